@@ -3,11 +3,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"pet-mgt/backend/internal/config"
+	"pet-mgt/backend/internal/payments"
 	"pet-mgt/backend/internal/routes"
 	"pet-mgt/backend/internal/store"
 	"syscall"
@@ -24,7 +26,7 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	db, err := store.NewSupabaseService(cfg)
+	db, err := newDatabase(ctx, cfg)
 	if err != nil {
 		log.Fatalf("failed to initialize database: %v", err)
 	}
@@ -36,7 +38,20 @@ func main() {
 		log.Println("database connection established")
 	}
 
-	r := routes.SetupRouter(cfg, db)
+	gateway, err := payments.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize payment gateway: %v", err)
+	}
+	if cfg.PaymentGateway == config.GatewayNone {
+		log.Println("no payment gateway configured; online payments are refused")
+	}
+
+	bootstrapAdmins(ctx, db, cfg.BootstrapAdminIDs)
+
+	go purgeTrash(ctx, db, cfg.TrashRetention)
+	go expireReservations(ctx, db)
+
+	r := routes.SetupRouter(cfg, db, gateway)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -85,3 +100,81 @@ func main() {
 
 	log.Println("cleanup completed")
 }
+
+// newDatabase builds the store.Database selected by cfg.DatabaseDriver
+func newDatabase(ctx context.Context, cfg *config.Config) (store.Database, error) {
+	switch cfg.DatabaseDriver {
+	case config.DriverPostgres:
+		return store.NewPostgresStore(ctx, cfg.DatabaseURL)
+	case config.DriverMemory:
+		log.Println("using in-memory database; data will not persist across restarts")
+		return store.NewMemoryStore(), nil
+	default:
+		return store.NewSupabaseService(cfg)
+	}
+}
+
+// bootstrapAdmins adds the configured users to the admin registry, keeping
+// the email of any profile they have. Users who are admins already are left
+// as they are, so the list can stay configured across restarts.
+func bootstrapAdmins(ctx context.Context, db store.Database, userIDs []string) {
+	for _, id := range userIDs {
+		var email string
+		if user, err := db.GetUserByID(ctx, id); err == nil {
+			email = user.Email
+		}
+		err := db.GrantAdmin(ctx, store.NewAdminGrant(id, email, "", ""))
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			log.Printf("bootstrapping admin %s failed: %v", id, err)
+			continue
+		}
+		log.Printf("bootstrapped admin %s", id)
+	}
+}
+
+// purgeTrash permanently removes rows that have been in the trash for longer
+// than retention, once at startup and then every hour until ctx is cancelled
+func purgeTrash(ctx context.Context, db store.Database, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		purged, err := db.PurgeDeleted(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("trash purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("purged %d rows from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireReservations releases the stock held by checkout reservations that
+// lapsed, once at startup and then every minute until ctx is cancelled
+func expireReservations(ctx context.Context, db store.Database) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		expired, err := db.ExpireReservations(ctx, time.Now())
+		if err != nil {
+			log.Printf("reservation expiry failed: %v", err)
+		} else if expired > 0 {
+			log.Printf("expired %d reservations", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package main contains the schema migration command
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"pet-mgt/backend/internal/migrate"
+	"pet-mgt/backend/migrations"
+	"strconv"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage: migrate [flags] <command>
+
+commands:
+  up              apply all pending migrations
+  down [n]        revert the last n applied migrations (default 1)
+  status          list migrations and whether they are applied
+  create <name>   add an empty up/down pair to the migrations directory
+
+flags:
+`
+
+func main() {
+	_ = godotenv.Load()
+
+	databaseURL := flag.String("database", os.Getenv("DATABASE_URL"), "PostgreSQL connection string")
+	dir := flag.String("dir", "migrations", "migrations directory used by create")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, *databaseURL, *dir, flag.Args()); err != nil {
+		log.Fatalf("migrate: %v", err)
+	}
+}
+
+// run executes a single migrate command
+func run(ctx context.Context, databaseURL, dir string, args []string) error {
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New("create requires a migration name")
+		}
+		up, down, err := migrate.Create(dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s\ncreated %s\n", up, down)
+		return nil
+	}
+
+	if databaseURL == "" {
+		return errors.New("DATABASE_URL or -database is required")
+	}
+
+	loaded, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return fmt.Errorf("connect postgres: %w", err)
+	}
+	defer pool.Close()
+
+	runner := migrate.NewRunner(pool, loaded)
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		reverted, err := runner.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
@@ -5,10 +5,31 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// Supported database drivers
+const (
+	DriverSupabase = "supabase"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// Supported payment gateways. "none" switches online payments off.
+const (
+	GatewayNone = "none"
+	GatewayFake = "fake"
+)
+
+// Deployment environments. ENV defaults to production, so a deploy that
+// forgets to set it gets the strict checks.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
 type Config struct {
 	// server config
 	Port string
@@ -17,10 +38,41 @@ type Config struct {
 	// URL for frontend
 	FrontendURL string
 
+	// Database backend: "supabase" (default), "postgres" or "memory"
+	DatabaseDriver string
+	// PostgreSQL connection string, required when DatabaseDriver is "postgres"
+	DatabaseURL string
+
 	// Supabase config
 	SupabaseURL        string
 	SupabaseServiceKey string
 	SupabaseJWTSecret  string
+
+	// Token verification: a JWKS URL or file whose keys verify asymmetric
+	// tokens, how often it is reloaded, and the issuer and audience tokens
+	// must carry when set. SupabaseJWTSecret still verifies HMAC tokens.
+	JWKSURL     string
+	JWKSRefresh time.Duration
+	JWTIssuer   string
+	JWTAudience string
+
+	// How long deleted rows stay in the trash before they are purged
+	TrashRetention time.Duration
+
+	// How long checkout holds stock for a client before releasing it
+	ReservationTTL time.Duration
+
+	// Payment gateway: "none" (default), which takes no payments, or "fake",
+	// which moves no money and is only allowed in development or on the
+	// memory store
+	PaymentGateway string
+	// Secret that signs the payment gateway's webhooks; without it every
+	// webhook is refused
+	PaymentWebhookSecret string
+
+	// User IDs added to the admin registry at startup, so the first admin
+	// can be created before anyone is able to grant the role
+	BootstrapAdminIDs []string
 }
 
 // LoadCfg loads the configuration from the environment
@@ -31,18 +83,49 @@ func LoadCfg() (*Config, error) {
 	// Load .env if present; ignore if missing (prod uses real env vars)
 	_ = godotenv.Load()
 
+	trashRetention, err := time.ParseDuration(getEnv("TRASH_RETENTION", "720h"))
+	if err != nil || trashRetention <= 0 {
+		return nil, fmt.Errorf("TRASH_RETENTION must be a positive duration such as 720h")
+	}
+
+	reservationTTL, err := time.ParseDuration(getEnv("RESERVATION_TTL", "15m"))
+	if err != nil || reservationTTL <= 0 {
+		return nil, fmt.Errorf("RESERVATION_TTL must be a positive duration such as 15m")
+	}
+
+	jwksRefresh, err := time.ParseDuration(getEnv("JWT_JWKS_REFRESH", "10m"))
+	if err != nil || jwksRefresh <= 0 {
+		return nil, fmt.Errorf("JWT_JWKS_REFRESH must be a positive duration such as 10m")
+	}
+
 	cfg := &Config{
 		Port: getEnv("PORT", "3000"),
-		Env:  getEnv("ENV", "development"),
+		Env:  getEnv("ENV", EnvProduction),
 
 		FrontendURL: getEnv("FRONTEND_URL", ""),
 
+		DatabaseDriver: getEnv("DB_DRIVER", DriverSupabase),
+		DatabaseURL:    getEnv("DATABASE_URL", ""),
+
 		SupabaseURL:        getEnv("SUPABASE_URL", ""),
 		SupabaseServiceKey: getEnv("SUPABASE_SERVICE_KEY", ""),
 		SupabaseJWTSecret:  getEnv("SUPABASE_JWT_SECRET", ""),
+
+		JWKSURL:     getEnv("JWT_JWKS_URL", ""),
+		JWKSRefresh: jwksRefresh,
+		JWTIssuer:   getEnv("JWT_ISSUER", ""),
+		JWTAudience: getEnv("JWT_AUDIENCE", ""),
+
+		TrashRetention: trashRetention,
+		ReservationTTL: reservationTTL,
+
+		PaymentGateway:       getEnv("PAYMENT_GATEWAY", GatewayNone),
+		PaymentWebhookSecret: getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+
+		BootstrapAdminIDs: splitList(getEnv("BOOTSTRAP_ADMIN_IDS", "")),
 	}
 
-	err := cfg.validateConfig()
+	err = cfg.validateConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -59,18 +142,58 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // validateConfig ensures all required environment variables are present
 func (cfg *Config) validateConfig() error {
 	var missingVars []string
 
-	if cfg.SupabaseURL == "" {
-		missingVars = append(missingVars, "SUPABASE_URL")
+	switch cfg.DatabaseDriver {
+	case DriverSupabase:
+		if cfg.SupabaseURL == "" {
+			missingVars = append(missingVars, "SUPABASE_URL")
+		}
+		if cfg.SupabaseServiceKey == "" {
+			missingVars = append(missingVars, "SUPABASE_SERVICE_KEY")
+		}
+	case DriverPostgres:
+		if cfg.DatabaseURL == "" {
+			missingVars = append(missingVars, "DATABASE_URL")
+		}
+	case DriverMemory:
+		// No external database required
+	default:
+		return fmt.Errorf("unsupported DB_DRIVER %q", cfg.DatabaseDriver)
 	}
-	if cfg.SupabaseServiceKey == "" {
-		missingVars = append(missingVars, "SUPABASE_SERVICE_KEY")
+
+	switch cfg.PaymentGateway {
+	case GatewayNone:
+		// Payments are refused, so there is nothing to configure
+	case GatewayFake:
+		// The fake gateway captures whatever it is asked to, so it must never
+		// take real orders
+		if cfg.Env != EnvDevelopment && cfg.DatabaseDriver != DriverMemory {
+			return fmt.Errorf(
+				"PAYMENT_GATEWAY %q is only allowed with ENV=%s or DB_DRIVER=%s",
+				GatewayFake, EnvDevelopment, DriverMemory,
+			)
+		}
+	default:
+		return fmt.Errorf("unsupported PAYMENT_GATEWAY %q", cfg.PaymentGateway)
 	}
-	if cfg.SupabaseJWTSecret == "" {
-		missingVars = append(missingVars, "SUPABASE_JWT_SECRET")
+
+	// Tokens need something to verify them against
+	if cfg.SupabaseJWTSecret == "" && cfg.JWKSURL == "" {
+		missingVars = append(missingVars, "SUPABASE_JWT_SECRET or JWT_JWKS_URL")
 	}
 
 	if len(missingVars) > 0 {
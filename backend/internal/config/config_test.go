@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestValidateConfigPayments tests that the fake payment gateway stays out of
+// production and that only gateways that exist are accepted
+func TestValidateConfigPayments(t *testing.T) {
+	base := func() *Config {
+		return &Config{
+			Env:                  EnvDevelopment,
+			DatabaseDriver:       DriverPostgres,
+			DatabaseURL:          "postgres://localhost/petmgt",
+			SupabaseJWTSecret:    "secret",
+			PaymentGateway:       GatewayFake,
+			PaymentWebhookSecret: "whsec",
+		}
+	}
+
+	cases := []struct {
+		name    string
+		edit    func(*Config)
+		wantErr string
+	}{
+		{"fake gateway in development", func(*Config) {}, ""},
+		{"fake gateway on the memory store", func(c *Config) { c.Env = EnvProduction; c.DatabaseDriver = DriverMemory }, ""},
+		{"fake gateway in production", func(c *Config) { c.Env = EnvProduction }, "PAYMENT_GATEWAY"},
+		{"fake gateway without a webhook secret", func(c *Config) { c.PaymentWebhookSecret = "" }, ""},
+		{"no gateway in production", func(c *Config) {
+			c.Env = EnvProduction
+			c.PaymentGateway = GatewayNone
+			c.PaymentWebhookSecret = ""
+		}, ""},
+		{"unknown gateway", func(c *Config) { c.PaymentGateway = "acme" }, "unsupported PAYMENT_GATEWAY"},
+	}
+	for _, tc := range cases {
+		cfg := base()
+		tc.edit(cfg)
+		err := cfg.validateConfig()
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: expected an error mentioning %s, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
@@ -2,12 +2,12 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
 	"pet-mgt/backend/internal/store"
-	"strconv"
 	"strings"
 	"time"
 
@@ -58,40 +58,28 @@ func (h *AppointmentHandler) CreateAppointment(w http.ResponseWriter, r *http.Re
 		req.DurationMinutes = 30 // Default duration
 	}
 
-	// Verify user is client and owns the pet (unless admin)
-	role := deriveRole(r.Context(), h.db, user)
-	if role != "admin" {
-		if role != "client" {
-			ErrorResponse(w, http.StatusForbidden, "Only clients can book appointments")
-			return
-		}
-
-		// Verify pet ownership
-		pet, err := h.db.GetPetByID(r.Context(), req.PetID)
-		if err != nil {
-			ErrorResponse(w, http.StatusNotFound, "Pet not found")
-			return
-		}
-		if pet.OwnerID != user.Sub {
-			ErrorResponse(
-				w,
-				http.StatusForbidden,
-				"You can only book appointments for your own pets",
-			)
-			return
-		}
+	// Clients book for their own pets and pets they may book for; admins for
+	// any
+	pet, err := h.db.GetPetByID(r.Context(), req.PetID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Pet not found")
+		return
+	}
+	obj := policy.Object{Resource: policy.Appointment, OwnerID: pet.OwnerID, PetID: pet.ID}
+	if !authorize(w, r, h.db, user, policy.Create, obj) {
+		return
 	}
 
 	// Verify veterinarian exists
-	_, err := h.db.GetVeterinarianByID(r.Context(), req.VeterinarianID)
+	_, err = h.db.GetVeterinarianByID(r.Context(), req.VeterinarianID)
 	if err != nil {
 		ErrorResponse(w, http.StatusNotFound, "Veterinarian not found")
 		return
 	}
 
-	// Create appointment
+	// Create appointment, which is always the pet owner's
 	appointment := store.NewAppointment(
-		user.Sub,
+		pet.OwnerID,
 		req.VeterinarianID,
 		req.PetID,
 		req.AppointmentDate,
@@ -130,6 +118,7 @@ func (h *AppointmentHandler) CreateAppointment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditCreate, store.EntityAppointment, appointment.ID, nil, appointment)
 	SuccessResponse(w, appointment)
 }
 
@@ -142,44 +131,36 @@ func (h *AppointmentHandler) GetAppointments(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := listFilter(r, h.db, user, policy.Appointment)
+	if !authorize(w, r, h.db, user, policy.List, filter) {
+		return
+	}
+
 	var appointments []store.Appointment
-	var err error
-
-	role := deriveRole(r.Context(), h.db, user)
-
-	switch role {
-	case "client":
-		appointments, err = h.db.GetAppointmentsByClientID(r.Context(), user.Sub)
-	case "veterinarian":
-		appointments, err = h.db.GetAppointmentsByVeterinarianID(r.Context(), user.Sub)
-	case "admin":
-		// For admin, check query params to see if they want specific user's appointments
-		clientID := r.URL.Query().Get("client_id")
-		vetID := r.URL.Query().Get("veterinarian_id")
-
-		if clientID != "" {
-			appointments, err = h.db.GetAppointmentsByClientID(r.Context(), clientID)
-		} else if vetID != "" {
-			appointments, err = h.db.GetAppointmentsByVeterinarianID(r.Context(), vetID)
-		} else {
-			// NOTE: Return all appointments would need a new method - for now return empty
-			appointments = []store.Appointment{}
-		}
+	var next string
+
+	switch {
+	case filter.OwnerID != "":
+		appointments, next, err = h.db.GetAppointmentsByClientID(r.Context(), filter.OwnerID, page)
+	case filter.VeterinarianID != "":
+		appointments, next, err = h.db.GetAppointmentsByVeterinarianID(r.Context(), filter.VeterinarianID, page)
 	default:
-		ErrorResponse(w, http.StatusForbidden, "Invalid user role")
-		return
+		// NOTE: Return all appointments would need a new method - for now return empty
+		appointments = []store.Appointment{}
 	}
 
 	if err != nil {
-		ErrorResponse(
-			w,
-			http.StatusInternalServerError,
-			"Failed to retrieve appointments",
-		)
+		listErrorResponse(w, err, "Failed to retrieve appointments")
 		return
 	}
 
-	SuccessResponse(w, appointments)
+	ListResponse(w, appointments, next)
 }
 
 // GetAppointment retrieves a specific appointment
@@ -204,27 +185,11 @@ func (h *AppointmentHandler) GetAppointment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Check permissions
-	role := deriveRole(r.Context(), h.db, user)
-	if role != "admin" {
-		if role == "client" && appointment.ClientID != user.Sub {
-			ErrorResponse(
-				w,
-				http.StatusForbidden,
-				"You can only view your own appointments",
-			)
-			return
-		}
-		if role == "veterinarian" && appointment.VeterinarianID != user.Sub {
-			ErrorResponse(
-				w,
-				http.StatusForbidden,
-				"You can only view your own appointments",
-			)
-			return
-		}
+	if !authorize(w, r, h.db, user, policy.Read, appointmentObject(appointment)) {
+		return
 	}
 
+	setETag(w, appointment.Version)
 	SuccessResponse(w, appointment)
 }
 
@@ -250,23 +215,11 @@ func (h *AppointmentHandler) UpdateAppointment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Check permissions
-	canUpdate := false
-	role := deriveRole(r.Context(), h.db, user)
-	if role == "admin" {
-		canUpdate = true
-	} else if role == "client" && appointment.ClientID == user.Sub {
-		canUpdate = true
-	} else if role == "veterinarian" && appointment.VeterinarianID == user.Sub {
-		canUpdate = true
+	if !authorize(w, r, h.db, user, policy.Update, appointmentObject(appointment)) {
+		return
 	}
 
-	if !canUpdate {
-		ErrorResponse(
-			w,
-			http.StatusForbidden,
-			"You can only update your own appointments",
-		)
+	if !checkIfMatch(w, r, appointment.Version) {
 		return
 	}
 
@@ -284,8 +237,17 @@ func (h *AppointmentHandler) UpdateAppointment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Update fields
+	before := *appointment
+	now := time.Now()
+
+	// Update fields. An appointment that took place lets its veterinarian see
+	// the pet's records, so none may be moved into the past or completed
+	// before it starts.
 	if updateData.AppointmentDate != nil {
+		if !updateData.AppointmentDate.Equal(appointment.AppointmentDate) && updateData.AppointmentDate.Before(now) {
+			ErrorResponse(w, http.StatusBadRequest, "Appointment date cannot be in the past")
+			return
+		}
 		appointment.AppointmentDate = *updateData.AppointmentDate
 	}
 	if updateData.DurationMinutes != nil {
@@ -306,20 +268,26 @@ func (h *AppointmentHandler) UpdateAppointment(w http.ResponseWriter, r *http.Re
 			ErrorResponse(w, http.StatusBadRequest, "Invalid status")
 			return
 		}
+		if updateData.Status == "completed" && appointment.AppointmentDate.After(now) {
+			ErrorResponse(w, http.StatusBadRequest, "Appointment has not started yet")
+			return
+		}
 		appointment.Status = updateData.Status
 	}
 	if updateData.Notes != "" {
 		appointment.Notes = updateData.Notes
 	}
 
-	appointment.UpdatedAt = time.Now()
+	appointment.UpdatedAt = now
 
 	// Update appointment
 	if err := h.db.UpdateAppointment(r.Context(), appointment); err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to update appointment")
+		updateErrorResponse(w, err, "Failed to update appointment")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityAppointment, appointment.ID, before, appointment)
+	setETag(w, appointment.Version)
 	SuccessResponse(w, appointment)
 }
 
@@ -345,35 +313,25 @@ func (h *AppointmentHandler) DeleteAppointment(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Check permissions
-	canDelete := false
-	role := deriveRole(r.Context(), h.db, user)
-	if role == "admin" {
-		canDelete = true
-	} else if role == "client" && appointment.ClientID == user.Sub {
-		canDelete = true
-	} else if role == "veterinarian" && appointment.VeterinarianID == user.Sub {
-		canDelete = true
-	}
-
-	if !canDelete {
-		ErrorResponse(
-			w,
-			http.StatusForbidden,
-			"You can only cancel your own appointments",
-		)
+	if !authorize(w, r, h.db, user, policy.Cancel, appointmentObject(appointment)) {
 		return
 	}
 
 	// Cancel appointment (soft delete by updating status)
+	before := *appointment
 	appointment.Status = "cancelled"
 	appointment.UpdatedAt = time.Now()
 
 	if err := h.db.UpdateAppointment(r.Context(), appointment); err != nil {
+		if errors.Is(err, store.ErrVersionConflict) {
+			ErrorResponse(w, http.StatusConflict, "Appointment was modified, please retry")
+			return
+		}
 		ErrorResponse(w, http.StatusInternalServerError, "Failed to cancel appointment")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityAppointment, appointment.ID, before, appointment)
 	MessageResponse(w, http.StatusOK, "Appointment cancelled successfully")
 }
 
@@ -430,9 +388,8 @@ func (h *AppointmentHandler) SetAvailability(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Only the veterinarian themselves or admin can update availability
-	role := deriveRole(r.Context(), h.db, user)
-	if role != "admin" && !(role == "veterinarian" && user.Sub == vetID) {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	obj := policy.Object{Resource: policy.Availability, VeterinarianID: vetID}
+	if !authorize(w, r, h.db, user, policy.Update, obj) {
 		return
 	}
 
@@ -461,6 +418,7 @@ func (h *AppointmentHandler) SetAvailability(w http.ResponseWriter, r *http.Requ
 		})
 	}
 
+	before := *vet
 	vet.AvailableHours = normalized
 	if req.ClinicAddress != "" {
 		vet.ClinicAddress = req.ClinicAddress
@@ -471,6 +429,7 @@ func (h *AppointmentHandler) SetAvailability(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityUser, vet.ID, before, vet)
 	SuccessResponse(w, vet)
 }
 
@@ -496,58 +455,28 @@ func normalizeDay(input string) string {
 	}
 }
 
-// deriveRole maps generic or missing roles from the JWT to concrete application roles
-// by querying the database. If the user's role is already a concrete role, it is returned as-is.
-func deriveRole(ctx context.Context, db store.Database, user *middleware.UserClaims) string {
-	role := user.Role
-	if role == "authenticated" || role == "user" || role == "" {
-		if c, err := db.GetClientByID(ctx, user.Sub); err == nil && c != nil && c.Role != "" {
-			return c.Role
-		}
-		if v, err := db.GetVeterinarianByID(ctx, user.Sub); err == nil && v != nil && v.Role != "" {
-			return v.Role
-		}
-	}
-	return role
-}
-
 // ListVeterinarians returns all veterinarians for appointment booking
 func (h *AppointmentHandler) ListVeterinarians(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-
-	limit := 10
-	offset := 0
-
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// NOTE: For now, we'll use the existing ListUsers method and filter by role
+	// NOTE: For now, we'll use the existing ListUsers method and filter by
+	// profile, so a page may hold fewer veterinarians than the limit. The
+	// profile rather than the role keeps veterinarians who are also admins.
 	// In a real implementation, you'd want a dedicated method for listing veterinarians
-	users, err := h.db.ListUsers(r.Context(), limit, offset)
+	users, next, err := h.db.ListUsers(r.Context(), "", page)
 	if err != nil {
-		ErrorResponse(
-			w,
-			http.StatusInternalServerError,
-			"Failed to retrieve veterinarians",
-		)
+		listErrorResponse(w, err, "Failed to retrieve veterinarians")
 		return
 	}
 
 	// Filter to only veterinarians and convert to proper format
-	var veterinarians []map[string]any
+	veterinarians := []map[string]any{}
 	for _, user := range users {
-		if user.Role == "veterinarian" {
+		if user.Profile == store.RoleVeterinarian {
 			// Get full veterinarian details
 			vet, err := h.db.GetVeterinarianByID(r.Context(), user.ID)
 			if err == nil {
@@ -563,5 +492,17 @@ func (h *AppointmentHandler) ListVeterinarians(w http.ResponseWriter, r *http.Re
 		}
 	}
 
-	SuccessResponse(w, veterinarians)
+	ListResponse(w, veterinarians, next)
+}
+
+// appointmentObject describes appointment to the policy: it belongs to the
+// client it was booked for, concerns their pet and is assigned to its
+// veterinarian
+func appointmentObject(appointment *store.Appointment) policy.Object {
+	return policy.Object{
+		Resource:       policy.Appointment,
+		OwnerID:        appointment.ClientID,
+		VeterinarianID: appointment.VeterinarianID,
+		PetID:          appointment.PetID,
+	}
 }
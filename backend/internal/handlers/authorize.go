@@ -0,0 +1,124 @@
+// Package handlers contains the authorization checks handlers make before acting
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"time"
+)
+
+// authorize checks the policy lets user take action on obj, writing the 403
+// response and returning false if not. It looks up the pet access grants and
+// record consents the policy needs to decide. Every refusal gets the same
+// response, so it does not tell callers whether the object is someone else's
+// or the action is closed to their role.
+func authorize(
+	w http.ResponseWriter,
+	r *http.Request,
+	db store.Database,
+	user *middleware.UserClaims,
+	action policy.Action,
+	obj policy.Object,
+) bool {
+	sub := policy.Subject{ID: user.Sub, Role: deriveRole(r.Context(), db, user)}
+	if _, ok := policy.Delegable(action, obj.Resource); ok &&
+		sub.Role == policy.RoleClient && obj.OwnerID != "" && obj.OwnerID != user.Sub {
+		sub.Delegations = delegations(r.Context(), db, user.Sub)
+	}
+	if obj.PetID != "" && policy.RequiresConsent(sub.Role, action, obj.Resource) {
+		obj.Consented = consented(r.Context(), db, user.Sub, obj.PetID)
+	}
+	if err := policy.Authorize(sub, action, obj); err != nil {
+		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+		return false
+	}
+	return true
+}
+
+// delegations are the active pet access grants clientID holds. A failed
+// lookup leaves them without any, so the request is refused.
+func delegations(ctx context.Context, db store.Database, clientID string) []policy.Delegation {
+	grants, err := db.GetGranteePetAccessGrants(ctx, clientID)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	var delegations []policy.Delegation
+	for _, g := range grants {
+		if !g.Active(now) {
+			continue
+		}
+		d := policy.Delegation{OwnerID: g.OwnerID, PetID: g.PetID}
+		for _, p := range g.Permissions {
+			d.Permissions = append(d.Permissions, policy.Permission(p))
+		}
+		delegations = append(delegations, d)
+	}
+	return delegations
+}
+
+// consented reports whether veterinarian vetID may see the records of
+// petID: they had an appointment for it within
+// store.AppointmentConsentWindow that has taken place, or hold an active
+// grant or break-glass access. A failed lookup counts as no consent.
+func consented(ctx context.Context, db store.Database, vetID, petID string) bool {
+	consents, err := db.GetPetRecordConsents(ctx, petID)
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	for _, c := range consents {
+		if c.VeterinarianID == vetID && c.Active(now) {
+			return true
+		}
+	}
+	since := now.Add(-store.AppointmentConsentWindow)
+	seen, err := db.HasPetAppointment(ctx, petID, vetID, since, now)
+	return err == nil && seen
+}
+
+// deriveRole maps generic or missing roles from the JWT to concrete application roles
+// by querying the database. If the user's role is already a concrete role, it is returned as-is.
+func deriveRole(ctx context.Context, db store.Database, user *middleware.UserClaims) string {
+	role := user.Role
+	if role == "authenticated" || role == "user" || role == "" {
+		if c, err := db.GetClientByID(ctx, user.Sub); err == nil && c != nil && c.Role != "" {
+			return c.Role
+		}
+		if v, err := db.GetVeterinarianByID(ctx, user.Sub); err == nil && v != nil && v.Role != "" {
+			return v.Role
+		}
+	}
+	return role
+}
+
+// listFilter is whose resource objects a list request asks for: the client
+// in the client_id query parameter, else the veterinarian in
+// veterinarian_id. Without either, clients and veterinarians get their own.
+func listFilter(
+	r *http.Request,
+	db store.Database,
+	user *middleware.UserClaims,
+	resource policy.Resource,
+) policy.Object {
+	filter := policy.Object{
+		Resource:       resource,
+		OwnerID:        r.URL.Query().Get("client_id"),
+		VeterinarianID: r.URL.Query().Get("veterinarian_id"),
+	}
+	if filter.OwnerID != "" {
+		filter.VeterinarianID = ""
+	}
+	if filter.OwnerID == "" && filter.VeterinarianID == "" {
+		switch deriveRole(r.Context(), db, user) {
+		case policy.RoleClient:
+			filter.OwnerID = user.Sub
+		case policy.RoleVeterinarian:
+			filter.VeterinarianID = user.Sub
+		}
+	}
+	return filter
+}
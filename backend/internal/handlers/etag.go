@@ -0,0 +1,50 @@
+// Package handlers/etag.go contains ETag and If-Match helpers for versioned entities
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pet-mgt/backend/internal/store"
+	"strconv"
+	"strings"
+)
+
+// etag formats an entity version as a strong entity tag
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag tags the response with the version of the entity it carries
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// checkIfMatch enforces the If-Match precondition of an update against the
+// entity's current version. It writes 428 when the header is missing and 412
+// when no listed tag matches, and reports whether the update may go ahead.
+// "*" matches nothing: an update must name the version it was made against.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		ErrorResponse(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return false
+	}
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+	ErrorResponse(w, http.StatusPreconditionFailed, "Resource has been modified")
+	return false
+}
+
+// updateErrorResponse reports a failed update. Losing a race to another
+// writer fails the If-Match precondition; anything else is a server error.
+func updateErrorResponse(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, store.ErrVersionConflict) {
+		ErrorResponse(w, http.StatusPreconditionFailed, "Resource has been modified")
+		return
+	}
+	ErrorResponse(w, http.StatusInternalServerError, message)
+}
@@ -3,6 +3,7 @@ package handlers
 
 import (
 	"pet-mgt/backend/internal/config"
+	"pet-mgt/backend/internal/payments"
 	"pet-mgt/backend/internal/store"
 )
 
@@ -10,22 +11,48 @@ import (
 type Handlers struct {
 	User          *UserHandler
 	Pet           *PetHandler
+	PetAccess     *PetAccessHandler
 	MedicalRecord *MedicalRecordHandler
+	RecordConsent *RecordConsentHandler
 	QRCode        *QRCodeHandler
 	Appointment   *AppointmentHandler
 	Product       *ProductHandler
 	Order         *OrderHandler
+	Reservation   *ReservationHandler
+	Payment       *PaymentHandler
+	Return        *ReturnHandler
+	Invoice       *InvoiceHandler
+	Tax           *TaxHandler
+	Promotion     *PromotionHandler
+	Trash         *TrashHandler
+	Audit         *AuditHandler
 }
 
-// NewHandlers creates a new Handlers instance with all handler dependencies
-func NewHandlers(cfg *config.Config, db store.Database) *Handlers {
+// NewHandlers creates a new Handlers instance with all handler dependencies.
+// Payments and returns share gateway, which the fake one needs to find the
+// intents it created.
+func NewHandlers(cfg *config.Config, db store.Database, gateway payments.Gateway) *Handlers {
 	return &Handlers{
 		User:          NewUserHandler(db),
 		Pet:           NewPetHandler(db),
+		PetAccess:     NewPetAccessHandler(db),
 		MedicalRecord: NewMedicalRecordHandler(db),
+		RecordConsent: NewRecordConsentHandler(db),
 		QRCode:        NewQRCodeHandler(db, cfg.FrontendURL),
 		Appointment:   NewAppointmentHandler(db),
 		Product:       NewProductHandler(db),
 		Order:         NewOrderHandler(db),
+		Reservation:   NewReservationHandler(db, cfg.ReservationTTL),
+		Payment: NewPaymentHandler(
+			db,
+			gateway,
+			cfg.PaymentWebhookSecret,
+		),
+		Return:    NewReturnHandler(db, gateway),
+		Invoice:   NewInvoiceHandler(db),
+		Tax:       NewTaxHandler(db),
+		Promotion: NewPromotionHandler(db),
+		Trash:     NewTrashHandler(db),
+		Audit:     NewAuditHandler(db),
 	}
 }
@@ -5,479 +5,1701 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"pet-mgt/backend/internal/config"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/payments"
 	"pet-mgt/backend/internal/store"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
-// MockDatabase implements the Database interface for testing
-type MockDatabase struct {
-	users map[string]*store.User
-	pets  map[string]*store.Pet
+// Helper function to create a request with context
+func createRequestWithContext(
+	method, path string,
+	body any,
+	user *middleware.UserClaims,
+) *http.Request {
+	var req *http.Request
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		req = httptest.NewRequest(method, path, bytes.NewBuffer(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+
+	ctx := context.WithValue(req.Context(), middleware.UserContextKey, user)
+	return req.WithContext(ctx)
 }
 
-func NewMockDatabase() *MockDatabase {
-	return &MockDatabase{
-		users: make(map[string]*store.User),
-		pets:  make(map[string]*store.Pet),
-	}
+// usd is major units of US dollars, such as usd(19.99)
+func usd(major float64) store.Money {
+	return store.MoneyFromMajor(major, "USD")
 }
 
-func (m *MockDatabase) GetUserByID(
-	ctx context.Context,
-	userID string,
-) (*store.User, error) {
-	if user, exists := m.users[userID]; exists {
-		return user, nil
+// TestGetUserProfile tests the GetUserProfile handler
+func TestGetUserProfile(t *testing.T) {
+	user := &middleware.UserClaims{
+		Sub:   "test-user-id",
+		Email: "test@example.com",
+		Role:  "client",
 	}
-	return nil, nil
-}
 
-func (m *MockDatabase) CreateUser(ctx context.Context, user *store.User) error {
-	m.users[user.ID] = user
-	return nil
+	// Create handler with in-memory database
+	db := store.NewMemoryStore()
+	userHandler := NewUserHandler(db)
+
+	req := createRequestWithContext("GET", "/api/v1/profile", nil, user)
+	w := httptest.NewRecorder()
+
+	userHandler.GetUserProfile(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Errorf("Failed to parse response: %v", err)
+	}
+
+	if response["user_id"] != user.Sub {
+		t.Errorf("Expected user_id %s, got %s", user.Sub, response["user_id"])
+	}
 }
 
-func (m *MockDatabase) UpdateUser(ctx context.Context, user *store.User) error {
-	m.users[user.ID] = user
-	return nil
+// TestCreateUser tests the CreateUser handler
+func TestCreateUser(t *testing.T) {
+	user := &middleware.UserClaims{
+		Sub:   "test-user-id",
+		Email: "test@example.com",
+		Role:  "client",
+	}
+
+	// Create handler with in-memory database
+	db := store.NewMemoryStore()
+	userHandler := NewUserHandler(db)
+
+	// Create test request
+	newUser := map[string]any{
+		"name":    "John Doe",
+		"email":   "john@example.com",
+		"phone":   "123-456-7890",
+		"address": "123 Main St",
+		"role":    "client",
+	}
+
+	req := createRequestWithContext("POST", "/api/v1/users", newUser, user)
+	w := httptest.NewRecorder()
+
+	userHandler.CreateUser(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Errorf("Failed to parse response: %v", err)
+	}
+
+	if !response["success"].(bool) {
+		t.Errorf("Expected success to be true")
+	}
 }
 
-func (m *MockDatabase) DeleteUser(ctx context.Context, userID string) error {
-	delete(m.users, userID)
-	return nil
+// TestCreateOrderInsufficientStock tests that a short order maps to 409 Conflict
+func TestCreateOrderInsufficientStock(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 1
+	_ = db.CreateProduct(ctx, product)
+
+	user := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	body := map[string]any{
+		"veterinarian_id": "vet-1",
+		"items":           []map[string]any{{"product_id": product.ID, "quantity": 2}},
+	}
+
+	req := createRequestWithContext("POST", "/api/v1/orders", body, user)
+	w := httptest.NewRecorder()
+	NewOrderHandler(db).CreateOrder(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
 }
 
-func (m *MockDatabase) ListUsers(
-	ctx context.Context,
-	limit, offset int,
-) ([]store.User, error) {
-	var users []store.User
-	for _, user := range m.users {
-		users = append(users, *user)
+// TestUpdateProductStock tests that stock updates are recorded in the ledger
+func TestUpdateProductStock(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+
+	vet := &middleware.UserClaims{Sub: "vet-1", Role: "veterinarian"}
+	withID := func(req *http.Request) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", product.ID)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	update := func(user *middleware.UserClaims, body map[string]any) *httptest.ResponseRecorder {
+		req := withID(createRequestWithContext("PUT", "/api/v1/products/"+product.ID+"/stock", body, user))
+		w := httptest.NewRecorder()
+		NewProductHandler(db).UpdateProductStock(w, req)
+		return w
+	}
+
+	other := &middleware.UserClaims{Sub: "vet-2", Role: "veterinarian"}
+	if w := update(other, map[string]any{"quantity": 8}); w.Code != http.StatusForbidden {
+		t.Errorf("As another vet: expected status 403, got %d", w.Code)
+	}
+	if w := update(vet, map[string]any{"type": "received", "change": -1}); w.Code != http.StatusBadRequest {
+		t.Errorf("Negative receipt: expected status 400, got %d", w.Code)
+	}
+	if w := update(vet, map[string]any{"type": "write_off", "change": -20}); w.Code != http.StatusConflict {
+		t.Errorf("Writing off more than in stock: expected status 409, got %d", w.Code)
+	}
+	if w := update(vet, map[string]any{"quantity": 8, "reason": "Stocktake"}); w.Code != http.StatusOK {
+		t.Fatalf("Setting the quantity: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Editing the product with a new count records the adjustment alongside
+	current, _ := db.GetProductByID(ctx, product.ID)
+	edit := withID(createRequestWithContext("PUT", "/api/v1/products/"+product.ID,
+		map[string]any{"name": "Counted kibble", "stock_quantity": 6}, vet))
+	edit.Header.Set("If-Match", `"`+strconv.Itoa(current.Version)+`"`)
+	w := httptest.NewRecorder()
+	NewProductHandler(db).UpdateProduct(w, edit)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Editing the product: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got, _ := db.GetProductByID(ctx, product.ID); got.Name != "Counted kibble" ||
+		got.StockQuantity != 6 || w.Header().Get("ETag") != `"`+strconv.Itoa(got.Version)+`"` {
+		t.Errorf("Editing the product: unexpected product %+v, ETag %s", got, w.Header().Get("ETag"))
+	}
+
+	req := withID(createRequestWithContext("GET", "/api/v1/products/"+product.ID+"/stock-history", nil, vet))
+	w = httptest.NewRecorder()
+	NewProductHandler(db).GetStockHistory(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Stock history: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []store.StockMovement `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data) != 3 {
+		t.Fatalf("Expected the opening balance and two adjustments, got %d movements", len(resp.Data))
+	}
+	if m := resp.Data[0]; m.Quantity != -2 || m.BalanceAfter != 6 || m.Reason != "Product update" {
+		t.Errorf("Unexpected product update adjustment %+v", m)
+	}
+	if m := resp.Data[1]; m.Type != store.StockAdjustment || m.Quantity != 5 ||
+		m.BalanceAfter != 8 || m.Reason != "Stocktake" || m.ActorID != "vet-1" {
+		t.Errorf("Unexpected adjustment %+v", m)
 	}
-	return users, nil
 }
 
-func (m *MockDatabase) GetPetsByUserID(
-	ctx context.Context,
-	userID string,
-) ([]store.Pet, error) {
-	var pets []store.Pet
-	for _, pet := range m.pets {
-		if pet.OwnerID == userID {
-			pets = append(pets, *pet)
+// TestCheckoutReservation tests that checkout reserves stock which confirming
+// turns into one order per veterinarian
+func TestCheckoutReservation(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-2", Email: "other@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-2", Email: "vet2@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+	toy := store.NewProduct("vet-2", "Ball", "", "toys", usd(5))
+	toy.StockQuantity = 1
+	_ = db.CreateProduct(ctx, toy)
+
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	other := &middleware.UserClaims{Sub: "client-2", Role: "client"}
+	h := NewReservationHandler(db, time.Hour)
+	checkout := func(user *middleware.UserClaims, quantity int) *httptest.ResponseRecorder {
+		body := map[string]any{
+			"items": []map[string]any{
+				{"product_id": product.ID, "quantity": quantity},
+				{"product_id": toy.ID, "quantity": 1},
+			},
 		}
+		w := httptest.NewRecorder()
+		h.CreateReservation(w, createRequestWithContext("POST", "/api/v1/products/checkout", body, user))
+		return w
 	}
-	return pets, nil
-}
 
-func (m *MockDatabase) GetPetByID(
-	ctx context.Context,
-	petID string,
-) (*store.Pet, error) {
-	if pet, exists := m.pets[petID]; exists {
-		return pet, nil
+	w := checkout(client, 2)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Checkout: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data store.Reservation `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w := checkout(other, 2); w.Code != http.StatusConflict {
+		t.Errorf("Checkout of reserved stock: expected status 409, got %d", w.Code)
 	}
-	return nil, nil
-}
 
-func (m *MockDatabase) CreatePet(ctx context.Context, pet *store.Pet) error {
-	m.pets[pet.ID] = pet
-	return nil
-}
+	withID := func(req *http.Request) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", created.Data.ID)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	confirm := func(user *middleware.UserClaims) *httptest.ResponseRecorder {
+		path := "/api/v1/reservations/" + created.Data.ID + "/confirm"
+		body := map[string]any{"delivery_method": "pickup"}
+		w := httptest.NewRecorder()
+		h.ConfirmReservation(w, withID(createRequestWithContext("POST", path, body, user)))
+		return w
+	}
+	if w := confirm(other); w.Code != http.StatusForbidden {
+		t.Errorf("Confirming another client's reservation: expected status 403, got %d", w.Code)
+	}
+	w = confirm(client)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Confirm: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var confirmed struct {
+		Data store.Checkout `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &confirmed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(confirmed.Data.Orders) != 2 || confirmed.Data.TotalAmount != usd(25) {
+		t.Errorf("Expected two orders totalling 25, got %+v", confirmed.Data)
+	}
+	if w := confirm(client); w.Code != http.StatusConflict {
+		t.Errorf("Confirming twice: expected status 409, got %d", w.Code)
+	}
 
-func (m *MockDatabase) UpdatePet(ctx context.Context, pet *store.Pet) error {
-	m.pets[pet.ID] = pet
-	return nil
+	orders, _, _ := db.GetOrdersByClientID(ctx, "client-1", store.Page{})
+	for _, o := range orders {
+		if o.CheckoutGroupID != confirmed.Data.ID || o.DeliveryMethod != "pickup" {
+			t.Errorf("Expected a pickup order in checkout %s, got %+v", confirmed.Data.ID, o)
+		}
+	}
+	if len(orders) != 2 {
+		t.Errorf("Expected one order per veterinarian, got %d", len(orders))
+	}
+	if p, _ := db.GetProductByID(ctx, product.ID); p.StockQuantity != 1 {
+		t.Errorf("Expected stock 1 after the order, got %d", p.StockQuantity)
+	}
 }
 
-func (m *MockDatabase) DeletePet(ctx context.Context, petID string) error {
-	delete(m.pets, petID)
-	return nil
-}
+// TestGetProductsPages tests that the product list pages by cursor and reports
+// the unpaged total
+func TestGetProductsPages(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	for _, price := range []float64{5, 10, 15} {
+		_ = db.CreateProduct(ctx, store.NewProduct("vet-1", "Kibble", "", "food", usd(price)))
+	}
 
-func (m *MockDatabase) GetMedicalRecordsByPetID(
-	ctx context.Context,
-	petID string,
-) ([]store.MedicalRecord, error) {
-	return []store.MedicalRecord{}, nil
-}
+	req := createRequestWithContext("GET", "/api/v1/products?sort=price_desc&limit=2", nil, nil)
+	w := httptest.NewRecorder()
+	NewProductHandler(db).GetProducts(w, req)
 
-func (m *MockDatabase) GetMedicalRecordByID(
-	ctx context.Context,
-	recordID string,
-) (*store.MedicalRecord, error) {
-	return nil, nil
-}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
 
-func (m *MockDatabase) CreateMedicalRecord(
-	ctx context.Context,
-	record *store.MedicalRecord,
-) error {
-	return nil
-}
+	var response struct {
+		Data       []store.Product `json:"data"`
+		Total      int             `json:"total"`
+		NextCursor *string         `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Total != 3 || len(response.Data) != 2 {
+		t.Errorf("Expected 2 of 3 products, got %d of %d", len(response.Data), response.Total)
+	}
+	if len(response.Data) > 0 && response.Data[0].Price != usd(15) {
+		t.Errorf("Expected most expensive product first, got price %v", response.Data[0].Price)
+	}
+	if response.NextCursor == nil {
+		t.Fatalf("Expected a next_cursor on the first page")
+	}
 
-func (m *MockDatabase) UpdateMedicalRecord(
-	ctx context.Context,
-	record *store.MedicalRecord,
-) error {
-	return nil
-}
+	req = createRequestWithContext(
+		"GET", "/api/v1/products?sort=price_desc&limit=2&cursor="+*response.NextCursor, nil, nil)
+	w = httptest.NewRecorder()
+	NewProductHandler(db).GetProducts(w, req)
 
-func (m *MockDatabase) DeleteMedicalRecord(ctx context.Context, recordID string) error {
-	return nil
+	response.NextCursor = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Data) != 1 || response.Data[0].Price != usd(5) {
+		t.Errorf("Expected the cheapest product alone on page 2, got %+v", response.Data)
+	}
+	if response.NextCursor != nil {
+		t.Errorf("Expected next_cursor to be null on the last page, got %q", *response.NextCursor)
+	}
 }
 
-func (m *MockDatabase) Ping(ctx context.Context) error {
-	return nil
+// TestGetProductsBadQuery tests that invalid filters are rejected with 400
+func TestGetProductsBadQuery(t *testing.T) {
+	db := store.NewMemoryStore()
+	for _, query := range []string{
+		"sort=cheapest",
+		"min_price=abc",
+		"max_price=-1",
+		"min_price=20&max_price=10",
+		"limit=0",
+		"cursor=bogus",
+	} {
+		req := createRequestWithContext("GET", "/api/v1/products?"+query, nil, nil)
+		w := httptest.NewRecorder()
+		NewProductHandler(db).GetProducts(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Query %q: expected status 400, got %d", query, w.Code)
+		}
+	}
 }
 
-func (m *MockDatabase) Close() error {
-	return nil
-}
+// TestUpdatePetIfMatch tests that pet updates require the current ETag
+func TestUpdatePetIfMatch(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	pet := store.NewPet("client-1", "Buddy", "Dog", "Beagle", time.Now(), 10)
+	_ = db.CreatePet(ctx, pet)
+
+	user := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	body := map[string]any{"name": "Max", "type": "Dog", "date_of_birth": time.Now()}
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		req := createRequestWithContext("PUT", "/api/v1/pets/"+pet.ID, body, user)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", pet.ID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		NewPetHandler(db).UpdatePet(w, req)
+		return w
+	}
 
-// Add these methods to MockDatabase:
-func (m *MockDatabase) CreateClient(ctx context.Context, client *store.Client) error {
-	// For test, just store as a User
-	m.users[client.ID] = &store.User{
-		ID:    client.ID,
-		Email: client.Email,
-		Role:  client.Role,
+	if w := update(""); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("Without If-Match: expected status 428, got %d", w.Code)
+	}
+	if w := update(`"7"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("With a stale ETag: expected status 412, got %d", w.Code)
+	}
+	if w := update("*"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("With If-Match: *: expected status 412, got %d", w.Code)
 	}
-	return nil
-}
 
-func (m *MockDatabase) CreateVeterinarian(
-	ctx context.Context,
-	vet *store.Veterinarian,
-) error {
-	m.users[vet.ID] = &store.User{ID: vet.ID, Email: vet.Email, Role: vet.Role}
-	return nil
+	w := update(`"1"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("With the current ETag: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("Expected ETag \"2\" after the update, got %s", got)
+	}
+	if w := update(`"1"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Reusing the old ETag: expected status 412, got %d", w.Code)
+	}
 }
 
-func (m *MockDatabase) UpdateClient(ctx context.Context, client *store.Client) error {
-	m.users[client.ID] = &store.User{
-		ID:    client.ID,
-		Email: client.Email,
-		Role:  client.Role,
+func TestRestoreDeleted(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	pet := store.NewPet("client-1", "Buddy", "Dog", "Beagle", time.Now(), 10)
+	_ = db.CreatePet(ctx, pet)
+	_ = db.DeletePet(ctx, pet.ID)
+
+	restore := func(user *middleware.UserClaims, entity, id string) *httptest.ResponseRecorder {
+		req := createRequestWithContext("POST", "/api/v1/pets/"+id+"/restore", nil, user)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		NewTrashHandler(db).Restore(entity)(w, req)
+		return w
 	}
-	return nil
-}
 
-func (m *MockDatabase) UpdateVeterinarian(
-	ctx context.Context,
-	vet *store.Veterinarian,
-) error {
-	m.users[vet.ID] = &store.User{ID: vet.ID, Email: vet.Email, Role: vet.Role}
-	return nil
+	admin := &middleware.UserClaims{Sub: "admin-1", Role: "admin"}
+	owner := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	if w := restore(owner, store.EntityPet, pet.ID); w.Code != http.StatusForbidden {
+		t.Errorf("As the owner: expected status 403, got %d", w.Code)
+	}
+	if w := restore(admin, store.EntityProduct, pet.ID); w.Code != http.StatusNotFound {
+		t.Errorf("With the wrong entity: expected status 404, got %d", w.Code)
+	}
+	if w := restore(admin, store.EntityPet, pet.ID); w.Code != http.StatusOK {
+		t.Fatalf("As an admin: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := db.GetPetByID(ctx, pet.ID); err != nil {
+		t.Errorf("Expected the pet to be restored, got %v", err)
+	}
 }
 
-func (m *MockDatabase) GetClientByID(
-	ctx context.Context,
-	clientID string,
-) (*store.Client, error) {
-	if u, ok := m.users[clientID]; ok {
-		return &store.Client{ID: u.ID, Email: u.Email, Role: u.Role}, nil
+// TestAuditLog tests that a pet update is recorded and only admins can list the log
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	pet := store.NewPet("client-1", "Buddy", "Dog", "Beagle", time.Now(), 10)
+	_ = db.CreatePet(ctx, pet)
+
+	owner := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	body := map[string]any{"name": "Max", "type": "Dog", "date_of_birth": time.Now()}
+	req := createRequestWithContext("PUT", "/api/v1/pets/"+pet.ID, body, owner)
+	req.Header.Set("If-Match", `"1"`)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", pet.ID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	NewPetHandler(db).UpdatePet(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Updating the pet: expected status 200, got %d: %s", w.Code, w.Body.String())
 	}
-	return nil, nil
-}
 
-func (m *MockDatabase) GetVeterinarianByID(
-	ctx context.Context,
-	vetID string,
-) (*store.Veterinarian, error) {
-	if u, ok := m.users[vetID]; ok {
-		return &store.Veterinarian{ID: u.ID, Email: u.Email, Role: u.Role}, nil
+	list := func(user *middleware.UserClaims) *httptest.ResponseRecorder {
+		req := createRequestWithContext("GET", "/api/v1/audit?entity_id="+pet.ID, nil, user)
+		w := httptest.NewRecorder()
+		NewAuditHandler(db).ListAuditEntries(w, req)
+		return w
 	}
-	return nil, nil
-}
 
-// QR Code operations (stub implementations for testing)
-func (m *MockDatabase) GetQRCodeByPetID(
-	ctx context.Context,
-	petID string,
-) (*store.QRCode, error) {
-	return nil, nil
-}
+	if w := list(owner); w.Code != http.StatusForbidden {
+		t.Errorf("As the owner: expected status 403, got %d", w.Code)
+	}
 
-func (m *MockDatabase) GetQRCodeByPublicURL(
-	ctx context.Context,
-	publicURL string,
-) (*store.QRCode, error) {
-	return nil, nil
+	w = list(&middleware.UserClaims{Sub: "admin-1", Role: "admin"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("As an admin: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []store.AuditEntry `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(resp.Data))
+	}
+	entry := resp.Data[0]
+	if entry.ActorID != "client-1" || entry.Action != store.AuditUpdate || entry.Entity != store.EntityPet {
+		t.Errorf("Unexpected audit entry %+v", entry)
+	}
+	if change, ok := entry.Changes["name"]; !ok || change.Before != "Buddy" || change.After != "Max" {
+		t.Errorf("Expected a name change from Buddy to Max, got %+v", entry.Changes)
+	}
 }
 
-func (m *MockDatabase) CreateQRCode(
-	ctx context.Context,
-	qrCode *store.QRCode,
-) error {
-	return nil
-}
+// TestPaymentWebhook tests that a signed gateway webhook settles a payment
+// and its order, that redeliveries are acknowledged without effect and that
+// unsigned events are rejected
+func TestPaymentWebhook(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+	order := store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 2, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
 
-func (m *MockDatabase) UpdateQRCode(
-	ctx context.Context,
-	qrCode *store.QRCode,
-) error {
-	return nil
-}
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	h := NewPaymentHandler(db, payments.NewFakeGateway(), "whsec")
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
 
-func (m *MockDatabase) DeleteQRCode(
-	ctx context.Context,
-	qrCodeID string,
-) error {
-	return nil
-}
+	pay := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		path := "/api/v1/orders/" + order.ID + "/payments"
+		h.CreatePayment(w, withID(createRequestWithContext("POST", path, nil, client), order.ID))
+		return w
+	}
+	w := pay()
+	if w.Code != http.StatusOK {
+		t.Fatalf("CreatePayment: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data struct {
+			Payment      store.Payment `json:"payment"`
+			ClientSecret string        `json:"client_secret"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	payment := created.Data.Payment
+	if payment.Amount != usd(20) || payment.Status != store.PaymentPending || created.Data.ClientSecret == "" {
+		t.Errorf("Expected a pending payment of 20 with a client secret, got %+v", created.Data)
+	}
+	if w := pay(); w.Code != http.StatusConflict {
+		t.Errorf("Paying with a payment pending: expected status 409, got %d", w.Code)
+	}
 
-func (m *MockDatabase) GetPublicPetProfile(
-	ctx context.Context,
-	publicURL string,
-) (*store.PublicPetProfile, error) {
-	return nil, nil
-}
+	webhook := func(secret string) *httptest.ResponseRecorder {
+		body := []byte(`{"id":"evt_1","type":"payment.succeeded","intent_id":"` + payment.IntentID + `"}`)
+		req := httptest.NewRequest("POST", "/api/v1/payments/webhook", bytes.NewReader(body))
+		req.Header.Set(payments.SignatureHeader, payments.Sign(secret, body, time.Now()))
+		w := httptest.NewRecorder()
+		h.HandleWebhook(w, req)
+		return w
+	}
+	if w := webhook("guess"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Webhook with a bad signature: expected status 401, got %d", w.Code)
+	}
+	if w := webhook("whsec"); w.Code != http.StatusOK {
+		t.Fatalf("Webhook: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	got, _ := db.GetOrderByID(ctx, order.ID)
+	if got.PaymentStatus != store.PaymentPaid {
+		t.Errorf("Expected the order paid, got %q", got.PaymentStatus)
+	}
+	if w := webhook("whsec"); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("ignored")) {
+		t.Errorf("Redelivered webhook: expected it ignored, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := pay(); w.Code != http.StatusConflict {
+		t.Errorf("Paying a paid order: expected status 409, got %d", w.Code)
+	}
 
-// Appointment operations (stub implementations for testing)
-func (m *MockDatabase) GetAppointmentsByClientID(
-	ctx context.Context,
-	clientID string,
-) ([]store.Appointment, error) {
-	return []store.Appointment{}, nil
+	// Without a gateway or a webhook secret, payments and webhooks are refused
+	none, err := payments.New(&config.Config{PaymentGateway: config.GatewayNone})
+	if err != nil {
+		t.Fatalf("payments.New: %v", err)
+	}
+	h = NewPaymentHandler(db, none, "")
+	if w := webhook(""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Webhook without a secret: expected status 503, got %d", w.Code)
+	}
+	order = store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 1, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if w := pay(); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Paying without a gateway: expected status 503, got %d", w.Code)
+	}
 }
 
-func (m *MockDatabase) GetAppointmentsByVeterinarianID(
-	ctx context.Context,
-	vetID string,
-) ([]store.Appointment, error) {
-	return []store.Appointment{}, nil
-}
+// TestCreatePaymentAfterRestart tests that a pending payment whose intent the
+// gateway lost, as the fake one does on restart, no longer blocks paying
+func TestCreatePaymentAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+	order := store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 1, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
 
-func (m *MockDatabase) GetAppointmentByID(
-	ctx context.Context,
-	appointmentID string,
-) (*store.Appointment, error) {
-	return nil, nil
-}
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	pay := func(h *PaymentHandler) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", order.ID)
+		req := createRequestWithContext("POST", "/api/v1/orders/"+order.ID+"/payments", nil, client)
+		w := httptest.NewRecorder()
+		h.CreatePayment(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+		return w
+	}
 
-func (m *MockDatabase) CreateAppointment(
-	ctx context.Context,
-	appointment *store.Appointment,
-) error {
-	return nil
-}
+	before := NewPaymentHandler(db, payments.NewFakeGateway(), "whsec")
+	if w := pay(before); w.Code != http.StatusOK {
+		t.Fatalf("CreatePayment: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := pay(before); w.Code != http.StatusConflict {
+		t.Errorf("Paying with a payment pending: expected status 409, got %d", w.Code)
+	}
 
-func (m *MockDatabase) UpdateAppointment(
-	ctx context.Context,
-	appointment *store.Appointment,
-) error {
-	return nil
+	after := NewPaymentHandler(db, payments.NewFakeGateway(), "whsec")
+	if w := pay(after); w.Code != http.StatusOK {
+		t.Fatalf("Paying after a restart: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	attempts, _ := db.GetOrderPayments(ctx, order.ID)
+	if len(attempts) != 2 || attempts[0].Status != store.PaymentFailed ||
+		attempts[0].FailureReason != lostIntentReason || attempts[1].Status != store.PaymentPending {
+		t.Errorf("Expected the lost attempt failed and a new one pending, got %+v", attempts)
+	}
 }
 
-func (m *MockDatabase) DeleteAppointment(
-	ctx context.Context,
-	appointmentID string,
-) error {
-	return nil
-}
+// TestOrderLifecycle tests that status updates follow the order lifecycle for
+// each role and show up in the order's history
+func TestOrderLifecycle(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+	order := store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 2, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
 
-func (m *MockDatabase) GetAvailableAppointmentSlots(
-	ctx context.Context,
-	vetID string,
-	date time.Time,
-) ([]store.TimeSlot, error) {
-	return []store.TimeSlot{}, nil
-}
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	vet := &middleware.UserClaims{Sub: "vet-1", Role: "veterinarian"}
+	h := NewOrderHandler(db)
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	update := func(status string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := map[string]string{"status": status, "note": "Moved to " + status}
+		req := createRequestWithContext("PUT", "/api/v1/orders/"+order.ID+"/status", body, vet)
+		h.UpdateOrderStatus(w, withID(req, order.ID))
+		return w
+	}
 
-// Product operations (stub implementations for testing)
-func (m *MockDatabase) GetProductsByVeterinarianID(
-	ctx context.Context,
-	vetID string,
-) ([]store.Product, error) {
-	return []store.Product{}, nil
-}
+	if w := update(store.OrderShipped); w.Code != http.StatusConflict {
+		t.Errorf("Shipping a pending order: expected status 409, got %d", w.Code)
+	}
+	for _, status := range []string{store.OrderConfirmed, store.OrderProcessing, store.OrderShipped} {
+		if w := update(status); w.Code != http.StatusOK {
+			t.Fatalf("Moving to %s: expected status 200, got %d: %s", status, w.Code, w.Body.String())
+		}
+	}
 
-func (m *MockDatabase) GetProductByID(
-	ctx context.Context,
-	productID string,
-) (*store.Product, error) {
-	return nil, nil
-}
+	w := httptest.NewRecorder()
+	req := createRequestWithContext("DELETE", "/api/v1/orders/"+order.ID, nil, client)
+	h.CancelOrder(w, withID(req, order.ID))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Cancelling a shipped order: expected status 409, got %d", w.Code)
+	}
 
-func (m *MockDatabase) CreateProduct(
-	ctx context.Context,
-	product *store.Product,
-) error {
-	return nil
-}
+	w = httptest.NewRecorder()
+	req = createRequestWithContext("GET", "/api/v1/orders/"+order.ID+"/history", nil, client)
+	h.GetOrderHistory(w, withID(req, order.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetOrderHistory: expected status 200, got %d", w.Code)
+	}
+	var resp struct {
+		Data []store.OrderStatusChange `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data) != 3 || resp.Data[2].ToStatus != store.OrderShipped ||
+		resp.Data[2].ActorID != "vet-1" || resp.Data[2].Note != "Moved to shipped" {
+		t.Errorf("Expected three changes ending in shipped, got %+v", resp.Data)
+	}
 
-func (m *MockDatabase) UpdateProduct(
-	ctx context.Context,
-	product *store.Product,
-) error {
-	return nil
-}
+	// Cash on pickup is recorded as paid; anything else goes through the gateway
+	settle := func(paymentStatus string) int {
+		w := httptest.NewRecorder()
+		body := map[string]string{"payment_status": paymentStatus}
+		req := createRequestWithContext("PUT", "/api/v1/orders/"+order.ID+"/status", body, vet)
+		h.UpdateOrderStatus(w, withID(req, order.ID))
+		return w.Code
+	}
+	if code := settle(store.PaymentRefunded); code != http.StatusBadRequest {
+		t.Errorf("Marking an order refunded: expected status 400, got %d", code)
+	}
+	if code := settle(store.PaymentPaid); code != http.StatusOK {
+		t.Errorf("Marking an order paid offline: expected status 200, got %d", code)
+	}
+	if got, _ := db.GetOrderByID(ctx, order.ID); got.PaymentStatus != store.PaymentPaid {
+		t.Errorf("Marking an order paid offline: expected paid, got %q", got.PaymentStatus)
+	}
+	if code := settle(store.PaymentFailed); code != http.StatusBadRequest {
+		t.Errorf("Marking a paid order failed: expected status 400, got %d", code)
+	}
+	entries, _, _ := db.ListAuditEntries(ctx, store.AuditFilter{Entity: store.EntityOrder, EntityID: order.ID}, store.Page{})
+	if len(entries) == 0 || entries[0].Changes["settlement"].After != "offline" {
+		t.Errorf("Marking an order paid offline: expected an audited offline settlement, got %+v", entries)
+	}
 
-func (m *MockDatabase) DeleteProduct(
-	ctx context.Context,
-	productID string,
-) error {
-	return nil
+	// A move and an offline payment land together, and a paid order stays
+	// uncancelled until it is refunded
+	second := store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, second, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 1, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	w = httptest.NewRecorder()
+	body := map[string]string{"status": store.OrderConfirmed, "payment_status": store.PaymentPaid}
+	req = createRequestWithContext("PUT", "/api/v1/orders/"+second.ID+"/status", body, vet)
+	h.UpdateOrderStatus(w, withID(req, second.ID))
+	if got, _ := db.GetOrderByID(ctx, second.ID); w.Code != http.StatusOK ||
+		got.Status != store.OrderConfirmed || got.PaymentStatus != store.PaymentPaid {
+		t.Errorf("Confirming and marking paid: expected 200 with both set, got %d and %+v", w.Code, got)
+	}
+	w = httptest.NewRecorder()
+	req = createRequestWithContext("DELETE", "/api/v1/orders/"+second.ID, nil, client)
+	h.CancelOrder(w, withID(req, second.ID))
+	if got, _ := db.GetOrderByID(ctx, second.ID); w.Code != http.StatusConflict ||
+		got.Status != store.OrderConfirmed {
+		t.Errorf("Cancelling a paid order: expected 409 and the order confirmed, got %d and %q",
+			w.Code, got.Status)
+	}
 }
 
-func (m *MockDatabase) ListProducts(
-	ctx context.Context,
-	filters store.ProductFilters,
-) ([]store.Product, error) {
-	return []store.Product{}, nil
-}
+// TestReturnRefund tests that an approved return is refunded in part from the
+// order's payment through the gateway
+func TestReturnRefund(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+	order := store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 2, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	from := store.OrderPending
+	for _, to := range []string{store.OrderConfirmed, store.OrderProcessing, store.OrderDelivered} {
+		change := store.NewOrderStatusChange(order.ID, from, to, "vet-1", "")
+		if err := db.TransitionOrder(ctx, change); err != nil {
+			t.Fatalf("TransitionOrder(%s): %v", to, err)
+		}
+		from = to
+	}
 
-func (m *MockDatabase) UpdateProductStock(
-	ctx context.Context,
-	productID string,
-	quantity int,
-) error {
-	return nil
-}
+	gateway := payments.NewFakeGateway()
+	intent, _ := gateway.CreateIntent(ctx, order.ID, order.TotalAmount)
+	_, _ = gateway.Capture(ctx, intent.ID)
+	payment := store.NewPayment(order.ID, gateway.Name(), intent.ID, intent.Amount)
+	_ = db.CreatePayment(ctx, payment)
+	_, _ = db.SetPaymentStatus(ctx, payment.ID, store.PaymentPaid, "")
+
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	vet := &middleware.UserClaims{Sub: "vet-1", Role: "veterinarian"}
+	h := NewReturnHandler(db, gateway)
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
 
-// Order operations (stub implementations for testing)
-func (m *MockDatabase) GetOrdersByClientID(
-	ctx context.Context,
-	clientID string,
-) ([]store.Order, error) {
-	return []store.Order{}, nil
-}
+	items, _ := db.GetOrderItems(ctx, order.ID)
+	body := map[string]any{
+		"reason": "One bag arrived torn",
+		"items":  []map[string]any{{"order_item_id": items[0].ID, "quantity": 1}},
+	}
+	w := httptest.NewRecorder()
+	req := createRequestWithContext("POST", "/api/v1/orders/"+order.ID+"/returns", body, client)
+	h.CreateReturn(w, withID(req, order.ID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("CreateReturn: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data store.Return `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	ret := created.Data
+	if ret.RefundAmount != usd(10) || ret.Status != store.ReturnRequested {
+		t.Errorf("Expected a requested return of 10, got %+v", ret)
+	}
 
-func (m *MockDatabase) GetOrdersByVeterinarianID(
-	ctx context.Context,
-	vetID string,
-) ([]store.Order, error) {
-	return []store.Order{}, nil
-}
+	approve := func(user *middleware.UserClaims) *httptest.ResponseRecorder {
+		body := map[string]any{
+			"items": []map[string]string{{"id": ret.Items[0].ID, "disposition": store.ReturnWriteOff}},
+		}
+		w := httptest.NewRecorder()
+		req := createRequestWithContext("POST", "/api/v1/returns/"+ret.ID+"/approve", body, user)
+		h.ApproveReturn(w, withID(req, ret.ID))
+		return w
+	}
+	if w := approve(client); w.Code != http.StatusForbidden {
+		t.Errorf("Client approving a return: expected status 403, got %d", w.Code)
+	}
+	if w := approve(vet); w.Code != http.StatusOK {
+		t.Fatalf("ApproveReturn: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
 
-func (m *MockDatabase) GetOrderByID(
-	ctx context.Context,
-	orderID string,
-) (*store.Order, error) {
-	return nil, nil
+	got, _ := db.GetReturnByID(ctx, ret.ID)
+	if got.Status != store.ReturnRefunded || got.PaymentID != payment.ID {
+		t.Errorf("Expected the return refunded from %s, got %+v", payment.ID, got)
+	}
+	paid, _ := db.GetPaymentByID(ctx, payment.ID)
+	if paid.Status != store.PaymentPartiallyRefunded || paid.RefundedAmount != usd(10) {
+		t.Errorf("Expected the payment partially refunded by 10, got %+v", paid)
+	}
+	stocked, _ := db.GetProductByID(ctx, product.ID)
+	if stocked.StockQuantity != 1 {
+		t.Errorf("Expected a written-off item to leave stock at 1, got %d", stocked.StockQuantity)
+	}
+	notes, _ := db.GetOrderCreditNotes(ctx, order.ID)
+	if len(notes) != 1 || notes[0].ReturnID != ret.ID || notes[0].Total != usd(10) {
+		t.Errorf("Expected one credit note of 10 for the return, got %+v", notes)
+	}
+	if w := approve(vet); w.Code != http.StatusConflict {
+		t.Errorf("Approving twice: expected status 409, got %d", w.Code)
+	}
 }
 
-func (m *MockDatabase) CreateOrder(
-	ctx context.Context,
-	order *store.Order,
-) error {
-	return nil
-}
+// TestOrderInvoice tests that an order's invoice is issued once, rendered in
+// the requested format and only shown to the order's parties
+func TestOrderInvoice(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Name: "Ann", Email: "client@example.com"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{
+		ID: "vet-1", Name: "Dr. Tan", Email: "vet@example.com", ClinicAddress: "2 Clinic Road",
+	})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+	order := store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 2, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	stranger := &middleware.UserClaims{Sub: "client-2", Role: "client"}
+	h := NewInvoiceHandler(db)
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	get := func(user *middleware.UserClaims, query, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := createRequestWithContext("GET", "/api/v1/orders/"+order.ID+"/invoice"+query, nil, user)
+		req.Header.Set("Accept", accept)
+		h.GetOrderInvoice(w, withID(req, order.ID))
+		return w
+	}
+
+	if w := get(stranger, "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Another client's invoice: expected status 403, got %d", w.Code)
+	}
+	w := get(client, "", "text/html")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(w.Body.String(), "INV-000001") {
+		t.Fatalf("GetOrderInvoice: expected an HTML invoice, got %d: %s", w.Code, w.Body.String())
+	}
+	w = get(client, "", "application/pdf")
+	if w.Header().Get("Content-Type") != "application/pdf" ||
+		!strings.HasPrefix(w.Body.String(), "%PDF-") {
+		t.Errorf("GetOrderInvoice: expected a PDF, got %q", w.Header().Get("Content-Type"))
+	}
+	if w := get(client, "?format=xml", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown format: expected status 400, got %d", w.Code)
+	}
+
+	var issued struct {
+		Data store.Invoice `json:"data"`
+	}
+	w = get(client, "?format=json", "text/html")
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	inv := issued.Data
+	if inv.Number != "INV-000001" || inv.Total != usd(20) || inv.Seller.Address != "2 Clinic Road" ||
+		len(inv.Lines) != 1 || inv.Lines[0].Description != "Kibble" {
+		t.Errorf("Expected the order's invoice, got %+v", inv)
+	}
 
-func (m *MockDatabase) UpdateOrderStatus(
-	ctx context.Context,
-	orderID string,
-	status string,
-) error {
-	return nil
+	w = httptest.NewRecorder()
+	req := createRequestWithContext("GET", "/api/v1/invoices/"+inv.ID, nil, stranger)
+	h.GetInvoice(w, withID(req, inv.ID))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Another client's invoice by ID: expected status 403, got %d", w.Code)
+	}
 }
 
-func (m *MockDatabase) GetOrderItems(
-	ctx context.Context,
-	orderID string,
-) ([]store.OrderItem, error) {
-	return []store.OrderItem{}, nil
+// TestTaxSettings tests that only the veterinarian or an admin sets a
+// clinic's taxes, and that orders placed afterwards are charged them
+func TestTaxSettings(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Name: "Ann", Email: "client@example.com"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Name: "Dr. Tan", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 3
+	_ = db.CreateProduct(ctx, product)
+
+	vet := &middleware.UserClaims{Sub: "vet-1", Role: "veterinarian"}
+	otherVet := &middleware.UserClaims{Sub: "vet-2", Role: "veterinarian"}
+	h := NewTaxHandler(db)
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	put := func(user *middleware.UserClaims, body any) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := createRequestWithContext("PUT", "/api/v1/veterinarians/vet-1/tax-settings", body, user)
+		h.SetTaxSettings(w, withID(req, "vet-1"))
+		return w
+	}
+
+	gst := map[string]any{"rates": []map[string]any{{"name": "GST", "rate_bps": 900}}}
+	if w := put(otherVet, gst); w.Code != http.StatusForbidden {
+		t.Errorf("Another veterinarian's taxes: expected status 403, got %d", w.Code)
+	}
+	invalid := map[string]any{"rates": []map[string]any{{"name": "GST", "rate_bps": 0}}}
+	if w := put(vet, invalid); w.Code != http.StatusBadRequest {
+		t.Errorf("Rate of 0: expected status 400, got %d", w.Code)
+	}
+	if w := put(vet, gst); w.Code != http.StatusOK {
+		t.Fatalf("SetTaxSettings: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	req := createRequestWithContext("GET", "/api/v1/veterinarians/vet-1/tax-settings", nil,
+		&middleware.UserClaims{Sub: "client-1", Role: "client"})
+	h.GetTaxSettings(w, withID(req, "vet-1"))
+	var got struct {
+		Data store.TaxSettings `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(got.Data.Rates) != 1 || got.Data.Rates[0].RateBps != 900 {
+		t.Errorf("GetTaxSettings: expected GST at 9%%, got %+v", got.Data)
+	}
+
+	order := store.NewOrder("client-1", "vet-1", store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 2, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	if order.TaxAmount != usd(1.80) || order.TotalAmount != usd(21.80) || len(order.TaxLines) != 1 {
+		t.Errorf("PlaceOrder: expected 9%% GST on top, got tax %v of %v", order.TaxAmount, order.TotalAmount)
+	}
+	entries, _, _ := db.ListAuditEntries(ctx, store.AuditFilter{Entity: store.EntityTaxSettings}, store.Page{})
+	if len(entries) != 1 {
+		t.Errorf("Expected the tax settings change audited once, got %d entries", len(entries))
+	}
 }
 
-func (m *MockDatabase) CreateOrderItem(
-	ctx context.Context,
-	item *store.OrderItem,
-) error {
-	return nil
+// TestPromotions tests that veterinarians manage their own discount codes
+// and that orders giving one get its discount until it is used up
+func TestPromotions(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Name: "Ann", Email: "client@example.com"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Name: "Dr. Tan", Email: "vet@example.com"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-2", Name: "Dr. Lim", Email: "lim@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 5
+	_ = db.CreateProduct(ctx, product)
+
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	vet := &middleware.UserClaims{Sub: "vet-1", Role: "veterinarian"}
+	otherVet := &middleware.UserClaims{Sub: "vet-2", Role: "veterinarian"}
+	h := NewPromotionHandler(db)
+	create := func(user *middleware.UserClaims, body any) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.CreatePromotion(w, createRequestWithContext("POST", "/api/v1/promotions", body, user))
+		return w
+	}
+
+	spring := map[string]any{
+		"name":        "Spring sale",
+		"code":        "spring10",
+		"kind":        store.PromotionPercent,
+		"percent_bps": 1000,
+		"usage_limit": 1,
+	}
+	if w := create(client, spring); w.Code != http.StatusForbidden {
+		t.Errorf("Client creating a promotion: expected status 403, got %d", w.Code)
+	}
+	if w := create(vet, map[string]any{"name": "Free", "kind": "free"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown kind: expected status 400, got %d", w.Code)
+	}
+	w := create(vet, spring)
+	if w.Code != http.StatusOK {
+		t.Fatalf("CreatePromotion: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data store.Promotion `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.Data.Code != "SPRING10" || created.Data.VeterinarianID != "vet-1" {
+		t.Errorf("CreatePromotion: expected vet-1's code SPRING10, got %+v", created.Data)
+	}
+	if w := create(otherVet, spring); w.Code != http.StatusConflict {
+		t.Errorf("Duplicate code: expected status 409, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req := createRequestWithContext("DELETE", "/api/v1/promotions/"+created.Data.ID, nil, otherVet)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", created.Data.ID)
+	h.DeletePromotion(w, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Another veterinarian's promotion: expected status 403, got %d", w.Code)
+	}
+
+	order := func(code string) *httptest.ResponseRecorder {
+		body := map[string]any{
+			"veterinarian_id": "vet-1",
+			"items":           []map[string]any{{"product_id": product.ID, "quantity": 2}},
+			"discount_code":   code,
+		}
+		w := httptest.NewRecorder()
+		NewOrderHandler(db).CreateOrder(w, createRequestWithContext("POST", "/api/v1/orders", body, client))
+		return w
+	}
+	if w := order("WINTER"); w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown code: expected status 400, got %d", w.Code)
+	}
+	w = order("Spring10")
+	if w.Code != http.StatusOK {
+		t.Fatalf("CreateOrder: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var placed struct {
+		Data struct {
+			Order store.Order `json:"order"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &placed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if placed.Data.Order.DiscountAmount != usd(2) || placed.Data.Order.TotalAmount != usd(18) {
+		t.Errorf("CreateOrder: expected $2 off to $18, got %v off to %v",
+			placed.Data.Order.DiscountAmount, placed.Data.Order.TotalAmount)
+	}
+	if w := order("SPRING10"); w.Code != http.StatusConflict {
+		t.Errorf("Used-up code: expected status 409, got %d", w.Code)
+	}
 }
 
-// Helper function to create a request with context
-func createRequestWithContext(
-	method, path string,
-	body any,
-	user *middleware.UserClaims,
-) *http.Request {
-	var req *http.Request
-	if body != nil {
-		jsonBody, _ := json.Marshal(body)
-		req = httptest.NewRequest(method, path, bytes.NewBuffer(jsonBody))
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req = httptest.NewRequest(method, path, nil)
+// TestAuthorizeUniform tests that refusals from different handlers, for
+// different reasons, all get the same 403 response, and that a generic JWT
+// role is resolved to the user's profile role before the policy is asked
+func TestAuthorizeUniform(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "one@example.com", Role: "client"})
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-2", Email: "two@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	pet := store.NewPet("client-1", "Buddy", "Dog", "Beagle", time.Now(), 10)
+	_ = db.CreatePet(ctx, pet)
+	order := store.NewOrder("client-1", "vet-1", store.Money{})
+	_ = db.CreateOrder(ctx, order)
+
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	owner := &middleware.UserClaims{Sub: "client-1", Role: "authenticated"}
+	other := &middleware.UserClaims{Sub: "client-2", Role: "client"}
+	vet := &middleware.UserClaims{Sub: "vet-1", Role: "veterinarian"}
+	stranger := &middleware.UserClaims{Sub: "nobody", Role: "authenticated"}
+
+	refusals := map[string]func(w http.ResponseWriter){
+		"veterinarian creating a pet": func(w http.ResponseWriter) {
+			body := map[string]any{"name": "Rex", "owner_id": "client-1"}
+			NewPetHandler(db).CreatePet(w, createRequestWithContext("POST", "/api/v1/pets", body, vet))
+		},
+		"another client's pet": func(w http.ResponseWriter) {
+			req := createRequestWithContext("GET", "/api/v1/pets/"+pet.ID, nil, other)
+			NewPetHandler(db).GetPet(w, withID(req, pet.ID))
+		},
+		"another client's order": func(w http.ResponseWriter) {
+			req := createRequestWithContext("GET", "/api/v1/orders/"+order.ID, nil, other)
+			NewOrderHandler(db).GetOrder(w, withID(req, order.ID))
+		},
+		"a client listing a veterinarian's orders": func(w http.ResponseWriter) {
+			req := createRequestWithContext("GET", "/api/v1/orders?veterinarian_id=vet-1", nil, other)
+			NewOrderHandler(db).GetOrders(w, req)
+		},
+		"a user without a profile": func(w http.ResponseWriter) {
+			NewOrderHandler(db).CreateOrder(w, createRequestWithContext("POST", "/api/v1/orders", nil, stranger))
+		},
+	}
+	var first string
+	for name, refuse := range refusals {
+		w := httptest.NewRecorder()
+		refuse(w)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d: %s", name, w.Code, w.Body.String())
+			continue
+		}
+		if first == "" {
+			first = w.Body.String()
+		} else if w.Body.String() != first {
+			t.Errorf("%s: expected the same response as the others, %s, got %s", name, first, w.Body.String())
+		}
 	}
 
-	ctx := context.WithValue(req.Context(), middleware.UserContextKey, user)
-	return req.WithContext(ctx)
+	// The owner's token only says "authenticated"; their profile makes them
+	// the client who owns the pet
+	w := httptest.NewRecorder()
+	req := createRequestWithContext("GET", "/api/v1/pets/"+pet.ID, nil, owner)
+	NewPetHandler(db).GetPet(w, withID(req, pet.ID))
+	if w.Code != http.StatusOK {
+		t.Errorf("Owner with a generic role: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
 }
 
-// TestGetUserProfile tests the GetUserProfile handler
-func TestGetUserProfile(t *testing.T) {
-	user := &middleware.UserClaims{
-		Sub:   "test-user-id",
-		Email: "test@example.com",
-		Role:  "client",
+// TestAdminUserManagement tests promoting and demoting users, that the last
+// admin stays, and suspending and reactivating accounts
+func TestAdminUserManagement(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Name: "Ann", Email: "ann@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	_ = db.GrantAdmin(ctx, store.NewAdminGrant("admin-1", "root@example.com", "Root", ""))
+	h := NewUserHandler(db)
+
+	withID := func(req *http.Request, id string) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	admin := &middleware.UserClaims{Sub: "admin-1", Role: "admin"}
+	client := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	setRole := func(user *middleware.UserClaims, id, role string) *httptest.ResponseRecorder {
+		req := createRequestWithContext("PUT", "/api/v1/users/"+id+"/role", map[string]string{"role": role}, user)
+		w := httptest.NewRecorder()
+		h.SetUserRole(w, withID(req, id))
+		return w
 	}
 
-	// Create handler with mock database
-	mockDB := NewMockDatabase()
-	userHandler := NewUserHandler(mockDB)
+	if w := setRole(client, "client-1", "admin"); w.Code != http.StatusForbidden {
+		t.Errorf("Client promoting themselves: expected status 403, got %d", w.Code)
+	}
+	if w := setRole(admin, "admin-1", "client"); w.Code != http.StatusConflict {
+		t.Errorf("Demoting an admin without a profile: expected status 409, got %d", w.Code)
+	}
+	if w := setRole(admin, "client-1", "veterinarian"); w.Code != http.StatusConflict {
+		t.Errorf("Changing a client to a veterinarian: expected status 409, got %d", w.Code)
+	}
+	if w := setRole(admin, "client-1", "superuser"); w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown role: expected status 400, got %d", w.Code)
+	}
+	if w := setRole(admin, "missing", "admin"); w.Code != http.StatusNotFound {
+		t.Errorf("Missing user: expected status 404, got %d", w.Code)
+	}
+	if w := setRole(admin, "client-1", "admin"); w.Code != http.StatusOK {
+		t.Fatalf("Promoting a client: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if user, _ := db.GetUserByID(ctx, "client-1"); user == nil || user.Role != store.RoleAdmin {
+		t.Errorf("Expected client-1 to be an admin, got %+v", user)
+	}
 
-	req := createRequestWithContext("GET", "/api/v1/profile", nil, user)
+	// The promoted client can demote themselves, but then the original
+	// admin is the last one
+	promoted := &middleware.UserClaims{Sub: "client-1", Role: "admin"}
+	if w := setRole(promoted, "client-1", "client"); w.Code != http.StatusOK {
+		t.Fatalf("Demoting to the profile's role: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	req := createRequestWithContext("GET", "/api/v1/users?role=admin", nil, admin)
 	w := httptest.NewRecorder()
+	h.ListUsers(w, req)
+	var listed struct {
+		Data []store.User `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed.Data) != 1 || listed.Data[0].ID != "admin-1" {
+		t.Errorf("Listing admins: expected only admin-1, got %+v", listed.Data)
+	}
+	_ = db.CreateClient(ctx, &store.Client{ID: "admin-1", Email: "root@example.com", Role: "client"})
+	if w := setRole(admin, "admin-1", "client"); w.Code != http.StatusConflict {
+		t.Errorf("Demoting the last admin: expected status 409, got %d", w.Code)
+	}
 
-	userHandler.GetUserProfile(w, req)
+	suspend := func(user *middleware.UserClaims, id string) *httptest.ResponseRecorder {
+		req := createRequestWithContext("POST", "/api/v1/users/"+id+"/suspend", map[string]string{"reason": "fraud"}, user)
+		w := httptest.NewRecorder()
+		h.SuspendUser(w, withID(req, id))
+		return w
+	}
+	reactivate := func(id string) *httptest.ResponseRecorder {
+		req := createRequestWithContext("POST", "/api/v1/users/"+id+"/reactivate", nil, admin)
+		w := httptest.NewRecorder()
+		h.ReactivateUser(w, withID(req, id))
+		return w
+	}
+	if w := suspend(admin, "admin-1"); w.Code != http.StatusConflict {
+		t.Errorf("Suspending yourself: expected status 409, got %d", w.Code)
+	}
+	if w := reactivate("vet-1"); w.Code != http.StatusConflict {
+		t.Errorf("Reactivating an active account: expected status 409, got %d", w.Code)
+	}
+	if w := suspend(admin, "vet-1"); w.Code != http.StatusOK {
+		t.Fatalf("Suspending: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if user, _ := db.GetUserByID(ctx, "vet-1"); user == nil || !user.Suspended() || user.SuspensionReason != "fraud" {
+		t.Errorf("Expected vet-1 to be suspended for fraud, got %+v", user)
+	}
+	if w := reactivate("vet-1"); w.Code != http.StatusOK {
+		t.Fatalf("Reactivating: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if user, _ := db.GetUserByID(ctx, "vet-1"); user == nil || user.Suspended() {
+		t.Errorf("Expected vet-1 to be reactivated, got %+v", user)
+	}
+}
+
+func TestPetAccessGrants(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "owner@example.com", Role: "client"})
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-2", Email: "sitter@example.com", Role: "client"})
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-3", Email: "partner@example.com", Role: "client"})
+	pet := store.NewPet("client-1", "Buddy", "Dog", "Beagle", time.Now(), 10)
+	_ = db.CreatePet(ctx, pet)
+	h := NewPetAccessHandler(db)
+
+	withParams := func(req *http.Request, params ...string) *http.Request {
+		rctx := chi.NewRouteContext()
+		for i := 0; i < len(params); i += 2 {
+			rctx.URLParams.Add(params[i], params[i+1])
+		}
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	owner := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	sitter := &middleware.UserClaims{Sub: "client-2", Role: "client"}
+	partner := &middleware.UserClaims{Sub: "client-3", Role: "client"}
+	grant := func(user *middleware.UserClaims, body map[string]any) *httptest.ResponseRecorder {
+		req := createRequestWithContext("POST", "/api/v1/pets/"+pet.ID+"/access", body, user)
+		w := httptest.NewRecorder()
+		h.GrantPetAccess(w, withParams(req, "petId", pet.ID))
+		return w
+	}
+	getPet := func(user *middleware.UserClaims) int {
+		req := createRequestWithContext("GET", "/api/v1/pets/"+pet.ID, nil, user)
+		w := httptest.NewRecorder()
+		NewPetHandler(db).GetPet(w, withParams(req, "id", pet.ID))
+		return w.Code
+	}
+	updatePet := func(user *middleware.UserClaims) int {
+		body := map[string]any{"name": "Max", "type": "Dog", "date_of_birth": time.Now()}
+		req := createRequestWithContext("PUT", "/api/v1/pets/"+pet.ID, body, user)
+		w := httptest.NewRecorder()
+		NewPetHandler(db).UpdatePet(w, withParams(req, "id", pet.ID))
+		return w.Code
+	}
+	listRecords := func(user *middleware.UserClaims) int {
+		req := createRequestWithContext("GET", "/api/v1/pets/"+pet.ID+"/medical-records", nil, user)
+		w := httptest.NewRecorder()
+		NewMedicalRecordHandler(db).GetMedicalRecords(w, withParams(req, "petId", pet.ID))
+		return w.Code
+	}
+
+	if code := getPet(sitter); code != http.StatusForbidden {
+		t.Errorf("Reading a pet without access: expected status 403, got %d", code)
+	}
+	if w := grant(sitter, map[string]any{"email": "partner@example.com", "role": "caretaker"}); w.Code != http.StatusForbidden {
+		t.Errorf("Sharing someone else's pet: expected status 403, got %d", w.Code)
+	}
+	invited := grant(owner, map[string]any{"email": "Newcomer@Example.com", "role": "caretaker"})
+	if invited.Code != http.StatusOK {
+		t.Fatalf("Inviting an unknown email: expected status 200, got %d: %s", invited.Code, invited.Body.String())
+	}
+	bad := map[string]any{"email": "sitter@example.com", "role": "caretaker", "permissions": []string{"manage_pet"}}
+	if w := grant(owner, bad); w.Code != http.StatusBadRequest {
+		t.Errorf("Letting a caretaker manage the pet: expected status 400, got %d", w.Code)
+	}
 
+	// Caretakers see the pet and its records but cannot edit it
+	w := grant(owner, map[string]any{"email": "sitter@example.com", "role": "caretaker"})
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Sharing with a caretaker: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data store.PetAccessGrant `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Data.GranteeEmail != "sitter@example.com" || len(created.Data.Permissions) != 2 {
+		t.Errorf("Sharing with a caretaker: expected the default permissions, got %+v", created.Data)
+	}
+	// Owners cannot tell an invitation from a grant to an existing client
+	var shape, invitedShape map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &shape)
+	_ = json.Unmarshal(invited.Body.Bytes(), &invitedShape)
+	keys := func(m map[string]any) []string {
+		data, _ := m["data"].(map[string]any)
+		return slices.Sorted(maps.Keys(data))
+	}
+	if !slices.Equal(keys(shape), keys(invitedShape)) || strings.Contains(w.Body.String(), "client-2") {
+		t.Errorf("Sharing: expected the same response for an invitation, got %s and %s",
+			w.Body.String(), invited.Body.String())
+	}
+	if w := grant(owner, map[string]any{"email": "sitter@example.com", "role": "co_owner"}); w.Code != http.StatusConflict {
+		t.Errorf("Sharing twice: expected status 409, got %d", w.Code)
+	}
+	if code := getPet(sitter); code != http.StatusOK {
+		t.Errorf("Caretaker reading the pet: expected status 200, got %d", code)
+	}
+	if code := listRecords(sitter); code != http.StatusOK {
+		t.Errorf("Caretaker listing records: expected status 200, got %d", code)
+	}
+	if code := updatePet(sitter); code != http.StatusForbidden {
+		t.Errorf("Caretaker editing the pet: expected status 403, got %d", code)
+	}
+	order := createRequestWithContext("POST", "/api/v1/orders?client_id=client-1", map[string]any{}, sitter)
+	w = httptest.NewRecorder()
+	NewOrderHandler(db).CreateOrder(w, order)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Caretaker ordering without the order permission: expected status 403, got %d", w.Code)
 	}
 
-	var response map[string]any
-	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
-		t.Errorf("Failed to parse response: %v", err)
+	// Co-owners get every permission; an edit then only wants If-Match
+	if w := grant(owner, map[string]any{"email": "partner@example.com", "role": "co_owner"}); w.Code != http.StatusOK {
+		t.Fatalf("Sharing with a co-owner: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := updatePet(partner); code != http.StatusPreconditionRequired {
+		t.Errorf("Co-owner editing the pet: expected status 428, got %d", code)
 	}
 
-	if response["user_id"] != user.Sub {
-		t.Errorf("Expected user_id %s, got %s", user.Sub, response["user_id"])
+	// They order on the owner's account, and follow and cancel what they
+	// placed but not the owner's own orders
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	product := store.NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.StockQuantity = 5
+	_ = db.CreateProduct(ctx, product)
+	orders := NewOrderHandler(db)
+	placeOrder := func(user *middleware.UserClaims, path string) store.Order {
+		body := map[string]any{
+			"veterinarian_id": "vet-1",
+			"items":           []map[string]any{{"product_id": product.ID, "quantity": 1}},
+		}
+		w := httptest.NewRecorder()
+		orders.CreateOrder(w, createRequestWithContext("POST", path, body, user))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Placing an order: expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var placed struct {
+			Data struct {
+				Order store.Order `json:"order"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &placed)
+		return placed.Data.Order
+	}
+	getOrder := func(user *middleware.UserClaims, orderID string) int {
+		req := createRequestWithContext("GET", "/api/v1/orders/"+orderID, nil, user)
+		w := httptest.NewRecorder()
+		orders.GetOrder(w, withParams(req, "id", orderID))
+		return w.Code
+	}
+	cancelOrder := func(user *middleware.UserClaims, orderID string) int {
+		req := createRequestWithContext("DELETE", "/api/v1/orders/"+orderID, nil, user)
+		w := httptest.NewRecorder()
+		orders.CancelOrder(w, withParams(req, "id", orderID))
+		return w.Code
+	}
+	delegatedOrder := placeOrder(partner, "/api/v1/orders?client_id=client-1")
+	if delegatedOrder.ClientID != "client-1" || delegatedOrder.PlacedBy != "client-3" {
+		t.Errorf("Co-owner ordering: expected an order for client-1 placed by client-3, got %+v", delegatedOrder)
+	}
+	ownOrder := placeOrder(owner, "/api/v1/orders")
+	if code := getOrder(partner, delegatedOrder.ID); code != http.StatusOK {
+		t.Errorf("Co-owner reading an order they placed: expected status 200, got %d", code)
+	}
+	if code := getOrder(partner, ownOrder.ID); code != http.StatusForbidden {
+		t.Errorf("Co-owner reading the owner's order: expected status 403, got %d", code)
+	}
+	if code := cancelOrder(partner, ownOrder.ID); code != http.StatusForbidden {
+		t.Errorf("Co-owner cancelling the owner's order: expected status 403, got %d", code)
+	}
+	if code := cancelOrder(partner, delegatedOrder.ID); code != http.StatusOK {
+		t.Errorf("Co-owner cancelling an order they placed: expected status 200, got %d", code)
 	}
-}
 
-// TestCreateUser tests the CreateUser handler
-func TestCreateUser(t *testing.T) {
-	user := &middleware.UserClaims{
-		Sub:   "test-user-id",
-		Email: "test@example.com",
-		Role:  "client",
+	// Invitations go to the client whose token carries the email, in any
+	// case; a profile giving someone else's email claims nothing
+	signUp := func(user *middleware.UserClaims, email string) {
+		t.Helper()
+		req := createRequestWithContext("POST", "/api/v1/users",
+			map[string]any{"name": "Newcomer", "email": email, "role": "client"}, user)
+		w := httptest.NewRecorder()
+		NewUserHandler(db).CreateUser(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Signing up: expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := grant(owner, map[string]any{"email": "friend@example.com", "role": "caretaker"}); w.Code != http.StatusOK {
+		t.Fatalf("Inviting a second email: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	impostor := &middleware.UserClaims{Sub: "client-5", Role: "client", Email: "impostor@example.com"}
+	signUp(impostor, "friend@example.com")
+	if code := getPet(impostor); code != http.StatusForbidden {
+		t.Errorf("Signing up with someone else's invited email: expected status 403, got %d", code)
+	}
+	newcomer := &middleware.UserClaims{Sub: "client-4", Role: "client", Email: "newcomer@example.com"}
+	if code := getPet(newcomer); code != http.StatusForbidden {
+		t.Errorf("Reading the pet before signing up: expected status 403, got %d", code)
+	}
+	signUp(newcomer, "newcomer@example.com")
+	if code := getPet(newcomer); code != http.StatusOK {
+		t.Errorf("Reading the pet after claiming an invitation: expected status 200, got %d", code)
+	}
+
+	// Grantees see what they received and can give it up
+	req := createRequestWithContext("GET", "/api/v1/pet-access", nil, sitter)
+	w = httptest.NewRecorder()
+	h.GetReceivedPetAccess(w, req)
+	var received struct {
+		Data []store.PetAccessGrant `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &received)
+	if w.Code != http.StatusOK || len(received.Data) != 1 || received.Data[0].ID != created.Data.ID {
+		t.Errorf("Listing received access: expected the caretaker grant, got %d %+v", w.Code, received.Data)
+	}
+	revoke := func(user *middleware.UserClaims, grantID string) int {
+		req := createRequestWithContext("DELETE", "/api/v1/pets/"+pet.ID+"/access/"+grantID, nil, user)
+		w := httptest.NewRecorder()
+		h.RevokePetAccess(w, withParams(req, "petId", pet.ID, "grantId", grantID))
+		return w.Code
+	}
+	if code := revoke(partner, created.Data.ID); code != http.StatusForbidden {
+		t.Errorf("Co-owner revoking another grantee's access: expected status 403, got %d", code)
+	}
+	if code := revoke(sitter, created.Data.ID); code != http.StatusOK {
+		t.Errorf("Caretaker giving up access: expected status 200, got %d", code)
+	}
+	if code := revoke(owner, created.Data.ID); code != http.StatusConflict {
+		t.Errorf("Revoking twice: expected status 409, got %d", code)
+	}
+	if code := getPet(sitter); code != http.StatusForbidden {
+		t.Errorf("Reading the pet after revoking: expected status 403, got %d", code)
 	}
 
-	// Create handler with mock database
-	mockDB := NewMockDatabase()
-	userHandler := NewUserHandler(mockDB)
+	// Expired grants stop working and make way for a new invitation
+	expired := time.Now().Add(-time.Hour)
+	old := store.NewPetAccessGrant(pet.ID, "client-1", &store.Client{ID: "client-2", Email: "sitter@example.com"},
+		store.PetAccessCaretaker, []string{store.PermissionViewRecords}, &expired, "client-1")
+	old.CreatedAt = expired.Add(-time.Hour)
+	_ = db.CreatePetAccessGrant(ctx, old)
+	if code := getPet(sitter); code != http.StatusForbidden {
+		t.Errorf("Reading the pet with an expired grant: expected status 403, got %d", code)
+	}
+	if w := grant(owner, map[string]any{"email": "sitter@example.com", "role": "caretaker"}); w.Code != http.StatusOK {
+		t.Errorf("Sharing again after expiry: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := getPet(sitter); code != http.StatusOK {
+		t.Errorf("Reading the pet with a new grant: expected status 200, got %d", code)
+	}
+}
 
-	// Create test request
-	newUser := map[string]any{
-		"name":    "John Doe",
-		"email":   "john@example.com",
-		"phone":   "123-456-7890",
-		"address": "123 Main St",
-		"role":    "client",
+func TestRecordConsents(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "owner@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-2", Email: "vet2@example.com"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-3", Email: "vet3@example.com"})
+	pet := store.NewPet("client-1", "Buddy", "Dog", "Beagle", time.Now(), 10)
+	_ = db.CreatePet(ctx, pet)
+	h := NewRecordConsentHandler(db)
+
+	withParams := func(req *http.Request, params ...string) *http.Request {
+		rctx := chi.NewRouteContext()
+		for i := 0; i < len(params); i += 2 {
+			rctx.URLParams.Add(params[i], params[i+1])
+		}
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+	owner := &middleware.UserClaims{Sub: "client-1", Role: "client"}
+	vet := &middleware.UserClaims{Sub: "vet-1", Role: "veterinarian"}
+	specialist := &middleware.UserClaims{Sub: "vet-2", Role: "veterinarian"}
+	booked := &middleware.UserClaims{Sub: "vet-3", Role: "veterinarian"}
+	listRecords := func(user *middleware.UserClaims) int {
+		req := createRequestWithContext("GET", "/api/v1/pets/"+pet.ID+"/medical-records", nil, user)
+		w := httptest.NewRecorder()
+		NewMedicalRecordHandler(db).GetMedicalRecords(w, withParams(req, "petId", pet.ID))
+		return w.Code
+	}
+	breakGlass := func(user *middleware.UserClaims, justification string) *httptest.ResponseRecorder {
+		body := map[string]any{"justification": justification}
+		req := createRequestWithContext("POST", "/api/v1/pets/"+pet.ID+"/break-glass", body, user)
+		w := httptest.NewRecorder()
+		h.BreakGlass(w, withParams(req, "petId", pet.ID))
+		return w
 	}
 
-	req := createRequestWithContext("POST", "/api/v1/users", newUser, user)
-	w := httptest.NewRecorder()
+	if code := listRecords(vet); code != http.StatusForbidden {
+		t.Errorf("Vet listing records without consent: expected status 403, got %d", code)
+	}
 
-	userHandler.CreateUser(w, req)
+	// Break-glass access needs a reason and is refused once the vet has access
+	if w := breakGlass(vet, "  "); w.Code != http.StatusBadRequest {
+		t.Errorf("Break-glass without a justification: expected status 400, got %d", w.Code)
+	}
+	if w := breakGlass(owner, "curious"); w.Code != http.StatusForbidden {
+		t.Errorf("Client breaking the glass: expected status 403, got %d", w.Code)
+	}
+	w := breakGlass(vet, "Brought in unconscious")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Break-glass: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var glass struct {
+		Data store.RecordConsent `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &glass)
+	if glass.Data.Kind != store.ConsentBreakGlass || glass.Data.ExpiresAt == nil ||
+		glass.Data.ExpiresAt.Sub(glass.Data.CreatedAt) != store.BreakGlassDuration {
+		t.Errorf("Break-glass: expected access for %s, got %+v", store.BreakGlassDuration, glass.Data)
+	}
+	if code := listRecords(vet); code != http.StatusOK {
+		t.Errorf("Vet listing records after break-glass: expected status 200, got %d", code)
+	}
+	if w := breakGlass(vet, "Still unconscious"); w.Code != http.StatusConflict {
+		t.Errorf("Break-glass with access: expected status 409, got %d", w.Code)
+	}
 
+	// Owners grant and revoke access; vets cannot see consents
+	grant := func(user *middleware.UserClaims, body map[string]any) *httptest.ResponseRecorder {
+		req := createRequestWithContext("POST", "/api/v1/pets/"+pet.ID+"/record-consents", body, user)
+		w := httptest.NewRecorder()
+		h.GrantRecordAccess(w, withParams(req, "petId", pet.ID))
+		return w
+	}
+	if w := grant(vet, map[string]any{"veterinarian_id": "vet-2"}); w.Code != http.StatusForbidden {
+		t.Errorf("Vet granting access: expected status 403, got %d", w.Code)
+	}
+	if w := grant(owner, map[string]any{"veterinarian_id": "vet-9"}); w.Code != http.StatusNotFound {
+		t.Errorf("Granting an unknown vet: expected status 404, got %d", w.Code)
+	}
+	w = grant(owner, map[string]any{"veterinarian_id": "vet-2"})
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Granting access: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var granted struct {
+		Data store.RecordConsent `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &granted)
+	if w := grant(owner, map[string]any{"veterinarian_id": "vet-2"}); w.Code != http.StatusConflict {
+		t.Errorf("Granting twice: expected status 409, got %d", w.Code)
+	}
+	if code := listRecords(specialist); code != http.StatusOK {
+		t.Errorf("Vet listing records with a grant: expected status 200, got %d", code)
+	}
+	revoke := func(user *middleware.UserClaims, consentID string) int {
+		req := createRequestWithContext("DELETE", "/api/v1/pets/"+pet.ID+"/record-consents/"+consentID, nil, user)
+		w := httptest.NewRecorder()
+		h.RevokeRecordAccess(w, withParams(req, "petId", pet.ID, "consentId", consentID))
+		return w.Code
+	}
+	if code := revoke(specialist, granted.Data.ID); code != http.StatusForbidden {
+		t.Errorf("Vet revoking a grant: expected status 403, got %d", code)
+	}
+	if code := revoke(owner, granted.Data.ID); code != http.StatusOK {
+		t.Errorf("Revoking access: expected status 200, got %d", code)
+	}
+	if code := revoke(owner, granted.Data.ID); code != http.StatusConflict {
+		t.Errorf("Revoking twice: expected status 409, got %d", code)
+	}
+	if code := listRecords(specialist); code != http.StatusForbidden {
+		t.Errorf("Vet listing records after revoking: expected status 403, got %d", code)
 	}
 
-	var response map[string]any
-	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
-		t.Errorf("Failed to parse response: %v", err)
+	// An appointment that took place within the window is consent enough; a
+	// booking still to come or one long past is not
+	upcoming := store.NewAppointment("client-1", "vet-3", pet.ID, time.Now().Add(24*time.Hour), 30, "Checkup")
+	_ = db.CreateAppointment(ctx, upcoming)
+	if code := listRecords(booked); code != http.StatusForbidden {
+		t.Errorf("Vet listing records with a future appointment: expected status 403, got %d", code)
 	}
 
-	if !response["success"].(bool) {
-		t.Errorf("Expected success to be true")
+	// Nor can the vet make it one by moving it into the past or completing it early
+	updateAppointment := func(body map[string]any) int {
+		req := createRequestWithContext("PUT", "/api/v1/appointments/"+upcoming.ID, body, booked)
+		req.Header.Set("If-Match", etag(upcoming.Version))
+		w := httptest.NewRecorder()
+		NewAppointmentHandler(db).UpdateAppointment(w, withParams(req, "id", upcoming.ID))
+		return w.Code
+	}
+	if code := updateAppointment(map[string]any{"appointment_date": time.Now().Add(-time.Hour)}); code != http.StatusBadRequest {
+		t.Errorf("Vet moving an appointment into the past: expected status 400, got %d", code)
+	}
+	if code := updateAppointment(map[string]any{"status": "completed"}); code != http.StatusBadRequest {
+		t.Errorf("Vet completing an appointment early: expected status 400, got %d", code)
+	}
+	if code := listRecords(booked); code != http.StatusForbidden {
+		t.Errorf("Vet listing records after editing a future appointment: expected status 403, got %d", code)
+	}
+	if code := updateAppointment(map[string]any{"notes": "Bring records"}); code != http.StatusOK {
+		t.Errorf("Vet updating notes: expected status 200, got %d", code)
+	}
+	_ = db.CreateAppointment(ctx, store.NewAppointment("client-1", "vet-3", pet.ID,
+		time.Now().Add(-store.AppointmentConsentWindow-24*time.Hour), 30, "Checkup"))
+	if code := listRecords(booked); code != http.StatusForbidden {
+		t.Errorf("Vet listing records with an old appointment: expected status 403, got %d", code)
+	}
+	_ = db.CreateAppointment(ctx, store.NewAppointment("client-1", "vet-3", pet.ID,
+		time.Now().Add(-24*time.Hour), 30, "Checkup"))
+	if code := listRecords(booked); code != http.StatusOK {
+		t.Errorf("Vet listing records after an appointment: expected status 200, got %d", code)
+	}
+
+	// Owners see who was given, took or used access; their own reads are left out
+	if code := listRecords(owner); code != http.StatusOK {
+		t.Errorf("Owner listing records: expected status 200, got %d", code)
+	}
+	req := createRequestWithContext("GET", "/api/v1/pets/"+pet.ID+"/record-access-log", nil, owner)
+	w = httptest.NewRecorder()
+	h.GetRecordAccessLog(w, withParams(req, "petId", pet.ID))
+	var log struct {
+		Data []store.AuditEntry `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &log)
+	counts := map[string]int{}
+	for _, e := range log.Data {
+		counts[e.ActorID+" "+e.Action]++
+	}
+	want := map[string]int{
+		"vet-1 create": 1, "vet-1 read": 1,
+		"client-1 create": 1, "client-1 update": 1,
+		"vet-2 read": 1, "vet-3 read": 1,
+	}
+	if w.Code != http.StatusOK || !maps.Equal(counts, want) {
+		t.Errorf("Record access log: expected %v, got %d %v", want, w.Code, counts)
+	}
+	req = createRequestWithContext("GET", "/api/v1/pets/"+pet.ID+"/record-access-log", nil, vet)
+	w = httptest.NewRecorder()
+	h.GetRecordAccessLog(w, withParams(req, "petId", pet.ID))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Vet reading the access log: expected status 403, got %d", w.Code)
 	}
 }
@@ -0,0 +1,207 @@
+// Package handlers contains invoice handlers
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"pet-mgt/backend/internal/invoices"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// InvoiceHandler handles the invoices and credit notes of orders
+type InvoiceHandler struct {
+	db store.Database
+}
+
+// NewInvoiceHandler creates a new InvoiceHandler
+func NewInvoiceHandler(db store.Database) *InvoiceHandler {
+	return &InvoiceHandler{db: db}
+}
+
+// GetOrderInvoice renders an order's invoice, issuing it on first request,
+// as HTML, PDF or JSON (order's client, order's veterinarian or admin)
+func (h *InvoiceHandler) GetOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.invoiceOrder(w, r)
+	if !ok {
+		return
+	}
+
+	inv, err := h.db.GetOrderInvoice(r.Context(), order.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		inv, err = invoices.Issue(r.Context(), h.db, order)
+		if err == nil {
+			recordAudit(r, h.db, store.AuditCreate, store.EntityInvoice, inv.ID, nil, inv)
+		}
+	}
+	switch {
+	case errors.Is(err, invoices.ErrNotInvoiceable):
+		ErrorResponse(w, http.StatusConflict, "Order was cancelled without payment and has no invoice")
+		return
+	case err != nil:
+		log.Printf("invoices: invoice for order %s: %v", order.ID, err)
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to issue invoice")
+		return
+	}
+	writeInvoice(w, r, inv)
+}
+
+// GetOrderCreditNotes lists an order's credit notes, oldest first (order's
+// client, order's veterinarian or admin)
+func (h *InvoiceHandler) GetOrderCreditNotes(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.invoiceOrder(w, r)
+	if !ok {
+		return
+	}
+
+	notes, err := h.db.GetOrderCreditNotes(r.Context(), order.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve credit notes")
+		return
+	}
+	SuccessResponse(w, notes)
+}
+
+// GetInvoice renders an invoice or credit note as HTML, PDF or JSON (its
+// client, its veterinarian or admin)
+func (h *InvoiceHandler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	invoiceID := chi.URLParam(r, "id")
+	if invoiceID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Invoice ID is required")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	inv, err := h.db.GetInvoiceByID(r.Context(), invoiceID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Invoice not found")
+		return
+	}
+	// Invoices outlive their orders, so access follows the parties they name
+	obj := policy.Object{
+		Resource:       policy.Invoice,
+		OwnerID:        inv.ClientID,
+		VeterinarianID: inv.VeterinarianID,
+	}
+	if !authorize(w, r, h.db, user, policy.Read, obj) {
+		return
+	}
+	writeInvoice(w, r, inv)
+}
+
+// invoiceOrder loads the order named in the URL and checks the current user
+// may see its invoices, writing the error response if not
+func (h *InvoiceHandler) invoiceOrder(w http.ResponseWriter, r *http.Request) (*store.Order, bool) {
+	orderID := chi.URLParam(r, "id")
+	if orderID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Order ID is required")
+		return nil, false
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	order, err := h.db.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return nil, false
+	}
+	if !authorize(w, r, h.db, user, policy.Read, orderObject(policy.Invoice, order)) {
+		return nil, false
+	}
+	return order, true
+}
+
+// writeInvoice renders inv in the format named by the format query
+// parameter, pdf, html or json, or else by the Accept header. HTML is the
+// default.
+func writeInvoice(w http.ResponseWriter, r *http.Request, inv *store.Invoice) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		accept := r.Header.Get("Accept")
+		switch {
+		case strings.Contains(accept, "application/pdf"):
+			format = "pdf"
+		case strings.Contains(accept, "application/json"):
+			format = "json"
+		default:
+			format = "html"
+		}
+	}
+
+	var (
+		buf         bytes.Buffer
+		contentType string
+		err         error
+	)
+	switch format {
+	case "json":
+		SuccessResponse(w, inv)
+		return
+	case "pdf":
+		contentType, err = "application/pdf", invoices.WritePDF(&buf, inv)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, inv.Number))
+	case "html":
+		contentType, err = "text/html; charset=utf-8", invoices.WriteHTML(&buf, inv)
+	default:
+		ErrorResponse(w, http.StatusBadRequest, "Format must be one of: pdf, html, json")
+		return
+	}
+	if err != nil {
+		log.Printf("invoices: rendering %s as %s: %v", inv.Number, format, err)
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to render invoice")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// creditRefund issues the credit note of amount refunded from payment. The
+// refund has already gone through, so a failure is logged rather than
+// reported to the caller.
+func creditRefund(r *http.Request, db store.Database, payment *store.Payment, amount store.Money) {
+	order, err := db.GetOrderByID(r.Context(), payment.OrderID)
+	if err == nil {
+		var note *store.Invoice
+		note, err = invoices.IssueRefund(r.Context(), db, order, payment, amount)
+		if err == nil {
+			recordAudit(r, db, store.AuditCreate, store.EntityInvoice, note.ID, nil, note)
+			return
+		}
+	}
+	log.Printf("invoices: credit note for refund of payment %s not issued: %v", payment.ID, err)
+}
+
+// creditReturn issues the credit note of a refunded return, logging failures
+// like creditRefund. Returns of nothing have no credit note.
+func creditReturn(r *http.Request, db store.Database, ret *store.Return) {
+	if ret.RefundAmount.IsZero() {
+		return
+	}
+	order, err := db.GetOrderByID(r.Context(), ret.OrderID)
+	if err == nil {
+		var note *store.Invoice
+		note, err = invoices.IssueReturn(r.Context(), db, order, ret)
+		if err == nil {
+			recordAudit(r, db, store.AuditCreate, store.EntityInvoice, note.ID, nil, note)
+			return
+		}
+	}
+	log.Printf("invoices: credit note for return %s not issued: %v", ret.ID, err)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
 	"pet-mgt/backend/internal/store"
 	"strings"
 	"time"
@@ -35,12 +36,6 @@ func (h *MedicalRecordHandler) CreateMedicalRecord(
 		return
 	}
 
-	// Require a veterinarian profile (admin must also have a veterinarian profile to satisfy FK)
-	if _, err := h.db.GetVeterinarianByID(r.Context(), user.Sub); err != nil && user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Veterinarian profile required to create medical records")
-		return
-	}
-
 	petID := chi.URLParam(r, "petId")
 	if petID == "" {
 		ErrorResponse(w, http.StatusBadRequest, "Pet ID is required")
@@ -62,12 +57,18 @@ func (h *MedicalRecordHandler) CreateMedicalRecord(
 	}
 
 	// Verify pet exists
-	_, err := h.db.GetPetByID(r.Context(), petID)
+	pet, err := h.db.GetPetByID(r.Context(), petID)
 	if err != nil {
 		ErrorResponse(w, http.StatusNotFound, "Pet not found")
 		return
 	}
 
+	// Only veterinarians and admins write records (admin must also have a
+	// veterinarian profile to satisfy FK)
+	if !authorize(w, r, h.db, user, policy.Create, petObject(policy.MedicalRecord, pet)) {
+		return
+	}
+
 	// Use current time if date not provided
 	if req.DateOfVisit.IsZero() {
 		req.DateOfVisit = time.Now()
@@ -84,8 +85,8 @@ func (h *MedicalRecordHandler) CreateMedicalRecord(
 			ErrorResponse(w, http.StatusBadRequest, "Appointment does not belong to this pet")
 			return
 		}
-		if appointment.VeterinarianID != user.Sub && user.Role != "admin" {
-			ErrorResponse(w, http.StatusForbidden, "You cannot link records to this appointment")
+		// Linking a record to an appointment takes the right to update it
+		if !authorize(w, r, h.db, user, policy.Update, appointmentObject(appointment)) {
 			return
 		}
 		appointmentIDPtr = &appointmentID
@@ -111,6 +112,7 @@ func (h *MedicalRecordHandler) CreateMedicalRecord(
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditCreate, store.EntityMedicalRecord, record.ID, nil, record)
 	SuccessResponse(w, record)
 }
 
@@ -138,23 +140,29 @@ func (h *MedicalRecordHandler) GetMedicalRecords(
 		return
 	}
 
-	// Authorization check: clients can only access their own pet's records, vets and admins can access any
-	if user.Role == "client" && pet.OwnerID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	// Authorization check: clients can only access their own pet's records, vets need the owner's consent
+	if !authorize(w, r, h.db, user, policy.List, petObject(policy.MedicalRecord, pet)) {
 		return
 	}
 
-	records, err := h.db.GetMedicalRecordsByPetID(r.Context(), petID)
+	page, err := parsePage(r)
 	if err != nil {
-		ErrorResponse(
-			w,
-			http.StatusInternalServerError,
-			"Failed to retrieve medical records",
-		)
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	SuccessResponse(w, records)
+	records, next, err := h.db.GetMedicalRecordsByPetID(r.Context(), petID, page)
+	if err != nil {
+		listErrorResponse(w, err, "Failed to retrieve medical records")
+		return
+	}
+
+	// Medical history is sensitive, so every record shown is audited
+	for _, record := range records {
+		recordAudit(r, h.db, store.AuditRead, store.EntityMedicalRecord, record.ID, nil, nil)
+	}
+	auditRecordAccess(r, h.db, pet)
+	ListResponse(w, records, next)
 }
 
 // GetMedicalRecord retrieves a specific medical record
@@ -187,12 +195,14 @@ func (h *MedicalRecordHandler) GetMedicalRecord(
 		return
 	}
 
-	// Authorization check: clients can only access their own pet's records, vets and admins can access any
-	if user.Role == "client" && pet.OwnerID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	// Authorization check: clients can only access their own pet's records, vets need the owner's consent
+	if !authorize(w, r, h.db, user, policy.Read, petObject(policy.MedicalRecord, pet)) {
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditRead, store.EntityMedicalRecord, record.ID, nil, nil)
+	auditRecordAccess(r, h.db, pet)
+	setETag(w, record.Version)
 	SuccessResponse(w, record)
 }
 
@@ -207,12 +217,6 @@ func (h *MedicalRecordHandler) UpdateMedicalRecord(
 		return
 	}
 
-	// Require a veterinarian profile; this also satisfies the FK constraint when updating
-	if _, err := h.db.GetVeterinarianByID(r.Context(), user.Sub); err != nil {
-		ErrorResponse(w, http.StatusForbidden, "Only veterinarians can update medical records")
-		return
-	}
-
 	recordID := chi.URLParam(r, "id")
 	if recordID == "" {
 		ErrorResponse(w, http.StatusBadRequest, "Record ID is required")
@@ -224,6 +228,13 @@ func (h *MedicalRecordHandler) UpdateMedicalRecord(
 		ErrorResponse(w, http.StatusNotFound, "Medical record not found")
 		return
 	}
+	if !h.authorizeRecord(w, r, user, policy.Update, record) {
+		return
+	}
+
+	if !checkIfMatch(w, r, record.Version) {
+		return
+	}
 
 	var req struct {
 		DateOfVisit          time.Time `json:"date_of_visit"`
@@ -250,14 +261,15 @@ func (h *MedicalRecordHandler) UpdateMedicalRecord(
 			ErrorResponse(w, http.StatusBadRequest, "Appointment does not belong to this pet")
 			return
 		}
-		if appointment.VeterinarianID != user.Sub && user.Role != "admin" {
-			ErrorResponse(w, http.StatusForbidden, "You cannot link records to this appointment")
+		// Linking a record to an appointment takes the right to update it
+		if !authorize(w, r, h.db, user, policy.Update, appointmentObject(appointment)) {
 			return
 		}
 		appointmentIDPtr = &appointmentID
 	}
 
 	// Update record fields
+	before := *record
 	record.DateOfVisit = req.DateOfVisit
 	record.ReasonForVisit = req.ReasonForVisit
 	record.Diagnosis = req.Diagnosis
@@ -267,14 +279,12 @@ func (h *MedicalRecordHandler) UpdateMedicalRecord(
 	record.UpdatedAt = time.Now()
 
 	if err := h.db.UpdateMedicalRecord(r.Context(), record); err != nil {
-		ErrorResponse(
-			w,
-			http.StatusInternalServerError,
-			"Failed to update medical record",
-		)
+		updateErrorResponse(w, err, "Failed to update medical record")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityMedicalRecord, record.ID, before, record)
+	setETag(w, record.Version)
 	SuccessResponse(w, record)
 }
 
@@ -289,12 +299,6 @@ func (h *MedicalRecordHandler) DeleteMedicalRecord(
 		return
 	}
 
-	// Require a veterinarian profile
-	if _, err := h.db.GetVeterinarianByID(r.Context(), user.Sub); err != nil {
-		ErrorResponse(w, http.StatusForbidden, "Only veterinarians can delete medical records")
-		return
-	}
-
 	recordID := chi.URLParam(r, "id")
 	if recordID == "" {
 		ErrorResponse(w, http.StatusBadRequest, "Record ID is required")
@@ -302,11 +306,14 @@ func (h *MedicalRecordHandler) DeleteMedicalRecord(
 	}
 
 	// Check if record exists
-	_, err := h.db.GetMedicalRecordByID(r.Context(), recordID)
+	record, err := h.db.GetMedicalRecordByID(r.Context(), recordID)
 	if err != nil {
 		ErrorResponse(w, http.StatusNotFound, "Medical record not found")
 		return
 	}
+	if !h.authorizeRecord(w, r, user, policy.Delete, record) {
+		return
+	}
 
 	if err := h.db.DeleteMedicalRecord(r.Context(), recordID); err != nil {
 		ErrorResponse(
@@ -317,5 +324,23 @@ func (h *MedicalRecordHandler) DeleteMedicalRecord(
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditDelete, store.EntityMedicalRecord, record.ID, record, nil)
 	MessageResponse(w, http.StatusOK, "Medical record deleted successfully")
 }
+
+// authorizeRecord checks the current user may take action on record, which
+// belongs to its pet's owner, writing the error response if not
+func (h *MedicalRecordHandler) authorizeRecord(
+	w http.ResponseWriter,
+	r *http.Request,
+	user *middleware.UserClaims,
+	action policy.Action,
+	record *store.MedicalRecord,
+) bool {
+	pet, err := h.db.GetPetByID(r.Context(), record.PetID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Pet not found")
+		return false
+	}
+	return authorize(w, r, h.db, user, action, petObject(policy.MedicalRecord, pet))
+}
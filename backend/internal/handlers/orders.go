@@ -3,9 +3,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
 	"pet-mgt/backend/internal/store"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -29,9 +33,14 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Only clients can create orders (unless admin)
-	if user.Role != "client" && user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Only clients can create orders")
+	// Clients order for themselves, or for the client in the client_id query
+	// parameter when pet access lets them; admins for anyone
+	clientID := user.Sub
+	if r.URL.Query().Get("client_id") != "" {
+		clientID = r.URL.Query().Get("client_id")
+	}
+	obj := policy.Object{Resource: policy.Order, OwnerID: clientID}
+	if !authorize(w, r, h.db, user, policy.Create, obj) {
 		return
 	}
 
@@ -46,6 +55,7 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		ShippingAddress string `json:"shipping_address,omitempty"`
 		DeliveryMethod  string `json:"delivery_method,omitempty"`
 		Notes           string `json:"notes,omitempty"`
+		DiscountCode    string `json:"discount_code,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -69,10 +79,16 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusNotFound, "Veterinarian not found")
 		return
 	}
+	if req.DiscountCode != "" {
+		if msg := checkDiscountCode(r.Context(), h.db, req.DiscountCode, req.VeterinarianID); msg != "" {
+			ErrorResponse(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
 
-	// Calculate total amount and validate products
-	var totalAmount float64
+	// Validate products and build line items; prices are re-read by the store
 	var orderItems []store.OrderItem
+	productNames := make(map[string]string)
 
 	for _, item := range req.Items {
 		if item.Quantity <= 0 {
@@ -100,18 +116,8 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 			)
 			return
 		}
+		productNames[product.ID] = product.Name
 
-		// Check stock availability
-		if product.StockQuantity < item.Quantity {
-			ErrorResponse(
-				w,
-				http.StatusBadRequest,
-				"Insufficient stock for product: "+product.Name,
-			)
-			return
-		}
-
-		// Create order item
 		orderItem := store.NewOrderItem(
 			"",
 			item.ProductID,
@@ -119,16 +125,13 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 			product.Price,
 		)
 		orderItems = append(orderItems, *orderItem)
-		totalAmount += orderItem.TotalPrice
 	}
 
 	// Create order
-	clientID := user.Sub
-	if user.Role == "admin" && r.URL.Query().Get("client_id") != "" {
-		clientID = r.URL.Query().Get("client_id")
+	order := store.NewOrder(clientID, req.VeterinarianID, store.Money{})
+	if clientID != user.Sub {
+		order.PlacedBy = user.Sub
 	}
-
-	order := store.NewOrder(clientID, req.VeterinarianID, totalAmount)
 	if req.PaymentMethod != "" {
 		order.PaymentMethod = req.PaymentMethod
 	}
@@ -141,31 +144,15 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	if req.Notes != "" {
 		order.Notes = req.Notes
 	}
+	order.DiscountCode = store.NormalizePromotionCode(req.DiscountCode)
 
-	// Create order in database
-	if err := h.db.CreateOrder(r.Context(), order); err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to create order")
+	// Insert order and items and decrement stock as one unit of work
+	if err := h.db.PlaceOrder(r.Context(), order, orderItems); err != nil {
+		writePlaceOrderError(w, err, productNames)
 		return
 	}
 
-	// Create order items
-	for i := range orderItems {
-		orderItems[i].OrderID = order.ID
-		if err := h.db.CreateOrderItem(r.Context(), &orderItems[i]); err != nil {
-			ErrorResponse(
-				w,
-				http.StatusInternalServerError,
-				"Failed to create order items",
-			)
-			return
-		}
-
-		// Update product stock
-		product, _ := h.db.GetProductByID(r.Context(), orderItems[i].ProductID)
-		newStock := product.StockQuantity - orderItems[i].Quantity
-		h.db.UpdateProductStock(r.Context(), orderItems[i].ProductID, newStock)
-	}
-
+	recordAudit(r, h.db, store.AuditCreate, store.EntityOrder, order.ID, nil, order)
 	// Return order with items
 	response := map[string]any{
 		"order": order,
@@ -175,6 +162,27 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	SuccessResponse(w, response)
 }
 
+// writePlaceOrderError maps store.PlaceOrder failures onto HTTP responses
+func writePlaceOrderError(w http.ResponseWriter, err error, productNames map[string]string) {
+	var stockErr *store.InsufficientStockError
+	switch {
+	case errors.As(err, &stockErr):
+		name := productNames[stockErr.ProductID]
+		if name == "" {
+			name = stockErr.ProductID
+		}
+		ErrorResponse(w, http.StatusConflict, "Insufficient stock for product: "+name)
+	case errors.Is(err, store.ErrPromotionUnavailable):
+		ErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrInvalidOrder):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, err.Error())
+	default:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to create order")
+	}
+}
+
 // GetOrders retrieves orders for the current user
 func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	// Get current user from context
@@ -184,38 +192,36 @@ func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := listFilter(r, h.db, user, policy.Order)
+	if !authorize(w, r, h.db, user, policy.List, filter) {
+		return
+	}
+
 	var orders []store.Order
-	var err error
-
-	switch user.Role {
-	case "client":
-		orders, err = h.db.GetOrdersByClientID(r.Context(), user.Sub)
-	case "veterinarian":
-		orders, err = h.db.GetOrdersByVeterinarianID(r.Context(), user.Sub)
-	case "admin":
-		// For admin, check query params
-		clientID := r.URL.Query().Get("client_id")
-		vetID := r.URL.Query().Get("veterinarian_id")
-
-		if clientID != "" {
-			orders, err = h.db.GetOrdersByClientID(r.Context(), clientID)
-		} else if vetID != "" {
-			orders, err = h.db.GetOrdersByVeterinarianID(r.Context(), vetID)
-		} else {
-			// NOTE: Return empty for now - would need a new method for all orders
-			orders = []store.Order{}
-		}
+	var next string
+
+	switch {
+	case filter.OwnerID != "":
+		orders, next, err = h.db.GetOrdersByClientID(r.Context(), filter.OwnerID, page)
+	case filter.VeterinarianID != "":
+		orders, next, err = h.db.GetOrdersByVeterinarianID(r.Context(), filter.VeterinarianID, page)
 	default:
-		ErrorResponse(w, http.StatusForbidden, "Invalid user role")
-		return
+		// NOTE: Return empty for now - would need a new method for all orders
+		orders = []store.Order{}
 	}
 
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve orders")
+		listErrorResponse(w, err, "Failed to retrieve orders")
 		return
 	}
 
-	SuccessResponse(w, orders)
+	ListResponse(w, orders, next)
 }
 
 // GetOrder retrieves a specific order
@@ -240,16 +246,8 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check permissions
-	if user.Role != "admin" {
-		if user.Role == "client" && order.ClientID != user.Sub {
-			ErrorResponse(w, http.StatusForbidden, "You can only view your own orders")
-			return
-		}
-		if user.Role == "veterinarian" && order.VeterinarianID != user.Sub {
-			ErrorResponse(w, http.StatusForbidden, "You can only view your own orders")
-			return
-		}
+	if !authorize(w, r, h.db, user, policy.Read, orderObject(policy.Order, order)) {
+		return
 	}
 
 	// Get order items
@@ -295,13 +293,7 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Check permissions - only veterinarian who owns the order or admin can update status
-	if user.Role != "admin" &&
-		(user.Role != "veterinarian" || order.VeterinarianID != user.Sub) {
-		ErrorResponse(
-			w,
-			http.StatusForbidden,
-			"You can only update status for your own orders",
-		)
+	if !authorize(w, r, h.db, user, policy.Update, orderObject(policy.Order, order)) {
 		return
 	}
 
@@ -309,6 +301,7 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		Status        string `json:"status,omitempty"`
 		PaymentStatus string `json:"payment_status,omitempty"`
+		Note          string `json:"note,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -317,56 +310,95 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Validate status values
-	if req.Status != "" {
-		validStatuses := map[string]bool{
-			"pending":    true,
-			"confirmed":  true,
-			"processing": true,
-			"shipped":    true,
-			"delivered":  true,
-			"cancelled":  true,
-		}
-		if !validStatuses[req.Status] {
-			ErrorResponse(w, http.StatusBadRequest, "Invalid order status")
-			return
-		}
+	if req.Status != "" && !store.IsValidOrderStatus(req.Status) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid order status")
+		return
+	}
+
+	if req.PaymentStatus != "" && !store.IsValidPaymentStatus(req.PaymentStatus) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid payment status")
+		return
 	}
+	settle := req.PaymentStatus != "" && req.PaymentStatus != order.PaymentStatus
+	if settle && !h.canSettleOffline(w, r, order, req.PaymentStatus) {
+		return
+	}
+
+	before := map[string]string{"status": order.Status}
+	after := map[string]string{"status": order.Status}
 
-	if req.PaymentStatus != "" {
-		validPaymentStatuses := map[string]bool{
-			"pending":  true,
-			"paid":     true,
-			"failed":   true,
-			"refunded": true,
+	// Payments settled outside the gateway, such as cash on pickup, are
+	// recorded by setting the payment status directly, together with the
+	// move through the lifecycle when there is one
+	paymentStatus := ""
+	if settle {
+		paymentStatus = req.PaymentStatus
+	}
+	if req.Status != "" && req.Status != order.Status {
+		if !h.transitionOrder(w, r, order, req.Status, req.Note, paymentStatus) {
+			return
 		}
-		if !validPaymentStatuses[req.PaymentStatus] {
-			ErrorResponse(w, http.StatusBadRequest, "Invalid payment status")
+		after["status"] = req.Status
+	} else if settle {
+		err := h.db.UpdateOrderPaymentStatus(r.Context(), orderID, req.PaymentStatus)
+		if err != nil {
+			ErrorResponse(
+				w,
+				http.StatusInternalServerError,
+				"Failed to update payment status",
+			)
 			return
 		}
 	}
-
-	// Update status
-	statusToUpdate := req.Status
-	if statusToUpdate == "" {
-		statusToUpdate = order.Status
-	}
-
-	if err := h.db.UpdateOrderStatus(r.Context(), orderID, statusToUpdate); err != nil {
-		ErrorResponse(
-			w,
-			http.StatusInternalServerError,
-			"Failed to update order status",
-		)
-		return
+	if settle {
+		before["payment_status"] = order.PaymentStatus
+		after["payment_status"] = req.PaymentStatus
+		after["settlement"] = "offline"
 	}
 
-	// If payment status is provided, we'd need a separate method to update it
-	// For now, just return success for the order status update
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityOrder, orderID, before, after)
 
 	MessageResponse(w, http.StatusOK, "Order status updated successfully")
 }
 
-// CancelOrder cancels an order (clients and veterinarians can cancel their own orders)
+// canSettleOffline checks an order may be marked paid outside the gateway,
+// writing the error response if not. Only unpaid orders with no gateway
+// attempt in progress can be; every other payment status, refunds included,
+// is left to the gateway and its webhooks so that each has a payment behind
+// it.
+func (h *OrderHandler) canSettleOffline(
+	w http.ResponseWriter,
+	r *http.Request,
+	order *store.Order,
+	paymentStatus string,
+) bool {
+	if paymentStatus != store.PaymentPaid {
+		ErrorResponse(w, http.StatusBadRequest,
+			"payment_status can only be set to paid, for payments taken outside the gateway")
+		return false
+	}
+	if order.Status == store.OrderCancelled ||
+		order.PaymentStatus != store.PaymentPending && order.PaymentStatus != store.PaymentFailed {
+		ErrorResponse(w, http.StatusConflict, "Order cannot be marked paid")
+		return false
+	}
+
+	payments, err := h.db.GetOrderPayments(r.Context(), order.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve payments")
+		return false
+	}
+	for _, p := range payments {
+		if p.Status == store.PaymentPending {
+			ErrorResponse(w, http.StatusConflict, "Order has a payment in progress")
+			return false
+		}
+	}
+	return true
+}
+
+// CancelOrder cancels an order and puts its items back in stock (clients and
+// veterinarians can cancel their own orders until they ship)
 func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	orderID := chi.URLParam(r, "id")
 	if orderID == "" {
@@ -388,49 +420,120 @@ func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check permissions
-	canCancel := false
-	if user.Role == "admin" {
-		canCancel = true
-	} else if user.Role == "client" && order.ClientID == user.Sub {
-		canCancel = true
-	} else if user.Role == "veterinarian" && order.VeterinarianID == user.Sub {
-		canCancel = true
+	if !authorize(w, r, h.db, user, policy.Cancel, orderObject(policy.Order, order)) {
+		return
 	}
 
-	if !canCancel {
-		ErrorResponse(w, http.StatusForbidden, "You can only cancel your own orders")
+	// The reason for cancelling is optional, so an empty body is fine
+	var req struct {
+		Note string `json:"note,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Check if order can be cancelled
-	if order.Status == "shipped" || order.Status == "delivered" ||
-		order.Status == "cancelled" {
-		ErrorResponse(
-			w,
-			http.StatusBadRequest,
-			"Order cannot be cancelled in current status",
-		)
+	if !h.transitionOrder(w, r, order, store.OrderCancelled, req.Note, "") {
+		return
+	}
+
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityOrder, orderID,
+		map[string]string{"status": order.Status},
+		map[string]string{"status": store.OrderCancelled},
+	)
+
+	MessageResponse(w, http.StatusOK, "Order cancelled successfully")
+}
+
+// GetOrderHistory lists an order's status changes, oldest first (order's
+// client, order's veterinarian or admin)
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "id")
+	if orderID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Order ID is required")
 		return
 	}
 
-	// Cancel order
-	if err := h.db.UpdateOrderStatus(r.Context(), orderID, "cancelled"); err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to cancel order")
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Restore product stock
-	items, err := h.db.GetOrderItems(r.Context(), orderID)
-	if err == nil {
-		for _, item := range items {
-			product, err := h.db.GetProductByID(r.Context(), item.ProductID)
-			if err == nil {
-				newStock := product.StockQuantity + item.Quantity
-				h.db.UpdateProductStock(r.Context(), item.ProductID, newStock)
-			}
+	order, err := h.db.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.History, orderObject(policy.Order, order)) {
+		return
+	}
+
+	history, err := h.db.GetOrderStatusHistory(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve order history")
+		return
+	}
+	SuccessResponse(w, history)
+}
+
+// transitionOrder moves order to status to on behalf of the current user,
+// setting its payment status to paymentStatus as well unless that is empty,
+// writing the error response and returning false if the lifecycle does not
+// allow it. Callers have already checked the user may act on the order.
+func (h *OrderHandler) transitionOrder(
+	w http.ResponseWriter,
+	r *http.Request,
+	order *store.Order,
+	to string,
+	note string,
+	paymentStatus string,
+) bool {
+	user, _ := middleware.GetUserFromContext(r.Context())
+	if !store.CanTransitionOrder(order.Status, to, user.Role) {
+		next := store.NextOrderStatuses(order.Status, user.Role)
+		msg := "Order cannot move from " + order.Status + " to " + to
+		if len(next) > 0 {
+			msg += "; allowed: " + strings.Join(next, ", ")
 		}
+		ErrorResponse(w, http.StatusConflict, msg)
+		return false
+	}
+
+	change := store.NewOrderStatusChange(order.ID, order.Status, to, user.Sub, note)
+	change.PaymentStatus = paymentStatus
+	err := h.db.TransitionOrder(r.Context(), change)
+	switch {
+	case errors.Is(err, store.ErrOrderPaid):
+		ErrorResponse(w, http.StatusConflict, "Paid orders must be refunded before they are cancelled")
+		return false
+	case errors.Is(err, store.ErrOrderTransition):
+		ErrorResponse(w, http.StatusConflict, "Order status changed, please retry")
+		return false
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return false
+	case err != nil:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to update order status")
+		return false
 	}
+	return true
+}
 
-	MessageResponse(w, http.StatusOK, "Order cancelled successfully")
+// orderObject describes order, or its payments, returns or invoices, to the
+// policy as resource: they belong to the client the order was placed for, were
+// placed by them unless PlacedBy says otherwise, and are assigned to its
+// veterinarian
+func orderObject(resource policy.Resource, order *store.Order) policy.Object {
+	placedBy := order.PlacedBy
+	if placedBy == "" {
+		placedBy = order.ClientID
+	}
+	return policy.Object{
+		Resource:       resource,
+		OwnerID:        order.ClientID,
+		VeterinarianID: order.VeterinarianID,
+		PlacedBy:       placedBy,
+	}
 }
@@ -0,0 +1,33 @@
+// Package handlers/pagination.go contains cursor pagination helpers for list endpoints
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pet-mgt/backend/internal/store"
+	"strconv"
+)
+
+// parsePage reads the limit and cursor query parameters. Without a limit the
+// store default applies; larger limits are capped at store.MaxPageLimit.
+func parsePage(r *http.Request) (store.Page, error) {
+	page := store.Page{Cursor: r.URL.Query().Get("cursor")}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = min(limit, store.MaxPageLimit)
+	}
+	return page, nil
+}
+
+// listErrorResponse reports a failed list query. A cursor the store cannot
+// decode is the client's fault; anything else is a server error.
+func listErrorResponse(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, store.ErrInvalidCursor) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	ErrorResponse(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,409 @@
+// Package handlers contains payment handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/payments"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWebhookBody caps the size of a webhook request body
+const maxWebhookBody = 64 << 10
+
+// lostIntentReason is the failure reason of payments whose intent the
+// gateway no longer has
+const lostIntentReason = "intent_not_found"
+
+// PaymentHandler handles order payments through a payment gateway
+type PaymentHandler struct {
+	db            store.Database
+	gateway       payments.Gateway
+	webhookSecret string
+}
+
+// NewPaymentHandler creates a new PaymentHandler that takes payments through
+// gateway and accepts webhooks signed with webhookSecret
+func NewPaymentHandler(
+	db store.Database,
+	gateway payments.Gateway,
+	webhookSecret string,
+) *PaymentHandler {
+	return &PaymentHandler{db: db, gateway: gateway, webhookSecret: webhookSecret}
+}
+
+// CreatePayment starts a payment attempt for an order's total and returns it
+// with the client secret the client authorizes it with (order's client or
+// admin)
+func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "id")
+	if orderID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Order ID is required")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	order, err := h.db.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.Create, orderObject(policy.Payment, order)) {
+		return
+	}
+
+	switch {
+	case order.Status == store.OrderCancelled:
+		ErrorResponse(w, http.StatusConflict, "Cancelled orders cannot be paid")
+		return
+	case order.PaymentStatus == store.PaymentPaid || order.PaymentStatus == store.PaymentRefunded:
+		ErrorResponse(w, http.StatusConflict, "Order has already been paid")
+		return
+	}
+	attempts, err := h.db.GetOrderPayments(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve payments")
+		return
+	}
+	for _, p := range attempts {
+		if p.Status == store.PaymentPending && !h.abandonLostIntent(r, &p) {
+			ErrorResponse(w, http.StatusConflict, "Order already has a pending payment: "+p.ID)
+			return
+		}
+	}
+
+	intent, err := h.gateway.CreateIntent(r.Context(), order.ID, order.TotalAmount)
+	if errors.Is(err, payments.ErrDisabled) {
+		ErrorResponse(w, http.StatusServiceUnavailable, "Online payments are not available")
+		return
+	}
+	if err != nil {
+		log.Printf("payments: create intent for order %s failed: %v", order.ID, err)
+		ErrorResponse(w, http.StatusBadGateway, "Payment gateway failed to start the payment")
+		return
+	}
+
+	payment := store.NewPayment(order.ID, h.gateway.Name(), intent.ID, intent.Amount)
+	// A request racing this one may have started an attempt since the check
+	// above; the store keeps it to one pending attempt per order
+	if err := h.db.CreatePayment(r.Context(), payment); errors.Is(err, store.ErrConflict) {
+		ErrorResponse(w, http.StatusConflict, "Order already has a pending payment")
+		return
+	} else if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to record payment")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditCreate, store.EntityPayment, payment.ID, nil, payment)
+	SuccessResponse(w, map[string]any{
+		"payment":       payment,
+		"client_secret": intent.ClientSecret,
+	})
+}
+
+// abandonLostIntent fails a pending payment whose intent the gateway no
+// longer has, such as one the fake gateway forgot when the server restarted,
+// so that it does not block paying the order again. It reports whether the
+// payment was failed.
+func (h *PaymentHandler) abandonLostIntent(r *http.Request, payment *store.Payment) bool {
+	if payment.Provider != h.gateway.Name() {
+		return false
+	}
+	_, err := h.gateway.Intent(r.Context(), payment.IntentID)
+	if !errors.Is(err, payments.ErrIntentNotFound) {
+		return false
+	}
+
+	failed, err := h.db.SetPaymentStatus(
+		r.Context(), payment.ID, store.PaymentFailed, lostIntentReason)
+	if err != nil {
+		log.Printf("payments: failing payment %s with a lost intent: %v", payment.ID, err)
+		return false
+	}
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityPayment, payment.ID,
+		map[string]string{"status": payment.Status},
+		map[string]string{"status": failed.Status, "failure_reason": failed.FailureReason},
+	)
+	return true
+}
+
+// GetOrderPayments lists an order's payment attempts, oldest first (order's
+// client, order's veterinarian or admin)
+func (h *PaymentHandler) GetOrderPayments(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "id")
+	if orderID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Order ID is required")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	order, err := h.db.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.List, orderObject(policy.Payment, order)) {
+		return
+	}
+
+	attempts, err := h.db.GetOrderPayments(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve payments")
+		return
+	}
+	SuccessResponse(w, attempts)
+}
+
+// CapturePayment takes an authorized payment (order's client, order's
+// veterinarian or admin)
+func (h *PaymentHandler) CapturePayment(w http.ResponseWriter, r *http.Request) {
+	payment, ok := h.orderPayment(w, r, policy.Capture)
+	if !ok {
+		return
+	}
+
+	intent, err := h.gateway.Capture(r.Context(), payment.IntentID)
+	if err != nil {
+		writeGatewayError(w, err, "capture")
+		return
+	}
+	h.applyIntent(w, r, payment, intent)
+}
+
+// RefundPayment returns a captured payment, in full or the amount given
+// (order's veterinarian or admin)
+func (h *PaymentHandler) RefundPayment(w http.ResponseWriter, r *http.Request) {
+	payment, ok := h.orderPayment(w, r, policy.Refund)
+	if !ok {
+		return
+	}
+
+	// Refund what is left of the payment unless an amount is given
+	var req struct {
+		Amount *store.Money `json:"amount,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	amount := payment.Remaining()
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+
+	intent, err := h.gateway.Refund(r.Context(), payment.IntentID, amount)
+	if err != nil {
+		writeGatewayError(w, err, "refund")
+		return
+	}
+	h.applyIntent(w, r, payment, intent)
+}
+
+// HandleWebhook applies a signed gateway event to the payment it names and
+// its order. Events that would not move the payment, such as redeliveries,
+// are acknowledged without changing anything.
+func (h *PaymentHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	// An empty secret would accept events signed with an empty key
+	if h.webhookSecret == "" {
+		ErrorResponse(w, http.StatusServiceUnavailable, "Payment webhooks are not configured")
+		return
+	}
+	err = payments.VerifySignature(
+		h.webhookSecret, r.Header.Get(payments.SignatureHeader), body, time.Now())
+	if err != nil {
+		ErrorResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	event, err := payments.ParseEvent(body)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	status := event.PaymentStatus()
+	if status == "" {
+		MessageResponse(w, http.StatusOK, "Event ignored")
+		return
+	}
+
+	payment, err := h.db.GetPaymentByIntentID(r.Context(), h.gateway.Name(), event.IntentID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Payment not found for intent: "+event.IntentID)
+		return
+	}
+
+	var updated *store.Payment
+	if status == store.PaymentRefunded {
+		refunded := payment.Amount
+		if event.AmountRefunded != nil {
+			refunded = *event.AmountRefunded
+		}
+		updated, err = h.db.RecordPaymentRefund(r.Context(), payment.ID, refunded)
+	} else {
+		updated, err = h.db.SetPaymentStatus(r.Context(), payment.ID, status, event.FailureReason)
+	}
+	switch {
+	case errors.Is(err, store.ErrPaymentTransition):
+		MessageResponse(w, http.StatusOK, "Event ignored")
+		return
+	case errors.Is(err, store.ErrInvalidPayment):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to update payment")
+		return
+	}
+
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityPayment, payment.ID,
+		map[string]string{"status": payment.Status},
+		map[string]string{"status": updated.Status, "event_id": event.ID},
+	)
+	if refunded := updated.RefundedAmount.Amount - payment.RefundedAmount.Amount; refunded > 0 {
+		creditRefund(r, h.db, updated, store.NewMoney(refunded, updated.Amount.Currency))
+	}
+	MessageResponse(w, http.StatusOK, "Event processed")
+}
+
+// orderPayment loads the payment named in the URL and checks the current
+// user may take action on it, writing the error response if not
+func (h *PaymentHandler) orderPayment(
+	w http.ResponseWriter,
+	r *http.Request,
+	action policy.Action,
+) (*store.Payment, bool) {
+	paymentID := chi.URLParam(r, "id")
+	if paymentID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Payment ID is required")
+		return nil, false
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	payment, err := h.db.GetPaymentByID(r.Context(), paymentID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Payment not found")
+		return nil, false
+	}
+	order, err := h.db.GetOrderByID(r.Context(), payment.OrderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return nil, false
+	}
+
+	if !authorize(w, r, h.db, user, action, orderObject(policy.Payment, order)) {
+		return nil, false
+	}
+
+	return payment, true
+}
+
+// applyIntent records the status a gateway call left an intent in on its
+// payment and responds with the payment. A webhook may have recorded it
+// already, in which case the stored payment is returned as it is. Refunds
+// recorded here get a credit note.
+func (h *PaymentHandler) applyIntent(
+	w http.ResponseWriter,
+	r *http.Request,
+	payment *store.Payment,
+	intent *payments.Intent,
+) {
+	updated, recorded, err := recordIntent(r.Context(), h.db, payment, intent)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to update payment")
+		return
+	}
+	if !recorded {
+		SuccessResponse(w, updated)
+		return
+	}
+	if refunded := updated.RefundedAmount.Amount - payment.RefundedAmount.Amount; refunded > 0 {
+		creditRefund(r, h.db, updated, store.NewMoney(refunded, updated.Amount.Currency))
+	}
+
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityPayment, payment.ID,
+		map[string]any{"status": payment.Status, "refunded_amount": payment.RefundedAmount},
+		map[string]any{"status": updated.Status, "refunded_amount": updated.RefundedAmount},
+	)
+	SuccessResponse(w, updated)
+}
+
+// recordIntent stores the status and refunds a gateway reported for intent
+// on its payment and reports whether that changed the payment. When a webhook
+// got there first it returns the payment as stored and reports no change.
+func recordIntent(
+	ctx context.Context,
+	db store.Database,
+	payment *store.Payment,
+	intent *payments.Intent,
+) (*store.Payment, bool, error) {
+	status := payments.PaymentStatus(intent.Status)
+	var (
+		updated *store.Payment
+		err     error
+	)
+	switch {
+	case store.IsRefundable(payment.Status) && status != store.PaymentPaid:
+		updated, err = db.RecordPaymentRefund(ctx, payment.ID, intent.AmountRefunded)
+	case status != payment.Status:
+		updated, err = db.SetPaymentStatus(ctx, payment.ID, status, intent.FailureReason)
+	default:
+		return payment, false, nil
+	}
+	if errors.Is(err, store.ErrPaymentTransition) {
+		updated, err = db.GetPaymentByID(ctx, payment.ID)
+		return updated, false, err
+	}
+	return updated, err == nil, err
+}
+
+// writeGatewayError maps payment gateway failures onto HTTP responses
+func writeGatewayError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, payments.ErrIntentState):
+		ErrorResponse(w, http.StatusConflict, "Payment's current status does not allow a "+action)
+	case errors.Is(err, payments.ErrRefundAmount):
+		ErrorResponse(
+			w,
+			http.StatusBadRequest,
+			"Refund amount must be positive and within what is left of the payment",
+		)
+	case errors.Is(err, payments.ErrIntentNotFound):
+		ErrorResponse(w, http.StatusNotFound, "Payment not found at the gateway")
+	case errors.Is(err, payments.ErrDisabled):
+		ErrorResponse(w, http.StatusServiceUnavailable, "Online payments are not available")
+	default:
+		log.Printf("payments: %s failed: %v", action, err)
+		ErrorResponse(w, http.StatusBadGateway, "Payment gateway failed to "+action+" the payment")
+	}
+}
@@ -0,0 +1,258 @@
+// Package handlers contains the pet access handlers owners share their pets with
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PetAccessHandler handles the grants that let pet owners share their pets
+// with co-owners and caretakers
+type PetAccessHandler struct {
+	db store.Database
+}
+
+// NewPetAccessHandler creates a new PetAccessHandler
+func NewPetAccessHandler(db store.Database) *PetAccessHandler {
+	return &PetAccessHandler{db: db}
+}
+
+// GrantPetAccess invites the client with the email given to act for a pet
+// as co-owner or caretaker (pet's owner or admin). Without permissions the
+// role's defaults apply. A client whose earlier grant has expired can be
+// invited again; one with an active grant must have it revoked first. An
+// email no client has yet gets an invitation the client claims on signing
+// up, with the same response, so owners cannot probe for accounts.
+func (h *PetAccessHandler) GrantPetAccess(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.Create, petObject(policy.PetAccess, pet)) {
+		return
+	}
+
+	var req struct {
+		Email       string     `json:"email"`
+		Role        string     `json:"role"`
+		Permissions []string   `json:"permissions,omitempty"`
+		ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Email) == "" || req.Role == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Missing required fields (email, role)")
+		return
+	}
+
+	// An email no client has gets an invitation they claim on signing up
+	email := strings.TrimSpace(req.Email)
+	grantee, err := h.db.GetClientByEmail(r.Context(), email)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		grantee = &store.Client{Email: email}
+	case err != nil:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to grant pet access")
+		return
+	}
+	if req.Permissions == nil {
+		req.Permissions = store.DefaultPetAccessPermissions(req.Role)
+	}
+	grant := store.NewPetAccessGrant(pet.ID, pet.OwnerID, grantee, req.Role, req.Permissions,
+		req.ExpiresAt, user.Sub)
+
+	// An expired grant still holds the client's place until it is revoked
+	grants, err := h.db.GetPetAccessGrants(r.Context(), pet.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve pet access")
+		return
+	}
+	for _, g := range grants {
+		if !g.SameGrantee(grant) || g.RevokedAt != nil {
+			continue
+		}
+		if g.Active(grant.CreatedAt) {
+			ErrorResponse(w, http.StatusConflict, "Client already has access to this pet")
+			return
+		}
+		if !h.revoke(w, r, &g, grant.CreatedAt) {
+			return
+		}
+	}
+
+	if err := h.db.CreatePetAccessGrant(r.Context(), grant); err != nil {
+		writePetAccessError(w, err, "Failed to grant pet access")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditCreate, store.EntityPetAccess, grant.ID, nil, grant)
+	SuccessResponse(w, ownerView(*grant))
+}
+
+// GetPetAccessGrants lists who has been given access to a pet, revoked and
+// expired grants included (pet's owner or admin)
+func (h *PetAccessHandler) GetPetAccessGrants(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.List, petObject(policy.PetAccess, pet)) {
+		return
+	}
+
+	grants, err := h.db.GetPetAccessGrants(r.Context(), pet.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve pet access")
+		return
+	}
+	for i := range grants {
+		grants[i] = ownerView(grants[i])
+	}
+	SuccessResponse(w, grants)
+}
+
+// GetReceivedPetAccess lists the grants the current client has received.
+// Admins list a client's with the client_id query parameter.
+func (h *PetAccessHandler) GetReceivedPetAccess(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	filter := listFilter(r, h.db, user, policy.PetAccess)
+	if !authorize(w, r, h.db, user, policy.List, filter) {
+		return
+	}
+	if filter.OwnerID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "client_id is required")
+		return
+	}
+
+	grants, err := h.db.GetGranteePetAccessGrants(r.Context(), filter.OwnerID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve pet access")
+		return
+	}
+	SuccessResponse(w, grants)
+}
+
+// RevokePetAccess ends a grant on a pet (pet's owner, the client who received
+// it or admin)
+func (h *PetAccessHandler) RevokePetAccess(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	grant, err := h.db.GetPetAccessGrantByID(r.Context(), chi.URLParam(r, "grantId"))
+	if err != nil || grant.PetID != pet.ID {
+		ErrorResponse(w, http.StatusNotFound, "Pet access grant not found")
+		return
+	}
+
+	// Grantees may give up access they no longer want
+	obj := petObject(policy.PetAccess, pet)
+	if grant.GranteeID == user.Sub {
+		obj.OwnerID = user.Sub
+	}
+	if !authorize(w, r, h.db, user, policy.Delete, obj) {
+		return
+	}
+	if grant.RevokedAt != nil {
+		ErrorResponse(w, http.StatusConflict, "Pet access has already been revoked")
+		return
+	}
+
+	if !h.revoke(w, r, grant, time.Now()) {
+		return
+	}
+	SuccessResponse(w, ownerView(*grant))
+}
+
+// pet loads the pet named in the URL, writing the error response if it
+// does not exist
+func (h *PetAccessHandler) pet(w http.ResponseWriter, r *http.Request) (*store.Pet, bool) {
+	petID := chi.URLParam(r, "petId")
+	if petID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Pet ID is required")
+		return nil, false
+	}
+	pet, err := h.db.GetPetByID(r.Context(), petID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Pet not found")
+		return nil, false
+	}
+	return pet, true
+}
+
+// revoke ends grant at and audits it, writing the error response if it
+// cannot
+func (h *PetAccessHandler) revoke(
+	w http.ResponseWriter,
+	r *http.Request,
+	grant *store.PetAccessGrant,
+	at time.Time,
+) bool {
+	before := *grant
+	if err := h.db.RevokePetAccessGrant(r.Context(), grant.ID, at); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			ErrorResponse(w, http.StatusConflict, "Pet access has already been revoked")
+			return false
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to revoke pet access")
+		return false
+	}
+	grant.RevokedAt = &at
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityPetAccess, grant.ID, before, grant)
+	return true
+}
+
+// ownerView is grant as owners see it: without its grantee's ID, so it does
+// not tell them whether the email they invited belongs to a client
+func ownerView(grant store.PetAccessGrant) store.PetAccessGrant {
+	grant.GranteeID = ""
+	return grant
+}
+
+// writePetAccessError maps store errors from granting pet access to
+// responses
+func writePetAccessError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidPetAccess):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrConflict):
+		ErrorResponse(w, http.StatusConflict, "Client already has access to this pet")
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, err.Error())
+	default:
+		ErrorResponse(w, http.StatusInternalServerError, fallback)
+	}
+}
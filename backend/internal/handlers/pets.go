@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
 	"pet-mgt/backend/internal/store"
 	"time"
 
@@ -51,17 +52,8 @@ func (h *PetHandler) CreatePet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization check: clients can only create pets for themselves, admins can create for anyone
-	if user.Role == "client" && req.OwnerID != user.Sub {
-		ErrorResponse(
-			w,
-			http.StatusForbidden,
-			"Clients can only create pets for themselves",
-		)
-		return
-	}
-
-	if user.Role == "veterinarian" {
-		ErrorResponse(w, http.StatusForbidden, "Veterinarians cannot create pets")
+	obj := policy.Object{Resource: policy.Pet, OwnerID: req.OwnerID}
+	if !authorize(w, r, h.db, user, policy.Create, obj) {
 		return
 	}
 
@@ -79,6 +71,7 @@ func (h *PetHandler) CreatePet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditCreate, store.EntityPet, pet.ID, nil, pet)
 	SuccessResponse(w, pet)
 }
 
@@ -103,11 +96,11 @@ func (h *PetHandler) GetPet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization check: clients can only access their own pets, vets and admins can access any
-	if user.Role == "client" && pet.OwnerID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	if !authorize(w, r, h.db, user, policy.Read, petObject(policy.Pet, pet)) {
 		return
 	}
 
+	setETag(w, pet.Version)
 	SuccessResponse(w, pet)
 }
 
@@ -132,8 +125,11 @@ func (h *PetHandler) UpdatePet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization: clients can update their own pets; veterinarians and admins can update any
-	if user.Role == "client" && pet.OwnerID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	if !authorize(w, r, h.db, user, policy.Update, petObject(policy.Pet, pet)) {
+		return
+	}
+
+	if !checkIfMatch(w, r, pet.Version) {
 		return
 	}
 
@@ -151,6 +147,7 @@ func (h *PetHandler) UpdatePet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update pet fields
+	before := *pet
 	pet.Name = req.Name
 	pet.Type = req.Type
 	pet.Breed = req.Breed
@@ -159,10 +156,12 @@ func (h *PetHandler) UpdatePet(w http.ResponseWriter, r *http.Request) {
 	pet.UpdatedAt = time.Now()
 
 	if err := h.db.UpdatePet(r.Context(), pet); err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to update pet")
+		updateErrorResponse(w, err, "Failed to update pet")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityPet, pet.ID, before, pet)
+	setETag(w, pet.Version)
 	SuccessResponse(w, pet)
 }
 
@@ -187,13 +186,7 @@ func (h *PetHandler) DeletePet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization check: clients can only delete their own pets, admins can delete any
-	if user.Role == "client" && pet.OwnerID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
-		return
-	}
-
-	if user.Role == "veterinarian" {
-		ErrorResponse(w, http.StatusForbidden, "Veterinarians cannot delete pets")
+	if !authorize(w, r, h.db, user, policy.Delete, petObject(policy.Pet, pet)) {
 		return
 	}
 
@@ -202,6 +195,7 @@ func (h *PetHandler) DeletePet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditDelete, store.EntityPet, pet.ID, pet, nil)
 	MessageResponse(w, http.StatusOK, "Pet deleted successfully")
 }
 
@@ -220,16 +214,28 @@ func (h *PetHandler) GetPetsByClient(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization check: clients can only access their own pets, vets and admins can access any
-	if user.Role == "client" && clientID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	obj := policy.Object{Resource: policy.Pet, OwnerID: clientID}
+	if !authorize(w, r, h.db, user, policy.List, obj) {
 		return
 	}
 
-	pets, err := h.db.GetPetsByUserID(r.Context(), clientID)
+	page, err := parsePage(r)
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve pets")
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	SuccessResponse(w, pets)
+	pets, next, err := h.db.GetPetsByUserID(r.Context(), clientID, page)
+	if err != nil {
+		listErrorResponse(w, err, "Failed to retrieve pets")
+		return
+	}
+
+	ListResponse(w, pets, next)
+}
+
+// petObject describes pet, or its records or QR code, to the policy as
+// resource: they all belong to the pet's owner
+func petObject(resource policy.Resource, pet *store.Pet) policy.Object {
+	return policy.Object{Resource: resource, OwnerID: pet.OwnerID, PetID: pet.ID}
 }
@@ -3,9 +3,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
 	"pet-mgt/backend/internal/store"
 	"strconv"
 
@@ -32,9 +34,14 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Only veterinarians and admins can create products
-	if user.Role != "veterinarian" && user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Only veterinarians can create products")
+	// Veterinarians sell their own products; admins add them for the
+	// veterinarian_id query parameter
+	veterinarianID := user.Sub
+	if r.URL.Query().Get("veterinarian_id") != "" {
+		veterinarianID = r.URL.Query().Get("veterinarian_id")
+	}
+	obj := policy.Object{Resource: policy.Product, VeterinarianID: veterinarianID}
+	if !authorize(w, r, h.db, user, policy.Create, obj) {
 		return
 	}
 
@@ -43,7 +50,7 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		Name                   string                  `json:"name"`
 		Description            string                  `json:"description"`
 		Category               string                  `json:"category"`
-		Price                  float64                 `json:"price"`
+		Price                  store.Money             `json:"price"`
 		StockQuantity          int                     `json:"stock_quantity"`
 		SKU                    string                  `json:"sku,omitempty"`
 		Brand                  string                  `json:"brand,omitempty"`
@@ -59,7 +66,7 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate required fields
-	if req.Name == "" || req.Category == "" || req.Price <= 0 {
+	if req.Name == "" || req.Category == "" || req.Price.Amount <= 0 {
 		ErrorResponse(
 			w,
 			http.StatusBadRequest,
@@ -67,13 +74,12 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-
-	// Create product
-	veterinarianID := user.Sub
-	if user.Role == "admin" && r.URL.Query().Get("veterinarian_id") != "" {
-		veterinarianID = r.URL.Query().Get("veterinarian_id")
+	if err := req.Price.Validate(); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Price currency must be a three-letter ISO 4217 code")
+		return
 	}
 
+	// Create product
 	// Ensure veterinarian exists to avoid FK violations
 	if _, err := h.db.GetVeterinarianByID(r.Context(), veterinarianID); err != nil {
 		ErrorResponse(
@@ -110,10 +116,11 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditCreate, store.EntityProduct, product.ID, nil, product)
 	SuccessResponse(w, product)
 }
 
-// GetProducts lists products with filtering
+// GetProducts lists products with filtering, search and sorting
 func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters for filtering
 	filters := store.ProductFilters{
@@ -121,43 +128,52 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 		Brand:          r.URL.Query().Get("brand"),
 		VeterinarianID: r.URL.Query().Get("veterinarian_id"),
 		Search:         r.URL.Query().Get("search"),
-		Limit:          10,
-		Offset:         0,
+		Sort:           r.URL.Query().Get("sort"),
+	}
+
+	if !store.IsValidProductSort(filters.Sort) {
+		ErrorResponse(w, http.StatusBadRequest, "sort must be one of newest, price_asc, price_desc, name")
+		return
 	}
 
 	// Parse numeric filters
 	if minPriceStr := r.URL.Query().Get("min_price"); minPriceStr != "" {
-		if price, err := strconv.ParseFloat(minPriceStr, 64); err == nil {
-			filters.MinPrice = price
+		price, err := store.ParseMoney(minPriceStr, store.DefaultCurrency)
+		if err != nil || price.Amount < 0 {
+			ErrorResponse(w, http.StatusBadRequest, "Invalid min_price")
+			return
 		}
+		filters.MinPrice = price
 	}
 
 	if maxPriceStr := r.URL.Query().Get("max_price"); maxPriceStr != "" {
-		if price, err := strconv.ParseFloat(maxPriceStr, 64); err == nil {
-			filters.MaxPrice = price
+		price, err := store.ParseMoney(maxPriceStr, store.DefaultCurrency)
+		if err != nil || price.Amount < 0 {
+			ErrorResponse(w, http.StatusBadRequest, "Invalid max_price")
+			return
 		}
+		filters.MaxPrice = price
 	}
 
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			filters.Limit = limit
-		}
+	if filters.MaxPrice.Amount > 0 && filters.MinPrice.Amount > filters.MaxPrice.Amount {
+		ErrorResponse(w, http.StatusBadRequest, "min_price cannot be greater than max_price")
+		return
 	}
 
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
-			filters.Offset = offset
-		}
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// Get products
-	products, err := h.db.ListProducts(r.Context(), filters)
+	result, err := h.db.ListProducts(r.Context(), filters, page)
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve products")
+		listErrorResponse(w, err, "Failed to retrieve products")
 		return
 	}
 
-	SuccessResponse(w, products)
+	CountedListResponse(w, result.Products, result.NextCursor, result.Total)
 }
 
 // GetProduct retrieves a specific product
@@ -175,6 +191,7 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, product.Version)
 	SuccessResponse(w, product)
 }
 
@@ -201,17 +218,21 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions - only product owner or admin can update
-	if user.Role != "admin" && product.VeterinarianID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "You can only update your own products")
+	if !authorize(w, r, h.db, user, policy.Update, productObject(product)) {
+		return
+	}
+
+	if !checkIfMatch(w, r, product.Version) {
 		return
 	}
+	before := *product
 
 	// Parse request body
 	var updateData struct {
 		Name                   string                   `json:"name,omitempty"`
 		Description            string                   `json:"description,omitempty"`
 		Category               string                   `json:"category,omitempty"`
-		Price                  *float64                 `json:"price,omitempty"`
+		Price                  *store.Money             `json:"price,omitempty"`
 		StockQuantity          *int                     `json:"stock_quantity,omitempty"`
 		SKU                    string                   `json:"sku,omitempty"`
 		Brand                  string                   `json:"brand,omitempty"`
@@ -238,14 +259,19 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		product.Category = updateData.Category
 	}
 	if updateData.Price != nil {
-		if *updateData.Price <= 0 {
+		if updateData.Price.Amount <= 0 {
 			ErrorResponse(w, http.StatusBadRequest, "Price must be greater than 0")
 			return
 		}
+		if err := updateData.Price.Validate(); err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "Price currency must be a three-letter ISO 4217 code")
+			return
+		}
 		product.Price = *updateData.Price
 	}
-	if updateData.StockQuantity != nil {
-		product.StockQuantity = *updateData.StockQuantity
+	if updateData.StockQuantity != nil && *updateData.StockQuantity < 0 {
+		ErrorResponse(w, http.StatusBadRequest, "Stock quantity cannot be negative")
+		return
 	}
 	if updateData.SKU != "" {
 		product.SKU = updateData.SKU
@@ -269,12 +295,23 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		product.Images = updateData.Images
 	}
 
-	// Update product
-	if err := h.db.UpdateProduct(r.Context(), product); err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to update product")
+	// Stock only changes through the ledger, so a new count is an adjustment
+	// the store works out and records along with the other fields
+	if updateData.StockQuantity != nil {
+		product.StockQuantity = *updateData.StockQuantity
+		adjustment := store.NewStockMovement(product.ID, store.StockAdjustment, 0, user.Sub)
+		adjustment.Reason = "Product update"
+		if err := h.db.UpdateProductWithStock(r.Context(), product, adjustment); err != nil {
+			updateErrorResponse(w, err, "Failed to update product")
+			return
+		}
+	} else if err := h.db.UpdateProduct(r.Context(), product); err != nil {
+		updateErrorResponse(w, err, "Failed to update product")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityProduct, product.ID, before, product)
+	setETag(w, product.Version)
 	SuccessResponse(w, product)
 }
 
@@ -301,18 +338,23 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions - only product owner or admin can delete
-	if user.Role != "admin" && product.VeterinarianID != user.Sub {
-		ErrorResponse(w, http.StatusForbidden, "You can only delete your own products")
+	if !authorize(w, r, h.db, user, policy.Delete, productObject(product)) {
 		return
 	}
 
 	// Deactivate product instead of hard delete
+	before := *product
 	product.IsActive = false
 	if err := h.db.UpdateProduct(r.Context(), product); err != nil {
+		if errors.Is(err, store.ErrVersionConflict) {
+			ErrorResponse(w, http.StatusConflict, "Product was modified, please retry")
+			return
+		}
 		ErrorResponse(w, http.StatusInternalServerError, "Failed to deactivate product")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityProduct, product.ID, before, product)
 	MessageResponse(w, http.StatusOK, "Product deactivated successfully")
 }
 
@@ -335,22 +377,30 @@ func (h *ProductHandler) GetVeterinarianProducts(
 	}
 
 	// Check permissions - veterinarians can only see their own products, others can see all
-	if user.Role == "veterinarian" && user.Sub != vetID {
-		ErrorResponse(w, http.StatusForbidden, "You can only view your own products")
+	obj := policy.Object{Resource: policy.Product, VeterinarianID: vetID}
+	if !authorize(w, r, h.db, user, policy.List, obj) {
+		return
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Get products
-	products, err := h.db.GetProductsByVeterinarianID(r.Context(), vetID)
+	products, next, err := h.db.GetProductsByVeterinarianID(r.Context(), vetID, page)
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve products")
+		listErrorResponse(w, err, "Failed to retrieve products")
 		return
 	}
 
-	SuccessResponse(w, products)
+	ListResponse(w, products, next)
 }
 
-// UpdateProductStock updates product stock quantity
+// UpdateProductStock records a stock movement for a product. The body gives
+// either a signed change with its type, or the quantity now in stock, which
+// is recorded as an adjustment.
 func (h *ProductHandler) UpdateProductStock(w http.ResponseWriter, r *http.Request) {
 	productID := chi.URLParam(r, "id")
 	if productID == "" {
@@ -373,18 +423,16 @@ func (h *ProductHandler) UpdateProductStock(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Check permissions - only product owner or admin can update stock
-	if user.Role != "admin" && product.VeterinarianID != user.Sub {
-		ErrorResponse(
-			w,
-			http.StatusForbidden,
-			"You can only update stock for your own products",
-		)
+	if !authorize(w, r, h.db, user, policy.Update, productObject(product)) {
 		return
 	}
 
 	// Parse request body
 	var req struct {
-		Quantity int `json:"quantity"`
+		Type     string `json:"type"`
+		Change   *int   `json:"change"`
+		Quantity *int   `json:"quantity"`
+		Reason   string `json:"reason"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -392,93 +440,117 @@ func (h *ProductHandler) UpdateProductStock(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if req.Quantity < 0 {
-		ErrorResponse(w, http.StatusBadRequest, "Stock quantity cannot be negative")
+	if req.Type == "" {
+		req.Type = store.StockAdjustment
+	}
+	// Sales and cancellation restocks are only recorded by orders
+	if req.Type != store.StockAdjustment && req.Type != store.StockReceived &&
+		req.Type != store.StockWriteOff {
+		ErrorResponse(w, http.StatusBadRequest, "Type must be adjustment, received or write_off")
 		return
 	}
 
-	// Update stock
-	if err := h.db.UpdateProductStock(r.Context(), productID, req.Quantity); err != nil {
+	var change int
+	switch {
+	case req.Change != nil && req.Quantity == nil:
+		change = *req.Change
+	case req.Quantity != nil && req.Change == nil && req.Type == store.StockAdjustment:
+		if *req.Quantity < 0 {
+			ErrorResponse(w, http.StatusBadRequest, "Stock quantity cannot be negative")
+			return
+		}
+		change = *req.Quantity - product.StockQuantity
+		if change == 0 {
+			MessageResponse(w, http.StatusOK, "Stock is already at the requested quantity")
+			return
+		}
+	default:
 		ErrorResponse(
 			w,
-			http.StatusInternalServerError,
-			"Failed to update product stock",
+			http.StatusBadRequest,
+			"Provide either a change, or the quantity in stock for an adjustment",
 		)
 		return
 	}
 
-	MessageResponse(w, http.StatusOK, "Stock updated successfully")
+	movement := store.NewStockMovement(productID, req.Type, change, user.Sub)
+	movement.Reason = req.Reason
+	if err := h.db.RecordStockMovement(r.Context(), movement); err != nil {
+		stockErrorResponse(w, err)
+		return
+	}
+
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityProduct, productID,
+		map[string]int{"stock_quantity": movement.BalanceAfter - movement.Quantity},
+		map[string]int{"stock_quantity": movement.BalanceAfter},
+	)
+	SuccessResponse(w, movement)
 }
 
-// CheckoutProducts decrements stock for arbitrary products.
-// Clients can reduce stock for items in their cart across different veterinarians.
-func (h *ProductHandler) CheckoutProducts(w http.ResponseWriter, r *http.Request) {
-	// Auth
-	user, ok := middleware.GetUserFromContext(r.Context())
-	if !ok {
-		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
-		return
+// stockErrorResponse maps store.RecordStockMovement failures onto HTTP responses
+func stockErrorResponse(w http.ResponseWriter, err error) {
+	var stockErr *store.InsufficientStockError
+	switch {
+	case errors.As(err, &stockErr):
+		ErrorResponse(
+			w,
+			http.StatusConflict,
+			"Insufficient stock: "+strconv.Itoa(stockErr.Available)+" available",
+		)
+	case errors.Is(err, store.ErrInvalidStockMovement):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, "Product not found")
+	default:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to update product stock")
 	}
-	if user.Role != "client" && user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Only clients can checkout")
+}
+
+// GetStockHistory lists a product's stock movements, newest first (product
+// owner or admin only)
+func (h *ProductHandler) GetStockHistory(w http.ResponseWriter, r *http.Request) {
+	productID := chi.URLParam(r, "id")
+	if productID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Product ID is required")
 		return
 	}
 
-	// Parse request
-	var req struct {
-		Items []struct {
-			ProductID string `json:"product_id"`
-			Quantity  int    `json:"quantity"`
-		} `json:"items"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+	// Get current user from context
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	if len(req.Items) == 0 {
-		ErrorResponse(w, http.StatusBadRequest, "No items provided")
+
+	product, err := h.db.GetProductByID(r.Context(), productID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Product not found")
 		return
 	}
 
-	// Aggregate by product id in case of duplicates
-	totals := map[string]int{}
-	for _, it := range req.Items {
-		if it.ProductID == "" || it.Quantity <= 0 {
-			ErrorResponse(w, http.StatusBadRequest, "Invalid item payload")
-			return
-		}
-		totals[it.ProductID] += it.Quantity
+	// Check permissions - only product owner or admin can see stock history
+	if !authorize(w, r, h.db, user, policy.History, productObject(product)) {
+		return
 	}
 
-	type updatedItem struct {
-		ProductID string `json:"product_id"`
-		NewStock  int    `json:"new_stock"`
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	updated := make([]updatedItem, 0, len(totals))
 
-	// Validate availability first
-	for pid, q := range totals {
-		p, err := h.db.GetProductByID(r.Context(), pid)
-		if err != nil {
-			ErrorResponse(w, http.StatusNotFound, "Product not found: "+pid)
-			return
-		}
-		if p.StockQuantity < q {
-			ErrorResponse(w, http.StatusBadRequest, "Insufficient stock for product: "+p.Name)
-			return
-		}
+	movements, next, err := h.db.ListStockMovements(r.Context(), productID, page)
+	if err != nil {
+		listErrorResponse(w, err, "Failed to retrieve stock history")
+		return
 	}
 
-	// Apply stock updates
-	for pid, q := range totals {
-		p, _ := h.db.GetProductByID(r.Context(), pid)
-		newQty := p.StockQuantity - q
-		if err := h.db.UpdateProductStock(r.Context(), pid, newQty); err != nil {
-			ErrorResponse(w, http.StatusInternalServerError, "Failed to update stock")
-			return
-		}
-		updated = append(updated, updatedItem{ProductID: pid, NewStock: newQty})
-	}
+	ListResponse(w, movements, next)
+}
 
-	SuccessResponse(w, map[string]any{"updated": updated})
+// productObject describes product to the policy: it is assigned to the
+// veterinarian selling it
+func productObject(product *store.Product) policy.Object {
+	return policy.Object{Resource: policy.Product, VeterinarianID: product.VeterinarianID}
 }
@@ -0,0 +1,294 @@
+// Package handlers contains promotion and discount code handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PromotionHandler handles the promotions veterinarians run on their
+// products and admins run shop-wide
+type PromotionHandler struct {
+	db store.Database
+}
+
+// NewPromotionHandler creates a new PromotionHandler
+func NewPromotionHandler(db store.Database) *PromotionHandler {
+	return &PromotionHandler{db: db}
+}
+
+// promotionRequest is the terms of a promotion as clients send them when
+// creating or replacing one
+type promotionRequest struct {
+	Name           string      `json:"name"`
+	Code           string      `json:"code,omitempty"`
+	Kind           string      `json:"kind"`
+	PercentBps     int         `json:"percent_bps,omitempty"`
+	Amount         store.Money `json:"amount"`
+	ProductIDs     []string    `json:"product_ids,omitempty"`
+	Categories     []string    `json:"categories,omitempty"`
+	MinSpend       store.Money `json:"min_spend"`
+	UsageLimit     int         `json:"usage_limit,omitempty"`
+	FirstOrderOnly bool        `json:"first_order_only"`
+	StartsAt       *time.Time  `json:"starts_at,omitempty"`
+	EndsAt         *time.Time  `json:"ends_at,omitempty"`
+	Active         *bool       `json:"active,omitempty"`
+}
+
+// apply copies the terms in req onto p. Leaving active out keeps p's.
+func (req promotionRequest) apply(p *store.Promotion) {
+	p.Name = req.Name
+	p.Code = store.NormalizePromotionCode(req.Code)
+	p.Kind = req.Kind
+	p.PercentBps = req.PercentBps
+	p.Amount = req.Amount
+	p.ProductIDs = []string{}
+	if req.ProductIDs != nil {
+		p.ProductIDs = req.ProductIDs
+	}
+	p.Categories = []string{}
+	if req.Categories != nil {
+		p.Categories = req.Categories
+	}
+	p.MinSpend = req.MinSpend
+	p.UsageLimit = req.UsageLimit
+	p.FirstOrderOnly = req.FirstOrderOnly
+	p.StartsAt = req.StartsAt
+	p.EndsAt = req.EndsAt
+	if req.Active != nil {
+		p.Active = *req.Active
+	}
+}
+
+// CreatePromotion creates a promotion. Veterinarians create their own;
+// admins create one for the veterinarian_id query parameter, or a shop-wide
+// one without it.
+func (h *PromotionHandler) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vetID := promotionVeterinarian(r, h.db, user)
+	obj := policy.Object{Resource: policy.Promotion, VeterinarianID: vetID}
+	if !authorize(w, r, h.db, user, policy.Create, obj) {
+		return
+	}
+
+	var req promotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	promotion := store.NewPromotion(vetID, req.Name, req.Kind)
+	req.apply(promotion)
+	if !h.checkProducts(w, r, promotion) {
+		return
+	}
+
+	if err := h.db.CreatePromotion(r.Context(), promotion); err != nil {
+		writePromotionError(w, err, "Failed to create promotion")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditCreate, store.EntityPromotion, promotion.ID, nil, promotion)
+	SuccessResponse(w, promotion)
+}
+
+// GetPromotions lists promotions. Veterinarians see their own; admins see
+// every promotion, or one veterinarian's with the veterinarian_id query
+// parameter.
+func (h *PromotionHandler) GetPromotions(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vetID := promotionVeterinarian(r, h.db, user)
+	obj := policy.Object{Resource: policy.Promotion, VeterinarianID: vetID}
+	if !authorize(w, r, h.db, user, policy.List, obj) {
+		return
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	promotions, next, err := h.db.ListPromotions(r.Context(), vetID, page)
+	if err != nil {
+		listErrorResponse(w, err, "Failed to retrieve promotions")
+		return
+	}
+
+	ListResponse(w, promotions, next)
+}
+
+// GetPromotion retrieves a specific promotion (its veterinarian or admin)
+func (h *PromotionHandler) GetPromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, ok := h.ownPromotion(w, r, policy.Read)
+	if !ok {
+		return
+	}
+	SuccessResponse(w, promotion)
+}
+
+// UpdatePromotion replaces the terms of a promotion. Its usage count, and the
+// discounts orders already got from it, stay as they are (its veterinarian or
+// admin).
+func (h *PromotionHandler) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, ok := h.ownPromotion(w, r, policy.Update)
+	if !ok {
+		return
+	}
+	before := *promotion
+
+	var req promotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.apply(promotion)
+	if !h.checkProducts(w, r, promotion) {
+		return
+	}
+
+	if err := h.db.UpdatePromotion(r.Context(), promotion); err != nil {
+		writePromotionError(w, err, "Failed to update promotion")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityPromotion, promotion.ID, before, promotion)
+	SuccessResponse(w, promotion)
+}
+
+// DeletePromotion removes a promotion. Orders keep the discounts it gave
+// (its veterinarian or admin).
+func (h *PromotionHandler) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, ok := h.ownPromotion(w, r, policy.Delete)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeletePromotion(r.Context(), promotion.ID); err != nil {
+		writePromotionError(w, err, "Failed to delete promotion")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditDelete, store.EntityPromotion, promotion.ID, promotion, nil)
+	MessageResponse(w, http.StatusOK, "Promotion deleted successfully")
+}
+
+// ownPromotion loads the promotion named in the URL and checks the current
+// user may take action on it, writing the error response if not. Shop-wide
+// promotions are for admins only.
+func (h *PromotionHandler) ownPromotion(
+	w http.ResponseWriter,
+	r *http.Request,
+	action policy.Action,
+) (*store.Promotion, bool) {
+	promotionID := chi.URLParam(r, "id")
+	if promotionID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Promotion ID is required")
+		return nil, false
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	promotion, err := h.db.GetPromotionByID(r.Context(), promotionID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Promotion not found")
+		return nil, false
+	}
+
+	obj := policy.Object{Resource: policy.Promotion, VeterinarianID: promotion.VeterinarianID}
+	if !authorize(w, r, h.db, user, action, obj) {
+		return nil, false
+	}
+
+	return promotion, true
+}
+
+// promotionVeterinarian is whose promotions a request is for: the
+// veterinarian_id query parameter, else the veterinarian making it. For
+// admins without it, that is the shop-wide ones.
+func promotionVeterinarian(r *http.Request, db store.Database, user *middleware.UserClaims) string {
+	if vetID := r.URL.Query().Get("veterinarian_id"); vetID != "" {
+		return vetID
+	}
+	if deriveRole(r.Context(), db, user) == policy.RoleVeterinarian {
+		return user.Sub
+	}
+	return ""
+}
+
+// checkProducts checks the products a promotion names exist and, for a
+// veterinarian's promotion, are theirs, writing the error response if not
+func (h *PromotionHandler) checkProducts(
+	w http.ResponseWriter,
+	r *http.Request,
+	promotion *store.Promotion,
+) bool {
+	for _, productID := range promotion.ProductIDs {
+		product, err := h.db.GetProductByID(r.Context(), productID)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, "Product not found: "+productID)
+			return false
+		}
+		if promotion.VeterinarianID != "" && product.VeterinarianID != promotion.VeterinarianID {
+			ErrorResponse(w, http.StatusBadRequest,
+				"Promotions can only cover the veterinarian's own products")
+			return false
+		}
+	}
+	return true
+}
+
+// checkDiscountCode reports why an order cannot use code, or "" when it can.
+// The code must exist, be live and, when vetID is given, be shop-wide or
+// vetID's. Whether the order meets its conditions is up to the store, which
+// leaves out a code whose conditions are not met.
+func checkDiscountCode(ctx context.Context, db store.Database, code, vetID string) string {
+	promotion, err := db.GetPromotionByCode(ctx, code)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return "Unknown discount code"
+	case err != nil:
+		return "Failed to check discount code"
+	case !promotion.Live(time.Now()):
+		return "Discount code is not active"
+	case vetID != "" && promotion.VeterinarianID != "" && promotion.VeterinarianID != vetID:
+		return "Discount code does not apply to this veterinarian"
+	}
+	return ""
+}
+
+// writePromotionError maps promotion store failures onto HTTP responses
+func writePromotionError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidPromotion):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrConflict):
+		ErrorResponse(w, http.StatusConflict, "Discount code is already in use")
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, err.Error())
+	default:
+		ErrorResponse(w, http.StatusInternalServerError, fallback)
+	}
+}
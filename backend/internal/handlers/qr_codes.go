@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
 	"pet-mgt/backend/internal/store"
 	"strings"
 
@@ -40,9 +41,6 @@ func (h *QRCodeHandler) GenerateQRCode(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	userID, role := user.Sub, user.Role
-	// Normalize to application role (client/veterinarian/admin)
-	role = deriveRole(r.Context(), h.db, user)
 
 	// Get pet details
 	pet, err := h.db.GetPetByID(r.Context(), petID)
@@ -52,8 +50,7 @@ func (h *QRCodeHandler) GenerateQRCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions - only pet owner or admin can generate QR codes
-	if role != "admin" && pet.OwnerID != userID {
-		ErrorResponse(w, http.StatusForbidden, "Forbidden: You can only generate QR codes for your own pets")
+	if !authorize(w, r, h.db, user, policy.Create, petObject(policy.QRCode, pet)) {
 		return
 	}
 
@@ -109,6 +106,10 @@ func (h *QRCodeHandler) GenerateQRCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The image is derived from the rest, so the audit log leaves it out
+	audited := *qrCode
+	audited.QRCodeData = ""
+	recordAudit(r, h.db, store.AuditCreate, store.EntityQRCode, qrCode.ID, nil, audited)
 	SuccessResponse(w, qrCode)
 }
 
@@ -126,8 +127,6 @@ func (h *QRCodeHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	userID, role := user.Sub, user.Role
-	role = deriveRole(r.Context(), h.db, user)
 
 	// Get pet details for permission check
 	pet, err := h.db.GetPetByID(r.Context(), petID)
@@ -137,8 +136,7 @@ func (h *QRCodeHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions
-	if role != "admin" && role != "veterinarian" && pet.OwnerID != userID {
-		ErrorResponse(w, http.StatusForbidden, "Forbidden: Insufficient permissions")
+	if !authorize(w, r, h.db, user, policy.Read, petObject(policy.QRCode, pet)) {
 		return
 	}
 
@@ -173,6 +171,8 @@ func (h *QRCodeHandler) GetPublicPetProfile(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// The profile carries the pet's medical history, so anonymous views are audited too
+	recordAudit(r, h.db, store.AuditRead, store.EntityQRCode, normalized, nil, nil)
 	SuccessResponse(w, profile)
 }
 
@@ -190,8 +190,6 @@ func (h *QRCodeHandler) UpdateQRCode(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	userID, role := user.Sub, user.Role
-	role = deriveRole(r.Context(), h.db, user)
 
 	// Get pet details for permission check
 	pet, err := h.db.GetPetByID(r.Context(), petID)
@@ -201,8 +199,7 @@ func (h *QRCodeHandler) UpdateQRCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions - only pet owner or admin can update QR codes
-	if role != "admin" && pet.OwnerID != userID {
-		ErrorResponse(w, http.StatusForbidden, "Forbidden: You can only update QR codes for your own pets")
+	if !authorize(w, r, h.db, user, policy.Update, petObject(policy.QRCode, pet)) {
 		return
 	}
 
@@ -226,6 +223,7 @@ func (h *QRCodeHandler) UpdateQRCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update encoded content
+	before := *qrCode
 	if updateData.EmergencyContact != "" {
 		qrCode.EncodedContent.EmergencyContact = updateData.EmergencyContact
 	}
@@ -242,6 +240,7 @@ func (h *QRCodeHandler) UpdateQRCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityQRCode, qrCode.ID, before, qrCode)
 	SuccessResponse(w, qrCode)
 }
 
@@ -259,8 +258,6 @@ func (h *QRCodeHandler) DeleteQRCode(w http.ResponseWriter, r *http.Request) {
 		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
-	userID, role := user.Sub, user.Role
-	role = deriveRole(r.Context(), h.db, user)
 
 	// Get pet details for permission check
 	pet, err := h.db.GetPetByID(r.Context(), petID)
@@ -270,8 +267,7 @@ func (h *QRCodeHandler) DeleteQRCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions - only pet owner or admin can delete QR codes
-	if role != "admin" && pet.OwnerID != userID {
-		ErrorResponse(w, http.StatusForbidden, "Forbidden: You can only delete QR codes for your own pets")
+	if !authorize(w, r, h.db, user, policy.Delete, petObject(policy.QRCode, pet)) {
 		return
 	}
 
@@ -283,12 +279,14 @@ func (h *QRCodeHandler) DeleteQRCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Deactivate instead of hard delete
+	before := *qrCode
 	qrCode.IsActive = false
 	if err := h.db.UpdateQRCode(r.Context(), qrCode); err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "Failed to deactivate QR code")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditDelete, store.EntityQRCode, qrCode.ID, before, qrCode)
 	MessageResponse(w, http.StatusOK, "QR code deactivated successfully")
 }
 
@@ -0,0 +1,261 @@
+// Package handlers contains the record consent handlers owners control veterinarians' access with
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RecordConsentHandler handles the consents that let veterinarians see a
+// pet's medical records, and the trail of access owners follow them with
+type RecordConsentHandler struct {
+	db store.Database
+}
+
+// NewRecordConsentHandler creates a new RecordConsentHandler
+func NewRecordConsentHandler(db store.Database) *RecordConsentHandler {
+	return &RecordConsentHandler{db: db}
+}
+
+// GrantRecordAccess lets a veterinarian see a pet's medical records without
+// an appointment, until expires_at when given (pet's owner or admin)
+func (h *RecordConsentHandler) GrantRecordAccess(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.Create, petObject(policy.RecordConsent, pet)) {
+		return
+	}
+
+	var req struct {
+		VeterinarianID string     `json:"veterinarian_id"`
+		ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.VeterinarianID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Missing required field (veterinarian_id)")
+		return
+	}
+	if _, err := h.db.GetVeterinarianByID(r.Context(), req.VeterinarianID); err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Veterinarian not found")
+		return
+	}
+
+	consents, err := h.db.GetPetRecordConsents(r.Context(), pet.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve record consents")
+		return
+	}
+	for _, c := range consents {
+		if c.VeterinarianID == req.VeterinarianID && c.Kind == store.ConsentOwnerGrant &&
+			c.Active(time.Now()) {
+			ErrorResponse(w, http.StatusConflict, "Veterinarian already has access to this pet's records")
+			return
+		}
+	}
+
+	consent := store.NewRecordConsent(pet.ID, pet.OwnerID, req.VeterinarianID, req.ExpiresAt, user.Sub)
+	if err := h.db.CreateRecordConsent(r.Context(), consent); err != nil {
+		writeConsentError(w, err, "Failed to grant record access")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditCreate, store.EntityRecordAccess, pet.ID, nil, consent)
+	SuccessResponse(w, consent)
+}
+
+// BreakGlass gives the current veterinarian emergency access to a pet's
+// medical records for store.BreakGlassDuration. The justification is
+// required and shown to the owner. Veterinarians who already have access are
+// refused, so break-glass access always marks an emergency.
+func (h *RecordConsentHandler) BreakGlass(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.BreakGlass, petObject(policy.RecordConsent, pet)) {
+		return
+	}
+
+	var req struct {
+		Justification string `json:"justification"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Justification) == "" {
+		ErrorResponse(w, http.StatusBadRequest, "A justification is required for break-glass access")
+		return
+	}
+	if consented(r.Context(), h.db, user.Sub, pet.ID) {
+		ErrorResponse(w, http.StatusConflict, "You already have access to this pet's records")
+		return
+	}
+
+	consent := store.NewBreakGlassAccess(pet.ID, pet.OwnerID, user.Sub, req.Justification)
+	if err := h.db.CreateRecordConsent(r.Context(), consent); err != nil {
+		writeConsentError(w, err, "Failed to record break-glass access")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditCreate, store.EntityRecordAccess, pet.ID, nil, consent)
+	SuccessResponse(w, consent)
+}
+
+// GetRecordConsents lists the grants and break-glass access on a pet's
+// records, revoked and expired ones included (pet's owner or admin)
+func (h *RecordConsentHandler) GetRecordConsents(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.List, petObject(policy.RecordConsent, pet)) {
+		return
+	}
+
+	consents, err := h.db.GetPetRecordConsents(r.Context(), pet.ID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve record consents")
+		return
+	}
+	SuccessResponse(w, consents)
+}
+
+// RevokeRecordAccess ends a grant or break-glass access on a pet's records
+// (pet's owner or admin)
+func (h *RecordConsentHandler) RevokeRecordAccess(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.Delete, petObject(policy.RecordConsent, pet)) {
+		return
+	}
+	consent, err := h.db.GetRecordConsentByID(r.Context(), chi.URLParam(r, "consentId"))
+	if err != nil || consent.PetID != pet.ID {
+		ErrorResponse(w, http.StatusNotFound, "Record consent not found")
+		return
+	}
+
+	before := *consent
+	now := time.Now()
+	if err := h.db.RevokeRecordConsent(r.Context(), consent.ID, now); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			ErrorResponse(w, http.StatusConflict, "Record access has already been revoked")
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to revoke record access")
+		return
+	}
+	consent.RevokedAt = &now
+
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityRecordAccess, pet.ID, before, consent)
+	SuccessResponse(w, consent)
+}
+
+// GetRecordAccessLog lists, newest first, who was given, took or used access
+// to a pet's medical records (pet's owner or admin)
+func (h *RecordConsentHandler) GetRecordAccessLog(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	pet, ok := h.pet(w, r)
+	if !ok {
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.List, petObject(policy.RecordConsent, pet)) {
+		return
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := store.AuditFilter{Entity: store.EntityRecordAccess, EntityID: pet.ID}
+	entries, next, err := h.db.ListAuditEntries(r.Context(), filter, page)
+	if err != nil {
+		listErrorResponse(w, err, "Failed to retrieve record access log")
+		return
+	}
+	ListResponse(w, entries, next)
+}
+
+// pet loads the pet named in the URL, writing the error response if it
+// does not exist
+func (h *RecordConsentHandler) pet(w http.ResponseWriter, r *http.Request) (*store.Pet, bool) {
+	petID := chi.URLParam(r, "petId")
+	if petID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Pet ID is required")
+		return nil, false
+	}
+	pet, err := h.db.GetPetByID(r.Context(), petID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Pet not found")
+		return nil, false
+	}
+	return pet, true
+}
+
+// auditRecordAccess adds a read of pet's records by anyone but its owner to
+// the trail the owner sees
+func auditRecordAccess(r *http.Request, db store.Database, pet *store.Pet) {
+	if user, ok := middleware.GetUserFromContext(r.Context()); ok && user.Sub != pet.OwnerID {
+		recordAudit(r, db, store.AuditRead, store.EntityRecordAccess, pet.ID, nil, nil)
+	}
+}
+
+// writeConsentError maps store errors from creating record consents to
+// responses
+func writeConsentError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, store.ErrInvalidConsent):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, err.Error())
+	default:
+		ErrorResponse(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,246 @@
+// Package handlers contains checkout reservation handlers
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ReservationHandler handles checkout reservations
+type ReservationHandler struct {
+	db  store.Database
+	ttl time.Duration
+}
+
+// NewReservationHandler creates a new ReservationHandler whose reservations
+// hold stock for ttl
+func NewReservationHandler(db store.Database, ttl time.Duration) *ReservationHandler {
+	return &ReservationHandler{db: db, ttl: ttl}
+}
+
+// CreateReservation holds stock for the items in a client's cart until the
+// reservation is confirmed, released or expires (clients only).
+// Items can come from different veterinarians; confirming places one order
+// for each.
+func (h *ReservationHandler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	// Auth
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Clients check out for themselves; admins for the client_id query parameter
+	clientID := user.Sub
+	if r.URL.Query().Get("client_id") != "" {
+		clientID = r.URL.Query().Get("client_id")
+	}
+	obj := policy.Object{Resource: policy.Reservation, OwnerID: clientID}
+	if !authorize(w, r, h.db, user, policy.Create, obj) {
+		return
+	}
+
+	// Parse request
+	var req struct {
+		Items []store.ReservationItem `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Items) == 0 {
+		ErrorResponse(w, http.StatusBadRequest, "No items provided")
+		return
+	}
+
+	productNames := make(map[string]string)
+	for _, it := range req.Items {
+		if it.ProductID == "" || it.Quantity <= 0 {
+			ErrorResponse(w, http.StatusBadRequest, "Invalid item payload")
+			return
+		}
+		if _, seen := productNames[it.ProductID]; seen {
+			continue
+		}
+		product, err := h.db.GetProductByID(r.Context(), it.ProductID)
+		if err != nil {
+			ErrorResponse(w, http.StatusNotFound, "Product not found: "+it.ProductID)
+			return
+		}
+		productNames[product.ID] = product.Name
+	}
+
+	reservation := store.NewReservation(clientID, req.Items, h.ttl)
+	if err := h.db.CreateReservation(r.Context(), reservation); err != nil {
+		writeReservationError(w, err, productNames, "Failed to reserve stock")
+		return
+	}
+
+	recordAudit(
+		r, h.db, store.AuditCreate, store.EntityReservation, reservation.ID,
+		nil, reservation,
+	)
+	SuccessResponse(w, reservation)
+}
+
+// GetReservation retrieves a reservation (owner or admin)
+func (h *ReservationHandler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := h.ownReservation(w, r, policy.Read)
+	if !ok {
+		return
+	}
+
+	SuccessResponse(w, reservation)
+}
+
+// ReleaseReservation gives the stock a reservation holds back before it
+// expires (owner or admin)
+func (h *ReservationHandler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := h.ownReservation(w, r, policy.Cancel)
+	if !ok {
+		return
+	}
+
+	if err := h.db.ReleaseReservation(r.Context(), reservation.ID); err != nil {
+		writeReservationError(w, err, nil, "Failed to release reservation")
+		return
+	}
+
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityReservation, reservation.ID,
+		map[string]string{"status": reservation.Status},
+		map[string]string{"status": store.ReservationReleased},
+	)
+	MessageResponse(w, http.StatusOK, "Reservation released")
+}
+
+// ConfirmReservation converts a reservation into one order per veterinarian
+// for its items, all placed or none, and returns them as a checkout with the
+// combined total (owner or admin)
+func (h *ReservationHandler) ConfirmReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := h.ownReservation(w, r, policy.Update)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PaymentMethod   string `json:"payment_method,omitempty"`
+		ShippingAddress string `json:"shipping_address,omitempty"`
+		DeliveryMethod  string `json:"delivery_method,omitempty"`
+		Notes           string `json:"notes,omitempty"`
+		DiscountCode    string `json:"discount_code,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.DiscountCode != "" {
+		if msg := checkDiscountCode(r.Context(), h.db, req.DiscountCode, ""); msg != "" {
+			ErrorResponse(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	productNames := make(map[string]string)
+	for _, it := range reservation.Items {
+		product, err := h.db.GetProductByID(r.Context(), it.ProductID)
+		if err != nil {
+			ErrorResponse(w, http.StatusNotFound, "Product not found: "+it.ProductID)
+			return
+		}
+		productNames[product.ID] = product.Name
+	}
+
+	// Every veterinarian's order copies these details
+	template := store.NewOrder(reservation.ClientID, "", store.Money{})
+	if req.PaymentMethod != "" {
+		template.PaymentMethod = req.PaymentMethod
+	}
+	if req.ShippingAddress != "" {
+		template.ShippingAddress = req.ShippingAddress
+	}
+	if req.DeliveryMethod != "" {
+		template.DeliveryMethod = req.DeliveryMethod
+	}
+	if req.Notes != "" {
+		template.Notes = req.Notes
+	}
+	template.DiscountCode = store.NormalizePromotionCode(req.DiscountCode)
+
+	checkout, err := h.db.ConfirmReservation(r.Context(), reservation.ID, template)
+	if err != nil {
+		writeReservationError(w, err, productNames, "Failed to create order")
+		return
+	}
+
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityReservation, reservation.ID,
+		map[string]string{"status": reservation.Status},
+		map[string]string{"status": store.ReservationConverted, "checkout_id": checkout.ID},
+	)
+	for _, o := range checkout.Orders {
+		recordAudit(r, h.db, store.AuditCreate, store.EntityOrder, o.ID, nil, o.Order)
+	}
+
+	SuccessResponse(w, checkout)
+}
+
+// ownReservation loads the reservation named in the URL and checks the
+// current user may take action on it, writing the error response if not
+func (h *ReservationHandler) ownReservation(
+	w http.ResponseWriter,
+	r *http.Request,
+	action policy.Action,
+) (*store.Reservation, bool) {
+	reservationID := chi.URLParam(r, "id")
+	if reservationID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Reservation ID is required")
+		return nil, false
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	reservation, err := h.db.GetReservationByID(r.Context(), reservationID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Reservation not found")
+		return nil, false
+	}
+
+	obj := policy.Object{Resource: policy.Reservation, OwnerID: reservation.ClientID}
+	if !authorize(w, r, h.db, user, action, obj) {
+		return nil, false
+	}
+
+	return reservation, true
+}
+
+// writeReservationError maps reservation failures onto HTTP responses
+func writeReservationError(
+	w http.ResponseWriter,
+	err error,
+	productNames map[string]string,
+	fallback string,
+) {
+	var stockErr *store.InsufficientStockError
+	switch {
+	case errors.Is(err, store.ErrReservationClosed):
+		ErrorResponse(w, http.StatusConflict, "Reservation is no longer active")
+	case errors.As(err, &stockErr), errors.Is(err, store.ErrInvalidOrder),
+		errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrPromotionUnavailable):
+		writePlaceOrderError(w, err, productNames)
+	default:
+		ErrorResponse(w, http.StatusInternalServerError, fallback)
+	}
+}
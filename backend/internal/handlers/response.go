@@ -26,6 +26,33 @@ func SuccessResponse(w http.ResponseWriter, data any) {
 	})
 }
 
+// ListResponse sends a success response for one page of a list. data stays
+// the array of items so existing clients keep working; next_cursor is null on
+// the last page.
+func ListResponse(w http.ResponseWriter, data any, nextCursor string) {
+	JSONResponse(w, http.StatusOK, listBody(data, nextCursor))
+}
+
+// CountedListResponse is ListResponse plus the number of matches across all pages
+func CountedListResponse(w http.ResponseWriter, data any, nextCursor string, total int) {
+	body := listBody(data, nextCursor)
+	body["total"] = total
+	JSONResponse(w, http.StatusOK, body)
+}
+
+// listBody builds the envelope shared by list responses
+func listBody(data any, nextCursor string) map[string]any {
+	var next any
+	if nextCursor != "" {
+		next = nextCursor
+	}
+	return map[string]any{
+		"success":     true,
+		"data":        data,
+		"next_cursor": next,
+	}
+}
+
 // MessageResponse sends a simple message response
 func MessageResponse(w http.ResponseWriter, status int, message string) {
 	JSONResponse(w, status, map[string]string{"message": message})
@@ -0,0 +1,357 @@
+// Package handlers contains return (RMA) handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/payments"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// errNothingToRefund is returned when an approved return's order has no
+// captured gateway payment to refund it from
+var errNothingToRefund = errors.New("order has no captured payment to refund")
+
+// ReturnHandler handles return requests for delivered orders and refunds
+// approved ones through the payment gateway
+type ReturnHandler struct {
+	db      store.Database
+	gateway payments.Gateway
+}
+
+// NewReturnHandler creates a new ReturnHandler that refunds through gateway
+func NewReturnHandler(db store.Database, gateway payments.Gateway) *ReturnHandler {
+	return &ReturnHandler{db: db, gateway: gateway}
+}
+
+// CreateReturn requests a return of some of a delivered order's items
+// (order's client or admin)
+func (h *ReturnHandler) CreateReturn(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "id")
+	if orderID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Order ID is required")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	order, err := h.db.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.Create, orderObject(policy.Return, order)) {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+		Items  []struct {
+			OrderItemID string `json:"order_item_id"`
+			Quantity    int    `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Reason == "" || len(req.Items) == 0 {
+		ErrorResponse(w, http.StatusBadRequest, "Reason and at least one item are required")
+		return
+	}
+
+	items := make([]store.ReturnItem, 0, len(req.Items))
+	for _, it := range req.Items {
+		items = append(items, store.NewReturnItem(it.OrderItemID, it.Quantity))
+	}
+	ret := store.NewReturn(order.ID, order.ClientID, req.Reason, items)
+	if err := h.db.CreateReturn(r.Context(), ret); err != nil {
+		if errors.Is(err, store.ErrInvalidReturn) {
+			ErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to create return")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditCreate, store.EntityReturn, ret.ID, nil, ret)
+	SuccessResponse(w, ret)
+}
+
+// GetOrderReturns lists an order's returns, oldest first (order's client,
+// order's veterinarian or admin)
+func (h *ReturnHandler) GetOrderReturns(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "id")
+	if orderID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Order ID is required")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	order, err := h.db.GetOrderByID(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !authorize(w, r, h.db, user, policy.List, orderObject(policy.Return, order)) {
+		return
+	}
+
+	returns, err := h.db.GetOrderReturns(r.Context(), orderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve returns")
+		return
+	}
+	SuccessResponse(w, returns)
+}
+
+// GetReturn retrieves a return (order's client, order's veterinarian or admin)
+func (h *ReturnHandler) GetReturn(w http.ResponseWriter, r *http.Request) {
+	ret, ok := h.orderReturn(w, r, policy.Read)
+	if !ok {
+		return
+	}
+	SuccessResponse(w, ret)
+}
+
+// ApproveReturn approves a requested return, restocking or writing off each
+// item as chosen, and refunds it from the order's payment (order's
+// veterinarian or admin)
+func (h *ReturnHandler) ApproveReturn(w http.ResponseWriter, r *http.Request) {
+	ret, ok := h.orderReturn(w, r, policy.Review)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Note  string `json:"note,omitempty"`
+		Items []struct {
+			ID          string `json:"id"`
+			Disposition string `json:"disposition"`
+		} `json:"items,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	dispositions := make(map[string]string, len(req.Items))
+	for _, it := range req.Items {
+		dispositions[it.ID] = it.Disposition
+	}
+
+	approved, ok := h.review(w, r, ret, store.ReturnApproved, req.Note, dispositions)
+	if !ok {
+		return
+	}
+
+	refunded, err := h.refund(r.Context(), approved)
+	switch {
+	case errors.Is(err, errNothingToRefund):
+		// Paid outside the gateway, so the refund is settled by hand
+		SuccessResponse(w, approved)
+	case err != nil:
+		log.Printf("returns: refund of approved return %s failed: %v", approved.ID, err)
+		writeRefundError(w, err)
+	default:
+		h.auditRefund(r, approved, refunded)
+		creditReturn(r, h.db, refunded)
+		SuccessResponse(w, refunded)
+	}
+}
+
+// RejectReturn rejects a requested return (order's veterinarian or admin)
+func (h *ReturnHandler) RejectReturn(w http.ResponseWriter, r *http.Request) {
+	ret, ok := h.orderReturn(w, r, policy.Review)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Note string `json:"note,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rejected, ok := h.review(w, r, ret, store.ReturnRejected, req.Note, nil)
+	if !ok {
+		return
+	}
+	SuccessResponse(w, rejected)
+}
+
+// RefundReturn refunds an approved return whose refund has not gone through
+// yet from the order's payment (order's veterinarian or admin)
+func (h *ReturnHandler) RefundReturn(w http.ResponseWriter, r *http.Request) {
+	ret, ok := h.orderReturn(w, r, policy.Refund)
+	if !ok {
+		return
+	}
+	if ret.Status != store.ReturnApproved {
+		ErrorResponse(
+			w,
+			http.StatusConflict,
+			"Only approved returns can be refunded, this one is "+ret.Status,
+		)
+		return
+	}
+
+	refunded, err := h.refund(r.Context(), ret)
+	if err != nil {
+		writeRefundError(w, err)
+		return
+	}
+	h.auditRefund(r, ret, refunded)
+	creditReturn(r, h.db, refunded)
+	SuccessResponse(w, refunded)
+}
+
+// orderReturn loads the return named in the URL and checks the current user
+// may take action on it, writing the error response if not
+func (h *ReturnHandler) orderReturn(
+	w http.ResponseWriter,
+	r *http.Request,
+	action policy.Action,
+) (*store.Return, bool) {
+	returnID := chi.URLParam(r, "id")
+	if returnID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Return ID is required")
+		return nil, false
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	ret, err := h.db.GetReturnByID(r.Context(), returnID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Return not found")
+		return nil, false
+	}
+	order, err := h.db.GetOrderByID(r.Context(), ret.OrderID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "Order not found")
+		return nil, false
+	}
+
+	if !authorize(w, r, h.db, user, action, orderObject(policy.Return, order)) {
+		return nil, false
+	}
+
+	return ret, true
+}
+
+// review approves or rejects ret, writing the error response and returning
+// false if it cannot be reviewed
+func (h *ReturnHandler) review(
+	w http.ResponseWriter,
+	r *http.Request,
+	ret *store.Return,
+	status string,
+	note string,
+	dispositions map[string]string,
+) (*store.Return, bool) {
+	user, _ := middleware.GetUserFromContext(r.Context())
+	reviewed, err := h.db.ReviewReturn(r.Context(), &store.ReturnReview{
+		ReturnID:     ret.ID,
+		Status:       status,
+		ReviewerID:   user.Sub,
+		Note:         note,
+		Dispositions: dispositions,
+	})
+	switch {
+	case errors.Is(err, store.ErrReturnTransition):
+		ErrorResponse(w, http.StatusConflict, "Return has already been reviewed")
+		return nil, false
+	case errors.Is(err, store.ErrInvalidReturn):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	case err != nil:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to review return")
+		return nil, false
+	}
+
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityReturn, ret.ID,
+		map[string]string{"status": ret.Status},
+		map[string]string{"status": reviewed.Status},
+	)
+	return reviewed, true
+}
+
+// refund returns an approved return's refund amount to the client from the
+// latest captured payment of its order, records the refund on the payment and
+// marks the return refunded
+func (h *ReturnHandler) refund(ctx context.Context, ret *store.Return) (*store.Return, error) {
+	if ret.RefundAmount.IsZero() {
+		return h.db.MarkReturnRefunded(ctx, ret.ID, "")
+	}
+
+	attempts, err := h.db.GetOrderPayments(ctx, ret.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	var payment *store.Payment
+	for i := range attempts {
+		if store.IsRefundable(attempts[i].Status) && attempts[i].Provider == h.gateway.Name() {
+			payment = &attempts[i]
+		}
+	}
+	if payment == nil {
+		return nil, errNothingToRefund
+	}
+
+	intent, err := h.gateway.Refund(ctx, payment.IntentID, ret.RefundAmount)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := recordIntent(ctx, h.db, payment, intent); err != nil {
+		return nil, err
+	}
+	return h.db.MarkReturnRefunded(ctx, ret.ID, payment.ID)
+}
+
+// auditRefund records that ret was refunded
+func (h *ReturnHandler) auditRefund(r *http.Request, ret, refunded *store.Return) {
+	recordAudit(
+		r, h.db, store.AuditUpdate, store.EntityReturn, ret.ID,
+		map[string]string{"status": ret.Status},
+		map[string]string{"status": refunded.Status, "payment_id": refunded.PaymentID},
+	)
+}
+
+// writeRefundError maps failures to refund a return onto HTTP responses
+func writeRefundError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNothingToRefund):
+		ErrorResponse(w, http.StatusConflict, "Order has no captured payment to refund")
+	case errors.Is(err, store.ErrReturnTransition):
+		ErrorResponse(w, http.StatusConflict, "Return has already been refunded")
+	case errors.Is(err, payments.ErrRefundAmount), errors.Is(err, payments.ErrIntentState):
+		ErrorResponse(w, http.StatusConflict, "Payment has too little left to refund this return")
+	case errors.Is(err, payments.ErrIntentNotFound):
+		ErrorResponse(w, http.StatusNotFound, "Payment not found at the gateway")
+	default:
+		ErrorResponse(w, http.StatusBadGateway, "Failed to refund the return")
+	}
+}
@@ -0,0 +1,111 @@
+// Package handlers contains tax settings handlers
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TaxHandler handles the tax settings of veterinarians' clinics
+type TaxHandler struct {
+	db store.Database
+}
+
+// NewTaxHandler creates a new TaxHandler
+func NewTaxHandler(db store.Database) *TaxHandler {
+	return &TaxHandler{db: db}
+}
+
+// GetTaxSettings returns the taxes a veterinarian's clinic charges, so
+// clients can see them before ordering (any authenticated user)
+func (h *TaxHandler) GetTaxSettings(w http.ResponseWriter, r *http.Request) {
+	vetID := chi.URLParam(r, "id")
+	if vetID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Veterinarian ID is required")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	obj := policy.Object{Resource: policy.TaxSettings, VeterinarianID: vetID}
+	if !authorize(w, r, h.db, user, policy.Read, obj) {
+		return
+	}
+
+	settings, err := h.db.GetTaxSettings(r.Context(), vetID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, "Veterinarian not found")
+		return
+	case err != nil:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve tax settings")
+		return
+	}
+	SuccessResponse(w, settings)
+}
+
+// SetTaxSettings replaces the taxes a veterinarian's clinic charges. Orders
+// placed before keep the tax they were charged (the veterinarian or admin).
+func (h *TaxHandler) SetTaxSettings(w http.ResponseWriter, r *http.Request) {
+	vetID := chi.URLParam(r, "id")
+	if vetID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "Veterinarian ID is required")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	obj := policy.Object{Resource: policy.TaxSettings, VeterinarianID: vetID}
+	if !authorize(w, r, h.db, user, policy.Update, obj) {
+		return
+	}
+
+	var req struct {
+		Inclusive bool            `json:"inclusive"`
+		Rates     []store.TaxRate `json:"rates"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	before, err := h.db.GetTaxSettings(r.Context(), vetID)
+	if errors.Is(err, store.ErrNotFound) {
+		ErrorResponse(w, http.StatusNotFound, "Veterinarian not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve tax settings")
+		return
+	}
+
+	settings := store.NewTaxSettings(vetID, req.Inclusive, req.Rates)
+	err = h.db.SetTaxSettings(r.Context(), settings)
+	switch {
+	case errors.Is(err, store.ErrInvalidTaxSettings):
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusNotFound, "Veterinarian not found")
+		return
+	case err != nil:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to update tax settings")
+		return
+	}
+
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityTaxSettings, vetID, before, settings)
+	SuccessResponse(w, settings)
+}
@@ -0,0 +1,95 @@
+// Package handlers/trash.go contains the admin trash HTTP handlers
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
+	"pet-mgt/backend/internal/store"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TrashHandler handles listing and restoring soft-deleted rows
+type TrashHandler struct {
+	db store.Database
+}
+
+// NewTrashHandler creates a new TrashHandler with database dependency
+func NewTrashHandler(db store.Database) *TrashHandler {
+	return &TrashHandler{
+		db: db,
+	}
+}
+
+// ListTrash lists deleted rows, most recently deleted first. The entity query
+// parameter narrows the list to users, pets, medical records or products.
+func (h *TrashHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "User not found in context")
+		return
+	}
+
+	// Only admins can see the trash
+	if !authorize(w, r, h.db, user, policy.List, policy.Object{Resource: policy.Trash}) {
+		return
+	}
+
+	entity := r.URL.Query().Get("entity")
+	if entity != "" && !slices.Contains(store.TrashEntities, entity) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid entity")
+		return
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, next, err := h.db.ListTrash(r.Context(), entity, page)
+	if err != nil {
+		listErrorResponse(w, err, "Failed to list trash")
+		return
+	}
+
+	ListResponse(w, items, next)
+}
+
+// Restore returns a handler that restores a deleted entity row named by the
+// id URL parameter, together with the rows that were deleted along with it
+func (h *TrashHandler) Restore(entity string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := middleware.GetUserFromContext(r.Context())
+		if !ok {
+			ErrorResponse(w, http.StatusUnauthorized, "User not found in context")
+			return
+		}
+
+		// Only admins can restore from the trash
+		if !authorize(w, r, h.db, user, policy.Restore, policy.Object{Resource: policy.Trash}) {
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		if id == "" {
+			ErrorResponse(w, http.StatusBadRequest, "ID is required")
+			return
+		}
+
+		if err := h.db.RestoreDeleted(r.Context(), entity, id); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				ErrorResponse(w, http.StatusNotFound, "Deleted item not found")
+				return
+			}
+			ErrorResponse(w, http.StatusInternalServerError, "Failed to restore item")
+			return
+		}
+
+		recordAudit(r, h.db, store.AuditRestore, entity, id, nil, nil)
+		MessageResponse(w, http.StatusOK, "Item restored successfully")
+	}
+}
@@ -3,10 +3,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/policy"
 	"pet-mgt/backend/internal/store"
-	"strconv"
+	"slices"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -68,8 +73,8 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	// If user already has a profile, they can't create another one (unless they're admin)
 	if (clientErr == nil && existingClient != nil) || (vetErr == nil && existingVet != nil) {
-		if user.Role != "admin" {
-			ErrorResponse(w, http.StatusForbidden, "User already has a profile")
+		obj := policy.Object{Resource: policy.User, OwnerID: user.Sub}
+		if !authorize(w, r, h.db, user, policy.Create, obj) {
 			return
 		}
 	}
@@ -88,6 +93,8 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 			ErrorResponse(w, http.StatusInternalServerError, "Failed to create client")
 			return
 		}
+		recordAudit(r, h.db, store.AuditCreate, store.EntityUser, client.ID, nil, client)
+		h.claimInvitations(r, user, client)
 		SuccessResponse(w, client)
 
 	case "veterinarian":
@@ -107,6 +114,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 			)
 			return
 		}
+		recordAudit(r, h.db, store.AuditCreate, store.EntityUser, vet.ID, nil, vet)
 		SuccessResponse(w, vet)
 
 	default:
@@ -114,6 +122,23 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// claimInvitations gives client the pet access invitations sent to their
+// email. Only the email of the token counts, since the profile's email is
+// whatever the request said, and a profile claiming a different one claims
+// nothing.
+func (h *UserHandler) claimInvitations(
+	r *http.Request,
+	user *middleware.UserClaims,
+	client *store.Client,
+) {
+	if user.Email == "" || !strings.EqualFold(strings.TrimSpace(client.Email), user.Email) {
+		return
+	}
+	if err := h.db.ClaimPetAccessInvitations(r.Context(), client.ID, user.Email); err != nil {
+		log.Printf("users: claiming pet access invitations for %s: %v", client.ID, err)
+	}
+}
+
 // GetUser retrieves a user by ID
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r.Context())
@@ -129,8 +154,8 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization check: users can only access their own data unless they're admin
-	if user.Sub != userID && user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	obj := policy.Object{Resource: policy.User, OwnerID: userID}
+	if !authorize(w, r, h.db, user, policy.Read, obj) {
 		return
 	}
 
@@ -146,6 +171,12 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Admins without a profile only have their account
+	if account, err := h.db.GetUserByID(r.Context(), userID); err == nil {
+		SuccessResponse(w, account)
+		return
+	}
+
 	ErrorResponse(w, http.StatusNotFound, "User not found")
 }
 
@@ -164,8 +195,8 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authorization check: users can only update their own data unless they're admin
-	if user.Sub != userID && user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	obj := policy.Object{Resource: policy.User, OwnerID: userID}
+	if !authorize(w, r, h.db, user, policy.Update, obj) {
 		return
 	}
 
@@ -184,6 +215,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Try to update as client first
 	if client, err := h.db.GetClientByID(r.Context(), userID); err == nil {
+		before := *client
 		client.Name = req.Name
 		client.Email = req.Email
 		client.Phone = req.Phone
@@ -193,12 +225,14 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 			ErrorResponse(w, http.StatusInternalServerError, "Failed to update client")
 			return
 		}
+		recordAudit(r, h.db, store.AuditUpdate, store.EntityUser, client.ID, before, client)
 		SuccessResponse(w, client)
 		return
 	}
 
 	// Try to update as veterinarian
 	if vet, err := h.db.GetVeterinarianByID(r.Context(), userID); err == nil {
+		before := *vet
 		vet.Name = req.Name
 		vet.Email = req.Email
 		vet.Phone = req.Phone
@@ -212,6 +246,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 			)
 			return
 		}
+		recordAudit(r, h.db, store.AuditUpdate, store.EntityUser, vet.ID, before, vet)
 		SuccessResponse(w, vet)
 		return
 	}
@@ -234,20 +269,33 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only admins can delete users
-	if user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	obj := policy.Object{Resource: policy.User, OwnerID: userID}
+	if !authorize(w, r, h.db, user, policy.Delete, obj) {
 		return
 	}
 
+	// Look the profile up first so the audit log keeps what was deleted
+	var deleted any
+	if client, err := h.db.GetClientByID(r.Context(), userID); err == nil {
+		deleted = client
+	} else if vet, err := h.db.GetVeterinarianByID(r.Context(), userID); err == nil {
+		deleted = vet
+	}
+
 	if err := h.db.DeleteUser(r.Context(), userID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			ErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
 		ErrorResponse(w, http.StatusInternalServerError, "Failed to delete user")
 		return
 	}
 
+	recordAudit(r, h.db, store.AuditDelete, store.EntityUser, userID, deleted, nil)
 	MessageResponse(w, http.StatusOK, "User deleted successfully")
 }
 
-// ListUsers lists all users with pagination
+// ListUsers lists all users, or those with the role query parameter, with pagination
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
@@ -256,36 +304,196 @@ func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only admins can list all users
-	if user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	if !authorize(w, r, h.db, user, policy.List, policy.Object{Resource: policy.User}) {
 		return
 	}
 
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
+	page, err := parsePage(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	limit := 10 // default limit
-	offset := 0 // default offset
+	role := r.URL.Query().Get("role")
+	if role != "" && !slices.Contains(store.UserRoles, role) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
 
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	users, next, err := h.db.ListUsers(r.Context(), role, page)
+	if err != nil {
+		listErrorResponse(w, err, "Failed to list users")
+		return
 	}
 
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
+	ListResponse(w, users, next)
+}
+
+// SetUserRole promotes a user to admin or demotes an admin to the role of
+// their client or veterinarian profile (admin only). Users cannot move
+// between client and veterinarian, and the last admin cannot be demoted.
+func (h *UserHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	target, ok := h.account(w, r, policy.AssignRole)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !slices.Contains(store.UserRoles, req.Role) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+	if req.Role == target.Role {
+		SuccessResponse(w, target)
+		return
 	}
 
-	users, err := h.db.ListUsers(r.Context(), limit, offset)
+	var err error
+	switch {
+	case req.Role == store.RoleAdmin:
+		user, _ := middleware.GetUserFromContext(r.Context())
+		grant := store.NewAdminGrant(target.ID, target.Email, h.profileName(r, target.ID), user.Sub)
+		err = h.db.GrantAdmin(r.Context(), grant)
+	case req.Role == target.Profile:
+		err = h.db.RevokeAdmin(r.Context(), target.ID)
+	default:
+		ErrorResponse(
+			w,
+			http.StatusConflict,
+			"Users can only be made admins or returned to their profile's role",
+		)
+		return
+	}
+	switch {
+	case errors.Is(err, store.ErrLastAdmin):
+		ErrorResponse(w, http.StatusConflict, "Cannot remove the last admin")
+		return
+	case errors.Is(err, store.ErrConflict), errors.Is(err, store.ErrNotFound):
+		ErrorResponse(w, http.StatusConflict, "User's role was changed by another request")
+		return
+	case err != nil:
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to change user role")
+		return
+	}
+
+	h.respondAccount(w, r, target)
+}
+
+// SuspendUser suspends a user's account, so every request they make is
+// refused until it is reactivated (admin only). Admins cannot suspend
+// themselves.
+func (h *UserHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	target, ok := h.account(w, r, policy.Suspend)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, _ := middleware.GetUserFromContext(r.Context())
+	if target.ID == user.Sub {
+		ErrorResponse(w, http.StatusConflict, "You cannot suspend your own account")
+		return
+	}
+	suspension := store.NewSuspension(target.ID, req.Reason, user.Sub)
+	if err := h.db.SuspendUser(r.Context(), suspension); err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+
+	h.respondAccount(w, r, target)
+}
+
+// ReactivateUser lifts a user's suspension (admin only)
+func (h *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	target, ok := h.account(w, r, policy.Suspend)
+	if !ok {
+		return
+	}
+	if !target.Suspended() {
+		ErrorResponse(w, http.StatusConflict, "User is not suspended")
+		return
+	}
+
+	err := h.db.ReactivateUser(r.Context(), target.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		ErrorResponse(w, http.StatusConflict, "User is not suspended")
+		return
+	}
+	if err != nil {
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to reactivate user")
+		return
+	}
+
+	h.respondAccount(w, r, target)
+}
+
+// account loads the account of the user named in the URL and checks the
+// current user may take action on it, writing the error response if not
+func (h *UserHandler) account(
+	w http.ResponseWriter,
+	r *http.Request,
+	action policy.Action,
+) (*store.User, bool) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		ErrorResponse(w, http.StatusUnauthorized, "User not found in context")
+		return nil, false
+	}
+
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		ErrorResponse(w, http.StatusBadRequest, "User ID is required")
+		return nil, false
+	}
+
+	obj := policy.Object{Resource: policy.User, OwnerID: userID}
+	if !authorize(w, r, h.db, user, action, obj) {
+		return nil, false
+	}
+
+	target, err := h.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		ErrorResponse(w, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	return target, true
+}
+
+// respondAccount audits a change to the account before was read as and
+// responds with the account as it is now
+func (h *UserHandler) respondAccount(w http.ResponseWriter, r *http.Request, before *store.User) {
+	after, err := h.db.GetUserByID(r.Context(), before.ID)
 	if err != nil {
-		ErrorResponse(w, http.StatusInternalServerError, "Failed to list users")
+		ErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve user")
 		return
 	}
+	recordAudit(r, h.db, store.AuditUpdate, store.EntityUser, before.ID, before, after)
+	SuccessResponse(w, after)
+}
 
-	SuccessResponse(w, users)
+// profileName is the name on the user's client or veterinarian profile, if
+// they have one
+func (h *UserHandler) profileName(r *http.Request, userID string) string {
+	if client, err := h.db.GetClientByID(r.Context(), userID); err == nil {
+		return client.Name
+	}
+	if vet, err := h.db.GetVeterinarianByID(r.Context(), userID); err == nil {
+		return vet.Name
+	}
+	return ""
 }
 
 // GetOwnerLabel returns a small slice of a client profile for display.
@@ -304,8 +512,8 @@ func (h *UserHandler) GetOwnerLabel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Clients can see their own label; vets/admins can see any client label
-	if user.Role == "client" && user.Sub != ownerID {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	obj := policy.Object{Resource: policy.ClientLabel, OwnerID: ownerID}
+	if !authorize(w, r, h.db, user, policy.Read, obj) {
 		return
 	}
 
@@ -341,8 +549,8 @@ func (h *UserHandler) GetVeterinarianLabel(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Any authenticated role can fetch a vet label for display
-	if user.Role != "client" && user.Role != "veterinarian" && user.Role != "admin" {
-		ErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+	obj := policy.Object{Resource: policy.VeterinarianLabel, VeterinarianID: vetID}
+	if !authorize(w, r, h.db, user, policy.Read, obj) {
 		return
 	}
 
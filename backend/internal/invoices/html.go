@@ -0,0 +1,63 @@
+// Package invoices/html.go renders invoices and credit notes as HTML pages
+package invoices
+
+import (
+	"html/template"
+	"io"
+	"pet-mgt/backend/internal/store"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} {{.Number}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 0.4em; border-bottom: 1px solid #ddd; text-align: left; }
+.num { text-align: right; }
+.parties { display: flex; gap: 4em; margin: 1.5em 0; }
+.parties p { margin: 0.2em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} {{.Number}}</h1>
+<p>Issued {{.Issued}} for order {{.OrderID}}</p>
+{{- if .Credits}}
+<p>Credits invoice {{.Credits}}</p>
+{{- end}}
+<div class="parties">
+{{- range .Parties}}
+<div>
+<h2>{{.Heading}}</h2>
+{{- range .Lines}}
+<p>{{.}}</p>
+{{- end}}
+</div>
+{{- end}}
+</div>
+<table>
+<thead>
+<tr><th>Description</th><th class="num">Quantity</th><th class="num">Unit price</th><th class="num">Total</th></tr>
+</thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.UnitPrice}}</td><td class="num">{{.Total}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+{{- range .Totals}}
+<tr><th colspan="3" class="num">{{.Label}}</th><td class="num">{{.Amount}}</td></tr>
+{{- end}}
+</tfoot>
+</table>
+<p>Payment status: {{.PaymentStatus}}</p>
+</body>
+</html>
+`))
+
+// WriteHTML renders inv as an HTML page
+func WriteHTML(w io.Writer, inv *store.Invoice) error {
+	return htmlTemplate.Execute(w, newView(inv))
+}
@@ -0,0 +1,217 @@
+// Package invoices builds, issues and renders the invoices and credit notes
+// of orders
+package invoices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pet-mgt/backend/internal/store"
+	"slices"
+)
+
+// ErrNotInvoiceable is returned for orders cancelled before they were paid,
+// which are never invoiced
+var ErrNotInvoiceable = errors.New("order was cancelled without payment and has no invoice")
+
+// Invoiceable reports whether order can be invoiced: every order except one
+// cancelled before any of it was paid
+func Invoiceable(order *store.Order) bool {
+	if order.Status != store.OrderCancelled {
+		return true
+	}
+	return store.IsRefundable(order.PaymentStatus) || order.PaymentStatus == store.PaymentRefunded
+}
+
+// Issue returns order's invoice, issuing it first if the order has none yet
+func Issue(ctx context.Context, db store.Database, order *store.Order) (*store.Invoice, error) {
+	inv, err := db.GetOrderInvoice(ctx, order.ID)
+	if !errors.Is(err, store.ErrNotFound) {
+		return inv, err
+	}
+	if !Invoiceable(order) {
+		return nil, ErrNotInvoiceable
+	}
+
+	inv, err = build(ctx, db, order)
+	if err != nil {
+		return nil, err
+	}
+	err = db.IssueInvoice(ctx, inv)
+	if errors.Is(err, store.ErrConflict) {
+		// Issued by a concurrent request in the meantime
+		return db.GetOrderInvoice(ctx, order.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// IssueRefund issues a credit note for amount refunded from payment, against
+// order's invoice. order should be read after the refund was recorded so the
+// note carries the payment status it left behind.
+func IssueRefund(
+	ctx context.Context,
+	db store.Database,
+	order *store.Order,
+	payment *store.Payment,
+	amount store.Money,
+) (*store.Invoice, error) {
+	invoice, err := Issue(ctx, db, order)
+	if err != nil {
+		return nil, err
+	}
+	lines := []store.InvoiceLine{{
+		Description: fmt.Sprintf("Refund of %s payment %s", payment.Provider, payment.IntentID),
+		Quantity:    1,
+		UnitPrice:   amount,
+		Total:       amount,
+	}}
+	note, err := creditNote(invoice, order, lines)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.IssueInvoice(ctx, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// IssueReturn issues the credit note of a refunded return against order's
+// invoice. A return only ever gets one; asking again returns it.
+func IssueReturn(
+	ctx context.Context,
+	db store.Database,
+	order *store.Order,
+	ret *store.Return,
+) (*store.Invoice, error) {
+	invoice, err := Issue(ctx, db, order)
+	if err != nil {
+		return nil, err
+	}
+	descriptions := make(map[string]string)
+	for _, line := range invoice.Lines {
+		descriptions[line.ProductID] = line.Description
+	}
+	lines := make([]store.InvoiceLine, len(ret.Items))
+	for i, it := range ret.Items {
+		description, ok := descriptions[it.ProductID]
+		if !ok {
+			description = "Product " + it.ProductID
+		}
+		lines[i] = store.InvoiceLine{
+			ProductID:   it.ProductID,
+			Description: "Return: " + description,
+			Quantity:    it.Quantity,
+			UnitPrice:   store.NewMoney(it.RefundAmount.Amount/int64(it.Quantity), it.RefundAmount.Currency),
+			Total:       it.RefundAmount,
+		}
+	}
+	note, err := creditNote(invoice, order, lines)
+	if err != nil {
+		return nil, err
+	}
+	note.ReturnID = ret.ID
+
+	err = db.IssueInvoice(ctx, note)
+	if errors.Is(err, store.ErrConflict) {
+		return returnCreditNote(ctx, db, order.ID, ret.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// returnCreditNote finds the credit note already issued for a return
+func returnCreditNote(
+	ctx context.Context,
+	db store.Database,
+	orderID, returnID string,
+) (*store.Invoice, error) {
+	notes, err := db.GetOrderCreditNotes(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		if notes[i].ReturnID == returnID {
+			return &notes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("credit note for return %s: %w", returnID, store.ErrNotFound)
+}
+
+// build snapshots an order's seller, buyer and items into a new invoice
+func build(ctx context.Context, db store.Database, order *store.Order) (*store.Invoice, error) {
+	vet, err := db.GetVeterinarianByID(ctx, order.VeterinarianID)
+	if err != nil {
+		return nil, fmt.Errorf("veterinarian: %w", err)
+	}
+	client, err := db.GetClientByID(ctx, order.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("client: %w", err)
+	}
+	items, err := db.GetOrderItems(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]store.InvoiceLine, len(items))
+	for i, it := range items {
+		// Products can be in the trash by now; the invoice still lists them
+		description := "Product " + it.ProductID
+		if product, err := db.GetProductByID(ctx, it.ProductID); err == nil {
+			description = product.Name
+		}
+		lines[i] = store.InvoiceLine{
+			ProductID:   it.ProductID,
+			Description: description,
+			Quantity:    it.Quantity,
+			UnitPrice:   it.UnitPrice,
+			Total:       it.TotalPrice,
+		}
+	}
+	// Discounts follow the items as lines taking their amount off
+	for _, d := range order.Discounts {
+		off := store.NewMoney(-d.Amount.Amount, d.Amount.Currency)
+		lines = append(lines, store.InvoiceLine{
+			Description: "Discount: " + d.Name,
+			Quantity:    1,
+			UnitPrice:   off,
+			Total:       off,
+		})
+	}
+	seller := store.InvoiceParty{
+		ID:      vet.ID,
+		Name:    vet.Name,
+		Email:   vet.Email,
+		Phone:   vet.Phone,
+		Address: vet.ClinicAddress,
+	}
+	buyer := store.InvoiceParty{
+		ID:      client.ID,
+		Name:    client.Name,
+		Email:   client.Email,
+		Phone:   client.Phone,
+		Address: client.Address,
+	}
+	return store.NewInvoice(store.InvoiceKindInvoice, order, seller, buyer, lines,
+		slices.Clone(order.TaxLines), order.TaxInclusive)
+}
+
+// creditNote builds a credit note of lines against invoice
+func creditNote(
+	invoice *store.Invoice,
+	order *store.Order,
+	lines []store.InvoiceLine,
+) (*store.Invoice, error) {
+	note, err := store.NewInvoice(store.InvoiceKindCreditNote, order, invoice.Seller, invoice.Buyer,
+		lines, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	note.InvoiceID = invoice.ID
+	note.InvoiceNumber = invoice.Number
+	return note, nil
+}
@@ -0,0 +1,213 @@
+package invoices
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"pet-mgt/backend/internal/store"
+	"strings"
+	"testing"
+)
+
+// placeOrder stores a vet, a client and an order of two units of one product
+func placeOrder(t *testing.T, db store.Database) *store.Order {
+	t.Helper()
+	return placeTaxedOrder(t, db, false)
+}
+
+// placeTaxedOrder is placeOrder with the vet charging rates, included in the
+// price when inclusive is set
+func placeTaxedOrder(t *testing.T, db store.Database, inclusive bool, rates ...store.TaxRate) *store.Order {
+	t.Helper()
+	ctx := context.Background()
+	vet := &store.Veterinarian{ID: "vet-1", Name: "Dr. Tan", Email: "tan@vet.example.com",
+		ClinicAddress: "2 Clinic Road\nSingapore"}
+	client := &store.Client{ID: "client-1", Name: "Ann <Lee>", Email: "ann@example.com"}
+	product := store.NewProduct(vet.ID, "Kibble", "", "food", store.NewMoney(1050, "USD"))
+	product.StockQuantity = 5
+	if err := db.CreateVeterinarian(ctx, vet); err != nil {
+		t.Fatalf("CreateVeterinarian: %v", err)
+	}
+	if len(rates) > 0 {
+		if err := db.SetTaxSettings(ctx, store.NewTaxSettings(vet.ID, inclusive, rates)); err != nil {
+			t.Fatalf("SetTaxSettings: %v", err)
+		}
+	}
+	if err := db.CreateClient(ctx, client); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	if err := db.CreateProduct(ctx, product); err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	order := store.NewOrder(client.ID, vet.ID, store.Money{})
+	items := []store.OrderItem{*store.NewOrderItem("", product.ID, 2, store.Money{})}
+	if err := db.PlaceOrder(ctx, order, items); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+	return order
+}
+
+// TestIssue tests that an order's invoice is built from its items, seller
+// and buyer once, and that refunds are credited against it
+func TestIssue(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	order := placeOrder(t, db)
+
+	inv, err := Issue(ctx, db, order)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if inv.Number != "INV-000001" || inv.Seller.Address != "2 Clinic Road\nSingapore" ||
+		inv.Buyer.Name != "Ann <Lee>" || len(inv.Lines) != 1 ||
+		inv.Lines[0].Description != "Kibble" || inv.Total != store.NewMoney(2100, "USD") {
+		t.Errorf("Issue: unexpected invoice %+v", inv)
+	}
+	again, err := Issue(ctx, db, order)
+	if err != nil || again.ID != inv.ID {
+		t.Errorf("Issue twice: expected the same invoice, got %+v, %v", again, err)
+	}
+
+	payment := store.NewPayment(order.ID, "fake", "pi_1", order.TotalAmount)
+	note, err := IssueRefund(ctx, db, order, payment, store.NewMoney(500, "USD"))
+	if err != nil {
+		t.Fatalf("IssueRefund: %v", err)
+	}
+	if note.Number != "CN-000001" || note.InvoiceNumber != inv.Number ||
+		note.Total != store.NewMoney(500, "USD") {
+		t.Errorf("IssueRefund: unexpected credit note %+v", note)
+	}
+
+	cancelled := placeOrder(t, store.NewMemoryStore())
+	cancelled.Status = store.OrderCancelled
+	if _, err := Issue(ctx, db, cancelled); !errors.Is(err, ErrNotInvoiceable) {
+		t.Errorf("Issue for an unpaid cancelled order: expected ErrNotInvoiceable, got %v", err)
+	}
+}
+
+// TestIssueTaxed tests that an invoice carries its order's tax lines, with
+// inclusive tax worked out of the subtotal
+func TestIssueTaxed(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	order := placeTaxedOrder(t, db, true, store.TaxRate{Name: "GST", RateBps: 900})
+
+	inv, err := Issue(ctx, db, order)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if inv.Subtotal != store.NewMoney(1927, "USD") || inv.Tax != store.NewMoney(173, "USD") ||
+		inv.Total != store.NewMoney(2100, "USD") || len(inv.TaxLines) != 1 {
+		t.Errorf("Issue: unexpected taxed invoice %+v", inv)
+	}
+	totals := newView(inv).Totals
+	if len(totals) != 3 || totals[1].Label != "GST 9%" {
+		t.Errorf("newView: expected a GST 9%% total, got %+v", totals)
+	}
+}
+
+// TestIssueDiscounted tests that an order's discounts are listed as lines
+// taking their amount off the subtotal
+func TestIssueDiscounted(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	first := placeTaxedOrder(t, db, false)
+	items, err := db.GetOrderItems(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("GetOrderItems: %v", err)
+	}
+	loyalty := store.NewPromotion(first.VeterinarianID, "Loyalty", store.PromotionFixed)
+	loyalty.Amount = store.NewMoney(100, "USD")
+	if err := db.CreatePromotion(ctx, loyalty); err != nil {
+		t.Fatalf("CreatePromotion: %v", err)
+	}
+	order := store.NewOrder(first.ClientID, first.VeterinarianID, store.Money{})
+	if err := db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", items[0].ProductID, 2, store.Money{}),
+	}); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	inv, err := Issue(ctx, db, order)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if len(inv.Lines) != 2 || inv.Lines[1].Description != "Discount: Loyalty" ||
+		inv.Lines[1].Total != store.NewMoney(-100, "USD") {
+		t.Errorf("Issue: expected a discount line, got %+v", inv.Lines)
+	}
+	if inv.Subtotal != store.NewMoney(2000, "USD") || inv.Total != order.TotalAmount {
+		t.Errorf("Issue: expected a total of %v, got %+v", order.TotalAmount, inv)
+	}
+}
+
+// TestWriteHTML tests that invoices render with their values escaped
+func TestWriteHTML(t *testing.T) {
+	db := store.NewMemoryStore()
+	inv, err := Issue(context.Background(), db, placeOrder(t, db))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, inv); err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+	page := buf.String()
+	for _, want := range []string{"Invoice INV-000001", "Ann &lt;Lee&gt;", "Singapore", "21.00 USD"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("WriteHTML: expected %q in the page", want)
+		}
+	}
+}
+
+// TestWritePDF tests that invoices render as a PDF whose cross-reference
+// table points at its objects
+func TestWritePDF(t *testing.T) {
+	db := store.NewMemoryStore()
+	inv, err := Issue(context.Background(), db, placeOrder(t, db))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	// Enough lines to need a second page
+	for i := 0; i < pdfPageLines; i++ {
+		inv.Lines = append(inv.Lines, inv.Lines[0])
+	}
+
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, inv); err != nil {
+		t.Fatalf("WritePDF: %v", err)
+	}
+	doc := buf.Bytes()
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatalf("WritePDF: not a PDF document")
+	}
+	if !bytes.Contains(doc, []byte("(INVOICE INV-000001)")) || !bytes.Contains(doc, []byte("/Count 2")) {
+		t.Errorf("WritePDF: expected the number and two pages")
+	}
+
+	var xref int
+	tail := doc[bytes.LastIndex(doc, []byte("startxref")):]
+	if _, err := fmt.Sscanf(string(tail), "startxref\n%d", &xref); err != nil {
+		t.Fatalf("WritePDF: reading startxref: %v", err)
+	}
+	entries := strings.Split(string(doc[xref:]), "\n")[3:]
+	for i, entry := range entries[:4+2*2] {
+		var offset int
+		fmt.Sscanf(entry, "%d", &offset)
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(doc[offset:], []byte(want)) {
+			t.Errorf("WritePDF: xref entry %d does not point at %q", i+1, want)
+		}
+	}
+}
+
+// TestPDFString tests that text is escaped for PDF literal strings
+func TestPDFString(t *testing.T) {
+	if got := pdfString(`a (b) \ c`); got != `a \(b\) \\ c` {
+		t.Errorf("pdfString: got %q", got)
+	}
+	if got := pdfString("café ☃"); got != "caf\xe9 ?" {
+		t.Errorf("pdfString: got %q", got)
+	}
+}
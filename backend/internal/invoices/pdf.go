@@ -0,0 +1,194 @@
+// Package invoices/pdf.go renders invoices and credit notes as PDF documents
+package invoices
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"pet-mgt/backend/internal/store"
+	"strings"
+)
+
+// The PDF is set in 10pt Courier on A4 pages. Courier is one of the standard
+// fonts every PDF reader has, and being monospaced it lets the columns be
+// laid out as padded text.
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+	pdfFontSize   = 10
+	pdfLeading    = 12
+	pdfColumns    = 80
+	pdfPageLines  = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// pdfLine is one line of text in the PDF
+type pdfLine struct {
+	text string
+	bold bool
+}
+
+// WritePDF renders inv as a PDF document
+func WritePDF(w io.Writer, inv *store.Invoice) error {
+	lines := pdfText(newView(inv))
+	var pages [][]pdfLine
+	for len(lines) > pdfPageLines {
+		pages = append(pages, lines[:pdfPageLines])
+		lines = lines[pdfPageLines:]
+	}
+	pages = append(pages, lines)
+
+	_, err := w.Write(pdfDocument(pages))
+	return err
+}
+
+// pdfText lays an invoice out as lines of at most pdfColumns characters
+func pdfText(v view) []pdfLine {
+	lines := []pdfLine{
+		{text: strings.ToUpper(v.Title) + " " + v.Number, bold: true},
+		{text: "Issued " + v.Issued + " for order " + v.OrderID},
+	}
+	if v.Credits != "" {
+		lines = append(lines, pdfLine{text: "Credits invoice " + v.Credits})
+	}
+	lines = append(lines, pdfLine{})
+
+	// Seller and buyer side by side
+	seller, buyer := v.Parties[0], v.Parties[1]
+	lines = append(lines, pdfLine{text: pdfRow(seller.Heading, buyer.Heading), bold: true})
+	for i := 0; i < max(len(seller.Lines), len(buyer.Lines)); i++ {
+		var left, right string
+		if i < len(seller.Lines) {
+			left = seller.Lines[i]
+		}
+		if i < len(buyer.Lines) {
+			right = buyer.Lines[i]
+		}
+		lines = append(lines, pdfLine{text: pdfRow(left, right)})
+	}
+	lines = append(lines, pdfLine{})
+
+	const item = "%-40.40s %5s %16s %16s"
+	lines = append(lines,
+		pdfLine{text: fmt.Sprintf(item, "Description", "Qty", "Unit price", "Total"), bold: true},
+		pdfLine{text: strings.Repeat("-", pdfColumns)})
+	for _, l := range v.Lines {
+		description := wrap(l.Description, 40)
+		lines = append(lines, pdfLine{
+			text: fmt.Sprintf(item, description[0], l.Quantity, l.UnitPrice, l.Total),
+		})
+		for _, rest := range description[1:] {
+			lines = append(lines, pdfLine{text: rest})
+		}
+	}
+	lines = append(lines, pdfLine{text: strings.Repeat("-", pdfColumns)})
+	for i, t := range v.Totals {
+		lines = append(lines, pdfLine{
+			text: fmt.Sprintf("%63s %16s", t.Label, t.Amount),
+			bold: i == len(v.Totals)-1,
+		})
+	}
+	return append(lines, pdfLine{}, pdfLine{text: "Payment status: " + v.PaymentStatus})
+}
+
+// pdfRow puts two texts in the left and right halves of a line
+func pdfRow(left, right string) string {
+	return fmt.Sprintf("%-39.39s %.40s", left, right)
+}
+
+// wrap breaks s into lines of at most width characters, at spaces where it can
+func wrap(s string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for len([]rune(word)) > width {
+			if line != "" {
+				lines, line = append(lines, line), ""
+			}
+			r := []rune(word)
+			lines, word = append(lines, string(r[:width])), string(r[width:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= width:
+			line += " " + word
+		default:
+			lines, line = append(lines, line), word
+		}
+	}
+	return append(lines, line)
+}
+
+// pdfDocument writes a PDF with one page per entry of pages. Objects 1 to 4
+// are the catalog, the page tree and the two fonts; each page then takes
+// two objects, the page and its content stream.
+func pdfDocument(pages [][]pdfLine) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>",
+		strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		content := pdfContent(page)
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfContent is the content stream that draws one page of lines
+func pdfContent(lines []pdfLine) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "BT\n%d TL\n%d %d Td\n", pdfLeading, pdfMargin,
+		pdfPageHeight-pdfMargin-pdfFontSize)
+	for _, line := range lines {
+		font := "F1"
+		if line.bold {
+			font = "F2"
+		}
+		fmt.Fprintf(&b, "/%s %d Tf (%s) Tj T*\n", font, pdfFontSize, pdfString(line.text))
+	}
+	b.WriteString("ET")
+	return b.String()
+}
+
+// pdfString encodes s for a PDF literal string. Characters outside Latin-1,
+// which the standard fonts cannot show, become question marks.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r < ' ' || r > 0xff || (r >= 0x7f && r < 0xa0):
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+// Package invoices/view.go contains the formatted contents shared by the renderers
+package invoices
+
+import (
+	"fmt"
+	"pet-mgt/backend/internal/store"
+	"strconv"
+	"strings"
+)
+
+// view is an invoice with every value formatted for display
+type view struct {
+	Title         string
+	Number        string
+	Issued        string
+	OrderID       string
+	Credits       string
+	Parties       []partyView
+	Lines         []lineView
+	Totals        []totalView
+	PaymentStatus string
+}
+
+type partyView struct {
+	Heading string
+	Lines   []string
+}
+
+type lineView struct {
+	Description string
+	Quantity    string
+	UnitPrice   string
+	Total       string
+}
+
+type totalView struct {
+	Label  string
+	Amount string
+}
+
+func newView(inv *store.Invoice) view {
+	v := view{
+		Title:         "Invoice",
+		Number:        inv.Number,
+		Issued:        inv.IssuedAt.UTC().Format("2006-01-02"),
+		OrderID:       inv.OrderID,
+		Credits:       inv.InvoiceNumber,
+		Parties:       []partyView{newPartyView("From", inv.Seller), newPartyView("Bill to", inv.Buyer)},
+		PaymentStatus: strings.ReplaceAll(inv.PaymentStatus, "_", " "),
+	}
+	if inv.Kind == store.InvoiceKindCreditNote {
+		v.Title = "Credit note"
+	}
+	for _, line := range inv.Lines {
+		v.Lines = append(v.Lines, lineView{
+			Description: line.Description,
+			Quantity:    strconv.Itoa(line.Quantity),
+			UnitPrice:   line.UnitPrice.String(),
+			Total:       line.Total.String(),
+		})
+	}
+	v.Totals = []totalView{{Label: "Subtotal", Amount: inv.Subtotal.String()}}
+	if len(inv.TaxLines) == 0 {
+		v.Totals = append(v.Totals, totalView{Label: "Tax", Amount: inv.Tax.String()})
+	}
+	for _, line := range inv.TaxLines {
+		v.Totals = append(v.Totals, totalView{
+			Label:  line.Name + " " + percent(line.RateBps),
+			Amount: line.Amount.String(),
+		})
+	}
+	v.Totals = append(v.Totals, totalView{Label: "Total", Amount: inv.Total.String()})
+	return v
+}
+
+// percent formats a rate in basis points as a percentage, such as 8.25%
+func percent(bps int) string {
+	s := fmt.Sprintf("%d.%02d", bps/100, bps%100)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".") + "%"
+}
+
+// newPartyView lists a party's name, address lines and contact details,
+// skipping the ones it does not have
+func newPartyView(heading string, p store.InvoiceParty) partyView {
+	lines := []string{p.Name}
+	for _, line := range strings.Split(p.Address, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	for _, contact := range []string{p.Email, p.Phone} {
+		if contact != "" {
+			lines = append(lines, contact)
+		}
+	}
+	return partyView{Heading: heading, Lines: lines}
+}
@@ -3,11 +3,13 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"pet-mgt/backend/internal/config"
 	"pet-mgt/backend/internal/store"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -25,8 +27,84 @@ type ContextKey string
 
 const UserContextKey ContextKey = "user"
 
+// Signing methods accepted from the JWKS, and from the shared secret
+var (
+	asymmetricMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+	hmacMethods       = []string{"HS256", "HS384", "HS512"}
+)
+
+// clockSkew is how far token times may be off from ours
+const clockSkew = 30 * time.Second
+
+// Verifier checks tokens' signatures and claims. Tokens signed with an
+// asymmetric key are verified against the key in the JWKS their kid names;
+// HMAC tokens against the shared secret, which stays accepted while clients
+// move over to the new keys. Either is turned off by leaving it unset.
+type Verifier struct {
+	keys   *KeySet
+	secret []byte
+	parser *jwt.Parser
+}
+
+// NewVerifier creates a Verifier from the JWKS, secret, issuer and audience
+// in cfg. Tokens must carry an expiry, and the issuer and audience when they
+// are configured.
+func NewVerifier(cfg *config.Config) *Verifier {
+	v := &Verifier{secret: []byte(cfg.SupabaseJWTSecret)}
+	var methods []string
+	if cfg.JWKSURL != "" {
+		v.keys = NewKeySet(cfg.JWKSURL, cfg.JWKSRefresh)
+		methods = append(methods, asymmetricMethods...)
+	}
+	if len(v.secret) > 0 {
+		methods = append(methods, hmacMethods...)
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	}
+	if cfg.JWTIssuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		options = append(options, jwt.WithAudience(cfg.JWTAudience))
+	}
+	v.parser = jwt.NewParser(options...)
+	return v
+}
+
+// Verify verifies and parses a token
+func (v *Verifier) Verify(tokenString string) (*UserClaims, error) {
+	token, err := v.parser.ParseWithClaims(tokenString, &UserClaims{}, v.key)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid token claims")
+}
+
+// key picks the key a token is verified with. The parser has already
+// checked its algorithm is one we accept.
+func (v *Verifier) key(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return v.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+	return v.keys.Key(kid, token.Method.Alg())
+}
+
 // JWTAuth verifies JWT tokens from Supabase and enriches role from DB
 func JWTAuth(cfg *config.Config, db store.Database) func(http.Handler) http.Handler {
+	verifier := NewVerifier(cfg)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := extractToken(r)
@@ -39,16 +117,30 @@ func JWTAuth(cfg *config.Config, db store.Database) func(http.Handler) http.Hand
 				return
 			}
 
-			claims, err := verifyToken(token, cfg.SupabaseJWTSecret)
+			claims, err := verifier.Verify(token)
 			if err != nil {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			// Hydrate role from DB so app authorization uses our roles
+			// Hydrate role from DB so app authorization uses our roles, and
+			// refuse suspended accounts whatever their token says. Only users
+			// with no profile yet get through without the check.
 			if db != nil && claims != nil && claims.Sub != "" {
-				if u, err := db.GetUserByID(r.Context(), claims.Sub); err == nil && u != nil && u.Role != "" {
-					claims.Role = u.Role
+				u, err := db.GetUserByID(r.Context(), claims.Sub)
+				switch {
+				case errors.Is(err, store.ErrNotFound):
+				case err != nil:
+					http.Error(w, "Unable to verify account", http.StatusServiceUnavailable)
+					return
+				case u != nil:
+					if u.Suspended() {
+						http.Error(w, "Account suspended", http.StatusForbidden)
+						return
+					}
+					if u.Role != "" {
+						claims.Role = u.Role
+					}
 				}
 			}
 
@@ -75,33 +167,6 @@ func extractToken(r *http.Request) string {
 	return parts[1]
 }
 
-// verifyToken verifies and parses the JWT token
-func verifyToken(tokenString, secret string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&UserClaims{},
-		func(token *jwt.Token) (any, error) {
-			// Verify signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf(
-					"unexpected signing method: %v",
-					token.Header["alg"],
-				)
-			}
-			return []byte(secret), nil
-		},
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, fmt.Errorf("invalid token claims")
-}
-
 // GetUserFromContext extracts user claims from request context
 func GetUserFromContext(ctx context.Context) (*UserClaims, bool) {
 	user, ok := ctx.Value(UserContextKey).(*UserClaims)
@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pet-mgt/backend/internal/config"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeJWKS writes the public halves of keys, by kid, as a JWKS file
+func writeJWKS(t *testing.T, path string, keys map[string]any) {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+	var doc struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+				"n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes()),
+			})
+		case *ecdsa.PrivateKey:
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal JWKS: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Write JWKS: %v", err)
+	}
+}
+
+// sign signs claims for a test user with method and key, naming kid
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+// TestVerifier tests that tokens are verified against the JWKS key their
+// kid names or the shared secret, that rotated-in keys are picked up, and
+// that the issuer, audience and validity window are enforced
+func TestVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]any{"rsa-1": rsaKey})
+
+	cfg := &config.Config{
+		SupabaseJWTSecret: "shared-secret",
+		JWKSURL:           "file://" + path,
+		JWKSRefresh:       time.Hour,
+		JWTIssuer:         "https://auth.example.com",
+		JWTAudience:       "authenticated",
+	}
+	v := NewVerifier(cfg)
+	v.keys.minRefresh = 0
+
+	now := time.Now()
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub": "user-1",
+			"iss": cfg.JWTIssuer,
+			"aud": cfg.JWTAudience,
+			"exp": now.Add(time.Hour).Unix(),
+			"nbf": now.Add(-time.Minute).Unix(),
+		}
+		for k, value := range changes {
+			if value == nil {
+				delete(c, k)
+			} else {
+				c[k] = value
+			}
+		}
+		return c
+	}
+
+	user, err := v.Verify(sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(nil)))
+	if err != nil || user.Sub != "user-1" {
+		t.Fatalf("Verify(RS256): expected user-1, got %+v, %v", user, err)
+	}
+	if _, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte("shared-secret"), "", claims(nil))); err != nil {
+		t.Errorf("Verify(HS256 fallback): %v", err)
+	}
+
+	// A key rotated into the JWKS is picked up by the first token using it
+	ecToken := sign(t, jwt.SigningMethodES256, ecKey, "ec-2", claims(nil))
+	if _, err := v.Verify(ecToken); err == nil {
+		t.Errorf("Verify(unknown kid): expected an error")
+	}
+	writeJWKS(t, path, map[string]any{"rsa-1": rsaKey, "ec-2": ecKey})
+	if _, err := v.Verify(ecToken); err != nil {
+		t.Errorf("Verify(rotated-in ES256 key): %v", err)
+	}
+
+	rejected := map[string]string{
+		"wrong issuer":   sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"iss": "https://evil.example.com"})),
+		"wrong audience": sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"aud": "anon"})),
+		"expired":        sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})),
+		"no expiry":      sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"exp": nil})),
+		"not yet valid":  sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()})),
+		"no kid":         sign(t, jwt.SigningMethodRS256, rsaKey, "", claims(nil)),
+		"key for RS256":  sign(t, jwt.SigningMethodRS384, rsaKey, "rsa-1", claims(nil)),
+		"wrong secret":   sign(t, jwt.SigningMethodHS256, []byte("guess"), "", claims(nil)),
+	}
+	for _, name := range []string{
+		"wrong issuer", "wrong audience", "expired", "no expiry", "not yet valid", "no kid",
+		"key for RS256", "wrong secret",
+	} {
+		if _, err := v.Verify(rejected[name]); err == nil {
+			t.Errorf("Verify(%s): expected an error", name)
+		}
+	}
+
+	// Without a secret HMAC tokens are refused outright
+	cfg.SupabaseJWTSecret = ""
+	if _, err := NewVerifier(cfg).Verify(sign(t, jwt.SigningMethodHS256, []byte(""), "", claims(nil))); err == nil {
+		t.Errorf("Verify(HS256 without a secret): expected an error")
+	}
+}
+
+// TestKeySetSkipsBadKeys tests that keys of an unsupported type or curve and
+// malformed keys are skipped without rejecting the rest of the set
+func TestKeySetSkipsBadKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	good := map[string]string{
+		"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256",
+		"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}
+	bad := []map[string]string{
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": b64(make([]byte, 32))},
+		{"kty": "EC", "kid": "ec-1", "crv": "secp256k1", "x": b64(make([]byte, 32)), "y": b64(make([]byte, 32))},
+		{"kty": "RSA", "kid": "rsa-bad", "n": "not base64!", "e": "AQAB"},
+	}
+	write := func(keys []map[string]string) string {
+		data, err := json.Marshal(map[string]any{"keys": keys})
+		if err != nil {
+			t.Fatalf("Marshal JWKS: %v", err)
+		}
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("Write JWKS: %v", err)
+		}
+		return path
+	}
+
+	ks := NewKeySet(write(append(bad, good)), time.Hour)
+	if _, err := ks.Key("rsa-1", "RS256"); err != nil {
+		t.Errorf("Key(rsa-1) in a mixed set: %v", err)
+	}
+	if _, err := ks.Key("ec-1", "ES256"); err == nil {
+		t.Errorf("Key(ec-1) on an unsupported curve: expected an error")
+	}
+
+	if _, err := NewKeySet(write(bad), time.Hour).Key("rsa-bad", "RS256"); err == nil {
+		t.Errorf("Key from a set without usable keys: expected an error")
+	}
+}
+
+// TestJWTAuthRoles tests that the role comes from the database rather than
+// the token, and that suspended accounts are refused with a valid token
+func TestJWTAuthRoles(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemoryStore()
+	_ = db.CreateClient(ctx, &store.Client{ID: "client-1", Email: "client@example.com", Role: "client"})
+	_ = db.CreateVeterinarian(ctx, &store.Veterinarian{ID: "vet-1", Email: "vet@example.com"})
+	_ = db.GrantAdmin(ctx, store.NewAdminGrant("vet-1", "vet@example.com", "", ""))
+	_ = db.SuspendUser(ctx, store.NewSuspension("client-1", "fraud", "vet-1"))
+
+	cfg := &config.Config{SupabaseJWTSecret: "shared-secret"}
+	var role string
+	handler := JWTAuth(cfg, db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := GetUserFromContext(r.Context())
+		role = user.Role
+	}))
+	serve := func(sub string) int {
+		token := sign(t, jwt.SigningMethodHS256, []byte("shared-secret"), "", jwt.MapClaims{
+			"sub":  sub,
+			"role": "authenticated",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		})
+		req := httptest.NewRequest("GET", "/api/v1/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := serve("vet-1"); code != http.StatusOK || role != store.RoleAdmin {
+		t.Errorf("Admin: expected status 200 as admin, got %d as %q", code, role)
+	}
+	if code := serve("client-1"); code != http.StatusForbidden {
+		t.Errorf("Suspended client: expected status 403, got %d", code)
+	}
+	_ = db.ReactivateUser(ctx, "client-1")
+	if code := serve("client-1"); code != http.StatusOK || role != store.RoleClient {
+		t.Errorf("Reactivated client: expected status 200 as client, got %d as %q", code, role)
+	}
+}
+
+// unreachableUsers is a store whose user lookups fail
+type unreachableUsers struct {
+	store.Database
+}
+
+func (unreachableUsers) GetUserByID(context.Context, string) (*store.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestJWTAuthUserLookup(t *testing.T) {
+	cfg := &config.Config{SupabaseJWTSecret: "shared-secret"}
+	serve := func(db store.Database) int {
+		handler := JWTAuth(cfg, db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		token := sign(t, jwt.SigningMethodHS256, []byte("shared-secret"), "", jwt.MapClaims{
+			"sub":  "client-1",
+			"role": "authenticated",
+			"exp":  time.Now().Add(time.Hour).Unix(),
+		})
+		req := httptest.NewRequest("GET", "/api/v1/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := serve(store.NewMemoryStore()); code != http.StatusOK {
+		t.Errorf("User without a profile: expected status 200, got %d", code)
+	}
+	if code := serve(unreachableUsers{store.NewMemoryStore()}); code != http.StatusServiceUnavailable {
+		t.Errorf("Failed lookup: expected status 503, got %d", code)
+	}
+}
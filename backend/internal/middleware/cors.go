@@ -23,10 +23,13 @@ func CORS(cfg *config.Config) func(http.Handler) http.Handler {
 			"Accept",
 			"Authorization",
 			"Content-Type",
+			"If-Match",
 			"X-CSRF-Token",
 		},
 		ExposedHeaders: []string{
+			"ETag",
 			"Link",
+			"X-Request-Id",
 		},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -0,0 +1,215 @@
+// Package middleware/jwks.go contains the JSON Web Key Set that asymmetric tokens are verified against
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksMinRefresh is how often a token with an unknown kid may make the key
+// set reload, so forged kids cannot hammer the JWKS source
+const jwksMinRefresh = 30 * time.Second
+
+// jwksMaxSize caps how much of a JWKS document is read
+const jwksMaxSize = 1 << 20
+
+// ErrUnknownKey is returned when no key in the set has a token's kid
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet is a JSON Web Key Set loaded from a URL or a local file and cached.
+// It reloads when the cache is older than its refresh interval, and early
+// when a token names a kid it does not have, which is how rotated-in keys
+// are picked up. If a reload fails the keys already loaded stay in use.
+type KeySet struct {
+	source     string
+	refresh    time.Duration
+	minRefresh time.Duration
+	client     *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]jwk
+	loadedAt time.Time
+	tried    time.Time
+}
+
+// jwk is a parsed JSON Web Key: its public key and the algorithm it is
+// restricted to, if any
+type jwk struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// NewKeySet creates a KeySet reading source, an http(s) URL or a file path,
+// reloaded every refresh. Nothing is read until the first key is looked up.
+func NewKeySet(source string, refresh time.Duration) *KeySet {
+	return &KeySet{
+		source:     source,
+		refresh:    refresh,
+		minRefresh: jwksMinRefresh,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns the public key with kid for a token signed with alg
+func (ks *KeySet) Key(kid, alg string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	_, known := ks.keys[kid]
+	stale := now.Sub(ks.loadedAt) >= ks.refresh
+	if (stale || !known) && now.Sub(ks.tried) >= ks.minRefresh {
+		ks.tried = now
+		keys, err := ks.load()
+		if err == nil {
+			ks.keys, ks.loadedAt = keys, now
+		} else if ks.keys == nil {
+			return nil, err
+		}
+	}
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	if k.alg != "" && k.alg != alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, k.alg, alg)
+	}
+	return k.key, nil
+}
+
+// load reads and parses the key set. Keys that are not for signatures are
+// skipped, as are keys of a type or curve tokens are not signed with and
+// malformed keys, which are logged, so one bad key cannot lock everyone out.
+// It fails when no usable key is left.
+func (ks *KeySet) load() (map[string]jwk, error) {
+	data, err := ks.read()
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS: %w", err)
+	}
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]jwk, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		default:
+			err = fmt.Errorf("unsupported key type %q", k.Kty)
+		}
+		if err != nil {
+			log.Printf("jwks: skipping key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = jwk{key: key, alg: k.Alg}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+// read fetches the key set document from the URL or file
+func (ks *KeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(ks.source, "http://") && !strings.HasPrefix(ks.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(ks.source, "file://"))
+	}
+
+	resp, err := ks.client.Get(ks.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", ks.source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+}
+
+// rsaKey builds an RSA public key from its base64url modulus and exponent
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	eInt := new(big.Int).SetBytes(exponent)
+	if len(modulus) == 0 || !eInt.IsInt64() || eInt.Int64() < 3 || eInt.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid modulus or exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(eInt.Int64())}, nil
+}
+
+// ecKey builds an ECDSA public key from its curve and base64url coordinates,
+// checking the point is on the curve
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var check ecdh.Curve
+	switch crv {
+	case "P-256":
+		curve, check = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, check = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, check = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(xBytes) != size {
+		return nil, errors.New("invalid x coordinate")
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil || len(yBytes) != size {
+		return nil, errors.New("invalid y coordinate")
+	}
+	point := append(append([]byte{4}, xBytes...), yBytes...)
+	if _, err := check.NewPublicKey(point); err != nil {
+		return nil, errors.New("point is not on the curve")
+	}
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}, nil
+}
@@ -0,0 +1,19 @@
+// Package middleware/request_id.go contains the request ID response header middleware
+package middleware
+
+import (
+	"net/http"
+
+	chiMw "github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader echoes the request ID assigned by chi's RequestID middleware
+// in the X-Request-Id response header, so clients can quote it against the audit log
+func RequestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := chiMw.GetReqID(r.Context()); id != "" {
+			w.Header().Set(chiMw.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
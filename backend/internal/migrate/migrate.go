@@ -0,0 +1,358 @@
+// Package migrate applies the versioned SQL migrations in backend/migrations
+// and records them in the schema_migrations table
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrPending is returned by Check when migrations have not been applied yet
+	ErrPending = errors.New("schema has pending migrations")
+
+	// ErrChecksumMismatch is returned when an applied migration file was edited
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+)
+
+// lockKey is the pg_advisory_lock key that serialises concurrent runners
+const lockKey = 7_340_912_004
+
+var (
+	fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	namePattern     = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load reads NNNN_name.up.sql / NNNN_name.down.sql pairs from fsys, sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		m := fileNamePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		if mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+		mig.Checksum = checksum(mig.Up)
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// checksum returns the hex SHA-256 of a migration's up script
+func checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create writes an empty up/down pair for name into dir, numbered after the
+// highest existing version, and returns the two file paths
+func Create(dir, name string) (string, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+	if !namePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q", name)
+	}
+
+	existing, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var next int64 = 1
+	if len(existing) > 0 {
+		next = existing[len(existing)-1].Version + 1
+	}
+
+	base := fmt.Sprintf("%04d_%s", next, name)
+	upPath := filepath.Join(dir, base+".up.sql")
+	downPath := filepath.Join(dir, base+".down.sql")
+
+	if err := os.WriteFile(upPath, []byte("-- "+base+" (up)\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(downPath, []byte("-- "+base+" (down)\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
+
+// querier is satisfied by both *pgxpool.Pool and *pgxpool.Conn
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// appliedMigration is a row in schema_migrations
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Runner applies migrations to a PostgreSQL database
+type Runner struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewRunner creates a Runner for the given migrations
+func NewRunner(pool *pgxpool.Pool, migrations []Migration) *Runner {
+	return &Runner{pool: pool, migrations: migrations}
+}
+
+// ensureTable creates schema_migrations if it does not exist
+func (r *Runner) ensureTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// applied returns the rows of schema_migrations keyed by version
+func (r *Runner) applied(ctx context.Context, q querier) (map[int64]appliedMigration, error) {
+	rows, err := q.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		out[version] = a
+	}
+	return out, rows.Err()
+}
+
+// verify checks that every applied migration still matches its file
+func (r *Runner) verify(applied map[int64]appliedMigration) error {
+	for _, m := range r.migrations {
+		a, ok := applied[m.Version]
+		if ok && a.Checksum != m.Checksum {
+			return fmt.Errorf("%w: %04d_%s was edited after it was applied", ErrChecksumMismatch, m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock
+func (r *Runner) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	if err := r.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones it applied
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := r.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := r.verify(applied); err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx,
+					`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					m.Version, m.Name, m.Checksum,
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("apply %04d_%s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the most recently applied steps migrations, newest first, and
+// returns the ones it reverted
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := r.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := r.verify(applied); err != nil {
+			return err
+		}
+
+		for i := len(r.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := r.migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("revert %04d_%s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status reports every known migration and whether it has been applied
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	var out []Status
+	err := r.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := r.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range r.migrations {
+			a, ok := applied[m.Version]
+			out = append(out, Status{Migration: m, Applied: ok, AppliedAt: a.AppliedAt})
+		}
+		return r.verify(applied)
+	})
+	return out, err
+}
+
+// Check returns ErrPending if the database is behind the known migrations and
+// ErrChecksumMismatch if an applied migration no longer matches its file. It
+// does not create schema_migrations, so it is safe against read-only roles.
+func (r *Runner) Check(ctx context.Context) error {
+	var exists bool
+	err := r.pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check schema_migrations: %w", err)
+	}
+
+	applied := map[int64]appliedMigration{}
+	if exists {
+		if applied, err = r.applied(ctx, r.pool); err != nil {
+			return err
+		}
+	}
+	if err := r.verify(applied); err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %s (run `go run ./cmd/migrate up`)", ErrPending, strings.Join(pending, ", "))
+	}
+	return nil
+}
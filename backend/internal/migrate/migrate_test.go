@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"pet-mgt/backend/migrations"
+	"testing"
+	"testing/fstest"
+)
+
+// TestLoadOrdersAndChecksums tests that migrations are paired, sorted and checksummed
+func TestLoadOrdersAndChecksums(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX a ON t(a);")},
+		"0002_add_index.down.sql": {Data: []byte("DROP INDEX a;")},
+		"0001_init.up.sql":        {Data: []byte("CREATE TABLE t (a INT);")},
+		"0001_init.down.sql":      {Data: []byte("DROP TABLE t;")},
+		"README.md":               {Data: []byte("ignored")},
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(got))
+	}
+	if got[0].Version != 1 || got[1].Version != 2 {
+		t.Errorf("Expected versions 1, 2, got %d, %d", got[0].Version, got[1].Version)
+	}
+	if got[0].Name != "init" || got[0].Down != "DROP TABLE t;" {
+		t.Errorf("Unexpected migration: %+v", got[0])
+	}
+	if got[0].Checksum == "" || got[0].Checksum == got[1].Checksum {
+		t.Errorf("Expected distinct checksums, got %q and %q", got[0].Checksum, got[1].Checksum)
+	}
+}
+
+// TestLoadRejectsBadFiles tests that malformed migration sets are rejected
+func TestLoadRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{"0001_init.up.sql": {Data: []byte("SELECT 1;")}},
+		},
+		{
+			name: "bad file name",
+			fsys: fstest.MapFS{"init.sql": {Data: []byte("SELECT 1;")}},
+		},
+		{
+			name: "conflicting names",
+			fsys: fstest.MapFS{
+				"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+				"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.fsys); err == nil {
+				t.Errorf("Expected an error for %s", tt.name)
+			}
+		})
+	}
+}
+
+// TestEmbeddedMigrationsLoad tests that the shipped migrations are well formed
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Errorf("Expected contiguous versions, got %d at position %d", m.Version, i)
+		}
+	}
+}
+
+// TestCreateNumbersAfterExisting tests that create picks the next version
+func TestCreateNumbersAfterExisting(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"0001_init.up.sql", "0001_init.down.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	up, down, err := Create(dir, "Add Pet Tags")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if filepath.Base(up) != "0002_add_pet_tags.up.sql" {
+		t.Errorf("Unexpected up file %s", up)
+	}
+	if filepath.Base(down) != "0002_add_pet_tags.down.sql" {
+		t.Errorf("Unexpected down file %s", down)
+	}
+
+	if _, err := Load(os.DirFS(dir)); err != nil {
+		t.Errorf("Expected created files to load, got %v", err)
+	}
+}
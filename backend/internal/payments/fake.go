@@ -0,0 +1,127 @@
+// Package payments/fake.go contains an in-process Gateway for local development and tests
+package payments
+
+import (
+	"context"
+	"fmt"
+	"pet-mgt/backend/internal/store"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// FakeGatewayName is the provider recorded on payments taken by FakeGateway
+const FakeGatewayName = "fake"
+
+// FakeDeclinedAmount is an amount FakeGateway declines on capture, in cents
+// of any currency, so the failure path can be tried locally
+const FakeDeclinedAmount = 13
+
+// FakeGateway is a concurrency-safe Gateway that moves no money. Intents are
+// authorized as soon as they are created; capturing succeeds unless the
+// amount is FakeDeclinedAmount. Intents are lost when the process exits.
+type FakeGateway struct {
+	mu      sync.Mutex
+	intents map[string]Intent
+}
+
+// NewFakeGateway creates a FakeGateway with no intents
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{intents: make(map[string]Intent)}
+}
+
+// Name returns FakeGatewayName
+func (g *FakeGateway) Name() string {
+	return FakeGatewayName
+}
+
+// CreateIntent authorizes a payment of amount for orderID
+func (g *FakeGateway) CreateIntent(
+	ctx context.Context,
+	orderID string,
+	amount store.Money,
+) (*Intent, error) {
+	if amount.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be greater than 0, got %s", amount)
+	}
+
+	id := "pi_fake_" + uuid.NewString()
+	intent := Intent{
+		ID:             id,
+		OrderID:        orderID,
+		Amount:         amount,
+		AmountRefunded: store.NewMoney(0, amount.Currency),
+		Status:         IntentRequiresCapture,
+		ClientSecret:   id + "_secret",
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.intents[id] = intent
+	return &intent, nil
+}
+
+// Intent returns the intent with intentID
+func (g *FakeGateway) Intent(ctx context.Context, intentID string) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	intent, ok := g.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", intentID, ErrIntentNotFound)
+	}
+	return &intent, nil
+}
+
+// Capture takes an authorized payment, declining FakeDeclinedAmount
+func (g *FakeGateway) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	intent, ok := g.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", intentID, ErrIntentNotFound)
+	}
+	if intent.Status != IntentRequiresCapture {
+		return nil, fmt.Errorf("capture %s in status %s: %w", intentID, intent.Status, ErrIntentState)
+	}
+	if intent.Amount.Amount == FakeDeclinedAmount {
+		intent.Status = IntentFailed
+		intent.FailureReason = "card_declined"
+	} else {
+		intent.Status = IntentSucceeded
+	}
+	g.intents[intentID] = intent
+	return &intent, nil
+}
+
+// Refund returns amount of a captured payment, which is refunded once all of
+// it has been returned
+func (g *FakeGateway) Refund(
+	ctx context.Context,
+	intentID string,
+	amount store.Money,
+) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	intent, ok := g.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", intentID, ErrIntentNotFound)
+	}
+	if intent.Status != IntentSucceeded && intent.Status != IntentPartiallyRefunded {
+		return nil, fmt.Errorf("refund %s in status %s: %w", intentID, intent.Status, ErrIntentState)
+	}
+	refunded, err := intent.AmountRefunded.Add(amount)
+	if err != nil || amount.Amount <= 0 || refunded.Amount > intent.Amount.Amount {
+		return nil, fmt.Errorf("refund %s of %s: %w", amount, intentID, ErrRefundAmount)
+	}
+
+	intent.AmountRefunded = refunded
+	intent.Status = IntentPartiallyRefunded
+	if refunded.Amount == intent.Amount.Amount {
+		intent.Status = IntentRefunded
+	}
+	g.intents[intentID] = intent
+	return &intent, nil
+}
@@ -0,0 +1,121 @@
+// Package payments contains the payment gateway abstraction, the built-in
+// fake gateway and the signing of gateway webhooks
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pet-mgt/backend/internal/config"
+	"pet-mgt/backend/internal/store"
+)
+
+// Intent statuses
+const (
+	// IntentRequiresCapture is an authorized intent waiting to be captured
+	IntentRequiresCapture = "requires_capture"
+	IntentSucceeded       = "succeeded"
+	IntentFailed          = "failed"
+	// IntentPartiallyRefunded has had some but not all of its amount refunded
+	IntentPartiallyRefunded = "partially_refunded"
+	IntentRefunded          = "refunded"
+)
+
+var (
+	// ErrIntentNotFound is returned when the gateway has no such intent
+	ErrIntentNotFound = errors.New("payment intent not found")
+
+	// ErrIntentState is returned when an intent cannot be captured or
+	// refunded in its current status
+	ErrIntentState = errors.New("payment intent cannot do that in its current status")
+
+	// ErrRefundAmount is returned when a refund is not positive or exceeds
+	// what is left of the intent
+	ErrRefundAmount = errors.New("refund amount must be positive and within the amount left")
+
+	// ErrDisabled is returned by every call to the gateway New builds when
+	// no payment gateway is configured
+	ErrDisabled = errors.New("online payments are not configured")
+)
+
+// Gateway takes payments for orders. An intent is created for an order's
+// total, captured once the client has authorized it and can be refunded, in
+// one go or in parts, once it succeeded. Gateways report the outcome both in their return values and,
+// asynchronously, through signed webhook events.
+type Gateway interface {
+	// Name identifies the gateway; payments record it as their provider
+	Name() string
+	CreateIntent(ctx context.Context, orderID string, amount store.Money) (*Intent, error)
+	// Intent looks an intent up, failing with ErrIntentNotFound once the
+	// gateway no longer has it
+	Intent(ctx context.Context, intentID string) (*Intent, error)
+	Capture(ctx context.Context, intentID string) (*Intent, error)
+	// Refund returns amount of a captured intent to the client
+	Refund(ctx context.Context, intentID string, amount store.Money) (*Intent, error)
+}
+
+// Intent is a gateway's record of one attempt to take a payment
+type Intent struct {
+	ID      string      `json:"id"`
+	OrderID string      `json:"order_id"`
+	Amount  store.Money `json:"amount"`
+	// AmountRefunded is the total refunded of the intent so far
+	AmountRefunded store.Money `json:"amount_refunded"`
+	Status         string      `json:"status"`
+	// ClientSecret lets the client authorize the intent with the gateway
+	ClientSecret  string `json:"client_secret,omitempty"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// PaymentStatus is the store payment status an intent status corresponds to
+func PaymentStatus(intentStatus string) string {
+	switch intentStatus {
+	case IntentSucceeded:
+		return store.PaymentPaid
+	case IntentFailed:
+		return store.PaymentFailed
+	case IntentPartiallyRefunded:
+		return store.PaymentPartiallyRefunded
+	case IntentRefunded:
+		return store.PaymentRefunded
+	default:
+		return store.PaymentPending
+	}
+}
+
+// New builds the Gateway selected by cfg.PaymentGateway. With none configured
+// it returns a gateway that refuses every payment, and it fails for any name
+// it has no gateway for.
+func New(cfg *config.Config) (Gateway, error) {
+	switch cfg.PaymentGateway {
+	case config.GatewayNone:
+		return disabledGateway{}, nil
+	case config.GatewayFake:
+		return NewFakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("payment gateway %q is not implemented", cfg.PaymentGateway)
+	}
+}
+
+// disabledGateway stands in when online payments are switched off
+type disabledGateway struct{}
+
+func (disabledGateway) Name() string {
+	return config.GatewayNone
+}
+
+func (disabledGateway) CreateIntent(context.Context, string, store.Money) (*Intent, error) {
+	return nil, ErrDisabled
+}
+
+func (disabledGateway) Intent(context.Context, string) (*Intent, error) {
+	return nil, ErrDisabled
+}
+
+func (disabledGateway) Capture(context.Context, string) (*Intent, error) {
+	return nil, ErrDisabled
+}
+
+func (disabledGateway) Refund(context.Context, string, store.Money) (*Intent, error) {
+	return nil, ErrDisabled
+}
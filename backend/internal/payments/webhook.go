@@ -0,0 +1,111 @@
+// Package payments/webhook.go contains the signed webhook events gateways send
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pet-mgt/backend/internal/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries a webhook's signature, "t=<unix seconds>,v1=<hex>",
+// where v1 is the HMAC-SHA256 of "<t>.<body>" keyed with the webhook secret
+const SignatureHeader = "Payment-Signature"
+
+// SignatureTolerance is how far a webhook's timestamp may be from now, which
+// bounds how long a captured request can be replayed
+const SignatureTolerance = 5 * time.Minute
+
+// Webhook event types
+const (
+	EventSucceeded = "payment.succeeded"
+	EventFailed    = "payment.failed"
+	EventRefunded  = "payment.refunded"
+)
+
+// ErrInvalidSignature is returned when a webhook's signature is missing,
+// malformed, stale or does not match its body
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Event is a gateway's notice that an intent changed status. Refund events
+// carry the total refunded so far; without it the whole payment was refunded.
+type Event struct {
+	ID             string       `json:"id"`
+	Type           string       `json:"type"`
+	IntentID       string       `json:"intent_id"`
+	FailureReason  string       `json:"failure_reason,omitempty"`
+	AmountRefunded *store.Money `json:"amount_refunded,omitempty"`
+}
+
+// PaymentStatus is the store payment status the event moves a payment to,
+// or "" for event types that do not move one
+func (e Event) PaymentStatus() string {
+	switch e.Type {
+	case EventSucceeded:
+		return store.PaymentPaid
+	case EventFailed:
+		return store.PaymentFailed
+	case EventRefunded:
+		return store.PaymentRefunded
+	default:
+		return ""
+	}
+}
+
+// ParseEvent decodes a webhook body
+func ParseEvent(body []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+	if event.ID == "" || event.Type == "" || event.IntentID == "" {
+		return nil, errors.New("invalid event: id, type and intent_id are required")
+	}
+	return &event, nil
+}
+
+// Sign returns the SignatureHeader value for body sent at t
+func Sign(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, body)
+}
+
+// VerifySignature checks header, a SignatureHeader value, against body and
+// rejects signatures more than SignatureTolerance away from now
+func VerifySignature(secret, header string, body []byte, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("%w: expected t=<timestamp>,v1=<signature>", ErrInvalidSignature)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return fmt.Errorf("%w: signature does not match", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// signature is the hex HMAC-SHA256 of "<ts>.<body>" keyed with secret
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
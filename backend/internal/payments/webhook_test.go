@@ -0,0 +1,37 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestVerifySignature tests that only fresh signatures over the exact body
+// with the right secret are accepted
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id":"evt_1","type":"payment.succeeded","intent_id":"pi_1"}`)
+	now := time.Unix(1_700_000_000, 0)
+	header := Sign("secret", body, now)
+
+	if err := VerifySignature("secret", header, body, now.Add(time.Minute)); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	cases := map[string]struct {
+		secret, header string
+		body           []byte
+		at             time.Time
+	}{
+		"wrong secret":   {"other", header, body, now},
+		"tampered body":  {"secret", header, []byte(`{"id":"evt_1"}`), now},
+		"stale":          {"secret", header, body, now.Add(SignatureTolerance + time.Second)},
+		"missing header": {"secret", "", body, now},
+		"malformed":      {"secret", "v1=abc", body, now},
+	}
+	for name, tc := range cases {
+		err := VerifySignature(tc.secret, tc.header, tc.body, tc.at)
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+// Package policy declares which roles may take which actions on each kind of
+// resource, and decides requests against those rules. Handlers describe the
+// object a request acts on, including who owns it and which veterinarian it
+// is assigned to, and ask Authorize whether the current user may act on it.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrForbidden is returned when a subject may not take an action on an object
+var ErrForbidden = errors.New("forbidden")
+
+// Roles users act in
+const (
+	RoleClient       = "client"
+	RoleVeterinarian = "veterinarian"
+	RoleAdmin        = "admin"
+)
+
+// Resource is a kind of object actions are taken on
+type Resource string
+
+// Resources
+const (
+	User              Resource = "user"
+	ClientLabel       Resource = "client_label"
+	VeterinarianLabel Resource = "veterinarian_label"
+	Availability      Resource = "availability"
+	Pet               Resource = "pet"
+	PetAccess         Resource = "pet_access"
+	MedicalRecord     Resource = "medical_record"
+	RecordConsent     Resource = "record_consent"
+	QRCode            Resource = "qr_code"
+	Appointment       Resource = "appointment"
+	Product           Resource = "product"
+	Order             Resource = "order"
+	Reservation       Resource = "reservation"
+	Payment           Resource = "payment"
+	Return            Resource = "return"
+	Invoice           Resource = "invoice"
+	TaxSettings       Resource = "tax_settings"
+	Promotion         Resource = "promotion"
+	Trash             Resource = "trash"
+	AuditLog          Resource = "audit_log"
+)
+
+// Action is something done to an object
+type Action string
+
+// Actions
+const (
+	Create  Action = "create"
+	Read    Action = "read"
+	List    Action = "list"
+	Update  Action = "update"
+	Delete  Action = "delete"
+	Cancel  Action = "cancel"
+	History Action = "history"
+	Capture Action = "capture"
+	Review  Action = "review"
+	Refund  Action = "refund"
+	Restore Action = "restore"
+	// AssignRole promotes a user to admin or demotes them to their profile's role
+	AssignRole Action = "assign_role"
+	// Suspend suspends or reactivates a user's account
+	Suspend Action = "suspend"
+	// BreakGlass takes emergency access to a pet's medical records
+	BreakGlass Action = "break_glass"
+)
+
+// Scope is which objects a role may take an action on
+type Scope int
+
+// Scopes, from none to every object of the resource
+const (
+	// None denies the action; it is what roles without a grant get
+	None Scope = iota
+	// Own allows it on objects the subject owns: their profile, their pets
+	// and the records of those pets, or the orders they placed
+	Own
+	// Assigned allows it on objects assigned to the subject as veterinarian:
+	// their appointments, products, orders and settings
+	Assigned
+	// Consented allows it on the medical records of pets whose owner let the
+	// subject see them: through a recent appointment with them, by granting
+	// them access, or through break-glass access the subject logged
+	Consented
+	// Any allows it on every object of the resource
+	Any
+)
+
+// String names the scope as the permission matrix does
+func (s Scope) String() string {
+	switch s {
+	case Own:
+		return "own"
+	case Assigned:
+		return "assigned"
+	case Consented:
+		return "consented"
+	case Any:
+		return "any"
+	default:
+		return "none"
+	}
+}
+
+// Grants maps roles to the scope they may take an action in
+type Grants map[string]Scope
+
+// Permission is what a pet's owner can let another client do for the pet
+type Permission string
+
+// Permissions owners can delegate
+const (
+	ViewRecords      Permission = "view_records"
+	BookAppointments Permission = "book_appointments"
+	PlaceOrders      Permission = "order"
+	ManagePet        Permission = "manage_pet"
+)
+
+// Delegation is access the owner of a pet gave the subject to it
+type Delegation struct {
+	OwnerID     string
+	PetID       string
+	Permissions []Permission
+}
+
+// Subject is the user asking to act. Delegations are the pet access grants
+// they currently hold; handlers only need to load them for delegable actions
+// on someone else's objects.
+type Subject struct {
+	ID          string
+	Role        string
+	Delegations []Delegation
+}
+
+// Object is what an action is taken on. OwnerID is the user it belongs to:
+// the profile's user, the pet's owner (for the pet's records, QR code,
+// appointments and access grants too) or the client an order was placed for.
+// VeterinarianID is the veterinarian it is assigned to, and PetID the pet it
+// concerns, which is what delegated access is checked against. PlacedBy is
+// who placed an order, and only they can act on it through a delegation. For
+// creating and listing, they are who the new object or the listed objects
+// are for.
+// Consented is whether the pet's owner let the subject see the pet's
+// records; handlers look it up when RequiresConsent says so.
+type Object struct {
+	Resource       Resource
+	OwnerID        string
+	VeterinarianID string
+	PetID          string
+	PlacedBy       string
+	Consented      bool
+}
+
+// rules is the permission matrix. Anything it does not grant is denied.
+var rules = map[Resource]map[Action]Grants{
+	User: {
+		// Creating a profile for a user who already has one
+		Create:     {RoleAdmin: Any},
+		Read:       {RoleClient: Own, RoleVeterinarian: Own, RoleAdmin: Any},
+		Update:     {RoleClient: Own, RoleVeterinarian: Own, RoleAdmin: Any},
+		Delete:     {RoleAdmin: Any},
+		List:       {RoleAdmin: Any},
+		AssignRole: {RoleAdmin: Any},
+		Suspend:    {RoleAdmin: Any},
+	},
+	ClientLabel: {
+		Read: {RoleClient: Own, RoleVeterinarian: Any, RoleAdmin: Any},
+	},
+	VeterinarianLabel: {
+		Read: {RoleClient: Any, RoleVeterinarian: Any, RoleAdmin: Any},
+	},
+	Availability: {
+		Update: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Pet: {
+		Create: {RoleClient: Own, RoleAdmin: Any},
+		Read:   {RoleClient: Own, RoleVeterinarian: Any, RoleAdmin: Any},
+		List:   {RoleClient: Own, RoleVeterinarian: Any, RoleAdmin: Any},
+		Update: {RoleClient: Own, RoleVeterinarian: Any, RoleAdmin: Any},
+		Delete: {RoleClient: Own, RoleAdmin: Any},
+	},
+	// Grants belong to the pet's owner, and to the client who received them
+	// when listing or giving them up
+	PetAccess: {
+		Create: {RoleClient: Own, RoleAdmin: Any},
+		List:   {RoleClient: Own, RoleAdmin: Any},
+		Delete: {RoleClient: Own, RoleAdmin: Any},
+	},
+	// Veterinarians add to any pet's history, but only see and change it
+	// with the owner's consent
+	MedicalRecord: {
+		Create: {RoleVeterinarian: Any, RoleAdmin: Any},
+		Read:   {RoleClient: Own, RoleVeterinarian: Consented, RoleAdmin: Any},
+		List:   {RoleClient: Own, RoleVeterinarian: Consented, RoleAdmin: Any},
+		Update: {RoleVeterinarian: Consented, RoleAdmin: Any},
+		Delete: {RoleVeterinarian: Consented, RoleAdmin: Any},
+	},
+	// Consents belong to the pet's owner; listing them includes the trail of
+	// access to the pet's records
+	RecordConsent: {
+		Create:     {RoleClient: Own, RoleAdmin: Any},
+		List:       {RoleClient: Own, RoleAdmin: Any},
+		Delete:     {RoleClient: Own, RoleAdmin: Any},
+		BreakGlass: {RoleVeterinarian: Any},
+	},
+	QRCode: {
+		Create: {RoleClient: Own, RoleAdmin: Any},
+		Read:   {RoleClient: Own, RoleVeterinarian: Any, RoleAdmin: Any},
+		Update: {RoleClient: Own, RoleAdmin: Any},
+		Delete: {RoleClient: Own, RoleAdmin: Any},
+	},
+	Appointment: {
+		Create: {RoleClient: Own, RoleAdmin: Any},
+		Read:   {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		List:   {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Update: {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Cancel: {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Product: {
+		Create:  {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		List:    {RoleClient: Any, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Update:  {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Delete:  {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		History: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Order: {
+		Create:  {RoleClient: Own, RoleAdmin: Any},
+		Read:    {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		List:    {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Update:  {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Cancel:  {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		History: {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Reservation: {
+		Create: {RoleClient: Own, RoleAdmin: Any},
+		Read:   {RoleClient: Own, RoleAdmin: Any},
+		Update: {RoleClient: Own, RoleAdmin: Any},
+		Cancel: {RoleClient: Own, RoleAdmin: Any},
+	},
+	Payment: {
+		Create:  {RoleClient: Own, RoleAdmin: Any},
+		List:    {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Capture: {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Refund:  {RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Return: {
+		Create: {RoleClient: Own, RoleAdmin: Any},
+		Read:   {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		List:   {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Review: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Refund: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Invoice: {
+		Read: {RoleClient: Own, RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	TaxSettings: {
+		Read:   {RoleClient: Any, RoleVeterinarian: Any, RoleAdmin: Any},
+		Update: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Promotion: {
+		Create: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Read:   {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		List:   {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Update: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+		Delete: {RoleVeterinarian: Assigned, RoleAdmin: Any},
+	},
+	Trash: {
+		List:    {RoleAdmin: Any},
+		Restore: {RoleAdmin: Any},
+	},
+	AuditLog: {
+		List: {RoleAdmin: Any},
+	},
+}
+
+// delegated maps the actions clients may take on their own objects that an
+// owner can let another client take, to the permission that lets them.
+// Orders are not tied to a pet, so any grant from the owner giving
+// PlaceOrders lets the grantee place orders on the owner's account, and
+// follow, pay for and cancel the ones they placed.
+var delegated = map[Resource]map[Action]Permission{
+	Pet: {
+		Read:   ViewRecords,
+		Update: ManagePet,
+	},
+	MedicalRecord: {
+		Read: ViewRecords,
+		List: ViewRecords,
+	},
+	QRCode: {
+		Create: ManagePet,
+		Read:   ViewRecords,
+		Update: ManagePet,
+		Delete: ManagePet,
+	},
+	Appointment: {
+		Create: BookAppointments,
+		Read:   BookAppointments,
+		Update: BookAppointments,
+		Cancel: BookAppointments,
+	},
+	Order: {
+		Create:  PlaceOrders,
+		Read:    PlaceOrders,
+		Cancel:  PlaceOrders,
+		History: PlaceOrders,
+	},
+	Payment: {
+		Create:  PlaceOrders,
+		List:    PlaceOrders,
+		Capture: PlaceOrders,
+	},
+}
+
+// Delegable returns the permission that lets a client take action on
+// resource for someone else's pet, and false if it cannot be delegated
+func Delegable(action Action, resource Resource) (Permission, bool) {
+	permission, ok := delegated[resource][action]
+	return permission, ok
+}
+
+// RequiresConsent reports whether role takes action on resource only with
+// the pet owner's consent, which the object must then say whether it has
+func RequiresConsent(role string, action Action, resource Resource) bool {
+	return scopeOf(role, action, resource) == Consented
+}
+
+// scopeOf returns the scope role may take action on resource in
+func scopeOf(role string, action Action, resource Resource) Scope {
+	return rules[resource][action][role]
+}
+
+// Authorize returns nil if sub may take action on obj, or an error wrapping
+// ErrForbidden if not
+func Authorize(sub Subject, action Action, obj Object) error {
+	scope := scopeOf(sub.Role, action, obj.Resource)
+	if sub.ID == "" || !(scope.covers(sub.ID, obj) || scope == Own && sub.delegated(action, obj)) {
+		return fmt.Errorf("%w: %s cannot %s %s", ErrForbidden, roleName(sub.Role), action, obj.Resource)
+	}
+	return nil
+}
+
+// Allowed reports whether sub may take action on obj
+func Allowed(sub Subject, action Action, obj Object) bool {
+	return Authorize(sub, action, obj) == nil
+}
+
+// covers reports whether the scope reaches obj for the subject with id
+func (s Scope) covers(id string, obj Object) bool {
+	switch s {
+	case Own:
+		return obj.OwnerID == id
+	case Assigned:
+		return obj.VeterinarianID == id
+	case Consented:
+		return obj.Consented
+	case Any:
+		return true
+	default:
+		return false
+	}
+}
+
+// delegated reports whether one of the subject's delegations lets them take
+// action on obj for its owner
+func (sub Subject) delegated(action Action, obj Object) bool {
+	permission, ok := Delegable(action, obj.Resource)
+	if !ok || obj.OwnerID == "" || obj.PlacedBy != "" && obj.PlacedBy != sub.ID {
+		return false
+	}
+	for _, d := range sub.Delegations {
+		if d.OwnerID == obj.OwnerID && (obj.PetID == "" || d.PetID == obj.PetID) &&
+			slices.Contains(d.Permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// roleName names role in errors, including the missing one
+func roleName(role string) string {
+	if role == "" {
+		return "user without a role"
+	}
+	return role
+}
@@ -0,0 +1,251 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+// matrix is the whole permission matrix: for each resource and action, the
+// scope clients, veterinarians and admins have
+var matrix = []struct {
+	resource           Resource
+	action             Action
+	client, vet, admin Scope
+}{
+	{User, Create, None, None, Any},
+	{User, Read, Own, Own, Any},
+	{User, Update, Own, Own, Any},
+	{User, Delete, None, None, Any},
+	{User, List, None, None, Any},
+	{User, AssignRole, None, None, Any},
+	{User, Suspend, None, None, Any},
+	{ClientLabel, Read, Own, Any, Any},
+	{VeterinarianLabel, Read, Any, Any, Any},
+	{Availability, Update, None, Assigned, Any},
+	{Pet, Create, Own, None, Any},
+	{Pet, Read, Own, Any, Any},
+	{Pet, List, Own, Any, Any},
+	{Pet, Update, Own, Any, Any},
+	{Pet, Delete, Own, None, Any},
+	{PetAccess, Create, Own, None, Any},
+	{PetAccess, List, Own, None, Any},
+	{PetAccess, Delete, Own, None, Any},
+	{MedicalRecord, Create, None, Any, Any},
+	{MedicalRecord, Read, Own, Consented, Any},
+	{MedicalRecord, List, Own, Consented, Any},
+	{MedicalRecord, Update, None, Consented, Any},
+	{MedicalRecord, Delete, None, Consented, Any},
+	{RecordConsent, Create, Own, None, Any},
+	{RecordConsent, List, Own, None, Any},
+	{RecordConsent, Delete, Own, None, Any},
+	{RecordConsent, BreakGlass, None, Any, None},
+	{QRCode, Create, Own, None, Any},
+	{QRCode, Read, Own, Any, Any},
+	{QRCode, Update, Own, None, Any},
+	{QRCode, Delete, Own, None, Any},
+	{Appointment, Create, Own, None, Any},
+	{Appointment, Read, Own, Assigned, Any},
+	{Appointment, List, Own, Assigned, Any},
+	{Appointment, Update, Own, Assigned, Any},
+	{Appointment, Cancel, Own, Assigned, Any},
+	{Product, Create, None, Assigned, Any},
+	{Product, List, Any, Assigned, Any},
+	{Product, Update, None, Assigned, Any},
+	{Product, Delete, None, Assigned, Any},
+	{Product, History, None, Assigned, Any},
+	{Order, Create, Own, None, Any},
+	{Order, Read, Own, Assigned, Any},
+	{Order, List, Own, Assigned, Any},
+	{Order, Update, None, Assigned, Any},
+	{Order, Cancel, Own, Assigned, Any},
+	{Order, History, Own, Assigned, Any},
+	{Reservation, Create, Own, None, Any},
+	{Reservation, Read, Own, None, Any},
+	{Reservation, Update, Own, None, Any},
+	{Reservation, Cancel, Own, None, Any},
+	{Payment, Create, Own, None, Any},
+	{Payment, List, Own, Assigned, Any},
+	{Payment, Capture, Own, Assigned, Any},
+	{Payment, Refund, None, Assigned, Any},
+	{Return, Create, Own, None, Any},
+	{Return, Read, Own, Assigned, Any},
+	{Return, List, Own, Assigned, Any},
+	{Return, Review, None, Assigned, Any},
+	{Return, Refund, None, Assigned, Any},
+	{Invoice, Read, Own, Assigned, Any},
+	{TaxSettings, Read, Any, Any, Any},
+	{TaxSettings, Update, None, Assigned, Any},
+	{Promotion, Create, None, Assigned, Any},
+	{Promotion, Read, None, Assigned, Any},
+	{Promotion, List, None, Assigned, Any},
+	{Promotion, Update, None, Assigned, Any},
+	{Promotion, Delete, None, Assigned, Any},
+	{Trash, List, None, None, Any},
+	{Trash, Restore, None, None, Any},
+	{AuditLog, List, None, None, Any},
+}
+
+// TestAuthorize tests every cell of the matrix against an object the user
+// owns, one assigned to them, one whose owner consented to them seeing it
+// and one that is none of these
+func TestAuthorize(t *testing.T) {
+	const me, other = "user-1", "user-2"
+	relations := []struct {
+		name   string
+		object func(Resource) Object
+		scopes []Scope
+	}{
+		{"own", func(res Resource) Object {
+			return Object{Resource: res, OwnerID: me, VeterinarianID: other}
+		}, []Scope{Own, Any}},
+		{"assigned", func(res Resource) Object {
+			return Object{Resource: res, OwnerID: other, VeterinarianID: me}
+		}, []Scope{Assigned, Any}},
+		{"consented", func(res Resource) Object {
+			return Object{Resource: res, OwnerID: other, VeterinarianID: other, Consented: true}
+		}, []Scope{Consented, Any}},
+		{"unrelated", func(res Resource) Object {
+			return Object{Resource: res, OwnerID: other, VeterinarianID: other}
+		}, []Scope{Any}},
+	}
+
+	for _, row := range matrix {
+		for role, scope := range map[string]Scope{
+			RoleClient:       row.client,
+			RoleVeterinarian: row.vet,
+			RoleAdmin:        row.admin,
+		} {
+			sub := Subject{ID: me, Role: role}
+			for _, rel := range relations {
+				want := false
+				for _, s := range rel.scopes {
+					want = want || s == scope
+				}
+				err := Authorize(sub, row.action, rel.object(row.resource))
+				if want && err != nil {
+					t.Errorf("%s %s %s (%s): expected allowed, got %v",
+						role, row.action, rel.name, row.resource, err)
+				}
+				if !want && !errors.Is(err, ErrForbidden) {
+					t.Errorf("%s %s %s (%s): expected ErrForbidden, got %v",
+						role, row.action, rel.name, row.resource, err)
+				}
+			}
+		}
+	}
+}
+
+// TestMatrixComplete tests that the matrix above and the rules cover the
+// same resources and actions, so no grant goes untested
+func TestMatrixComplete(t *testing.T) {
+	listed := map[Resource]map[Action]bool{}
+	for _, row := range matrix {
+		if listed[row.resource] == nil {
+			listed[row.resource] = map[Action]bool{}
+		}
+		if listed[row.resource][row.action] {
+			t.Errorf("matrix lists %s %s twice", row.action, row.resource)
+		}
+		listed[row.resource][row.action] = true
+		if _, ok := rules[row.resource][row.action]; !ok {
+			t.Errorf("matrix lists %s %s, which has no rule", row.action, row.resource)
+		}
+	}
+	for resource, actions := range rules {
+		for action, grants := range actions {
+			if !listed[resource][action] {
+				t.Errorf("rule for %s %s is missing from the matrix", action, resource)
+			}
+			for role := range grants {
+				if role != RoleClient && role != RoleVeterinarian && role != RoleAdmin {
+					t.Errorf("rule for %s %s grants unknown role %q", action, resource, role)
+				}
+			}
+		}
+	}
+}
+
+// TestAuthorizeDeniesByDefault tests that unknown roles, resources and
+// actions, and subjects without an ID, are refused
+func TestAuthorizeDeniesByDefault(t *testing.T) {
+	obj := Object{Resource: Pet, OwnerID: "user-1"}
+	cases := map[string]struct {
+		sub    Subject
+		action Action
+		obj    Object
+	}{
+		"no role":          {Subject{ID: "user-1"}, Read, obj},
+		"generic role":     {Subject{ID: "user-1", Role: "authenticated"}, Read, obj},
+		"unknown action":   {Subject{ID: "user-1", Role: RoleAdmin}, "approve", obj},
+		"unknown resource": {Subject{ID: "user-1", Role: RoleAdmin}, Read, Object{Resource: "ledger"}},
+		"no ID":            {Subject{Role: RoleClient}, Read, Object{Resource: Pet}},
+	}
+	for name, c := range cases {
+		if err := Authorize(c.sub, c.action, c.obj); !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s: expected ErrForbidden, got %v", name, err)
+		}
+	}
+	if Allowed(Subject{ID: "user-1", Role: RoleClient}, Delete, Object{Resource: Pet, OwnerID: "user-2"}) {
+		t.Errorf("Allowed: a client deleting another client's pet was allowed")
+	}
+}
+
+// TestAuthorizeDelegations tests that pet access grants let clients act for
+// another client's pet within the permissions they were given, and for that
+// pet only
+func TestAuthorizeDelegations(t *testing.T) {
+	sitter := Subject{ID: "sitter", Role: RoleClient, Delegations: []Delegation{
+		{OwnerID: "owner", PetID: "pet-1", Permissions: []Permission{ViewRecords, BookAppointments}},
+		{OwnerID: "neighbour", PetID: "pet-9", Permissions: []Permission{PlaceOrders}},
+	}}
+	pet := func(resource Resource, petID string) Object {
+		return Object{Resource: resource, OwnerID: "owner", PetID: petID}
+	}
+	placed := func(resource Resource, placedBy string) Object {
+		return Object{Resource: resource, OwnerID: "neighbour", PlacedBy: placedBy}
+	}
+	cases := []struct {
+		name    string
+		action  Action
+		obj     Object
+		allowed bool
+	}{
+		{"read the pet", Read, pet(Pet, "pet-1"), true},
+		{"list its records", List, pet(MedicalRecord, "pet-1"), true},
+		{"read its QR code", Read, pet(QRCode, "pet-1"), true},
+		{"book an appointment", Create, pet(Appointment, "pet-1"), true},
+		{"cancel an appointment", Cancel, pet(Appointment, "pet-1"), true},
+		{"update the pet without manage_pet", Update, pet(Pet, "pet-1"), false},
+		{"delete the pet", Delete, pet(Pet, "pet-1"), false},
+		{"read another of the owner's pets", Read, pet(Pet, "pet-2"), false},
+		{"order without the order permission", Create, Object{Resource: Order, OwnerID: "owner"}, false},
+		{"order for the neighbour", Create, Object{Resource: Order, OwnerID: "neighbour"}, true},
+		{"list the neighbour's orders", List, Object{Resource: Order, OwnerID: "neighbour"}, false},
+		{"read an order they placed", Read, placed(Order, "sitter"), true},
+		{"cancel an order they placed", Cancel, placed(Order, "sitter"), true},
+		{"pay for an order they placed", Create, placed(Payment, "sitter"), true},
+		{"read an order the neighbour placed", Read, placed(Order, "neighbour"), false},
+		{"cancel an order the neighbour placed", Cancel, placed(Order, "neighbour"), false},
+		{"refund an order they placed", Refund, placed(Payment, "sitter"), false},
+		{"grant access onwards", Create, pet(PetAccess, "pet-1"), false},
+	}
+	for _, c := range cases {
+		if got := Allowed(sitter, c.action, c.obj); got != c.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", c.name, c.allowed, got)
+		}
+	}
+
+	// Delegations only widen what clients may do with their own objects
+	vet := Subject{ID: "vet", Role: RoleVeterinarian, Delegations: sitter.Delegations}
+	if Allowed(vet, Create, pet(Appointment, "pet-1")) {
+		t.Errorf("a veterinarian holding a delegation booked an appointment")
+	}
+	for resource, actions := range delegated {
+		for action := range actions {
+			if scopeOf(RoleClient, action, resource) != Own {
+				t.Errorf("%s %s is delegable but clients cannot take it on their own objects",
+					action, resource)
+			}
+		}
+	}
+}
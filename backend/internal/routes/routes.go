@@ -5,6 +5,7 @@ import (
 	"pet-mgt/backend/internal/config"
 	"pet-mgt/backend/internal/handlers"
 	"pet-mgt/backend/internal/middleware"
+	"pet-mgt/backend/internal/payments"
 	"pet-mgt/backend/internal/store"
 	"time"
 
@@ -14,13 +15,13 @@ import (
 )
 
 // SetupRouter sets up the chi router
-func SetupRouter(cfg *config.Config, db store.Database) *chi.Mux {
+func SetupRouter(cfg *config.Config, db store.Database, gateway payments.Gateway) *chi.Mux {
 	r := chi.NewRouter()
 	setupGlobalMiddleware(cfg, r)
 	r.Use(chiMw.Heartbeat("/ping"))
 
 	// Initialize all handlers with database dependency
-	h := handlers.NewHandlers(cfg, db)
+	h := handlers.NewHandlers(cfg, db, gateway)
 
 	r.Route("/api/v1", func(r chi.Router) {
 		// Public routes with their own middleware
@@ -29,6 +30,9 @@ func SetupRouter(cfg *config.Config, db store.Database) *chi.Mux {
 			publicRoutes(r, h)
 		})
 
+		// Payment gateway webhooks are authenticated by their signature
+		r.Post("/payments/webhook", h.Payment.HandleWebhook)
+
 		// Protected routes with their own middleware
 		r.Group(func(r chi.Router) {
 			r.Use(httprate.LimitByIP(100, 1*time.Minute))
@@ -66,6 +70,10 @@ func protectedRoutes(r chi.Router, h *handlers.Handlers) {
 	r.Get("/veterinarians/{id}/label", h.User.GetVeterinarianLabel)
 	r.Put("/users/{id}", h.User.UpdateUser)
 	r.Delete("/users/{id}", h.User.DeleteUser)
+	// Role assignment and account suspension (admin only)
+	r.Put("/users/{id}/role", h.User.SetUserRole)
+	r.Post("/users/{id}/suspend", h.User.SuspendUser)
+	r.Post("/users/{id}/reactivate", h.User.ReactivateUser)
 
 	// Pet routes
 	r.Post("/pets", h.Pet.CreatePet)
@@ -74,6 +82,12 @@ func protectedRoutes(r chi.Router, h *handlers.Handlers) {
 	r.Delete("/pets/{id}", h.Pet.DeletePet)
 	r.Get("/clients/{clientId}/pets", h.Pet.GetPetsByClient)
 
+	// Pet access routes: owners share pets with co-owners and caretakers
+	r.Post("/pets/{petId}/access", h.PetAccess.GrantPetAccess)
+	r.Get("/pets/{petId}/access", h.PetAccess.GetPetAccessGrants)
+	r.Delete("/pets/{petId}/access/{grantId}", h.PetAccess.RevokePetAccess)
+	r.Get("/pet-access", h.PetAccess.GetReceivedPetAccess)
+
 	// QR Code routes
 	r.Post("/pets/{petId}/qr-code", h.QRCode.GenerateQRCode)
 	r.Get("/pets/{petId}/qr-code", h.QRCode.GetQRCode)
@@ -87,6 +101,13 @@ func protectedRoutes(r chi.Router, h *handlers.Handlers) {
 	r.Put("/medical-records/{id}", h.MedicalRecord.UpdateMedicalRecord)
 	r.Delete("/medical-records/{id}", h.MedicalRecord.DeleteMedicalRecord)
 
+	// Record consent routes: owners decide which vets see a pet's records
+	r.Post("/pets/{petId}/record-consents", h.RecordConsent.GrantRecordAccess)
+	r.Get("/pets/{petId}/record-consents", h.RecordConsent.GetRecordConsents)
+	r.Delete("/pets/{petId}/record-consents/{consentId}", h.RecordConsent.RevokeRecordAccess)
+	r.Post("/pets/{petId}/break-glass", h.RecordConsent.BreakGlass)
+	r.Get("/pets/{petId}/record-access-log", h.RecordConsent.GetRecordAccessLog)
+
 	// Appointment routes
 	r.Post("/appointments", h.Appointment.CreateAppointment)
 	r.Get("/appointments", h.Appointment.GetAppointments)
@@ -108,7 +129,13 @@ func protectedRoutes(r chi.Router, h *handlers.Handlers) {
 	r.Delete("/products/{id}", h.Product.DeleteProduct)
 	r.Get("/veterinarians/{vetId}/products", h.Product.GetVeterinarianProducts)
 	r.Put("/products/{id}/stock", h.Product.UpdateProductStock)
-	r.Post("/products/checkout", h.Product.CheckoutProducts)
+	r.Get("/products/{id}/stock-history", h.Product.GetStockHistory)
+	r.Post("/products/checkout", h.Reservation.CreateReservation)
+
+	// Reservation routes
+	r.Get("/reservations/{id}", h.Reservation.GetReservation)
+	r.Delete("/reservations/{id}", h.Reservation.ReleaseReservation)
+	r.Post("/reservations/{id}/confirm", h.Reservation.ConfirmReservation)
 
 	// Order routes
 	r.Post("/orders", h.Order.CreateOrder)
@@ -116,10 +143,53 @@ func protectedRoutes(r chi.Router, h *handlers.Handlers) {
 	r.Get("/orders/{id}", h.Order.GetOrder)
 	r.Put("/orders/{id}/status", h.Order.UpdateOrderStatus)
 	r.Delete("/orders/{id}", h.Order.CancelOrder)
+	r.Get("/orders/{id}/history", h.Order.GetOrderHistory)
+
+	// Payment routes
+	r.Post("/orders/{id}/payments", h.Payment.CreatePayment)
+	r.Get("/orders/{id}/payments", h.Payment.GetOrderPayments)
+	r.Post("/payments/{id}/capture", h.Payment.CapturePayment)
+	r.Post("/payments/{id}/refund", h.Payment.RefundPayment)
+
+	// Return routes
+	r.Post("/orders/{id}/returns", h.Return.CreateReturn)
+	r.Get("/orders/{id}/returns", h.Return.GetOrderReturns)
+	r.Get("/returns/{id}", h.Return.GetReturn)
+	r.Post("/returns/{id}/approve", h.Return.ApproveReturn)
+	r.Post("/returns/{id}/reject", h.Return.RejectReturn)
+	r.Post("/returns/{id}/refund", h.Return.RefundReturn)
+
+	// Invoice routes
+	r.Get("/orders/{id}/invoice", h.Invoice.GetOrderInvoice)
+	r.Get("/orders/{id}/credit-notes", h.Invoice.GetOrderCreditNotes)
+	r.Get("/invoices/{id}", h.Invoice.GetInvoice)
+
+	// Tax settings routes
+	r.Get("/veterinarians/{id}/tax-settings", h.Tax.GetTaxSettings)
+	r.Put("/veterinarians/{id}/tax-settings", h.Tax.SetTaxSettings)
+
+	// Promotion routes (veterinarians and admins)
+	r.Post("/promotions", h.Promotion.CreatePromotion)
+	r.Get("/promotions", h.Promotion.GetPromotions)
+	r.Get("/promotions/{id}", h.Promotion.GetPromotion)
+	r.Put("/promotions/{id}", h.Promotion.UpdatePromotion)
+	r.Delete("/promotions/{id}", h.Promotion.DeletePromotion)
+
+	// Trash routes (admin only)
+	r.Get("/trash", h.Trash.ListTrash)
+	r.Post("/users/{id}/restore", h.Trash.Restore(store.EntityUser))
+	r.Post("/pets/{id}/restore", h.Trash.Restore(store.EntityPet))
+	r.Post("/medical-records/{id}/restore", h.Trash.Restore(store.EntityMedicalRecord))
+	r.Post("/products/{id}/restore", h.Trash.Restore(store.EntityProduct))
+
+	// Audit log (admin only)
+	r.Get("/audit", h.Audit.ListAuditEntries)
 }
 
 // setupGlobalMiddleware sets up the middleware for the router
 func setupGlobalMiddleware(cfg *config.Config, r *chi.Mux) {
+	r.Use(chiMw.RequestID)
+	r.Use(middleware.RequestIDHeader)
 	r.Use(chiMw.Logger)
 	r.Use(chiMw.Recoverer)
 	r.Use(chiMw.Timeout(60 * time.Second))
@@ -0,0 +1,75 @@
+// Package store/accounts.go contains the admin registry and account suspension types shared by all backends
+package store
+
+import "time"
+
+// Roles users act in. A user is an admin while they are in the admin
+// registry, and otherwise has the role of their client or veterinarian
+// profile.
+const (
+	RoleClient       = "client"
+	RoleVeterinarian = "veterinarian"
+	RoleAdmin        = "admin"
+)
+
+// AdminGrant puts a user in the admin registry. Email and Name are what is
+// shown for admins without a profile. GrantedBy is the admin who granted it,
+// empty for admins bootstrapped at startup.
+type AdminGrant struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	GrantedBy string    `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// Suspension records why and by whom a user's account was suspended
+type Suspension struct {
+	UserID      string    `json:"user_id"`
+	Reason      string    `json:"reason"`
+	SuspendedBy string    `json:"suspended_by"`
+	SuspendedAt time.Time `json:"suspended_at"`
+}
+
+// NewAdminGrant creates an AdminGrant for userID by the admin grantedBy
+func NewAdminGrant(userID, email, name, grantedBy string) *AdminGrant {
+	return &AdminGrant{
+		UserID:    userID,
+		Email:     email,
+		Name:      name,
+		GrantedBy: grantedBy,
+		GrantedAt: time.Now(),
+	}
+}
+
+// NewSuspension creates a Suspension of userID by the admin suspendedBy
+func NewSuspension(userID, reason, suspendedBy string) *Suspension {
+	return &Suspension{
+		UserID:      userID,
+		Reason:      reason,
+		SuspendedBy: suspendedBy,
+		SuspendedAt: time.Now(),
+	}
+}
+
+// UserRoles lists the roles ListUsers can filter by
+var UserRoles = []string{RoleClient, RoleVeterinarian, RoleAdmin}
+
+// account applies the admin registry and a suspension to a user read from
+// their profile, which is the zero User for admins without one
+func account(u User, userID string, admin *AdminGrant, suspension *Suspension) User {
+	u.ID = userID
+	u.Profile = u.Role
+	if admin != nil {
+		u.Role = RoleAdmin
+		if u.Email == "" {
+			u.Email = admin.Email
+		}
+	}
+	if suspension != nil {
+		at := suspension.SuspendedAt
+		u.SuspendedAt = &at
+		u.SuspensionReason = suspension.Reason
+	}
+	return u
+}
@@ -0,0 +1,140 @@
+// Package store/audit.go contains the audit log types shared by all backends
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditRead    = "read"
+)
+
+// Audited entities besides the ones that can be trashed
+const (
+	EntityAppointment = "appointment"
+	EntityOrder       = "order"
+	EntityQRCode      = "qr_code"
+	EntityReservation = "reservation"
+	EntityPayment     = "payment"
+	EntityReturn      = "return"
+	EntityInvoice     = "invoice"
+	EntityTaxSettings = "tax_settings"
+	EntityPromotion   = "promotion"
+	EntityPetAccess   = "pet_access"
+	// EntityRecordAccess entries are keyed by pet ID, so a pet's owner can
+	// follow who was given, took and used access to its medical records
+	EntityRecordAccess = "record_access"
+)
+
+// AuditEntry records who did what to which row. Entries are append-only:
+// no backend can change or remove one once it is written.
+type AuditEntry struct {
+	ID        string                 `json:"id"`
+	ActorID   string                 `json:"actor_id"`
+	ActorRole string                 `json:"actor_role"`
+	Action    string                 `json:"action"`
+	Entity    string                 `json:"entity"`
+	EntityID  string                 `json:"entity_id"`
+	Changes   map[string]FieldChange `json:"changes,omitempty"`
+	IP        string                 `json:"ip"`
+	RequestID string                 `json:"request_id"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FieldChange is the value of one field before and after a write. Before is
+// null for creates and After is null for deletes.
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditFilter narrows ListAuditEntries. Zero fields match everything; From is
+// inclusive and To exclusive.
+type AuditFilter struct {
+	ActorID  string
+	Action   string
+	Entity   string
+	EntityID string
+	From     time.Time
+	To       time.Time
+}
+
+// NewAuditEntry creates a new AuditEntry with generated ID and timestamp
+func NewAuditEntry(actorID, actorRole, action, entity, entityID string) *AuditEntry {
+	return &AuditEntry{
+		ID:        uuid.New().String(),
+		ActorID:   actorID,
+		ActorRole: actorRole,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// matches reports whether e passes every filter in f
+func (f AuditFilter) matches(e AuditEntry) bool {
+	switch {
+	case f.ActorID != "" && e.ActorID != f.ActorID,
+		f.Action != "" && e.Action != f.Action,
+		f.Entity != "" && e.Entity != f.Entity,
+		f.EntityID != "" && e.EntityID != f.EntityID,
+		!f.From.IsZero() && e.CreatedAt.Before(f.From),
+		!f.To.IsZero() && !e.CreatedAt.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// auditKey is the cursor for ListAuditEntries, which lists newest first
+func auditKey(e AuditEntry) cursor {
+	return cursor{Sort: sortByNewest, CreatedAt: e.CreatedAt, ID: e.ID}
+}
+
+// AuditDiff compares the JSON forms of before and after, either of which may
+// be nil, and returns the fields that differ. updated_at is left out since
+// every write changes it.
+func AuditDiff(before, after any) map[string]FieldChange {
+	a, b := auditFields(before), auditFields(after)
+	changes := map[string]FieldChange{}
+	for field, was := range a {
+		if field == "updated_at" {
+			continue
+		}
+		if is, ok := b[field]; !ok || !reflect.DeepEqual(was, is) {
+			changes[field] = FieldChange{Before: was, After: b[field]}
+		}
+	}
+	for field, is := range b {
+		if _, ok := a[field]; !ok && field != "updated_at" {
+			changes[field] = FieldChange{After: is}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// auditFields flattens v into its top-level JSON fields
+func auditFields(v any) map[string]any {
+	fields := map[string]any{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
@@ -0,0 +1,91 @@
+// Package store/checkout.go contains the multi-veterinarian checkout types shared by all backends
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Checkout is a cart placed as one order per veterinarian. The orders share
+// the checkout's ID as their CheckoutGroupID and are placed all-or-nothing.
+type Checkout struct {
+	ID          string          `json:"id"`
+	ClientID    string          `json:"client_id"`
+	Orders      []CheckoutOrder `json:"orders"`
+	TotalAmount Money           `json:"total_amount"`
+}
+
+// CheckoutOrder is one veterinarian's order within a checkout
+type CheckoutOrder struct {
+	Order
+	Items []OrderItem `json:"items"`
+}
+
+// splitCheckout groups items into one order per veterinarian, ordered by
+// veterinarian ID. Every order copies template's client, payment and delivery
+// details. products maps product IDs to the products, of which only the
+// veterinarian and price currency are used; a product missing from it is not
+// found. All products must be priced in the same currency.
+func splitCheckout(
+	template *Order,
+	items []OrderItem,
+	products map[string]Product,
+) (*Checkout, error) {
+	if template.ClientID == "" {
+		return nil, fmt.Errorf("%w: client is required", ErrInvalidOrder)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+
+	checkout := &Checkout{ID: uuid.New().String(), ClientID: template.ClientID}
+	byVet := make(map[string]int)
+	var currency string
+	for _, it := range items {
+		if it.ProductID == "" || it.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: item quantity must be greater than 0", ErrInvalidOrder)
+		}
+		product, ok := products[it.ProductID]
+		if !ok {
+			return nil, notFound("product " + it.ProductID)
+		}
+		if currency == "" {
+			currency = product.Price.Currency
+		} else if product.Price.Currency != currency {
+			return nil, fmt.Errorf("%w: all products must be priced in the same currency", ErrInvalidOrder)
+		}
+		vetID := product.VeterinarianID
+		i, ok := byVet[vetID]
+		if !ok {
+			order := *template
+			order.ID = uuid.New().String()
+			order.VeterinarianID = vetID
+			order.CheckoutGroupID = checkout.ID
+			order.TotalAmount = Money{}
+			checkout.Orders = append(checkout.Orders, CheckoutOrder{Order: order})
+			i = len(checkout.Orders) - 1
+			byVet[vetID] = i
+		}
+		it.OrderID = checkout.Orders[i].ID
+		checkout.Orders[i].Items = append(checkout.Orders[i].Items, it)
+	}
+	sort.Slice(checkout.Orders, func(a, b int) bool {
+		return checkout.Orders[a].VeterinarianID < checkout.Orders[b].VeterinarianID
+	})
+	return checkout, nil
+}
+
+// total sums the placed orders into the checkout's total
+func (c *Checkout) total() error {
+	c.TotalAmount = Money{}
+	for _, o := range c.Orders {
+		sum, err := c.TotalAmount.Add(o.TotalAmount)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+		}
+		c.TotalAmount = sum
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"pet-mgt/backend/internal/config"
+	"pet-mgt/backend/internal/store"
+	"pet-mgt/backend/internal/store/storetest"
+	"testing"
+)
+
+// TestMemoryStoreContract runs the shared suite against a fresh MemoryStore per subtest
+func TestMemoryStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Database {
+		return store.NewMemoryStore()
+	})
+}
+
+// TestPostgresStoreContract runs the shared suite against TEST_DATABASE_URL
+func TestPostgresStoreContract(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := store.NewPostgresStore(context.Background(), url)
+	if err != nil {
+		t.Fatalf("NewPostgresStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	storetest.Run(t, func(t *testing.T) store.Database { return db })
+}
+
+// TestSupabaseServiceContract runs the shared suite against a Supabase project
+// given by TEST_SUPABASE_URL and TEST_SUPABASE_SERVICE_KEY. The project must
+// have the migrations applied; never point this at production data.
+func TestSupabaseServiceContract(t *testing.T) {
+	url := os.Getenv("TEST_SUPABASE_URL")
+	key := os.Getenv("TEST_SUPABASE_SERVICE_KEY")
+	if url == "" || key == "" {
+		t.Skip("TEST_SUPABASE_URL or TEST_SUPABASE_SERVICE_KEY not set")
+	}
+
+	db, err := store.NewSupabaseService(&config.Config{SupabaseURL: url, SupabaseServiceKey: key})
+	if err != nil {
+		t.Fatalf("NewSupabaseService: %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) store.Database { return db })
+}
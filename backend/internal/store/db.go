@@ -3,10 +3,15 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"pet-mgt/backend/internal/config"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/supabase-community/postgrest-go"
 	"github.com/supabase-community/supabase-go"
 )
 
@@ -39,42 +44,143 @@ func (s *SupabaseService) Ping(ctx context.Context) error {
 	return nil
 }
 
-// GetUserByID retrieves a user by their ID
+// supabaseError maps PostgREST errors, which surface as "(CODE) message",
+// onto the store's sentinel errors
+func supabaseError(entity string, err error) error {
+	if err == nil {
+		return nil
+	}
+	code, _, _ := strings.Cut(strings.TrimPrefix(err.Error(), "("), ")")
+	switch code {
+	case "PGRST116", "22P02": // no rows for Single(), malformed id
+		return notFound(entity)
+	case "23505": // unique_violation
+		return fmt.Errorf("%s: %w", entity, ErrConflict)
+	case "23503": // foreign_key_violation
+		return fmt.Errorf("%s references a missing row: %w", entity, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", entity, err)
+}
+
+// Sort orders shared by list queries so pagination is stable across backends
+var (
+	oldestFirst = postgrest.OrderOpts{Ascending: true}
+	newestFirst = postgrest.OrderOpts{Ascending: false}
+)
+
+// updateOne executes a filtered update and reports ErrNotFound when it
+// matched no rows. PostgREST returns the updated rows by default.
+func updateOne(entity string, query *postgrest.FilterBuilder) error {
+	body, _, err := query.Execute()
+	if err != nil {
+		return supabaseError(entity, err)
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return fmt.Errorf("%s: unexpected response: %w", entity, err)
+	}
+	if len(rows) == 0 {
+		return notFound(entity)
+	}
+	return nil
+}
+
+// updateVersioned updates the row id in table with values, guarded by the
+// expected version unless it is zero, and stores the row's new version back
+// into version. A miss is a version conflict when the row still exists.
+func (s *SupabaseService) updateVersioned(
+	entity, table, id string,
+	version *int,
+	values any,
+) error {
+	query := s.client.From(table).Update(values, "", "").Eq("id", id)
+	if softDeleted(table) {
+		query = query.Is("deleted_at", "null")
+	}
+	if *version != 0 {
+		query = query.Eq("version", strconv.Itoa(*version))
+	}
+	body, _, err := query.Execute()
+	if err != nil {
+		return supabaseError(entity, err)
+	}
+	var rows []struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return fmt.Errorf("%s: unexpected response: %w", entity, err)
+	}
+	if len(rows) > 0 {
+		*version = rows[0].Version
+		return nil
+	}
+
+	exists := s.client.From(table).Select("id", "exact", true).Eq("id", id)
+	if softDeleted(table) {
+		exists = exists.Is("deleted_at", "null")
+	}
+	_, count, err := exists.Execute()
+	if err != nil {
+		return supabaseError(entity, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%s %w", entity, ErrVersionConflict)
+	}
+	return notFound(entity)
+}
+
+// selectPage orders a filtered select by sortBy, applies page.Cursor as a
+// keyset filter and fetches one page plus the next cursor
+func selectPage[T any](
+	entity string,
+	query *postgrest.FilterBuilder,
+	key func(T) cursor,
+	sortBy string,
+	page Page,
+) ([]T, string, error) {
+	after, err := decodeCursor(page.Cursor, sortBy)
+	if err != nil {
+		return nil, "", err
+	}
+	if after != nil {
+		query = query.Or(postgrestKeyset(after.keys()), "")
+	}
+	for _, k := range (cursor{Sort: sortBy}).keys() {
+		if k.desc {
+			query = query.Order(k.column, &newestFirst)
+		} else {
+			query = query.Order(k.column, &oldestFirst)
+		}
+	}
+	limit := page.limit()
+
+	var items []T
+	if _, err := query.Limit(limit+1, "").ExecuteTo(&items); err != nil {
+		return nil, "", supabaseError(entity, err)
+	}
+	items, next := trimPage(items, limit, key)
+	return items, next, nil
+}
+
+// GetUserByID retrieves a user by their ID from the user_accounts view, which
+// joins their profile with the admin registry and any suspension
 func (s *SupabaseService) GetUserByID(
 	ctx context.Context,
 	userID string,
 ) (*User, error) {
-	// Try to get from clients table first
-	var client Client
-	_, err := s.client.From("clients").
+	var users []User
+	_, err := s.client.From("user_accounts").
 		Select("*", "", false).
 		Eq("id", userID).
-		Single().
-		ExecuteTo(&client)
-	if err == nil {
-		return &User{
-			ID:    client.ID,
-			Email: client.Email,
-			Role:  client.Role,
-		}, nil
+		Limit(1, "").
+		ExecuteTo(&users)
+	if err != nil {
+		return nil, supabaseError("user", err)
 	}
-
-	// Try to get from veterinarians table
-	var vet Veterinarian
-	_, err = s.client.From("veterinarians").
-		Select("*", "", false).
-		Eq("id", userID).
-		Single().
-		ExecuteTo(&vet)
-	if err == nil {
-		return &User{
-			ID:    vet.ID,
-			Email: vet.Email,
-			Role:  vet.Role,
-		}, nil
+	if len(users) == 0 {
+		return nil, notFound("user")
 	}
-
-	return nil, fmt.Errorf("user not found")
+	return &users[0], nil
 }
 
 // CreateUser creates a new user profile
@@ -87,7 +193,7 @@ func (s *SupabaseService) CreateUser(ctx context.Context, user *User) error {
 // CreateClient creates a new client profile
 func (s *SupabaseService) CreateClient(ctx context.Context, client *Client) error {
 	_, _, err := s.client.From("clients").Insert(client, false, "", "", "").Execute()
-	return err
+	return supabaseError("client", err)
 }
 
 // CreateVeterinarian creates a new veterinarian profile
@@ -96,7 +202,7 @@ func (s *SupabaseService) CreateVeterinarian(
 	vet *Veterinarian,
 ) error {
 	_, _, err := s.client.From("veterinarians").Insert(vet, false, "", "", "").Execute()
-	return err
+	return supabaseError("veterinarian", err)
 }
 
 // UpdateUser updates a user profile
@@ -107,11 +213,10 @@ func (s *SupabaseService) UpdateUser(ctx context.Context, user *User) error {
 
 // UpdateClient updates a client profile
 func (s *SupabaseService) UpdateClient(ctx context.Context, client *Client) error {
-	_, _, err := s.client.From("clients").
+	return updateOne("client", s.client.From("clients").
 		Update(client, "", "").
 		Eq("id", client.ID).
-		Execute()
-	return err
+		Is("deleted_at", "null"))
 }
 
 // UpdateVeterinarian updates a veterinarian profile
@@ -119,89 +224,90 @@ func (s *SupabaseService) UpdateVeterinarian(
 	ctx context.Context,
 	vet *Veterinarian,
 ) error {
-	_, _, err := s.client.From("veterinarians").
+	return updateOne("veterinarian", s.client.From("veterinarians").
 		Update(vet, "", "").
 		Eq("id", vet.ID).
-		Execute()
-	return err
+		Is("deleted_at", "null"))
 }
 
-// DeleteUser deletes a user profile
+// DeleteUser moves a client with their pets, or a veterinarian with their
+// products, to the trash. A user with neither profile is not found.
 func (s *SupabaseService) DeleteUser(ctx context.Context, userID string) error {
-	// Try to delete from clients table first
-	_, _, err := s.client.From("clients").Delete("", "").Eq("id", userID).Execute()
-	if err == nil {
-		return nil
+	at := trashTimestamp()
+	clients, err := s.trashRows("clients", "id", []string{userID}, at)
+	if err != nil {
+		return err
 	}
-
-	// Try to delete from veterinarians table
-	_, _, err = s.client.From("veterinarians").Delete("", "").Eq("id", userID).Execute()
-	return err
+	vets, err := s.trashRows("veterinarians", "id", []string{userID}, at)
+	if err != nil {
+		return err
+	}
+	if clients+vets == 0 {
+		return notFound("user")
+	}
+	return nil
 }
 
-// ListUsers lists all users with pagination
+// ListUsers lists users with role, or all users, ordered by ID with pagination
 func (s *SupabaseService) ListUsers(
 	ctx context.Context,
-	limit, offset int,
-) ([]User, error) {
-	var users []User
-
-	// Get clients
-	var clients []Client
-	_, err := s.client.From("clients").
-		Select("*", "", false).
-		Range(offset, offset+limit-1, "").
-		ExecuteTo(&clients)
-	if err != nil {
-		return nil, err
+	role string,
+	page Page,
+) ([]User, string, error) {
+	query := s.client.From("user_accounts").Select("*", "", false)
+	if role != "" {
+		query = query.Eq("role", role)
 	}
+	return selectPage("user", query, userKey, sortByID, page)
+}
 
-	// Get veterinarians
-	var vets []Veterinarian
-	_, err = s.client.From("veterinarians").
-		Select("*", "", false).
-		Range(offset, offset+limit-1, "").
-		ExecuteTo(&vets)
-	if err != nil {
-		return nil, err
-	}
+// Admin registry and account operations
 
-	// Convert to User interface
-	for _, client := range clients {
-		users = append(users, User{
-			ID:    client.ID,
-			Email: client.Email,
-			Role:  client.Role,
-		})
-	}
+// GrantAdmin adds a user to the admin registry
+func (s *SupabaseService) GrantAdmin(ctx context.Context, grant *AdminGrant) error {
+	_, _, err := s.client.From("admins").Insert(grant, false, "", "", "").Execute()
+	return supabaseError("admin", err)
+}
 
-	for _, vet := range vets {
-		users = append(users, User{
-			ID:    vet.ID,
-			Email: vet.Email,
-			Role:  vet.Role,
-		})
+// RevokeAdmin calls the revoke_admin database function, which locks the
+// registry so that two admins demoting each other at once cannot leave none
+func (s *SupabaseService) RevokeAdmin(ctx context.Context, userID string) error {
+	body := s.client.Rpc("revoke_admin", "", map[string]any{
+		"p_user_id": userID,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("revoke_admin")
 	}
+	return nil
+}
+
+// SuspendUser suspends a user's account, replacing any earlier suspension
+func (s *SupabaseService) SuspendUser(ctx context.Context, suspension *Suspension) error {
+	_, _, err := s.client.From("user_suspensions").
+		Insert(suspension, true, "user_id", "", "").
+		Execute()
+	return supabaseError("user", err)
+}
 
-	return users, nil
+// ReactivateUser lifts a user's suspension
+func (s *SupabaseService) ReactivateUser(ctx context.Context, userID string) error {
+	return updateOne("suspension", s.client.From("user_suspensions").
+		Delete("", "").
+		Eq("user_id", userID))
 }
 
-// GetPetsByUserID retrieves all pets for a specific user
+// GetPetsByUserID retrieves a page of pets for a specific user
 func (s *SupabaseService) GetPetsByUserID(
 	ctx context.Context,
 	userID string,
-) ([]Pet, error) {
-	var pets []Pet
-
-	_, err := s.client.From("pets").
+	page Page,
+) ([]Pet, string, error) {
+	query := s.client.From("pets").
 		Select("*", "", false).
 		Eq("owner_id", userID).
-		ExecuteTo(&pets)
-	if err != nil {
-		return nil, err
-	}
-
-	return pets, err
+		Is("deleted_at", "null")
+	return selectPage("pet", query, petKey, "", page)
 }
 
 // GetPetByID retrieves a pet by ID
@@ -210,43 +316,205 @@ func (s *SupabaseService) GetPetByID(ctx context.Context, petID string) (*Pet, e
 	_, err := s.client.From("pets").
 		Select("*", "", false).
 		Eq("id", petID).
+		Is("deleted_at", "null").
 		Single().
 		ExecuteTo(&pet)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("pet", err)
 	}
 	return &pet, nil
 }
 
 // CreatePet creates a new pet
 func (s *SupabaseService) CreatePet(ctx context.Context, pet *Pet) error {
+	pet.Version = 1
 	_, _, err := s.client.From("pets").Insert(pet, false, "", "", "").Execute()
-	return err
+	return supabaseError("pet", err)
 }
 
-// UpdatePet updates an existing pet
+// UpdatePet updates an existing pet unless its version is stale
 func (s *SupabaseService) UpdatePet(ctx context.Context, pet *Pet) error {
-	_, _, err := s.client.From("pets").Update(pet, "", "").Eq("id", pet.ID).Execute()
-	return err
+	return s.updateVersioned("pet", "pets", pet.ID, &pet.Version, pet)
 }
 
-// DeletePet deletes a pet by ID
+// DeletePet moves a pet and its medical records to the trash
 func (s *SupabaseService) DeletePet(ctx context.Context, petID string) error {
-	_, _, err := s.client.From("pets").Delete("", "").Eq("id", petID).Execute()
+	_, err := s.trashRows("pets", "id", []string{petID}, trashTimestamp())
 	return err
 }
 
-// GetMedicalRecordsByPetID retrieves all medical records for a pet
+// CreatePetAccessGrant creates a new pet access grant
+func (s *SupabaseService) CreatePetAccessGrant(ctx context.Context, grant *PetAccessGrant) error {
+	if err := validatePetAccessGrant(grant); err != nil {
+		return err
+	}
+	row := storedPetAccessGrant(*grant)
+	_, _, err := s.client.From("pet_access_grants").
+		Insert(row, false, "", "", "").
+		Execute()
+	return supabaseError("pet access grant", err)
+}
+
+// GetPetAccessGrantByID retrieves a specific pet access grant
+func (s *SupabaseService) GetPetAccessGrantByID(
+	ctx context.Context,
+	grantID string,
+) (*PetAccessGrant, error) {
+	var grant PetAccessGrant
+	_, err := s.client.From("pet_access_grants").
+		Select("*", "", false).
+		Eq("id", grantID).
+		Single().
+		ExecuteTo(&grant)
+	if err != nil {
+		return nil, supabaseError("pet access grant", err)
+	}
+	return &grant, nil
+}
+
+// GetPetAccessGrants lists the grants on a pet
+func (s *SupabaseService) GetPetAccessGrants(ctx context.Context, petID string) ([]PetAccessGrant, error) {
+	return s.petAccessGrants("pet_id", petID)
+}
+
+// GetGranteePetAccessGrants lists the grants a client received
+func (s *SupabaseService) GetGranteePetAccessGrants(
+	ctx context.Context,
+	granteeID string,
+) ([]PetAccessGrant, error) {
+	return s.petAccessGrants("grantee_id", granteeID)
+}
+
+// petAccessGrants lists the grants whose column is value, oldest first
+func (s *SupabaseService) petAccessGrants(column, value string) ([]PetAccessGrant, error) {
+	grants := []PetAccessGrant{}
+	_, err := s.client.From("pet_access_grants").
+		Select("*", "", false).
+		Eq(column, value).
+		Order("created_at", &oldestFirst).
+		Order("id", &oldestFirst).
+		ExecuteTo(&grants)
+	if err != nil {
+		return nil, supabaseError("pet access grant", err)
+	}
+	return grants, nil
+}
+
+// ClaimPetAccessInvitations gives the unrevoked invitations to email to
+// clientID, one at a time so an invitation claimed meanwhile is left alone
+func (s *SupabaseService) ClaimPetAccessInvitations(
+	ctx context.Context,
+	clientID, email string,
+) error {
+	var invitations []PetAccessGrant
+	_, err := s.client.From("pet_access_grants").
+		Select("*", "", false).
+		Filter("grantee_email", "ilike", likeExactly(email)).
+		Is("grantee_id", "null").
+		Is("revoked_at", "null").
+		ExecuteTo(&invitations)
+	if err != nil {
+		return supabaseError("pet access grant", err)
+	}
+	held, err := s.GetGranteePetAccessGrants(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	pets := make(map[string]bool, len(held))
+	for _, g := range held {
+		if g.RevokedAt == nil {
+			pets[g.PetID] = true
+		}
+	}
+
+	for _, g := range invitations {
+		// ilike still treats _ as a wildcard
+		if !strings.EqualFold(g.GranteeEmail, email) || g.OwnerID == clientID || pets[g.PetID] {
+			continue
+		}
+		_, _, err := s.client.From("pet_access_grants").
+			Update(map[string]any{"grantee_id": clientID}, "", "").
+			Eq("id", g.ID).
+			Is("grantee_id", "null").
+			Execute()
+		if err != nil {
+			return supabaseError("pet access grant", err)
+		}
+		pets[g.PetID] = true
+	}
+	return nil
+}
+
+// RevokePetAccessGrant ends a pet access grant
+func (s *SupabaseService) RevokePetAccessGrant(ctx context.Context, grantID string, at time.Time) error {
+	return updateOne("pet access grant", s.client.From("pet_access_grants").
+		Update(map[string]any{"revoked_at": at}, "", "").
+		Eq("id", grantID).
+		Is("revoked_at", "null"))
+}
+
+// CreateRecordConsent creates a new record consent
+func (s *SupabaseService) CreateRecordConsent(ctx context.Context, consent *RecordConsent) error {
+	if err := validateRecordConsent(consent); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("record_consents").
+		Insert(consent, false, "", "", "").
+		Execute()
+	return supabaseError("record consent", err)
+}
+
+// GetRecordConsentByID retrieves a specific record consent
+func (s *SupabaseService) GetRecordConsentByID(
+	ctx context.Context,
+	consentID string,
+) (*RecordConsent, error) {
+	var consent RecordConsent
+	_, err := s.client.From("record_consents").
+		Select("*", "", false).
+		Eq("id", consentID).
+		Single().
+		ExecuteTo(&consent)
+	if err != nil {
+		return nil, supabaseError("record consent", err)
+	}
+	return &consent, nil
+}
+
+// GetPetRecordConsents lists the record consents on a pet
+func (s *SupabaseService) GetPetRecordConsents(ctx context.Context, petID string) ([]RecordConsent, error) {
+	consents := []RecordConsent{}
+	_, err := s.client.From("record_consents").
+		Select("*", "", false).
+		Eq("pet_id", petID).
+		Order("created_at", &oldestFirst).
+		Order("id", &oldestFirst).
+		ExecuteTo(&consents)
+	if err != nil {
+		return nil, supabaseError("record consent", err)
+	}
+	return consents, nil
+}
+
+// RevokeRecordConsent ends a record consent
+func (s *SupabaseService) RevokeRecordConsent(ctx context.Context, consentID string, at time.Time) error {
+	return updateOne("record consent", s.client.From("record_consents").
+		Update(map[string]any{"revoked_at": at}, "", "").
+		Eq("id", consentID).
+		Is("revoked_at", "null"))
+}
+
+// GetMedicalRecordsByPetID retrieves a page of medical records for a pet
 func (s *SupabaseService) GetMedicalRecordsByPetID(
 	ctx context.Context,
 	petID string,
-) ([]MedicalRecord, error) {
-	var records []MedicalRecord
-	_, err := s.client.From("medical_records").
+	page Page,
+) ([]MedicalRecord, string, error) {
+	query := s.client.From("medical_records").
 		Select("*", "", false).
 		Eq("pet_id", petID).
-		ExecuteTo(&records)
-	return records, err
+		Is("deleted_at", "null")
+	return selectPage("medical record", query, recordKey, "", page)
 }
 
 // GetMedicalRecordByID retrieves a specific medical record
@@ -258,10 +526,11 @@ func (s *SupabaseService) GetMedicalRecordByID(
 	_, err := s.client.From("medical_records").
 		Select("*", "", false).
 		Eq("id", recordID).
+		Is("deleted_at", "null").
 		Single().
 		ExecuteTo(&record)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("medical record", err)
 	}
 	return &record, nil
 }
@@ -271,33 +540,28 @@ func (s *SupabaseService) CreateMedicalRecord(
 	ctx context.Context,
 	record *MedicalRecord,
 ) error {
+	record.Version = 1
 	_, _, err := s.client.From("medical_records").
 		Insert(record, false, "", "", "").
 		Execute()
-	return err
+	return supabaseError("medical record", err)
 }
 
-// UpdateMedicalRecord updates an existing medical record
+// UpdateMedicalRecord updates an existing medical record unless its version is stale
 func (s *SupabaseService) UpdateMedicalRecord(
 	ctx context.Context,
 	record *MedicalRecord,
 ) error {
-	_, _, err := s.client.From("medical_records").
-		Update(record, "", "").
-		Eq("id", record.ID).
-		Execute()
-	return err
+	return s.updateVersioned("medical record", "medical_records", record.ID,
+		&record.Version, record)
 }
 
-// DeleteMedicalRecord deletes a medical record by ID
+// DeleteMedicalRecord moves a medical record to the trash
 func (s *SupabaseService) DeleteMedicalRecord(
 	ctx context.Context,
 	recordID string,
 ) error {
-	_, _, err := s.client.From("medical_records").
-		Delete("", "").
-		Eq("id", recordID).
-		Execute()
+	_, err := s.trashRows("medical_records", "id", []string{recordID}, trashTimestamp())
 	return err
 }
 
@@ -310,14 +574,48 @@ func (s *SupabaseService) GetClientByID(
 	_, err := s.client.From("clients").
 		Select("*", "", false).
 		Eq("id", clientID).
+		Is("deleted_at", "null").
 		Single().
 		ExecuteTo(&client)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("client", err)
 	}
 	return &client, nil
 }
 
+// likeExactly strips the wildcards PostgREST maps to %, so that ilike with
+// the result is a case-insensitive equality check apart from _
+func likeExactly(value string) string {
+	return strings.NewReplacer("*", "", "%", "").Replace(value)
+}
+
+// GetClientByEmail retrieves a client by email
+func (s *SupabaseService) GetClientByEmail(ctx context.Context, email string) (*Client, error) {
+	var clients []Client
+	_, err := s.client.From("clients").
+		Select("*", "", false).
+		Filter("email", "ilike", likeExactly(email)).
+		Is("deleted_at", "null").
+		ExecuteTo(&clients)
+	if err != nil {
+		return nil, supabaseError("client", err)
+	}
+	var found *Client
+	for i, c := range clients {
+		// ilike still treats _ as a wildcard
+		if email == "" || !strings.EqualFold(c.Email, email) {
+			continue
+		}
+		if found == nil || c.Email == email {
+			found = &clients[i]
+		}
+	}
+	if found == nil {
+		return nil, notFound("client")
+	}
+	return found, nil
+}
+
 // GetVeterinarianByID retrieves a veterinarian by ID
 func (s *SupabaseService) GetVeterinarianByID(
 	ctx context.Context,
@@ -327,10 +625,11 @@ func (s *SupabaseService) GetVeterinarianByID(
 	_, err := s.client.From("veterinarians").
 		Select("*", "", false).
 		Eq("id", vetID).
+		Is("deleted_at", "null").
 		Single().
 		ExecuteTo(&vet)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("veterinarian", err)
 	}
 	return &vet, nil
 }
@@ -354,10 +653,12 @@ func (s *SupabaseService) GetQRCodeByPetID(
 		Select("*", "", false).
 		Eq("pet_id", petID).
 		Eq("is_active", "true").
+		Order("created_at", &newestFirst).
+		Limit(1, "").
 		Single().
 		ExecuteTo(&qrCode)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("qr code", err)
 	}
 	return &qrCode, nil
 }
@@ -367,15 +668,19 @@ func (s *SupabaseService) GetQRCodeByPublicURL(
 	ctx context.Context,
 	publicURL string,
 ) (*QRCode, error) {
+	// The inner join on pets drops codes whose pet is in the trash
 	var qrCode QRCode
 	_, err := s.client.From("qr_codes").
-		Select("*", "", false).
+		Select("*,pets!inner(id)", "", false).
 		Eq("public_url", publicURL).
 		Eq("is_active", "true").
+		Is("pets.deleted_at", "null").
+		Order("created_at", &newestFirst).
+		Limit(1, "").
 		Single().
 		ExecuteTo(&qrCode)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("qr code", err)
 	}
 	return &qrCode, nil
 }
@@ -383,16 +688,14 @@ func (s *SupabaseService) GetQRCodeByPublicURL(
 // CreateQRCode creates a new QR code
 func (s *SupabaseService) CreateQRCode(ctx context.Context, qrCode *QRCode) error {
 	_, _, err := s.client.From("qr_codes").Insert(qrCode, false, "", "", "").Execute()
-	return err
+	return supabaseError("qr code", err)
 }
 
 // UpdateQRCode updates an existing QR code
 func (s *SupabaseService) UpdateQRCode(ctx context.Context, qrCode *QRCode) error {
-	_, _, err := s.client.From("qr_codes").
+	return updateOne("qr code", s.client.From("qr_codes").
 		Update(qrCode, "", "").
-		Eq("id", qrCode.ID).
-		Execute()
-	return err
+		Eq("id", qrCode.ID))
 }
 
 // DeleteQRCode deletes a QR code by ID
@@ -411,10 +714,12 @@ func (s *SupabaseService) GetPublicPetProfile(
 		Select("*", "", false).
 		Eq("public_url", publicURL).
 		Eq("is_active", "true").
+		Order("created_at", &newestFirst).
+		Limit(1, "").
 		Single().
 		ExecuteTo(&qrCode)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("qr code", err)
 	}
 
 	// Convert to public profile
@@ -423,10 +728,11 @@ func (s *SupabaseService) GetPublicPetProfile(
 	_, err = s.client.From("pets").
 		Select("*", "", false).
 		Eq("id", qrCode.PetID).
+		Is("deleted_at", "null").
 		Single().
 		ExecuteTo(&pet)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("pet", err)
 	}
 
 	// Fetch medical records and project to public-friendly shape
@@ -434,6 +740,9 @@ func (s *SupabaseService) GetPublicPetProfile(
 	_, err = s.client.From("medical_records").
 		Select("*", "", false).
 		Eq("pet_id", qrCode.PetID).
+		Is("deleted_at", "null").
+		Order("created_at", &oldestFirst).
+		Order("id", &oldestFirst).
 		ExecuteTo(&records)
 	if err != nil {
 		return nil, err
@@ -469,30 +778,28 @@ func (s *SupabaseService) GetPublicPetProfile(
 
 // Appointment operations
 
-// GetAppointmentsByClientID retrieves appointments for a client
+// GetAppointmentsByClientID retrieves a page of appointments for a client
 func (s *SupabaseService) GetAppointmentsByClientID(
 	ctx context.Context,
 	clientID string,
-) ([]Appointment, error) {
-	var appointments []Appointment
-	_, err := s.client.From("appointments").
+	page Page,
+) ([]Appointment, string, error) {
+	query := s.client.From("appointments").
 		Select("*", "", false).
-		Eq("client_id", clientID).
-		ExecuteTo(&appointments)
-	return appointments, err
+		Eq("client_id", clientID)
+	return selectPage("appointment", query, appointmentKey, "", page)
 }
 
-// GetAppointmentsByVeterinarianID retrieves appointments for a veterinarian
+// GetAppointmentsByVeterinarianID retrieves a page of appointments for a veterinarian
 func (s *SupabaseService) GetAppointmentsByVeterinarianID(
 	ctx context.Context,
 	vetID string,
-) ([]Appointment, error) {
-	var appointments []Appointment
-	_, err := s.client.From("appointments").
+	page Page,
+) ([]Appointment, string, error) {
+	query := s.client.From("appointments").
 		Select("*", "", false).
-		Eq("veterinarian_id", vetID).
-		ExecuteTo(&appointments)
-	return appointments, err
+		Eq("veterinarian_id", vetID)
+	return selectPage("appointment", query, appointmentKey, "", page)
 }
 
 // GetAppointmentByID retrieves a specific appointment
@@ -507,32 +814,56 @@ func (s *SupabaseService) GetAppointmentByID(
 		Single().
 		ExecuteTo(&appointment)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("appointment", err)
 	}
 	return &appointment, nil
 }
 
+// HasPetAppointment reports whether a veterinarian had an appointment for a
+// pet from since that took place by now
+func (s *SupabaseService) HasPetAppointment(
+	ctx context.Context,
+	petID, vetID string,
+	since, now time.Time,
+) (bool, error) {
+	var appointments []Appointment
+	_, err := s.client.From("appointments").
+		Select("status,appointment_date", "", false).
+		Eq("pet_id", petID).
+		Eq("veterinarian_id", vetID).
+		Gte("appointment_date", since.UTC().Format(time.RFC3339Nano)).
+		Neq("status", "cancelled").
+		ExecuteTo(&appointments)
+	if err != nil {
+		return false, supabaseError("appointment", err)
+	}
+	for _, a := range appointments {
+		if a.tookPlace(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // CreateAppointment creates a new appointment
 func (s *SupabaseService) CreateAppointment(
 	ctx context.Context,
 	appointment *Appointment,
 ) error {
+	appointment.Version = 1
 	_, _, err := s.client.From("appointments").
 		Insert(appointment, false, "", "", "").
 		Execute()
-	return err
+	return supabaseError("appointment", err)
 }
 
-// UpdateAppointment updates an existing appointment
+// UpdateAppointment updates an existing appointment unless its version is stale
 func (s *SupabaseService) UpdateAppointment(
 	ctx context.Context,
 	appointment *Appointment,
 ) error {
-	_, _, err := s.client.From("appointments").
-		Update(appointment, "", "").
-		Eq("id", appointment.ID).
-		Execute()
-	return err
+	return s.updateVersioned("appointment", "appointments", appointment.ID,
+		&appointment.Version, appointment)
 }
 
 // DeleteAppointment deletes an appointment by ID
@@ -553,45 +884,18 @@ func (s *SupabaseService) GetAvailableAppointmentSlots(
 	vetID string,
 	date time.Time,
 ) ([]TimeSlot, error) {
-	// Interpret working hours in clinic timezone (Asia/Singapore)
-	loc, _ := time.LoadLocation("Asia/Singapore")
-
 	// Fetch veterinarian working hours
 	vet, err := s.GetVeterinarianByID(ctx, vetID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Determine windows for the requested day
-	weekdayKey := weekdayToKey(date.Weekday())
-	type window struct {
-		start time.Time
-		end   time.Time
-	}
-	var windows []window
-	for _, wh := range vet.AvailableHours {
-		if normalizeDayKey(wh.DayOfWeek) != weekdayKey {
-			continue
-		}
-		startParsed, err1 := time.Parse("15:04", wh.Start)
-		endParsed, err2 := time.Parse("15:04", wh.End)
-		if err1 != nil || err2 != nil {
-			continue
-		}
-		ws := time.Date(date.Year(), date.Month(), date.Day(), startParsed.Hour(), startParsed.Minute(), 0, 0, loc)
-		we := time.Date(date.Year(), date.Month(), date.Day(), endParsed.Hour(), endParsed.Minute(), 0, 0, loc)
-		if we.After(ws) {
-			windows = append(windows, window{start: ws, end: we})
-		}
-	}
-
-	if len(windows) == 0 {
+	if len(workingWindows(vet, date)) == 0 {
 		return []TimeSlot{}, nil
 	}
 
 	// Fetch existing appointments for that day
-	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
-	endOfDay := startOfDay.Add(24 * time.Hour)
+	startOfDay, endOfDay := clinicDayBounds(date)
 
 	var appts []Appointment
 	_, err = s.client.From("appointments").
@@ -604,97 +908,60 @@ func (s *SupabaseService) GetAvailableAppointmentSlots(
 		return nil, err
 	}
 
-	// Ignore cancelled appointments
-	activeAppts := make([]Appointment, 0, len(appts))
-	for _, a := range appts {
-		if a.Status != "cancelled" {
-			activeAppts = append(activeAppts, a)
-		}
-	}
+	return buildTimeSlots(vet, appts, date), nil
+}
 
-	// Build 30-minute slots within the windows and mark as available if no overlap
-	const slotMinutes = 30
-	var slots []TimeSlot
-	for _, win := range windows {
-		for ts := win.start; ts.Add(time.Duration(slotMinutes)*time.Minute).Before(win.end) || ts.Add(time.Duration(slotMinutes)*time.Minute).Equal(win.end); ts = ts.Add(time.Duration(slotMinutes) * time.Minute) {
-			te := ts.Add(time.Duration(slotMinutes) * time.Minute)
-			available := true
-			for _, a := range activeAppts {
-				as := a.AppointmentDate
-				ae := as.Add(time.Duration(a.DurationMinutes) * time.Minute)
-				if intervalsOverlap(ts, te, as, ae) {
-					available = false
-					break
-				}
-			}
-			slots = append(slots, TimeSlot{StartTime: ts, EndTime: te, Available: available})
-		}
-	}
+// Product operations
 
-	return slots, nil
+// productRow is how a product is stored: its price in major units in a
+// decimal column, with the currency in a column of its own
+type productRow struct {
+	Product
+	Price    float64 `json:"price"`
+	Currency string  `json:"currency"`
 }
 
-// intervalsOverlap returns true if [s1,e1) overlaps [s2,e2)
-func intervalsOverlap(s1, e1, s2, e2 time.Time) bool {
-	return s1.Before(e2) && s2.Before(e1)
+func newProductRow(p *Product) productRow {
+	return productRow{Product: *p, Price: p.Price.Major(), Currency: p.Price.currencyOrDefault()}
 }
 
-// weekdayToKey returns canonical three-letter weekday key
-func weekdayToKey(w time.Weekday) string {
-	switch w {
-	case time.Monday:
-		return "Mon"
-	case time.Tuesday:
-		return "Tue"
-	case time.Wednesday:
-		return "Wed"
-	case time.Thursday:
-		return "Thu"
-	case time.Friday:
-		return "Fri"
-	case time.Saturday:
-		return "Sat"
-	default:
-		return "Sun"
-	}
-}
-
-// normalizeDayKey maps arbitrary inputs to canonical three-letter weekday key
-func normalizeDayKey(s string) string {
-	switch s {
-	case "Mon", "Monday", "monday", "mon":
-		return "Mon"
-	case "Tue", "Tues", "Tuesday", "tuesday", "tue", "tues":
-		return "Tue"
-	case "Wed", "Wednesday", "wednesday", "wed":
-		return "Wed"
-	case "Thu", "Thur", "Thurs", "Thursday", "thursday", "thu", "thur", "thurs":
-		return "Thu"
-	case "Fri", "Friday", "friday", "fri":
-		return "Fri"
-	case "Sat", "Saturday", "saturday", "sat":
-		return "Sat"
-	case "Sun", "Sunday", "sunday", "sun":
-		return "Sun"
-	default:
-		return s
-	}
+func (r productRow) product() Product {
+	p := r.Product
+	p.Price = MoneyFromMajor(r.Price, r.Currency)
+	return p
 }
 
-// Product operations
+// selectProducts runs selectPage over stored products
+func selectProducts(
+	query *postgrest.FilterBuilder,
+	key func(Product) cursor,
+	sortBy string,
+	page Page,
+) ([]Product, string, error) {
+	rows, next, err := selectPage("product", query,
+		func(r productRow) cursor { return key(r.product()) }, sortBy, page)
+	if err != nil {
+		return nil, "", err
+	}
+	products := make([]Product, len(rows))
+	for i, r := range rows {
+		products[i] = r.product()
+	}
+	return products, next, nil
+}
 
-// GetProductsByVeterinarianID retrieves products for a veterinarian
+// GetProductsByVeterinarianID retrieves a page of active products for a veterinarian
 func (s *SupabaseService) GetProductsByVeterinarianID(
 	ctx context.Context,
 	vetID string,
-) ([]Product, error) {
-	var products []Product
-	_, err := s.client.From("products").
+	page Page,
+) ([]Product, string, error) {
+	query := s.client.From("products").
 		Select("*", "", false).
 		Eq("veterinarian_id", vetID).
 		Eq("is_active", "true").
-		ExecuteTo(&products)
-	return products, err
+		Is("deleted_at", "null")
+	return selectProducts(query, createdProductKey, "", page)
 }
 
 // GetProductByID retrieves a specific product
@@ -702,106 +969,287 @@ func (s *SupabaseService) GetProductByID(
 	ctx context.Context,
 	productID string,
 ) (*Product, error) {
-	var product Product
+	var row productRow
 	_, err := s.client.From("products").
 		Select("*", "", false).
 		Eq("id", productID).
+		Is("deleted_at", "null").
 		Single().
-		ExecuteTo(&product)
+		ExecuteTo(&row)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("product", err)
 	}
+	product := row.product()
 	return &product, nil
 }
 
-// CreateProduct creates a new product
+// CreateProduct creates a new product and records its opening stock
 func (s *SupabaseService) CreateProduct(ctx context.Context, product *Product) error {
-	_, _, err := s.client.From("products").Insert(product, false, "", "", "").Execute()
-	return err
+	product.Version = 1
+	_, _, err := s.client.From("products").
+		Insert(newProductRow(product), false, "", "", "").
+		Execute()
+	if err != nil || product.StockQuantity == 0 {
+		return supabaseError("product", err)
+	}
+	_, _, err = s.client.From("stock_movements").
+		Insert(openingMovement(product), false, "", "minimal", "").
+		Execute()
+	return supabaseError("stock movement", err)
 }
 
-// UpdateProduct updates an existing product
+// UpdateProduct updates an existing product unless its version is stale.
+// Stock is left out; it only changes through stock movements.
 func (s *SupabaseService) UpdateProduct(ctx context.Context, product *Product) error {
-	_, _, err := s.client.From("products").
-		Update(product, "", "").
-		Eq("id", product.ID).
-		Execute()
-	return err
+	values := struct {
+		productRow
+		StockQuantity *int `json:"stock_quantity,omitempty"`
+	}{productRow: newProductRow(product)}
+	return s.updateVersioned("product", "products", product.ID, &product.Version, values)
 }
 
-// DeleteProduct deletes a product by ID
+// UpdateProductWithStock calls the update_product_with_stock database
+// function, which saves the product and adjusts its stock to
+// product.StockQuantity inside a single Postgres transaction
+func (s *SupabaseService) UpdateProductWithStock(
+	ctx context.Context,
+	product *Product,
+	adjustment *StockMovement,
+) error {
+	if product.StockQuantity < 0 {
+		return fmt.Errorf("%w: stock cannot be negative", ErrInvalidStockMovement)
+	}
+
+	body := s.client.Rpc("update_product_with_stock", "", map[string]any{
+		"p_product":  newProductRow(product),
+		"p_movement": adjustment,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("update_product_with_stock")
+	}
+
+	var result struct {
+		Version  int            `json:"version"`
+		Movement *StockMovement `json:"movement"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		return fmt.Errorf("update_product_with_stock: unexpected response: %w", err)
+	}
+	product.Version = result.Version
+	adjustment.ProductID = product.ID
+	adjustment.Type = StockAdjustment
+	adjustment.Quantity = 0
+	if result.Movement != nil {
+		adjustment.Quantity = result.Movement.Quantity
+		adjustment.BalanceAfter = result.Movement.BalanceAfter
+	}
+	return nil
+}
+
+// DeleteProduct deactivates a product and moves it to the trash
 func (s *SupabaseService) DeleteProduct(ctx context.Context, productID string) error {
-	_, _, err := s.client.From("products").Delete("", "").Eq("id", productID).Execute()
+	_, err := s.trashRows("products", "id", []string{productID}, trashTimestamp())
 	return err
 }
 
-// ListProducts retrieves products with filtering
+// ListProducts retrieves active products with filtering, sorting and a total count
 func (s *SupabaseService) ListProducts(
 	ctx context.Context,
 	filters ProductFilters,
-) ([]Product, error) {
-	var products []Product
+	page Page,
+) (*ProductPage, error) {
+	filter := func(query *postgrest.FilterBuilder) *postgrest.FilterBuilder {
+		query = query.Eq("is_active", "true").Is("deleted_at", "null")
+		if filters.Category != "" {
+			query = query.Eq("category", filters.Category)
+		}
+		if filters.VeterinarianID != "" {
+			query = query.Eq("veterinarian_id", filters.VeterinarianID)
+		}
+		if filters.Brand != "" {
+			query = query.Filter("brand", "ilike", likeExactly(filters.Brand))
+		}
+
+		// Both bounds filter the same column, so they must go through one and=()
+		// parameter; separate Gte/Lte calls would overwrite each other
+		var priceRange []string
+		if filters.MinPrice.Amount > 0 {
+			priceRange = append(priceRange, "price.gte."+filters.MinPrice.Decimal())
+		}
+		if filters.MaxPrice.Amount > 0 {
+			priceRange = append(priceRange, "price.lte."+filters.MaxPrice.Decimal())
+		}
+		if len(priceRange) > 0 {
+			query = query.And(strings.Join(priceRange, ","), "")
+		}
+
+		if terms := searchTerms(filters.Search); len(terms) > 0 {
+			query = query.TextSearch("search_vector", prefixTSQuery(terms), "simple", "")
+		}
+		return query
+	}
 
-	query := s.client.From("products").Select("*", "", false).Eq("is_active", "true")
+	// The cursor narrows the page query, so the total is counted separately
+	_, total, err := filter(s.client.From("products").Select("id", "exact", true)).Execute()
+	if err != nil {
+		return nil, supabaseError("product", err)
+	}
 
-	if filters.Category != "" {
-		query = query.Eq("category", filters.Category)
+	products, next, err := selectProducts(
+		filter(s.client.From("products").Select("*", "", false)),
+		func(p Product) cursor { return productKey(p, filters.Sort) }, filters.Sort, page)
+	if err != nil {
+		return nil, err
 	}
-	if filters.VeterinarianID != "" {
-		query = query.Eq("veterinarian_id", filters.VeterinarianID)
+	return &ProductPage{Products: products, NextCursor: next, Total: int(total)}, nil
+}
+
+// Stock ledger operations
+
+// RecordStockMovement calls the record_stock_movement database function, which
+// applies the movement to the product's stock and appends it to the ledger
+// inside a single Postgres transaction
+func (s *SupabaseService) RecordStockMovement(
+	ctx context.Context,
+	movement *StockMovement,
+) error {
+	if err := validateStockMovement(movement); err != nil {
+		return err
 	}
 
-	// Use Range for pagination like other methods in this file
-	if filters.Limit > 0 && filters.Offset >= 0 {
-		query = query.Range(filters.Offset, filters.Offset+filters.Limit-1, "")
+	body := s.client.Rpc("record_stock_movement", "", map[string]any{
+		"p_movement": movement,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("record_stock_movement")
 	}
 
-	_, err := query.ExecuteTo(&products)
-	return products, err
+	var recorded StockMovement
+	if err := json.Unmarshal([]byte(body), &recorded); err != nil {
+		return fmt.Errorf("record_stock_movement: unexpected response: %w", err)
+	}
+	movement.BalanceAfter = recorded.BalanceAfter
+	return nil
 }
 
-// UpdateProductStock updates product stock quantity
-func (s *SupabaseService) UpdateProductStock(
+// ListStockMovements retrieves a page of a product's stock movements, newest first
+func (s *SupabaseService) ListStockMovements(
 	ctx context.Context,
 	productID string,
-	quantity int,
-) error {
-	updateData := map[string]any{
-		"stock_quantity": quantity,
+	page Page,
+) ([]StockMovement, string, error) {
+	if _, err := s.GetProductByID(ctx, productID); err != nil {
+		return nil, "", err
 	}
-	_, _, err := s.client.From("products").
-		Update(updateData, "", "").
-		Eq("id", productID).
-		Execute()
-	return err
+	query := s.client.From("stock_movements").
+		Select("*", "", false).
+		Eq("product_id", productID)
+	return selectPage("stock movement", query, stockMovementKey, sortByNewest, page)
 }
 
 // Order operations
 
-// GetOrdersByClientID retrieves orders for a client
+// orderRow is how an order is stored: its total, tax and discount in major
+// units in decimal columns, with the currency in a column of its own. Tax
+// lines and discounts are JSONB columns and decode as they are.
+type orderRow struct {
+	Order
+	TotalAmount    float64 `json:"total_amount"`
+	TaxAmount      float64 `json:"tax_amount"`
+	DiscountAmount float64 `json:"discount_amount"`
+	DiscountCode   *string `json:"discount_code"`
+	Currency       string  `json:"currency"`
+}
+
+func newOrderRow(o *Order) orderRow {
+	row := orderRow{
+		Order:          *o,
+		TotalAmount:    o.TotalAmount.Major(),
+		TaxAmount:      o.TaxAmount.Major(),
+		DiscountAmount: o.DiscountAmount.Major(),
+		Currency:       o.TotalAmount.currencyOrDefault(),
+	}
+	row.TaxLines = taxLinesJSON(o.TaxLines)
+	row.Discounts = discountsJSON(o.Discounts)
+	if code := NormalizePromotionCode(o.DiscountCode); code != "" {
+		row.DiscountCode = &code
+	}
+	return row
+}
+
+func (r orderRow) order() Order {
+	o := r.Order
+	o.TotalAmount = MoneyFromMajor(r.TotalAmount, r.Currency)
+	o.TaxAmount = MoneyFromMajor(r.TaxAmount, r.Currency)
+	o.DiscountAmount = MoneyFromMajor(r.DiscountAmount, r.Currency)
+	if r.DiscountCode != nil {
+		o.DiscountCode = *r.DiscountCode
+	}
+	return o
+}
+
+// orderItemRow is how an order item is stored, like orderRow
+type orderItemRow struct {
+	OrderItem
+	UnitPrice  float64 `json:"unit_price"`
+	TotalPrice float64 `json:"total_price"`
+	Currency   string  `json:"currency"`
+}
+
+func newOrderItemRow(it *OrderItem) orderItemRow {
+	return orderItemRow{
+		OrderItem:  *it,
+		UnitPrice:  it.UnitPrice.Major(),
+		TotalPrice: it.TotalPrice.Major(),
+		Currency:   it.UnitPrice.currencyOrDefault(),
+	}
+}
+
+func (r orderItemRow) orderItem() OrderItem {
+	it := r.OrderItem
+	it.UnitPrice = MoneyFromMajor(r.UnitPrice, r.Currency)
+	it.TotalPrice = MoneyFromMajor(r.TotalPrice, r.Currency)
+	return it
+}
+
+// selectOrders runs selectPage over stored orders
+func selectOrders(query *postgrest.FilterBuilder, page Page) ([]Order, string, error) {
+	rows, next, err := selectPage("order", query,
+		func(r orderRow) cursor { return orderKey(r.order()) }, "", page)
+	if err != nil {
+		return nil, "", err
+	}
+	orders := make([]Order, len(rows))
+	for i, r := range rows {
+		orders[i] = r.order()
+	}
+	return orders, next, nil
+}
+
+// GetOrdersByClientID retrieves a page of orders for a client
 func (s *SupabaseService) GetOrdersByClientID(
 	ctx context.Context,
 	clientID string,
-) ([]Order, error) {
-	var orders []Order
-	_, err := s.client.From("orders").
+	page Page,
+) ([]Order, string, error) {
+	query := s.client.From("orders").
 		Select("*", "", false).
-		Eq("client_id", clientID).
-		ExecuteTo(&orders)
-	return orders, err
+		Eq("client_id", clientID)
+	return selectOrders(query, page)
 }
 
-// GetOrdersByVeterinarianID retrieves orders for a veterinarian
+// GetOrdersByVeterinarianID retrieves a page of orders for a veterinarian
 func (s *SupabaseService) GetOrdersByVeterinarianID(
 	ctx context.Context,
 	vetID string,
-) ([]Order, error) {
-	var orders []Order
-	_, err := s.client.From("orders").
+	page Page,
+) ([]Order, string, error) {
+	query := s.client.From("orders").
 		Select("*", "", false).
-		Eq("veterinarian_id", vetID).
-		ExecuteTo(&orders)
-	return orders, err
+		Eq("veterinarian_id", vetID)
+	return selectOrders(query, page)
 }
 
 // GetOrderByID retrieves a specific order
@@ -809,38 +1257,62 @@ func (s *SupabaseService) GetOrderByID(
 	ctx context.Context,
 	orderID string,
 ) (*Order, error) {
-	var order Order
+	var row orderRow
 	_, err := s.client.From("orders").
 		Select("*", "", false).
 		Eq("id", orderID).
 		Single().
-		ExecuteTo(&order)
+		ExecuteTo(&row)
 	if err != nil {
-		return nil, err
+		return nil, supabaseError("order", err)
 	}
+	order := row.order()
 	return &order, nil
 }
 
 // CreateOrder creates a new order
 func (s *SupabaseService) CreateOrder(ctx context.Context, order *Order) error {
-	_, _, err := s.client.From("orders").Insert(order, false, "", "", "").Execute()
-	return err
+	_, _, err := s.client.From("orders").Insert(newOrderRow(order), false, "", "", "").Execute()
+	return supabaseError("order", err)
+}
+
+// TransitionOrder calls the transition_order database function, which moves
+// the order, records the change and restocks a cancelled order's items
+// inside a single Postgres transaction
+func (s *SupabaseService) TransitionOrder(ctx context.Context, change *OrderStatusChange) error {
+	if err := validateOrderTransition(change); err != nil {
+		return err
+	}
+
+	body := s.client.Rpc("transition_order", "", map[string]any{
+		"p_change": change,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("transition_order")
+	}
+	return nil
 }
 
-// UpdateOrderStatus updates the status of an order
-func (s *SupabaseService) UpdateOrderStatus(
+// GetOrderStatusHistory lists an order's status changes, oldest first
+func (s *SupabaseService) GetOrderStatusHistory(
 	ctx context.Context,
 	orderID string,
-	status string,
-) error {
-	updateData := map[string]any{
-		"status": status,
+) ([]OrderStatusChange, error) {
+	if _, err := s.GetOrderByID(ctx, orderID); err != nil {
+		return nil, err
 	}
-	_, _, err := s.client.From("orders").
-		Update(updateData, "", "").
-		Eq("id", orderID).
-		Execute()
-	return err
+	var history []OrderStatusChange
+	_, err := s.client.From("order_status_history").
+		Select("*", "", false).
+		Eq("order_id", orderID).
+		Order("created_at", &oldestFirst).
+		Order("id", &oldestFirst).
+		ExecuteTo(&history)
+	if err != nil {
+		return nil, supabaseError("order status change", err)
+	}
+	return history, nil
 }
 
 // GetOrderItems retrieves items for an order
@@ -848,16 +1320,1152 @@ func (s *SupabaseService) GetOrderItems(
 	ctx context.Context,
 	orderID string,
 ) ([]OrderItem, error) {
-	var items []OrderItem
+	var rows []orderItemRow
 	_, err := s.client.From("order_items").
 		Select("*", "", false).
 		Eq("order_id", orderID).
-		ExecuteTo(&items)
-	return items, err
+		Order("created_at", &oldestFirst).
+		Order("id", &oldestFirst).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]OrderItem, len(rows))
+	for i, r := range rows {
+		items[i] = r.orderItem()
+	}
+	return items, nil
 }
 
 // CreateOrderItem creates a new order item
 func (s *SupabaseService) CreateOrderItem(ctx context.Context, item *OrderItem) error {
-	_, _, err := s.client.From("order_items").Insert(item, false, "", "", "").Execute()
-	return err
+	_, _, err := s.client.From("order_items").
+		Insert(newOrderItemRow(item), false, "", "", "").
+		Execute()
+	return supabaseError("order item", err)
+}
+
+// rpcError is the error body PostgREST returns when an RPC raises
+type rpcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details"`
+}
+
+// storeError maps the error codes raised by the database functions onto the
+// store's errors
+func (e rpcError) storeError(function string) error {
+	switch e.Code {
+	case "PS001": // insufficient stock, details carry the numbers
+		stockErr := &InsufficientStockError{}
+		var details struct {
+			ProductID string `json:"product_id"`
+			Requested int    `json:"requested"`
+			Available int    `json:"available"`
+		}
+		if json.Unmarshal([]byte(e.Details), &details) == nil {
+			stockErr.ProductID = details.ProductID
+			stockErr.Requested = details.Requested
+			stockErr.Available = details.Available
+		}
+		return stockErr
+	case "PS002":
+		return fmt.Errorf("%w: %s", ErrInvalidOrder, e.Message)
+	case "PS003":
+		return fmt.Errorf("%s: %w", e.Message, ErrReservationClosed)
+	case "PS004":
+		return fmt.Errorf("%s: %w", e.Message, ErrPaymentTransition)
+	case "PS005":
+		return fmt.Errorf("%s: %w", e.Message, ErrOrderTransition)
+	case "PS006":
+		return fmt.Errorf("%w: %s", ErrInvalidPayment, e.Message)
+	case "PS007":
+		return fmt.Errorf("%w: %s", ErrInvalidReturn, e.Message)
+	case "PS008":
+		return fmt.Errorf("%s: %w", e.Message, ErrReturnTransition)
+	case "PS009":
+		return fmt.Errorf("%w: %s", ErrPromotionUnavailable, e.Message)
+	case "PS010":
+		return ErrLastAdmin
+	case "PS011":
+		return fmt.Errorf("%s %w", e.Message, ErrVersionConflict)
+	case "PS012":
+		return fmt.Errorf("%s: %w", e.Message, ErrOrderPaid)
+	case "P0002":
+		return fmt.Errorf("%s: %w", e.Message, ErrNotFound)
+	case "23505": // unique_violation
+		return fmt.Errorf("%s: %w", e.Message, ErrConflict)
+	case "23503": // foreign_key_violation
+		return fmt.Errorf("%s: %w", e.Message, ErrNotFound)
+	default:
+		return fmt.Errorf("%s: (%s) %s", function, e.Code, e.Message)
+	}
+}
+
+// PlaceOrder calls the place_order database function, which inserts the order
+// and its items and decrements stock inside a single Postgres transaction
+func (s *SupabaseService) PlaceOrder(ctx context.Context, order *Order, items []OrderItem) error {
+	if err := validateOrderPlacement(order, items); err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].OrderID = order.ID
+	}
+
+	body := s.client.Rpc("place_order", "", map[string]any{
+		"p_order": newOrderRow(order),
+		"p_items": items,
+	})
+
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("place_order")
+	}
+
+	var placed placedOrder
+	if err := json.Unmarshal([]byte(body), &placed); err != nil {
+		return fmt.Errorf("place_order: unexpected response: %w", err)
+	}
+	placed.apply(order, items)
+	return nil
+}
+
+// placedOrder is what place_order returns on success: the priced line items,
+// the order total, its tax and discount, in major units of the products'
+// currency, and the tax lines and discounts
+type placedOrder struct {
+	TotalAmount    float64         `json:"total_amount"`
+	TaxAmount      float64         `json:"tax_amount"`
+	TaxInclusive   bool            `json:"tax_inclusive"`
+	TaxLines       []TaxLine       `json:"tax_lines"`
+	DiscountAmount float64         `json:"discount_amount"`
+	Discounts      []OrderDiscount `json:"discounts"`
+	Currency       string          `json:"currency"`
+	Items          []struct {
+		ID         string  `json:"id"`
+		UnitPrice  float64 `json:"unit_price"`
+		TotalPrice float64 `json:"total_price"`
+	} `json:"items"`
+}
+
+// apply copies the prices the database charged onto order and items
+func (p placedOrder) apply(order *Order, items []OrderItem) {
+	prices := make(map[string]int, len(p.Items))
+	for i, it := range p.Items {
+		prices[it.ID] = i
+	}
+	for i := range items {
+		if j, ok := prices[items[i].ID]; ok {
+			items[i].UnitPrice = MoneyFromMajor(p.Items[j].UnitPrice, p.Currency)
+			items[i].TotalPrice = MoneyFromMajor(p.Items[j].TotalPrice, p.Currency)
+		}
+	}
+	order.TotalAmount = MoneyFromMajor(p.TotalAmount, p.Currency)
+	order.TaxAmount = MoneyFromMajor(p.TaxAmount, p.Currency)
+	order.TaxInclusive = p.TaxInclusive
+	order.TaxLines = taxLinesJSON(p.TaxLines)
+	order.DiscountCode = NormalizePromotionCode(order.DiscountCode)
+	order.DiscountAmount = MoneyFromMajor(p.DiscountAmount, p.Currency)
+	order.Discounts = discountsJSON(p.Discounts)
+}
+
+// Reservation operations
+
+// CreateReservation calls the create_reservation database function, which
+// checks availability and inserts the reservation inside a single Postgres
+// transaction
+func (s *SupabaseService) CreateReservation(ctx context.Context, reservation *Reservation) error {
+	if err := validateReservation(reservation); err != nil {
+		return err
+	}
+
+	body := s.client.Rpc("create_reservation", "", map[string]any{
+		"p_reservation": reservation,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("create_reservation")
+	}
+	return nil
+}
+
+// GetReservationByID retrieves a specific reservation
+func (s *SupabaseService) GetReservationByID(
+	ctx context.Context,
+	reservationID string,
+) (*Reservation, error) {
+	var reservation Reservation
+	_, err := s.client.From("reservations").
+		Select("*", "", false).
+		Eq("id", reservationID).
+		Single().
+		ExecuteTo(&reservation)
+	if err != nil {
+		return nil, supabaseError("reservation", err)
+	}
+	return &reservation, nil
+}
+
+// ReleaseReservation gives the stock a reservation holds back before it expires
+func (s *SupabaseService) ReleaseReservation(ctx context.Context, reservationID string) error {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	err := updateOne("reservation", s.client.From("reservations").
+		Update(map[string]any{"status": ReservationReleased, "updated_at": now}, "", "").
+		Eq("id", reservationID).
+		Eq("status", ReservationActive).
+		Gt("expires_at", now))
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	_, count, err := s.client.From("reservations").
+		Select("id", "exact", true).
+		Eq("id", reservationID).
+		Execute()
+	if err != nil {
+		return supabaseError("reservation", err)
+	}
+	if count == 0 {
+		return notFound("reservation")
+	}
+	return fmt.Errorf("reservation %s: %w", reservationID, ErrReservationClosed)
+}
+
+// ConfirmReservation splits the reservation's items into one order per
+// veterinarian and calls the confirm_reservation database function, which
+// converts the reservation and places every order inside a single Postgres
+// transaction
+func (s *SupabaseService) ConfirmReservation(
+	ctx context.Context,
+	reservationID string,
+	template *Order,
+) (*Checkout, error) {
+	res, err := s.GetReservationByID(ctx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	productIDs := make([]string, len(res.Items))
+	for i, it := range res.Items {
+		productIDs[i] = it.ProductID
+	}
+	var rows []productRow
+	_, err = s.client.From("products").
+		Select("id,veterinarian_id,price,currency", "", false).
+		In("id", productIDs).
+		Eq("is_active", "true").
+		Is("deleted_at", "null").
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, supabaseError("product", err)
+	}
+	products := make(map[string]Product, len(rows))
+	for _, r := range rows {
+		products[r.ID] = r.product()
+	}
+	checkout, err := splitCheckout(template, res.orderItems(), products)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]map[string]any, len(checkout.Orders))
+	for i, o := range checkout.Orders {
+		orders[i] = map[string]any{"order": newOrderRow(&o.Order), "items": o.Items}
+	}
+	body := s.client.Rpc("confirm_reservation", "", map[string]any{
+		"p_reservation_id": reservationID,
+		"p_orders":         orders,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return nil, rpcErr.storeError("confirm_reservation")
+	}
+
+	// On success the function returns what place_order returned for each order
+	var placed []placedOrder
+	if err := json.Unmarshal([]byte(body), &placed); err != nil {
+		return nil, fmt.Errorf("confirm_reservation: unexpected response: %w", err)
+	}
+	if len(placed) != len(checkout.Orders) {
+		return nil, fmt.Errorf("confirm_reservation: expected %d orders, got %d",
+			len(checkout.Orders), len(placed))
+	}
+	for i := range checkout.Orders {
+		placed[i].apply(&checkout.Orders[i].Order, checkout.Orders[i].Items)
+	}
+	if err := checkout.total(); err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// ExpireReservations marks reservations that lapsed before now expired
+func (s *SupabaseService) ExpireReservations(ctx context.Context, now time.Time) (int, error) {
+	_, count, err := s.client.From("reservations").
+		Update(map[string]any{
+			"status":     ReservationExpired,
+			"updated_at": time.Now().UTC().Format(time.RFC3339Nano),
+		}, "minimal", "exact").
+		Eq("status", ReservationActive).
+		Lte("expires_at", now.UTC().Format(time.RFC3339Nano)).
+		Execute()
+	if err != nil {
+		return 0, supabaseError("reservation", err)
+	}
+	return int(count), nil
+}
+
+// Payment operations
+
+// UpdateOrderPaymentStatus sets an order's payment status
+func (s *SupabaseService) UpdateOrderPaymentStatus(
+	ctx context.Context,
+	orderID string,
+	paymentStatus string,
+) error {
+	updateData := map[string]any{
+		"payment_status": paymentStatus,
+		"updated_at":     time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	return updateOne("order", s.client.From("orders").
+		Update(updateData, "", "").
+		Eq("id", orderID))
+}
+
+// paymentRow is how a payment is stored, like orderRow
+type paymentRow struct {
+	Payment
+	Amount         float64 `json:"amount"`
+	RefundedAmount float64 `json:"refunded_amount"`
+	Currency       string  `json:"currency"`
+	FailureReason  *string `json:"failure_reason"`
+}
+
+func newPaymentRow(p *Payment) paymentRow {
+	row := paymentRow{
+		Payment:        *p,
+		Amount:         p.Amount.Major(),
+		RefundedAmount: p.RefundedAmount.Major(),
+		Currency:       p.Amount.currencyOrDefault(),
+	}
+	if p.FailureReason != "" {
+		row.FailureReason = &p.FailureReason
+	}
+	return row
+}
+
+func (r paymentRow) payment() *Payment {
+	p := r.Payment
+	p.Amount = MoneyFromMajor(r.Amount, r.Currency)
+	p.RefundedAmount = MoneyFromMajor(r.RefundedAmount, r.Currency)
+	if r.FailureReason != nil {
+		p.FailureReason = *r.FailureReason
+	}
+	return &p
+}
+
+// CreatePayment records a payment attempt for an existing order
+func (s *SupabaseService) CreatePayment(ctx context.Context, payment *Payment) error {
+	if err := validatePayment(payment); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("payments").
+		Insert(newPaymentRow(payment), false, "", "", "").
+		Execute()
+	return supabaseError("payment", err)
+}
+
+// GetPaymentByID retrieves a specific payment attempt
+func (s *SupabaseService) GetPaymentByID(ctx context.Context, paymentID string) (*Payment, error) {
+	var row paymentRow
+	_, err := s.client.From("payments").
+		Select("*", "", false).
+		Eq("id", paymentID).
+		Single().
+		ExecuteTo(&row)
+	if err != nil {
+		return nil, supabaseError("payment", err)
+	}
+	return row.payment(), nil
+}
+
+// GetPaymentByIntentID retrieves the payment attempt for a gateway intent
+func (s *SupabaseService) GetPaymentByIntentID(
+	ctx context.Context,
+	provider, intentID string,
+) (*Payment, error) {
+	var row paymentRow
+	_, err := s.client.From("payments").
+		Select("*", "", false).
+		Eq("provider", provider).
+		Eq("intent_id", intentID).
+		Single().
+		ExecuteTo(&row)
+	if err != nil {
+		return nil, supabaseError("payment", err)
+	}
+	return row.payment(), nil
+}
+
+// GetOrderPayments lists an order's payment attempts, oldest first
+func (s *SupabaseService) GetOrderPayments(ctx context.Context, orderID string) ([]Payment, error) {
+	var rows []paymentRow
+	_, err := s.client.From("payments").
+		Select("*", "", false).
+		Eq("order_id", orderID).
+		Order("created_at", &oldestFirst).
+		Order("id", &oldestFirst).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, supabaseError("payment", err)
+	}
+	payments := make([]Payment, len(rows))
+	for i, r := range rows {
+		payments[i] = *r.payment()
+	}
+	return payments, nil
+}
+
+// SetPaymentStatus calls the set_payment_status database function, which
+// moves a payment attempt and its order's payment status inside a single
+// Postgres transaction
+func (s *SupabaseService) SetPaymentStatus(
+	ctx context.Context,
+	paymentID string,
+	status string,
+	failureReason string,
+) (*Payment, error) {
+	body := s.client.Rpc("set_payment_status", "", map[string]any{
+		"p_payment_id":     paymentID,
+		"p_status":         status,
+		"p_failure_reason": failureReason,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return nil, rpcErr.storeError("set_payment_status")
+	}
+
+	var row paymentRow
+	if err := json.Unmarshal([]byte(body), &row); err != nil {
+		return nil, fmt.Errorf("set_payment_status: unexpected response: %w", err)
+	}
+	return row.payment(), nil
+}
+
+// RecordPaymentRefund calls the record_payment_refund database function,
+// which records the total refunded of a payment attempt and moves its order's
+// payment status inside a single Postgres transaction
+func (s *SupabaseService) RecordPaymentRefund(
+	ctx context.Context,
+	paymentID string,
+	refunded Money,
+) (*Payment, error) {
+	body := s.client.Rpc("record_payment_refund", "", map[string]any{
+		"p_payment_id": paymentID,
+		"p_refunded":   refunded.Decimal(),
+		"p_currency":   refunded.currencyOrDefault(),
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return nil, rpcErr.storeError("record_payment_refund")
+	}
+
+	var row paymentRow
+	if err := json.Unmarshal([]byte(body), &row); err != nil {
+		return nil, fmt.Errorf("record_payment_refund: unexpected response: %w", err)
+	}
+	return row.payment(), nil
+}
+
+// Return operations
+
+// returnRow is how a return is stored, like orderRow. Its items live in
+// return_items and are read separately.
+type returnRow struct {
+	Return
+	RefundAmount float64      `json:"refund_amount"`
+	Currency     string       `json:"currency"`
+	ReviewerID   *string      `json:"reviewer_id"`
+	ReviewNote   *string      `json:"review_note"`
+	PaymentID    *string      `json:"payment_id"`
+	Items        []ReturnItem `json:"items,omitempty"`
+}
+
+func (r returnRow) ret() Return {
+	ret := r.Return
+	ret.RefundAmount = MoneyFromMajor(r.RefundAmount, r.Currency)
+	if r.ReviewerID != nil {
+		ret.ReviewerID = *r.ReviewerID
+	}
+	if r.ReviewNote != nil {
+		ret.ReviewNote = *r.ReviewNote
+	}
+	if r.PaymentID != nil {
+		ret.PaymentID = *r.PaymentID
+	}
+	return ret
+}
+
+// returnItemRow is how a return item is stored
+type returnItemRow struct {
+	ReturnItem
+	RefundAmount float64 `json:"refund_amount"`
+	Currency     string  `json:"currency"`
+	Disposition  *string `json:"disposition"`
+}
+
+func (r returnItemRow) item() ReturnItem {
+	it := r.ReturnItem
+	it.RefundAmount = MoneyFromMajor(r.RefundAmount, r.Currency)
+	if r.Disposition != nil {
+		it.Disposition = *r.Disposition
+	}
+	return it
+}
+
+// selectReturns runs a query for returns and loads each one's items in the
+// order they were listed
+func (s *SupabaseService) selectReturns(query *postgrest.FilterBuilder) ([]Return, error) {
+	var rows []returnRow
+	if _, err := query.ExecuteTo(&rows); err != nil {
+		return nil, supabaseError("return", err)
+	}
+	returns := make([]Return, len(rows))
+	for i, r := range rows {
+		returns[i] = r.ret()
+		var items []returnItemRow
+		_, err := s.client.From("return_items").
+			Select("*", "", false).
+			Eq("return_id", r.ID).
+			Order("position", &oldestFirst).
+			ExecuteTo(&items)
+		if err != nil {
+			return nil, supabaseError("return item", err)
+		}
+		returns[i].Items = make([]ReturnItem, len(items))
+		for j, it := range items {
+			returns[i].Items[j] = it.item()
+		}
+	}
+	return returns, nil
+}
+
+// CreateReturn calls the create_return database function, which checks and
+// prices the return against its order and inserts it with its items inside a
+// single Postgres transaction, then reads the priced return back into ret
+func (s *SupabaseService) CreateReturn(ctx context.Context, ret *Return) error {
+	if err := validateReturn(ret); err != nil {
+		return err
+	}
+
+	body := s.client.Rpc("create_return", "", map[string]any{
+		"p_return": ret,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("create_return")
+	}
+
+	created, err := s.GetReturnByID(ctx, ret.ID)
+	if err != nil {
+		return err
+	}
+	*ret = *created
+	return nil
+}
+
+// GetReturnByID retrieves a specific return with its items
+func (s *SupabaseService) GetReturnByID(ctx context.Context, returnID string) (*Return, error) {
+	returns, err := s.selectReturns(s.client.From("returns").
+		Select("*", "", false).
+		Eq("id", returnID))
+	if err != nil {
+		return nil, err
+	}
+	if len(returns) == 0 {
+		return nil, notFound("return")
+	}
+	return &returns[0], nil
+}
+
+// GetOrderReturns lists an order's returns with their items, oldest first
+func (s *SupabaseService) GetOrderReturns(ctx context.Context, orderID string) ([]Return, error) {
+	if _, err := s.GetOrderByID(ctx, orderID); err != nil {
+		return nil, err
+	}
+	return s.selectReturns(s.client.From("returns").
+		Select("*", "", false).
+		Eq("order_id", orderID).
+		Order("created_at", &oldestFirst).
+		Order("id", &oldestFirst))
+}
+
+// ReviewReturn calls the review_return database function, which reviews the
+// return and restocks its approved items inside a single Postgres transaction
+func (s *SupabaseService) ReviewReturn(ctx context.Context, review *ReturnReview) (*Return, error) {
+	if err := validateReturnReview(review); err != nil {
+		return nil, err
+	}
+
+	body := s.client.Rpc("review_return", "", map[string]any{
+		"p_review": review,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return nil, rpcErr.storeError("review_return")
+	}
+	return s.GetReturnByID(ctx, review.ReturnID)
+}
+
+// MarkReturnRefunded records the payment an approved return was refunded
+// from. The update is guarded on the return still being approved.
+func (s *SupabaseService) MarkReturnRefunded(
+	ctx context.Context,
+	returnID, paymentID string,
+) (*Return, error) {
+	ret, err := s.GetReturnByID(ctx, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if err := refundReturn(ret, paymentID); err != nil {
+		return nil, err
+	}
+
+	err = updateOne("return", s.client.From("returns").
+		Update(map[string]any{
+			"status":     ret.Status,
+			"payment_id": ret.PaymentID,
+			"updated_at": ret.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		}, "", "").
+		Eq("id", returnID).
+		Eq("status", ReturnApproved))
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("return %s is no longer approved: %w", returnID, ErrReturnTransition)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Invoice operations
+
+// invoiceRow is how an invoice is stored, like orderRow. Seller, buyer and
+// lines are JSONB columns and decode as they are.
+type invoiceRow struct {
+	Invoice
+	Subtotal      float64 `json:"subtotal"`
+	Tax           float64 `json:"tax"`
+	Total         float64 `json:"total"`
+	Currency      string  `json:"currency"`
+	InvoiceID     *string `json:"invoice_id"`
+	InvoiceNumber *string `json:"invoice_number"`
+	ReturnID      *string `json:"return_id"`
+}
+
+func (r invoiceRow) invoice() Invoice {
+	inv := r.Invoice
+	inv.Subtotal = MoneyFromMajor(r.Subtotal, r.Currency)
+	inv.Tax = MoneyFromMajor(r.Tax, r.Currency)
+	inv.Total = MoneyFromMajor(r.Total, r.Currency)
+	if r.InvoiceID != nil {
+		inv.InvoiceID = *r.InvoiceID
+	}
+	if r.InvoiceNumber != nil {
+		inv.InvoiceNumber = *r.InvoiceNumber
+	}
+	if r.ReturnID != nil {
+		inv.ReturnID = *r.ReturnID
+	}
+	return inv
+}
+
+// selectInvoices runs a query for invoices
+func selectInvoices(query *postgrest.FilterBuilder) ([]Invoice, error) {
+	var rows []invoiceRow
+	if _, err := query.ExecuteTo(&rows); err != nil {
+		return nil, supabaseError("invoice", err)
+	}
+	invoices := make([]Invoice, len(rows))
+	for i, r := range rows {
+		invoices[i] = r.invoice()
+	}
+	return invoices, nil
+}
+
+// IssueInvoice calls the issue_invoice database function, which takes the
+// next number in the veterinarian's sequence and inserts the invoice inside a
+// single Postgres transaction
+func (s *SupabaseService) IssueInvoice(ctx context.Context, inv *Invoice) error {
+	if err := validateInvoice(inv); err != nil {
+		return err
+	}
+
+	body := s.client.Rpc("issue_invoice", "", map[string]any{
+		"p_invoice": inv,
+	})
+	var rpcErr rpcError
+	if err := json.Unmarshal([]byte(body), &rpcErr); err == nil && rpcErr.Code != "" {
+		return rpcErr.storeError("issue_invoice")
+	}
+
+	var issued struct {
+		Sequence int    `json:"sequence"`
+		Number   string `json:"number"`
+	}
+	if err := json.Unmarshal([]byte(body), &issued); err != nil || issued.Number == "" {
+		return fmt.Errorf("issue_invoice: unexpected response: %s", body)
+	}
+	inv.Sequence, inv.Number = issued.Sequence, issued.Number
+	return nil
+}
+
+// GetInvoiceByID retrieves a specific invoice or credit note
+func (s *SupabaseService) GetInvoiceByID(ctx context.Context, invoiceID string) (*Invoice, error) {
+	invoices, err := selectInvoices(s.client.From("invoices").
+		Select("*", "", false).
+		Eq("id", invoiceID))
+	if err != nil {
+		return nil, err
+	}
+	if len(invoices) == 0 {
+		return nil, notFound("invoice")
+	}
+	return &invoices[0], nil
+}
+
+// GetOrderInvoice retrieves the invoice issued for an order
+func (s *SupabaseService) GetOrderInvoice(ctx context.Context, orderID string) (*Invoice, error) {
+	invoices, err := selectInvoices(s.client.From("invoices").
+		Select("*", "", false).
+		Eq("order_id", orderID).
+		Eq("kind", InvoiceKindInvoice))
+	if err != nil {
+		return nil, err
+	}
+	if len(invoices) == 0 {
+		return nil, notFound("invoice")
+	}
+	return &invoices[0], nil
+}
+
+// GetOrderCreditNotes lists the credit notes issued for an order, oldest first
+func (s *SupabaseService) GetOrderCreditNotes(ctx context.Context, orderID string) ([]Invoice, error) {
+	return selectInvoices(s.client.From("invoices").
+		Select("*", "", false).
+		Eq("order_id", orderID).
+		Eq("kind", InvoiceKindCreditNote).
+		Order("sequence", &oldestFirst))
+}
+
+// Tax operations
+
+// GetTaxSettings retrieves a veterinarian's tax settings, which have no rates
+// until they are set
+func (s *SupabaseService) GetTaxSettings(ctx context.Context, vetID string) (*TaxSettings, error) {
+	if _, err := s.GetVeterinarianByID(ctx, vetID); err != nil {
+		return nil, err
+	}
+	var rows []TaxSettings
+	_, err := s.client.From("tax_settings").
+		Select("*", "", false).
+		Eq("veterinarian_id", vetID).
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, supabaseError("tax settings", err)
+	}
+	if len(rows) == 0 {
+		return &TaxSettings{VeterinarianID: vetID, Rates: []TaxRate{}}, nil
+	}
+	return &rows[0], nil
+}
+
+// SetTaxSettings replaces a veterinarian's tax settings
+func (s *SupabaseService) SetTaxSettings(ctx context.Context, settings *TaxSettings) error {
+	if err := validateTaxSettings(settings); err != nil {
+		return err
+	}
+	row := *settings
+	row.Rates = taxRatesJSON(settings.Rates)
+	_, _, err := s.client.From("tax_settings").
+		Insert(row, true, "veterinarian_id", "", "").
+		Execute()
+	return supabaseError("veterinarian", err)
+}
+
+// Promotion operations
+
+// promotionRow is how a promotion is stored: its amount and minimum spend in
+// major units, sharing a currency column that is NULL for a percentage off
+// without a minimum. Shop-wide promotions have no veterinarian and automatic
+// ones no code.
+type promotionRow struct {
+	Promotion
+	VeterinarianID *string `json:"veterinarian_id"`
+	Code           *string `json:"code"`
+	Amount         float64 `json:"amount"`
+	MinSpend       float64 `json:"min_spend"`
+	Currency       *string `json:"currency"`
+}
+
+func newPromotionRow(p *Promotion) promotionRow {
+	row := promotionRow{
+		Promotion: *p,
+		Amount:    p.Amount.Major(),
+		MinSpend:  p.MinSpend.Major(),
+	}
+	row.ProductIDs = stringsJSON(p.ProductIDs)
+	row.Categories = stringsJSON(p.Categories)
+	if p.VeterinarianID != "" {
+		row.VeterinarianID = &p.VeterinarianID
+	}
+	if p.Code != "" {
+		row.Code = &p.Code
+	}
+	if currency := p.currency(); currency != "" {
+		row.Currency = &currency
+	}
+	return row
+}
+
+func (r promotionRow) promotion() Promotion {
+	p := r.Promotion
+	var currency string
+	if r.Currency != nil {
+		currency = *r.Currency
+	}
+	p.Amount = MoneyFromMajor(r.Amount, currency)
+	p.MinSpend = MoneyFromMajor(r.MinSpend, currency)
+	if r.VeterinarianID != nil {
+		p.VeterinarianID = *r.VeterinarianID
+	}
+	if r.Code != nil {
+		p.Code = *r.Code
+	}
+	return p
+}
+
+// getPromotion reads the one promotion matching query
+func getPromotion(query *postgrest.FilterBuilder) (*Promotion, error) {
+	var row promotionRow
+	if _, err := query.Single().ExecuteTo(&row); err != nil {
+		return nil, supabaseError("promotion", err)
+	}
+	p := row.promotion()
+	return &p, nil
+}
+
+// CreatePromotion creates a new promotion
+func (s *SupabaseService) CreatePromotion(ctx context.Context, promotion *Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("promotions").
+		Insert(newPromotionRow(promotion), false, "", "", "").
+		Execute()
+	return supabaseError("promotion", err)
+}
+
+// GetPromotionByID retrieves a specific promotion
+func (s *SupabaseService) GetPromotionByID(
+	ctx context.Context,
+	promotionID string,
+) (*Promotion, error) {
+	return getPromotion(s.client.From("promotions").
+		Select("*", "", false).
+		Eq("id", promotionID))
+}
+
+// GetPromotionByCode retrieves the promotion with a discount code
+func (s *SupabaseService) GetPromotionByCode(ctx context.Context, code string) (*Promotion, error) {
+	return getPromotion(s.client.From("promotions").
+		Select("*", "", false).
+		Eq("code", NormalizePromotionCode(code)))
+}
+
+// ListPromotions lists a veterinarian's promotions, or every promotion
+func (s *SupabaseService) ListPromotions(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Promotion, string, error) {
+	query := s.client.From("promotions").Select("*", "", false)
+	if vetID != "" {
+		query = query.Eq("veterinarian_id", vetID)
+	}
+	rows, next, err := selectPage("promotion", query,
+		func(r promotionRow) cursor { return promotionKey(r.promotion()) }, "", page)
+	if err != nil {
+		return nil, "", err
+	}
+	promotions := make([]Promotion, len(rows))
+	for i, r := range rows {
+		promotions[i] = r.promotion()
+	}
+	return promotions, next, nil
+}
+
+// UpdatePromotion updates a promotion, keeping its usage count
+func (s *SupabaseService) UpdatePromotion(ctx context.Context, promotion *Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	promotion.UpdatedAt = time.Now()
+
+	// Leave the usage count, which orders update concurrently, to the database
+	values := struct {
+		promotionRow
+		UsageCount *int       `json:"usage_count,omitempty"`
+		CreatedAt  *time.Time `json:"created_at,omitempty"`
+	}{promotionRow: newPromotionRow(promotion)}
+	var rows []promotionRow
+	_, err := s.client.From("promotions").
+		Update(values, "", "").
+		Eq("id", promotion.ID).
+		ExecuteTo(&rows)
+	if err != nil {
+		return supabaseError("promotion", err)
+	}
+	if len(rows) == 0 {
+		return notFound("promotion")
+	}
+	promotion.UsageCount = rows[0].UsageCount
+	promotion.CreatedAt = rows[0].CreatedAt
+	return nil
+}
+
+// DeletePromotion removes a promotion. Orders keep the discounts it gave.
+func (s *SupabaseService) DeletePromotion(ctx context.Context, promotionID string) error {
+	return updateOne("promotion", s.client.From("promotions").
+		Delete("", "").
+		Eq("id", promotionID))
+}
+
+// Trash operations
+
+// trashTimestamp is the deleted_at shared by every row one delete trashes.
+// It is cut to the microsecond precision Postgres stores so that restores
+// can match it exactly.
+func trashTimestamp() string {
+	return time.Now().UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+}
+
+// trashRef is the part of a trashed row the trash operations read back
+type trashRef struct {
+	ID        string `json:"id"`
+	DeletedAt string `json:"deleted_at"`
+}
+
+// trashRows moves the live rows of table whose column matches one of ids to
+// the trash, then the rows that cascade from them. PostgREST cannot wrap the
+// cascade in a transaction, so a failure part way leaves the rows already
+// trashed in the trash.
+// It returns how many rows of table it trashed.
+func (s *SupabaseService) trashRows(table, column string, ids []string, at string) (int, error) {
+	values := map[string]any{"deleted_at": at}
+	if table == "products" {
+		values["is_active"] = false
+	}
+	var trashed []trashRef
+	_, err := s.client.From(table).
+		Update(values, "", "").
+		In(column, ids).
+		Is("deleted_at", "null").
+		ExecuteTo(&trashed)
+	if err != nil {
+		return 0, supabaseError(table, err)
+	}
+	if len(trashed) == 0 {
+		return 0, nil
+	}
+	for _, c := range trashCascades {
+		if c.parent == table {
+			if _, err := s.trashRows(c.table, c.column, trashedIDs(trashed), at); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(trashed), nil
+}
+
+// restoreRows restores the rows that cascaded from the restored ids of table,
+// which are the ones trashed at the same moment
+func (s *SupabaseService) restoreRows(table string, ids []string, at string) error {
+	for _, c := range trashCascades {
+		if c.parent != table {
+			continue
+		}
+		var restored []trashRef
+		_, err := s.client.From(c.table).
+			Update(map[string]any{"deleted_at": nil}, "", "").
+			In(c.column, ids).
+			Eq("deleted_at", at).
+			ExecuteTo(&restored)
+		if err != nil {
+			return supabaseError(c.table, err)
+		}
+		if len(restored) > 0 {
+			if err := s.restoreRows(c.table, trashedIDs(restored), at); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func trashedIDs(rows []trashRef) []string {
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// ListTrash retrieves a page of deleted rows, most recently deleted first.
+// Each table is read up to one row past the page and the rows merged, so the
+// page is taken over the combined list rather than each table separately.
+func (s *SupabaseService) ListTrash(
+	ctx context.Context,
+	entity string,
+	page Page,
+) ([]TrashItem, string, error) {
+	tables, err := trashTablesFor(entity)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := decodeCursor(page.Cursor, sortByDeletion)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := page.limit()
+
+	items := []TrashItem{}
+	for _, t := range tables {
+		query := s.client.From(t.table).
+			Select("id,name:"+t.name+",deleted_at", "", false).
+			Not("deleted_at", "is", "null")
+		if after != nil {
+			query = query.Or(postgrestKeyset(after.keys()), "")
+		}
+		var rows []TrashItem
+		_, err := query.
+			Order("deleted_at", &newestFirst).
+			Order("id", &newestFirst).
+			Limit(limit+1, "").
+			ExecuteTo(&rows)
+		if err != nil {
+			return nil, "", supabaseError(t.table, err)
+		}
+		for _, row := range rows {
+			row.Entity = t.entity
+			items = append(items, row)
+		}
+	}
+	sortTrash(items)
+
+	if len(items) > limit+1 {
+		items = items[:limit+1]
+	}
+	items, next := trimPage(items, limit, trashKey)
+	return items, next, nil
+}
+
+// RestoreDeleted brings a row back with the rows that were trashed along with it
+func (s *SupabaseService) RestoreDeleted(ctx context.Context, entity, id string) error {
+	tables, err := trashTablesFor(entity)
+	if err != nil || entity == "" {
+		return notFound(entity)
+	}
+	for _, t := range tables {
+		var rows []trashRef
+		_, err := s.client.From(t.table).
+			Select("id,deleted_at", "", false).
+			Eq("id", id).
+			Not("deleted_at", "is", "null").
+			ExecuteTo(&rows)
+		if err != nil {
+			return supabaseError(entity, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		// Guard on the timestamp so a concurrent restore does not cascade twice
+		at := rows[0].DeletedAt
+		var restored []trashRef
+		_, err = s.client.From(t.table).
+			Update(map[string]any{"deleted_at": nil}, "", "").
+			Eq("id", id).
+			Eq("deleted_at", at).
+			ExecuteTo(&restored)
+		if err != nil {
+			return supabaseError(entity, err)
+		}
+		if len(restored) == 0 {
+			return notFound(entity)
+		}
+		return s.restoreRows(t.table, []string{id}, at)
+	}
+	return notFound(entity)
+}
+
+// PurgeDeleted permanently removes rows deleted before the cutoff. Foreign
+// keys cascade to everything that references them.
+func (s *SupabaseService) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	cutoff := before.UTC().Format(time.RFC3339Nano)
+	purged := 0
+	// Children go first so that they are counted before a parent's cascade
+	// removes them
+	for i := len(trashTables) - 1; i >= 0; i-- {
+		_, count, err := s.client.From(trashTables[i].table).
+			Delete("minimal", "exact").
+			Lt("deleted_at", cutoff).
+			Execute()
+		if err != nil {
+			return purged, supabaseError(trashTables[i].table, err)
+		}
+		purged += int(count)
+	}
+	return purged, nil
+}
+
+// Audit log operations
+
+// AppendAuditEntry adds an entry to the audit log
+func (s *SupabaseService) AppendAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	_, _, err := s.client.From("audit_log").Insert(entry, false, "", "minimal", "").Execute()
+	return supabaseError("audit entry", err)
+}
+
+// ListAuditEntries retrieves a page of audit entries matching filter, newest first
+func (s *SupabaseService) ListAuditEntries(
+	ctx context.Context,
+	filter AuditFilter,
+	page Page,
+) ([]AuditEntry, string, error) {
+	query := s.client.From("audit_log").Select("*", "", false)
+	if filter.ActorID != "" {
+		query = query.Eq("actor_id", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Eq("action", filter.Action)
+	}
+	if filter.Entity != "" {
+		query = query.Eq("entity", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		query = query.Eq("entity_id", filter.EntityID)
+	}
+
+	// Both bounds filter created_at, so they must share one and=() parameter
+	var window []string
+	if !filter.From.IsZero() {
+		window = append(window, "created_at.gte."+filter.From.UTC().Format(time.RFC3339Nano))
+	}
+	if !filter.To.IsZero() {
+		window = append(window, "created_at.lt."+filter.To.UTC().Format(time.RFC3339Nano))
+	}
+	if len(window) > 0 {
+		query = query.And(strings.Join(window, ","), "")
+	}
+	return selectPage("audit entry", query, auditKey, sortByNewest, page)
 }
@@ -0,0 +1,94 @@
+// Package store/errors.go contains sentinel errors shared by all store backends
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when a write violates a uniqueness constraint
+	ErrConflict = errors.New("conflict")
+
+	// ErrVersionConflict is returned when an update names a row version that
+	// is no longer current because someone else changed the row first
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// ErrInvalidOrder is returned when an order placement fails validation
+var ErrInvalidOrder = errors.New("invalid order")
+
+// ErrReservationClosed is returned when a reservation that was released,
+// has expired or was already confirmed is released or confirmed
+var ErrReservationClosed = errors.New("reservation is no longer active")
+
+// ErrInvalidStockMovement is returned when a stock movement's quantity does
+// not fit its type
+var ErrInvalidStockMovement = errors.New("invalid stock movement")
+
+// InsufficientStockError is returned when an order or stock movement takes
+// more units of a product than are currently in stock
+type InsufficientStockError struct {
+	ProductID string
+	Requested int
+	Available int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf(
+		"insufficient stock for product %s: requested %d, available %d",
+		e.ProductID,
+		e.Requested,
+		e.Available,
+	)
+}
+
+// ErrInvalidPayment is returned when a payment attempt fails validation
+var ErrInvalidPayment = errors.New("invalid payment")
+
+// ErrPaymentTransition is returned when a payment attempt cannot move to the
+// requested status from the one it is in
+var ErrPaymentTransition = errors.New("invalid payment status transition")
+
+// ErrOrderTransition is returned when an order cannot move to the requested
+// status, either because the lifecycle does not allow it or because the order
+// has moved on since it was read
+var ErrOrderTransition = errors.New("invalid order status transition")
+
+// ErrOrderPaid is returned when cancelling an order that has been paid and
+// not refunded, since nothing would give the client their money back
+var ErrOrderPaid = errors.New("paid orders must be refunded before they are cancelled")
+
+// ErrInvalidReturn is returned when a return request or review fails
+// validation, such as returning more of an item than was delivered
+var ErrInvalidReturn = errors.New("invalid return")
+
+// ErrReturnTransition is returned when a return cannot move to the requested
+// status from the one it is in
+var ErrReturnTransition = errors.New("invalid return status transition")
+
+// ErrInvalidInvoice is returned when an invoice or credit note fails
+// validation
+var ErrInvalidInvoice = errors.New("invalid invoice")
+
+// ErrInvalidTaxSettings is returned when tax settings fail validation
+var ErrInvalidTaxSettings = errors.New("invalid tax settings")
+
+// ErrInvalidPromotion is returned when a promotion fails validation
+var ErrInvalidPromotion = errors.New("invalid promotion")
+
+// ErrPromotionUnavailable is returned when an order gives a discount code
+// that has reached its usage cap
+var ErrPromotionUnavailable = errors.New("promotion unavailable")
+
+// ErrLastAdmin is returned when removing an admin would leave none
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
+// ErrInvalidPetAccess is returned when a pet access grant fails validation
+var ErrInvalidPetAccess = errors.New("invalid pet access grant")
+
+// ErrInvalidConsent is returned when a record consent fails validation
+var ErrInvalidConsent = errors.New("invalid record consent")
@@ -0,0 +1,144 @@
+// Package store/invoice.go contains the invoice and credit note types shared by all backends
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invoice kinds. Each veterinarian numbers invoices and credit notes in
+// separate sequences.
+const (
+	InvoiceKindInvoice    = "invoice"
+	InvoiceKindCreditNote = "credit_note"
+)
+
+// invoicePrefixes start the numbers of each kind of invoice
+var invoicePrefixes = map[string]string{
+	InvoiceKindInvoice:    "INV",
+	InvoiceKindCreditNote: "CN",
+}
+
+// Invoice is an issued invoice or credit note. It is a snapshot: seller,
+// buyer and lines are copied in when it is issued, and it is never changed
+// afterwards, so it outlives edits to and purges of what it was made from.
+// Credit notes name the invoice they credit in InvoiceID and InvoiceNumber
+// and, for returns, the return in ReturnID. Tax is the sum of TaxLines.
+type Invoice struct {
+	ID             string        `json:"id"`
+	Kind           string        `json:"kind"`
+	Number         string        `json:"number"`
+	Sequence       int           `json:"sequence"`
+	OrderID        string        `json:"order_id"`
+	VeterinarianID string        `json:"veterinarian_id"`
+	ClientID       string        `json:"client_id"`
+	InvoiceID      string        `json:"invoice_id,omitempty"`
+	InvoiceNumber  string        `json:"invoice_number,omitempty"`
+	ReturnID       string        `json:"return_id,omitempty"`
+	Seller         InvoiceParty  `json:"seller"`
+	Buyer          InvoiceParty  `json:"buyer"`
+	Lines          []InvoiceLine `json:"lines"`
+	Subtotal       Money         `json:"subtotal"`
+	Tax            Money         `json:"tax"`
+	TaxLines       []TaxLine     `json:"tax_lines"`
+	Total          Money         `json:"total"`
+	PaymentStatus  string        `json:"payment_status"`
+	IssuedAt       time.Time     `json:"issued_at"`
+}
+
+// InvoiceParty is the seller or buyer named on an invoice
+type InvoiceParty struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// InvoiceLine is one line of an invoice
+type InvoiceLine struct {
+	ProductID   string `json:"product_id,omitempty"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   Money  `json:"unit_price"`
+	Total       Money  `json:"total"`
+}
+
+// NewInvoice creates a new unnumbered Invoice of kind for order with
+// generated ID and timestamp, charging taxLines on the lines. The lines
+// contain the tax when inclusive is set; either way Subtotal excludes it and
+// Total includes it. IssueInvoice assigns the number.
+func NewInvoice(
+	kind string,
+	order *Order,
+	seller, buyer InvoiceParty,
+	lines []InvoiceLine,
+	taxLines []TaxLine,
+	inclusive bool,
+) (*Invoice, error) {
+	subtotal := NewMoney(0, order.TotalAmount.currencyOrDefault())
+	for _, line := range lines {
+		sum, err := subtotal.Add(line.Total)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInvoice, err)
+		}
+		subtotal = sum
+	}
+	tax := NewMoney(0, subtotal.Currency)
+	for _, line := range taxLines {
+		sum, err := tax.Add(line.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInvoice, err)
+		}
+		tax = sum
+	}
+	if inclusive {
+		subtotal.Amount -= tax.Amount
+	}
+	total, _ := subtotal.Add(tax)
+	if taxLines == nil {
+		taxLines = []TaxLine{}
+	}
+	return &Invoice{
+		ID:             uuid.New().String(),
+		Kind:           kind,
+		OrderID:        order.ID,
+		VeterinarianID: order.VeterinarianID,
+		ClientID:       order.ClientID,
+		Seller:         seller,
+		Buyer:          buyer,
+		Lines:          lines,
+		Subtotal:       subtotal,
+		Tax:            tax,
+		TaxLines:       taxLines,
+		Total:          total,
+		PaymentStatus:  order.PaymentStatus,
+		IssuedAt:       time.Now(),
+	}, nil
+}
+
+// invoiceNumber formats the number of the sequence-th invoice of kind
+func invoiceNumber(kind string, sequence int) string {
+	return fmt.Sprintf("%s-%06d", invoicePrefixes[kind], sequence)
+}
+
+// validateInvoice rejects invoices without lines or of an unknown kind, and
+// credit notes that do not name the invoice they credit
+func validateInvoice(inv *Invoice) error {
+	if _, ok := invoicePrefixes[inv.Kind]; !ok {
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidInvoice, inv.Kind)
+	}
+	if inv.OrderID == "" || inv.VeterinarianID == "" || inv.ClientID == "" {
+		return fmt.Errorf("%w: order, veterinarian and client are required", ErrInvalidInvoice)
+	}
+	if len(inv.Lines) == 0 {
+		return fmt.Errorf("%w: at least one line is required", ErrInvalidInvoice)
+	}
+	if (inv.Kind == InvoiceKindCreditNote) != (inv.InvoiceID != "") {
+		return fmt.Errorf("%w: credit notes, and only they, name the invoice they credit",
+			ErrInvalidInvoice)
+	}
+	return nil
+}
@@ -0,0 +1,2727 @@
+// Package store/memory.go contains an in-memory Database for local development and tests
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a concurrency-safe, in-process implementation of Database.
+// It mirrors the semantics of SupabaseService so the API can run without a
+// Supabase project; all data is lost when the process exits.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	clients      map[string]Client
+	vets         map[string]Veterinarian
+	pets         map[string]Pet
+	records      map[string]MedicalRecord
+	qrCodes      map[string]QRCode
+	appointments map[string]Appointment
+	products     map[string]Product
+	orders       map[string]Order
+	orderItems   map[string]OrderItem
+	reservations map[string]Reservation
+	payments     map[string]Payment
+	returns      map[string]Return
+
+	// Soft-deleted rows are moved out of the maps above into the trash
+	trash map[string]trashedRow
+
+	// The audit log only ever grows
+	audit []AuditEntry
+
+	// Stock movements in the order they were recorded
+	stock []StockMovement
+
+	// Order status changes in the order they were made
+	orderHistory []OrderStatusChange
+
+	// Issued invoices and credit notes, which are never changed or removed
+	invoices []Invoice
+
+	// Tax settings by veterinarian ID
+	taxSettings map[string]TaxSettings
+
+	promotions map[string]Promotion
+
+	// The admin registry and suspended accounts by user ID
+	admins      map[string]AdminGrant
+	suspensions map[string]Suspension
+
+	// Pet access grants by ID, revoked ones included
+	petAccess map[string]PetAccessGrant
+
+	// Record consents by ID, revoked ones included
+	consents map[string]RecordConsent
+}
+
+// trashedRow is a soft-deleted Client, Veterinarian, Pet, MedicalRecord or Product
+type trashedRow struct {
+	item TrashItem
+	row  any
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients:      make(map[string]Client),
+		vets:         make(map[string]Veterinarian),
+		pets:         make(map[string]Pet),
+		records:      make(map[string]MedicalRecord),
+		qrCodes:      make(map[string]QRCode),
+		appointments: make(map[string]Appointment),
+		products:     make(map[string]Product),
+		orders:       make(map[string]Order),
+		orderItems:   make(map[string]OrderItem),
+		reservations: make(map[string]Reservation),
+		payments:     make(map[string]Payment),
+		returns:      make(map[string]Return),
+		taxSettings:  make(map[string]TaxSettings),
+		promotions:   make(map[string]Promotion),
+		admins:       make(map[string]AdminGrant),
+		suspensions:  make(map[string]Suspension),
+		petAccess:    make(map[string]PetAccessGrant),
+		consents:     make(map[string]RecordConsent),
+		trash:        make(map[string]trashedRow),
+	}
+}
+
+// Ping always succeeds for the in-memory store
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op for the in-memory store
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// notFound wraps ErrNotFound with the entity name
+func notFound(entity string) error {
+	return fmt.Errorf("%s %w", entity, ErrNotFound)
+}
+
+// checkVersion reports ErrVersionConflict when an update expects a version
+// other than the current one. A zero expected version skips the check.
+func checkVersion(entity string, current, expected int) error {
+	if expected != 0 && expected != current {
+		return fmt.Errorf("%s %w", entity, ErrVersionConflict)
+	}
+	return nil
+}
+
+// GetUserByID retrieves a user by their ID, looking in clients then
+// veterinarians, then the admin registry for admins without a profile
+func (m *MemoryStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.userLocked(userID)
+	if !ok {
+		return nil, notFound("user")
+	}
+	return &u, nil
+}
+
+// userLocked is the user with userID and whether there is one
+func (m *MemoryStore) userLocked(userID string) (User, bool) {
+	var u User
+	c, isClient := m.clients[userID]
+	v, isVet := m.vets[userID]
+	switch {
+	case isClient:
+		u = User{Email: c.Email, Role: c.Role}
+	case isVet:
+		u = User{Email: v.Email, Role: v.Role}
+	}
+	var admin *AdminGrant
+	if a, ok := m.admins[userID]; ok {
+		admin = &a
+	}
+	if !isClient && !isVet && admin == nil {
+		return User{}, false
+	}
+	var suspension *Suspension
+	if s, ok := m.suspensions[userID]; ok {
+		suspension = &s
+	}
+	return account(u, userID, admin, suspension), true
+}
+
+// CreateUser is not supported; profiles are role specific
+func (m *MemoryStore) CreateUser(ctx context.Context, user *User) error {
+	return fmt.Errorf("use CreateClient or CreateVeterinarian instead")
+}
+
+// UpdateUser is not supported; profiles are role specific
+func (m *MemoryStore) UpdateUser(ctx context.Context, user *User) error {
+	return fmt.Errorf("use UpdateClient or UpdateVeterinarian instead")
+}
+
+// DeleteUser moves a client with their pets, or a veterinarian with their
+// products, to the trash. A user with neither profile is not found.
+func (m *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if c, ok := m.clients[userID]; ok {
+		delete(m.clients, userID)
+		m.trashLocked(EntityUser, c.ID, c.Name, now, c)
+		for id, p := range m.pets {
+			if p.OwnerID == userID {
+				m.trashPetLocked(id, now)
+			}
+		}
+		return nil
+	}
+
+	if v, ok := m.vets[userID]; ok {
+		delete(m.vets, userID)
+		m.trashLocked(EntityUser, v.ID, v.Name, now, v)
+		for id, p := range m.products {
+			if p.VeterinarianID == userID {
+				m.trashProductLocked(id, now)
+			}
+		}
+		return nil
+	}
+	return notFound("user")
+}
+
+// purgeClientLocked removes what references a purged client, cascading like
+// the schema's foreign keys
+func (m *MemoryStore) purgeClientLocked(userID string) {
+	for id, p := range m.pets {
+		if p.OwnerID == userID {
+			m.deletePetLocked(id)
+		}
+	}
+	for id, a := range m.appointments {
+		if a.ClientID == userID {
+			delete(m.appointments, id)
+		}
+	}
+	for id, o := range m.orders {
+		if o.ClientID == userID {
+			m.deleteOrderLocked(id)
+		}
+	}
+	for id, res := range m.reservations {
+		if res.ClientID == userID {
+			delete(m.reservations, id)
+		}
+	}
+	for id, g := range m.petAccess {
+		if g.OwnerID == userID || g.GranteeID == userID {
+			delete(m.petAccess, id)
+		}
+	}
+	for id, c := range m.consents {
+		if c.OwnerID == userID {
+			delete(m.consents, id)
+		}
+	}
+}
+
+// purgeVetLocked removes what references a purged veterinarian
+func (m *MemoryStore) purgeVetLocked(userID string) {
+	for id, r := range m.records {
+		if r.VeterinarianID == userID {
+			delete(m.records, id)
+		}
+	}
+	for id, a := range m.appointments {
+		if a.VeterinarianID == userID {
+			delete(m.appointments, id)
+		}
+	}
+	for id, p := range m.products {
+		if p.VeterinarianID == userID {
+			m.deleteProductLocked(id)
+		}
+	}
+	for id, o := range m.orders {
+		if o.VeterinarianID == userID {
+			m.deleteOrderLocked(id)
+		}
+	}
+	delete(m.taxSettings, userID)
+	for id, c := range m.consents {
+		if c.VeterinarianID == userID {
+			delete(m.consents, id)
+		}
+	}
+	for id, p := range m.promotions {
+		if p.VeterinarianID == userID {
+			delete(m.promotions, id)
+		}
+	}
+}
+
+// ListUsers lists users with role, or all users, ordered by ID with pagination
+func (m *MemoryStore) ListUsers(ctx context.Context, role string, page Page) ([]User, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make(map[string]bool, len(m.clients)+len(m.vets)+len(m.admins))
+	for id := range m.clients {
+		ids[id] = true
+	}
+	for id := range m.vets {
+		ids[id] = true
+	}
+	for id := range m.admins {
+		ids[id] = true
+	}
+	users := make([]User, 0, len(ids))
+	for id := range ids {
+		if u, ok := m.userLocked(id); ok && (role == "" || u.Role == role) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return paginate(users, page, sortByID, userKey)
+}
+
+// CreateClient creates a new client profile
+func (m *MemoryStore) CreateClient(ctx context.Context, client *Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.clients[client.ID]; ok || m.trashedLocked(client.ID) {
+		return fmt.Errorf("client %s: %w", client.ID, ErrConflict)
+	}
+	for _, c := range m.clients {
+		if c.Email == client.Email {
+			return fmt.Errorf("client email %s: %w", client.Email, ErrConflict)
+		}
+	}
+	c := *client
+	if c.Role == "" {
+		c.Role = "client"
+	}
+	m.clients[c.ID] = c
+	return nil
+}
+
+// CreateVeterinarian creates a new veterinarian profile
+func (m *MemoryStore) CreateVeterinarian(ctx context.Context, vet *Veterinarian) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.vets[vet.ID]; ok || m.trashedLocked(vet.ID) {
+		return fmt.Errorf("veterinarian %s: %w", vet.ID, ErrConflict)
+	}
+	for _, v := range m.vets {
+		if v.Email == vet.Email {
+			return fmt.Errorf("veterinarian email %s: %w", vet.Email, ErrConflict)
+		}
+	}
+	v := cloneVeterinarian(*vet)
+	if v.Role == "" {
+		v.Role = "veterinarian"
+	}
+	m.vets[v.ID] = v
+	return nil
+}
+
+// UpdateClient updates a client profile
+func (m *MemoryStore) UpdateClient(ctx context.Context, client *Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.clients[client.ID]; !ok {
+		return notFound("client")
+	}
+	m.clients[client.ID] = *client
+	return nil
+}
+
+// UpdateVeterinarian updates a veterinarian profile
+func (m *MemoryStore) UpdateVeterinarian(ctx context.Context, vet *Veterinarian) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.vets[vet.ID]; !ok {
+		return notFound("veterinarian")
+	}
+	m.vets[vet.ID] = cloneVeterinarian(*vet)
+	return nil
+}
+
+// GetClientByID retrieves a client by ID
+func (m *MemoryStore) GetClientByID(ctx context.Context, clientID string) (*Client, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.clients[clientID]
+	if !ok {
+		return nil, notFound("client")
+	}
+	return &c, nil
+}
+
+// GetClientByEmail retrieves a client by email
+func (m *MemoryStore) GetClientByEmail(ctx context.Context, email string) (*Client, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found *Client
+	for _, c := range m.clients {
+		if email == "" || !strings.EqualFold(c.Email, email) {
+			continue
+		}
+		if found == nil || c.Email == email {
+			found = &c
+		}
+	}
+	if found == nil {
+		return nil, notFound("client")
+	}
+	return found, nil
+}
+
+// GetVeterinarianByID retrieves a veterinarian by ID
+func (m *MemoryStore) GetVeterinarianByID(
+	ctx context.Context,
+	vetID string,
+) (*Veterinarian, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.vets[vetID]
+	if !ok {
+		return nil, notFound("veterinarian")
+	}
+	v = cloneVeterinarian(v)
+	return &v, nil
+}
+
+// Admin registry and account operations
+
+// GrantAdmin adds a user to the admin registry
+func (m *MemoryStore) GrantAdmin(ctx context.Context, grant *AdminGrant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.admins[grant.UserID]; ok {
+		return fmt.Errorf("admin %s: %w", grant.UserID, ErrConflict)
+	}
+	m.admins[grant.UserID] = *grant
+	return nil
+}
+
+// RevokeAdmin removes a user from the admin registry unless they are the
+// last admin
+func (m *MemoryStore) RevokeAdmin(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.admins[userID]; !ok {
+		return notFound("admin")
+	}
+	if len(m.admins) == 1 {
+		return ErrLastAdmin
+	}
+	delete(m.admins, userID)
+	return nil
+}
+
+// SuspendUser suspends a user's account
+func (m *MemoryStore) SuspendUser(ctx context.Context, suspension *Suspension) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.suspensions[suspension.UserID] = *suspension
+	return nil
+}
+
+// ReactivateUser lifts a user's suspension
+func (m *MemoryStore) ReactivateUser(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.suspensions[userID]; !ok {
+		return notFound("suspension")
+	}
+	delete(m.suspensions, userID)
+	return nil
+}
+
+// Pet operations
+
+// GetPetsByUserID retrieves a page of pets for a specific user
+func (m *MemoryStore) GetPetsByUserID(
+	ctx context.Context,
+	userID string,
+	page Page,
+) ([]Pet, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pets := []Pet{}
+	for _, p := range m.pets {
+		if p.OwnerID == userID {
+			pets = append(pets, p)
+		}
+	}
+	sort.Slice(pets, func(i, j int) bool {
+		return createdBefore(pets[i].CreatedAt, pets[i].ID, pets[j].CreatedAt, pets[j].ID)
+	})
+	return paginate(pets, page, "", petKey)
+}
+
+// GetPetByID retrieves a pet by ID
+func (m *MemoryStore) GetPetByID(ctx context.Context, petID string) (*Pet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.pets[petID]
+	if !ok {
+		return nil, notFound("pet")
+	}
+	return &p, nil
+}
+
+// CreatePet creates a new pet
+func (m *MemoryStore) CreatePet(ctx context.Context, pet *Pet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pets[pet.ID]; ok || m.trashedLocked(pet.ID) {
+		return fmt.Errorf("pet %s: %w", pet.ID, ErrConflict)
+	}
+	if _, ok := m.clients[pet.OwnerID]; !ok {
+		return notFound("owner")
+	}
+	pet.Version = 1
+	m.pets[pet.ID] = *pet
+	return nil
+}
+
+// UpdatePet updates an existing pet unless its version is stale
+func (m *MemoryStore) UpdatePet(ctx context.Context, pet *Pet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.pets[pet.ID]
+	if !ok {
+		return notFound("pet")
+	}
+	if err := checkVersion("pet", current.Version, pet.Version); err != nil {
+		return err
+	}
+	pet.Version = current.Version + 1
+	m.pets[pet.ID] = *pet
+	return nil
+}
+
+// DeletePet moves a pet and its medical records to the trash
+func (m *MemoryStore) DeletePet(ctx context.Context, petID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pets[petID]; ok {
+		m.trashPetLocked(petID, time.Now())
+	}
+	return nil
+}
+
+// trashPetLocked moves a live pet and its live records to the trash
+func (m *MemoryStore) trashPetLocked(petID string, at time.Time) {
+	p := m.pets[petID]
+	delete(m.pets, petID)
+	p.Version++
+	m.trashLocked(EntityPet, p.ID, p.Name, at, p)
+	for id := range m.records {
+		if m.records[id].PetID == petID {
+			m.trashRecordLocked(id, at)
+		}
+	}
+}
+
+// deletePetLocked removes a pet and cascades like the schema's foreign keys
+func (m *MemoryStore) deletePetLocked(petID string) {
+	delete(m.pets, petID)
+	for id, r := range m.records {
+		if r.PetID == petID {
+			delete(m.records, id)
+		}
+	}
+	for id, q := range m.qrCodes {
+		if q.PetID == petID {
+			delete(m.qrCodes, id)
+		}
+	}
+	for id, a := range m.appointments {
+		if a.PetID == petID {
+			m.deleteAppointmentLocked(id)
+		}
+	}
+	for id, g := range m.petAccess {
+		if g.PetID == petID {
+			delete(m.petAccess, id)
+		}
+	}
+	for id, c := range m.consents {
+		if c.PetID == petID {
+			delete(m.consents, id)
+		}
+	}
+}
+
+// Pet access operations
+
+// CreatePetAccessGrant creates a new pet access grant
+func (m *MemoryStore) CreatePetAccessGrant(ctx context.Context, grant *PetAccessGrant) error {
+	if err := validatePetAccessGrant(grant); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pets[grant.PetID]; !ok {
+		return notFound("pet")
+	}
+	for _, id := range []string{grant.OwnerID, grant.GranteeID} {
+		if _, ok := m.clients[id]; !ok && id != "" {
+			return notFound("client")
+		}
+	}
+	for _, g := range m.petAccess {
+		if g.ID == grant.ID ||
+			(g.PetID == grant.PetID && g.SameGrantee(grant) && g.RevokedAt == nil) {
+			return fmt.Errorf("pet access grant: %w", ErrConflict)
+		}
+	}
+	m.petAccess[grant.ID] = storedPetAccessGrant(*grant)
+	return nil
+}
+
+// GetPetAccessGrantByID retrieves a specific pet access grant
+func (m *MemoryStore) GetPetAccessGrantByID(
+	ctx context.Context,
+	grantID string,
+) (*PetAccessGrant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	g, ok := m.petAccess[grantID]
+	if !ok {
+		return nil, notFound("pet access grant")
+	}
+	g = storedPetAccessGrant(g)
+	return &g, nil
+}
+
+// GetPetAccessGrants lists the grants on a pet
+func (m *MemoryStore) GetPetAccessGrants(ctx context.Context, petID string) ([]PetAccessGrant, error) {
+	return m.petAccessGrants(func(g PetAccessGrant) bool { return g.PetID == petID }), nil
+}
+
+// GetGranteePetAccessGrants lists the grants a client received
+func (m *MemoryStore) GetGranteePetAccessGrants(
+	ctx context.Context,
+	granteeID string,
+) ([]PetAccessGrant, error) {
+	return m.petAccessGrants(func(g PetAccessGrant) bool { return g.GranteeID == granteeID }), nil
+}
+
+// ClaimPetAccessInvitations gives the unrevoked invitations to email to
+// clientID
+func (m *MemoryStore) ClaimPetAccessInvitations(ctx context.Context, clientID, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.clients[clientID]; !ok {
+		return notFound("client")
+	}
+	for id, g := range m.petAccess {
+		if !g.Invitation() || !strings.EqualFold(g.GranteeEmail, email) || g.RevokedAt != nil ||
+			g.OwnerID == clientID || m.holdsPetAccessLocked(g.PetID, clientID) {
+			continue
+		}
+		g.GranteeID = clientID
+		m.petAccess[id] = g
+	}
+	return nil
+}
+
+// holdsPetAccessLocked reports whether clientID holds an unrevoked grant for
+// petID
+func (m *MemoryStore) holdsPetAccessLocked(petID, clientID string) bool {
+	for _, g := range m.petAccess {
+		if g.PetID == petID && g.GranteeID == clientID && g.RevokedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// petAccessGrants lists the grants matching keep, oldest first
+func (m *MemoryStore) petAccessGrants(keep func(PetAccessGrant) bool) []PetAccessGrant {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	grants := []PetAccessGrant{}
+	for _, g := range m.petAccess {
+		if keep(g) {
+			grants = append(grants, storedPetAccessGrant(g))
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return createdBefore(grants[i].CreatedAt, grants[i].ID, grants[j].CreatedAt, grants[j].ID)
+	})
+	return grants
+}
+
+// RevokePetAccessGrant ends a pet access grant
+func (m *MemoryStore) RevokePetAccessGrant(ctx context.Context, grantID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.petAccess[grantID]
+	if !ok || g.RevokedAt != nil {
+		return notFound("pet access grant")
+	}
+	g.RevokedAt = &at
+	m.petAccess[grantID] = g
+	return nil
+}
+
+// Record consent operations
+
+// CreateRecordConsent creates a new record consent
+func (m *MemoryStore) CreateRecordConsent(ctx context.Context, consent *RecordConsent) error {
+	if err := validateRecordConsent(consent); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.consents[consent.ID]; ok {
+		return fmt.Errorf("record consent %s: %w", consent.ID, ErrConflict)
+	}
+	if _, ok := m.pets[consent.PetID]; !ok {
+		return notFound("pet")
+	}
+	if _, ok := m.clients[consent.OwnerID]; !ok {
+		return notFound("client")
+	}
+	if _, ok := m.vets[consent.VeterinarianID]; !ok {
+		return notFound("veterinarian")
+	}
+	m.consents[consent.ID] = *consent
+	return nil
+}
+
+// GetRecordConsentByID retrieves a specific record consent
+func (m *MemoryStore) GetRecordConsentByID(ctx context.Context, consentID string) (*RecordConsent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.consents[consentID]
+	if !ok {
+		return nil, notFound("record consent")
+	}
+	return &c, nil
+}
+
+// GetPetRecordConsents lists the record consents on a pet
+func (m *MemoryStore) GetPetRecordConsents(ctx context.Context, petID string) ([]RecordConsent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	consents := []RecordConsent{}
+	for _, c := range m.consents {
+		if c.PetID == petID {
+			consents = append(consents, c)
+		}
+	}
+	sort.Slice(consents, func(i, j int) bool {
+		return createdBefore(consents[i].CreatedAt, consents[i].ID,
+			consents[j].CreatedAt, consents[j].ID)
+	})
+	return consents, nil
+}
+
+// RevokeRecordConsent ends a record consent
+func (m *MemoryStore) RevokeRecordConsent(ctx context.Context, consentID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.consents[consentID]
+	if !ok || c.RevokedAt != nil {
+		return notFound("record consent")
+	}
+	c.RevokedAt = &at
+	m.consents[consentID] = c
+	return nil
+}
+
+// Medical record operations
+
+// GetMedicalRecordsByPetID retrieves a page of medical records for a pet
+func (m *MemoryStore) GetMedicalRecordsByPetID(
+	ctx context.Context,
+	petID string,
+	page Page,
+) ([]MedicalRecord, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return paginate(m.recordsForPetLocked(petID), page, "", recordKey)
+}
+
+// recordsForPetLocked returns a pet's records in creation order
+func (m *MemoryStore) recordsForPetLocked(petID string) []MedicalRecord {
+	records := []MedicalRecord{}
+	for _, r := range m.records {
+		if r.PetID == petID {
+			records = append(records, cloneMedicalRecord(r))
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return createdBefore(records[i].CreatedAt, records[i].ID, records[j].CreatedAt, records[j].ID)
+	})
+	return records
+}
+
+// GetMedicalRecordByID retrieves a specific medical record
+func (m *MemoryStore) GetMedicalRecordByID(
+	ctx context.Context,
+	recordID string,
+) (*MedicalRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.records[recordID]
+	if !ok {
+		return nil, notFound("medical record")
+	}
+	r = cloneMedicalRecord(r)
+	return &r, nil
+}
+
+// CreateMedicalRecord creates a new medical record
+func (m *MemoryStore) CreateMedicalRecord(ctx context.Context, record *MedicalRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[record.ID]; ok || m.trashedLocked(record.ID) {
+		return fmt.Errorf("medical record %s: %w", record.ID, ErrConflict)
+	}
+	if _, ok := m.pets[record.PetID]; !ok {
+		return notFound("pet")
+	}
+	if _, ok := m.vets[record.VeterinarianID]; !ok {
+		return notFound("veterinarian")
+	}
+	record.Version = 1
+	m.records[record.ID] = cloneMedicalRecord(*record)
+	return nil
+}
+
+// UpdateMedicalRecord updates an existing medical record unless its version is stale
+func (m *MemoryStore) UpdateMedicalRecord(ctx context.Context, record *MedicalRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.records[record.ID]
+	if !ok {
+		return notFound("medical record")
+	}
+	if err := checkVersion("medical record", current.Version, record.Version); err != nil {
+		return err
+	}
+	record.Version = current.Version + 1
+	m.records[record.ID] = cloneMedicalRecord(*record)
+	return nil
+}
+
+// DeleteMedicalRecord moves a medical record to the trash
+func (m *MemoryStore) DeleteMedicalRecord(ctx context.Context, recordID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[recordID]; ok {
+		m.trashRecordLocked(recordID, time.Now())
+	}
+	return nil
+}
+
+// trashRecordLocked moves a live medical record to the trash
+func (m *MemoryStore) trashRecordLocked(recordID string, at time.Time) {
+	r := m.records[recordID]
+	delete(m.records, recordID)
+	r.Version++
+	m.trashLocked(EntityMedicalRecord, r.ID, r.ReasonForVisit, at, r)
+}
+
+// QR Code operations
+
+// GetQRCodeByPetID retrieves the active QR code for a pet
+func (m *MemoryStore) GetQRCodeByPetID(ctx context.Context, petID string) (*QRCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, q := range m.qrCodes {
+		if q.PetID == petID && q.IsActive {
+			q = cloneQRCode(q)
+			return &q, nil
+		}
+	}
+	return nil, notFound("qr code")
+}
+
+// GetQRCodeByPublicURL retrieves the active QR code for a public URL
+func (m *MemoryStore) GetQRCodeByPublicURL(
+	ctx context.Context,
+	publicURL string,
+) (*QRCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	q, ok := m.activeQRCodeByURLLocked(publicURL)
+	if !ok {
+		return nil, notFound("qr code")
+	}
+	return &q, nil
+}
+
+// activeQRCodeByURLLocked finds an active QR code by its public URL. Codes of
+// deleted pets stop resolving.
+func (m *MemoryStore) activeQRCodeByURLLocked(publicURL string) (QRCode, bool) {
+	for _, q := range m.qrCodes {
+		if _, live := m.pets[q.PetID]; live && q.PublicURL == publicURL && q.IsActive {
+			return cloneQRCode(q), true
+		}
+	}
+	return QRCode{}, false
+}
+
+// CreateQRCode creates a new QR code
+func (m *MemoryStore) CreateQRCode(ctx context.Context, qrCode *QRCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.qrCodes[qrCode.ID]; ok {
+		return fmt.Errorf("qr code %s: %w", qrCode.ID, ErrConflict)
+	}
+	for _, q := range m.qrCodes {
+		if q.PublicURL == qrCode.PublicURL {
+			return fmt.Errorf("qr code url %s: %w", qrCode.PublicURL, ErrConflict)
+		}
+	}
+	if _, ok := m.pets[qrCode.PetID]; !ok {
+		return notFound("pet")
+	}
+	m.qrCodes[qrCode.ID] = cloneQRCode(*qrCode)
+	return nil
+}
+
+// UpdateQRCode updates an existing QR code
+func (m *MemoryStore) UpdateQRCode(ctx context.Context, qrCode *QRCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.qrCodes[qrCode.ID]; !ok {
+		return notFound("qr code")
+	}
+	m.qrCodes[qrCode.ID] = cloneQRCode(*qrCode)
+	return nil
+}
+
+// DeleteQRCode deletes a QR code by ID
+func (m *MemoryStore) DeleteQRCode(ctx context.Context, qrCodeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.qrCodes, qrCodeID)
+	return nil
+}
+
+// GetPublicPetProfile retrieves public pet profile via QR code URL
+func (m *MemoryStore) GetPublicPetProfile(
+	ctx context.Context,
+	publicURL string,
+) (*PublicPetProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	qrCode, ok := m.activeQRCodeByURLLocked(publicURL)
+	if !ok {
+		return nil, notFound("qr code")
+	}
+	pet, ok := m.pets[qrCode.PetID]
+	if !ok {
+		return nil, notFound("pet")
+	}
+
+	records := m.recordsForPetLocked(qrCode.PetID)
+	publicRecords := make([]PublicMedicalRecord, 0, len(records))
+	for _, r := range records {
+		publicRecords = append(publicRecords, PublicMedicalRecord{
+			DateOfVisit:          r.DateOfVisit.Format("2006-01-02"),
+			ReasonForVisit:       r.ReasonForVisit,
+			Diagnosis:            r.Diagnosis,
+			MedicationPrescribed: r.MedicationPrescribed,
+		})
+	}
+
+	return &PublicPetProfile{
+		PetName:          qrCode.EncodedContent.PetName,
+		PetType:          qrCode.EncodedContent.PetType,
+		Breed:            pet.Breed,
+		DateOfBirth:      pet.DateOfBirth,
+		Weight:           pet.Weight,
+		OwnerName:        qrCode.EncodedContent.OwnerName,
+		OwnerPhone:       qrCode.EncodedContent.OwnerPhone,
+		OwnerEmail:       qrCode.EncodedContent.OwnerEmail,
+		OwnerAddress:     qrCode.EncodedContent.OwnerAddress,
+		EmergencyContact: qrCode.EncodedContent.EmergencyContact,
+		MedicalAlerts:    qrCode.EncodedContent.MedicalAlerts,
+		MedicalRecords:   publicRecords,
+	}, nil
+}
+
+// Appointment operations
+
+// GetAppointmentsByClientID retrieves a page of appointments for a client
+func (m *MemoryStore) GetAppointmentsByClientID(
+	ctx context.Context,
+	clientID string,
+	page Page,
+) ([]Appointment, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	appts := m.filterAppointmentsLocked(func(a Appointment) bool {
+		return a.ClientID == clientID
+	})
+	return paginate(appts, page, "", appointmentKey)
+}
+
+// GetAppointmentsByVeterinarianID retrieves a page of appointments for a veterinarian
+func (m *MemoryStore) GetAppointmentsByVeterinarianID(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Appointment, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	appts := m.filterAppointmentsLocked(func(a Appointment) bool {
+		return a.VeterinarianID == vetID
+	})
+	return paginate(appts, page, "", appointmentKey)
+}
+
+// HasPetAppointment reports whether a veterinarian had an appointment for a
+// pet from since that took place by now
+func (m *MemoryStore) HasPetAppointment(
+	ctx context.Context,
+	petID, vetID string,
+	since, now time.Time,
+) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, a := range m.appointments {
+		if a.PetID == petID && a.VeterinarianID == vetID && !a.AppointmentDate.Before(since) &&
+			a.tookPlace(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// filterAppointmentsLocked returns matching appointments in creation order
+func (m *MemoryStore) filterAppointmentsLocked(match func(Appointment) bool) []Appointment {
+	appts := []Appointment{}
+	for _, a := range m.appointments {
+		if match(a) {
+			appts = append(appts, a)
+		}
+	}
+	sort.Slice(appts, func(i, j int) bool {
+		return createdBefore(appts[i].CreatedAt, appts[i].ID, appts[j].CreatedAt, appts[j].ID)
+	})
+	return appts
+}
+
+// GetAppointmentByID retrieves a specific appointment
+func (m *MemoryStore) GetAppointmentByID(
+	ctx context.Context,
+	appointmentID string,
+) (*Appointment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.appointments[appointmentID]
+	if !ok {
+		return nil, notFound("appointment")
+	}
+	return &a, nil
+}
+
+// CreateAppointment creates a new appointment
+func (m *MemoryStore) CreateAppointment(ctx context.Context, appointment *Appointment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.appointments[appointment.ID]; ok {
+		return fmt.Errorf("appointment %s: %w", appointment.ID, ErrConflict)
+	}
+	if _, ok := m.clients[appointment.ClientID]; !ok {
+		return notFound("client")
+	}
+	if _, ok := m.vets[appointment.VeterinarianID]; !ok {
+		return notFound("veterinarian")
+	}
+	if _, ok := m.pets[appointment.PetID]; !ok {
+		return notFound("pet")
+	}
+	appointment.Version = 1
+	m.appointments[appointment.ID] = *appointment
+	return nil
+}
+
+// UpdateAppointment updates an existing appointment unless its version is stale
+func (m *MemoryStore) UpdateAppointment(ctx context.Context, appointment *Appointment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.appointments[appointment.ID]
+	if !ok {
+		return notFound("appointment")
+	}
+	if err := checkVersion("appointment", current.Version, appointment.Version); err != nil {
+		return err
+	}
+	appointment.Version = current.Version + 1
+	m.appointments[appointment.ID] = *appointment
+	return nil
+}
+
+// DeleteAppointment deletes an appointment by ID
+func (m *MemoryStore) DeleteAppointment(ctx context.Context, appointmentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteAppointmentLocked(appointmentID)
+	return nil
+}
+
+// deleteAppointmentLocked removes an appointment and unlinks records (ON DELETE SET NULL)
+func (m *MemoryStore) deleteAppointmentLocked(appointmentID string) {
+	delete(m.appointments, appointmentID)
+	for id, r := range m.records {
+		if r.AppointmentID != nil && *r.AppointmentID == appointmentID {
+			r.AppointmentID = nil
+			r.Version++
+			m.records[id] = r
+		}
+	}
+}
+
+// GetAvailableAppointmentSlots retrieves available time slots for a veterinarian
+func (m *MemoryStore) GetAvailableAppointmentSlots(
+	ctx context.Context,
+	vetID string,
+	date time.Time,
+) ([]TimeSlot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	vet, ok := m.vets[vetID]
+	if !ok {
+		return nil, notFound("veterinarian")
+	}
+
+	startOfDay, endOfDay := clinicDayBounds(date)
+	appts := m.filterAppointmentsLocked(func(a Appointment) bool {
+		return a.VeterinarianID == vetID &&
+			!a.AppointmentDate.Before(startOfDay) &&
+			a.AppointmentDate.Before(endOfDay)
+	})
+
+	return buildTimeSlots(&vet, appts, date), nil
+}
+
+// Product operations
+
+// GetProductsByVeterinarianID retrieves a page of active products for a veterinarian
+func (m *MemoryStore) GetProductsByVeterinarianID(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Product, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	products := m.filterProductsLocked(func(p Product) bool {
+		return p.IsActive && p.VeterinarianID == vetID
+	})
+	return paginate(products, page, "", createdProductKey)
+}
+
+// filterProductsLocked returns matching products in creation order
+func (m *MemoryStore) filterProductsLocked(match func(Product) bool) []Product {
+	products := []Product{}
+	for _, p := range m.products {
+		if match(p) {
+			products = append(products, cloneProduct(p))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return createdBefore(products[i].CreatedAt, products[i].ID, products[j].CreatedAt, products[j].ID)
+	})
+	return products
+}
+
+// GetProductByID retrieves a specific product
+func (m *MemoryStore) GetProductByID(ctx context.Context, productID string) (*Product, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.products[productID]
+	if !ok {
+		return nil, notFound("product")
+	}
+	p = cloneProduct(p)
+	return &p, nil
+}
+
+// CreateProduct creates a new product
+func (m *MemoryStore) CreateProduct(ctx context.Context, product *Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[product.ID]; ok || m.trashedLocked(product.ID) {
+		return fmt.Errorf("product %s: %w", product.ID, ErrConflict)
+	}
+	if product.SKU != "" {
+		for _, p := range m.products {
+			if p.SKU == product.SKU {
+				return fmt.Errorf("product sku %s: %w", product.SKU, ErrConflict)
+			}
+		}
+	}
+	if _, ok := m.vets[product.VeterinarianID]; !ok {
+		return notFound("veterinarian")
+	}
+	product.Version = 1
+	m.products[product.ID] = cloneProduct(*product)
+	if product.StockQuantity != 0 {
+		m.stock = append(m.stock, *openingMovement(product))
+	}
+	return nil
+}
+
+// UpdateProduct updates an existing product unless its version is stale
+func (m *MemoryStore) UpdateProduct(ctx context.Context, product *Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.updateProductLocked(product)
+}
+
+// UpdateProductWithStock updates a product and adjusts its stock to
+// product.StockQuantity under the same lock
+func (m *MemoryStore) UpdateProductWithStock(
+	ctx context.Context,
+	product *Product,
+	adjustment *StockMovement,
+) error {
+	if product.StockQuantity < 0 {
+		return fmt.Errorf("%w: stock cannot be negative", ErrInvalidStockMovement)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sm := range m.stock {
+		if sm.ID == adjustment.ID {
+			return fmt.Errorf("stock movement: %w", ErrConflict)
+		}
+	}
+	current, ok := m.products[product.ID]
+	if !ok {
+		return notFound("product")
+	}
+	adjustment.ProductID = product.ID
+	adjustment.Type = StockAdjustment
+	adjustment.Quantity = product.StockQuantity - current.StockQuantity
+	if err := m.updateProductLocked(product); err != nil {
+		return err
+	}
+	if adjustment.Quantity != 0 {
+		m.applyStockLocked(adjustment)
+		product.Version = m.products[product.ID].Version
+	}
+	return nil
+}
+
+// updateProductLocked saves every field of product except its stock
+func (m *MemoryStore) updateProductLocked(product *Product) error {
+	current, ok := m.products[product.ID]
+	if !ok {
+		return notFound("product")
+	}
+	if err := checkVersion("product", current.Version, product.Version); err != nil {
+		return err
+	}
+	if product.SKU != "" {
+		for id, p := range m.products {
+			if id != product.ID && p.SKU == product.SKU {
+				return fmt.Errorf("product sku %s: %w", product.SKU, ErrConflict)
+			}
+		}
+	}
+	product.Version = current.Version + 1
+	stored := cloneProduct(*product)
+	stored.StockQuantity = current.StockQuantity
+	m.products[product.ID] = stored
+	return nil
+}
+
+// DeleteProduct deactivates a product and moves it to the trash
+func (m *MemoryStore) DeleteProduct(ctx context.Context, productID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[productID]; ok {
+		m.trashProductLocked(productID, time.Now())
+	}
+	return nil
+}
+
+// trashProductLocked deactivates a live product and moves it to the trash
+func (m *MemoryStore) trashProductLocked(productID string, at time.Time) {
+	p := m.products[productID]
+	delete(m.products, productID)
+	p.IsActive = false
+	p.Version++
+	m.trashLocked(EntityProduct, p.ID, p.Name, at, p)
+}
+
+// deleteProductLocked removes a product and cascades to order items and
+// stock movements
+func (m *MemoryStore) deleteProductLocked(productID string) {
+	delete(m.products, productID)
+	for id, it := range m.orderItems {
+		if it.ProductID == productID {
+			delete(m.orderItems, id)
+		}
+	}
+	m.stock = slices.DeleteFunc(m.stock, func(sm StockMovement) bool {
+		return sm.ProductID == productID
+	})
+}
+
+// ListProducts retrieves active products with filtering, sorting and a total count
+func (m *MemoryStore) ListProducts(
+	ctx context.Context,
+	filters ProductFilters,
+	page Page,
+) (*ProductPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := searchTerms(filters.Search)
+	products := m.filterProductsLocked(func(p Product) bool {
+		return matchesProductFilters(p, filters, terms)
+	})
+	sortProducts(products, filters.Sort)
+
+	total := len(products)
+	products, next, err := paginate(products, page, filters.Sort, func(p Product) cursor {
+		return productKey(p, filters.Sort)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ProductPage{Products: products, NextCursor: next, Total: total}, nil
+}
+
+// RecordStockMovement applies a movement to a product's stock and appends it
+// to the ledger
+func (m *MemoryStore) RecordStockMovement(ctx context.Context, movement *StockMovement) error {
+	if err := validateStockMovement(movement); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sm := range m.stock {
+		if sm.ID == movement.ID {
+			return fmt.Errorf("stock movement: %w", ErrConflict)
+		}
+	}
+	p, ok := m.products[movement.ProductID]
+	if !ok {
+		return notFound("product")
+	}
+	if _, ok := m.orders[movement.OrderID]; movement.OrderID != "" && !ok {
+		return notFound("order")
+	}
+	if p.StockQuantity+movement.Quantity < 0 {
+		return &InsufficientStockError{
+			ProductID: p.ID,
+			Requested: -movement.Quantity,
+			Available: p.StockQuantity,
+		}
+	}
+	m.applyStockLocked(movement)
+	return nil
+}
+
+// applyStockLocked adds movement to its product's stock and the ledger
+func (m *MemoryStore) applyStockLocked(movement *StockMovement) {
+	p := m.products[movement.ProductID]
+	p.StockQuantity += movement.Quantity
+	p.Version++
+	m.products[p.ID] = p
+	movement.BalanceAfter = p.StockQuantity
+	m.stock = append(m.stock, *movement)
+}
+
+// ListStockMovements retrieves a page of a product's stock movements, newest first
+func (m *MemoryStore) ListStockMovements(
+	ctx context.Context,
+	productID string,
+	page Page,
+) ([]StockMovement, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.products[productID]; !ok {
+		return nil, "", notFound("product")
+	}
+	movements := []StockMovement{}
+	for _, sm := range m.stock {
+		if sm.ProductID == productID {
+			movements = append(movements, sm)
+		}
+	}
+	slices.SortFunc(movements, func(a, b StockMovement) int {
+		return stockMovementKey(a).compare(stockMovementKey(b))
+	})
+	return paginate(movements, page, sortByNewest, stockMovementKey)
+}
+
+// Order operations
+
+// GetOrdersByClientID retrieves a page of orders for a client
+func (m *MemoryStore) GetOrdersByClientID(
+	ctx context.Context,
+	clientID string,
+	page Page,
+) ([]Order, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orders := m.filterOrdersLocked(func(o Order) bool { return o.ClientID == clientID })
+	return paginate(orders, page, "", orderKey)
+}
+
+// GetOrdersByVeterinarianID retrieves a page of orders for a veterinarian
+func (m *MemoryStore) GetOrdersByVeterinarianID(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Order, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orders := m.filterOrdersLocked(func(o Order) bool { return o.VeterinarianID == vetID })
+	return paginate(orders, page, "", orderKey)
+}
+
+// filterOrdersLocked returns matching orders in creation order
+func (m *MemoryStore) filterOrdersLocked(match func(Order) bool) []Order {
+	orders := []Order{}
+	for _, o := range m.orders {
+		if match(o) {
+			orders = append(orders, o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return createdBefore(orders[i].CreatedAt, orders[i].ID, orders[j].CreatedAt, orders[j].ID)
+	})
+	return orders
+}
+
+// GetOrderByID retrieves a specific order
+func (m *MemoryStore) GetOrderByID(ctx context.Context, orderID string) (*Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	o, ok := m.orders[orderID]
+	if !ok {
+		return nil, notFound("order")
+	}
+	o = storedOrder(o)
+	return &o, nil
+}
+
+// storedOrder copies an order so callers cannot change the stored tax lines
+// and discounts
+func storedOrder(o Order) Order {
+	o.TaxLines = slices.Clone(o.TaxLines)
+	o.Discounts = slices.Clone(o.Discounts)
+	return o
+}
+
+// CreateOrder creates a new order
+func (m *MemoryStore) CreateOrder(ctx context.Context, order *Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orders[order.ID]; ok {
+		return fmt.Errorf("order %s: %w", order.ID, ErrConflict)
+	}
+	if _, ok := m.clients[order.ClientID]; !ok {
+		return notFound("client")
+	}
+	if _, ok := m.vets[order.VeterinarianID]; !ok {
+		return notFound("veterinarian")
+	}
+	m.orders[order.ID] = storedOrder(*order)
+	return nil
+}
+
+// TransitionOrder moves an order to a new status and records the change,
+// restocking the order's items when it is cancelled
+func (m *MemoryStore) TransitionOrder(ctx context.Context, change *OrderStatusChange) error {
+	if err := validateOrderTransition(change); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[change.OrderID]
+	if !ok {
+		return notFound("order")
+	}
+	if o.Status != change.FromStatus {
+		return orderMovedError(change, o.Status)
+	}
+	if err := checkPaidCancellation(change, o.PaymentStatus); err != nil {
+		return err
+	}
+
+	if change.ToStatus == OrderCancelled {
+		for _, it := range m.orderItems {
+			if _, live := m.products[it.ProductID]; it.OrderID == o.ID && live {
+				m.applyStockLocked(cancellationRestock(change, it))
+			}
+		}
+	}
+	o.Status = change.ToStatus
+	if change.PaymentStatus != "" {
+		o.PaymentStatus = change.PaymentStatus
+	}
+	o.UpdatedAt = change.CreatedAt
+	m.orders[o.ID] = o
+	entry := *change
+	entry.PaymentStatus = ""
+	m.orderHistory = append(m.orderHistory, entry)
+	return nil
+}
+
+// GetOrderStatusHistory lists an order's status changes, oldest first
+func (m *MemoryStore) GetOrderStatusHistory(
+	ctx context.Context,
+	orderID string,
+) ([]OrderStatusChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.orders[orderID]; !ok {
+		return nil, notFound("order")
+	}
+	history := []OrderStatusChange{}
+	for _, c := range m.orderHistory {
+		if c.OrderID == orderID {
+			history = append(history, c)
+		}
+	}
+	return history, nil
+}
+
+// deleteOrderLocked removes an order and cascades to its items and payments
+func (m *MemoryStore) deleteOrderLocked(orderID string) {
+	delete(m.orders, orderID)
+	for id, it := range m.orderItems {
+		if it.OrderID == orderID {
+			delete(m.orderItems, id)
+		}
+	}
+	for id, p := range m.payments {
+		if p.OrderID == orderID {
+			delete(m.payments, id)
+		}
+	}
+	for id, ret := range m.returns {
+		if ret.OrderID == orderID {
+			delete(m.returns, id)
+		}
+	}
+	m.orderHistory = slices.DeleteFunc(m.orderHistory, func(c OrderStatusChange) bool {
+		return c.OrderID == orderID
+	})
+}
+
+// GetOrderItems retrieves items for an order
+func (m *MemoryStore) GetOrderItems(ctx context.Context, orderID string) ([]OrderItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := []OrderItem{}
+	for _, it := range m.orderItems {
+		if it.OrderID == orderID {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return createdBefore(items[i].CreatedAt, items[i].ID, items[j].CreatedAt, items[j].ID)
+	})
+	return items, nil
+}
+
+// CreateOrderItem creates a new order item
+func (m *MemoryStore) CreateOrderItem(ctx context.Context, item *OrderItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orderItems[item.ID]; ok {
+		return fmt.Errorf("order item %s: %w", item.ID, ErrConflict)
+	}
+	if _, ok := m.orders[item.OrderID]; !ok {
+		return notFound("order")
+	}
+	if _, ok := m.products[item.ProductID]; !ok {
+		return notFound("product")
+	}
+	m.orderItems[item.ID] = *item
+	return nil
+}
+
+// PlaceOrder inserts an order with its items and decrements stock atomically
+func (m *MemoryStore) PlaceOrder(ctx context.Context, order *Order, items []OrderItem) error {
+	if err := validateOrderPlacement(order, items); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.placeOrderLocked(order, items)
+}
+
+// placeOrderLocked validates and writes an order placement; nothing is
+// written unless every line can be sold
+func (m *MemoryStore) placeOrderLocked(order *Order, items []OrderItem) error {
+	sales, err := m.prepareOrderLocked(order, items, make(map[string]int))
+	if err != nil {
+		return err
+	}
+	m.writeOrderLocked(order, items, sales)
+	return nil
+}
+
+// prepareOrderLocked validates an order placement without writing it. It
+// prices the items and the order and returns the sale movements to apply.
+// claimed counts the promotion uses taken by orders prepared alongside it,
+// which writeOrderLocked has yet to record.
+func (m *MemoryStore) prepareOrderLocked(
+	order *Order,
+	items []OrderItem,
+	claimed map[string]int,
+) ([]*StockMovement, error) {
+	if _, ok := m.orders[order.ID]; ok {
+		return nil, fmt.Errorf("order %s: %w", order.ID, ErrConflict)
+	}
+	if _, ok := m.clients[order.ClientID]; !ok {
+		return nil, notFound("client")
+	}
+	if _, ok := m.vets[order.VeterinarianID]; !ok {
+		return nil, notFound("veterinarian")
+	}
+
+	// Validate every line against a working copy of stock before writing anything
+	remaining := make(map[string]int)
+	sales := make([]*StockMovement, 0, len(items))
+	categories := make(map[string]string, len(items))
+	var total Money
+	for i := range items {
+		p, ok := m.products[items[i].ProductID]
+		if !ok || !p.IsActive {
+			return nil, notFound("product " + items[i].ProductID)
+		}
+		if p.VeterinarianID != order.VeterinarianID {
+			return nil, fmt.Errorf("%w: all products must be from the same veterinarian", ErrInvalidOrder)
+		}
+		stock, seen := remaining[p.ID]
+		if !seen {
+			stock = p.StockQuantity - m.reservedLocked(p.ID, time.Now())
+		}
+		if stock < items[i].Quantity {
+			return nil, &InsufficientStockError{
+				ProductID: p.ID,
+				Requested: items[i].Quantity,
+				Available: stock,
+			}
+		}
+		remaining[p.ID] = stock - items[i].Quantity
+
+		sale := NewStockMovement(p.ID, StockSale, -items[i].Quantity, order.placer())
+		sale.OrderID = order.ID
+		sales = append(sales, sale)
+
+		items[i].OrderID = order.ID
+		items[i].UnitPrice = p.Price
+		items[i].TotalPrice = p.Price.Mul(items[i].Quantity)
+		sum, err := total.Add(items[i].TotalPrice)
+		if err != nil {
+			return nil, fmt.Errorf("%w: all products must be priced in the same currency", ErrInvalidOrder)
+		}
+		total = sum
+		categories[p.ID] = p.Category
+	}
+
+	promotions := m.promotionsLocked(order.VeterinarianID, order.DiscountCode, time.Now())
+	discounts, err := applyPromotions(order, items, categories, promotions,
+		m.orderHistoryLocked(order), func(p *Promotion) (bool, error) {
+			if p.UsageLimit > 0 && p.UsageCount+claimed[p.ID] >= p.UsageLimit {
+				return false, nil
+			}
+			claimed[p.ID]++
+			return true, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	settings := m.taxSettingsLocked(order.VeterinarianID)
+	applyTax(order, items, categories, discounts, &settings)
+	return sales, nil
+}
+
+// writeOrderLocked writes an order prepared by prepareOrderLocked
+func (m *MemoryStore) writeOrderLocked(order *Order, items []OrderItem, sales []*StockMovement) {
+	m.orders[order.ID] = storedOrder(*order)
+	for _, it := range items {
+		m.orderItems[it.ID] = it
+	}
+	for _, sale := range sales {
+		m.applyStockLocked(sale)
+	}
+	for _, d := range order.Discounts {
+		if p, ok := m.promotions[d.PromotionID]; ok {
+			p.UsageCount++
+			m.promotions[p.ID] = p
+		}
+	}
+}
+
+// placeCheckoutLocked places items as one order per veterinarian. Every
+// order is prepared before any is written, so either all are placed or none
+// is; a checkout's orders never share a product, so preparing one cannot
+// change what another may sell.
+func (m *MemoryStore) placeCheckoutLocked(template *Order, items []OrderItem) (*Checkout, error) {
+	products := make(map[string]Product, len(items))
+	for _, it := range items {
+		if p, ok := m.products[it.ProductID]; ok && p.IsActive {
+			products[p.ID] = p
+		}
+	}
+	checkout, err := splitCheckout(template, items, products)
+	if err != nil {
+		return nil, err
+	}
+
+	sales := make([][]*StockMovement, len(checkout.Orders))
+	claimed := make(map[string]int)
+	for i := range checkout.Orders {
+		o := &checkout.Orders[i]
+		if sales[i], err = m.prepareOrderLocked(&o.Order, o.Items, claimed); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkout.total(); err != nil {
+		return nil, err
+	}
+	for i := range checkout.Orders {
+		o := &checkout.Orders[i]
+		m.writeOrderLocked(&o.Order, o.Items, sales[i])
+	}
+	return checkout, nil
+}
+
+// Reservation operations
+
+// reservedLocked is the stock of a product held by reservations at now
+func (m *MemoryStore) reservedLocked(productID string, now time.Time) int {
+	reserved := 0
+	for _, res := range m.reservations {
+		if !res.holds(now) {
+			continue
+		}
+		for _, it := range res.Items {
+			if it.ProductID == productID {
+				reserved += it.Quantity
+			}
+		}
+	}
+	return reserved
+}
+
+// CreateReservation holds stock for a client if enough of every product is available
+func (m *MemoryStore) CreateReservation(ctx context.Context, reservation *Reservation) error {
+	if err := validateReservation(reservation); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[reservation.ID]; ok {
+		return fmt.Errorf("reservation %s: %w", reservation.ID, ErrConflict)
+	}
+	if _, ok := m.clients[reservation.ClientID]; !ok {
+		return notFound("client")
+	}
+	now := time.Now()
+	for _, it := range reservation.Items {
+		p, ok := m.products[it.ProductID]
+		if !ok || !p.IsActive {
+			return notFound("product " + it.ProductID)
+		}
+		if available := p.StockQuantity - m.reservedLocked(p.ID, now); available < it.Quantity {
+			return &InsufficientStockError{
+				ProductID: p.ID,
+				Requested: it.Quantity,
+				Available: available,
+			}
+		}
+	}
+	m.reservations[reservation.ID] = cloneReservation(*reservation)
+	return nil
+}
+
+// GetReservationByID retrieves a specific reservation
+func (m *MemoryStore) GetReservationByID(
+	ctx context.Context,
+	reservationID string,
+) (*Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res, ok := m.reservations[reservationID]
+	if !ok {
+		return nil, notFound("reservation")
+	}
+	res = cloneReservation(res)
+	return &res, nil
+}
+
+// ReleaseReservation gives the stock a reservation holds back before it expires
+func (m *MemoryStore) ReleaseReservation(ctx context.Context, reservationID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res, ok := m.reservations[reservationID]
+	if !ok {
+		return notFound("reservation")
+	}
+	if !res.holds(time.Now()) {
+		return fmt.Errorf("reservation %s: %w", reservationID, ErrReservationClosed)
+	}
+	res.Status = ReservationReleased
+	res.UpdatedAt = time.Now()
+	m.reservations[reservationID] = res
+	return nil
+}
+
+// ConfirmReservation converts a reservation into a checkout of one order per
+// veterinarian for its items
+func (m *MemoryStore) ConfirmReservation(
+	ctx context.Context,
+	reservationID string,
+	template *Order,
+) (*Checkout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res, ok := m.reservations[reservationID]
+	if !ok {
+		return nil, notFound("reservation")
+	}
+	if !res.holds(time.Now()) {
+		return nil, fmt.Errorf("reservation %s: %w", reservationID, ErrReservationClosed)
+	}
+	if template.ClientID != res.ClientID {
+		return nil, fmt.Errorf("%w: order is not for the reservation's client", ErrInvalidOrder)
+	}
+
+	// The reservation stops holding its stock so the orders can take it
+	converted := res
+	converted.Status = ReservationConverted
+	converted.UpdatedAt = time.Now()
+	m.reservations[reservationID] = converted
+	checkout, err := m.placeCheckoutLocked(template, res.orderItems())
+	if err != nil {
+		m.reservations[reservationID] = res
+		return nil, err
+	}
+	converted.CheckoutID = checkout.ID
+	m.reservations[reservationID] = converted
+	return checkout, nil
+}
+
+// ExpireReservations marks reservations that lapsed before now expired
+func (m *MemoryStore) ExpireReservations(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for id, res := range m.reservations {
+		if res.Status == ReservationActive && !now.Before(res.ExpiresAt) {
+			res.Status = ReservationExpired
+			res.UpdatedAt = now
+			m.reservations[id] = res
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// Payment operations
+
+// UpdateOrderPaymentStatus sets an order's payment status
+func (m *MemoryStore) UpdateOrderPaymentStatus(
+	ctx context.Context,
+	orderID string,
+	paymentStatus string,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[orderID]
+	if !ok {
+		return notFound("order")
+	}
+	o.PaymentStatus = paymentStatus
+	o.UpdatedAt = time.Now()
+	m.orders[orderID] = o
+	return nil
+}
+
+// CreatePayment records a payment attempt for an existing order
+func (m *MemoryStore) CreatePayment(ctx context.Context, payment *Payment) error {
+	if err := validatePayment(payment); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orders[payment.OrderID]; !ok {
+		return notFound("order")
+	}
+	if _, exists := m.payments[payment.ID]; exists {
+		return fmt.Errorf("payment %s: %w", payment.ID, ErrConflict)
+	}
+	for _, p := range m.payments {
+		if p.Provider == payment.Provider && p.IntentID == payment.IntentID {
+			return fmt.Errorf("payment intent %s: %w", payment.IntentID, ErrConflict)
+		}
+		if p.OrderID == payment.OrderID && p.Status == PaymentPending &&
+			payment.Status == PaymentPending {
+			return fmt.Errorf("order %s already has a pending payment: %w", p.OrderID, ErrConflict)
+		}
+	}
+	m.payments[payment.ID] = *payment
+	return nil
+}
+
+// GetPaymentByID retrieves a specific payment attempt
+func (m *MemoryStore) GetPaymentByID(ctx context.Context, paymentID string) (*Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.payments[paymentID]
+	if !ok {
+		return nil, notFound("payment")
+	}
+	return &p, nil
+}
+
+// GetPaymentByIntentID retrieves the payment attempt for a gateway intent
+func (m *MemoryStore) GetPaymentByIntentID(
+	ctx context.Context,
+	provider, intentID string,
+) (*Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.payments {
+		if p.Provider == provider && p.IntentID == intentID {
+			return &p, nil
+		}
+	}
+	return nil, notFound("payment")
+}
+
+// GetOrderPayments lists an order's payment attempts, oldest first
+func (m *MemoryStore) GetOrderPayments(ctx context.Context, orderID string) ([]Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	payments := []Payment{}
+	for _, p := range m.payments {
+		if p.OrderID == orderID {
+			payments = append(payments, p)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return createdBefore(payments[i].CreatedAt, payments[i].ID,
+			payments[j].CreatedAt, payments[j].ID)
+	})
+	return payments, nil
+}
+
+// SetPaymentStatus moves a payment attempt and its order's payment status
+// to status together
+func (m *MemoryStore) SetPaymentStatus(
+	ctx context.Context,
+	paymentID string,
+	status string,
+	failureReason string,
+) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.payments[paymentID]
+	if !ok {
+		return nil, notFound("payment")
+	}
+	if !canTransitionPayment(p.Status, status) {
+		return nil, paymentTransitionError(&p, status)
+	}
+	now := time.Now()
+	p.Status = status
+	p.FailureReason = failureReason
+	p.UpdatedAt = now
+	m.payments[paymentID] = p
+
+	if o, ok := m.orders[p.OrderID]; ok {
+		o.PaymentStatus = status
+		o.UpdatedAt = now
+		m.orders[p.OrderID] = o
+	}
+	return &p, nil
+}
+
+// RecordPaymentRefund records the total refunded of a payment attempt and
+// moves its order's payment status with it
+func (m *MemoryStore) RecordPaymentRefund(
+	ctx context.Context,
+	paymentID string,
+	refunded Money,
+) (*Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.payments[paymentID]
+	if !ok {
+		return nil, notFound("payment")
+	}
+	if err := refundPayment(&p, refunded); err != nil {
+		return nil, err
+	}
+	m.payments[paymentID] = p
+
+	if o, ok := m.orders[p.OrderID]; ok {
+		o.PaymentStatus = p.Status
+		o.UpdatedAt = p.UpdatedAt
+		m.orders[p.OrderID] = o
+	}
+	return &p, nil
+}
+
+// Return operations
+
+// storedReturn copies ret so callers cannot change the stored items
+func storedReturn(ret Return) Return {
+	ret.Items = slices.Clone(ret.Items)
+	return ret
+}
+
+// orderReturnsLocked lists an order's returns, oldest first
+func (m *MemoryStore) orderReturnsLocked(orderID string) []Return {
+	returns := []Return{}
+	for _, ret := range m.returns {
+		if ret.OrderID == orderID {
+			returns = append(returns, storedReturn(ret))
+		}
+	}
+	sort.Slice(returns, func(i, j int) bool {
+		return createdBefore(returns[i].CreatedAt, returns[i].ID,
+			returns[j].CreatedAt, returns[j].ID)
+	})
+	return returns
+}
+
+// CreateReturn records a return request for items of a delivered order
+func (m *MemoryStore) CreateReturn(ctx context.Context, ret *Return) error {
+	if err := validateReturn(ret); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[ret.OrderID]
+	if !ok {
+		return notFound("order")
+	}
+	if _, exists := m.returns[ret.ID]; exists {
+		return fmt.Errorf("return %s: %w", ret.ID, ErrConflict)
+	}
+	items := []OrderItem{}
+	for _, it := range m.orderItems {
+		if it.OrderID == o.ID {
+			items = append(items, it)
+		}
+	}
+	returned := returnedQuantities(m.orderReturnsLocked(o.ID))
+	if err := priceReturn(ret, &o, items, returned); err != nil {
+		return err
+	}
+	m.returns[ret.ID] = storedReturn(*ret)
+	return nil
+}
+
+// GetReturnByID retrieves a specific return with its items
+func (m *MemoryStore) GetReturnByID(ctx context.Context, returnID string) (*Return, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ret, ok := m.returns[returnID]
+	if !ok {
+		return nil, notFound("return")
+	}
+	ret = storedReturn(ret)
+	return &ret, nil
+}
+
+// GetOrderReturns lists an order's returns with their items, oldest first
+func (m *MemoryStore) GetOrderReturns(ctx context.Context, orderID string) ([]Return, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.orders[orderID]; !ok {
+		return nil, notFound("order")
+	}
+	return m.orderReturnsLocked(orderID), nil
+}
+
+// ReviewReturn approves or rejects a requested return, restocking approved
+// items marked restock whose product is not in the trash
+func (m *MemoryStore) ReviewReturn(ctx context.Context, review *ReturnReview) (*Return, error) {
+	if err := validateReturnReview(review); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret, ok := m.returns[review.ReturnID]
+	if !ok {
+		return nil, notFound("return")
+	}
+	ret = storedReturn(ret)
+	if err := reviewReturn(&ret, review); err != nil {
+		return nil, err
+	}
+	for _, it := range ret.Items {
+		if _, live := m.products[it.ProductID]; it.Disposition == ReturnRestock && live {
+			m.applyStockLocked(returnRestock(&ret, it))
+		}
+	}
+	m.returns[ret.ID] = storedReturn(ret)
+	return &ret, nil
+}
+
+// MarkReturnRefunded records the payment an approved return was refunded from
+func (m *MemoryStore) MarkReturnRefunded(
+	ctx context.Context,
+	returnID, paymentID string,
+) (*Return, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret, ok := m.returns[returnID]
+	if !ok {
+		return nil, notFound("return")
+	}
+	ret = storedReturn(ret)
+	if err := refundReturn(&ret, paymentID); err != nil {
+		return nil, err
+	}
+	m.returns[ret.ID] = storedReturn(ret)
+	return &ret, nil
+}
+
+// Invoice operations
+
+// storedInvoice copies an invoice so callers cannot change the stored lines
+func storedInvoice(inv Invoice) Invoice {
+	inv.Lines = slices.Clone(inv.Lines)
+	inv.TaxLines = slices.Clone(inv.TaxLines)
+	return inv
+}
+
+// IssueInvoice numbers an invoice or credit note and stores it
+func (m *MemoryStore) IssueInvoice(ctx context.Context, inv *Invoice) error {
+	if err := validateInvoice(inv); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	credited := inv.Kind != InvoiceKindCreditNote
+	sequence := 0
+	for _, other := range m.invoices {
+		switch {
+		case other.ID == inv.ID:
+			return fmt.Errorf("invoice %s: %w", inv.ID, ErrConflict)
+		case inv.Kind == InvoiceKindInvoice && other.Kind == InvoiceKindInvoice &&
+			other.OrderID == inv.OrderID:
+			return fmt.Errorf("order %s already has an invoice: %w", inv.OrderID, ErrConflict)
+		case inv.ReturnID != "" && other.ReturnID == inv.ReturnID:
+			return fmt.Errorf("return %s already has a credit note: %w", inv.ReturnID, ErrConflict)
+		}
+		if other.ID == inv.InvoiceID && other.Kind == InvoiceKindInvoice &&
+			other.OrderID == inv.OrderID {
+			credited = true
+		}
+		if other.VeterinarianID == inv.VeterinarianID && other.Kind == inv.Kind {
+			sequence = max(sequence, other.Sequence)
+		}
+	}
+	if !credited {
+		return notFound("invoice")
+	}
+	inv.Sequence = sequence + 1
+	inv.Number = invoiceNumber(inv.Kind, inv.Sequence)
+	m.invoices = append(m.invoices, storedInvoice(*inv))
+	return nil
+}
+
+// GetInvoiceByID retrieves a specific invoice or credit note
+func (m *MemoryStore) GetInvoiceByID(ctx context.Context, invoiceID string) (*Invoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, inv := range m.invoices {
+		if inv.ID == invoiceID {
+			inv = storedInvoice(inv)
+			return &inv, nil
+		}
+	}
+	return nil, notFound("invoice")
+}
+
+// GetOrderInvoice retrieves the invoice issued for an order
+func (m *MemoryStore) GetOrderInvoice(ctx context.Context, orderID string) (*Invoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, inv := range m.invoices {
+		if inv.OrderID == orderID && inv.Kind == InvoiceKindInvoice {
+			inv = storedInvoice(inv)
+			return &inv, nil
+		}
+	}
+	return nil, notFound("invoice")
+}
+
+// GetOrderCreditNotes lists the credit notes issued for an order, oldest first
+func (m *MemoryStore) GetOrderCreditNotes(ctx context.Context, orderID string) ([]Invoice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	notes := []Invoice{}
+	for _, inv := range m.invoices {
+		if inv.OrderID == orderID && inv.Kind == InvoiceKindCreditNote {
+			notes = append(notes, storedInvoice(inv))
+		}
+	}
+	return notes, nil
+}
+
+// Tax operations
+
+// taxSettingsLocked returns a veterinarian's tax settings, which have no
+// rates until they are set
+func (m *MemoryStore) taxSettingsLocked(vetID string) TaxSettings {
+	settings, ok := m.taxSettings[vetID]
+	if !ok {
+		return TaxSettings{VeterinarianID: vetID, Rates: []TaxRate{}}
+	}
+	settings.Rates = slices.Clone(settings.Rates)
+	return settings
+}
+
+// GetTaxSettings retrieves a veterinarian's tax settings
+func (m *MemoryStore) GetTaxSettings(ctx context.Context, vetID string) (*TaxSettings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.vets[vetID]; !ok {
+		return nil, notFound("veterinarian")
+	}
+	settings := m.taxSettingsLocked(vetID)
+	return &settings, nil
+}
+
+// SetTaxSettings replaces a veterinarian's tax settings
+func (m *MemoryStore) SetTaxSettings(ctx context.Context, settings *TaxSettings) error {
+	if err := validateTaxSettings(settings); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.vets[settings.VeterinarianID]; !ok {
+		return notFound("veterinarian")
+	}
+	stored := *settings
+	stored.Rates = slices.Clone(settings.Rates)
+	m.taxSettings[settings.VeterinarianID] = stored
+	return nil
+}
+
+// Promotion operations
+
+// storedPromotion copies a promotion so callers cannot change the stored
+// products and categories
+func storedPromotion(p Promotion) Promotion {
+	p.ProductIDs = slices.Clone(p.ProductIDs)
+	p.Categories = slices.Clone(p.Categories)
+	if p.ProductIDs == nil {
+		p.ProductIDs = []string{}
+	}
+	if p.Categories == nil {
+		p.Categories = []string{}
+	}
+	return p
+}
+
+// checkPromotionLocked checks a promotion about to be written: its
+// veterinarian exists and no other promotion has its code
+func (m *MemoryStore) checkPromotionLocked(promotion *Promotion) error {
+	if promotion.VeterinarianID != "" {
+		if _, ok := m.vets[promotion.VeterinarianID]; !ok {
+			return notFound("veterinarian")
+		}
+	}
+	if promotion.Code == "" {
+		return nil
+	}
+	for _, p := range m.promotions {
+		if p.Code == promotion.Code && p.ID != promotion.ID {
+			return fmt.Errorf("promotion code %s: %w", promotion.Code, ErrConflict)
+		}
+	}
+	return nil
+}
+
+// CreatePromotion creates a new promotion
+func (m *MemoryStore) CreatePromotion(ctx context.Context, promotion *Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.promotions[promotion.ID]; ok {
+		return fmt.Errorf("promotion %s: %w", promotion.ID, ErrConflict)
+	}
+	if err := m.checkPromotionLocked(promotion); err != nil {
+		return err
+	}
+	m.promotions[promotion.ID] = storedPromotion(*promotion)
+	return nil
+}
+
+// GetPromotionByID retrieves a specific promotion
+func (m *MemoryStore) GetPromotionByID(ctx context.Context, promotionID string) (*Promotion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.promotions[promotionID]
+	if !ok {
+		return nil, notFound("promotion")
+	}
+	p = storedPromotion(p)
+	return &p, nil
+}
+
+// GetPromotionByCode retrieves the promotion with a discount code
+func (m *MemoryStore) GetPromotionByCode(ctx context.Context, code string) (*Promotion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	code = NormalizePromotionCode(code)
+	for _, p := range m.promotions {
+		if code != "" && p.Code == code {
+			p = storedPromotion(p)
+			return &p, nil
+		}
+	}
+	return nil, notFound("promotion")
+}
+
+// ListPromotions lists a veterinarian's promotions, or every promotion
+func (m *MemoryStore) ListPromotions(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Promotion, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	promotions := []Promotion{}
+	for _, p := range m.promotions {
+		if vetID == "" || p.VeterinarianID == vetID {
+			promotions = append(promotions, storedPromotion(p))
+		}
+	}
+	sort.Slice(promotions, func(i, j int) bool {
+		return createdBefore(promotions[i].CreatedAt, promotions[i].ID,
+			promotions[j].CreatedAt, promotions[j].ID)
+	})
+	return paginate(promotions, page, "", promotionKey)
+}
+
+// UpdatePromotion updates a promotion, keeping its usage count
+func (m *MemoryStore) UpdatePromotion(ctx context.Context, promotion *Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.promotions[promotion.ID]
+	if !ok {
+		return notFound("promotion")
+	}
+	if err := m.checkPromotionLocked(promotion); err != nil {
+		return err
+	}
+	promotion.UsageCount = current.UsageCount
+	promotion.CreatedAt = current.CreatedAt
+	promotion.UpdatedAt = time.Now()
+	m.promotions[promotion.ID] = storedPromotion(*promotion)
+	return nil
+}
+
+// DeletePromotion removes a promotion. Orders keep the discounts it gave.
+func (m *MemoryStore) DeletePromotion(ctx context.Context, promotionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.promotions[promotionID]; !ok {
+		return notFound("promotion")
+	}
+	delete(m.promotions, promotionID)
+	return nil
+}
+
+// promotionsLocked returns the promotions that may apply to an order from
+// vetID placed at now with code, in the order they apply
+func (m *MemoryStore) promotionsLocked(vetID, code string, now time.Time) []Promotion {
+	var promotions []Promotion
+	for _, p := range m.promotions {
+		if p.candidate(vetID, code, now) {
+			promotions = append(promotions, storedPromotion(p))
+		}
+	}
+	sortPromotions(promotions)
+	return promotions
+}
+
+// orderHistoryLocked looks up the client's earlier orders for first-order
+// promotions
+func (m *MemoryStore) orderHistoryLocked(order *Order) orderHistory {
+	var history orderHistory
+	for _, o := range m.orders {
+		if o.ClientID != order.ClientID || o.Status == OrderCancelled ||
+			(order.CheckoutGroupID != "" && o.CheckoutGroupID == order.CheckoutGroupID) {
+			continue
+		}
+		history.ordered = true
+		if o.VeterinarianID == order.VeterinarianID {
+			history.orderedFromVet = true
+		}
+	}
+	return history
+}
+
+// Trash operations
+
+// trashLocked records a row that was just removed from its live map
+func (m *MemoryStore) trashLocked(entity, id, name string, at time.Time, row any) {
+	m.trash[id] = trashedRow{
+		item: TrashItem{Entity: entity, ID: id, Name: name, DeletedAt: at},
+		row:  row,
+	}
+}
+
+// trashedLocked reports whether id belongs to a row in the trash, whose ID
+// stays taken until it is purged
+func (m *MemoryStore) trashedLocked(id string) bool {
+	_, ok := m.trash[id]
+	return ok
+}
+
+// ListTrash retrieves a page of deleted rows, most recently deleted first
+func (m *MemoryStore) ListTrash(
+	ctx context.Context,
+	entity string,
+	page Page,
+) ([]TrashItem, string, error) {
+	if _, err := trashTablesFor(entity); err != nil {
+		return nil, "", err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := []TrashItem{}
+	for _, t := range m.trash {
+		if entity == "" || t.item.Entity == entity {
+			items = append(items, t.item)
+		}
+	}
+	sortTrash(items)
+	return paginate(items, page, sortByDeletion, trashKey)
+}
+
+// RestoreDeleted moves a row and the rows trashed along with it back out of the trash
+func (m *MemoryStore) RestoreDeleted(ctx context.Context, entity, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.trash[id]
+	if !ok || t.item.Entity != entity {
+		return notFound(entity)
+	}
+	m.restoreLocked(id)
+
+	// Children deleted in the same call share the timestamp; restoring a
+	// client brings back their pets and, through them, the pets' records
+	restored := map[string]bool{id: true}
+	for changed := true; changed; {
+		changed = false
+		for childID, child := range m.trash {
+			if child.item.DeletedAt.Equal(t.item.DeletedAt) && restored[trashParentID(child.row)] {
+				m.restoreLocked(childID)
+				restored[childID] = true
+				changed = true
+			}
+		}
+	}
+	return nil
+}
+
+// trashParentID returns the ID of the row whose deletion cascades to row
+func trashParentID(row any) string {
+	switch r := row.(type) {
+	case Pet:
+		return r.OwnerID
+	case MedicalRecord:
+		return r.PetID
+	case Product:
+		return r.VeterinarianID
+	}
+	return ""
+}
+
+// restoreLocked puts a trashed row back into its live map
+func (m *MemoryStore) restoreLocked(id string) {
+	switch r := m.trash[id].row.(type) {
+	case Client:
+		m.clients[id] = r
+	case Veterinarian:
+		m.vets[id] = r
+	case Pet:
+		r.Version++
+		m.pets[id] = r
+	case MedicalRecord:
+		r.Version++
+		m.records[id] = r
+	case Product:
+		r.Version++
+		m.products[id] = r
+	}
+	delete(m.trash, id)
+}
+
+// PurgeDeleted permanently removes rows deleted before the cutoff
+func (m *MemoryStore) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, t := range m.trash {
+		if !t.item.DeletedAt.Before(before) {
+			continue
+		}
+		delete(m.trash, id)
+		purged++
+		switch t.row.(type) {
+		case Client:
+			m.purgeClientLocked(id)
+		case Veterinarian:
+			m.purgeVetLocked(id)
+		case Pet:
+			m.deletePetLocked(id)
+		case Product:
+			m.deleteProductLocked(id)
+		}
+	}
+	m.dropOrphanedTrashLocked()
+	return purged, nil
+}
+
+// dropOrphanedTrashLocked removes trashed rows whose parent was purged, which
+// the schema's foreign keys would have cascaded to
+func (m *MemoryStore) dropOrphanedTrashLocked() {
+	exists := func(id string) bool {
+		_, trashed := m.trash[id]
+		_, client := m.clients[id]
+		_, vet := m.vets[id]
+		_, pet := m.pets[id]
+		return trashed || client || vet || pet
+	}
+	for changed := true; changed; {
+		changed = false
+		for id, t := range m.trash {
+			parent := trashParentID(t.row)
+			orphaned := parent != "" && !exists(parent)
+			if r, ok := t.row.(MedicalRecord); ok {
+				orphaned = orphaned || !exists(r.VeterinarianID)
+			}
+			if _, ok := t.row.(Pet); ok && orphaned {
+				m.deletePetLocked(id)
+			}
+			if orphaned {
+				delete(m.trash, id)
+				changed = true
+			}
+		}
+	}
+}
+
+// Audit log operations
+
+// AppendAuditEntry adds an entry to the audit log
+func (m *MemoryStore) AppendAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.audit {
+		if e.ID == entry.ID {
+			return fmt.Errorf("audit entry: %w", ErrConflict)
+		}
+	}
+	e := *entry
+	e.Changes = maps.Clone(entry.Changes)
+	m.audit = append(m.audit, e)
+	return nil
+}
+
+// ListAuditEntries retrieves a page of audit entries matching filter, newest first
+func (m *MemoryStore) ListAuditEntries(
+	ctx context.Context,
+	filter AuditFilter,
+	page Page,
+) ([]AuditEntry, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []AuditEntry{}
+	for _, e := range m.audit {
+		if filter.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b AuditEntry) int {
+		return auditKey(a).compare(auditKey(b))
+	})
+	return paginate(entries, page, sortByNewest, auditKey)
+}
+
+// createdBefore orders rows by creation time, breaking ties by ID
+func createdBefore(at1 time.Time, id1 string, at2 time.Time, id2 string) bool {
+	if !at1.Equal(at2) {
+		return at1.Before(at2)
+	}
+	return id1 < id2
+}
+
+// cloneReservation deep-copies a reservation so callers cannot mutate stored state
+func cloneReservation(r Reservation) Reservation {
+	r.Items = slices.Clone(r.Items)
+	return r
+}
+
+// cloneVeterinarian deep-copies a veterinarian so callers cannot mutate stored state
+func cloneVeterinarian(v Veterinarian) Veterinarian {
+	v.AvailableHours = slices.Clone(v.AvailableHours)
+	return v
+}
+
+// cloneMedicalRecord deep-copies a medical record
+func cloneMedicalRecord(r MedicalRecord) MedicalRecord {
+	r.MedicationPrescribed = slices.Clone(r.MedicationPrescribed)
+	if r.AppointmentID != nil {
+		id := *r.AppointmentID
+		r.AppointmentID = &id
+	}
+	return r
+}
+
+// cloneQRCode deep-copies a QR code
+func cloneQRCode(q QRCode) QRCode {
+	q.EncodedContent.MedicalAlerts = slices.Clone(q.EncodedContent.MedicalAlerts)
+	return q
+}
+
+// cloneProduct deep-copies a product
+func cloneProduct(p Product) Product {
+	p.Images = slices.Clone(p.Images)
+	return p
+}
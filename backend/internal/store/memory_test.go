@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMemoryStoreUserFallback tests that GetUserByID looks in clients then veterinarians
+func TestMemoryStoreUserFallback(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+
+	if err := db.CreateVeterinarian(ctx, &Veterinarian{ID: "vet-1", Email: "vet@example.com"}); err != nil {
+		t.Fatalf("CreateVeterinarian: %v", err)
+	}
+
+	user, err := db.GetUserByID(ctx, "vet-1")
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Role != "veterinarian" {
+		t.Errorf("Expected role veterinarian, got %s", user.Role)
+	}
+
+	if _, err := db.GetUserByID(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestMemoryStoreSlots tests slot computation ignores cancelled appointments
+func TestMemoryStoreSlots(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	loc := clinicLocation()
+
+	// 2024-01-15 is a Monday
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, loc)
+	vet := &Veterinarian{
+		ID:             "vet-1",
+		Email:          "vet@example.com",
+		AvailableHours: []WorkingHours{{DayOfWeek: "Monday", Start: "09:00", End: "10:30"}},
+	}
+	if err := db.CreateVeterinarian(ctx, vet); err != nil {
+		t.Fatalf("CreateVeterinarian: %v", err)
+	}
+	if err := db.CreateClient(ctx, &Client{ID: "client-1", Email: "client@example.com"}); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	pet := NewPet("client-1", "Buddy", "Dog", "", date, 10)
+	if err := db.CreatePet(ctx, pet); err != nil {
+		t.Fatalf("CreatePet: %v", err)
+	}
+
+	booked := NewAppointment("client-1", "vet-1", pet.ID, date.Add(9*time.Hour), 30, "Checkup")
+	cancelled := NewAppointment("client-1", "vet-1", pet.ID, date.Add(9*time.Hour+30*time.Minute), 30, "Checkup")
+	cancelled.Status = "cancelled"
+	for _, a := range []*Appointment{booked, cancelled} {
+		if err := db.CreateAppointment(ctx, a); err != nil {
+			t.Fatalf("CreateAppointment: %v", err)
+		}
+	}
+
+	slots, err := db.GetAvailableAppointmentSlots(ctx, "vet-1", date)
+	if err != nil {
+		t.Fatalf("GetAvailableAppointmentSlots: %v", err)
+	}
+	if len(slots) != 3 {
+		t.Fatalf("Expected 3 slots, got %d", len(slots))
+	}
+	want := []bool{false, true, true}
+	for i, s := range slots {
+		if s.Available != want[i] {
+			t.Errorf("Slot %d at %s: expected available=%v", i, s.StartTime, want[i])
+		}
+	}
+}
+
+// TestMemoryStoreReturnsCopies tests that callers cannot mutate stored rows
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+
+	if err := db.CreateVeterinarian(ctx, &Veterinarian{ID: "vet-1", Email: "vet@example.com"}); err != nil {
+		t.Fatalf("CreateVeterinarian: %v", err)
+	}
+	product := NewProduct("vet-1", "Kibble", "", "food", usd(10))
+	product.Images = []string{"a.png"}
+	if err := db.CreateProduct(ctx, product); err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+
+	got, _ := db.GetProductByID(ctx, product.ID)
+	got.Name = "changed"
+	got.Images[0] = "changed.png"
+
+	again, _ := db.GetProductByID(ctx, product.ID)
+	if again.Name != "Kibble" || again.Images[0] != "a.png" {
+		t.Errorf("Stored product was mutated through a returned copy: %+v", again)
+	}
+}
+
+// TestMemoryStoreConcurrentWrites tests the store under concurrent use
+func TestMemoryStoreConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("client-%d", i)
+			_ = db.CreateClient(ctx, &Client{ID: id, Email: id + "@example.com"})
+			_, _, _ = db.ListUsers(ctx, "", Page{Limit: 10})
+		}()
+	}
+	wg.Wait()
+
+	users, _, err := db.ListUsers(ctx, "", Page{Limit: 100})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users) != 50 {
+		t.Errorf("Expected 50 users, got %d", len(users))
+	}
+}
+
+// usd is major units of US dollars, such as usd(19.99)
+func usd(major float64) Money {
+	return MoneyFromMajor(major, "USD")
+}
+
+// seedShop creates a client, a vet and one product with the given stock
+func seedShop(t *testing.T, db *MemoryStore, stock int) *Product {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := db.CreateClient(ctx, &Client{ID: "client-1", Email: "client@example.com"}); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	if err := db.CreateVeterinarian(ctx, &Veterinarian{ID: "vet-1", Email: "vet@example.com"}); err != nil {
+		t.Fatalf("CreateVeterinarian: %v", err)
+	}
+	product := NewProduct("vet-1", "Kibble", "", "food", usd(12.5))
+	product.StockQuantity = stock
+	if err := db.CreateProduct(ctx, product); err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	return product
+}
+
+// TestMemoryStorePlaceOrderInsufficientStock tests that a short order writes nothing
+func TestMemoryStorePlaceOrderInsufficientStock(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	product := seedShop(t, db, 2)
+
+	order := NewOrder("client-1", "vet-1", Money{})
+	items := []OrderItem{
+		*NewOrderItem("", product.ID, 1, Money{}),
+		*NewOrderItem("", product.ID, 2, Money{}),
+	}
+
+	err := db.PlaceOrder(ctx, order, items)
+	var stockErr *InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("Expected InsufficientStockError, got %v", err)
+	}
+	if stockErr.Available != 1 || stockErr.Requested != 2 {
+		t.Errorf("Unexpected stock error: %+v", stockErr)
+	}
+
+	if _, err := db.GetOrderByID(ctx, order.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected no order to be written, got %v", err)
+	}
+	got, _ := db.GetProductByID(ctx, product.ID)
+	if got.StockQuantity != 2 {
+		t.Errorf("Expected stock to stay at 2, got %d", got.StockQuantity)
+	}
+}
+
+// TestMemoryStorePlaceOrderNoOversell tests concurrent buyers racing for the last unit
+func TestMemoryStorePlaceOrderNoOversell(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	product := seedShop(t, db, 1)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	placed := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order := NewOrder("client-1", "vet-1", Money{})
+			items := []OrderItem{*NewOrderItem("", product.ID, 1, Money{})}
+			if err := db.PlaceOrder(ctx, order, items); err == nil {
+				mu.Lock()
+				placed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if placed != 1 {
+		t.Errorf("Expected exactly one order to succeed, got %d", placed)
+	}
+	got, _ := db.GetProductByID(ctx, product.ID)
+	if got.StockQuantity != 0 {
+		t.Errorf("Expected stock 0, got %d", got.StockQuantity)
+	}
+}
+
+// TestMemoryStorePlaceOrderPrices tests that prices and totals come from the product row
+func TestMemoryStorePlaceOrderPrices(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+	product := seedShop(t, db, 5)
+
+	order := NewOrder("client-1", "vet-1", Money{})
+	items := []OrderItem{*NewOrderItem("", product.ID, 2, usd(999))}
+	if err := db.PlaceOrder(ctx, order, items); err != nil {
+		t.Fatalf("PlaceOrder: %v", err)
+	}
+
+	if items[0].UnitPrice != usd(12.5) || items[0].OrderID != order.ID {
+		t.Errorf("Unexpected item after placement: %+v", items[0])
+	}
+	if order.TotalAmount != usd(25) {
+		t.Errorf("Expected total 25, got %v", order.TotalAmount)
+	}
+	stored, _ := db.GetOrderItems(ctx, order.ID)
+	if len(stored) != 1 {
+		t.Errorf("Expected 1 stored item, got %d", len(stored))
+	}
+}
+
+// TestMemoryStoreLastAdmin tests that the last admin cannot be removed, so
+// the registry is never left empty once it has an admin
+func TestMemoryStoreLastAdmin(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore()
+
+	for _, id := range []string{"admin-1", "admin-2"} {
+		if err := db.GrantAdmin(ctx, NewAdminGrant(id, id+"@example.com", "", "")); err != nil {
+			t.Fatalf("GrantAdmin(%s): %v", id, err)
+		}
+	}
+	if err := db.RevokeAdmin(ctx, "admin-1"); err != nil {
+		t.Fatalf("RevokeAdmin: %v", err)
+	}
+	if err := db.RevokeAdmin(ctx, "admin-2"); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("RevokeAdmin(last admin): expected ErrLastAdmin, got %v", err)
+	}
+	if user, err := db.GetUserByID(ctx, "admin-2"); err != nil || user.Role != RoleAdmin {
+		t.Errorf("GetUserByID: expected admin-2 to still be an admin, got %+v, %v", user, err)
+	}
+}
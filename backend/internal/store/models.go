@@ -3,19 +3,41 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// Database interface defines methods for data access operations
+// Database interface defines methods for data access operations. List methods
+// return one Page in a stable order together with the cursor of the next page,
+// which is empty on the last page.
+//
+// Pets, medical records, appointments and products carry a Version that every
+// update bumps. Updating one of them with a non-zero Version fails with
+// ErrVersionConflict unless that version is still current; on success the new
+// version is written back to the entity.
 type Database interface {
-	// User operations
+	// User operations. Users are admins while they are in the admin registry,
+	// even without a profile, and otherwise have their profile's role.
+	// ListUsers lists the users with role, or every user when it is empty.
 	GetUserByID(ctx context.Context, userID string) (*User, error)
 	CreateUser(ctx context.Context, user *User) error
 	UpdateUser(ctx context.Context, user *User) error
 	DeleteUser(ctx context.Context, userID string) error
-	ListUsers(ctx context.Context, limit, offset int) ([]User, error)
+	ListUsers(ctx context.Context, role string, page Page) ([]User, string, error)
+
+	// Admin registry and account operations. GrantAdmin adds a user to the
+	// registry and fails with ErrConflict if they are in it already.
+	// RevokeAdmin removes them, failing with ErrNotFound for a user who is
+	// not an admin and ErrLastAdmin rather than leaving no admin at all.
+	// SuspendUser suspends a user's account, replacing any earlier
+	// suspension, and ReactivateUser lifts it or fails with ErrNotFound.
+	// Deleting a profile leaves both alone.
+	GrantAdmin(ctx context.Context, grant *AdminGrant) error
+	RevokeAdmin(ctx context.Context, userID string) error
+	SuspendUser(ctx context.Context, suspension *Suspension) error
+	ReactivateUser(ctx context.Context, userID string) error
 
 	// Client/Veterinarian specific
 	CreateClient(ctx context.Context, client *Client) error
@@ -24,16 +46,51 @@ type Database interface {
 	UpdateVeterinarian(ctx context.Context, vet *Veterinarian) error
 	GetClientByID(ctx context.Context, clientID string) (*Client, error)
 	GetVeterinarianByID(ctx context.Context, vetID string) (*Veterinarian, error)
+	// GetClientByEmail finds the client whose email is email, ignoring case
+	// unless a client has it exactly
+	GetClientByEmail(ctx context.Context, email string) (*Client, error)
 
 	// Pet operations
-	GetPetsByUserID(ctx context.Context, userID string) ([]Pet, error)
+	GetPetsByUserID(ctx context.Context, userID string, page Page) ([]Pet, string, error)
 	GetPetByID(ctx context.Context, petID string) (*Pet, error)
 	CreatePet(ctx context.Context, pet *Pet) error
 	UpdatePet(ctx context.Context, pet *Pet) error
 	DeletePet(ctx context.Context, petID string) error
 
+	// Pet access operations. Grants let clients other than a pet's owner act
+	// for the pet. CreatePetAccessGrant fails with ErrConflict while the
+	// grantee, or the email of an invitation, holds an unrevoked grant for the
+	// pet, expired or not. ClaimPetAccessInvitations gives the unrevoked
+	// invitations to email, in any case, to a client, skipping pets they own or already
+	// hold an unrevoked grant for. RevokePetAccessGrant ends a grant at the
+	// time given, failing with ErrNotFound for one already revoked. The list
+	// methods list a pet's grants and the grants a client received, revoked
+	// ones included, oldest first. Purging the pet or either client removes
+	// the grants.
+	CreatePetAccessGrant(ctx context.Context, grant *PetAccessGrant) error
+	GetPetAccessGrantByID(ctx context.Context, grantID string) (*PetAccessGrant, error)
+	GetPetAccessGrants(ctx context.Context, petID string) ([]PetAccessGrant, error)
+	GetGranteePetAccessGrants(ctx context.Context, granteeID string) ([]PetAccessGrant, error)
+	ClaimPetAccessInvitations(ctx context.Context, clientID, email string) error
+	RevokePetAccessGrant(ctx context.Context, grantID string, at time.Time) error
+
+	// Record consent operations. Consents let a veterinarian without an
+	// appointment for a pet see its medical records. RevokeRecordConsent ends
+	// one at the time given, failing with ErrNotFound for one already
+	// revoked. GetPetRecordConsents lists a pet's consents, revoked ones
+	// included, oldest first. Purging the pet, its owner or the veterinarian
+	// removes them.
+	CreateRecordConsent(ctx context.Context, consent *RecordConsent) error
+	GetRecordConsentByID(ctx context.Context, consentID string) (*RecordConsent, error)
+	GetPetRecordConsents(ctx context.Context, petID string) ([]RecordConsent, error)
+	RevokeRecordConsent(ctx context.Context, consentID string, at time.Time) error
+
 	// Medical record operations
-	GetMedicalRecordsByPetID(ctx context.Context, petID string) ([]MedicalRecord, error)
+	GetMedicalRecordsByPetID(
+		ctx context.Context,
+		petID string,
+		page Page,
+	) ([]MedicalRecord, string, error)
 	GetMedicalRecordByID(ctx context.Context, recordID string) (*MedicalRecord, error)
 	CreateMedicalRecord(ctx context.Context, record *MedicalRecord) error
 	UpdateMedicalRecord(ctx context.Context, record *MedicalRecord) error
@@ -54,12 +111,18 @@ type Database interface {
 	GetAppointmentsByClientID(
 		ctx context.Context,
 		clientID string,
-	) ([]Appointment, error)
+		page Page,
+	) ([]Appointment, string, error)
 	GetAppointmentsByVeterinarianID(
 		ctx context.Context,
 		vetID string,
-	) ([]Appointment, error)
+		page Page,
+	) ([]Appointment, string, error)
 	GetAppointmentByID(ctx context.Context, appointmentID string) (*Appointment, error)
+	// HasPetAppointment reports whether vetID had an appointment for petID
+	// dated from since that took place by now: one completed, or one not
+	// cancelled that has started. Future bookings do not count.
+	HasPetAppointment(ctx context.Context, petID, vetID string, since, now time.Time) (bool, error)
 	CreateAppointment(ctx context.Context, appointment *Appointment) error
 	UpdateAppointment(ctx context.Context, appointment *Appointment) error
 	DeleteAppointment(ctx context.Context, appointmentID string) error
@@ -70,22 +133,173 @@ type Database interface {
 	) ([]TimeSlot, error)
 
 	// Product operations
-	GetProductsByVeterinarianID(ctx context.Context, vetID string) ([]Product, error)
+	GetProductsByVeterinarianID(
+		ctx context.Context,
+		vetID string,
+		page Page,
+	) ([]Product, string, error)
 	GetProductByID(ctx context.Context, productID string) (*Product, error)
 	CreateProduct(ctx context.Context, product *Product) error
 	UpdateProduct(ctx context.Context, product *Product) error
+	// UpdateProductWithStock saves product like UpdateProduct and, in the same
+	// transaction, records adjustment to bring its stock to
+	// product.StockQuantity. The store works the change out from the stock it
+	// holds at the time and fills in adjustment.Quantity, which stays 0 when
+	// the stock already matched.
+	UpdateProductWithStock(ctx context.Context, product *Product, adjustment *StockMovement) error
 	DeleteProduct(ctx context.Context, productID string) error
-	ListProducts(ctx context.Context, filters ProductFilters) ([]Product, error)
-	UpdateProductStock(ctx context.Context, productID string, quantity int) error
+	// ListProducts returns one page of active products matching filters and
+	// the total number of matches across all pages
+	ListProducts(ctx context.Context, filters ProductFilters, page Page) (*ProductPage, error)
+
+	// Stock ledger operations. Stock only changes through movements:
+	// CreateProduct records the opening balance, PlaceOrder one sale per line,
+	// and UpdateProduct leaves stock_quantity alone. RecordStockMovement
+	// applies movement.Quantity and sets BalanceAfter, failing with
+	// *InsufficientStockError rather than letting stock go negative.
+	// ListStockMovements lists newest first.
+	RecordStockMovement(ctx context.Context, movement *StockMovement) error
+	ListStockMovements(
+		ctx context.Context,
+		productID string,
+		page Page,
+	) ([]StockMovement, string, error)
 
 	// Order operations
-	GetOrdersByClientID(ctx context.Context, clientID string) ([]Order, error)
-	GetOrdersByVeterinarianID(ctx context.Context, vetID string) ([]Order, error)
+	GetOrdersByClientID(ctx context.Context, clientID string, page Page) ([]Order, string, error)
+	GetOrdersByVeterinarianID(ctx context.Context, vetID string, page Page) ([]Order, string, error)
 	GetOrderByID(ctx context.Context, orderID string) (*Order, error)
 	CreateOrder(ctx context.Context, order *Order) error
-	UpdateOrderStatus(ctx context.Context, orderID string, status string) error
 	GetOrderItems(ctx context.Context, orderID string) ([]OrderItem, error)
 	CreateOrderItem(ctx context.Context, item *OrderItem) error
+	// PlaceOrder validates the order, inserts it with its items and decrements
+	// stock as a single unit of work. Unit prices and totals are taken from the
+	// current product rows, and tax from the veterinarian's tax settings.
+	// The veterinarian's and shop-wide promotions that apply, including the
+	// one order.DiscountCode names, are taken off before tax and their use
+	// counted. Returns *InsufficientStockError when stock is short and
+	// ErrPromotionUnavailable when the discount code is used up.
+	PlaceOrder(ctx context.Context, order *Order, items []OrderItem) error
+	// TransitionOrder moves an order from change.FromStatus to change.ToStatus
+	// and appends change to its status history as a single unit of work. It
+	// fails with ErrOrderTransition when the lifecycle does not allow the move
+	// or the order is no longer in FromStatus. A change.PaymentStatus is set
+	// on the order in the same unit of work. Cancelling puts the order's
+	// items back in stock with cancellation movements; products in the trash
+	// are skipped, and a paid order fails with ErrOrderPaid instead.
+	// GetOrderStatusHistory lists oldest first.
+	TransitionOrder(ctx context.Context, change *OrderStatusChange) error
+	GetOrderStatusHistory(ctx context.Context, orderID string) ([]OrderStatusChange, error)
+
+	// Reservation operations. CreateReservation holds stock for a client and
+	// fails with *InsufficientStockError when less is available than asked
+	// for. Available stock is stock_quantity less what active, unexpired
+	// reservations hold; PlaceOrder only sells available stock.
+	// ConfirmReservation places the reservation's items as a Checkout of one
+	// order per veterinarian, each copying template's client, payment and
+	// delivery details and placed as PlaceOrder does; either every order is
+	// placed or none is. ReleaseReservation and
+	// ConfirmReservation return ErrReservationClosed once a reservation no
+	// longer holds stock. ExpireReservations marks the ones that lapsed before
+	// now expired and returns how many there were.
+	CreateReservation(ctx context.Context, reservation *Reservation) error
+	GetReservationByID(ctx context.Context, reservationID string) (*Reservation, error)
+	ReleaseReservation(ctx context.Context, reservationID string) error
+	ConfirmReservation(
+		ctx context.Context,
+		reservationID string,
+		template *Order,
+	) (*Checkout, error)
+	ExpireReservations(ctx context.Context, now time.Time) (int, error)
+
+	// Payment operations. UpdateOrderPaymentStatus sets an order's payment
+	// status directly, for payments settled outside a gateway. A Payment
+	// records one attempt to pay for an order through a gateway, and
+	// CreatePayment fails with ErrConflict while the order has a pending one;
+	// SetPaymentStatus settles a pending attempt and its order's payment
+	// status together, or fails with ErrPaymentTransition when the attempt
+	// cannot move from its current status. RecordPaymentRefund records the
+	// total refunded of a paid attempt so far, moving it and its order to
+	// partially_refunded or refunded; it fails with ErrPaymentTransition when
+	// that total is already recorded and ErrInvalidPayment when it exceeds the
+	// attempt. GetOrderPayments lists oldest first.
+	UpdateOrderPaymentStatus(ctx context.Context, orderID string, paymentStatus string) error
+	CreatePayment(ctx context.Context, payment *Payment) error
+	GetPaymentByID(ctx context.Context, paymentID string) (*Payment, error)
+	GetPaymentByIntentID(ctx context.Context, provider, intentID string) (*Payment, error)
+	GetOrderPayments(ctx context.Context, orderID string) ([]Payment, error)
+	SetPaymentStatus(
+		ctx context.Context,
+		paymentID string,
+		status string,
+		failureReason string,
+	) (*Payment, error)
+	RecordPaymentRefund(ctx context.Context, paymentID string, refunded Money) (*Payment, error)
+
+	// Return operations. CreateReturn checks the order was delivered and no
+	// item is returned more often than it was ordered, filling in each item's
+	// product and refund from the order, or fails with ErrInvalidReturn.
+	// ReviewReturn approves or rejects a requested return and puts approved
+	// items marked restock back in stock; MarkReturnRefunded records the
+	// payment an approved return was refunded from. Both fail with
+	// ErrReturnTransition when the return has moved on. GetOrderReturns lists
+	// oldest first.
+	CreateReturn(ctx context.Context, ret *Return) error
+	GetReturnByID(ctx context.Context, returnID string) (*Return, error)
+	GetOrderReturns(ctx context.Context, orderID string) ([]Return, error)
+	ReviewReturn(ctx context.Context, review *ReturnReview) (*Return, error)
+	MarkReturnRefunded(ctx context.Context, returnID, paymentID string) (*Return, error)
+
+	// Invoice operations. IssueInvoice gives an invoice or credit note the
+	// next number in its veterinarian's sequence for its kind and stores it;
+	// issued invoices are never changed or removed. It fails with ErrConflict
+	// when the order already has an invoice or the return a credit note.
+	// GetOrderInvoice fails with ErrNotFound until the order's invoice is
+	// issued; GetOrderCreditNotes lists oldest first.
+	IssueInvoice(ctx context.Context, inv *Invoice) error
+	GetInvoiceByID(ctx context.Context, invoiceID string) (*Invoice, error)
+	GetOrderInvoice(ctx context.Context, orderID string) (*Invoice, error)
+	GetOrderCreditNotes(ctx context.Context, orderID string) ([]Invoice, error)
+
+	// Tax operations. GetTaxSettings returns settings without rates for a
+	// veterinarian who has not set any; SetTaxSettings replaces them.
+	GetTaxSettings(ctx context.Context, vetID string) (*TaxSettings, error)
+	SetTaxSettings(ctx context.Context, settings *TaxSettings) error
+
+	// Promotion operations. Discount codes are unique: CreatePromotion and
+	// UpdatePromotion fail with ErrConflict on one already taken, and
+	// GetPromotionByCode matches regardless of case. UpdatePromotion leaves
+	// UsageCount alone. ListPromotions lists a veterinarian's promotions, or
+	// every promotion for an empty vetID, oldest first.
+	CreatePromotion(ctx context.Context, promotion *Promotion) error
+	GetPromotionByID(ctx context.Context, promotionID string) (*Promotion, error)
+	GetPromotionByCode(ctx context.Context, code string) (*Promotion, error)
+	ListPromotions(ctx context.Context, vetID string, page Page) ([]Promotion, string, error)
+	UpdatePromotion(ctx context.Context, promotion *Promotion) error
+	DeletePromotion(ctx context.Context, promotionID string) error
+
+	// Trash operations. DeleteUser, DeletePet, DeleteMedicalRecord and
+	// DeleteProduct only move rows to the trash, which every other read skips.
+	// Deleting a client also trashes their pets, deleting a pet its medical
+	// records and deleting a veterinarian their products; deleted products are
+	// deactivated. ListTrash lists one entity, or all when entity is empty,
+	// most recently deleted first.
+	ListTrash(ctx context.Context, entity string, page Page) ([]TrashItem, string, error)
+	// RestoreDeleted brings a row back with the rows that were trashed along
+	// with it. Returns ErrNotFound unless the row is in the trash.
+	RestoreDeleted(ctx context.Context, entity, id string) error
+	// PurgeDeleted permanently removes rows deleted before the cutoff, with
+	// everything that references them, and returns how many it removed
+	PurgeDeleted(ctx context.Context, before time.Time) (int, error)
+
+	// Audit log operations. The log is append-only; no backend can change or
+	// remove an entry. ListAuditEntries lists newest first.
+	AppendAuditEntry(ctx context.Context, entry *AuditEntry) error
+	ListAuditEntries(
+		ctx context.Context,
+		filter AuditFilter,
+		page Page,
+	) ([]AuditEntry, string, error)
 
 	// Health check
 	Ping(ctx context.Context) error
@@ -99,6 +313,17 @@ type User struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
 	Role  string `json:"role"`
+	// Profile is the role of the user's client or veterinarian profile,
+	// which admins go back to when demoted; empty for admins without one
+	Profile string `json:"profile,omitempty"`
+	// SuspendedAt is set while the account is suspended
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+}
+
+// Suspended reports whether the user's account is suspended
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
 }
 
 // Client represents a pet owner
@@ -140,6 +365,7 @@ type Pet struct {
 	Weight      float64   `json:"weight"        db:"weight"`
 	CreatedAt   time.Time `json:"created_at"    db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"    db:"updated_at"`
+	Version     int       `json:"version"       db:"version"`
 }
 
 // MedicalRecord represents a veterinary visit record
@@ -155,6 +381,7 @@ type MedicalRecord struct {
 	Notes                string    `json:"notes"                    db:"notes"`
 	CreatedAt            time.Time `json:"created_at"               db:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at"               db:"updated_at"`
+	Version              int       `json:"version"                  db:"version"`
 }
 
 // QRCode represents a QR code for pet identification
@@ -219,6 +446,7 @@ type Appointment struct {
 	Notes           string    `json:"notes"            db:"notes"`
 	CreatedAt       time.Time `json:"created_at"       db:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"       db:"updated_at"`
+	Version         int       `json:"version"          db:"version"`
 }
 
 // TimeSlot represents an available appointment time slot
@@ -235,7 +463,7 @@ type Product struct {
 	Name                   string            `json:"name"                     db:"name"`
 	Description            string            `json:"description"              db:"description"`
 	Category               string            `json:"category"                 db:"category"`
-	Price                  float64           `json:"price"                    db:"price"`
+	Price                  Money             `json:"price"                    db:"price"`
 	StockQuantity          int               `json:"stock_quantity"           db:"stock_quantity"`
 	SKU                    string            `json:"sku"                      db:"sku"`
 	Brand                  string            `json:"brand"                    db:"brand"`
@@ -246,6 +474,7 @@ type Product struct {
 	Images                 []string          `json:"images"                   db:"images"`
 	CreatedAt              time.Time         `json:"created_at"               db:"created_at"`
 	UpdatedAt              time.Time         `json:"updated_at"               db:"updated_at"`
+	Version                int               `json:"version"                  db:"version"`
 }
 
 // ProductDimensions represents product dimensions
@@ -258,30 +487,49 @@ type ProductDimensions struct {
 
 // ProductFilters represents filters for product listing
 type ProductFilters struct {
-	Category       string  `json:"category,omitempty"`
-	MinPrice       float64 `json:"min_price,omitempty"`
-	MaxPrice       float64 `json:"max_price,omitempty"`
-	Brand          string  `json:"brand,omitempty"`
-	VeterinarianID string  `json:"veterinarian_id,omitempty"`
-	Search         string  `json:"search,omitempty"`
-	Limit          int     `json:"limit,omitempty"`
-	Offset         int     `json:"offset,omitempty"`
+	Category       string `json:"category,omitempty"`
+	MinPrice       Money  `json:"min_price,omitempty"`
+	MaxPrice       Money  `json:"max_price,omitempty"`
+	Brand          string `json:"brand,omitempty"`
+	VeterinarianID string `json:"veterinarian_id,omitempty"`
+	Search         string `json:"search,omitempty"`
+	Sort           string `json:"sort,omitempty"`
 }
 
-// Order represents a purchase order
+// ProductPage is one page of ListProducts results
+type ProductPage struct {
+	Products   []Product
+	NextCursor string
+	Total      int
+}
+
+// Order represents a purchase order. TotalAmount is what the client pays,
+// after discounts and with tax included; DiscountAmount is what the
+// promotions in Discounts took off, and TaxAmount the tax, itemized by
+// TaxLines. DiscountCode is the code the client gave, if any. PlacedBy is
+// who placed the order for ClientID, such as a client with a pet access
+// grant, and empty when ClientID placed it.
 type Order struct {
-	ID              string    `json:"id"               db:"id"`
-	ClientID        string    `json:"client_id"        db:"client_id"`
-	VeterinarianID  string    `json:"veterinarian_id"  db:"veterinarian_id"`
-	TotalAmount     float64   `json:"total_amount"     db:"total_amount"`
-	Status          string    `json:"status"           db:"status"`
-	PaymentStatus   string    `json:"payment_status"   db:"payment_status"`
-	PaymentMethod   string    `json:"payment_method"   db:"payment_method"`
-	ShippingAddress string    `json:"shipping_address" db:"shipping_address"`
-	DeliveryMethod  string    `json:"delivery_method"  db:"delivery_method"`
-	Notes           string    `json:"notes"            db:"notes"`
-	CreatedAt       time.Time `json:"created_at"       db:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"       db:"updated_at"`
+	ID              string          `json:"id"               db:"id"`
+	ClientID        string          `json:"client_id"        db:"client_id"`
+	PlacedBy        string          `json:"placed_by,omitempty" db:"placed_by"`
+	VeterinarianID  string          `json:"veterinarian_id"  db:"veterinarian_id"`
+	TotalAmount     Money           `json:"total_amount"     db:"total_amount"`
+	TaxAmount       Money           `json:"tax_amount"       db:"tax_amount"`
+	TaxInclusive    bool            `json:"tax_inclusive"    db:"tax_inclusive"`
+	TaxLines        []TaxLine       `json:"tax_lines"        db:"tax_lines"`
+	DiscountCode    string          `json:"discount_code,omitempty" db:"discount_code"`
+	DiscountAmount  Money           `json:"discount_amount"  db:"discount_amount"`
+	Discounts       []OrderDiscount `json:"discounts"  db:"discounts"`
+	Status          string          `json:"status"           db:"status"`
+	PaymentStatus   string          `json:"payment_status"   db:"payment_status"`
+	PaymentMethod   string          `json:"payment_method"   db:"payment_method"`
+	ShippingAddress string          `json:"shipping_address" db:"shipping_address"`
+	DeliveryMethod  string          `json:"delivery_method"  db:"delivery_method"`
+	Notes           string          `json:"notes"            db:"notes"`
+	CheckoutGroupID string          `json:"checkout_group_id,omitempty" db:"checkout_group_id"`
+	CreatedAt       time.Time       `json:"created_at"       db:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"       db:"updated_at"`
 }
 
 // OrderItem represents an individual item in an order
@@ -290,8 +538,8 @@ type OrderItem struct {
 	OrderID    string    `json:"order_id"    db:"order_id"`
 	ProductID  string    `json:"product_id"  db:"product_id"`
 	Quantity   int       `json:"quantity"    db:"quantity"`
-	UnitPrice  float64   `json:"unit_price"  db:"unit_price"`
-	TotalPrice float64   `json:"total_price" db:"total_price"`
+	UnitPrice  Money     `json:"unit_price"  db:"unit_price"`
+	TotalPrice Money     `json:"total_price" db:"total_price"`
 	CreatedAt  time.Time `json:"created_at"  db:"created_at"`
 }
 
@@ -312,6 +560,7 @@ func NewPet(
 		Weight:      weight,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Version:     1,
 	}
 }
 
@@ -336,6 +585,7 @@ func NewMedicalRecord(
 		Notes:                notes,
 		CreatedAt:            now,
 		UpdatedAt:            now,
+		Version:              1,
 	}
 }
 
@@ -376,13 +626,14 @@ func NewAppointment(
 		Status:          "scheduled",
 		CreatedAt:       now,
 		UpdatedAt:       now,
+		Version:         1,
 	}
 }
 
 // NewProduct creates a new Product with generated ID and timestamps
 func NewProduct(
 	veterinarianID, name, description, category string,
-	price float64,
+	price Money,
 ) *Product {
 	now := time.Now()
 	return &Product{
@@ -397,17 +648,22 @@ func NewProduct(
 		IsActive:               true,
 		CreatedAt:              now,
 		UpdatedAt:              now,
+		Version:                1,
 	}
 }
 
 // NewOrder creates a new Order with generated ID and timestamps
-func NewOrder(clientID, veterinarianID string, totalAmount float64) *Order {
+func NewOrder(clientID, veterinarianID string, totalAmount Money) *Order {
 	now := time.Now()
 	return &Order{
 		ID:             uuid.New().String(),
 		ClientID:       clientID,
 		VeterinarianID: veterinarianID,
 		TotalAmount:    totalAmount,
+		TaxAmount:      NewMoney(0, totalAmount.currencyOrDefault()),
+		TaxLines:       []TaxLine{},
+		DiscountAmount: NewMoney(0, totalAmount.currencyOrDefault()),
+		Discounts:      []OrderDiscount{},
 		Status:         "pending",
 		PaymentStatus:  "pending",
 		DeliveryMethod: "pickup",
@@ -416,21 +672,44 @@ func NewOrder(clientID, veterinarianID string, totalAmount float64) *Order {
 	}
 }
 
+// placer is who placed o: PlacedBy, or the client it is for
+func (o *Order) placer() string {
+	if o.PlacedBy != "" {
+		return o.PlacedBy
+	}
+	return o.ClientID
+}
+
 // NewOrderItem creates a new OrderItem with generated ID and timestamps
 func NewOrderItem(
 	orderID, productID string,
 	quantity int,
-	unitPrice float64,
+	unitPrice Money,
 ) *OrderItem {
 	now := time.Now()
-	totalPrice := float64(quantity) * unitPrice
 	return &OrderItem{
 		ID:         uuid.New().String(),
 		OrderID:    orderID,
 		ProductID:  productID,
 		Quantity:   quantity,
 		UnitPrice:  unitPrice,
-		TotalPrice: totalPrice,
+		TotalPrice: unitPrice.Mul(quantity),
 		CreatedAt:  now,
 	}
 }
+
+// validateOrderPlacement checks the parts of an order that do not need the database
+func validateOrderPlacement(order *Order, items []OrderItem) error {
+	if order.ClientID == "" || order.VeterinarianID == "" {
+		return fmt.Errorf("%w: client and veterinarian are required", ErrInvalidOrder)
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+	for _, it := range items {
+		if it.ProductID == "" || it.Quantity <= 0 {
+			return fmt.Errorf("%w: item quantity must be greater than 0", ErrInvalidOrder)
+		}
+	}
+	return nil
+}
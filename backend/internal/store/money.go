@@ -0,0 +1,166 @@
+// Package store/money.go contains the Money type used for prices and totals
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts given without one, such as
+// plain numbers in older request payloads. The shop prices in Philippine
+// pesos, as it did before amounts carried a currency.
+const DefaultCurrency = "PHP"
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are combined
+var ErrCurrencyMismatch = errors.New("currencies do not match")
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Money is an amount in cents, hundredths of the currency's major unit, with
+// its ISO 4217 currency code. The zero value is nothing in no currency and
+// takes on the currency of whatever it is added to.
+//
+// Money encodes to JSON as {"amount": 1999, "currency": "PHP"}. It also
+// decodes a plain number such as 19.99 as that many major units of
+// DefaultCurrency, so older payloads keep working.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// NewMoney creates a Money of amount cents in currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// MoneyFromMajor converts an amount in major units, such as 19.99, to Money,
+// rounding to the nearest cent
+func MoneyFromMajor(major float64, currency string) Money {
+	return Money{Amount: int64(math.Round(major * 100)), Currency: currency}
+}
+
+// ParseMoney parses a decimal amount in major units, such as "19.99",
+// without going through floating point
+func ParseMoney(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > 2 || frac != "" && strings.Trim(frac, "0123456789") != "" {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	negative := strings.HasPrefix(whole, "-")
+	units, err := strconv.ParseInt(strings.TrimPrefix(whole, "-"), 10, 64)
+	if err != nil || strings.HasPrefix(whole, "+") {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	cents, _ := strconv.ParseInt((frac + "00")[:2], 10, 64)
+	amount := units*100 + cents
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Major is the amount in major units, for storage in decimal columns
+func (m Money) Major() float64 {
+	return float64(m.Amount) / 100
+}
+
+// Decimal formats the amount in major units with two decimals, such as "19.99"
+func (m Money) Decimal() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// String formats m for people, such as "19.99 PHP"
+func (m Money) String() string {
+	return strings.TrimSpace(m.Decimal() + " " + m.Currency)
+}
+
+// Add returns m + o. Either side may be the zero Money; otherwise both must
+// be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	switch {
+	case m.Currency == "":
+		return Money{Amount: m.Amount + o.Amount, Currency: o.Currency}, nil
+	case o.Currency == "" || o.Currency == m.Currency:
+		return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+	}
+	return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
+
+// Mul returns m times n, such as a unit price times a quantity
+func (m Money) Mul(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+// IsZero reports whether m is no money at all
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// currencyOrDefault is m's currency, or DefaultCurrency for the zero Money
+func (m Money) currencyOrDefault() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// validCurrency reports whether code looks like an ISO 4217 currency code
+func validCurrency(code string) bool {
+	return currencyPattern.MatchString(code)
+}
+
+// Validate checks that m has a currency code
+func (m Money) Validate() error {
+	if !validCurrency(m.Currency) {
+		return fmt.Errorf("invalid currency %q", m.Currency)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes {"amount": 1999, "currency": "PHP"} or, for older
+// payloads, a plain number of major units in DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		type money Money
+		var v money
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*m = Money(v)
+		if m.Currency == "" {
+			m.Currency = DefaultCurrency
+		}
+		return nil
+	}
+
+	var major json.Number
+	if err := json.Unmarshal(data, &major); err != nil {
+		return fmt.Errorf("money must be a number or an object with amount and currency")
+	}
+	parsed, err := ParseMoney(major.String(), DefaultCurrency)
+	if err != nil {
+		f, ferr := major.Float64()
+		if ferr != nil {
+			return err
+		}
+		parsed = MoneyFromMajor(f, DefaultCurrency)
+	}
+	*m = parsed
+	return nil
+}
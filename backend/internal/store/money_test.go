@@ -0,0 +1,63 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestMoneyJSON tests that Money decodes objects and legacy plain numbers
+// and encodes as an object
+func TestMoneyJSON(t *testing.T) {
+	cases := map[string]Money{
+		`{"amount": 1999, "currency": "EUR"}`: {Amount: 1999, Currency: "EUR"},
+		`{"amount": 1999}`:                    {Amount: 1999, Currency: "PHP"},
+		`19.99`:                               {Amount: 1999, Currency: "PHP"},
+		`0.1`:                                 {Amount: 10, Currency: "PHP"},
+		`25`:                                  {Amount: 2500, Currency: "PHP"},
+	}
+	for in, want := range cases {
+		var got Money
+		if err := json.Unmarshal([]byte(in), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Unmarshal(%s): expected %+v, got %+v", in, want, got)
+		}
+	}
+
+	var bad Money
+	if err := json.Unmarshal([]byte(`"cheap"`), &bad); err == nil {
+		t.Errorf("Unmarshal of a word: expected an error")
+	}
+
+	out, err := json.Marshal(NewMoney(1999, "USD"))
+	if err != nil || string(out) != `{"amount":1999,"currency":"USD"}` {
+		t.Errorf("Marshal: unexpected %s (%v)", out, err)
+	}
+}
+
+// TestMoneyArithmetic tests adding, multiplying and formatting Money
+func TestMoneyArithmetic(t *testing.T) {
+	// 0.1 + 0.2 is exact in cents
+	sum, err := MoneyFromMajor(0.1, "USD").Add(MoneyFromMajor(0.2, "USD"))
+	if err != nil || sum != NewMoney(30, "USD") {
+		t.Errorf("Add: expected 0.30 USD, got %v (%v)", sum, err)
+	}
+	if sum, _ := (Money{}).Add(NewMoney(5, "EUR")); sum.Currency != "EUR" {
+		t.Errorf("Add to zero Money: expected EUR, got %q", sum.Currency)
+	}
+	if _, err := NewMoney(1, "USD").Add(NewMoney(1, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies: expected ErrCurrencyMismatch, got %v", err)
+	}
+	if got := NewMoney(1250, "USD").Mul(3).Decimal(); got != "37.50" {
+		t.Errorf("Mul: expected 37.50, got %s", got)
+	}
+	if got := NewMoney(-5, "USD").String(); got != "-0.05 USD" {
+		t.Errorf("String: expected -0.05 USD, got %s", got)
+	}
+	if _, err := ParseMoney("1.234", "USD"); err == nil {
+		t.Errorf("ParseMoney: expected an error for sub-cent amounts")
+	}
+}
@@ -0,0 +1,146 @@
+// Package store/order_status.go contains the order lifecycle state machine shared by all backends
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Order statuses
+const (
+	OrderPending    = "pending"
+	OrderConfirmed  = "confirmed"
+	OrderProcessing = "processing"
+	OrderShipped    = "shipped"
+	OrderDelivered  = "delivered"
+	OrderCancelled  = "cancelled"
+)
+
+// orderTransitions lists, for each status, the statuses an order can move to
+// and the roles that may move it there. Delivered and cancelled orders are
+// final. Pickup orders go straight from processing to delivered.
+var orderTransitions = map[string]map[string][]string{
+	OrderPending: {
+		OrderConfirmed: {"veterinarian", "admin"},
+		OrderCancelled: {"client", "veterinarian", "admin"},
+	},
+	OrderConfirmed: {
+		OrderProcessing: {"veterinarian", "admin"},
+		OrderCancelled:  {"client", "veterinarian", "admin"},
+	},
+	OrderProcessing: {
+		OrderShipped:   {"veterinarian", "admin"},
+		OrderDelivered: {"veterinarian", "admin"},
+		OrderCancelled: {"client", "veterinarian", "admin"},
+	},
+	OrderShipped: {
+		OrderDelivered: {"veterinarian", "admin"},
+	},
+}
+
+// IsValidOrderStatus reports whether status is one of the order statuses
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderPending, OrderConfirmed, OrderProcessing, OrderShipped, OrderDelivered,
+		OrderCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransitionOrder reports whether role may move an order from one status
+// to another. Callers still check that the user owns the order.
+func CanTransitionOrder(from, to, role string) bool {
+	for _, allowed := range orderTransitions[from][to] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOrderStatuses lists the statuses role may move an order in status
+// from to, in alphabetical order
+func NextOrderStatuses(from, role string) []string {
+	next := []string{}
+	for to := range orderTransitions[from] {
+		if CanTransitionOrder(from, to, role) {
+			next = append(next, to)
+		}
+	}
+	sort.Strings(next)
+	return next
+}
+
+// OrderStatusChange is one entry of an order's status history
+type OrderStatusChange struct {
+	ID         string    `json:"id"`
+	OrderID    string    `json:"order_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    string    `json:"actor_id"`
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// PaymentStatus, when set, becomes the order's payment status along with
+	// the move, for payments settled outside a gateway. History leaves it out.
+	PaymentStatus string `json:"payment_status,omitempty"`
+}
+
+// NewOrderStatusChange creates a new OrderStatusChange with generated ID and timestamp
+func NewOrderStatusChange(orderID, from, to, actorID, note string) *OrderStatusChange {
+	return &OrderStatusChange{
+		ID:         uuid.New().String(),
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		Note:       note,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// validateOrderTransition rejects changes the state machine does not allow
+// for any role
+func validateOrderTransition(c *OrderStatusChange) error {
+	if _, ok := orderTransitions[c.FromStatus][c.ToStatus]; !ok {
+		return fmt.Errorf("order %s from %s to %s: %w",
+			c.OrderID, c.FromStatus, c.ToStatus, ErrOrderTransition)
+	}
+	if c.PaymentStatus != "" && !IsValidPaymentStatus(c.PaymentStatus) {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidPayment, c.PaymentStatus)
+	}
+	return nil
+}
+
+// checkPaidCancellation fails with ErrOrderPaid when c cancels an order whose
+// payment status, once c is applied, still holds the client's money
+func checkPaidCancellation(c *OrderStatusChange, paymentStatus string) error {
+	if c.PaymentStatus != "" {
+		paymentStatus = c.PaymentStatus
+	}
+	if c.ToStatus == OrderCancelled &&
+		(paymentStatus == PaymentPaid || paymentStatus == PaymentPartiallyRefunded) {
+		return fmt.Errorf("order %s: %w", c.OrderID, ErrOrderPaid)
+	}
+	return nil
+}
+
+// orderMovedError explains that an order is no longer in the status a change
+// expected to move it from
+func orderMovedError(c *OrderStatusChange, current string) error {
+	return fmt.Errorf("order %s is %s, not %s: %w", c.OrderID, current, c.FromStatus,
+		ErrOrderTransition)
+}
+
+// cancellationRestock is the movement that puts a cancelled order's item
+// back in stock
+func cancellationRestock(c *OrderStatusChange, item OrderItem) *StockMovement {
+	m := NewStockMovement(item.ProductID, StockCancellation, item.Quantity, c.ActorID)
+	m.OrderID = c.OrderID
+	m.Reason = "Order cancelled"
+	m.CreatedAt = c.CreatedAt
+	return m
+}
@@ -0,0 +1,313 @@
+// Package store/page.go contains keyset (cursor) pagination shared by all backends
+package store
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page size bounds for list methods
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ErrInvalidCursor is returned when a page cursor cannot be decoded or was
+// issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects one page of a list. Cursor is empty for the first page and
+// otherwise the next cursor returned with the previous page.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// limit returns the page size clamped to [1, MaxPageLimit]
+func (p Page) limit() int {
+	switch {
+	case p.Limit <= 0:
+		return DefaultPageLimit
+	case p.Limit > MaxPageLimit:
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// sortByID orders users, which are merged from two tables, by ID alone
+const sortByID = "id"
+
+// sortByDeletion orders the trash newest deletion first. Its cursors carry
+// deleted_at in CreatedAt.
+const sortByDeletion = "deleted"
+
+// sortByNewest orders the audit log newest first, like the newest product sort
+const sortByNewest = ProductSortNewest
+
+// cursor is the decoded form of a page cursor: the sort key of the last item
+// on the previous page. Clients only ever see it base64-encoded.
+type cursor struct {
+	Sort      string    `json:"s,omitempty"`
+	Price     float64   `json:"p,omitempty"`
+	Name      string    `json:"n,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// keyColumn is one column of a keyset ordering and the cursor's value for it
+type keyColumn struct {
+	column string
+	desc   bool
+	fold   bool // compare case-insensitively
+	value  any
+}
+
+// keys lists the columns the cursor's sort order is made of, most
+// significant first. Every ordering ends in ID so keys are unique.
+func (c cursor) keys() []keyColumn {
+	byCreation := []keyColumn{
+		{column: "created_at", value: c.CreatedAt},
+		{column: "id", value: c.ID},
+	}
+	switch c.Sort {
+	case sortByID:
+		return byCreation[1:]
+	case sortByDeletion:
+		return []keyColumn{
+			{column: "deleted_at", desc: true, value: c.CreatedAt},
+			{column: "id", desc: true, value: c.ID},
+		}
+	case ProductSortNewest:
+		return []keyColumn{
+			{column: "created_at", desc: true, value: c.CreatedAt},
+			{column: "id", desc: true, value: c.ID},
+		}
+	case ProductSortPriceAsc:
+		return append([]keyColumn{{column: "price", value: c.Price}}, byCreation...)
+	case ProductSortPriceDesc:
+		return append([]keyColumn{{column: "price", desc: true, value: c.Price}}, byCreation...)
+	case ProductSortName:
+		return append([]keyColumn{{column: "name", fold: true, value: c.Name}}, byCreation...)
+	}
+	return byCreation
+}
+
+// compare orders two cursors of the same sort
+func (c cursor) compare(o cursor) int {
+	a, b := c.keys(), o.keys()
+	for i := range a {
+		var n int
+		switch v := a[i].value.(type) {
+		case float64:
+			n = cmp.Compare(v, b[i].value.(float64))
+		case time.Time:
+			n = v.Compare(b[i].value.(time.Time))
+		case string:
+			w := b[i].value.(string)
+			if a[i].fold {
+				v, w = strings.ToLower(v), strings.ToLower(w)
+			}
+			n = strings.Compare(v, w)
+		}
+		if a[i].desc {
+			n = -n
+		}
+		if n != 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// Cursors for lists in creation order
+func petKey(p Pet) cursor                 { return cursor{CreatedAt: p.CreatedAt, ID: p.ID} }
+func recordKey(r MedicalRecord) cursor    { return cursor{CreatedAt: r.CreatedAt, ID: r.ID} }
+func appointmentKey(a Appointment) cursor { return cursor{CreatedAt: a.CreatedAt, ID: a.ID} }
+func orderKey(o Order) cursor             { return cursor{CreatedAt: o.CreatedAt, ID: o.ID} }
+func promotionKey(p Promotion) cursor     { return cursor{CreatedAt: p.CreatedAt, ID: p.ID} }
+func createdProductKey(p Product) cursor  { return productKey(p, "") }
+
+// userKey is the cursor for ListUsers
+func userKey(u User) cursor {
+	return cursor{Sort: sortByID, ID: u.ID}
+}
+
+// productKey is the cursor for a product listed with sortBy
+func productKey(p Product, sortBy string) cursor {
+	c := cursor{Sort: sortBy, CreatedAt: p.CreatedAt, ID: p.ID}
+	switch sortBy {
+	case ProductSortPriceAsc, ProductSortPriceDesc:
+		c.Price = p.Price.Major()
+	case ProductSortName:
+		c.Name = p.Name
+	}
+	return c
+}
+
+// encodeCursor makes c opaque for clients
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor issued for sortBy. An empty string is the first
+// page and decodes to nil.
+func decodeCursor(s, sortBy string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" || c.Sort != sortBy {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// trimPage cuts items, fetched with one row more than limit, down to the page
+// and returns the cursor of its last item when another page follows
+func trimPage[T any](items []T, limit int, key func(T) cursor) ([]T, string) {
+	if items == nil {
+		items = []T{}
+	}
+	if len(items) <= limit {
+		return items, ""
+	}
+	items = items[:limit]
+	return items, encodeCursor(key(items[limit-1]))
+}
+
+// paginate returns the page of already ordered items that follows
+// page.Cursor, plus the next cursor
+func paginate[T any](
+	items []T,
+	page Page,
+	sortBy string,
+	key func(T) cursor,
+) ([]T, string, error) {
+	after, err := decodeCursor(page.Cursor, sortBy)
+	if err != nil {
+		return nil, "", err
+	}
+	if after != nil {
+		start := len(items)
+		for i, it := range items {
+			if key(it).compare(*after) > 0 {
+				start = i
+				break
+			}
+		}
+		items = items[start:]
+	}
+	limit := page.limit()
+	if len(items) > limit+1 {
+		items = items[:limit+1]
+	}
+	items, next := trimPage(items, limit, key)
+	return items, next, nil
+}
+
+// pgKeyset renders the SQL condition for rows that sort after keys, adding
+// the cursor values as arguments through arg
+func pgKeyset(keys []keyColumn, arg func(any) string) string {
+	expr := func(k keyColumn) (string, string) {
+		if k.fold {
+			return "lower(" + k.column + ")", "lower(" + arg(k.value) + ")"
+		}
+		return k.column, arg(k.value)
+	}
+
+	// A uniform direction compares as one row value, which indexes can serve
+	uniform := true
+	for _, k := range keys {
+		uniform = uniform && k.desc == keys[0].desc
+	}
+	if uniform {
+		cols := make([]string, len(keys))
+		vals := make([]string, len(keys))
+		for i, k := range keys {
+			cols[i], vals[i] = expr(k)
+		}
+		op := ">"
+		if keys[0].desc {
+			op = "<"
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(cols, ", "), op, strings.Join(vals, ", "))
+	}
+
+	var ors []string
+	for i, k := range keys {
+		var ands []string
+		for _, prev := range keys[:i] {
+			col, val := expr(prev)
+			ands = append(ands, col+" = "+val)
+		}
+		col, val := expr(k)
+		op := ">"
+		if k.desc {
+			op = "<"
+		}
+		ands = append(ands, col+" "+op+" "+val)
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+// pgOrderBy renders the ORDER BY list for keys
+func pgOrderBy(keys []keyColumn) string {
+	cols := make([]string, len(keys))
+	for i, k := range keys {
+		cols[i] = k.column
+		if k.fold {
+			cols[i] = "lower(" + k.column + ")"
+		}
+		if k.desc {
+			cols[i] += " DESC"
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// postgrestKeyset renders the or=() filter for rows that sort after keys.
+// PostgREST cannot compare lower(name), so folded keys compare as stored.
+func postgrestKeyset(keys []keyColumn) string {
+	value := func(v any) string {
+		switch v := v.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case time.Time:
+			return `"` + v.UTC().Format(time.RFC3339Nano) + `"`
+		default:
+			s := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(fmt.Sprint(v))
+			return `"` + s + `"`
+		}
+	}
+
+	ors := make([]string, len(keys))
+	for i, k := range keys {
+		ands := make([]string, 0, i+1)
+		for _, prev := range keys[:i] {
+			ands = append(ands, prev.column+".eq."+value(prev.value))
+		}
+		op := ".gt."
+		if k.desc {
+			op = ".lt."
+		}
+		ands = append(ands, k.column+op+value(k.value))
+		if len(ands) == 1 {
+			ors[i] = ands[0]
+		} else {
+			ors[i] = "and(" + strings.Join(ands, ",") + ")"
+		}
+	}
+	return strings.Join(ors, ",")
+}
@@ -0,0 +1,134 @@
+// Package store/payment.go contains the payment types shared by all backends
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment statuses, used both for an order's PaymentStatus and for each
+// payment attempt
+const (
+	PaymentPending           = "pending"
+	PaymentPaid              = "paid"
+	PaymentFailed            = "failed"
+	PaymentPartiallyRefunded = "partially_refunded"
+	PaymentRefunded          = "refunded"
+)
+
+// paymentTransitions lists the statuses a payment attempt can be settled to
+// from each status. Failed attempts are final; paying again starts a new
+// attempt. Paid attempts only move through refunds, see refundPayment.
+var paymentTransitions = map[string][]string{
+	PaymentPending: {PaymentPaid, PaymentFailed},
+}
+
+// IsValidPaymentStatus reports whether status is one of the payment statuses
+func IsValidPaymentStatus(status string) bool {
+	switch status {
+	case PaymentPending, PaymentPaid, PaymentFailed, PaymentPartiallyRefunded, PaymentRefunded:
+		return true
+	}
+	return false
+}
+
+// IsRefundable reports whether an attempt in status has money left to refund
+func IsRefundable(status string) bool {
+	return status == PaymentPaid || status == PaymentPartiallyRefunded
+}
+
+// canTransitionPayment reports whether an attempt in status from can move to to
+func canTransitionPayment(from, to string) bool {
+	for _, next := range paymentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment is one attempt to pay for an order through a payment gateway.
+// IntentID is the gateway's reference for it, unique per provider.
+// RefundedAmount is how much of Amount has been refunded so far.
+type Payment struct {
+	ID             string    `json:"id"`
+	OrderID        string    `json:"order_id"`
+	Provider       string    `json:"provider"`
+	IntentID       string    `json:"intent_id"`
+	Amount         Money     `json:"amount"`
+	RefundedAmount Money     `json:"refunded_amount"`
+	Status         string    `json:"status"`
+	FailureReason  string    `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Remaining is how much of the payment has not been refunded
+func (p *Payment) Remaining() Money {
+	return NewMoney(p.Amount.Amount-p.RefundedAmount.Amount, p.Amount.currencyOrDefault())
+}
+
+// NewPayment creates a new pending Payment for orderID
+func NewPayment(orderID, provider, intentID string, amount Money) *Payment {
+	now := time.Now()
+	return &Payment{
+		ID:             uuid.New().String(),
+		OrderID:        orderID,
+		Provider:       provider,
+		IntentID:       intentID,
+		Amount:         amount,
+		RefundedAmount: NewMoney(0, amount.currencyOrDefault()),
+		Status:         PaymentPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// validatePayment rejects payments that are not tied to an order and a
+// gateway intent
+func validatePayment(p *Payment) error {
+	if p.OrderID == "" || p.Provider == "" || p.IntentID == "" {
+		return fmt.Errorf("%w: payment needs an order, provider and intent", ErrInvalidPayment)
+	}
+	if !IsValidPaymentStatus(p.Status) {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidPayment, p.Status)
+	}
+	return nil
+}
+
+// paymentTransitionError explains why payment p cannot move to status
+func paymentTransitionError(p *Payment, status string) error {
+	return fmt.Errorf("payment %s from %s to %s: %w", p.ID, p.Status, status, ErrPaymentTransition)
+}
+
+// refundPayment records on p that refunded has been returned of it in total,
+// as gateways report refunds, so that a repeated report changes nothing and
+// fails with ErrPaymentTransition. The payment is refunded once all of it has
+// been returned and partially refunded until then.
+func refundPayment(p *Payment, refunded Money) error {
+	if !IsRefundable(p.Status) {
+		return paymentTransitionError(p, PaymentRefunded)
+	}
+	if refunded.currencyOrDefault() != p.Amount.currencyOrDefault() {
+		return fmt.Errorf("%w: refund in %s of a payment in %s", ErrInvalidPayment,
+			refunded.currencyOrDefault(), p.Amount.currencyOrDefault())
+	}
+	if refunded.Amount > p.Amount.Amount {
+		return fmt.Errorf("%w: refunds of %s exceed the payment of %s", ErrInvalidPayment,
+			refunded, p.Amount)
+	}
+	if refunded.Amount <= p.RefundedAmount.Amount {
+		return fmt.Errorf("payment %s already refunded %s: %w", p.ID, p.RefundedAmount,
+			ErrPaymentTransition)
+	}
+
+	p.RefundedAmount = NewMoney(refunded.Amount, p.Amount.currencyOrDefault())
+	p.Status = PaymentPartiallyRefunded
+	if refunded.Amount == p.Amount.Amount {
+		p.Status = PaymentRefunded
+	}
+	p.UpdatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package store/pet_access.go contains the pet access grants shared by all backends
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles a client is given on someone else's pet: co-owners may be given
+// every permission, caretakers every one but managing the pet
+const (
+	PetAccessCoOwner   = "co_owner"
+	PetAccessCaretaker = "caretaker"
+)
+
+// Permissions a pet access grant can give
+const (
+	// PermissionViewRecords lets the grantee see the pet, its medical
+	// records and its QR code
+	PermissionViewRecords = "view_records"
+	// PermissionBookAppointments lets the grantee book, change and cancel
+	// the pet's appointments
+	PermissionBookAppointments = "book_appointments"
+	// PermissionOrder lets the grantee place orders on the owner's account
+	PermissionOrder = "order"
+	// PermissionManagePet lets the grantee edit the pet and its QR code
+	PermissionManagePet = "manage_pet"
+)
+
+// PetAccessPermissions lists every permission a grant can give
+var PetAccessPermissions = []string{
+	PermissionViewRecords,
+	PermissionBookAppointments,
+	PermissionOrder,
+	PermissionManagePet,
+}
+
+// DefaultPetAccessPermissions are what a grant of role gives when the owner
+// does not list any
+func DefaultPetAccessPermissions(role string) []string {
+	if role == PetAccessCoOwner {
+		return slices.Clone(PetAccessPermissions)
+	}
+	return []string{PermissionViewRecords, PermissionBookAppointments}
+}
+
+// PetAccessGrant lets a client other than a pet's owner act for the pet.
+// It is active from CreatedAt until ExpiresAt, when set, or until revoked.
+// CreatedBy is the owner or admin who made it. A grant without a GranteeID
+// is an invitation to GranteeEmail, which no client had when it was made,
+// and the client who later signs up with that email claims it.
+type PetAccessGrant struct {
+	ID           string     `json:"id"`
+	PetID        string     `json:"pet_id"`
+	OwnerID      string     `json:"owner_id"`
+	GranteeID    string     `json:"grantee_id,omitempty"`
+	GranteeEmail string     `json:"grantee_email"`
+	Role         string     `json:"role"`
+	Permissions  []string   `json:"permissions"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy    string     `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// NewPetAccessGrant creates a new PetAccessGrant with generated ID and
+// timestamp giving grantee role on the pet of ownerID
+func NewPetAccessGrant(
+	petID, ownerID string,
+	grantee *Client,
+	role string,
+	permissions []string,
+	expiresAt *time.Time,
+	createdBy string,
+) *PetAccessGrant {
+	return &PetAccessGrant{
+		ID:           uuid.New().String(),
+		PetID:        petID,
+		OwnerID:      ownerID,
+		GranteeID:    grantee.ID,
+		GranteeEmail: grantee.Email,
+		Role:         role,
+		Permissions:  permissions,
+		ExpiresAt:    expiresAt,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Invitation reports whether g is waiting for a client with its email
+func (g *PetAccessGrant) Invitation() bool {
+	return g.GranteeID == ""
+}
+
+// SameGrantee reports whether g and other were given to the same client, or
+// are invitations to the same email, which ignores case
+func (g *PetAccessGrant) SameGrantee(other *PetAccessGrant) bool {
+	if g.Invitation() || other.Invitation() {
+		return g.Invitation() && other.Invitation() && strings.EqualFold(g.GranteeEmail, other.GranteeEmail)
+	}
+	return g.GranteeID == other.GranteeID
+}
+
+// Active reports whether g is neither revoked nor expired at now
+func (g *PetAccessGrant) Active(now time.Time) bool {
+	return g.RevokedAt == nil && (g.ExpiresAt == nil || now.Before(*g.ExpiresAt))
+}
+
+// Allows reports whether g is active at now and gives permission
+func (g *PetAccessGrant) Allows(permission string, now time.Time) bool {
+	return g.Active(now) && slices.Contains(g.Permissions, permission)
+}
+
+// validatePetAccessGrant rejects grants to the pet's owner, invitations
+// without an email, grants of an unknown role, without permissions or with
+// ones the role cannot have, and grants that expire before they are made
+func validatePetAccessGrant(g *PetAccessGrant) error {
+	if g.GranteeID == g.OwnerID {
+		return fmt.Errorf("%w: owners cannot be granted access to their own pet", ErrInvalidPetAccess)
+	}
+	if g.Invitation() && g.GranteeEmail == "" {
+		return fmt.Errorf("%w: an invitation needs an email", ErrInvalidPetAccess)
+	}
+	if g.Role != PetAccessCoOwner && g.Role != PetAccessCaretaker {
+		return fmt.Errorf("%w: unknown role %q", ErrInvalidPetAccess, g.Role)
+	}
+	if len(g.Permissions) == 0 {
+		return fmt.Errorf("%w: at least one permission is required", ErrInvalidPetAccess)
+	}
+	for i, p := range g.Permissions {
+		if !slices.Contains(PetAccessPermissions, p) {
+			return fmt.Errorf("%w: unknown permission %q", ErrInvalidPetAccess, p)
+		}
+		if slices.Contains(g.Permissions[:i], p) {
+			return fmt.Errorf("%w: permission %q is listed twice", ErrInvalidPetAccess, p)
+		}
+		if p == PermissionManagePet && g.Role != PetAccessCoOwner {
+			return fmt.Errorf("%w: only co-owners can manage the pet", ErrInvalidPetAccess)
+		}
+	}
+	if g.ExpiresAt != nil && !g.ExpiresAt.After(g.CreatedAt) {
+		return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidPetAccess)
+	}
+	return nil
+}
+
+// storedPetAccessGrant copies a grant so callers cannot change the stored
+// permissions
+func storedPetAccessGrant(g PetAccessGrant) PetAccessGrant {
+	g.Permissions = slices.Clone(g.Permissions)
+	if g.Permissions == nil {
+		g.Permissions = []string{}
+	}
+	return g
+}
@@ -0,0 +1,2599 @@
+// Package store/postgres.go contains a native PostgreSQL Database backed by pgx
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pet-mgt/backend/internal/migrate"
+	"pet-mgt/backend/migrations"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Transactor is implemented by backends that can run several operations atomically
+type Transactor interface {
+	// WithTx runs fn inside a single transaction. The Database passed to fn is
+	// bound to that transaction; it commits when fn returns nil and rolls back
+	// otherwise.
+	WithTx(ctx context.Context, fn func(tx Database) error) error
+}
+
+// pgQuerier is the subset of pgx shared by *pgxpool.Pool and pgx.Tx
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// PostgresStore talks to PostgreSQL directly using the schema defined by the
+// migrations in backend/migrations. Unlike SupabaseService it honours context
+// cancellation and supports transactions through WithTx.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+	q    pgQuerier
+	inTx bool
+}
+
+var _ Transactor = (*PostgresStore)(nil)
+
+// NewPostgresStore connects to the database at databaseURL. It refuses to
+// start when the schema is behind the embedded migrations.
+func NewPostgresStore(ctx context.Context, databaseURL string) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("connect postgres: %w", err)
+	}
+
+	loaded, err := migrate.Load(migrations.FS)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := migrate.NewRunner(pool, loaded).Check(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &PostgresStore{pool: pool, q: pool}, nil
+}
+
+// Ping checks if the database connection is alive
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+// Close closes the connection pool
+func (s *PostgresStore) Close() error {
+	if !s.inTx {
+		s.pool.Close()
+	}
+	return nil
+}
+
+// WithTx runs fn inside a transaction. Nested calls reuse the outer transaction.
+func (s *PostgresStore) WithTx(ctx context.Context, fn func(tx Database) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&PostgresStore{pool: s.pool, q: tx, inTx: true}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// pgError maps pgx errors onto the store's sentinel errors
+func pgError(entity string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound(entity)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return fmt.Errorf("%s: %w", entity, ErrConflict)
+		case "23503": // foreign_key_violation
+			return fmt.Errorf("%s references a missing row: %w", entity, ErrNotFound)
+		case "22P02": // invalid_text_representation, e.g. a malformed UUID
+			return notFound(entity)
+		}
+	}
+	return fmt.Errorf("%s: %w", entity, err)
+}
+
+// execOne runs a statement that must affect exactly one row
+func (s *PostgresStore) execOne(ctx context.Context, entity, sql string, args ...any) error {
+	tag, err := s.q.Exec(ctx, sql, args...)
+	if err != nil {
+		return pgError(entity, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound(entity)
+	}
+	return nil
+}
+
+// updateVersioned runs an UPDATE ... RETURNING version on table and scans the
+// new version into version. When no row matched it tells a stale version apart
+// from a missing row; the row ID must be the first argument.
+func (s *PostgresStore) updateVersioned(
+	ctx context.Context,
+	entity, table string,
+	version *int,
+	sql string,
+	args ...any,
+) error {
+	err := s.q.QueryRow(ctx, sql, args...).Scan(version)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return pgError(entity, err)
+	}
+	live := ""
+	if softDeleted(table) {
+		live = " AND deleted_at IS NULL"
+	}
+	var exists bool
+	err = s.q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1`+live+`)`,
+		args[0]).Scan(&exists)
+	if err != nil {
+		return pgError(entity, err)
+	}
+	if exists {
+		return fmt.Errorf("%s %w", entity, ErrVersionConflict)
+	}
+	return notFound(entity)
+}
+
+// collect runs a query and scans every row with scan
+func collect[T any](
+	ctx context.Context,
+	q pgQuerier,
+	entity string,
+	scan func(pgx.Row) (T, error),
+	sql string,
+	args ...any,
+) ([]T, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, pgError(entity, err)
+	}
+	defer rows.Close()
+
+	items := []T{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, pgError(entity, err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pgError(entity, err)
+	}
+	return items, nil
+}
+
+// collectPage runs query, which must end in a WHERE clause, for the page that
+// follows page.Cursor in sortBy order and returns it with the next cursor
+func collectPage[T any](
+	ctx context.Context,
+	q pgQuerier,
+	entity string,
+	scan func(pgx.Row) (T, error),
+	key func(T) cursor,
+	sortBy string,
+	page Page,
+	query string,
+	args ...any,
+) ([]T, string, error) {
+	after, err := decodeCursor(page.Cursor, sortBy)
+	if err != nil {
+		return nil, "", err
+	}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if after != nil {
+		query += " AND " + pgKeyset(after.keys(), arg)
+	}
+	limit := page.limit()
+	query += " ORDER BY " + pgOrderBy(cursor{Sort: sortBy}.keys()) + " LIMIT " + arg(limit+1)
+
+	items, err := collect(ctx, q, entity, scan, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	items, next := trimPage(items, limit, key)
+	return items, next, nil
+}
+
+// User operations
+
+const clientColumns = `id::text, name, email, COALESCE(phone, ''), COALESCE(address, ''),
+	COALESCE(role, 'client')`
+
+func scanClient(row pgx.Row) (Client, error) {
+	var c Client
+	err := row.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.Address, &c.Role)
+	return c, err
+}
+
+const vetColumns = `id::text, name, email, COALESCE(phone, ''), COALESCE(clinic_address, ''),
+	COALESCE(available_hours, '[]'::jsonb), COALESCE(role, 'veterinarian')`
+
+func scanVeterinarian(row pgx.Row) (Veterinarian, error) {
+	var v Veterinarian
+	err := row.Scan(&v.ID, &v.Name, &v.Email, &v.Phone, &v.ClinicAddress, &v.AvailableHours, &v.Role)
+	return v, err
+}
+
+const userColumns = `id, email, role, profile, suspended_at, suspension_reason`
+
+func scanUser(row pgx.Row) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Email, &u.Role, &u.Profile, &u.SuspendedAt, &u.SuspensionReason)
+	return u, err
+}
+
+// GetUserByID retrieves a user by their ID from the user_accounts view, which
+// joins their profile with the admin registry and any suspension
+func (s *PostgresStore) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	u, err := scanUser(s.q.QueryRow(ctx, `
+		SELECT `+userColumns+` FROM user_accounts
+		WHERE id = $1
+		LIMIT 1`, userID))
+	if err != nil {
+		return nil, pgError("user", err)
+	}
+	return &u, nil
+}
+
+// CreateUser is not supported; profiles are role specific
+func (s *PostgresStore) CreateUser(ctx context.Context, user *User) error {
+	return fmt.Errorf("use CreateClient or CreateVeterinarian instead")
+}
+
+// UpdateUser is not supported; profiles are role specific
+func (s *PostgresStore) UpdateUser(ctx context.Context, user *User) error {
+	return fmt.Errorf("use UpdateClient or UpdateVeterinarian instead")
+}
+
+// DeleteUser moves a client with their pets, or a veterinarian with their
+// products, to the trash. A user with neither profile is not found.
+func (s *PostgresStore) DeleteUser(ctx context.Context, userID string) error {
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		clients, err := trashRows(ctx, q, "clients", "id", []string{userID})
+		if err != nil {
+			return err
+		}
+		vets, err := trashRows(ctx, q, "veterinarians", "id", []string{userID})
+		if err != nil {
+			return err
+		}
+		if clients+vets == 0 {
+			return notFound("user")
+		}
+		return nil
+	})
+}
+
+// ListUsers lists users with role, or all users, ordered by ID with pagination
+func (s *PostgresStore) ListUsers(ctx context.Context, role string, page Page) ([]User, string, error) {
+	return collectPage(ctx, s.q, "user", scanUser, userKey, sortByID, page, `
+		SELECT `+userColumns+` FROM user_accounts
+		WHERE ($1 = '' OR role = $1)`, role)
+}
+
+// CreateClient creates a new client profile
+func (s *PostgresStore) CreateClient(ctx context.Context, client *Client) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO clients (id, name, email, phone, address, role)
+		VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'client'))`,
+		client.ID, client.Name, client.Email, client.Phone, client.Address, client.Role)
+	return pgError("client", err)
+}
+
+// CreateVeterinarian creates a new veterinarian profile
+func (s *PostgresStore) CreateVeterinarian(ctx context.Context, vet *Veterinarian) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO veterinarians (id, name, email, phone, clinic_address, available_hours, role)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, ''), 'veterinarian'))`,
+		vet.ID, vet.Name, vet.Email, vet.Phone, vet.ClinicAddress,
+		workingHoursJSON(vet.AvailableHours), vet.Role)
+	return pgError("veterinarian", err)
+}
+
+// UpdateClient updates a client profile
+func (s *PostgresStore) UpdateClient(ctx context.Context, client *Client) error {
+	return s.execOne(ctx, "client", `
+		UPDATE clients
+		SET name = $2, email = $3, phone = $4, address = $5, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL`,
+		client.ID, client.Name, client.Email, client.Phone, client.Address)
+}
+
+// UpdateVeterinarian updates a veterinarian profile
+func (s *PostgresStore) UpdateVeterinarian(ctx context.Context, vet *Veterinarian) error {
+	return s.execOne(ctx, "veterinarian", `
+		UPDATE veterinarians
+		SET name = $2, email = $3, phone = $4, clinic_address = $5, available_hours = $6,
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL`,
+		vet.ID, vet.Name, vet.Email, vet.Phone, vet.ClinicAddress,
+		workingHoursJSON(vet.AvailableHours))
+}
+
+// workingHoursJSON never stores NULL for a vet without hours
+func workingHoursJSON(hours []WorkingHours) []WorkingHours {
+	if hours == nil {
+		return []WorkingHours{}
+	}
+	return hours
+}
+
+// GetClientByID retrieves a client by ID
+func (s *PostgresStore) GetClientByID(ctx context.Context, clientID string) (*Client, error) {
+	c, err := scanClient(s.q.QueryRow(ctx,
+		`SELECT `+clientColumns+` FROM clients WHERE id = $1 AND deleted_at IS NULL`,
+		clientID))
+	if err != nil {
+		return nil, pgError("client", err)
+	}
+	return &c, nil
+}
+
+// GetClientByEmail retrieves a client by email
+func (s *PostgresStore) GetClientByEmail(ctx context.Context, email string) (*Client, error) {
+	c, err := scanClient(s.q.QueryRow(ctx,
+		`SELECT `+clientColumns+` FROM clients
+		WHERE lower(email) = lower($1) AND deleted_at IS NULL
+		ORDER BY email = $1 DESC
+		LIMIT 1`,
+		email))
+	if err != nil {
+		return nil, pgError("client", err)
+	}
+	return &c, nil
+}
+
+// GetVeterinarianByID retrieves a veterinarian by ID
+func (s *PostgresStore) GetVeterinarianByID(
+	ctx context.Context,
+	vetID string,
+) (*Veterinarian, error) {
+	v, err := scanVeterinarian(s.q.QueryRow(ctx,
+		`SELECT `+vetColumns+` FROM veterinarians WHERE id = $1 AND deleted_at IS NULL`,
+		vetID))
+	if err != nil {
+		return nil, pgError("veterinarian", err)
+	}
+	return &v, nil
+}
+
+// Admin registry and account operations
+
+// GrantAdmin adds a user to the admin registry
+func (s *PostgresStore) GrantAdmin(ctx context.Context, grant *AdminGrant) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO admins (user_id, email, name, granted_by, granted_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		grant.UserID, grant.Email, grant.Name, grant.GrantedBy, grant.GrantedAt)
+	return pgError("admin", err)
+}
+
+// RevokeAdmin removes a user from the admin registry unless they are the
+// last admin. The registry is locked first so two admins demoting each other
+// at once cannot leave none.
+func (s *PostgresStore) RevokeAdmin(ctx context.Context, userID string) error {
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		admins, err := collect(ctx, q, "admin", func(row pgx.Row) (string, error) {
+			var id string
+			err := row.Scan(&id)
+			return id, err
+		}, `SELECT user_id::text FROM admins FOR UPDATE`)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(admins, userID) {
+			return notFound("admin")
+		}
+		if len(admins) == 1 {
+			return ErrLastAdmin
+		}
+		return tx.(*PostgresStore).execOne(ctx, "admin",
+			`DELETE FROM admins WHERE user_id = $1`, userID)
+	})
+}
+
+// SuspendUser suspends a user's account, replacing any earlier suspension
+func (s *PostgresStore) SuspendUser(ctx context.Context, suspension *Suspension) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO user_suspensions (user_id, reason, suspended_by, suspended_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id)
+		DO UPDATE SET reason = $2, suspended_by = $3, suspended_at = $4`,
+		suspension.UserID, suspension.Reason, suspension.SuspendedBy, suspension.SuspendedAt)
+	return pgError("user", err)
+}
+
+// ReactivateUser lifts a user's suspension
+func (s *PostgresStore) ReactivateUser(ctx context.Context, userID string) error {
+	return s.execOne(ctx, "suspension", `DELETE FROM user_suspensions WHERE user_id = $1`, userID)
+}
+
+// Pet operations
+
+const petColumns = `id::text, owner_id::text, name, type, COALESCE(breed, ''),
+	to_char(date_of_birth, 'YYYY-MM-DD'), COALESCE(weight, 0)::float8, created_at, updated_at, version`
+
+func scanPet(row pgx.Row) (Pet, error) {
+	var p Pet
+	err := row.Scan(&p.ID, &p.OwnerID, &p.Name, &p.Type, &p.Breed, &p.DateOfBirth,
+		&p.Weight, &p.CreatedAt, &p.UpdatedAt, &p.Version)
+	return p, err
+}
+
+// GetPetsByUserID retrieves a page of pets for a specific user
+func (s *PostgresStore) GetPetsByUserID(
+	ctx context.Context,
+	userID string,
+	page Page,
+) ([]Pet, string, error) {
+	return collectPage(ctx, s.q, "pet", scanPet, petKey, "", page,
+		`SELECT `+petColumns+` FROM pets WHERE owner_id = $1 AND deleted_at IS NULL`,
+		userID)
+}
+
+// GetPetByID retrieves a pet by ID
+func (s *PostgresStore) GetPetByID(ctx context.Context, petID string) (*Pet, error) {
+	p, err := scanPet(s.q.QueryRow(ctx,
+		`SELECT `+petColumns+` FROM pets WHERE id = $1 AND deleted_at IS NULL`, petID))
+	if err != nil {
+		return nil, pgError("pet", err)
+	}
+	return &p, nil
+}
+
+// CreatePet creates a new pet
+func (s *PostgresStore) CreatePet(ctx context.Context, pet *Pet) error {
+	err := s.q.QueryRow(ctx, `
+		INSERT INTO pets (id, owner_id, name, type, breed, date_of_birth, weight, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6::date, $7, $8, $9)
+		RETURNING version`,
+		pet.ID, pet.OwnerID, pet.Name, pet.Type, pet.Breed, pet.DateOfBirth, pet.Weight,
+		pet.CreatedAt, pet.UpdatedAt).Scan(&pet.Version)
+	return pgError("pet", err)
+}
+
+// UpdatePet updates an existing pet unless its version is stale
+func (s *PostgresStore) UpdatePet(ctx context.Context, pet *Pet) error {
+	return s.updateVersioned(ctx, "pet", "pets", &pet.Version, `
+		UPDATE pets
+		SET name = $2, type = $3, breed = $4, date_of_birth = $5::date, weight = $6, updated_at = $7
+		WHERE id = $1 AND deleted_at IS NULL AND ($8::int = 0 OR version = $8)
+		RETURNING version`,
+		pet.ID, pet.Name, pet.Type, pet.Breed, pet.DateOfBirth, pet.Weight, pet.UpdatedAt,
+		pet.Version)
+}
+
+// DeletePet moves a pet and its medical records to the trash
+func (s *PostgresStore) DeletePet(ctx context.Context, petID string) error {
+	return s.WithTx(ctx, func(tx Database) error {
+		_, err := trashRows(ctx, tx.(*PostgresStore).q, "pets", "id", []string{petID})
+		return err
+	})
+}
+
+// Pet access operations
+
+const petAccessColumns = `id::text, pet_id::text, owner_id::text, COALESCE(grantee_id::text, ''),
+	grantee_email, role, permissions, expires_at, revoked_at, created_by, created_at`
+
+func scanPetAccessGrant(row pgx.Row) (PetAccessGrant, error) {
+	var g PetAccessGrant
+	err := row.Scan(&g.ID, &g.PetID, &g.OwnerID, &g.GranteeID, &g.GranteeEmail, &g.Role,
+		&g.Permissions, &g.ExpiresAt, &g.RevokedAt, &g.CreatedBy, &g.CreatedAt)
+	return g, err
+}
+
+// CreatePetAccessGrant creates a new pet access grant
+func (s *PostgresStore) CreatePetAccessGrant(ctx context.Context, grant *PetAccessGrant) error {
+	if err := validatePetAccessGrant(grant); err != nil {
+		return err
+	}
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO pet_access_grants (id, pet_id, owner_id, grantee_id, grantee_email, role,
+			permissions, expires_at, created_by, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7, $8, $9, $10)`,
+		grant.ID, grant.PetID, grant.OwnerID, grant.GranteeID, grant.GranteeEmail, grant.Role,
+		stringsJSON(grant.Permissions), grant.ExpiresAt, grant.CreatedBy, grant.CreatedAt)
+	return pgError("pet access grant", err)
+}
+
+// GetPetAccessGrantByID retrieves a specific pet access grant
+func (s *PostgresStore) GetPetAccessGrantByID(
+	ctx context.Context,
+	grantID string,
+) (*PetAccessGrant, error) {
+	g, err := scanPetAccessGrant(s.q.QueryRow(ctx,
+		`SELECT `+petAccessColumns+` FROM pet_access_grants WHERE id = $1`, grantID))
+	if err != nil {
+		return nil, pgError("pet access grant", err)
+	}
+	return &g, nil
+}
+
+// GetPetAccessGrants lists the grants on a pet
+func (s *PostgresStore) GetPetAccessGrants(ctx context.Context, petID string) ([]PetAccessGrant, error) {
+	return collect(ctx, s.q, "pet access grant", scanPetAccessGrant, `
+		SELECT `+petAccessColumns+` FROM pet_access_grants
+		WHERE pet_id = $1
+		ORDER BY created_at, id`,
+		petID)
+}
+
+// GetGranteePetAccessGrants lists the grants a client received
+func (s *PostgresStore) GetGranteePetAccessGrants(
+	ctx context.Context,
+	granteeID string,
+) ([]PetAccessGrant, error) {
+	return collect(ctx, s.q, "pet access grant", scanPetAccessGrant, `
+		SELECT `+petAccessColumns+` FROM pet_access_grants
+		WHERE grantee_id = $1
+		ORDER BY created_at, id`,
+		granteeID)
+}
+
+// ClaimPetAccessInvitations gives the unrevoked invitations to email to
+// clientID
+func (s *PostgresStore) ClaimPetAccessInvitations(ctx context.Context, clientID, email string) error {
+	_, err := s.q.Exec(ctx, `
+		UPDATE pet_access_grants g SET grantee_id = $1
+		WHERE g.grantee_id IS NULL AND lower(g.grantee_email) = lower($2) AND g.revoked_at IS NULL
+			AND g.owner_id <> $1
+			AND NOT EXISTS (
+				SELECT 1 FROM pet_access_grants held
+				WHERE held.pet_id = g.pet_id AND held.grantee_id = $1 AND held.revoked_at IS NULL
+			)`,
+		clientID, email)
+	return pgError("pet access grant", err)
+}
+
+// RevokePetAccessGrant ends a pet access grant
+func (s *PostgresStore) RevokePetAccessGrant(ctx context.Context, grantID string, at time.Time) error {
+	return s.execOne(ctx, "pet access grant", `
+		UPDATE pet_access_grants SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL`,
+		grantID, at)
+}
+
+// Record consent operations
+
+const consentColumns = `id::text, pet_id::text, owner_id::text, veterinarian_id::text, kind,
+	justification, expires_at, revoked_at, created_by, created_at`
+
+func scanRecordConsent(row pgx.Row) (RecordConsent, error) {
+	var c RecordConsent
+	err := row.Scan(&c.ID, &c.PetID, &c.OwnerID, &c.VeterinarianID, &c.Kind, &c.Justification,
+		&c.ExpiresAt, &c.RevokedAt, &c.CreatedBy, &c.CreatedAt)
+	return c, err
+}
+
+// CreateRecordConsent creates a new record consent
+func (s *PostgresStore) CreateRecordConsent(ctx context.Context, consent *RecordConsent) error {
+	if err := validateRecordConsent(consent); err != nil {
+		return err
+	}
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO record_consents (id, pet_id, owner_id, veterinarian_id, kind, justification,
+			expires_at, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		consent.ID, consent.PetID, consent.OwnerID, consent.VeterinarianID, consent.Kind,
+		consent.Justification, consent.ExpiresAt, consent.CreatedBy, consent.CreatedAt)
+	return pgError("record consent", err)
+}
+
+// GetRecordConsentByID retrieves a specific record consent
+func (s *PostgresStore) GetRecordConsentByID(
+	ctx context.Context,
+	consentID string,
+) (*RecordConsent, error) {
+	c, err := scanRecordConsent(s.q.QueryRow(ctx,
+		`SELECT `+consentColumns+` FROM record_consents WHERE id = $1`, consentID))
+	if err != nil {
+		return nil, pgError("record consent", err)
+	}
+	return &c, nil
+}
+
+// GetPetRecordConsents lists the record consents on a pet
+func (s *PostgresStore) GetPetRecordConsents(ctx context.Context, petID string) ([]RecordConsent, error) {
+	return collect(ctx, s.q, "record consent", scanRecordConsent, `
+		SELECT `+consentColumns+` FROM record_consents
+		WHERE pet_id = $1
+		ORDER BY created_at, id`,
+		petID)
+}
+
+// RevokeRecordConsent ends a record consent
+func (s *PostgresStore) RevokeRecordConsent(ctx context.Context, consentID string, at time.Time) error {
+	return s.execOne(ctx, "record consent", `
+		UPDATE record_consents SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL`,
+		consentID, at)
+}
+
+// Medical record operations
+
+const recordColumns = `id::text, pet_id::text, veterinarian_id::text, appointment_id::text,
+	date_of_visit, reason_for_visit, COALESCE(diagnosis, ''),
+	COALESCE(medication_prescribed, '{}'), COALESCE(notes, ''), created_at, updated_at, version`
+
+func scanMedicalRecord(row pgx.Row) (MedicalRecord, error) {
+	var r MedicalRecord
+	err := row.Scan(&r.ID, &r.PetID, &r.VeterinarianID, &r.AppointmentID, &r.DateOfVisit,
+		&r.ReasonForVisit, &r.Diagnosis, &r.MedicationPrescribed, &r.Notes,
+		&r.CreatedAt, &r.UpdatedAt, &r.Version)
+	return r, err
+}
+
+// GetMedicalRecordsByPetID retrieves a page of medical records for a pet
+func (s *PostgresStore) GetMedicalRecordsByPetID(
+	ctx context.Context,
+	petID string,
+	page Page,
+) ([]MedicalRecord, string, error) {
+	return collectPage(ctx, s.q, "medical record", scanMedicalRecord, recordKey, "", page,
+		`SELECT `+recordColumns+` FROM medical_records WHERE pet_id = $1 AND deleted_at IS NULL`,
+		petID)
+}
+
+// GetMedicalRecordByID retrieves a specific medical record
+func (s *PostgresStore) GetMedicalRecordByID(
+	ctx context.Context,
+	recordID string,
+) (*MedicalRecord, error) {
+	r, err := scanMedicalRecord(s.q.QueryRow(ctx,
+		`SELECT `+recordColumns+` FROM medical_records WHERE id = $1 AND deleted_at IS NULL`,
+		recordID))
+	if err != nil {
+		return nil, pgError("medical record", err)
+	}
+	return &r, nil
+}
+
+// CreateMedicalRecord creates a new medical record
+func (s *PostgresStore) CreateMedicalRecord(ctx context.Context, record *MedicalRecord) error {
+	err := s.q.QueryRow(ctx, `
+		INSERT INTO medical_records (id, pet_id, veterinarian_id, appointment_id, date_of_visit,
+			reason_for_visit, diagnosis, medication_prescribed, notes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING version`,
+		record.ID, record.PetID, record.VeterinarianID, record.AppointmentID, record.DateOfVisit,
+		record.ReasonForVisit, record.Diagnosis, record.MedicationPrescribed, record.Notes,
+		record.CreatedAt, record.UpdatedAt).Scan(&record.Version)
+	return pgError("medical record", err)
+}
+
+// UpdateMedicalRecord updates an existing medical record unless its version is stale
+func (s *PostgresStore) UpdateMedicalRecord(ctx context.Context, record *MedicalRecord) error {
+	return s.updateVersioned(ctx, "medical record", "medical_records", &record.Version, `
+		UPDATE medical_records
+		SET appointment_id = $2, date_of_visit = $3, reason_for_visit = $4, diagnosis = $5,
+			medication_prescribed = $6, notes = $7, updated_at = $8
+		WHERE id = $1 AND deleted_at IS NULL AND ($9::int = 0 OR version = $9)
+		RETURNING version`,
+		record.ID, record.AppointmentID, record.DateOfVisit, record.ReasonForVisit,
+		record.Diagnosis, record.MedicationPrescribed, record.Notes, record.UpdatedAt,
+		record.Version)
+}
+
+// DeleteMedicalRecord moves a medical record to the trash
+func (s *PostgresStore) DeleteMedicalRecord(ctx context.Context, recordID string) error {
+	_, err := trashRows(ctx, s.q, "medical_records", "id", []string{recordID})
+	return err
+}
+
+// QR Code operations
+
+const qrColumns = `id::text, pet_id::text, qr_code_data, public_url, encoded_content,
+	COALESCE(is_active, true), created_at, updated_at`
+
+func scanQRCode(row pgx.Row) (QRCode, error) {
+	var q QRCode
+	err := row.Scan(&q.ID, &q.PetID, &q.QRCodeData, &q.PublicURL, &q.EncodedContent,
+		&q.IsActive, &q.CreatedAt, &q.UpdatedAt)
+	return q, err
+}
+
+// GetQRCodeByPetID retrieves the active QR code for a pet
+func (s *PostgresStore) GetQRCodeByPetID(ctx context.Context, petID string) (*QRCode, error) {
+	q, err := scanQRCode(s.q.QueryRow(ctx, `
+		SELECT `+qrColumns+` FROM qr_codes
+		WHERE pet_id = $1 AND is_active
+		ORDER BY created_at DESC LIMIT 1`, petID))
+	if err != nil {
+		return nil, pgError("qr code", err)
+	}
+	return &q, nil
+}
+
+// GetQRCodeByPublicURL retrieves the active QR code for a public URL
+func (s *PostgresStore) GetQRCodeByPublicURL(
+	ctx context.Context,
+	publicURL string,
+) (*QRCode, error) {
+	q, err := scanQRCode(s.q.QueryRow(ctx, `
+		SELECT `+qrColumns+` FROM qr_codes
+		WHERE public_url = $1 AND is_active
+			AND EXISTS (SELECT 1 FROM pets WHERE pets.id = pet_id AND deleted_at IS NULL)`,
+		publicURL))
+	if err != nil {
+		return nil, pgError("qr code", err)
+	}
+	return &q, nil
+}
+
+// CreateQRCode creates a new QR code
+func (s *PostgresStore) CreateQRCode(ctx context.Context, qrCode *QRCode) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO qr_codes (id, pet_id, qr_code_data, public_url, encoded_content, is_active,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		qrCode.ID, qrCode.PetID, qrCode.QRCodeData, qrCode.PublicURL, qrCode.EncodedContent,
+		qrCode.IsActive, qrCode.CreatedAt, qrCode.UpdatedAt)
+	return pgError("qr code", err)
+}
+
+// UpdateQRCode updates an existing QR code
+func (s *PostgresStore) UpdateQRCode(ctx context.Context, qrCode *QRCode) error {
+	return s.execOne(ctx, "qr code", `
+		UPDATE qr_codes
+		SET qr_code_data = $2, public_url = $3, encoded_content = $4, is_active = $5,
+			updated_at = NOW()
+		WHERE id = $1`,
+		qrCode.ID, qrCode.QRCodeData, qrCode.PublicURL, qrCode.EncodedContent, qrCode.IsActive)
+}
+
+// DeleteQRCode deletes a QR code by ID
+func (s *PostgresStore) DeleteQRCode(ctx context.Context, qrCodeID string) error {
+	_, err := s.q.Exec(ctx, `DELETE FROM qr_codes WHERE id = $1`, qrCodeID)
+	return pgError("qr code", err)
+}
+
+// GetPublicPetProfile retrieves public pet profile via QR code URL
+func (s *PostgresStore) GetPublicPetProfile(
+	ctx context.Context,
+	publicURL string,
+) (*PublicPetProfile, error) {
+	qrCode, err := s.GetQRCodeByPublicURL(ctx, publicURL)
+	if err != nil {
+		return nil, err
+	}
+	pet, err := s.GetPetByID(ctx, qrCode.PetID)
+	if err != nil {
+		return nil, err
+	}
+	// The public profile shows the whole history rather than one page
+	records, err := collect(ctx, s.q, "medical record", scanMedicalRecord,
+		`SELECT `+recordColumns+` FROM medical_records
+		WHERE pet_id = $1 AND deleted_at IS NULL ORDER BY created_at, id`,
+		qrCode.PetID)
+	if err != nil {
+		return nil, err
+	}
+
+	publicRecords := make([]PublicMedicalRecord, 0, len(records))
+	for _, r := range records {
+		publicRecords = append(publicRecords, PublicMedicalRecord{
+			DateOfVisit:          r.DateOfVisit.Format("2006-01-02"),
+			ReasonForVisit:       r.ReasonForVisit,
+			Diagnosis:            r.Diagnosis,
+			MedicationPrescribed: r.MedicationPrescribed,
+		})
+	}
+
+	return &PublicPetProfile{
+		PetName:          qrCode.EncodedContent.PetName,
+		PetType:          qrCode.EncodedContent.PetType,
+		Breed:            pet.Breed,
+		DateOfBirth:      pet.DateOfBirth,
+		Weight:           pet.Weight,
+		OwnerName:        qrCode.EncodedContent.OwnerName,
+		OwnerPhone:       qrCode.EncodedContent.OwnerPhone,
+		OwnerEmail:       qrCode.EncodedContent.OwnerEmail,
+		OwnerAddress:     qrCode.EncodedContent.OwnerAddress,
+		EmergencyContact: qrCode.EncodedContent.EmergencyContact,
+		MedicalAlerts:    qrCode.EncodedContent.MedicalAlerts,
+		MedicalRecords:   publicRecords,
+	}, nil
+}
+
+// Appointment operations
+
+const appointmentColumns = `id::text, client_id::text, veterinarian_id::text, pet_id::text,
+	appointment_date, COALESCE(duration_minutes, 30), reason, COALESCE(status, 'scheduled'),
+	COALESCE(notes, ''), created_at, updated_at, version`
+
+func scanAppointment(row pgx.Row) (Appointment, error) {
+	var a Appointment
+	err := row.Scan(&a.ID, &a.ClientID, &a.VeterinarianID, &a.PetID, &a.AppointmentDate,
+		&a.DurationMinutes, &a.Reason, &a.Status, &a.Notes, &a.CreatedAt, &a.UpdatedAt,
+		&a.Version)
+	return a, err
+}
+
+// GetAppointmentsByClientID retrieves a page of appointments for a client
+func (s *PostgresStore) GetAppointmentsByClientID(
+	ctx context.Context,
+	clientID string,
+	page Page,
+) ([]Appointment, string, error) {
+	return collectPage(ctx, s.q, "appointment", scanAppointment, appointmentKey, "", page,
+		`SELECT `+appointmentColumns+` FROM appointments WHERE client_id = $1`, clientID)
+}
+
+// GetAppointmentsByVeterinarianID retrieves a page of appointments for a veterinarian
+func (s *PostgresStore) GetAppointmentsByVeterinarianID(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Appointment, string, error) {
+	return collectPage(ctx, s.q, "appointment", scanAppointment, appointmentKey, "", page,
+		`SELECT `+appointmentColumns+` FROM appointments WHERE veterinarian_id = $1`, vetID)
+}
+
+// GetAppointmentByID retrieves a specific appointment
+func (s *PostgresStore) GetAppointmentByID(
+	ctx context.Context,
+	appointmentID string,
+) (*Appointment, error) {
+	a, err := scanAppointment(s.q.QueryRow(ctx,
+		`SELECT `+appointmentColumns+` FROM appointments WHERE id = $1`, appointmentID))
+	if err != nil {
+		return nil, pgError("appointment", err)
+	}
+	return &a, nil
+}
+
+// HasPetAppointment reports whether a veterinarian had an appointment for a
+// pet from since that took place by now
+func (s *PostgresStore) HasPetAppointment(
+	ctx context.Context,
+	petID, vetID string,
+	since, now time.Time,
+) (bool, error) {
+	var exists bool
+	err := s.q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM appointments
+			WHERE pet_id = $1 AND veterinarian_id = $2 AND appointment_date >= $3
+				AND (status = 'completed'
+					OR COALESCE(status, '') <> 'cancelled' AND appointment_date <= $4)
+		)`,
+		petID, vetID, since, now).Scan(&exists)
+	if err != nil {
+		return false, pgError("appointment", err)
+	}
+	return exists, nil
+}
+
+// CreateAppointment creates a new appointment
+func (s *PostgresStore) CreateAppointment(ctx context.Context, appointment *Appointment) error {
+	err := s.q.QueryRow(ctx, `
+		INSERT INTO appointments (id, client_id, veterinarian_id, pet_id, appointment_date,
+			duration_minutes, reason, status, notes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING version`,
+		appointment.ID, appointment.ClientID, appointment.VeterinarianID, appointment.PetID,
+		appointment.AppointmentDate, appointment.DurationMinutes, appointment.Reason,
+		appointment.Status, appointment.Notes, appointment.CreatedAt, appointment.UpdatedAt).
+		Scan(&appointment.Version)
+	return pgError("appointment", err)
+}
+
+// UpdateAppointment updates an existing appointment unless its version is stale
+func (s *PostgresStore) UpdateAppointment(ctx context.Context, appointment *Appointment) error {
+	return s.updateVersioned(ctx, "appointment", "appointments", &appointment.Version, `
+		UPDATE appointments
+		SET appointment_date = $2, duration_minutes = $3, reason = $4, status = $5, notes = $6,
+			updated_at = $7
+		WHERE id = $1 AND ($8::int = 0 OR version = $8)
+		RETURNING version`,
+		appointment.ID, appointment.AppointmentDate, appointment.DurationMinutes,
+		appointment.Reason, appointment.Status, appointment.Notes, appointment.UpdatedAt,
+		appointment.Version)
+}
+
+// DeleteAppointment deletes an appointment by ID
+func (s *PostgresStore) DeleteAppointment(ctx context.Context, appointmentID string) error {
+	_, err := s.q.Exec(ctx, `DELETE FROM appointments WHERE id = $1`, appointmentID)
+	return pgError("appointment", err)
+}
+
+// GetAvailableAppointmentSlots retrieves available time slots for a veterinarian
+func (s *PostgresStore) GetAvailableAppointmentSlots(
+	ctx context.Context,
+	vetID string,
+	date time.Time,
+) ([]TimeSlot, error) {
+	vet, err := s.GetVeterinarianByID(ctx, vetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(workingWindows(vet, date)) == 0 {
+		return []TimeSlot{}, nil
+	}
+
+	startOfDay, endOfDay := clinicDayBounds(date)
+	appts, err := collect(ctx, s.q, "appointment", scanAppointment,
+		`SELECT `+appointmentColumns+` FROM appointments
+		WHERE veterinarian_id = $1 AND appointment_date >= $2 AND appointment_date < $3`,
+		vetID, startOfDay, endOfDay)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildTimeSlots(vet, appts, date), nil
+}
+
+// Product operations
+
+const productColumns = `id::text, veterinarian_id::text, name, COALESCE(description, ''),
+	category, (price * 100)::bigint, currency, COALESCE(stock_quantity, 0), COALESCE(sku, ''),
+	COALESCE(brand, ''),
+	COALESCE(weight, 0)::float8, COALESCE(dimensions, '{}'::jsonb),
+	COALESCE(is_prescription_required, false), COALESCE(is_active, true),
+	COALESCE(images, '{}'), created_at, updated_at, version`
+
+func scanProduct(row pgx.Row) (Product, error) {
+	var p Product
+	err := row.Scan(&p.ID, &p.VeterinarianID, &p.Name, &p.Description, &p.Category,
+		&p.Price.Amount, &p.Price.Currency, &p.StockQuantity, &p.SKU, &p.Brand, &p.Weight, &p.Dimensions,
+		&p.IsPrescriptionRequired, &p.IsActive, &p.Images, &p.CreatedAt, &p.UpdatedAt,
+		&p.Version)
+	return p, err
+}
+
+// GetProductsByVeterinarianID retrieves a page of active products for a veterinarian
+func (s *PostgresStore) GetProductsByVeterinarianID(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Product, string, error) {
+	return collectPage(ctx, s.q, "product", scanProduct, createdProductKey, "", page,
+		`SELECT `+productColumns+` FROM products
+		WHERE veterinarian_id = $1 AND is_active AND deleted_at IS NULL`, vetID)
+}
+
+// GetProductByID retrieves a specific product
+func (s *PostgresStore) GetProductByID(ctx context.Context, productID string) (*Product, error) {
+	p, err := scanProduct(s.q.QueryRow(ctx,
+		`SELECT `+productColumns+` FROM products WHERE id = $1 AND deleted_at IS NULL`,
+		productID))
+	if err != nil {
+		return nil, pgError("product", err)
+	}
+	return &p, nil
+}
+
+// CreateProduct creates a new product and records its opening stock
+func (s *PostgresStore) CreateProduct(ctx context.Context, product *Product) error {
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		err := q.QueryRow(ctx, `
+			INSERT INTO products (id, veterinarian_id, name, description, category, price,
+				currency, stock_quantity, sku, brand, weight, dimensions,
+				is_prescription_required, is_active, images, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6::numeric / 100, $7, $8, NULLIF($9, ''), $10, $11,
+				$12, $13, $14, $15, $16, $17)
+			RETURNING version`,
+			product.ID, product.VeterinarianID, product.Name, product.Description,
+			product.Category, product.Price.Amount, product.Price.Currency,
+			product.StockQuantity, product.SKU, product.Brand, product.Weight,
+			product.Dimensions, product.IsPrescriptionRequired, product.IsActive,
+			product.Images, product.CreatedAt, product.UpdatedAt).Scan(&product.Version)
+		if err != nil {
+			return pgError("product", err)
+		}
+		if product.StockQuantity == 0 {
+			return nil
+		}
+		return insertStockMovement(ctx, q, openingMovement(product))
+	})
+}
+
+// UpdateProduct updates an existing product unless its version is stale
+func (s *PostgresStore) UpdateProduct(ctx context.Context, product *Product) error {
+	return s.updateVersioned(ctx, "product", "products", &product.Version, `
+		UPDATE products
+		SET name = $2, description = $3, category = $4, price = $5::numeric / 100,
+			currency = $6, sku = NULLIF($7, ''), brand = $8, weight = $9, dimensions = $10,
+			is_prescription_required = $11, is_active = $12, images = $13, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND ($14::int = 0 OR version = $14)
+		RETURNING version`,
+		product.ID, product.Name, product.Description, product.Category, product.Price.Amount,
+		product.Price.Currency, product.SKU, product.Brand, product.Weight, product.Dimensions,
+		product.IsPrescriptionRequired, product.IsActive, product.Images, product.Version)
+}
+
+// UpdateProductWithStock updates a product and adjusts its stock to
+// product.StockQuantity in one transaction. The product row is locked before
+// the change is worked out, so concurrent movements cannot make it stale.
+func (s *PostgresStore) UpdateProductWithStock(
+	ctx context.Context,
+	product *Product,
+	adjustment *StockMovement,
+) error {
+	if product.StockQuantity < 0 {
+		return fmt.Errorf("%w: stock cannot be negative", ErrInvalidStockMovement)
+	}
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		var stock int
+		err := q.QueryRow(ctx, `
+			SELECT COALESCE(stock_quantity, 0) FROM products
+			WHERE id = $1 AND deleted_at IS NULL
+			FOR UPDATE`, product.ID).Scan(&stock)
+		if err != nil {
+			return pgError("product", err)
+		}
+		if err := tx.UpdateProduct(ctx, product); err != nil {
+			return err
+		}
+
+		adjustment.ProductID = product.ID
+		adjustment.Type = StockAdjustment
+		adjustment.Quantity = product.StockQuantity - stock
+		if adjustment.Quantity == 0 {
+			return nil
+		}
+		if err := applyStock(ctx, q, adjustment); err != nil {
+			return err
+		}
+		if err := insertStockMovement(ctx, q, adjustment); err != nil {
+			return err
+		}
+		err = q.QueryRow(ctx, `SELECT version FROM products WHERE id = $1`, product.ID).
+			Scan(&product.Version)
+		return pgError("product", err)
+	})
+}
+
+// DeleteProduct deactivates a product and moves it to the trash
+func (s *PostgresStore) DeleteProduct(ctx context.Context, productID string) error {
+	_, err := trashRows(ctx, s.q, "products", "id", []string{productID})
+	return err
+}
+
+// ListProducts retrieves active products with filtering, sorting and a total count
+func (s *PostgresStore) ListProducts(
+	ctx context.Context,
+	filters ProductFilters,
+	page Page,
+) (*ProductPage, error) {
+	where := []string{"is_active", "deleted_at IS NULL"}
+	var args []any
+	add := func(cond string, value any) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filters.Category != "" {
+		add("category = $%d", filters.Category)
+	}
+	if filters.VeterinarianID != "" {
+		add("veterinarian_id::text = $%d", filters.VeterinarianID)
+	}
+	if filters.Brand != "" {
+		add("lower(brand) = lower($%d)", filters.Brand)
+	}
+	if filters.MinPrice.Amount > 0 {
+		add("price >= $%d::numeric / 100", filters.MinPrice.Amount)
+	}
+	if filters.MaxPrice.Amount > 0 {
+		add("price <= $%d::numeric / 100", filters.MaxPrice.Amount)
+	}
+	if terms := searchTerms(filters.Search); len(terms) > 0 {
+		add("search_vector @@ to_tsquery('simple', $%d)", prefixTSQuery(terms))
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	err := s.q.QueryRow(ctx, `SELECT COUNT(*) FROM products WHERE `+cond, args...).Scan(&total)
+	if err != nil {
+		return nil, pgError("product", err)
+	}
+
+	products, next, err := collectPage(ctx, s.q, "product", scanProduct,
+		func(p Product) cursor { return productKey(p, filters.Sort) }, filters.Sort, page,
+		`SELECT `+productColumns+` FROM products WHERE `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &ProductPage{Products: products, NextCursor: next, Total: total}, nil
+}
+
+// Stock ledger operations
+
+const stockMovementColumns = `id::text, product_id::text, type, quantity, balance_after, reason,
+	actor_id, COALESCE(order_id::text, ''), created_at`
+
+func scanStockMovement(row pgx.Row) (StockMovement, error) {
+	var m StockMovement
+	err := row.Scan(&m.ID, &m.ProductID, &m.Type, &m.Quantity, &m.BalanceAfter, &m.Reason,
+		&m.ActorID, &m.OrderID, &m.CreatedAt)
+	return m, err
+}
+
+// RecordStockMovement applies a movement to a product's stock and appends it
+// to the ledger in one transaction
+func (s *PostgresStore) RecordStockMovement(ctx context.Context, movement *StockMovement) error {
+	if err := validateStockMovement(movement); err != nil {
+		return err
+	}
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		if err := applyStock(ctx, q, movement); err != nil {
+			return err
+		}
+		return insertStockMovement(ctx, q, movement)
+	})
+}
+
+// applyStock adds movement.Quantity to the product's stock and stores the new
+// stock in movement.BalanceAfter. The UPDATE is conditional so concurrent
+// movements cannot take stock below zero.
+func applyStock(ctx context.Context, q pgQuerier, movement *StockMovement) error {
+	err := q.QueryRow(ctx, `
+		UPDATE products
+		SET stock_quantity = COALESCE(stock_quantity, 0) + $2, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND COALESCE(stock_quantity, 0) + $2 >= 0
+		RETURNING stock_quantity`,
+		movement.ProductID, movement.Quantity).Scan(&movement.BalanceAfter)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return pgError("product", err)
+	}
+
+	var available int
+	err = q.QueryRow(ctx,
+		`SELECT COALESCE(stock_quantity, 0) FROM products WHERE id = $1 AND deleted_at IS NULL`,
+		movement.ProductID).Scan(&available)
+	if err != nil {
+		return pgError("product", err)
+	}
+	return &InsufficientStockError{
+		ProductID: movement.ProductID,
+		Requested: -movement.Quantity,
+		Available: available,
+	}
+}
+
+// insertStockMovement appends a movement whose stock change is already applied
+func insertStockMovement(ctx context.Context, q pgQuerier, movement *StockMovement) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO stock_movements (id, product_id, type, quantity, balance_after, reason,
+			actor_id, order_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9)`,
+		movement.ID, movement.ProductID, movement.Type, movement.Quantity,
+		movement.BalanceAfter, movement.Reason, movement.ActorID, movement.OrderID,
+		movement.CreatedAt)
+	return pgError("stock movement", err)
+}
+
+// ListStockMovements retrieves a page of a product's stock movements, newest first
+func (s *PostgresStore) ListStockMovements(
+	ctx context.Context,
+	productID string,
+	page Page,
+) ([]StockMovement, string, error) {
+	if _, err := s.GetProductByID(ctx, productID); err != nil {
+		return nil, "", err
+	}
+	return collectPage(ctx, s.q, "stock movement", scanStockMovement, stockMovementKey,
+		sortByNewest, page,
+		`SELECT `+stockMovementColumns+` FROM stock_movements WHERE product_id = $1`, productID)
+}
+
+// Order operations
+
+const orderColumns = `id::text, client_id::text, COALESCE(placed_by, ''), veterinarian_id::text,
+	(total_amount * 100)::bigint, currency, (tax_amount * 100)::bigint, tax_inclusive, tax_lines,
+	COALESCE(discount_code, ''), (discount_amount * 100)::bigint, discounts,
+	COALESCE(status, 'pending'), COALESCE(payment_status, 'pending'),
+	COALESCE(payment_method, ''), COALESCE(shipping_address, ''),
+	COALESCE(delivery_method, 'pickup'), COALESCE(notes, ''),
+	COALESCE(checkout_group_id::text, ''), created_at, updated_at`
+
+func scanOrder(row pgx.Row) (Order, error) {
+	var o Order
+	err := row.Scan(&o.ID, &o.ClientID, &o.PlacedBy, &o.VeterinarianID, &o.TotalAmount.Amount,
+		&o.TotalAmount.Currency, &o.TaxAmount.Amount, &o.TaxInclusive, &o.TaxLines,
+		&o.DiscountCode, &o.DiscountAmount.Amount, &o.Discounts, &o.Status, &o.PaymentStatus,
+		&o.PaymentMethod, &o.ShippingAddress, &o.DeliveryMethod, &o.Notes, &o.CheckoutGroupID,
+		&o.CreatedAt, &o.UpdatedAt)
+	o.TaxAmount.Currency = o.TotalAmount.Currency
+	o.DiscountAmount.Currency = o.TotalAmount.Currency
+	return o, err
+}
+
+// GetOrdersByClientID retrieves a page of orders for a client
+func (s *PostgresStore) GetOrdersByClientID(
+	ctx context.Context,
+	clientID string,
+	page Page,
+) ([]Order, string, error) {
+	return collectPage(ctx, s.q, "order", scanOrder, orderKey, "", page,
+		`SELECT `+orderColumns+` FROM orders WHERE client_id = $1`, clientID)
+}
+
+// GetOrdersByVeterinarianID retrieves a page of orders for a veterinarian
+func (s *PostgresStore) GetOrdersByVeterinarianID(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Order, string, error) {
+	return collectPage(ctx, s.q, "order", scanOrder, orderKey, "", page,
+		`SELECT `+orderColumns+` FROM orders WHERE veterinarian_id = $1`, vetID)
+}
+
+// GetOrderByID retrieves a specific order
+func (s *PostgresStore) GetOrderByID(ctx context.Context, orderID string) (*Order, error) {
+	o, err := scanOrder(s.q.QueryRow(ctx,
+		`SELECT `+orderColumns+` FROM orders WHERE id = $1`, orderID))
+	if err != nil {
+		return nil, pgError("order", err)
+	}
+	return &o, nil
+}
+
+// CreateOrder creates a new order
+func (s *PostgresStore) CreateOrder(ctx context.Context, order *Order) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO orders (id, client_id, veterinarian_id, total_amount, currency, tax_amount,
+			tax_inclusive, tax_lines, discount_code, discount_amount, discounts, status,
+			payment_status, payment_method, shipping_address, delivery_method, notes,
+			checkout_group_id, created_at, updated_at, placed_by)
+		VALUES ($1, $2, $3, $4::numeric / 100, $5, $6::numeric / 100, $7, $8, NULLIF($9, ''),
+			$10::numeric / 100, $11, $12, $13, $14, $15, $16, $17, NULLIF($18, '')::uuid, $19, $20,
+			NULLIF($21, ''))`,
+		order.ID, order.ClientID, order.VeterinarianID, order.TotalAmount.Amount,
+		order.TotalAmount.currencyOrDefault(), order.TaxAmount.Amount, order.TaxInclusive,
+		taxLinesJSON(order.TaxLines), NormalizePromotionCode(order.DiscountCode),
+		order.DiscountAmount.Amount, discountsJSON(order.Discounts), order.Status,
+		order.PaymentStatus, order.PaymentMethod, order.ShippingAddress, order.DeliveryMethod,
+		order.Notes, order.CheckoutGroupID, order.CreatedAt, order.UpdatedAt, order.PlacedBy)
+	return pgError("order", err)
+}
+
+// discountsJSON never stores NULL for an order without discounts
+func discountsJSON(discounts []OrderDiscount) []OrderDiscount {
+	if discounts == nil {
+		return []OrderDiscount{}
+	}
+	return discounts
+}
+
+// taxRatesJSON never stores NULL for a clinic without tax rates
+func taxRatesJSON(rates []TaxRate) []TaxRate {
+	if rates == nil {
+		return []TaxRate{}
+	}
+	return rates
+}
+
+// taxLinesJSON never stores NULL for an order without tax
+func taxLinesJSON(lines []TaxLine) []TaxLine {
+	if lines == nil {
+		return []TaxLine{}
+	}
+	return lines
+}
+
+// TransitionOrder moves an order to a new status and records the change in
+// one transaction, restocking the order's items when it is cancelled
+func (s *PostgresStore) TransitionOrder(ctx context.Context, change *OrderStatusChange) error {
+	if err := validateOrderTransition(change); err != nil {
+		return err
+	}
+
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		var current, paymentStatus string
+		err := q.QueryRow(ctx, `
+			SELECT status, COALESCE(payment_status, '') FROM orders WHERE id = $1 FOR UPDATE`,
+			change.OrderID).Scan(&current, &paymentStatus)
+		if err != nil {
+			return pgError("order", err)
+		}
+		if current != change.FromStatus {
+			return orderMovedError(change, current)
+		}
+		if err := checkPaidCancellation(change, paymentStatus); err != nil {
+			return err
+		}
+
+		if change.ToStatus == OrderCancelled {
+			items, err := collect(ctx, q, "order item", scanOrderItem, `
+				SELECT `+orderItemColumns+` FROM order_items i
+				WHERE order_id = $1
+					AND EXISTS (SELECT 1 FROM products p
+						WHERE p.id = i.product_id AND p.deleted_at IS NULL)
+				ORDER BY product_id`,
+				change.OrderID)
+			if err != nil {
+				return err
+			}
+			for _, it := range items {
+				restock := cancellationRestock(change, it)
+				if err := applyStock(ctx, q, restock); err != nil {
+					return err
+				}
+				if err := insertStockMovement(ctx, q, restock); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = q.Exec(ctx, `
+			UPDATE orders
+			SET status = $2, payment_status = COALESCE(NULLIF($4, ''), payment_status),
+				updated_at = $3
+			WHERE id = $1`,
+			change.OrderID, change.ToStatus, change.CreatedAt, change.PaymentStatus)
+		if err != nil {
+			return pgError("order", err)
+		}
+		_, err = q.Exec(ctx, `
+			INSERT INTO order_status_history (id, order_id, from_status, to_status, actor_id,
+				note, created_at)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)`,
+			change.ID, change.OrderID, change.FromStatus, change.ToStatus, change.ActorID,
+			change.Note, change.CreatedAt)
+		return pgError("order status change", err)
+	})
+}
+
+// GetOrderStatusHistory lists an order's status changes, oldest first
+func (s *PostgresStore) GetOrderStatusHistory(
+	ctx context.Context,
+	orderID string,
+) ([]OrderStatusChange, error) {
+	if _, err := s.GetOrderByID(ctx, orderID); err != nil {
+		return nil, err
+	}
+	return collect(ctx, s.q, "order status change", func(row pgx.Row) (OrderStatusChange, error) {
+		var c OrderStatusChange
+		err := row.Scan(&c.ID, &c.OrderID, &c.FromStatus, &c.ToStatus, &c.ActorID, &c.Note,
+			&c.CreatedAt)
+		return c, err
+	}, `
+		SELECT id::text, order_id::text, from_status, to_status, actor_id,
+			COALESCE(note, ''), created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at, id`,
+		orderID)
+}
+
+const orderItemColumns = `id::text, order_id::text, product_id::text, quantity,
+	(unit_price * 100)::bigint, (total_price * 100)::bigint, currency, created_at`
+
+func scanOrderItem(row pgx.Row) (OrderItem, error) {
+	var it OrderItem
+	err := row.Scan(&it.ID, &it.OrderID, &it.ProductID, &it.Quantity, &it.UnitPrice.Amount,
+		&it.TotalPrice.Amount, &it.UnitPrice.Currency, &it.CreatedAt)
+	it.TotalPrice.Currency = it.UnitPrice.Currency
+	return it, err
+}
+
+// GetOrderItems retrieves items for an order
+func (s *PostgresStore) GetOrderItems(ctx context.Context, orderID string) ([]OrderItem, error) {
+	return collect(ctx, s.q, "order item", scanOrderItem,
+		`SELECT `+orderItemColumns+` FROM order_items WHERE order_id = $1 ORDER BY created_at, id`,
+		orderID)
+}
+
+// CreateOrderItem creates a new order item
+func (s *PostgresStore) CreateOrderItem(ctx context.Context, item *OrderItem) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price,
+			currency, created_at)
+		VALUES ($1, $2, $3, $4, $5::numeric / 100, $6::numeric / 100, $7, $8)`,
+		item.ID, item.OrderID, item.ProductID, item.Quantity, item.UnitPrice.Amount,
+		item.TotalPrice.Amount, item.UnitPrice.currencyOrDefault(), item.CreatedAt)
+	return pgError("order item", err)
+}
+
+// PlaceOrder inserts an order with its items and decrements stock in one transaction.
+// Stock is decremented with a conditional UPDATE so concurrent buyers cannot oversell,
+// and only stock that no reservation holds can be sold.
+func (s *PostgresStore) PlaceOrder(ctx context.Context, order *Order, items []OrderItem) error {
+	if err := validateOrderPlacement(order, items); err != nil {
+		return err
+	}
+
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+
+		// Lock product rows in a stable order to avoid deadlocks between checkouts
+		lines := make([]int, len(items))
+		for i := range lines {
+			lines[i] = i
+		}
+		sort.SliceStable(lines, func(a, b int) bool {
+			return items[lines[a]].ProductID < items[lines[b]].ProductID
+		})
+
+		var total Money
+		sales := make([]*StockMovement, 0, len(items))
+		categories := make(map[string]string, len(items))
+		for _, i := range lines {
+			var vetID, category string
+			var price Money
+			sale := NewStockMovement(items[i].ProductID, StockSale, -items[i].Quantity,
+				order.placer())
+			sale.OrderID = order.ID
+			err := q.QueryRow(ctx, `
+				UPDATE products
+				SET stock_quantity = stock_quantity - $2, updated_at = NOW()
+				WHERE id = $1 AND is_active AND stock_quantity - reserved_stock(id) >= $2
+				RETURNING veterinarian_id::text, (price * 100)::bigint, currency, stock_quantity,
+					COALESCE(category, '')`,
+				items[i].ProductID, items[i].Quantity).
+				Scan(&vetID, &price.Amount, &price.Currency, &sale.BalanceAfter, &category)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return s.stockFailure(ctx, q, items[i])
+			}
+			if err != nil {
+				return pgError("product", err)
+			}
+			if vetID != order.VeterinarianID {
+				return fmt.Errorf("%w: all products must be from the same veterinarian", ErrInvalidOrder)
+			}
+
+			items[i].OrderID = order.ID
+			items[i].UnitPrice = price
+			items[i].TotalPrice = price.Mul(items[i].Quantity)
+			if total, err = total.Add(items[i].TotalPrice); err != nil {
+				return fmt.Errorf("%w: all products must be priced in the same currency", ErrInvalidOrder)
+			}
+			sales = append(sales, sale)
+			categories[items[i].ProductID] = category
+		}
+
+		discounts, err := claimPromotions(ctx, q, order, items, categories)
+		if err != nil {
+			return err
+		}
+		settings, err := getTaxSettings(ctx, q, order.VeterinarianID)
+		if err != nil {
+			return err
+		}
+		applyTax(order, items, categories, discounts, settings)
+		if err := tx.CreateOrder(ctx, order); err != nil {
+			return err
+		}
+		for i := range items {
+			if err := tx.CreateOrderItem(ctx, &items[i]); err != nil {
+				return err
+			}
+		}
+		for _, sale := range sales {
+			if err := insertStockMovement(ctx, q, sale); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// stockFailure explains why the conditional stock decrement for item matched no row
+func (s *PostgresStore) stockFailure(ctx context.Context, q pgQuerier, item OrderItem) error {
+	var available int
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(stock_quantity, 0) - reserved_stock(id) FROM products
+		WHERE id = $1 AND is_active`,
+		item.ProductID).Scan(&available)
+	if err != nil {
+		return pgError("product "+item.ProductID, err)
+	}
+	return &InsufficientStockError{
+		ProductID: item.ProductID,
+		Requested: item.Quantity,
+		Available: available,
+	}
+}
+
+// Reservation operations
+
+const reservationColumns = `id::text, client_id::text, status, items,
+	COALESCE(checkout_id::text, ''), expires_at, created_at, updated_at`
+
+func scanReservation(row pgx.Row) (Reservation, error) {
+	var r Reservation
+	err := row.Scan(&r.ID, &r.ClientID, &r.Status, &r.Items, &r.CheckoutID, &r.ExpiresAt,
+		&r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// CreateReservation holds stock for a client if enough of every product is
+// available. Product rows are locked in a stable order first so concurrent
+// checkouts and orders see each other's reservations.
+func (s *PostgresStore) CreateReservation(ctx context.Context, reservation *Reservation) error {
+	if err := validateReservation(reservation); err != nil {
+		return err
+	}
+
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		items := mergeReservationItems(reservation.Items)
+		for _, it := range items {
+			var stock, reserved int
+			err := q.QueryRow(ctx, `
+				SELECT COALESCE(stock_quantity, 0) FROM products
+				WHERE id = $1 AND is_active AND deleted_at IS NULL
+				FOR UPDATE`,
+				it.ProductID).Scan(&stock)
+			if err != nil {
+				return pgError("product "+it.ProductID, err)
+			}
+			err = q.QueryRow(ctx, `SELECT reserved_stock($1)`, it.ProductID).Scan(&reserved)
+			if err != nil {
+				return pgError("product "+it.ProductID, err)
+			}
+			if stock-reserved < it.Quantity {
+				return &InsufficientStockError{
+					ProductID: it.ProductID,
+					Requested: it.Quantity,
+					Available: stock - reserved,
+				}
+			}
+		}
+
+		_, err := q.Exec(ctx, `
+			INSERT INTO reservations (id, client_id, status, items, expires_at, created_at,
+				updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			reservation.ID, reservation.ClientID, reservation.Status, reservation.Items,
+			reservation.ExpiresAt, reservation.CreatedAt, reservation.UpdatedAt)
+		return pgError("reservation", err)
+	})
+}
+
+// GetReservationByID retrieves a specific reservation
+func (s *PostgresStore) GetReservationByID(
+	ctx context.Context,
+	reservationID string,
+) (*Reservation, error) {
+	r, err := scanReservation(s.q.QueryRow(ctx,
+		`SELECT `+reservationColumns+` FROM reservations WHERE id = $1`, reservationID))
+	if err != nil {
+		return nil, pgError("reservation", err)
+	}
+	return &r, nil
+}
+
+// ReleaseReservation gives the stock a reservation holds back before it expires
+func (s *PostgresStore) ReleaseReservation(ctx context.Context, reservationID string) error {
+	tag, err := s.q.Exec(ctx, `
+		UPDATE reservations SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = $3 AND expires_at > NOW()`,
+		reservationID, ReservationReleased, ReservationActive)
+	if err != nil {
+		return pgError("reservation", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return s.reservationClosed(ctx, s.q, reservationID)
+	}
+	return nil
+}
+
+// reservationClosed explains why a reservation could not be released or
+// confirmed: it is missing, or it no longer holds stock
+func (s *PostgresStore) reservationClosed(ctx context.Context, q pgQuerier, id string) error {
+	var exists bool
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM reservations WHERE id = $1)`, id).
+		Scan(&exists)
+	if err != nil {
+		return pgError("reservation", err)
+	}
+	if !exists {
+		return notFound("reservation")
+	}
+	return fmt.Errorf("reservation %s: %w", id, ErrReservationClosed)
+}
+
+// ConfirmReservation converts a reservation into a checkout of one order per
+// veterinarian in one transaction. The reservation stops holding its stock
+// before the orders are placed, so they can take it.
+func (s *PostgresStore) ConfirmReservation(
+	ctx context.Context,
+	reservationID string,
+	template *Order,
+) (*Checkout, error) {
+	var checkout *Checkout
+	err := s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		res, err := scanReservation(q.QueryRow(ctx, `
+			SELECT `+reservationColumns+` FROM reservations
+			WHERE id = $1 AND status = $2 AND expires_at > NOW()
+			FOR UPDATE`,
+			reservationID, ReservationActive))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.reservationClosed(ctx, q, reservationID)
+		}
+		if err != nil {
+			return pgError("reservation", err)
+		}
+		if template.ClientID != res.ClientID {
+			return fmt.Errorf("%w: order is not for the reservation's client", ErrInvalidOrder)
+		}
+
+		_, err = q.Exec(ctx,
+			`UPDATE reservations SET status = $2, updated_at = NOW() WHERE id = $1`,
+			reservationID, ReservationConverted)
+		if err != nil {
+			return pgError("reservation", err)
+		}
+		checkout, err = tx.(*PostgresStore).placeCheckout(ctx, template, res.orderItems())
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec(ctx, `UPDATE reservations SET checkout_id = $2 WHERE id = $1`,
+			reservationID, checkout.ID)
+		return pgError("reservation", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// placeCheckout places items as one order per veterinarian. Callers run it
+// inside a transaction so that either every order is placed or none is.
+func (s *PostgresStore) placeCheckout(
+	ctx context.Context,
+	template *Order,
+	items []OrderItem,
+) (*Checkout, error) {
+	productIDs := make([]string, len(items))
+	for i, it := range items {
+		productIDs[i] = it.ProductID
+	}
+	found, err := collect(ctx, s.q, "product", func(row pgx.Row) (Product, error) {
+		var p Product
+		err := row.Scan(&p.ID, &p.VeterinarianID, &p.Price.Currency)
+		return p, err
+	}, `
+		SELECT id::text, veterinarian_id::text, currency FROM products
+		WHERE id::text = ANY($1) AND is_active AND deleted_at IS NULL`,
+		productIDs)
+	if err != nil {
+		return nil, err
+	}
+	products := make(map[string]Product, len(found))
+	for _, p := range found {
+		products[p.ID] = p
+	}
+
+	checkout, err := splitCheckout(template, items, products)
+	if err != nil {
+		return nil, err
+	}
+	for i := range checkout.Orders {
+		o := &checkout.Orders[i]
+		if err := s.PlaceOrder(ctx, &o.Order, o.Items); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkout.total(); err != nil {
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// ExpireReservations marks reservations that lapsed before now expired
+func (s *PostgresStore) ExpireReservations(ctx context.Context, now time.Time) (int, error) {
+	tag, err := s.q.Exec(ctx, `
+		UPDATE reservations SET status = $1, updated_at = NOW()
+		WHERE status = $2 AND expires_at <= $3`,
+		ReservationExpired, ReservationActive, now)
+	if err != nil {
+		return 0, pgError("reservation", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// Payment operations
+
+// UpdateOrderPaymentStatus sets an order's payment status
+func (s *PostgresStore) UpdateOrderPaymentStatus(
+	ctx context.Context,
+	orderID string,
+	paymentStatus string,
+) error {
+	return s.execOne(ctx, "order",
+		`UPDATE orders SET payment_status = $2, updated_at = NOW() WHERE id = $1`,
+		orderID, paymentStatus)
+}
+
+const paymentColumns = `id::text, order_id::text, provider, intent_id,
+	(amount * 100)::bigint, (refunded_amount * 100)::bigint, currency, status,
+	COALESCE(failure_reason, ''), created_at, updated_at`
+
+func scanPayment(row pgx.Row) (Payment, error) {
+	var p Payment
+	err := row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.IntentID, &p.Amount.Amount,
+		&p.RefundedAmount.Amount, &p.Amount.Currency, &p.Status, &p.FailureReason,
+		&p.CreatedAt, &p.UpdatedAt)
+	p.RefundedAmount.Currency = p.Amount.Currency
+	return p, err
+}
+
+// CreatePayment records a payment attempt for an existing order
+func (s *PostgresStore) CreatePayment(ctx context.Context, payment *Payment) error {
+	if err := validatePayment(payment); err != nil {
+		return err
+	}
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO payments (id, order_id, provider, intent_id, amount, refunded_amount,
+			currency, status, failure_reason, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5::numeric / 100, $6::numeric / 100, $7, $8, NULLIF($9, ''),
+			$10, $11)`,
+		payment.ID, payment.OrderID, payment.Provider, payment.IntentID, payment.Amount.Amount,
+		payment.RefundedAmount.Amount, payment.Amount.currencyOrDefault(), payment.Status,
+		payment.FailureReason, payment.CreatedAt, payment.UpdatedAt)
+	return pgError("payment", err)
+}
+
+// GetPaymentByID retrieves a specific payment attempt
+func (s *PostgresStore) GetPaymentByID(ctx context.Context, paymentID string) (*Payment, error) {
+	p, err := scanPayment(s.q.QueryRow(ctx,
+		`SELECT `+paymentColumns+` FROM payments WHERE id = $1`, paymentID))
+	if err != nil {
+		return nil, pgError("payment", err)
+	}
+	return &p, nil
+}
+
+// GetPaymentByIntentID retrieves the payment attempt for a gateway intent
+func (s *PostgresStore) GetPaymentByIntentID(
+	ctx context.Context,
+	provider, intentID string,
+) (*Payment, error) {
+	p, err := scanPayment(s.q.QueryRow(ctx, `
+		SELECT `+paymentColumns+` FROM payments WHERE provider = $1 AND intent_id = $2`,
+		provider, intentID))
+	if err != nil {
+		return nil, pgError("payment", err)
+	}
+	return &p, nil
+}
+
+// GetOrderPayments lists an order's payment attempts, oldest first
+func (s *PostgresStore) GetOrderPayments(ctx context.Context, orderID string) ([]Payment, error) {
+	return collect(ctx, s.q, "payment", scanPayment, `
+		SELECT `+paymentColumns+` FROM payments
+		WHERE order_id = $1
+		ORDER BY created_at, id`,
+		orderID)
+}
+
+// SetPaymentStatus moves a payment attempt and its order's payment status
+// to status in one transaction
+func (s *PostgresStore) SetPaymentStatus(
+	ctx context.Context,
+	paymentID string,
+	status string,
+	failureReason string,
+) (*Payment, error) {
+	var payment Payment
+	err := s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		current, err := scanPayment(q.QueryRow(ctx,
+			`SELECT `+paymentColumns+` FROM payments WHERE id = $1 FOR UPDATE`, paymentID))
+		if err != nil {
+			return pgError("payment", err)
+		}
+		if !canTransitionPayment(current.Status, status) {
+			return paymentTransitionError(&current, status)
+		}
+
+		payment, err = scanPayment(q.QueryRow(ctx, `
+			UPDATE payments
+			SET status = $2, failure_reason = NULLIF($3, ''), updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+paymentColumns,
+			paymentID, status, failureReason))
+		if err != nil {
+			return pgError("payment", err)
+		}
+		_, err = q.Exec(ctx,
+			`UPDATE orders SET payment_status = $2, updated_at = NOW() WHERE id = $1`,
+			payment.OrderID, status)
+		return pgError("order", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// RecordPaymentRefund records the total refunded of a payment attempt and
+// moves its order's payment status with it in one transaction
+func (s *PostgresStore) RecordPaymentRefund(
+	ctx context.Context,
+	paymentID string,
+	refunded Money,
+) (*Payment, error) {
+	var payment Payment
+	err := s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		var err error
+		payment, err = scanPayment(q.QueryRow(ctx,
+			`SELECT `+paymentColumns+` FROM payments WHERE id = $1 FOR UPDATE`, paymentID))
+		if err != nil {
+			return pgError("payment", err)
+		}
+		if err := refundPayment(&payment, refunded); err != nil {
+			return err
+		}
+
+		_, err = q.Exec(ctx, `
+			UPDATE payments
+			SET refunded_amount = $2::numeric / 100, status = $3, updated_at = $4
+			WHERE id = $1`,
+			paymentID, payment.RefundedAmount.Amount, payment.Status, payment.UpdatedAt)
+		if err != nil {
+			return pgError("payment", err)
+		}
+		_, err = q.Exec(ctx,
+			`UPDATE orders SET payment_status = $2, updated_at = $3 WHERE id = $1`,
+			payment.OrderID, payment.Status, payment.UpdatedAt)
+		return pgError("order", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// Return operations
+
+const returnColumns = `id::text, order_id::text, client_id::text, status, reason,
+	COALESCE(reviewer_id, ''), COALESCE(review_note, ''), (refund_amount * 100)::bigint,
+	currency, COALESCE(payment_id::text, ''), created_at, updated_at`
+
+func scanReturn(row pgx.Row) (Return, error) {
+	var r Return
+	err := row.Scan(&r.ID, &r.OrderID, &r.ClientID, &r.Status, &r.Reason, &r.ReviewerID,
+		&r.ReviewNote, &r.RefundAmount.Amount, &r.RefundAmount.Currency, &r.PaymentID,
+		&r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+const returnItemColumns = `id::text, return_id::text, order_item_id::text,
+	product_id::text, quantity, COALESCE(disposition, ''), (refund_amount * 100)::bigint, currency`
+
+func scanReturnItem(row pgx.Row) (ReturnItem, error) {
+	var it ReturnItem
+	err := row.Scan(&it.ID, &it.ReturnID, &it.OrderItemID, &it.ProductID, &it.Quantity,
+		&it.Disposition, &it.RefundAmount.Amount, &it.RefundAmount.Currency)
+	return it, err
+}
+
+// collectReturns runs a query for returns and loads each one's items in the
+// order they were listed
+func collectReturns(ctx context.Context, q pgQuerier, sql string, args ...any) ([]Return, error) {
+	returns, err := collect(ctx, q, "return", scanReturn, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range returns {
+		returns[i].Items, err = collect(ctx, q, "return item", scanReturnItem, `
+			SELECT `+returnItemColumns+` FROM return_items
+			WHERE return_id = $1
+			ORDER BY position`,
+			returns[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return returns, nil
+}
+
+// getReturn loads one return with its items, locking it when forUpdate is set
+func getReturn(ctx context.Context, q pgQuerier, returnID string, forUpdate bool) (*Return, error) {
+	sql := `SELECT ` + returnColumns + ` FROM returns WHERE id = $1`
+	if forUpdate {
+		sql += ` FOR UPDATE`
+	}
+	returns, err := collectReturns(ctx, q, sql, returnID)
+	if err != nil {
+		return nil, err
+	}
+	if len(returns) == 0 {
+		return nil, notFound("return")
+	}
+	return &returns[0], nil
+}
+
+// updateReturn writes the review and refund fields of ret
+func updateReturn(ctx context.Context, q pgQuerier, ret *Return) error {
+	_, err := q.Exec(ctx, `
+		UPDATE returns
+		SET status = $2, reviewer_id = NULLIF($3, ''), review_note = NULLIF($4, ''),
+			payment_id = NULLIF($5, '')::uuid, updated_at = $6
+		WHERE id = $1`,
+		ret.ID, ret.Status, ret.ReviewerID, ret.ReviewNote, ret.PaymentID, ret.UpdatedAt)
+	return pgError("return", err)
+}
+
+// CreateReturn records a return request for items of a delivered order. The
+// order is locked so concurrent requests cannot return the same units twice.
+func (s *PostgresStore) CreateReturn(ctx context.Context, ret *Return) error {
+	if err := validateReturn(ret); err != nil {
+		return err
+	}
+
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		order, err := scanOrder(q.QueryRow(ctx,
+			`SELECT `+orderColumns+` FROM orders WHERE id = $1 FOR UPDATE`, ret.OrderID))
+		if err != nil {
+			return pgError("order", err)
+		}
+		items, err := collect(ctx, q, "order item", scanOrderItem,
+			`SELECT `+orderItemColumns+` FROM order_items WHERE order_id = $1`, ret.OrderID)
+		if err != nil {
+			return err
+		}
+		previous, err := collectReturns(ctx, q,
+			`SELECT `+returnColumns+` FROM returns WHERE order_id = $1`, ret.OrderID)
+		if err != nil {
+			return err
+		}
+		if err := priceReturn(ret, &order, items, returnedQuantities(previous)); err != nil {
+			return err
+		}
+
+		_, err = q.Exec(ctx, `
+			INSERT INTO returns (id, order_id, client_id, status, reason, refund_amount, currency,
+				created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6::numeric / 100, $7, $8, $9)`,
+			ret.ID, ret.OrderID, ret.ClientID, ret.Status, ret.Reason, ret.RefundAmount.Amount,
+			ret.RefundAmount.currencyOrDefault(), ret.CreatedAt, ret.UpdatedAt)
+		if err != nil {
+			return pgError("return", err)
+		}
+		for i, it := range ret.Items {
+			_, err = q.Exec(ctx, `
+				INSERT INTO return_items (id, return_id, order_item_id, product_id, quantity,
+					refund_amount, currency, position)
+				VALUES ($1, $2, $3, $4, $5, $6::numeric / 100, $7, $8)`,
+				it.ID, ret.ID, it.OrderItemID, it.ProductID, it.Quantity, it.RefundAmount.Amount,
+				it.RefundAmount.currencyOrDefault(), i)
+			if err != nil {
+				return pgError("return item", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetReturnByID retrieves a specific return with its items
+func (s *PostgresStore) GetReturnByID(ctx context.Context, returnID string) (*Return, error) {
+	return getReturn(ctx, s.q, returnID, false)
+}
+
+// GetOrderReturns lists an order's returns with their items, oldest first
+func (s *PostgresStore) GetOrderReturns(ctx context.Context, orderID string) ([]Return, error) {
+	if _, err := s.GetOrderByID(ctx, orderID); err != nil {
+		return nil, err
+	}
+	return collectReturns(ctx, s.q, `
+		SELECT `+returnColumns+` FROM returns
+		WHERE order_id = $1
+		ORDER BY created_at, id`,
+		orderID)
+}
+
+// ReviewReturn approves or rejects a requested return in one transaction,
+// restocking approved items marked restock whose product is not in the trash
+func (s *PostgresStore) ReviewReturn(ctx context.Context, review *ReturnReview) (*Return, error) {
+	if err := validateReturnReview(review); err != nil {
+		return nil, err
+	}
+
+	var ret *Return
+	err := s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		var err error
+		ret, err = getReturn(ctx, q, review.ReturnID, true)
+		if err != nil {
+			return err
+		}
+		if err := reviewReturn(ret, review); err != nil {
+			return err
+		}
+		if err := updateReturn(ctx, q, ret); err != nil {
+			return err
+		}
+
+		for _, it := range ret.Items {
+			_, err := q.Exec(ctx,
+				`UPDATE return_items SET disposition = NULLIF($2, '') WHERE id = $1`,
+				it.ID, it.Disposition)
+			if err != nil {
+				return pgError("return item", err)
+			}
+			if it.Disposition != ReturnRestock {
+				continue
+			}
+			var live bool
+			err = q.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM products WHERE id = $1 AND deleted_at IS NULL)`,
+				it.ProductID).Scan(&live)
+			if err != nil {
+				return pgError("product", err)
+			}
+			if !live {
+				continue
+			}
+			restock := returnRestock(ret, it)
+			if err := applyStock(ctx, q, restock); err != nil {
+				return err
+			}
+			if err := insertStockMovement(ctx, q, restock); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// MarkReturnRefunded records the payment an approved return was refunded from
+func (s *PostgresStore) MarkReturnRefunded(
+	ctx context.Context,
+	returnID, paymentID string,
+) (*Return, error) {
+	var ret *Return
+	err := s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		var err error
+		ret, err = getReturn(ctx, q, returnID, true)
+		if err != nil {
+			return err
+		}
+		if err := refundReturn(ret, paymentID); err != nil {
+			return err
+		}
+		return updateReturn(ctx, q, ret)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Invoice operations
+
+const invoiceColumns = `id::text, kind, number, sequence, order_id::text, veterinarian_id::text,
+	client_id::text, COALESCE(invoice_id::text, ''), COALESCE(invoice_number, ''),
+	COALESCE(return_id::text, ''), seller, buyer, lines, (subtotal * 100)::bigint,
+	(tax * 100)::bigint, tax_lines, (total * 100)::bigint, currency, payment_status, issued_at`
+
+func scanInvoice(row pgx.Row) (Invoice, error) {
+	var inv Invoice
+	err := row.Scan(&inv.ID, &inv.Kind, &inv.Number, &inv.Sequence, &inv.OrderID,
+		&inv.VeterinarianID, &inv.ClientID, &inv.InvoiceID, &inv.InvoiceNumber, &inv.ReturnID, &inv.Seller, &inv.Buyer,
+		&inv.Lines, &inv.Subtotal.Amount, &inv.Tax.Amount, &inv.TaxLines, &inv.Total.Amount,
+		&inv.Total.Currency,
+		&inv.PaymentStatus, &inv.IssuedAt)
+	inv.Subtotal.Currency = inv.Total.Currency
+	inv.Tax.Currency = inv.Total.Currency
+	return inv, err
+}
+
+// IssueInvoice numbers an invoice or credit note and stores it in one
+// transaction. The sequence row stays locked until the transaction ends, so
+// concurrent invoices of one veterinarian get consecutive numbers.
+func (s *PostgresStore) IssueInvoice(ctx context.Context, inv *Invoice) error {
+	if err := validateInvoice(inv); err != nil {
+		return err
+	}
+
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		if inv.Kind == InvoiceKindCreditNote {
+			var credited bool
+			err := q.QueryRow(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM invoices WHERE id = $1 AND kind = $2 AND order_id = $3
+				)`,
+				inv.InvoiceID, InvoiceKindInvoice, inv.OrderID).Scan(&credited)
+			if err != nil {
+				return pgError("invoice", err)
+			}
+			if !credited {
+				return notFound("invoice")
+			}
+		}
+
+		var sequence int
+		err := q.QueryRow(ctx, `
+			INSERT INTO invoice_sequences (veterinarian_id, kind, last_sequence)
+			VALUES ($1, $2, 1)
+			ON CONFLICT (veterinarian_id, kind)
+			DO UPDATE SET last_sequence = invoice_sequences.last_sequence + 1
+			RETURNING last_sequence`,
+			inv.VeterinarianID, inv.Kind).Scan(&sequence)
+		if err != nil {
+			return pgError("invoice sequence", err)
+		}
+
+		number := invoiceNumber(inv.Kind, sequence)
+		_, err = q.Exec(ctx, `
+			INSERT INTO invoices (id, kind, number, sequence, order_id, veterinarian_id, client_id,
+				invoice_id, invoice_number, return_id, seller, buyer, lines, subtotal, tax, tax_lines,
+				total, currency, payment_status, issued_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, NULLIF($9, ''),
+				NULLIF($10, '')::uuid, $11, $12, $13, $14::numeric / 100, $15::numeric / 100, $16,
+				$17::numeric / 100, $18, $19, $20)`,
+			inv.ID, inv.Kind, number, sequence, inv.OrderID, inv.VeterinarianID, inv.ClientID,
+			inv.InvoiceID, inv.InvoiceNumber, inv.ReturnID, inv.Seller, inv.Buyer, inv.Lines, inv.Subtotal.Amount,
+			inv.Tax.Amount, taxLinesJSON(inv.TaxLines), inv.Total.Amount, inv.Total.currencyOrDefault(), inv.PaymentStatus,
+			inv.IssuedAt)
+		if err != nil {
+			return pgError("invoice", err)
+		}
+		inv.Sequence, inv.Number = sequence, number
+		return nil
+	})
+}
+
+// GetInvoiceByID retrieves a specific invoice or credit note
+func (s *PostgresStore) GetInvoiceByID(ctx context.Context, invoiceID string) (*Invoice, error) {
+	inv, err := scanInvoice(s.q.QueryRow(ctx,
+		`SELECT `+invoiceColumns+` FROM invoices WHERE id = $1`, invoiceID))
+	if err != nil {
+		return nil, pgError("invoice", err)
+	}
+	return &inv, nil
+}
+
+// GetOrderInvoice retrieves the invoice issued for an order
+func (s *PostgresStore) GetOrderInvoice(ctx context.Context, orderID string) (*Invoice, error) {
+	inv, err := scanInvoice(s.q.QueryRow(ctx,
+		`SELECT `+invoiceColumns+` FROM invoices WHERE order_id = $1 AND kind = $2`,
+		orderID, InvoiceKindInvoice))
+	if err != nil {
+		return nil, pgError("invoice", err)
+	}
+	return &inv, nil
+}
+
+// GetOrderCreditNotes lists the credit notes issued for an order, oldest first
+func (s *PostgresStore) GetOrderCreditNotes(ctx context.Context, orderID string) ([]Invoice, error) {
+	return collect(ctx, s.q, "invoice", scanInvoice, `
+		SELECT `+invoiceColumns+` FROM invoices
+		WHERE order_id = $1 AND kind = $2
+		ORDER BY sequence`,
+		orderID, InvoiceKindCreditNote)
+}
+
+// Tax operations
+
+// getTaxSettings loads a veterinarian's tax settings, which have no rates
+// until they are set
+func getTaxSettings(ctx context.Context, q pgQuerier, vetID string) (*TaxSettings, error) {
+	settings := TaxSettings{VeterinarianID: vetID, Rates: []TaxRate{}}
+	err := q.QueryRow(ctx, `
+		SELECT inclusive, rates, updated_at FROM tax_settings WHERE veterinarian_id = $1`,
+		vetID).Scan(&settings.Inclusive, &settings.Rates, &settings.UpdatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, pgError("tax settings", err)
+	}
+	return &settings, nil
+}
+
+// GetTaxSettings retrieves a veterinarian's tax settings
+func (s *PostgresStore) GetTaxSettings(ctx context.Context, vetID string) (*TaxSettings, error) {
+	if _, err := s.GetVeterinarianByID(ctx, vetID); err != nil {
+		return nil, err
+	}
+	return getTaxSettings(ctx, s.q, vetID)
+}
+
+// SetTaxSettings replaces a veterinarian's tax settings
+func (s *PostgresStore) SetTaxSettings(ctx context.Context, settings *TaxSettings) error {
+	if err := validateTaxSettings(settings); err != nil {
+		return err
+	}
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO tax_settings (veterinarian_id, inclusive, rates, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (veterinarian_id)
+		DO UPDATE SET inclusive = $2, rates = $3, updated_at = $4`,
+		settings.VeterinarianID, settings.Inclusive, taxRatesJSON(settings.Rates), settings.UpdatedAt)
+	return pgError("veterinarian", err)
+}
+
+// Promotion operations
+
+const promotionColumns = `id::text, COALESCE(veterinarian_id::text, ''), COALESCE(code, ''),
+	name, kind, percent_bps, (amount * 100)::bigint, (min_spend * 100)::bigint,
+	COALESCE(currency, ''), product_ids, categories, usage_limit, usage_count,
+	first_order_only, starts_at, ends_at, active, created_at, updated_at`
+
+func scanPromotion(row pgx.Row) (Promotion, error) {
+	var p Promotion
+	var currency string
+	err := row.Scan(&p.ID, &p.VeterinarianID, &p.Code, &p.Name, &p.Kind, &p.PercentBps,
+		&p.Amount.Amount, &p.MinSpend.Amount, &currency, &p.ProductIDs, &p.Categories,
+		&p.UsageLimit, &p.UsageCount, &p.FirstOrderOnly, &p.StartsAt, &p.EndsAt, &p.Active,
+		&p.CreatedAt, &p.UpdatedAt)
+	p.Amount.Currency, p.MinSpend.Currency = currency, currency
+	return p, err
+}
+
+// promotionArgs are the arguments $2 to $15 of the statements that write a
+// promotion, after its ID
+func promotionArgs(p *Promotion) []any {
+	return []any{
+		p.VeterinarianID, p.Code, p.Name, p.Kind, p.PercentBps, p.Amount.Amount,
+		p.MinSpend.Amount, p.currency(), stringsJSON(p.ProductIDs), stringsJSON(p.Categories),
+		p.UsageLimit, p.FirstOrderOnly, p.StartsAt, p.EndsAt, p.Active,
+	}
+}
+
+// stringsJSON never stores NULL for an empty list
+func stringsJSON(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// CreatePromotion creates a new promotion
+func (s *PostgresStore) CreatePromotion(ctx context.Context, promotion *Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	args := append([]any{promotion.ID}, promotionArgs(promotion)...)
+	args = append(args, promotion.UsageCount, promotion.CreatedAt, promotion.UpdatedAt)
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO promotions (id, veterinarian_id, code, name, kind, percent_bps, amount,
+			min_spend, currency, product_ids, categories, usage_limit, first_order_only,
+			starts_at, ends_at, active, usage_count, created_at, updated_at)
+		VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, ''), $4, $5, $6, $7::numeric / 100,
+			$8::numeric / 100, NULLIF($9, ''), $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
+		args...)
+	return pgError("promotion", err)
+}
+
+// GetPromotionByID retrieves a specific promotion
+func (s *PostgresStore) GetPromotionByID(ctx context.Context, promotionID string) (*Promotion, error) {
+	p, err := scanPromotion(s.q.QueryRow(ctx,
+		`SELECT `+promotionColumns+` FROM promotions WHERE id = $1`, promotionID))
+	if err != nil {
+		return nil, pgError("promotion", err)
+	}
+	return &p, nil
+}
+
+// GetPromotionByCode retrieves the promotion with a discount code
+func (s *PostgresStore) GetPromotionByCode(ctx context.Context, code string) (*Promotion, error) {
+	p, err := scanPromotion(s.q.QueryRow(ctx,
+		`SELECT `+promotionColumns+` FROM promotions WHERE code = $1`,
+		NormalizePromotionCode(code)))
+	if err != nil {
+		return nil, pgError("promotion", err)
+	}
+	return &p, nil
+}
+
+// ListPromotions lists a veterinarian's promotions, or every promotion
+func (s *PostgresStore) ListPromotions(
+	ctx context.Context,
+	vetID string,
+	page Page,
+) ([]Promotion, string, error) {
+	return collectPage(ctx, s.q, "promotion", scanPromotion, promotionKey, "", page, `
+		SELECT `+promotionColumns+` FROM promotions
+		WHERE ($1 = '' OR veterinarian_id::text = $1)`,
+		vetID)
+}
+
+// UpdatePromotion updates a promotion, keeping its usage count
+func (s *PostgresStore) UpdatePromotion(ctx context.Context, promotion *Promotion) error {
+	if err := validatePromotion(promotion); err != nil {
+		return err
+	}
+	promotion.UpdatedAt = time.Now()
+	args := append([]any{promotion.ID}, promotionArgs(promotion)...)
+	err := s.q.QueryRow(ctx, `
+		UPDATE promotions
+		SET veterinarian_id = NULLIF($2, '')::uuid, code = NULLIF($3, ''), name = $4, kind = $5,
+			percent_bps = $6, amount = $7::numeric / 100, min_spend = $8::numeric / 100,
+			currency = NULLIF($9, ''), product_ids = $10, categories = $11, usage_limit = $12,
+			first_order_only = $13, starts_at = $14, ends_at = $15, active = $16,
+			updated_at = $17
+		WHERE id = $1
+		RETURNING usage_count, created_at`,
+		append(args, promotion.UpdatedAt)...).Scan(&promotion.UsageCount, &promotion.CreatedAt)
+	return pgError("promotion", err)
+}
+
+// DeletePromotion removes a promotion. Orders keep the discounts it gave.
+func (s *PostgresStore) DeletePromotion(ctx context.Context, promotionID string) error {
+	return s.execOne(ctx, "promotion", `DELETE FROM promotions WHERE id = $1`, promotionID)
+}
+
+// claimPromotions applies the promotions that may apply to an order being
+// placed in q's transaction. Each use is claimed with a conditional UPDATE,
+// which keeps the promotion's row locked until the transaction ends, so
+// concurrent orders cannot take a promotion past its cap.
+func claimPromotions(
+	ctx context.Context,
+	q pgQuerier,
+	order *Order,
+	items []OrderItem,
+	categories map[string]string,
+) ([]int64, error) {
+	promotions, err := collect(ctx, q, "promotion", scanPromotion, `
+		SELECT `+promotionColumns+` FROM promotions
+		WHERE active AND (veterinarian_id = $1 OR veterinarian_id IS NULL)
+			AND (starts_at IS NULL OR starts_at <= $2) AND (ends_at IS NULL OR ends_at > $2)
+			AND (code IS NULL OR code = $3)`,
+		order.VeterinarianID, time.Now(), NormalizePromotionCode(order.DiscountCode))
+	if err != nil {
+		return nil, err
+	}
+	sortPromotions(promotions)
+
+	var history orderHistory
+	err = q.QueryRow(ctx, `
+		SELECT COUNT(*) > 0, COUNT(*) FILTER (WHERE veterinarian_id = $2) > 0
+		FROM orders
+		WHERE client_id = $1 AND COALESCE(status, 'pending') <> $3
+			AND ($4 = '' OR checkout_group_id IS NULL OR checkout_group_id::text <> $4)`,
+		order.ClientID, order.VeterinarianID, OrderCancelled, order.CheckoutGroupID).
+		Scan(&history.ordered, &history.orderedFromVet)
+	if err != nil {
+		return nil, pgError("order", err)
+	}
+
+	return applyPromotions(order, items, categories, promotions, history,
+		func(p *Promotion) (bool, error) {
+			tag, err := q.Exec(ctx, `
+				UPDATE promotions SET usage_count = usage_count + 1, updated_at = NOW()
+				WHERE id = $1 AND (usage_limit = 0 OR usage_count < usage_limit)`,
+				p.ID)
+			if err != nil {
+				return false, pgError("promotion", err)
+			}
+			return tag.RowsAffected() == 1, nil
+		})
+}
+
+// Trash operations
+
+func scanID(row pgx.Row) (string, error) {
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+// trashRows moves the live rows of table whose column matches one of ids to
+// the trash, then the rows that cascade from them. NOW() is fixed for the
+// transaction, so everything trashed by one call shares a timestamp.
+// It returns how many rows of table it trashed.
+func trashRows(ctx context.Context, q pgQuerier, table, column string, ids []string) (int, error) {
+	set := "deleted_at = NOW()"
+	if table == "products" {
+		set += ", is_active = false"
+	}
+	trashed, err := collect(ctx, q, table, scanID, `
+		UPDATE `+table+` SET `+set+`
+		WHERE `+column+` = ANY($1::text[]::uuid[]) AND deleted_at IS NULL
+		RETURNING id::text`, ids)
+	if err != nil || len(trashed) == 0 {
+		return 0, err
+	}
+	for _, c := range trashCascades {
+		if c.parent == table {
+			if _, err := trashRows(ctx, q, c.table, c.column, trashed); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(trashed), nil
+}
+
+// restoreRows restores the rows that cascaded from the restored ids of table,
+// which are the ones trashed at the same moment
+func restoreRows(
+	ctx context.Context,
+	q pgQuerier,
+	table string,
+	ids []string,
+	deletedAt time.Time,
+) error {
+	for _, c := range trashCascades {
+		if c.parent != table {
+			continue
+		}
+		restored, err := collect(ctx, q, c.table, scanID, `
+			UPDATE `+c.table+` SET deleted_at = NULL
+			WHERE `+c.column+` = ANY($1::text[]::uuid[]) AND deleted_at = $2
+			RETURNING id::text`, ids, deletedAt)
+		if err != nil {
+			return err
+		}
+		if len(restored) > 0 {
+			if err := restoreRows(ctx, q, c.table, restored, deletedAt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListTrash retrieves a page of deleted rows, most recently deleted first
+func (s *PostgresStore) ListTrash(
+	ctx context.Context,
+	entity string,
+	page Page,
+) ([]TrashItem, string, error) {
+	tables, err := trashTablesFor(entity)
+	if err != nil {
+		return nil, "", err
+	}
+	selects := make([]string, len(tables))
+	for i, t := range tables {
+		selects[i] = fmt.Sprintf(`SELECT '%s' AS entity, id::text AS id, COALESCE(%s, '') AS name, deleted_at
+			FROM %s WHERE deleted_at IS NOT NULL`, t.entity, t.name, t.table)
+	}
+	return collectPage(ctx, s.q, "trash", func(row pgx.Row) (TrashItem, error) {
+		var item TrashItem
+		err := row.Scan(&item.Entity, &item.ID, &item.Name, &item.DeletedAt)
+		return item, err
+	}, trashKey, sortByDeletion, page, `
+		SELECT entity, id, name, deleted_at FROM (`+strings.Join(selects, " UNION ALL ")+`) trash
+		WHERE TRUE`)
+}
+
+// RestoreDeleted brings a row back with the rows that were trashed along with it
+func (s *PostgresStore) RestoreDeleted(ctx context.Context, entity, id string) error {
+	tables, err := trashTablesFor(entity)
+	if err != nil || entity == "" {
+		return notFound(entity)
+	}
+	return s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		for _, t := range tables {
+			// The self join reads deleted_at as it was before the update
+			var deletedAt time.Time
+			err := q.QueryRow(ctx, `
+				UPDATE `+t.table+` SET deleted_at = NULL
+				FROM `+t.table+` old
+				WHERE `+t.table+`.id = $1 AND old.id = $1 AND old.deleted_at IS NOT NULL
+				RETURNING old.deleted_at`, id).Scan(&deletedAt)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return pgError(entity, err)
+			}
+			return restoreRows(ctx, q, t.table, []string{id}, deletedAt)
+		}
+		return notFound(entity)
+	})
+}
+
+// PurgeDeleted permanently removes rows deleted before the cutoff. Foreign
+// keys cascade to everything that references them.
+func (s *PostgresStore) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	err := s.WithTx(ctx, func(tx Database) error {
+		q := tx.(*PostgresStore).q
+		// Children go first so that they are counted before a parent's
+		// cascade removes them
+		for i := len(trashTables) - 1; i >= 0; i-- {
+			tag, err := q.Exec(ctx,
+				`DELETE FROM `+trashTables[i].table+` WHERE deleted_at < $1`, before)
+			if err != nil {
+				return pgError(trashTables[i].table, err)
+			}
+			purged += int(tag.RowsAffected())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// Audit log operations
+
+const auditColumns = `id::text, actor_id, actor_role, action, entity, entity_id, changes, ip,
+	request_id, created_at`
+
+func scanAuditEntry(row pgx.Row) (AuditEntry, error) {
+	var e AuditEntry
+	err := row.Scan(&e.ID, &e.ActorID, &e.ActorRole, &e.Action, &e.Entity, &e.EntityID,
+		&e.Changes, &e.IP, &e.RequestID, &e.CreatedAt)
+	return e, err
+}
+
+// AppendAuditEntry adds an entry to the audit log
+func (s *PostgresStore) AppendAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	_, err := s.q.Exec(ctx, `
+		INSERT INTO audit_log (id, actor_id, actor_role, action, entity, entity_id, changes, ip,
+			request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		entry.ID, entry.ActorID, entry.ActorRole, entry.Action, entry.Entity, entry.EntityID,
+		entry.Changes, entry.IP, entry.RequestID, entry.CreatedAt)
+	return pgError("audit entry", err)
+}
+
+// ListAuditEntries retrieves a page of audit entries matching filter, newest first
+func (s *PostgresStore) ListAuditEntries(
+	ctx context.Context,
+	filter AuditFilter,
+	page Page,
+) ([]AuditEntry, string, error) {
+	where := []string{"TRUE"}
+	var args []any
+	add := func(cond string, value any) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.ActorID != "" {
+		add("actor_id = $%d", filter.ActorID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.Entity != "" {
+		add("entity = $%d", filter.Entity)
+	}
+	if filter.EntityID != "" {
+		add("entity_id = $%d", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+
+	return collectPage(ctx, s.q, "audit entry", scanAuditEntry, auditKey, sortByNewest, page,
+		`SELECT `+auditColumns+` FROM audit_log WHERE `+strings.Join(where, " AND "), args...)
+}
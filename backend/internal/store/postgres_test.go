@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// newTestPostgresStore connects to TEST_DATABASE_URL or skips the test. The
+// database must already be migrated with `go run ./cmd/migrate up`.
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := NewPostgresStore(context.Background(), url)
+	if err != nil {
+		t.Fatalf("NewPostgresStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// TestPostgresStoreWithTxRollback tests that a failed transaction leaves no rows behind
+func TestPostgresStoreWithTxRollback(t *testing.T) {
+	ctx := context.Background()
+	db := newTestPostgresStore(t)
+
+	vetID := uuid.NewString()
+	errAbort := errors.New("abort")
+	err := db.WithTx(ctx, func(tx Database) error {
+		if err := tx.CreateVeterinarian(ctx, &Veterinarian{
+			ID:    vetID,
+			Name:  "Dr. Rollback",
+			Email: vetID + "@example.com",
+		}); err != nil {
+			return err
+		}
+		if _, err := tx.GetVeterinarianByID(ctx, vetID); err != nil {
+			t.Errorf("Expected vet to be visible inside the transaction: %v", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Expected errAbort, got %v", err)
+	}
+
+	if _, err := db.GetVeterinarianByID(ctx, vetID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after rollback, got %v", err)
+	}
+}
+
+// TestPostgresStoreContextCancellation tests that a cancelled context aborts queries
+func TestPostgresStoreContextCancellation(t *testing.T) {
+	db := newTestPostgresStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.GetClientByID(ctx, uuid.NewString()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Package store/promotion.go contains the promotions and discount codes shared by all backends
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Promotion kinds: a percentage off the items a promotion covers, or a fixed
+// amount off them
+const (
+	PromotionPercent = "percent"
+	PromotionFixed   = "fixed"
+)
+
+// promotionCodePattern is what discount codes look like once normalized
+var promotionCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,31}$`)
+
+// Promotion is a discount a veterinarian runs on their products, or an admin
+// runs shop-wide when VeterinarianID is empty. Promotions with a Code only
+// apply to orders that give it; the others apply to every order they cover.
+//
+// A promotion covers the products in ProductIDs and in Categories, or every
+// product when both are empty. It applies while Active and between StartsAt
+// and EndsAt, to orders that spend at least MinSpend on what it covers and,
+// with FirstOrderOnly, to a client's first order (from the veterinarian, for
+// a veterinarian's promotion). UsageLimit caps how many orders it applies to,
+// zero meaning no cap; UsageCount is how many it has applied to so far.
+type Promotion struct {
+	ID             string     `json:"id"`
+	VeterinarianID string     `json:"veterinarian_id,omitempty"`
+	Code           string     `json:"code,omitempty"`
+	Name           string     `json:"name"`
+	Kind           string     `json:"kind"`
+	PercentBps     int        `json:"percent_bps,omitempty"`
+	Amount         Money      `json:"amount"`
+	ProductIDs     []string   `json:"product_ids"`
+	Categories     []string   `json:"categories"`
+	MinSpend       Money      `json:"min_spend"`
+	UsageLimit     int        `json:"usage_limit"`
+	UsageCount     int        `json:"usage_count"`
+	FirstOrderOnly bool       `json:"first_order_only"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	Active         bool       `json:"active"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// OrderDiscount is one promotion applied to an order and what it took off
+type OrderDiscount struct {
+	PromotionID string `json:"promotion_id"`
+	Code        string `json:"code,omitempty"`
+	Name        string `json:"name"`
+	Amount      Money  `json:"amount"`
+}
+
+// NewPromotion creates a new active Promotion of kind with generated ID and
+// timestamps, covering every product of vetID until narrowed
+func NewPromotion(vetID, name, kind string) *Promotion {
+	now := time.Now()
+	return &Promotion{
+		ID:             uuid.New().String(),
+		VeterinarianID: vetID,
+		Name:           name,
+		Kind:           kind,
+		ProductIDs:     []string{},
+		Categories:     []string{},
+		Active:         true,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// NormalizePromotionCode is code as it is stored and matched: trimmed and in
+// upper case, so codes are case-insensitive
+func NormalizePromotionCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validatePromotion rejects promotions without a name, of an unknown kind or
+// with a discount, spend, cap or window that makes no sense
+func validatePromotion(p *Promotion) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPromotion)
+	}
+	if p.Code != "" && !promotionCodePattern.MatchString(p.Code) {
+		return fmt.Errorf("%w: codes are 3 to 32 upper-case letters, digits, - and _",
+			ErrInvalidPromotion)
+	}
+	switch p.Kind {
+	case PromotionPercent:
+		if p.PercentBps <= 0 || p.PercentBps > 10000 {
+			return fmt.Errorf("%w: percent_bps must be between 1 and 10000", ErrInvalidPromotion)
+		}
+	case PromotionFixed:
+		if p.Amount.Amount <= 0 {
+			return fmt.Errorf("%w: amount must be greater than 0", ErrInvalidPromotion)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidPromotion, p.Kind)
+	}
+	if p.MinSpend.Amount < 0 {
+		return fmt.Errorf("%w: min_spend cannot be negative", ErrInvalidPromotion)
+	}
+	if _, err := p.Amount.Add(p.MinSpend); err != nil {
+		return fmt.Errorf("%w: amount and min_spend must share a currency", ErrInvalidPromotion)
+	}
+	if p.UsageLimit < 0 {
+		return fmt.Errorf("%w: usage_limit cannot be negative", ErrInvalidPromotion)
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromotion)
+	}
+	return nil
+}
+
+// currency is the currency of the promotion's amount and minimum spend, or
+// empty for a percentage off without a minimum, which applies in any
+func (p *Promotion) currency() string {
+	if p.Kind == PromotionFixed || p.MinSpend.Amount > 0 {
+		sum, _ := p.Amount.Add(p.MinSpend)
+		return sum.currencyOrDefault()
+	}
+	return ""
+}
+
+// Live reports whether p can apply to orders placed at now
+func (p *Promotion) Live(now time.Time) bool {
+	return p.Active && (p.StartsAt == nil || !now.Before(*p.StartsAt)) &&
+		(p.EndsAt == nil || now.Before(*p.EndsAt))
+}
+
+// covers reports whether p discounts a product in category
+func (p *Promotion) covers(productID, category string) bool {
+	if len(p.ProductIDs) == 0 && len(p.Categories) == 0 {
+		return true
+	}
+	return slices.Contains(p.ProductIDs, productID) ||
+		slices.ContainsFunc(p.Categories, func(c string) bool {
+			return strings.EqualFold(c, category)
+		})
+}
+
+// candidate reports whether p may apply to an order from vetID placed at now
+// with code, before its conditions on the order's items are checked
+func (p *Promotion) candidate(vetID, code string, now time.Time) bool {
+	return (p.VeterinarianID == "" || p.VeterinarianID == vetID) &&
+		(p.Code == "" || p.Code == NormalizePromotionCode(code)) && p.Live(now)
+}
+
+// sortPromotions puts promotions in the order they apply to an order:
+// automatic ones oldest first, then the discount code
+func sortPromotions(promotions []Promotion) {
+	sort.SliceStable(promotions, func(a, b int) bool {
+		pa, pb := promotions[a], promotions[b]
+		if (pa.Code == "") != (pb.Code == "") {
+			return pa.Code == ""
+		}
+		if !pa.CreatedAt.Equal(pb.CreatedAt) {
+			return pa.CreatedAt.Before(pb.CreatedAt)
+		}
+		return pa.ID < pb.ID
+	})
+}
+
+// orderHistory is what first-order promotions need to know about a client's
+// earlier orders: whether there are any that were not cancelled, leaving out
+// the rest of the order's own checkout, and whether any are from the order's
+// veterinarian
+type orderHistory struct {
+	ordered        bool
+	orderedFromVet bool
+}
+
+// discount works out what p takes off each of items, given what earlier
+// promotions took off them. It returns nil when p does not apply.
+func (p *Promotion) discount(
+	items []OrderItem,
+	categories map[string]string,
+	taken []int64,
+	currency string,
+	history orderHistory,
+) []int64 {
+	if p.FirstOrderOnly {
+		if (p.VeterinarianID == "" && history.ordered) ||
+			(p.VeterinarianID != "" && history.orderedFromVet) {
+			return nil
+		}
+	}
+	if c := p.currency(); c != "" && c != currency {
+		return nil
+	}
+
+	// Fixed amounts are taken from the covered items in product order
+	var covered []int
+	var spend int64
+	for i, it := range items {
+		if p.covers(it.ProductID, categories[it.ProductID]) {
+			covered = append(covered, i)
+			spend += it.TotalPrice.Amount
+		}
+	}
+	if spend == 0 || spend < p.MinSpend.Amount {
+		return nil
+	}
+	sort.SliceStable(covered, func(a, b int) bool {
+		return items[covered[a]].ProductID < items[covered[b]].ProductID
+	})
+
+	lines := make([]int64, len(items))
+	left := p.Amount.Amount
+	for _, i := range covered {
+		remaining := items[i].TotalPrice.Amount - taken[i]
+		if p.Kind == PromotionPercent {
+			lines[i] = (remaining*int64(p.PercentBps) + 5000) / 10000
+		} else {
+			lines[i] = min(left, remaining)
+			left -= lines[i]
+		}
+	}
+	return lines
+}
+
+// applyPromotions applies promotions, in the order sortPromotions puts them,
+// to the priced items of order and records the discounts on it. claim takes
+// one use of a promotion about to apply, reporting false when its usage cap
+// is reached: an automatic promotion is then skipped, while a used-up code
+// fails with ErrPromotionUnavailable. It returns what was taken off each item.
+func applyPromotions(
+	order *Order,
+	items []OrderItem,
+	categories map[string]string,
+	promotions []Promotion,
+	history orderHistory,
+	claim func(*Promotion) (bool, error),
+) ([]int64, error) {
+	var subtotal Money
+	for _, it := range items {
+		subtotal, _ = subtotal.Add(it.TotalPrice)
+	}
+	currency := subtotal.currencyOrDefault()
+
+	taken := make([]int64, len(items))
+	order.DiscountCode = NormalizePromotionCode(order.DiscountCode)
+	order.Discounts = []OrderDiscount{}
+	order.DiscountAmount = NewMoney(0, currency)
+	for i := range promotions {
+		p := &promotions[i]
+		lines := p.discount(items, categories, taken, currency, history)
+		var amount int64
+		for _, d := range lines {
+			amount += d
+		}
+		if amount == 0 {
+			continue
+		}
+		ok, err := claim(p)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if p.Code != "" {
+				return nil, fmt.Errorf("%w: code %s has been used up", ErrPromotionUnavailable, p.Code)
+			}
+			continue
+		}
+
+		for j, d := range lines {
+			taken[j] += d
+		}
+		order.Discounts = append(order.Discounts, OrderDiscount{
+			PromotionID: p.ID,
+			Code:        p.Code,
+			Name:        p.Name,
+			Amount:      NewMoney(amount, currency),
+		})
+		order.DiscountAmount.Amount += amount
+	}
+	return taken, nil
+}
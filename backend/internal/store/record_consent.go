@@ -0,0 +1,109 @@
+// Package store/record_consent.go contains the consents behind veterinarians' access to medical records
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of record consent
+const (
+	// ConsentOwnerGrant is access a pet's owner gave a veterinarian
+	ConsentOwnerGrant = "owner_grant"
+	// ConsentBreakGlass is emergency access a veterinarian took themselves,
+	// with a justification the owner can see
+	ConsentBreakGlass = "break_glass"
+)
+
+// BreakGlassDuration is how long break-glass access lasts
+const BreakGlassDuration = 24 * time.Hour
+
+// AppointmentConsentWindow is how long after an appointment its veterinarian
+// may still see the pet's records
+const AppointmentConsentWindow = 180 * 24 * time.Hour
+
+// tookPlace reports whether a counts as the owner's consent at now: it was
+// completed, or was not cancelled and has started
+func (a *Appointment) tookPlace(now time.Time) bool {
+	return a.Status == "completed" || a.Status != "cancelled" && !a.AppointmentDate.After(now)
+}
+
+// RecordConsent lets a veterinarian see a pet's medical records without an
+// appointment for the pet. It is active from CreatedAt until ExpiresAt, when
+// set, or until revoked. CreatedBy is who made it: the owner or an admin for
+// a grant, the veterinarian for break-glass access.
+type RecordConsent struct {
+	ID             string     `json:"id"`
+	PetID          string     `json:"pet_id"`
+	OwnerID        string     `json:"owner_id"`
+	VeterinarianID string     `json:"veterinarian_id"`
+	Kind           string     `json:"kind"`
+	Justification  string     `json:"justification,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// NewRecordConsent creates an owner's grant of access to the records of
+// petID for vetID, with generated ID and timestamp
+func NewRecordConsent(petID, ownerID, vetID string, expiresAt *time.Time, createdBy string) *RecordConsent {
+	return &RecordConsent{
+		ID:             uuid.New().String(),
+		PetID:          petID,
+		OwnerID:        ownerID,
+		VeterinarianID: vetID,
+		Kind:           ConsentOwnerGrant,
+		ExpiresAt:      expiresAt,
+		CreatedBy:      createdBy,
+		CreatedAt:      time.Now(),
+	}
+}
+
+// NewBreakGlassAccess creates break-glass access to the records of petID
+// for vetID, lasting BreakGlassDuration
+func NewBreakGlassAccess(petID, ownerID, vetID, justification string) *RecordConsent {
+	now := time.Now()
+	expires := now.Add(BreakGlassDuration)
+	return &RecordConsent{
+		ID:             uuid.New().String(),
+		PetID:          petID,
+		OwnerID:        ownerID,
+		VeterinarianID: vetID,
+		Kind:           ConsentBreakGlass,
+		Justification:  strings.TrimSpace(justification),
+		ExpiresAt:      &expires,
+		CreatedBy:      vetID,
+		CreatedAt:      now,
+	}
+}
+
+// Active reports whether c is neither revoked nor expired at now
+func (c *RecordConsent) Active(now time.Time) bool {
+	return c.RevokedAt == nil && (c.ExpiresAt == nil || now.Before(*c.ExpiresAt))
+}
+
+// validateRecordConsent rejects consents of an unknown kind, break-glass
+// access without a justification or expiry, and consents that expire
+// before they are made
+func validateRecordConsent(c *RecordConsent) error {
+	switch c.Kind {
+	case ConsentOwnerGrant:
+	case ConsentBreakGlass:
+		if c.Justification == "" {
+			return fmt.Errorf("%w: break-glass access needs a justification", ErrInvalidConsent)
+		}
+		if c.ExpiresAt == nil {
+			return fmt.Errorf("%w: break-glass access must expire", ErrInvalidConsent)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidConsent, c.Kind)
+	}
+	if c.ExpiresAt != nil && !c.ExpiresAt.After(c.CreatedAt) {
+		return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidConsent)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Package store/reservation.go contains the stock reservation types shared by all backends
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reservation statuses. Only an active reservation that has not yet expired
+// holds stock; the sweeper marks lapsed ones expired.
+const (
+	ReservationActive    = "active"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+	ReservationConverted = "converted"
+)
+
+// Reservation holds quantities of products for a client during checkout.
+// While it holds them, PlaceOrder and other reservations can only take the
+// stock that is left. Confirming it converts it into a Checkout.
+type Reservation struct {
+	ID         string            `json:"id"`
+	ClientID   string            `json:"client_id"`
+	Status     string            `json:"status"`
+	Items      []ReservationItem `json:"items"`
+	CheckoutID string            `json:"checkout_id,omitempty"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// ReservationItem is the quantity of one product a reservation holds
+type ReservationItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// NewReservation creates a new active Reservation that expires after ttl.
+// Items naming the same product are merged.
+func NewReservation(clientID string, items []ReservationItem, ttl time.Duration) *Reservation {
+	now := time.Now()
+	return &Reservation{
+		ID:        uuid.New().String(),
+		ClientID:  clientID,
+		Status:    ReservationActive,
+		Items:     mergeReservationItems(items),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// mergeReservationItems sums quantities per product, ordered by product ID
+// so that backends lock product rows in a stable order
+func mergeReservationItems(items []ReservationItem) []ReservationItem {
+	totals := make(map[string]int, len(items))
+	for _, it := range items {
+		totals[it.ProductID] += it.Quantity
+	}
+	merged := make([]ReservationItem, 0, len(totals))
+	for id, q := range totals {
+		merged = append(merged, ReservationItem{ProductID: id, Quantity: q})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ProductID < merged[j].ProductID })
+	return merged
+}
+
+// holds reports whether r still holds its stock at now
+func (r *Reservation) holds(now time.Time) bool {
+	return r.Status == ReservationActive && now.Before(r.ExpiresAt)
+}
+
+// orderItems are the order lines a confirmed reservation turns into
+func (r *Reservation) orderItems() []OrderItem {
+	items := make([]OrderItem, len(r.Items))
+	for i, it := range r.Items {
+		items[i] = *NewOrderItem("", it.ProductID, it.Quantity, Money{})
+	}
+	return items
+}
+
+// validateReservation rejects reservations without a client or items
+func validateReservation(r *Reservation) error {
+	if r.ClientID == "" {
+		return fmt.Errorf("%w: client is required", ErrInvalidOrder)
+	}
+	if len(r.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidOrder)
+	}
+	for _, it := range r.Items {
+		if it.ProductID == "" || it.Quantity <= 0 {
+			return fmt.Errorf("%w: item quantity must be greater than 0", ErrInvalidOrder)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// Package store/returns.go contains the order return (RMA) types shared by all backends
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Return statuses. A requested return is approved or rejected by the order's
+// veterinarian; an approved one is refunded once its money goes back.
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnRefunded  = "refunded"
+)
+
+// Return item dispositions, chosen per item when a return is approved
+const (
+	// ReturnRestock puts the returned units back in stock
+	ReturnRestock = "restock"
+	// ReturnWriteOff discards them, leaving stock as it is
+	ReturnWriteOff = "write_off"
+)
+
+// Return is a client's request to send back some of a delivered order's
+// items. RefundAmount is what the items were bought for; PaymentID is the
+// payment it was refunded from.
+type Return struct {
+	ID           string       `json:"id"`
+	OrderID      string       `json:"order_id"`
+	ClientID     string       `json:"client_id"`
+	Status       string       `json:"status"`
+	Reason       string       `json:"reason"`
+	ReviewerID   string       `json:"reviewer_id,omitempty"`
+	ReviewNote   string       `json:"review_note,omitempty"`
+	RefundAmount Money        `json:"refund_amount"`
+	PaymentID    string       `json:"payment_id,omitempty"`
+	Items        []ReturnItem `json:"items"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// ReturnItem is a quantity of one order item being returned
+type ReturnItem struct {
+	ID           string `json:"id"`
+	ReturnID     string `json:"return_id"`
+	OrderItemID  string `json:"order_item_id"`
+	ProductID    string `json:"product_id"`
+	Quantity     int    `json:"quantity"`
+	Disposition  string `json:"disposition,omitempty"`
+	RefundAmount Money  `json:"refund_amount"`
+}
+
+// ReturnReview approves or rejects a requested return. Dispositions maps
+// return item IDs to ReturnRestock or ReturnWriteOff; approved items it does
+// not name are restocked.
+type ReturnReview struct {
+	ReturnID     string            `json:"return_id"`
+	Status       string            `json:"status"`
+	ReviewerID   string            `json:"reviewer_id"`
+	Note         string            `json:"note,omitempty"`
+	Dispositions map[string]string `json:"dispositions,omitempty"`
+}
+
+// NewReturn creates a new requested Return with generated IDs and timestamps
+func NewReturn(orderID, clientID, reason string, items []ReturnItem) *Return {
+	now := time.Now()
+	ret := &Return{
+		ID:        uuid.New().String(),
+		OrderID:   orderID,
+		ClientID:  clientID,
+		Status:    ReturnRequested,
+		Reason:    reason,
+		Items:     items,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for i := range ret.Items {
+		ret.Items[i].ReturnID = ret.ID
+	}
+	return ret
+}
+
+// NewReturnItem creates a new ReturnItem for quantity units of an order item
+func NewReturnItem(orderItemID string, quantity int) ReturnItem {
+	return ReturnItem{
+		ID:          uuid.New().String(),
+		OrderItemID: orderItemID,
+		Quantity:    quantity,
+	}
+}
+
+// validateReturn rejects returns without items or with items that are not
+// positive quantities of distinct order items
+func validateReturn(ret *Return) error {
+	if ret.OrderID == "" || ret.ClientID == "" {
+		return fmt.Errorf("%w: order and client are required", ErrInvalidReturn)
+	}
+	if len(ret.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidReturn)
+	}
+	seen := make(map[string]bool, len(ret.Items))
+	for _, it := range ret.Items {
+		if it.OrderItemID == "" || it.Quantity <= 0 {
+			return fmt.Errorf("%w: item quantity must be greater than 0", ErrInvalidReturn)
+		}
+		if seen[it.OrderItemID] {
+			return fmt.Errorf("%w: order item %s is listed twice", ErrInvalidReturn, it.OrderItemID)
+		}
+		seen[it.OrderItemID] = true
+	}
+	return nil
+}
+
+// returnedQuantities sums, per order item, the units in returns that were
+// not rejected
+func returnedQuantities(returns []Return) map[string]int {
+	returned := make(map[string]int)
+	for _, ret := range returns {
+		if ret.Status == ReturnRejected {
+			continue
+		}
+		for _, it := range ret.Items {
+			returned[it.OrderItemID] += it.Quantity
+		}
+	}
+	return returned
+}
+
+// priceReturn checks ret against its delivered order, whose items have
+// already had returned units returned, and fills in each item's product and
+// refund and the return's total
+func priceReturn(ret *Return, order *Order, items []OrderItem, returned map[string]int) error {
+	if order.Status != OrderDelivered {
+		return fmt.Errorf("%w: order %s is %s, only delivered orders can be returned",
+			ErrInvalidReturn, order.ID, order.Status)
+	}
+
+	byID := make(map[string]OrderItem, len(items))
+	for _, it := range items {
+		byID[it.ID] = it
+	}
+	total := NewMoney(0, order.TotalAmount.currencyOrDefault())
+	for i := range ret.Items {
+		it := &ret.Items[i]
+		ordered, ok := byID[it.OrderItemID]
+		if !ok {
+			return fmt.Errorf("%w: item %s is not part of order %s",
+				ErrInvalidReturn, it.OrderItemID, order.ID)
+		}
+		if left := ordered.Quantity - returned[it.OrderItemID]; it.Quantity > left {
+			return fmt.Errorf("%w: only %d of item %s can still be returned",
+				ErrInvalidReturn, left, it.OrderItemID)
+		}
+		it.ReturnID = ret.ID
+		it.ProductID = ordered.ProductID
+		it.RefundAmount = ordered.UnitPrice.Mul(it.Quantity)
+		sum, err := total.Add(it.RefundAmount)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidReturn, err)
+		}
+		total = sum
+	}
+	ret.RefundAmount = total
+	return nil
+}
+
+// validateReturnReview rejects reviews that neither approve nor reject or
+// that name an unknown disposition
+func validateReturnReview(review *ReturnReview) error {
+	if review.Status != ReturnApproved && review.Status != ReturnRejected {
+		return fmt.Errorf("%w: a review approves or rejects", ErrInvalidReturn)
+	}
+	for id, disposition := range review.Dispositions {
+		if disposition != ReturnRestock && disposition != ReturnWriteOff {
+			return fmt.Errorf("%w: unknown disposition %q for item %s",
+				ErrInvalidReturn, disposition, id)
+		}
+	}
+	return nil
+}
+
+// reviewReturn applies review to ret, which must still be requested, and
+// sets the disposition of each item of an approved return
+func reviewReturn(ret *Return, review *ReturnReview) error {
+	if ret.Status != ReturnRequested {
+		return returnTransitionError(ret, review.Status)
+	}
+	for id := range review.Dispositions {
+		found := false
+		for _, it := range ret.Items {
+			found = found || it.ID == id
+		}
+		if !found {
+			return fmt.Errorf("%w: item %s is not part of return %s", ErrInvalidReturn, id, ret.ID)
+		}
+	}
+
+	ret.Status = review.Status
+	ret.ReviewerID = review.ReviewerID
+	ret.ReviewNote = review.Note
+	ret.UpdatedAt = time.Now()
+	if review.Status == ReturnApproved {
+		for i := range ret.Items {
+			ret.Items[i].Disposition = ReturnRestock
+			if d, ok := review.Dispositions[ret.Items[i].ID]; ok {
+				ret.Items[i].Disposition = d
+			}
+		}
+	}
+	return nil
+}
+
+// refundReturn records that ret, which must be approved, was refunded from
+// paymentID
+func refundReturn(ret *Return, paymentID string) error {
+	if ret.Status != ReturnApproved {
+		return returnTransitionError(ret, ReturnRefunded)
+	}
+	ret.Status = ReturnRefunded
+	ret.PaymentID = paymentID
+	ret.UpdatedAt = time.Now()
+	return nil
+}
+
+// returnTransitionError explains why ret cannot move to status
+func returnTransitionError(ret *Return, status string) error {
+	return fmt.Errorf("return %s from %s to %s: %w", ret.ID, ret.Status, status, ErrReturnTransition)
+}
+
+// returnRestock is the movement that puts an approved return's item back in
+// stock
+func returnRestock(ret *Return, item ReturnItem) *StockMovement {
+	m := NewStockMovement(item.ProductID, StockReturn, item.Quantity, ret.ReviewerID)
+	m.OrderID = ret.OrderID
+	m.Reason = "Order returned"
+	m.CreatedAt = ret.UpdatedAt
+	return m
+}
@@ -0,0 +1,94 @@
+// Package store/search.go contains product search and sort rules shared by all backends
+package store
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Product sort orders accepted in ProductFilters.Sort. The empty string keeps
+// creation order, oldest first.
+const (
+	ProductSortNewest    = "newest"
+	ProductSortPriceAsc  = "price_asc"
+	ProductSortPriceDesc = "price_desc"
+	ProductSortName      = "name"
+)
+
+// IsValidProductSort reports whether sort is a supported ProductFilters.Sort value
+func IsValidProductSort(sort string) bool {
+	switch sort {
+	case "", ProductSortNewest, ProductSortPriceAsc, ProductSortPriceDesc, ProductSortName:
+		return true
+	}
+	return false
+}
+
+// searchTerms splits a search string into lower-case words. Anything that is
+// not a letter or digit separates words, which also keeps the terms safe to
+// embed in a tsquery.
+func searchTerms(search string) []string {
+	return strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixTSQuery builds a to_tsquery expression that requires every term to
+// prefix-match a word, so "kib dog" finds "Kibble for dogs"
+func prefixTSQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// matchesSearch mirrors the products.search_vector full-text match in Go:
+// every term must prefix a word of the name, description or SKU
+func matchesSearch(p Product, terms []string) bool {
+	words := searchTerms(p.Name + " " + p.Description + " " + p.SKU)
+	for _, term := range terms {
+		found := false
+		for _, w := range words {
+			if strings.HasPrefix(w, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesProductFilters applies every ProductFilters condition except paging
+func matchesProductFilters(p Product, filters ProductFilters, terms []string) bool {
+	if !p.IsActive {
+		return false
+	}
+	if filters.Category != "" && p.Category != filters.Category {
+		return false
+	}
+	if filters.VeterinarianID != "" && p.VeterinarianID != filters.VeterinarianID {
+		return false
+	}
+	if filters.Brand != "" && !strings.EqualFold(p.Brand, filters.Brand) {
+		return false
+	}
+	if filters.MinPrice.Amount > 0 && p.Price.Amount < filters.MinPrice.Amount {
+		return false
+	}
+	if filters.MaxPrice.Amount > 0 && p.Price.Amount > filters.MaxPrice.Amount {
+		return false
+	}
+	return len(terms) == 0 || matchesSearch(p, terms)
+}
+
+// sortProducts orders products by sortBy, breaking ties by creation then ID
+func sortProducts(products []Product, sortBy string) {
+	sort.Slice(products, func(i, j int) bool {
+		return productKey(products[i], sortBy).compare(productKey(products[j], sortBy)) < 0
+	})
+}
@@ -0,0 +1,136 @@
+// Package store/slots.go contains appointment slot computation shared by all backends
+package store
+
+import "time"
+
+// slotMinutes is the length of a bookable appointment slot
+const slotMinutes = 30
+
+// slotWindow is a contiguous block of working time on a given day
+type slotWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// clinicLocation returns the timezone working hours are interpreted in (Asia/Singapore)
+func clinicLocation() *time.Location {
+	loc, err := time.LoadLocation("Asia/Singapore")
+	if err != nil {
+		return time.FixedZone("SGT", 8*60*60)
+	}
+	return loc
+}
+
+// clinicDayBounds returns the start and end of the clinic day containing date
+func clinicDayBounds(date time.Time) (time.Time, time.Time) {
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, clinicLocation())
+	return startOfDay, startOfDay.Add(24 * time.Hour)
+}
+
+// workingWindows returns the veterinarian's working windows on the requested day
+func workingWindows(vet *Veterinarian, date time.Time) []slotWindow {
+	loc := clinicLocation()
+	weekdayKey := weekdayToKey(date.Weekday())
+
+	var windows []slotWindow
+	for _, wh := range vet.AvailableHours {
+		if normalizeDayKey(wh.DayOfWeek) != weekdayKey {
+			continue
+		}
+		startParsed, err1 := time.Parse("15:04", wh.Start)
+		endParsed, err2 := time.Parse("15:04", wh.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		ws := time.Date(date.Year(), date.Month(), date.Day(), startParsed.Hour(), startParsed.Minute(), 0, 0, loc)
+		we := time.Date(date.Year(), date.Month(), date.Day(), endParsed.Hour(), endParsed.Minute(), 0, 0, loc)
+		if we.After(ws) {
+			windows = append(windows, slotWindow{start: ws, end: we})
+		}
+	}
+	return windows
+}
+
+// buildTimeSlots builds 30-minute slots within the vet's working windows for date
+// and marks each as available if it does not overlap a non-cancelled appointment
+func buildTimeSlots(vet *Veterinarian, appts []Appointment, date time.Time) []TimeSlot {
+	windows := workingWindows(vet, date)
+	if len(windows) == 0 {
+		return []TimeSlot{}
+	}
+
+	// Ignore cancelled appointments
+	activeAppts := make([]Appointment, 0, len(appts))
+	for _, a := range appts {
+		if a.Status != "cancelled" {
+			activeAppts = append(activeAppts, a)
+		}
+	}
+
+	step := time.Duration(slotMinutes) * time.Minute
+	var slots []TimeSlot
+	for _, win := range windows {
+		for ts := win.start; !ts.Add(step).After(win.end); ts = ts.Add(step) {
+			te := ts.Add(step)
+			available := true
+			for _, a := range activeAppts {
+				as := a.AppointmentDate
+				ae := as.Add(time.Duration(a.DurationMinutes) * time.Minute)
+				if intervalsOverlap(ts, te, as, ae) {
+					available = false
+					break
+				}
+			}
+			slots = append(slots, TimeSlot{StartTime: ts, EndTime: te, Available: available})
+		}
+	}
+
+	return slots
+}
+
+// intervalsOverlap returns true if [s1,e1) overlaps [s2,e2)
+func intervalsOverlap(s1, e1, s2, e2 time.Time) bool {
+	return s1.Before(e2) && s2.Before(e1)
+}
+
+// weekdayToKey returns canonical three-letter weekday key
+func weekdayToKey(w time.Weekday) string {
+	switch w {
+	case time.Monday:
+		return "Mon"
+	case time.Tuesday:
+		return "Tue"
+	case time.Wednesday:
+		return "Wed"
+	case time.Thursday:
+		return "Thu"
+	case time.Friday:
+		return "Fri"
+	case time.Saturday:
+		return "Sat"
+	default:
+		return "Sun"
+	}
+}
+
+// normalizeDayKey maps arbitrary inputs to canonical three-letter weekday key
+func normalizeDayKey(s string) string {
+	switch s {
+	case "Mon", "Monday", "monday", "mon":
+		return "Mon"
+	case "Tue", "Tues", "Tuesday", "tuesday", "tue", "tues":
+		return "Tue"
+	case "Wed", "Wednesday", "wednesday", "wed":
+		return "Wed"
+	case "Thu", "Thur", "Thurs", "Thursday", "thursday", "thu", "thur", "thurs":
+		return "Thu"
+	case "Fri", "Friday", "friday", "fri":
+		return "Fri"
+	case "Sat", "Saturday", "saturday", "sat":
+		return "Sat"
+	case "Sun", "Sunday", "sunday", "sun":
+		return "Sun"
+	default:
+		return s
+	}
+}
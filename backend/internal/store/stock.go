@@ -0,0 +1,85 @@
+// Package store/stock.go contains the inventory ledger types shared by all backends
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Stock movement types
+const (
+	StockSale         = "sale"
+	StockCancellation = "cancellation"
+	StockAdjustment   = "adjustment"
+	StockReceived     = "received"
+	StockWriteOff     = "write_off"
+	StockReturn       = "return"
+)
+
+// openingBalance is the reason on the movement that records a product's
+// stock when it is created, or when the ledger was introduced
+const openingBalance = "Opening balance"
+
+// StockMovement is one row of a product's inventory ledger. Quantity is the
+// signed change in stock and BalanceAfter the stock it left behind, so a
+// product's stock is the sum of its movements. Rows are never changed.
+type StockMovement struct {
+	ID           string    `json:"id"`
+	ProductID    string    `json:"product_id"`
+	Type         string    `json:"type"`
+	Quantity     int       `json:"quantity"`
+	BalanceAfter int       `json:"balance_after"`
+	Reason       string    `json:"reason"`
+	ActorID      string    `json:"actor_id"`
+	OrderID      string    `json:"order_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewStockMovement creates a new StockMovement with generated ID and timestamp
+func NewStockMovement(productID, movementType string, quantity int, actorID string) *StockMovement {
+	return &StockMovement{
+		ID:        uuid.New().String(),
+		ProductID: productID,
+		Type:      movementType,
+		Quantity:  quantity,
+		ActorID:   actorID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// openingMovement records the stock a product was created with
+func openingMovement(product *Product) *StockMovement {
+	m := NewStockMovement(product.ID, StockAdjustment, product.StockQuantity, "")
+	m.BalanceAfter = product.StockQuantity
+	m.Reason = openingBalance
+	m.CreatedAt = product.CreatedAt
+	return m
+}
+
+// validateStockMovement rejects movements whose sign does not fit their type
+func validateStockMovement(m *StockMovement) error {
+	switch m.Type {
+	case StockSale, StockWriteOff:
+		if m.Quantity >= 0 {
+			return fmt.Errorf("%w: %s must decrease stock", ErrInvalidStockMovement, m.Type)
+		}
+	case StockCancellation, StockReceived, StockReturn:
+		if m.Quantity <= 0 {
+			return fmt.Errorf("%w: %s must increase stock", ErrInvalidStockMovement, m.Type)
+		}
+	case StockAdjustment:
+		if m.Quantity == 0 {
+			return fmt.Errorf("%w: adjustment must change stock", ErrInvalidStockMovement)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidStockMovement, m.Type)
+	}
+	return nil
+}
+
+// stockMovementKey is the cursor for ListStockMovements, which lists newest first
+func stockMovementKey(m StockMovement) cursor {
+	return cursor{Sort: sortByNewest, CreatedAt: m.CreatedAt, ID: m.ID}
+}
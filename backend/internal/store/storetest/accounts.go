@@ -0,0 +1,100 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+)
+
+// testAdminAccounts covers the admin registry, suspensions and listing users
+// by role. Other admins may exist in a shared database, so removing the last
+// admin is left to backends' own tests.
+func testAdminAccounts(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	bare := missingID()
+
+	// A client promoted to admin acts as one and keeps their profile
+	must(t, "GrantAdmin(client)", db.GrantAdmin(ctx, store.NewAdminGrant(client.ID, client.Email, client.Name, vet.ID)))
+	user, err := db.GetUserByID(ctx, client.ID)
+	must(t, "GetUserByID(promoted client)", err)
+	if user.Role != store.RoleAdmin || user.Profile != store.RoleClient || user.Email != client.Email {
+		t.Errorf("GetUserByID(promoted client): expected an admin with a client profile, got %+v", user)
+	}
+	err = db.GrantAdmin(ctx, store.NewAdminGrant(client.ID, client.Email, client.Name, ""))
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("GrantAdmin twice: expected ErrConflict, got %v", err)
+	}
+
+	// Admins without a profile are found through the registry
+	must(t, "GrantAdmin(no profile)", db.GrantAdmin(ctx, store.NewAdminGrant(bare, "root@example.com", "Root", "")))
+	user, err = db.GetUserByID(ctx, bare)
+	must(t, "GetUserByID(admin without a profile)", err)
+	if user.Role != store.RoleAdmin || user.Profile != "" || user.Email != "root@example.com" {
+		t.Errorf("GetUserByID(admin without a profile): unexpected user %+v", user)
+	}
+
+	// Listing by role uses the role users act in
+	roles := map[string]string{}
+	for _, role := range store.UserRoles {
+		list := func(page store.Page) ([]store.User, string, error) {
+			return db.ListUsers(ctx, role, page)
+		}
+		for _, page := range walk(t, "ListUsers("+role+")", store.MaxPageLimit, userID, list) {
+			for _, id := range page {
+				if other, ok := roles[id]; ok {
+					t.Errorf("ListUsers: user %s listed as both %s and %s", id, other, role)
+				}
+				roles[id] = role
+			}
+		}
+	}
+	want := map[string]string{client.ID: store.RoleAdmin, vet.ID: store.RoleVeterinarian, bare: store.RoleAdmin}
+	for id, role := range want {
+		if roles[id] != role {
+			t.Errorf("ListUsers: expected %s listed as %s, got %q", id, role, roles[id])
+		}
+	}
+
+	// Demoting puts the client back in their profile's role
+	must(t, "RevokeAdmin", db.RevokeAdmin(ctx, client.ID))
+	user, err = db.GetUserByID(ctx, client.ID)
+	must(t, "GetUserByID(demoted client)", err)
+	if user.Role != store.RoleClient {
+		t.Errorf("GetUserByID(demoted client): expected role client, got %q", user.Role)
+	}
+	expectNotFound(t, "RevokeAdmin(not an admin)", db.RevokeAdmin(ctx, client.ID))
+
+	// Suspensions are reported until lifted, and a second replaces the first
+	if user.Suspended() {
+		t.Errorf("GetUserByID: expected an active account, got %+v", user)
+	}
+	must(t, "SuspendUser", db.SuspendUser(ctx, store.NewSuspension(vet.ID, "chargebacks", bare)))
+	must(t, "SuspendUser(again)", db.SuspendUser(ctx, store.NewSuspension(vet.ID, "fraud", bare)))
+	user, err = db.GetUserByID(ctx, vet.ID)
+	must(t, "GetUserByID(suspended)", err)
+	if !user.Suspended() || user.SuspensionReason != "fraud" || user.Role != store.RoleVeterinarian {
+		t.Errorf("GetUserByID(suspended): expected a suspended veterinarian, got %+v", user)
+	}
+	must(t, "ReactivateUser", db.ReactivateUser(ctx, vet.ID))
+	user, err = db.GetUserByID(ctx, vet.ID)
+	must(t, "GetUserByID(reactivated)", err)
+	if user.Suspended() {
+		t.Errorf("GetUserByID(reactivated): expected an active account, got %+v", user)
+	}
+	expectNotFound(t, "ReactivateUser(not suspended)", db.ReactivateUser(ctx, vet.ID))
+
+	// Deleting a profile leaves the registry alone
+	must(t, "GrantAdmin(vet)", db.GrantAdmin(ctx, store.NewAdminGrant(vet.ID, vet.Email, vet.Name, bare)))
+	must(t, "DeleteUser", db.DeleteUser(ctx, vet.ID))
+	user, err = db.GetUserByID(ctx, vet.ID)
+	must(t, "GetUserByID(deleted admin)", err)
+	if user.Role != store.RoleAdmin || user.Profile != "" {
+		t.Errorf("GetUserByID(deleted admin): expected an admin without a profile, got %+v", user)
+	}
+	must(t, "RevokeAdmin(deleted admin)", db.RevokeAdmin(ctx, vet.ID))
+	_, err = db.GetUserByID(ctx, vet.ID)
+	expectNotFound(t, "GetUserByID(deleted and demoted)", err)
+}
@@ -0,0 +1,112 @@
+package storetest
+
+import (
+	"context"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// clinicZone matches the clinic's Asia/Singapore day boundaries (UTC+8, no DST)
+var clinicZone = time.FixedZone("SGT", 8*60*60)
+
+// testAppointments covers appointment CRUD and listing by client and vet
+func testAppointments(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	otherVet := newVet(t, db)
+	pet := newPet(t, db, client.ID, "Coco")
+
+	at := time.Date(2024, 6, 3, 10, 0, 0, 0, clinicZone)
+	first := store.NewAppointment(client.ID, vet.ID, pet.ID, at, 30, "Checkup")
+	second := store.NewAppointment(client.ID, otherVet.ID, pet.ID, at.Add(time.Hour), 30, "Dental")
+	must(t, "CreateAppointment", db.CreateAppointment(ctx, first))
+	must(t, "CreateAppointment", db.CreateAppointment(ctx, second))
+
+	got, err := db.GetAppointmentByID(ctx, first.ID)
+	must(t, "GetAppointmentByID", err)
+	if got.Reason != "Checkup" || got.Status != "scheduled" || got.DurationMinutes != 30 {
+		t.Errorf("GetAppointmentByID: unexpected appointment %+v", got)
+	}
+	if !got.AppointmentDate.Equal(at) {
+		t.Errorf("GetAppointmentByID: expected date %s, got %s", at, got.AppointmentDate)
+	}
+
+	byClient, _, err := db.GetAppointmentsByClientID(ctx, client.ID, store.Page{})
+	must(t, "GetAppointmentsByClientID", err)
+	if want := []string{first.ID, second.ID}; !sameIDs(ids(byClient, apptID), want) {
+		t.Errorf("GetAppointmentsByClientID: expected %v, got %v", want, ids(byClient, apptID))
+	}
+	byVet, _, err := db.GetAppointmentsByVeterinarianID(ctx, vet.ID, store.Page{})
+	must(t, "GetAppointmentsByVeterinarianID", err)
+	if want := []string{first.ID}; !sameIDs(ids(byVet, apptID), want) {
+		t.Errorf("GetAppointmentsByVeterinarianID: expected %v, got %v", want, ids(byVet, apptID))
+	}
+
+	orphan := store.NewAppointment(client.ID, missingID(), pet.ID, at, 30, "Checkup")
+	expectNotFound(t, "CreateAppointment with missing vet", db.CreateAppointment(ctx, orphan))
+
+	first.Status = "cancelled"
+	first.UpdatedAt = time.Now()
+	must(t, "UpdateAppointment", db.UpdateAppointment(ctx, first))
+	got, err = db.GetAppointmentByID(ctx, first.ID)
+	must(t, "GetAppointmentByID after update", err)
+	if got.Status != "cancelled" {
+		t.Errorf("UpdateAppointment: expected status cancelled, got %q", got.Status)
+	}
+
+	missing := *first
+	missing.ID = missingID()
+	expectNotFound(t, "UpdateAppointment", db.UpdateAppointment(ctx, &missing))
+
+	must(t, "DeleteAppointment", db.DeleteAppointment(ctx, first.ID))
+	_, err = db.GetAppointmentByID(ctx, first.ID)
+	expectNotFound(t, "GetAppointmentByID after delete", err)
+}
+
+// testAppointmentSlots covers slot generation from working hours, ignoring
+// cancelled appointments and appointments on other days
+func testAppointmentSlots(t *testing.T, db store.Database) {
+	ctx := context.Background()
+
+	// 2024-01-15 is a Monday
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, clinicZone)
+	vet := newVet(t, db, store.WorkingHours{DayOfWeek: "Monday", Start: "09:00", End: "11:00"})
+	client := newClient(t, db)
+	pet := newPet(t, db, client.ID, "Pixel")
+
+	booked := store.NewAppointment(client.ID, vet.ID, pet.ID, date.Add(9*time.Hour), 30, "Checkup")
+	long := store.NewAppointment(client.ID, vet.ID, pet.ID, date.Add(10*time.Hour), 60, "Surgery consult")
+	long.Status = "cancelled"
+	nextDay := store.NewAppointment(client.ID, vet.ID, pet.ID, date.Add(33*time.Hour+30*time.Minute), 30, "Checkup")
+	for _, a := range []*store.Appointment{booked, long, nextDay} {
+		must(t, "CreateAppointment", db.CreateAppointment(ctx, a))
+	}
+
+	slots, err := db.GetAvailableAppointmentSlots(ctx, vet.ID, date)
+	must(t, "GetAvailableAppointmentSlots", err)
+	if len(slots) != 4 {
+		t.Fatalf("GetAvailableAppointmentSlots: expected 4 slots, got %d", len(slots))
+	}
+	want := []bool{false, true, true, true}
+	for i, s := range slots {
+		if s.Available != want[i] {
+			t.Errorf("Slot %d at %s: expected available=%v", i, s.StartTime, want[i])
+		}
+		if start := date.Add(9*time.Hour + time.Duration(i)*30*time.Minute); !s.StartTime.Equal(start) {
+			t.Errorf("Slot %d: expected start %s, got %s", i, start, s.StartTime)
+		}
+	}
+
+	// A day without working hours has no slots
+	tuesday := date.AddDate(0, 0, 1)
+	slots, err = db.GetAvailableAppointmentSlots(ctx, vet.ID, tuesday)
+	must(t, "GetAvailableAppointmentSlots(Tuesday)", err)
+	if len(slots) != 0 {
+		t.Errorf("GetAvailableAppointmentSlots(Tuesday): expected no slots, got %d", len(slots))
+	}
+
+	_, err = db.GetAvailableAppointmentSlots(ctx, missingID(), date)
+	expectNotFound(t, "GetAvailableAppointmentSlots", err)
+}
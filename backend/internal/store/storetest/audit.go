@@ -0,0 +1,110 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testAudit covers the audit log: entries round-trip with their changes, list
+// newest first, honour every filter and cannot be written twice
+func testAudit(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	// A fresh actor keeps this test's entries apart from anything else in the log
+	actor := uuid.NewString()
+	petID := uuid.NewString()
+	start := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+
+	var entries []*store.AuditEntry
+	for i, action := range []string{store.AuditCreate, store.AuditUpdate, store.AuditRead} {
+		e := store.NewAuditEntry(actor, "client", action, store.EntityPet, petID)
+		e.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		e.IP = "203.0.113.7"
+		e.RequestID = "req-" + action
+		if action == store.AuditUpdate {
+			e.Changes = store.AuditDiff(
+				map[string]any{"name": "Luna", "weight": 4.5},
+				map[string]any{"name": "Luna II", "weight": 4.5},
+			)
+		}
+		must(t, "AppendAuditEntry", db.AppendAuditEntry(ctx, e))
+		entries = append(entries, e)
+	}
+	other := store.NewAuditEntry(actor, "client", store.AuditRead, store.EntityMedicalRecord, uuid.NewString())
+	other.CreatedAt = start.Add(10 * time.Minute)
+	must(t, "AppendAuditEntry", db.AppendAuditEntry(ctx, other))
+
+	if err := db.AppendAuditEntry(ctx, entries[0]); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("AppendAuditEntry(duplicate): expected ErrConflict, got %v", err)
+	}
+
+	got, _, err := db.ListAuditEntries(ctx, store.AuditFilter{ActorID: actor}, store.Page{})
+	must(t, "ListAuditEntries(actor)", err)
+	want := []string{other.ID, entries[2].ID, entries[1].ID, entries[0].ID}
+	if !sameIDs(ids(got, auditID), want) {
+		t.Errorf("ListAuditEntries(actor): expected newest first %v, got %v", want, ids(got, auditID))
+	}
+	if len(got) == 4 {
+		update := got[2]
+		if update.IP != "203.0.113.7" || update.RequestID != "req-update" {
+			t.Errorf("ListAuditEntries: expected IP and request ID to round-trip, got %q %q",
+				update.IP, update.RequestID)
+		}
+		change, ok := update.Changes["name"]
+		if len(update.Changes) != 1 || !ok || change.Before != "Luna" || change.After != "Luna II" {
+			t.Errorf("ListAuditEntries: expected only the name change, got %v", update.Changes)
+		}
+		if got[0].Changes != nil {
+			t.Errorf("ListAuditEntries: expected no changes on a read, got %v", got[0].Changes)
+		}
+	}
+
+	filters := map[string]struct {
+		filter store.AuditFilter
+		want   []string
+	}{
+		"entity": {
+			store.AuditFilter{ActorID: actor, Entity: store.EntityPet},
+			[]string{entries[2].ID, entries[1].ID, entries[0].ID},
+		},
+		"entity ID": {
+			store.AuditFilter{ActorID: actor, EntityID: other.EntityID},
+			[]string{other.ID},
+		},
+		"action": {
+			store.AuditFilter{ActorID: actor, Action: store.AuditRead},
+			[]string{other.ID, entries[2].ID},
+		},
+		"window": {
+			store.AuditFilter{ActorID: actor, From: entries[1].CreatedAt, To: other.CreatedAt},
+			[]string{entries[2].ID, entries[1].ID},
+		},
+	}
+	for name, tt := range filters {
+		got, _, err := db.ListAuditEntries(ctx, tt.filter, store.Page{})
+		must(t, "ListAuditEntries("+name+")", err)
+		if !sameIDs(ids(got, auditID), tt.want) {
+			t.Errorf("ListAuditEntries(%s): expected %v, got %v", name, tt.want, ids(got, auditID))
+		}
+	}
+
+	// Paging through the log visits every entry once
+	var paged []string
+	page := store.Page{Limit: 3}
+	for {
+		got, next, err := db.ListAuditEntries(ctx, store.AuditFilter{ActorID: actor}, page)
+		must(t, "ListAuditEntries(page)", err)
+		paged = append(paged, ids(got, auditID)...)
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+	if !sameIDs(paged, want) {
+		t.Errorf("ListAuditEntries pages: expected %v, got %v", want, paged)
+	}
+}
@@ -0,0 +1,93 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// testCheckout covers confirming a cart from several veterinarians: it is
+// placed as one order per veterinarian under a shared checkout group, and
+// either every order is placed or none is
+func testCheckout(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vetA := newVet(t, db)
+	vetB := newVet(t, db)
+	food := newProduct(t, db, vetA.ID, "food", 10, 5)
+	toy := newProduct(t, db, vetB.ID, "toys", 4, 3)
+	lead := newProduct(t, db, vetB.ID, "accessories", 7, 2)
+
+	cart := []store.ReservationItem{
+		{ProductID: food.ID, Quantity: 2},
+		{ProductID: toy.ID, Quantity: 3},
+		{ProductID: lead.ID, Quantity: 1},
+	}
+
+	// A later order failing leaves no earlier order behind
+	failing := store.NewReservation(client.ID, cart, time.Hour)
+	must(t, "CreateReservation", db.CreateReservation(ctx, failing))
+	writeOff := store.NewStockMovement(toy.ID, store.StockWriteOff, -1, vetB.ID)
+	must(t, "RecordStockMovement", db.RecordStockMovement(ctx, writeOff))
+	var stockErr *store.InsufficientStockError
+	_, err := db.ConfirmReservation(ctx, failing.ID, store.NewOrder(client.ID, "", store.Money{}))
+	if !errors.As(err, &stockErr) || stockErr.ProductID != toy.ID {
+		t.Fatalf("ConfirmReservation with short stock: expected InsufficientStockError for the toy, got %v", err)
+	}
+	assertStock(t, db, food.ID, 5)
+	assertStock(t, db, lead.ID, 2)
+	orders, _, err := db.GetOrdersByClientID(ctx, client.ID, store.Page{})
+	must(t, "GetOrdersByClientID", err)
+	if len(orders) != 0 {
+		t.Errorf("ConfirmReservation with short stock: expected no orders, got %d", len(orders))
+	}
+	got, err := db.GetReservationByID(ctx, failing.ID)
+	must(t, "GetReservationByID", err)
+	if got.Status != store.ReservationActive {
+		t.Errorf("ConfirmReservation with short stock: expected the reservation still active, got %q", got.Status)
+	}
+	must(t, "ReleaseReservation", db.ReleaseReservation(ctx, failing.ID))
+
+	cart[1].Quantity = 2
+	held := store.NewReservation(client.ID, cart, time.Hour)
+	must(t, "CreateReservation", db.CreateReservation(ctx, held))
+	template := store.NewOrder(client.ID, "", store.Money{})
+	template.DeliveryMethod = "delivery"
+	template.ShippingAddress = "1 Test Street"
+	checkout, err := db.ConfirmReservation(ctx, held.ID, template)
+	must(t, "ConfirmReservation", err)
+	if checkout.ClientID != client.ID || len(checkout.Orders) != 2 || checkout.TotalAmount != usd(35) {
+		t.Fatalf("ConfirmReservation: unexpected checkout %+v", checkout)
+	}
+	totals := map[string]store.Money{}
+	for _, o := range checkout.Orders {
+		totals[o.VeterinarianID] = o.TotalAmount
+		if o.CheckoutGroupID != checkout.ID || o.DeliveryMethod != "delivery" ||
+			o.ShippingAddress != "1 Test Street" {
+			t.Errorf("ConfirmReservation: order %+v does not carry the checkout's details", o.Order)
+		}
+		stored, err := db.GetOrderByID(ctx, o.ID)
+		must(t, "GetOrderByID", err)
+		if stored.CheckoutGroupID != checkout.ID || stored.TotalAmount != o.TotalAmount {
+			t.Errorf("GetOrderByID: expected the stored order to match %+v, got %+v", o.Order, stored)
+		}
+		items, err := db.GetOrderItems(ctx, o.ID)
+		must(t, "GetOrderItems", err)
+		if len(items) != len(o.Items) {
+			t.Errorf("GetOrderItems: expected %d items, got %d", len(o.Items), len(items))
+		}
+	}
+	if totals[vetA.ID] != usd(20) || totals[vetB.ID] != usd(15) {
+		t.Errorf("ConfirmReservation: expected an order of 20 for one vet and 15 for the other, got %v", totals)
+	}
+	vetOrders, _, err := db.GetOrdersByVeterinarianID(ctx, vetB.ID, store.Page{})
+	must(t, "GetOrdersByVeterinarianID", err)
+	if len(vetOrders) != 1 || vetOrders[0].CheckoutGroupID != checkout.ID {
+		t.Errorf("GetOrdersByVeterinarianID: expected the vet to see their part of the checkout, got %+v", vetOrders)
+	}
+	assertStock(t, db, food.ID, 3)
+	assertStock(t, db, toy.ID, 0)
+	assertStock(t, db, lead.ID, 1)
+}
@@ -0,0 +1,119 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+)
+
+// newInvoice builds an unnumbered invoice of kind for order with one line
+func newInvoice(t *testing.T, kind string, order *store.Order, total store.Money) *store.Invoice {
+	t.Helper()
+	inv, err := store.NewInvoice(kind, order,
+		store.InvoiceParty{ID: order.VeterinarianID, Name: "Clinic"},
+		store.InvoiceParty{ID: order.ClientID, Name: "Client"},
+		[]store.InvoiceLine{{Description: "Item", Quantity: 1, UnitPrice: total, Total: total}},
+		nil, false)
+	must(t, "NewInvoice", err)
+	return inv
+}
+
+// testInvoices covers invoice numbering: each veterinarian numbers invoices
+// and credit notes in their own sequences, an order has one invoice and a
+// return one credit note, and credit notes must credit the order's invoice
+func testInvoices(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	other := newVet(t, db)
+	newOrder := func(vetID string) *store.Order {
+		order := store.NewOrder(client.ID, vetID, usd(12))
+		must(t, "CreateOrder", db.CreateOrder(ctx, order))
+		return order
+	}
+	first, second, elsewhere := newOrder(vet.ID), newOrder(vet.ID), newOrder(other.ID)
+
+	_, err := db.GetOrderInvoice(ctx, first.ID)
+	expectNotFound(t, "GetOrderInvoice before issuing", err)
+	_, err = db.GetInvoiceByID(ctx, missingID())
+	expectNotFound(t, "GetInvoiceByID(missing)", err)
+
+	inv := newInvoice(t, store.InvoiceKindInvoice, first, usd(12))
+	must(t, "IssueInvoice", db.IssueInvoice(ctx, inv))
+	if inv.Sequence != 1 || inv.Number != "INV-000001" {
+		t.Errorf("IssueInvoice: expected INV-000001, got %q (%d)", inv.Number, inv.Sequence)
+	}
+	again := newInvoice(t, store.InvoiceKindInvoice, first, usd(12))
+	if err := db.IssueInvoice(ctx, again); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("IssueInvoice for an invoiced order: expected ErrConflict, got %v", err)
+	}
+	next := newInvoice(t, store.InvoiceKindInvoice, second, usd(12))
+	must(t, "IssueInvoice(second)", db.IssueInvoice(ctx, next))
+	if next.Number != "INV-000002" {
+		t.Errorf("IssueInvoice after a conflict: expected INV-000002, got %q", next.Number)
+	}
+	theirs := newInvoice(t, store.InvoiceKindInvoice, elsewhere, usd(12))
+	must(t, "IssueInvoice(other vet)", db.IssueInvoice(ctx, theirs))
+	if theirs.Number != "INV-000001" {
+		t.Errorf("IssueInvoice for another vet: expected INV-000001, got %q", theirs.Number)
+	}
+
+	got, err := db.GetOrderInvoice(ctx, first.ID)
+	must(t, "GetOrderInvoice", err)
+	if got.ID != inv.ID || got.Number != inv.Number || got.Total != usd(12) ||
+		got.Seller.Name != "Clinic" || len(got.Lines) != 1 || got.Lines[0].Total != usd(12) {
+		t.Errorf("GetOrderInvoice: unexpected invoice %+v", got)
+	}
+
+	invalid := newInvoice(t, store.InvoiceKindCreditNote, first, usd(2))
+	if err := db.IssueInvoice(ctx, invalid); !errors.Is(err, store.ErrInvalidInvoice) {
+		t.Errorf("IssueInvoice of a credit note crediting nothing: expected ErrInvalidInvoice, got %v", err)
+	}
+	stray := newInvoice(t, store.InvoiceKindCreditNote, first, usd(2))
+	stray.InvoiceID = theirs.ID
+	expectNotFound(t, "IssueInvoice crediting another order's invoice", db.IssueInvoice(ctx, stray))
+
+	returnID := missingID()
+	var notes []*store.Invoice
+	for _, amount := range []store.Money{usd(2), usd(3)} {
+		note := newInvoice(t, store.InvoiceKindCreditNote, first, amount)
+		note.InvoiceID, note.InvoiceNumber = inv.ID, inv.Number
+		if len(notes) == 0 {
+			note.ReturnID = returnID
+		}
+		must(t, "IssueInvoice(credit note)", db.IssueInvoice(ctx, note))
+		notes = append(notes, note)
+	}
+	if notes[0].Number != "CN-000001" || notes[1].Number != "CN-000002" {
+		t.Errorf("IssueInvoice: expected CN-000001 and CN-000002, got %q and %q",
+			notes[0].Number, notes[1].Number)
+	}
+	dup := newInvoice(t, store.InvoiceKindCreditNote, first, usd(2))
+	dup.InvoiceID, dup.ReturnID = inv.ID, returnID
+	if err := db.IssueInvoice(ctx, dup); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("IssueInvoice of a second credit note for a return: expected ErrConflict, got %v", err)
+	}
+
+	listed, err := db.GetOrderCreditNotes(ctx, first.ID)
+	must(t, "GetOrderCreditNotes", err)
+	want := []string{notes[0].ID, notes[1].ID}
+	if got := ids(listed, func(n store.Invoice) string { return n.ID }); !sameIDs(got, want) {
+		t.Errorf("GetOrderCreditNotes: expected %v, got %v", want, got)
+	}
+	if n := listed[0]; n.InvoiceID != inv.ID || n.InvoiceNumber != inv.Number ||
+		n.ReturnID != returnID || n.Total != usd(2) {
+		t.Errorf("GetOrderCreditNotes: unexpected credit note %+v", n)
+	}
+	none, err := db.GetOrderCreditNotes(ctx, second.ID)
+	must(t, "GetOrderCreditNotes(none)", err)
+	if len(none) != 0 {
+		t.Errorf("GetOrderCreditNotes: expected none, got %d", len(none))
+	}
+
+	byID, err := db.GetInvoiceByID(ctx, notes[1].ID)
+	must(t, "GetInvoiceByID", err)
+	if byID.Kind != store.InvoiceKindCreditNote || byID.Number != "CN-000002" {
+		t.Errorf("GetInvoiceByID: unexpected credit note %+v", byID)
+	}
+}
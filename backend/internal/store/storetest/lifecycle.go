@@ -0,0 +1,125 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// testOrderLifecycle covers status transitions: each is checked against the
+// order's current status, recorded in its history, can settle the payment
+// along the way, and cancelling puts the items back in stock unless the order
+// is paid
+func testOrderLifecycle(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	product := newProduct(t, db, vet.ID, "food", 10, 5)
+
+	delivered := store.NewOrder(client.ID, vet.ID, store.Money{})
+	must(t, "PlaceOrder", db.PlaceOrder(ctx, delivered,
+		[]store.OrderItem{*store.NewOrderItem("", product.ID, 1, store.Money{})}))
+
+	steps := []struct{ from, to, note string }{
+		{store.OrderPending, store.OrderConfirmed, ""},
+		{store.OrderConfirmed, store.OrderProcessing, ""},
+		{store.OrderProcessing, store.OrderShipped, "Tracking 1Z999"},
+		{store.OrderShipped, store.OrderDelivered, ""},
+	}
+	at := time.Now()
+	for i, step := range steps {
+		change := store.NewOrderStatusChange(delivered.ID, step.from, step.to, vet.ID, step.note)
+		change.CreatedAt = at.Add(time.Duration(i) * time.Millisecond)
+		if step.to == store.OrderDelivered {
+			change.PaymentStatus = store.PaymentPaid // cash on delivery
+		}
+		must(t, "TransitionOrder("+step.to+")", db.TransitionOrder(ctx, change))
+	}
+	got, err := db.GetOrderByID(ctx, delivered.ID)
+	must(t, "GetOrderByID", err)
+	if got.Status != store.OrderDelivered || got.PaymentStatus != store.PaymentPaid {
+		t.Errorf("TransitionOrder with a payment status: expected delivered and paid, got %s and %s",
+			got.Status, got.PaymentStatus)
+	}
+
+	history, err := db.GetOrderStatusHistory(ctx, delivered.ID)
+	must(t, "GetOrderStatusHistory", err)
+	if len(history) != len(steps) {
+		t.Fatalf("GetOrderStatusHistory: expected %d changes, got %d", len(steps), len(history))
+	}
+	for i, step := range steps {
+		if history[i].FromStatus != step.from || history[i].ToStatus != step.to ||
+			history[i].ActorID != vet.ID || history[i].Note != step.note {
+			t.Errorf("GetOrderStatusHistory[%d]: unexpected change %+v", i, history[i])
+		}
+	}
+	_, err = db.GetOrderStatusHistory(ctx, missingID())
+	expectNotFound(t, "GetOrderStatusHistory", err)
+
+	backwards := store.NewOrderStatusChange(
+		delivered.ID, store.OrderDelivered, store.OrderPending, vet.ID, "")
+	if err := db.TransitionOrder(ctx, backwards); !errors.Is(err, store.ErrOrderTransition) {
+		t.Errorf("TransitionOrder from delivered: expected ErrOrderTransition, got %v", err)
+	}
+
+	cancelled := store.NewOrder(client.ID, vet.ID, store.Money{})
+	must(t, "PlaceOrder(second)", db.PlaceOrder(ctx, cancelled,
+		[]store.OrderItem{*store.NewOrderItem("", product.ID, 3, store.Money{})}))
+	stale := store.NewOrderStatusChange(
+		cancelled.ID, store.OrderConfirmed, store.OrderCancelled, client.ID, "")
+	if err := db.TransitionOrder(ctx, stale); !errors.Is(err, store.ErrOrderTransition) {
+		t.Errorf("TransitionOrder from a stale status: expected ErrOrderTransition, got %v", err)
+	}
+
+	cancel := store.NewOrderStatusChange(
+		cancelled.ID, store.OrderPending, store.OrderCancelled, client.ID, "Ordered twice")
+	must(t, "TransitionOrder(cancelled)", db.TransitionOrder(ctx, cancel))
+	got, err = db.GetOrderByID(ctx, cancelled.ID)
+	must(t, "GetOrderByID", err)
+	if got.Status != store.OrderCancelled {
+		t.Errorf("TransitionOrder: expected cancelled, got %q", got.Status)
+	}
+	if err := db.TransitionOrder(ctx, cancel); !errors.Is(err, store.ErrOrderTransition) {
+		t.Errorf("TransitionOrder cancelling twice: expected ErrOrderTransition, got %v", err)
+	}
+
+	stocked, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID", err)
+	if stocked.StockQuantity != 4 {
+		t.Errorf("TransitionOrder: expected stock 4 after cancelling, got %d", stocked.StockQuantity)
+	}
+	movements, _, err := db.ListStockMovements(ctx, product.ID, store.Page{})
+	must(t, "ListStockMovements", err)
+	restock := movements[0]
+	if restock.Type != store.StockCancellation || restock.Quantity != 3 ||
+		restock.BalanceAfter != 4 || restock.OrderID != cancelled.ID ||
+		restock.ActorID != client.ID {
+		t.Errorf("TransitionOrder: unexpected restock movement %+v", restock)
+	}
+
+	// Cancelling would keep a paid order's money, whether it was paid before
+	// or by the cancelling change itself
+	paid := store.NewOrder(client.ID, vet.ID, store.Money{})
+	must(t, "PlaceOrder(third)", db.PlaceOrder(ctx, paid,
+		[]store.OrderItem{*store.NewOrderItem("", product.ID, 1, store.Money{})}))
+	settleAndCancel := store.NewOrderStatusChange(
+		paid.ID, store.OrderPending, store.OrderCancelled, vet.ID, "")
+	settleAndCancel.PaymentStatus = store.PaymentPaid
+	if err := db.TransitionOrder(ctx, settleAndCancel); !errors.Is(err, store.ErrOrderPaid) {
+		t.Errorf("TransitionOrder settling and cancelling: expected ErrOrderPaid, got %v", err)
+	}
+	must(t, "UpdateOrderPaymentStatus", db.UpdateOrderPaymentStatus(ctx, paid.ID, store.PaymentPaid))
+	cancelPaid := store.NewOrderStatusChange(
+		paid.ID, store.OrderPending, store.OrderCancelled, client.ID, "")
+	if err := db.TransitionOrder(ctx, cancelPaid); !errors.Is(err, store.ErrOrderPaid) {
+		t.Errorf("TransitionOrder cancelling a paid order: expected ErrOrderPaid, got %v", err)
+	}
+	got, err = db.GetOrderByID(ctx, paid.ID)
+	must(t, "GetOrderByID(paid)", err)
+	if got.Status != store.OrderPending {
+		t.Errorf("TransitionOrder cancelling a paid order: expected it pending, got %q", got.Status)
+	}
+	assertStock(t, db, product.ID, 3)
+}
@@ -0,0 +1,114 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+)
+
+// testPagination covers cursor paging: page boundaries, the last page, stable
+// ordering with ties and rejecting bad cursors
+func testPagination(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	var pets []string
+	for range 5 {
+		pets = append(pets, newPet(t, db, owner.ID, "Pet").ID)
+	}
+	listPets := func(page store.Page) ([]store.Pet, string, error) {
+		return db.GetPetsByUserID(ctx, owner.ID, page)
+	}
+
+	pages := walk(t, "GetPetsByUserID", 2, petID, listPets)
+	if len(pages) != 3 || len(pages[2]) != 1 {
+		t.Errorf("GetPetsByUserID: expected pages of 2, 2 and 1 pets, got %v", pages)
+	}
+	if got := flatten(pages); !sameIDs(got, pets) {
+		t.Errorf("GetPetsByUserID: expected %v across pages, got %v", pets, got)
+	}
+
+	// A page that ends exactly at the last row has no next cursor
+	pages = walk(t, "GetPetsByUserID", 5, petID, listPets)
+	if len(pages) != 1 {
+		t.Errorf("GetPetsByUserID: expected one full page, got %d pages", len(pages))
+	}
+
+	// Ties on price fall back to creation order and never repeat or skip rows
+	vet := newVet(t, db)
+	cheap := newProduct(t, db, vet.ID, "food", 5, 1)
+	mid1 := newProduct(t, db, vet.ID, "food", 10, 1)
+	mid2 := newProduct(t, db, vet.ID, "food", 10, 1)
+	dear := newProduct(t, db, vet.ID, "food", 20, 1)
+	filters := store.ProductFilters{VeterinarianID: vet.ID, Sort: store.ProductSortPriceDesc}
+	var cursors []string
+	pages = walk(t, "ListProducts", 1, productID, func(page store.Page) ([]store.Product, string, error) {
+		result, err := db.ListProducts(ctx, filters, page)
+		if err != nil {
+			return nil, "", err
+		}
+		if result.Total != 4 {
+			t.Errorf("ListProducts: expected total 4 on every page, got %d", result.Total)
+		}
+		cursors = append(cursors, result.NextCursor)
+		return result.Products, result.NextCursor, nil
+	})
+	if want := []string{dear.ID, mid1.ID, mid2.ID, cheap.ID}; !sameIDs(flatten(pages), want) {
+		t.Errorf("ListProducts(price_desc): expected %v across pages, got %v", want, flatten(pages))
+	}
+
+	// Cursors are only valid for the list order that issued them
+	filters.Sort = store.ProductSortName
+	_, err := db.ListProducts(ctx, filters, store.Page{Cursor: cursors[0]})
+	expectInvalidCursor(t, "ListProducts with a cursor from another sort", err)
+	_, _, err = db.GetPetsByUserID(ctx, owner.ID, store.Page{Cursor: "not a cursor"})
+	expectInvalidCursor(t, "GetPetsByUserID", err)
+	_, _, err = db.GetOrdersByClientID(ctx, owner.ID, store.Page{Cursor: cursors[0]})
+	expectInvalidCursor(t, "GetOrdersByClientID with a product cursor", err)
+}
+
+// walk follows next cursors from the first page to the last and returns the
+// IDs on each page
+func walk[T any](
+	t *testing.T,
+	name string,
+	limit int,
+	id func(T) string,
+	list func(store.Page) ([]T, string, error),
+) [][]string {
+	t.Helper()
+	var pages [][]string
+	page := store.Page{Limit: limit}
+	for {
+		items, next, err := list(page)
+		must(t, name, err)
+		if len(items) > limit {
+			t.Fatalf("%s: expected at most %d items, got %d", name, limit, len(items))
+		}
+		pages = append(pages, ids(items, id))
+		if next == "" {
+			return pages
+		}
+		if len(pages) > 1000 {
+			t.Fatalf("%s: cursor never reached the last page", name)
+		}
+		page.Cursor = next
+	}
+}
+
+// flatten joins pages of IDs in order
+func flatten(pages [][]string) []string {
+	var out []string
+	for _, p := range pages {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// expectInvalidCursor fails the test unless err wraps store.ErrInvalidCursor
+func expectInvalidCursor(t *testing.T, op string, err error) {
+	t.Helper()
+	if !errors.Is(err, store.ErrInvalidCursor) {
+		t.Errorf("%s: expected ErrInvalidCursor, got %v", op, err)
+	}
+}
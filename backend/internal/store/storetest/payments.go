@@ -0,0 +1,121 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// testPayments covers payment attempts: each is recorded against an order,
+// found by its gateway intent, and moves together with the order's payment
+// status through pending, paid or failed, and refunded
+func testPayments(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	product := newProduct(t, db, vet.ID, "food", 10, 5)
+	order := store.NewOrder(client.ID, vet.ID, store.Money{})
+	must(t, "PlaceOrder", db.PlaceOrder(ctx, order,
+		[]store.OrderItem{*store.NewOrderItem("", product.ID, 2, store.Money{})}))
+
+	must(t, "UpdateOrderPaymentStatus", db.UpdateOrderPaymentStatus(ctx, order.ID, store.PaymentFailed))
+	got, err := db.GetOrderByID(ctx, order.ID)
+	must(t, "GetOrderByID", err)
+	if got.PaymentStatus != store.PaymentFailed {
+		t.Errorf("UpdateOrderPaymentStatus: expected failed, got %q", got.PaymentStatus)
+	}
+	expectNotFound(t, "UpdateOrderPaymentStatus",
+		db.UpdateOrderPaymentStatus(ctx, missingID(), store.PaymentPaid))
+
+	declined := store.NewPayment(order.ID, "test", "pi_declined", order.TotalAmount)
+	must(t, "CreatePayment", db.CreatePayment(ctx, declined))
+	racing := store.NewPayment(order.ID, "test", "pi_racing", order.TotalAmount)
+	if err := db.CreatePayment(ctx, racing); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreatePayment with one pending: expected ErrConflict, got %v", err)
+	}
+	failed, err := db.SetPaymentStatus(ctx, declined.ID, store.PaymentFailed, "card_declined")
+	must(t, "SetPaymentStatus(failed)", err)
+	if failed.Status != store.PaymentFailed || failed.FailureReason != "card_declined" {
+		t.Errorf("SetPaymentStatus: unexpected payment %+v", failed)
+	}
+	_, err = db.SetPaymentStatus(ctx, declined.ID, store.PaymentPaid, "")
+	if !errors.Is(err, store.ErrPaymentTransition) {
+		t.Errorf("SetPaymentStatus from failed: expected ErrPaymentTransition, got %v", err)
+	}
+
+	paid := store.NewPayment(order.ID, "test", "pi_paid", order.TotalAmount)
+	paid.CreatedAt = declined.CreatedAt.Add(time.Millisecond)
+	must(t, "CreatePayment(second)", db.CreatePayment(ctx, paid))
+	duplicate := store.NewPayment(order.ID, "test", "pi_paid", order.TotalAmount)
+	duplicate.Status = store.PaymentFailed
+	if err := db.CreatePayment(ctx, duplicate); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreatePayment with a used intent: expected ErrConflict, got %v", err)
+	}
+	expectNotFound(t, "CreatePayment for missing order",
+		db.CreatePayment(ctx, store.NewPayment(missingID(), "test", "pi_orphan", usd(1))))
+
+	byIntent, err := db.GetPaymentByIntentID(ctx, "test", "pi_paid")
+	must(t, "GetPaymentByIntentID", err)
+	if byIntent.ID != paid.ID || byIntent.Status != store.PaymentPending || byIntent.Amount != usd(20) {
+		t.Errorf("GetPaymentByIntentID: unexpected payment %+v", byIntent)
+	}
+	_, err = db.GetPaymentByIntentID(ctx, "other", "pi_paid")
+	expectNotFound(t, "GetPaymentByIntentID with another provider", err)
+
+	_, err = db.SetPaymentStatus(ctx, paid.ID, store.PaymentPaid, "")
+	must(t, "SetPaymentStatus(paid)", err)
+	got, err = db.GetOrderByID(ctx, order.ID)
+	must(t, "GetOrderByID(paid)", err)
+	if got.PaymentStatus != store.PaymentPaid {
+		t.Errorf("SetPaymentStatus: expected the order paid, got %q", got.PaymentStatus)
+	}
+	if _, err := db.SetPaymentStatus(ctx, paid.ID, store.PaymentPaid, ""); !errors.Is(err, store.ErrPaymentTransition) {
+		t.Errorf("SetPaymentStatus twice: expected ErrPaymentTransition, got %v", err)
+	}
+	if _, err := db.SetPaymentStatus(ctx, paid.ID, store.PaymentRefunded, ""); !errors.Is(err, store.ErrPaymentTransition) {
+		t.Errorf("SetPaymentStatus(refunded): expected ErrPaymentTransition, got %v", err)
+	}
+
+	partial, err := db.RecordPaymentRefund(ctx, paid.ID, usd(5))
+	must(t, "RecordPaymentRefund(partial)", err)
+	if partial.Status != store.PaymentPartiallyRefunded || partial.RefundedAmount != usd(5) {
+		t.Errorf("RecordPaymentRefund: unexpected payment %+v", partial)
+	}
+	got, err = db.GetOrderByID(ctx, order.ID)
+	must(t, "GetOrderByID(partially refunded)", err)
+	if got.PaymentStatus != store.PaymentPartiallyRefunded {
+		t.Errorf("RecordPaymentRefund: expected the order partially refunded, got %q", got.PaymentStatus)
+	}
+	if _, err := db.RecordPaymentRefund(ctx, paid.ID, usd(5)); !errors.Is(err, store.ErrPaymentTransition) {
+		t.Errorf("RecordPaymentRefund replayed: expected ErrPaymentTransition, got %v", err)
+	}
+	if _, err := db.RecordPaymentRefund(ctx, paid.ID, usd(25)); !errors.Is(err, store.ErrInvalidPayment) {
+		t.Errorf("RecordPaymentRefund beyond the payment: expected ErrInvalidPayment, got %v", err)
+	}
+	if _, err := db.RecordPaymentRefund(ctx, declined.ID, usd(5)); !errors.Is(err, store.ErrPaymentTransition) {
+		t.Errorf("RecordPaymentRefund of a failed payment: expected ErrPaymentTransition, got %v", err)
+	}
+
+	refunded, err := db.RecordPaymentRefund(ctx, paid.ID, usd(20))
+	must(t, "RecordPaymentRefund(rest)", err)
+	if refunded.Status != store.PaymentRefunded || refunded.RefundedAmount != usd(20) {
+		t.Errorf("RecordPaymentRefund: unexpected payment %+v", refunded)
+	}
+	got, err = db.GetOrderByID(ctx, order.ID)
+	must(t, "GetOrderByID(refunded)", err)
+	if got.PaymentStatus != store.PaymentRefunded {
+		t.Errorf("RecordPaymentRefund: expected the order refunded, got %q", got.PaymentStatus)
+	}
+	_, err = db.RecordPaymentRefund(ctx, missingID(), usd(1))
+	expectNotFound(t, "RecordPaymentRefund", err)
+	_, err = db.SetPaymentStatus(ctx, missingID(), store.PaymentPaid, "")
+	expectNotFound(t, "SetPaymentStatus", err)
+
+	attempts, err := db.GetOrderPayments(ctx, order.ID)
+	must(t, "GetOrderPayments", err)
+	if len(attempts) != 2 || attempts[0].ID != declined.ID || attempts[1].Status != store.PaymentRefunded {
+		t.Errorf("GetOrderPayments: expected both attempts oldest first, got %+v", attempts)
+	}
+}
@@ -0,0 +1,156 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPetAccess covers granting, listing and revoking access to a pet
+func testPetAccess(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	sitter := newClient(t, db)
+	partner := newClient(t, db)
+	pet := newPet(t, db, owner.ID, "Biscuit")
+	other := newPet(t, db, partner.ID, "Pepper")
+
+	found, err := db.GetClientByEmail(ctx, sitter.Email)
+	must(t, "GetClientByEmail", err)
+	if found.ID != sitter.ID {
+		t.Errorf("GetClientByEmail: expected %s, got %s", sitter.ID, found.ID)
+	}
+	found, err = db.GetClientByEmail(ctx, strings.ToUpper(sitter.Email))
+	must(t, "GetClientByEmail(upper case)", err)
+	if found.ID != sitter.ID {
+		t.Errorf("GetClientByEmail(upper case): expected %s, got %s", sitter.ID, found.ID)
+	}
+	_, err = db.GetClientByEmail(ctx, missingID()+"@client.example.com")
+	expectNotFound(t, "GetClientByEmail(missing)", err)
+
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Microsecond)
+	caretaker := store.NewPetAccessGrant(pet.ID, owner.ID, sitter, store.PetAccessCaretaker,
+		store.DefaultPetAccessPermissions(store.PetAccessCaretaker), &expires, owner.ID)
+	must(t, "CreatePetAccessGrant(caretaker)", db.CreatePetAccessGrant(ctx, caretaker))
+	coOwner := store.NewPetAccessGrant(pet.ID, owner.ID, partner, store.PetAccessCoOwner,
+		store.DefaultPetAccessPermissions(store.PetAccessCoOwner), nil, owner.ID)
+	must(t, "CreatePetAccessGrant(co-owner)", db.CreatePetAccessGrant(ctx, coOwner))
+	elsewhere := store.NewPetAccessGrant(other.ID, partner.ID, sitter, store.PetAccessCaretaker,
+		[]string{store.PermissionViewRecords}, nil, partner.ID)
+	must(t, "CreatePetAccessGrant(other pet)", db.CreatePetAccessGrant(ctx, elsewhere))
+
+	got, err := db.GetPetAccessGrantByID(ctx, caretaker.ID)
+	must(t, "GetPetAccessGrantByID", err)
+	if got.GranteeID != sitter.ID || got.GranteeEmail != sitter.Email || got.Role != store.PetAccessCaretaker ||
+		got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) || got.RevokedAt != nil ||
+		!sameIDs(got.Permissions, caretaker.Permissions) {
+		t.Errorf("GetPetAccessGrantByID: unexpected grant %+v", got)
+	}
+	if !got.Allows(store.PermissionBookAppointments, time.Now()) ||
+		got.Allows(store.PermissionOrder, time.Now()) || got.Active(expires) {
+		t.Errorf("GetPetAccessGrantByID: unexpected permissions on %+v", got)
+	}
+	_, err = db.GetPetAccessGrantByID(ctx, missingID())
+	expectNotFound(t, "GetPetAccessGrantByID(missing)", err)
+
+	grants, err := db.GetPetAccessGrants(ctx, pet.ID)
+	must(t, "GetPetAccessGrants", err)
+	if want := []string{caretaker.ID, coOwner.ID}; !sameIDs(ids(grants, grantID), want) {
+		t.Errorf("GetPetAccessGrants: expected %v, got %v", want, ids(grants, grantID))
+	}
+	grants, err = db.GetGranteePetAccessGrants(ctx, sitter.ID)
+	must(t, "GetGranteePetAccessGrants", err)
+	if want := []string{caretaker.ID, elsewhere.ID}; !sameIDs(ids(grants, grantID), want) {
+		t.Errorf("GetGranteePetAccessGrants: expected %v, got %v", want, ids(grants, grantID))
+	}
+
+	// One unrevoked grant per client and pet
+	again := store.NewPetAccessGrant(pet.ID, owner.ID, sitter, store.PetAccessCoOwner,
+		[]string{store.PermissionOrder}, nil, owner.ID)
+	if err := db.CreatePetAccessGrant(ctx, again); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreatePetAccessGrant(second grant): expected ErrConflict, got %v", err)
+	}
+
+	// Grants are checked before they are stored
+	invalid := []*store.PetAccessGrant{
+		store.NewPetAccessGrant(pet.ID, owner.ID, owner, store.PetAccessCoOwner,
+			[]string{store.PermissionOrder}, nil, owner.ID),
+		store.NewPetAccessGrant(pet.ID, owner.ID, sitter, "dog_walker",
+			[]string{store.PermissionOrder}, nil, owner.ID),
+		store.NewPetAccessGrant(pet.ID, owner.ID, sitter, store.PetAccessCaretaker,
+			[]string{store.PermissionManagePet}, nil, owner.ID),
+		store.NewPetAccessGrant(pet.ID, owner.ID, sitter, store.PetAccessCaretaker,
+			nil, nil, owner.ID),
+	}
+	for i, g := range invalid {
+		if err := db.CreatePetAccessGrant(ctx, g); !errors.Is(err, store.ErrInvalidPetAccess) {
+			t.Errorf("CreatePetAccessGrant(invalid %d): expected ErrInvalidPetAccess, got %v", i, err)
+		}
+	}
+	stray := store.NewPetAccessGrant(missingID(), owner.ID, sitter, store.PetAccessCaretaker,
+		[]string{store.PermissionViewRecords}, nil, owner.ID)
+	expectNotFound(t, "CreatePetAccessGrant(missing pet)", db.CreatePetAccessGrant(ctx, stray))
+
+	// Revoked grants are kept and free the client for a new one
+	revokedAt := time.Now().Truncate(time.Microsecond)
+	must(t, "RevokePetAccessGrant", db.RevokePetAccessGrant(ctx, caretaker.ID, revokedAt))
+	expectNotFound(t, "RevokePetAccessGrant(twice)", db.RevokePetAccessGrant(ctx, caretaker.ID, revokedAt))
+	expectNotFound(t, "RevokePetAccessGrant(missing)", db.RevokePetAccessGrant(ctx, missingID(), revokedAt))
+	got, err = db.GetPetAccessGrantByID(ctx, caretaker.ID)
+	must(t, "GetPetAccessGrantByID(revoked)", err)
+	if got.RevokedAt == nil || !got.RevokedAt.Equal(revokedAt) || got.Active(time.Now()) {
+		t.Errorf("GetPetAccessGrantByID(revoked): expected a revoked grant, got %+v", got)
+	}
+	must(t, "CreatePetAccessGrant(after revoking)", db.CreatePetAccessGrant(ctx, again))
+	grants, err = db.GetPetAccessGrants(ctx, pet.ID)
+	must(t, "GetPetAccessGrants(after revoking)", err)
+	if want := []string{caretaker.ID, coOwner.ID, again.ID}; !sameIDs(ids(grants, grantID), want) {
+		t.Errorf("GetPetAccessGrants(after revoking): expected %v, got %v", want, ids(grants, grantID))
+	}
+
+	// Invitations wait for a client with their email, who claims them unless
+	// they already hold a grant for the pet
+	email := missingID() + "@client.example.com"
+	invite := func(petID, ownerID string) *store.PetAccessGrant {
+		return store.NewPetAccessGrant(petID, ownerID, &store.Client{Email: email},
+			store.PetAccessCaretaker, []string{store.PermissionViewRecords}, nil, ownerID)
+	}
+	invitation := invite(pet.ID, owner.ID)
+	must(t, "CreatePetAccessGrant(invitation)", db.CreatePetAccessGrant(ctx, invitation))
+	if err := db.CreatePetAccessGrant(ctx, invite(pet.ID, owner.ID)); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreatePetAccessGrant(second invitation): expected ErrConflict, got %v", err)
+	}
+	shouted := invite(pet.ID, owner.ID)
+	shouted.GranteeEmail = strings.ToUpper(email)
+	if err := db.CreatePetAccessGrant(ctx, shouted); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreatePetAccessGrant(invitation in upper case): expected ErrConflict, got %v", err)
+	}
+	skipped := invite(other.ID, partner.ID)
+	must(t, "CreatePetAccessGrant(invitation to other pet)", db.CreatePetAccessGrant(ctx, skipped))
+	got, err = db.GetPetAccessGrantByID(ctx, invitation.ID)
+	must(t, "GetPetAccessGrantByID(invitation)", err)
+	if !got.Invitation() || got.GranteeEmail != email {
+		t.Errorf("GetPetAccessGrantByID(invitation): expected an invitation to %s, got %+v", email, got)
+	}
+
+	newcomer := &store.Client{ID: missingID(), Name: "Newcomer", Email: email}
+	must(t, "CreateClient(newcomer)", db.CreateClient(ctx, newcomer))
+	held := store.NewPetAccessGrant(other.ID, partner.ID, newcomer, store.PetAccessCaretaker,
+		[]string{store.PermissionViewRecords}, nil, partner.ID)
+	must(t, "CreatePetAccessGrant(held)", db.CreatePetAccessGrant(ctx, held))
+	must(t, "ClaimPetAccessInvitations",
+		db.ClaimPetAccessInvitations(ctx, newcomer.ID, strings.ToUpper(email)))
+	grants, err = db.GetGranteePetAccessGrants(ctx, newcomer.ID)
+	must(t, "GetGranteePetAccessGrants(newcomer)", err)
+	if want := []string{invitation.ID, held.ID}; !sameIDs(ids(grants, grantID), want) {
+		t.Errorf("ClaimPetAccessInvitations: expected %v, got %v", want, ids(grants, grantID))
+	}
+	got, err = db.GetPetAccessGrantByID(ctx, skipped.ID)
+	must(t, "GetPetAccessGrantByID(skipped)", err)
+	if !got.Invitation() {
+		t.Errorf("ClaimPetAccessInvitations: claimed an invitation for a pet already held, got %+v", got)
+	}
+}
@@ -0,0 +1,190 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testPets covers pet CRUD, owner scoping and cascading deletes
+func testPets(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	other := newClient(t, db)
+
+	buddy := newPet(t, db, owner.ID, "Buddy")
+	rex := newPet(t, db, owner.ID, "Rex")
+	newPet(t, db, other.ID, "Stranger")
+
+	got, err := db.GetPetByID(ctx, buddy.ID)
+	must(t, "GetPetByID", err)
+	if got.Name != "Buddy" || got.OwnerID != owner.ID || got.DateOfBirth != "2020-05-17" || got.Weight != 12.5 {
+		t.Errorf("GetPetByID: unexpected pet %+v", got)
+	}
+
+	pets, _, err := db.GetPetsByUserID(ctx, owner.ID, store.Page{})
+	must(t, "GetPetsByUserID", err)
+	if want := []string{buddy.ID, rex.ID}; !sameIDs(ids(pets, petID), want) {
+		t.Errorf("GetPetsByUserID: expected %v in creation order, got %v", want, ids(pets, petID))
+	}
+
+	none, _, err := db.GetPetsByUserID(ctx, missingID(), store.Page{})
+	must(t, "GetPetsByUserID(missing)", err)
+	if len(none) != 0 {
+		t.Errorf("GetPetsByUserID(missing): expected no pets, got %d", len(none))
+	}
+
+	orphan := store.NewPet(missingID(), "Orphan", "Cat", "", time.Now(), 3)
+	expectNotFound(t, "CreatePet with missing owner", db.CreatePet(ctx, orphan))
+
+	buddy.Name = "Buddy II"
+	buddy.UpdatedAt = time.Now()
+	must(t, "UpdatePet", db.UpdatePet(ctx, buddy))
+	got, err = db.GetPetByID(ctx, buddy.ID)
+	must(t, "GetPetByID after update", err)
+	if got.Name != "Buddy II" {
+		t.Errorf("UpdatePet: expected name to change, got %q", got.Name)
+	}
+
+	missing := *buddy
+	missing.ID = missingID()
+	expectNotFound(t, "UpdatePet", db.UpdatePet(ctx, &missing))
+
+	_, err = db.GetPetByID(ctx, missingID())
+	expectNotFound(t, "GetPetByID", err)
+
+	// Deleting a pet removes its medical records
+	vet := newVet(t, db)
+	record := store.NewMedicalRecord(rex.ID, vet.ID, "Checkup", "", time.Now(), nil, "", nil)
+	must(t, "CreateMedicalRecord", db.CreateMedicalRecord(ctx, record))
+
+	must(t, "DeletePet", db.DeletePet(ctx, rex.ID))
+	_, err = db.GetPetByID(ctx, rex.ID)
+	expectNotFound(t, "GetPetByID after delete", err)
+	_, err = db.GetMedicalRecordByID(ctx, record.ID)
+	expectNotFound(t, "GetMedicalRecordByID after pet delete", err)
+
+	must(t, "DeletePet(missing)", db.DeletePet(ctx, missingID()))
+}
+
+// testMedicalRecords covers medical record CRUD
+func testMedicalRecords(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	vet := newVet(t, db)
+	pet := newPet(t, db, owner.ID, "Milo")
+
+	visit := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	first := store.NewMedicalRecord(pet.ID, vet.ID, "Vaccination", "Healthy", visit,
+		[]string{"Rabies vaccine"}, "", nil)
+	second := store.NewMedicalRecord(pet.ID, vet.ID, "Limping", "Sprain", visit.Add(24*time.Hour),
+		nil, "Rest for a week", nil)
+	must(t, "CreateMedicalRecord", db.CreateMedicalRecord(ctx, first))
+	must(t, "CreateMedicalRecord", db.CreateMedicalRecord(ctx, second))
+
+	got, err := db.GetMedicalRecordByID(ctx, first.ID)
+	must(t, "GetMedicalRecordByID", err)
+	if got.ReasonForVisit != "Vaccination" || got.VeterinarianID != vet.ID {
+		t.Errorf("GetMedicalRecordByID: unexpected record %+v", got)
+	}
+	if len(got.MedicationPrescribed) != 1 || got.MedicationPrescribed[0] != "Rabies vaccine" {
+		t.Errorf("GetMedicalRecordByID: medication not stored, got %v", got.MedicationPrescribed)
+	}
+	if !got.DateOfVisit.Equal(visit) {
+		t.Errorf("GetMedicalRecordByID: expected visit %s, got %s", visit, got.DateOfVisit)
+	}
+
+	records, _, err := db.GetMedicalRecordsByPetID(ctx, pet.ID, store.Page{})
+	must(t, "GetMedicalRecordsByPetID", err)
+	if want := []string{first.ID, second.ID}; !sameIDs(ids(records, recordID), want) {
+		t.Errorf("GetMedicalRecordsByPetID: expected %v, got %v", want, ids(records, recordID))
+	}
+
+	missingVet := store.NewMedicalRecord(pet.ID, missingID(), "Checkup", "", visit, nil, "", nil)
+	expectNotFound(t, "CreateMedicalRecord with missing vet", db.CreateMedicalRecord(ctx, missingVet))
+
+	second.Diagnosis = "Healed"
+	second.UpdatedAt = time.Now()
+	must(t, "UpdateMedicalRecord", db.UpdateMedicalRecord(ctx, second))
+	got, err = db.GetMedicalRecordByID(ctx, second.ID)
+	must(t, "GetMedicalRecordByID after update", err)
+	if got.Diagnosis != "Healed" {
+		t.Errorf("UpdateMedicalRecord: expected diagnosis to change, got %q", got.Diagnosis)
+	}
+
+	missing := *second
+	missing.ID = missingID()
+	expectNotFound(t, "UpdateMedicalRecord", db.UpdateMedicalRecord(ctx, &missing))
+
+	must(t, "DeleteMedicalRecord", db.DeleteMedicalRecord(ctx, first.ID))
+	_, err = db.GetMedicalRecordByID(ctx, first.ID)
+	expectNotFound(t, "GetMedicalRecordByID after delete", err)
+}
+
+// testQRCodes covers QR code lookups, the active flag and the public profile
+func testQRCodes(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	vet := newVet(t, db)
+	pet := newPet(t, db, owner.ID, "Luna")
+
+	record := store.NewMedicalRecord(pet.ID, vet.ID, "Allergy test", "Pollen", time.Now(), nil, "", nil)
+	must(t, "CreateMedicalRecord", db.CreateMedicalRecord(ctx, record))
+
+	content := store.EncodedContent{
+		PetName:    pet.Name,
+		PetType:    pet.Type,
+		OwnerName:  owner.Name,
+		OwnerPhone: owner.Phone,
+		OwnerEmail: owner.Email,
+	}
+	url := "contract-" + uuid.NewString()
+	qr := store.NewQRCode(pet.ID, "data", url, content)
+	must(t, "CreateQRCode", db.CreateQRCode(ctx, qr))
+
+	got, err := db.GetQRCodeByPetID(ctx, pet.ID)
+	must(t, "GetQRCodeByPetID", err)
+	if got.ID != qr.ID || got.EncodedContent.PetName != "Luna" {
+		t.Errorf("GetQRCodeByPetID: unexpected qr code %+v", got)
+	}
+	got, err = db.GetQRCodeByPublicURL(ctx, url)
+	must(t, "GetQRCodeByPublicURL", err)
+	if got.ID != qr.ID {
+		t.Errorf("GetQRCodeByPublicURL: expected %s, got %s", qr.ID, got.ID)
+	}
+
+	profile, err := db.GetPublicPetProfile(ctx, url)
+	must(t, "GetPublicPetProfile", err)
+	if profile.PetName != "Luna" || profile.Breed != "Beagle" || profile.OwnerEmail != owner.Email {
+		t.Errorf("GetPublicPetProfile: unexpected profile %+v", profile)
+	}
+	if len(profile.MedicalRecords) != 1 || profile.MedicalRecords[0].Diagnosis != "Pollen" {
+		t.Errorf("GetPublicPetProfile: expected the pet's medical record, got %+v", profile.MedicalRecords)
+	}
+
+	dup := store.NewQRCode(pet.ID, "data", url, content)
+	if err := db.CreateQRCode(ctx, dup); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreateQRCode with duplicate URL: expected ErrConflict, got %v", err)
+	}
+
+	// Inactive codes are invisible to lookups
+	qr.IsActive = false
+	must(t, "UpdateQRCode", db.UpdateQRCode(ctx, qr))
+	_, err = db.GetQRCodeByPetID(ctx, pet.ID)
+	expectNotFound(t, "GetQRCodeByPetID after deactivation", err)
+	_, err = db.GetQRCodeByPublicURL(ctx, url)
+	expectNotFound(t, "GetQRCodeByPublicURL after deactivation", err)
+	_, err = db.GetPublicPetProfile(ctx, url)
+	expectNotFound(t, "GetPublicPetProfile after deactivation", err)
+
+	missing := *qr
+	missing.ID = missingID()
+	missing.PublicURL = "contract-" + uuid.NewString()
+	expectNotFound(t, "UpdateQRCode", db.UpdateQRCode(ctx, &missing))
+
+	must(t, "DeleteQRCode", db.DeleteQRCode(ctx, qr.ID))
+}
@@ -0,0 +1,306 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testProducts covers product CRUD, stock movements and SKU uniqueness
+func testProducts(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	vet := newVet(t, db)
+
+	product := store.NewProduct(vet.ID, "Kibble", "Dry food", "food", usd(24.9))
+	product.SKU = "SKU-" + uuid.NewString()
+	product.Images = []string{"kibble.png"}
+	product.Dimensions = store.ProductDimensions{Length: 30, Width: 20, Height: 10, Unit: "cm"}
+	must(t, "CreateProduct", db.CreateProduct(ctx, product))
+
+	got, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID", err)
+	if got.Name != "Kibble" || got.Price != usd(24.9) || got.SKU != product.SKU || !got.IsActive {
+		t.Errorf("GetProductByID: unexpected product %+v", got)
+	}
+	if len(got.Images) != 1 || got.Dimensions.Unit != "cm" {
+		t.Errorf("GetProductByID: images or dimensions not stored, got %+v", got)
+	}
+
+	dup := store.NewProduct(vet.ID, "Copy", "", "food", usd(1))
+	dup.SKU = product.SKU
+	if err := db.CreateProduct(ctx, dup); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreateProduct with duplicate SKU: expected ErrConflict, got %v", err)
+	}
+
+	orphan := store.NewProduct(missingID(), "Orphan", "", "food", usd(1))
+	expectNotFound(t, "CreateProduct with missing vet", db.CreateProduct(ctx, orphan))
+
+	received := store.NewStockMovement(product.ID, store.StockReceived, 7, vet.ID)
+	must(t, "RecordStockMovement", db.RecordStockMovement(ctx, received))
+	got, err = db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID after stock update", err)
+	if got.StockQuantity != 7 {
+		t.Errorf("RecordStockMovement: expected stock 7, got %d", got.StockQuantity)
+	}
+	expectNotFound(t, "RecordStockMovement", db.RecordStockMovement(ctx,
+		store.NewStockMovement(missingID(), store.StockReceived, 1, vet.ID)))
+
+	got.Price = usd(19.9)
+	must(t, "UpdateProduct", db.UpdateProduct(ctx, got))
+	got, err = db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID after update", err)
+	if got.Price != usd(19.9) {
+		t.Errorf("UpdateProduct: expected price 19.9, got %v", got.Price)
+	}
+
+	missing := *got
+	missing.ID = missingID()
+	missing.SKU = ""
+	expectNotFound(t, "UpdateProduct", db.UpdateProduct(ctx, &missing))
+
+	must(t, "DeleteProduct", db.DeleteProduct(ctx, product.ID))
+	_, err = db.GetProductByID(ctx, product.ID)
+	expectNotFound(t, "GetProductByID after delete", err)
+}
+
+// testProductFilters covers the active flag and the vet and category filters
+func testProductFilters(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	vet := newVet(t, db)
+	otherVet := newVet(t, db)
+
+	food1 := newProduct(t, db, vet.ID, "food", 10, 5)
+	toy := newProduct(t, db, vet.ID, "toys", 5, 5)
+	food2 := newProduct(t, db, vet.ID, "food", 12, 5)
+	newProduct(t, db, otherVet.ID, "food", 8, 5)
+
+	hidden := newProduct(t, db, vet.ID, "food", 9, 5)
+	hidden.IsActive = false
+	must(t, "UpdateProduct", db.UpdateProduct(ctx, hidden))
+
+	byVet, _, err := db.GetProductsByVeterinarianID(ctx, vet.ID, store.Page{})
+	must(t, "GetProductsByVeterinarianID", err)
+	if want := []string{food1.ID, toy.ID, food2.ID}; !sameIDs(ids(byVet, productID), want) {
+		t.Errorf("GetProductsByVeterinarianID: expected %v, got %v", want, ids(byVet, productID))
+	}
+
+	expectProducts(t, db, "vet", store.ProductFilters{VeterinarianID: vet.ID},
+		3, food1.ID, toy.ID, food2.ID)
+	expectProducts(t, db, "vet, food", store.ProductFilters{VeterinarianID: vet.ID, Category: "food"},
+		2, food1.ID, food2.ID)
+}
+
+// testProductSearch covers price range, brand, full-text search and sorting
+func testProductSearch(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	vet := newVet(t, db)
+	tag := uuid.NewString()[:8]
+
+	kibble := store.NewProduct(vet.ID, "Kibble Deluxe "+tag, "Grain free food for adult dogs", "food", usd(30))
+	kibble.Brand = "Acme"
+	kibble.SKU = "KIB-" + tag
+	treats := store.NewProduct(vet.ID, "Chicken Treats", "Crunchy snacks", "food", usd(8))
+	treats.Brand = "acme"
+	leash := store.NewProduct(vet.ID, "Leash", "Nylon leash for large dogs", "accessories", usd(15))
+	leash.Brand = "Other"
+	for _, p := range []*store.Product{kibble, treats, leash} {
+		must(t, "CreateProduct", db.CreateProduct(ctx, p))
+	}
+	scoped := func(f store.ProductFilters) store.ProductFilters {
+		f.VeterinarianID = vet.ID
+		return f
+	}
+
+	expectProducts(t, db, "min price", scoped(store.ProductFilters{MinPrice: usd(10)}),
+		2, kibble.ID, leash.ID)
+	expectProducts(t, db, "max price", scoped(store.ProductFilters{MaxPrice: usd(15)}),
+		2, treats.ID, leash.ID)
+	expectProducts(t, db, "price range", scoped(store.ProductFilters{MinPrice: usd(10), MaxPrice: usd(20)}),
+		1, leash.ID)
+	expectProducts(t, db, "brand is case-insensitive", scoped(store.ProductFilters{Brand: "ACME"}),
+		2, kibble.ID, treats.ID)
+
+	expectProducts(t, db, "search description", scoped(store.ProductFilters{Search: "dogs"}),
+		2, kibble.ID, leash.ID)
+	expectProducts(t, db, "search word prefix", scoped(store.ProductFilters{Search: "kib"}),
+		1, kibble.ID)
+	expectProducts(t, db, "search SKU", scoped(store.ProductFilters{Search: "kib-" + tag}),
+		1, kibble.ID)
+	expectProducts(t, db, "search all terms", scoped(store.ProductFilters{Search: "nylon dogs"}),
+		1, leash.ID)
+	expectProducts(t, db, "search no match", scoped(store.ProductFilters{Search: "parrot"}),
+		0)
+
+	expectProducts(t, db, "sort price asc", scoped(store.ProductFilters{Sort: store.ProductSortPriceAsc}),
+		3, treats.ID, leash.ID, kibble.ID)
+	expectProducts(t, db, "sort price desc", scoped(store.ProductFilters{Sort: store.ProductSortPriceDesc}),
+		3, kibble.ID, leash.ID, treats.ID)
+	expectProducts(t, db, "sort newest", scoped(store.ProductFilters{Sort: store.ProductSortNewest}),
+		3, leash.ID, treats.ID, kibble.ID)
+	expectProducts(t, db, "sort name", scoped(store.ProductFilters{Sort: store.ProductSortName}),
+		3, treats.ID, kibble.ID, leash.ID)
+}
+
+// expectProducts checks one ListProducts call's page and total
+func expectProducts(
+	t *testing.T,
+	db store.Database,
+	name string,
+	filters store.ProductFilters,
+	wantTotal int,
+	wantIDs ...string,
+) {
+	t.Helper()
+	result, err := db.ListProducts(context.Background(), filters, store.Page{})
+	must(t, "ListProducts("+name+")", err)
+	if got := ids(result.Products, productID); !sameIDs(got, wantIDs) {
+		t.Errorf("ListProducts(%s): expected %v, got %v", name, wantIDs, got)
+	}
+	if result.Total != wantTotal {
+		t.Errorf("ListProducts(%s): expected total %d, got %d", name, wantTotal, result.Total)
+	}
+}
+
+// testOrders covers order CRUD, order items and listing by client and vet
+func testOrders(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	product := newProduct(t, db, vet.ID, "food", 10, 5)
+
+	order := store.NewOrder(client.ID, vet.ID, usd(20))
+	must(t, "CreateOrder", db.CreateOrder(ctx, order))
+	item := store.NewOrderItem(order.ID, product.ID, 2, usd(10))
+	must(t, "CreateOrderItem", db.CreateOrderItem(ctx, item))
+
+	got, err := db.GetOrderByID(ctx, order.ID)
+	must(t, "GetOrderByID", err)
+	if got.TotalAmount != usd(20) || got.Status != "pending" || got.ClientID != client.ID {
+		t.Errorf("GetOrderByID: unexpected order %+v", got)
+	}
+
+	items, err := db.GetOrderItems(ctx, order.ID)
+	must(t, "GetOrderItems", err)
+	if len(items) != 1 || items[0].Quantity != 2 || items[0].TotalPrice != usd(20) {
+		t.Errorf("GetOrderItems: unexpected items %+v", items)
+	}
+
+	byClient, _, err := db.GetOrdersByClientID(ctx, client.ID, store.Page{})
+	must(t, "GetOrdersByClientID", err)
+	if want := []string{order.ID}; !sameIDs(ids(byClient, orderID), want) {
+		t.Errorf("GetOrdersByClientID: expected %v, got %v", want, ids(byClient, orderID))
+	}
+	byVet, _, err := db.GetOrdersByVeterinarianID(ctx, vet.ID, store.Page{})
+	must(t, "GetOrdersByVeterinarianID", err)
+	if want := []string{order.ID}; !sameIDs(ids(byVet, orderID), want) {
+		t.Errorf("GetOrdersByVeterinarianID: expected %v, got %v", want, ids(byVet, orderID))
+	}
+
+	confirm := store.NewOrderStatusChange(
+		order.ID, store.OrderPending, store.OrderConfirmed, vet.ID, "")
+	must(t, "TransitionOrder", db.TransitionOrder(ctx, confirm))
+	got, err = db.GetOrderByID(ctx, order.ID)
+	must(t, "GetOrderByID after update", err)
+	if got.Status != store.OrderConfirmed {
+		t.Errorf("TransitionOrder: expected confirmed, got %q", got.Status)
+	}
+
+	missing := store.NewOrderStatusChange(
+		missingID(), store.OrderPending, store.OrderConfirmed, vet.ID, "")
+	expectNotFound(t, "TransitionOrder", db.TransitionOrder(ctx, missing))
+	_, err = db.GetOrderByID(ctx, missingID())
+	expectNotFound(t, "GetOrderByID", err)
+
+	orphan := store.NewOrderItem(missingID(), product.ID, 1, usd(10))
+	expectNotFound(t, "CreateOrderItem with missing order", db.CreateOrderItem(ctx, orphan))
+}
+
+// testPlaceOrder covers atomic placement: pricing, stock decrement and
+// all-or-nothing failure
+func testPlaceOrder(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	otherVet := newVet(t, db)
+	kibble := newProduct(t, db, vet.ID, "food", 12.5, 5)
+	leash := newProduct(t, db, vet.ID, "accessories", 8, 1)
+	foreign := newProduct(t, db, otherVet.ID, "food", 3, 10)
+
+	order := store.NewOrder(client.ID, vet.ID, store.Money{})
+	order.PlacedBy = newClient(t, db).ID
+	items := []store.OrderItem{
+		*store.NewOrderItem("", kibble.ID, 2, store.Money{}),
+		*store.NewOrderItem("", leash.ID, 1, store.Money{}),
+	}
+	must(t, "PlaceOrder", db.PlaceOrder(ctx, order, items))
+
+	if order.TotalAmount != usd(33) {
+		t.Errorf("PlaceOrder: expected total 33, got %v", order.TotalAmount)
+	}
+	if items[0].UnitPrice != usd(12.5) || items[0].TotalPrice != usd(25) || items[0].OrderID != order.ID {
+		t.Errorf("PlaceOrder: item not priced from the product, got %+v", items[0])
+	}
+	placed, err := db.GetOrderByID(ctx, order.ID)
+	must(t, "GetOrderByID", err)
+	if placed.PlacedBy != order.PlacedBy {
+		t.Errorf("PlaceOrder: expected placed_by %q, got %q", order.PlacedBy, placed.PlacedBy)
+	}
+	stored, err := db.GetOrderItems(ctx, order.ID)
+	must(t, "GetOrderItems", err)
+	if len(stored) != 2 {
+		t.Errorf("PlaceOrder: expected 2 stored items, got %d", len(stored))
+	}
+	assertStock(t, db, kibble.ID, 3)
+	assertStock(t, db, leash.ID, 0)
+	movements, _, err := db.ListStockMovements(ctx, kibble.ID, store.Page{Limit: 1})
+	must(t, "ListStockMovements", err)
+	if len(movements) != 1 || movements[0].ActorID != order.PlacedBy {
+		t.Errorf("PlaceOrder: expected the sale credited to %s, got %+v", order.PlacedBy, movements)
+	}
+
+	// Not enough leashes left: nothing is written and no stock moves
+	short := store.NewOrder(client.ID, vet.ID, store.Money{})
+	err = db.PlaceOrder(ctx, short, []store.OrderItem{
+		*store.NewOrderItem("", kibble.ID, 1, store.Money{}),
+		*store.NewOrderItem("", leash.ID, 1, store.Money{}),
+	})
+	var stockErr *store.InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("PlaceOrder with short stock: expected InsufficientStockError, got %v", err)
+	}
+	if stockErr.ProductID != leash.ID || stockErr.Requested != 1 || stockErr.Available != 0 {
+		t.Errorf("PlaceOrder with short stock: unexpected error %+v", stockErr)
+	}
+	_, err = db.GetOrderByID(ctx, short.ID)
+	expectNotFound(t, "GetOrderByID after failed placement", err)
+	assertStock(t, db, kibble.ID, 3)
+
+	mixed := store.NewOrder(client.ID, vet.ID, store.Money{})
+	err = db.PlaceOrder(ctx, mixed, []store.OrderItem{*store.NewOrderItem("", foreign.ID, 1, store.Money{})})
+	if !errors.Is(err, store.ErrInvalidOrder) {
+		t.Errorf("PlaceOrder with another vet's product: expected ErrInvalidOrder, got %v", err)
+	}
+	assertStock(t, db, foreign.ID, 10)
+
+	unknown := store.NewOrder(client.ID, vet.ID, store.Money{})
+	err = db.PlaceOrder(ctx, unknown, []store.OrderItem{*store.NewOrderItem("", missingID(), 1, store.Money{})})
+	expectNotFound(t, "PlaceOrder with missing product", err)
+
+	empty := store.NewOrder(client.ID, vet.ID, store.Money{})
+	if err := db.PlaceOrder(ctx, empty, nil); !errors.Is(err, store.ErrInvalidOrder) {
+		t.Errorf("PlaceOrder without items: expected ErrInvalidOrder, got %v", err)
+	}
+}
+
+// assertStock checks a product's current stock level
+func assertStock(t *testing.T, db store.Database, productID string, want int) {
+	t.Helper()
+	p, err := db.GetProductByID(context.Background(), productID)
+	must(t, "GetProductByID", err)
+	if p.StockQuantity != want {
+		t.Errorf("Product %s: expected stock %d, got %d", productID, want, p.StockQuantity)
+	}
+}
@@ -0,0 +1,235 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testPromotions covers promotions and discount codes: their validation and
+// storage, which orders they apply to, how they stack, their usage caps and
+// that tax is charged on what is left
+func testPromotions(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	food := newProduct(t, db, vet.ID, "Food", 10, 20)
+	toy := newProduct(t, db, vet.ID, "toys", 25, 20)
+
+	// Codes are unique across the database, so each test run makes its own
+	code := func(prefix string) string {
+		return prefix + strings.ToUpper(uuid.NewString()[:8])
+	}
+	create := func(p *store.Promotion) *store.Promotion {
+		t.Helper()
+		must(t, "CreatePromotion", db.CreatePromotion(ctx, p))
+		return p
+	}
+	place := func(clientID, discountCode string, items ...store.OrderItem) (*store.Order, error) {
+		t.Helper()
+		order := store.NewOrder(clientID, vet.ID, store.Money{})
+		order.DiscountCode = discountCode
+		return order, db.PlaceOrder(ctx, order, items)
+	}
+	foodAndToy := func() []store.OrderItem {
+		return []store.OrderItem{
+			*store.NewOrderItem("", food.ID, 2, store.Money{}),
+			*store.NewOrderItem("", toy.ID, 1, store.Money{}),
+		}
+	}
+
+	// Validation
+	later := time.Now().Add(time.Hour)
+	invalid := []func(p *store.Promotion){
+		func(p *store.Promotion) { p.Name = " " },
+		func(p *store.Promotion) { p.Code = "x" },
+		func(p *store.Promotion) { p.Kind = "bogo" },
+		func(p *store.Promotion) { p.PercentBps = 0 },
+		func(p *store.Promotion) { p.PercentBps = 10001 },
+		func(p *store.Promotion) { p.MinSpend = usd(-1) },
+		func(p *store.Promotion) { p.UsageLimit = -1 },
+		func(p *store.Promotion) { p.StartsAt, p.EndsAt = &later, &later },
+	}
+	for i, change := range invalid {
+		p := store.NewPromotion(vet.ID, "Invalid", store.PromotionPercent)
+		p.PercentBps = 1000
+		change(p)
+		if err := db.CreatePromotion(ctx, p); !errors.Is(err, store.ErrInvalidPromotion) {
+			t.Errorf("CreatePromotion(invalid %d): expected ErrInvalidPromotion, got %v", i, err)
+		}
+	}
+	fixed := store.NewPromotion(vet.ID, "No amount", store.PromotionFixed)
+	if err := db.CreatePromotion(ctx, fixed); !errors.Is(err, store.ErrInvalidPromotion) {
+		t.Errorf("CreatePromotion(fixed without amount): expected ErrInvalidPromotion, got %v", err)
+	}
+	orphan := store.NewPromotion(missingID(), "Orphan", store.PromotionPercent)
+	orphan.PercentBps = 1000
+	expectNotFound(t, "CreatePromotion for a missing veterinarian", db.CreatePromotion(ctx, orphan))
+
+	// Storage: codes are matched regardless of case and never shared
+	saving := store.NewPromotion(vet.ID, "Five off", store.PromotionFixed)
+	saving.Code = code("SAVE")
+	saving.Amount = usd(5)
+	saving.MinSpend = usd(30)
+	saving.UsageLimit = 1
+	create(saving)
+	got, err := db.GetPromotionByCode(ctx, strings.ToLower(saving.Code))
+	must(t, "GetPromotionByCode", err)
+	if got.ID != saving.ID || got.Amount != usd(5) || got.MinSpend != usd(30) || got.UsageLimit != 1 {
+		t.Errorf("GetPromotionByCode: expected %+v, got %+v", saving, got)
+	}
+	duplicate := store.NewPromotion("", "Duplicate", store.PromotionPercent)
+	duplicate.PercentBps = 500
+	duplicate.Code = saving.Code
+	if err := db.CreatePromotion(ctx, duplicate); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreatePromotion(duplicate code): expected ErrConflict, got %v", err)
+	}
+	_, err = db.GetPromotionByID(ctx, missingID())
+	expectNotFound(t, "GetPromotionByID", err)
+	_, err = db.GetPromotionByCode(ctx, code("NONE"))
+	expectNotFound(t, "GetPromotionByCode", err)
+
+	// An automatic 10% off food, matched regardless of case
+	tenOff := store.NewPromotion(vet.ID, "Ten off food", store.PromotionPercent)
+	tenOff.PercentBps = 1000
+	tenOff.Categories = []string{"food"}
+	create(tenOff)
+
+	order, err := place(client.ID, "", foodAndToy()...)
+	must(t, "PlaceOrder", err)
+	assertDiscounts(t, db, order.ID, usd(43), store.OrderDiscount{
+		PromotionID: tenOff.ID, Name: tenOff.Name, Amount: usd(2),
+	})
+
+	// The code stacks on top, taking its $5 from what is left, and uses up
+	// its one use; the next order giving it fails without taking stock
+	order, err = place(client.ID, strings.ToLower(saving.Code), foodAndToy()...)
+	must(t, "PlaceOrder", err)
+	assertDiscounts(t, db, order.ID, usd(38),
+		store.OrderDiscount{PromotionID: tenOff.ID, Name: tenOff.Name, Amount: usd(2)},
+		store.OrderDiscount{PromotionID: saving.ID, Code: saving.Code, Name: saving.Name, Amount: usd(5)})
+	if order.DiscountCode != saving.Code {
+		t.Errorf("PlaceOrder: expected discount code %s, got %q", saving.Code, order.DiscountCode)
+	}
+	_, err = place(client.ID, saving.Code, foodAndToy()...)
+	if !errors.Is(err, store.ErrPromotionUnavailable) {
+		t.Errorf("PlaceOrder(used-up code): expected ErrPromotionUnavailable, got %v", err)
+	}
+	assertStock(t, db, food.ID, 16)
+	got, err = db.GetPromotionByID(ctx, saving.ID)
+	must(t, "GetPromotionByID", err)
+	if got.UsageCount != 1 {
+		t.Errorf("GetPromotionByID: expected a usage count of 1, got %d", got.UsageCount)
+	}
+
+	// Updating keeps the usage count; raising the cap lets the code apply
+	// again, but not to an order under its minimum spend
+	saving.UsageLimit = 2
+	saving.Name = "Five dollars off"
+	must(t, "UpdatePromotion", db.UpdatePromotion(ctx, saving))
+	if saving.UsageCount != 1 {
+		t.Errorf("UpdatePromotion: expected the usage count to stay 1, got %d", saving.UsageCount)
+	}
+	order, err = place(client.ID, saving.Code, *store.NewOrderItem("", toy.ID, 1, store.Money{}))
+	must(t, "PlaceOrder", err)
+	assertDiscounts(t, db, order.ID, usd(25))
+
+	// Promotions outside their window, inactive or for a first order the
+	// client already placed do not apply
+	tomorrow := time.Now().Add(24 * time.Hour)
+	for _, change := range []func(p *store.Promotion){
+		func(p *store.Promotion) { p.StartsAt = &tomorrow },
+		func(p *store.Promotion) { p.Active = false },
+		func(p *store.Promotion) { p.FirstOrderOnly = true },
+	} {
+		p := store.NewPromotion(vet.ID, "Not applied", store.PromotionFixed)
+		p.Amount = usd(1)
+		change(p)
+		create(p)
+	}
+	order, err = place(client.ID, "", *store.NewOrderItem("", toy.ID, 1, store.Money{}))
+	must(t, "PlaceOrder", err)
+	assertDiscounts(t, db, order.ID, usd(25))
+
+	// A new client gets the first-order promotion once
+	newcomer := newClient(t, db)
+	first, err := place(newcomer.ID, "", *store.NewOrderItem("", toy.ID, 1, store.Money{}))
+	must(t, "PlaceOrder", err)
+	if first.DiscountAmount != usd(1) || first.TotalAmount != usd(24) {
+		t.Errorf("PlaceOrder(first order): expected $1 off to $24, got %v off to %v",
+			first.DiscountAmount, first.TotalAmount)
+	}
+	second, err := place(newcomer.ID, "", *store.NewOrderItem("", toy.ID, 1, store.Money{}))
+	must(t, "PlaceOrder", err)
+	assertDiscounts(t, db, second.ID, usd(25))
+
+	// A used-up automatic promotion is skipped, not an error
+	once := store.NewPromotion(vet.ID, "Once", store.PromotionFixed)
+	once.Amount = usd(3)
+	once.ProductIDs = []string{toy.ID}
+	once.UsageLimit = 1
+	create(once)
+	order, err = place(client.ID, "", *store.NewOrderItem("", toy.ID, 1, store.Money{}))
+	must(t, "PlaceOrder", err)
+	assertDiscounts(t, db, order.ID, usd(22),
+		store.OrderDiscount{PromotionID: once.ID, Name: once.Name, Amount: usd(3)})
+	order, err = place(client.ID, "", *store.NewOrderItem("", toy.ID, 1, store.Money{}))
+	must(t, "PlaceOrder", err)
+	assertDiscounts(t, db, order.ID, usd(25))
+
+	// Tax is charged on the discounted price
+	must(t, "SetTaxSettings", db.SetTaxSettings(ctx, store.NewTaxSettings(vet.ID, false, []store.TaxRate{
+		{Name: "GST", RateBps: 1000},
+	})))
+	order, err = place(client.ID, "", *store.NewOrderItem("", food.ID, 1, store.Money{}))
+	must(t, "PlaceOrder", err)
+	assertTax(t, db, order.ID, false, []store.TaxLine{
+		{Name: "GST", RateBps: 1000, Taxable: usd(9), Amount: usd(0.90)},
+	}, usd(0.90), usd(9.90))
+
+	// Listing and deleting
+	list, _, err := db.ListPromotions(ctx, vet.ID, store.Page{Limit: store.MaxPageLimit})
+	must(t, "ListPromotions", err)
+	if len(list) != 6 {
+		t.Errorf("ListPromotions: expected the veterinarian's 6 promotions, got %d", len(list))
+	}
+	must(t, "DeletePromotion", db.DeletePromotion(ctx, tenOff.ID))
+	_, err = db.GetPromotionByID(ctx, tenOff.ID)
+	expectNotFound(t, "GetPromotionByID after delete", err)
+	expectNotFound(t, "DeletePromotion", db.DeletePromotion(ctx, tenOff.ID))
+	expectNotFound(t, "UpdatePromotion", db.UpdatePromotion(ctx, tenOff))
+}
+
+// assertDiscounts checks the discounts a stored order got and its total
+func assertDiscounts(
+	t *testing.T,
+	db store.Database,
+	orderID string,
+	total store.Money,
+	discounts ...store.OrderDiscount,
+) {
+	t.Helper()
+	order, err := db.GetOrderByID(context.Background(), orderID)
+	must(t, "GetOrderByID", err)
+	var amount int64
+	for _, d := range discounts {
+		amount += d.Amount.Amount
+	}
+	if order.DiscountAmount != store.NewMoney(amount, "USD") || order.TotalAmount != total {
+		t.Errorf("order %s: expected %d cents off to %v, got %v off to %v",
+			orderID, amount, total, order.DiscountAmount, order.TotalAmount)
+	}
+	if len(order.Discounts) != len(discounts) {
+		t.Fatalf("order %s: expected discounts %+v, got %+v", orderID, discounts, order.Discounts)
+	}
+	for i := range discounts {
+		if order.Discounts[i] != discounts[i] {
+			t.Errorf("order %s: expected discount %+v, got %+v", orderID, discounts[i], order.Discounts[i])
+		}
+	}
+}
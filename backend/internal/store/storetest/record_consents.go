@@ -0,0 +1,101 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// testRecordConsents covers owner grants, break-glass access and the
+// appointments that let veterinarians see a pet's records
+func testRecordConsents(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	vet := newVet(t, db)
+	otherVet := newVet(t, db)
+	pet := newPet(t, db, owner.ID, "Mochi")
+
+	// Appointments count once they have taken place, until they are older
+	// than the window or cancelled
+	at := time.Date(2024, 7, 1, 9, 0, 0, 0, clinicZone)
+	before, after := at.Add(-time.Hour), at.Add(time.Hour)
+	seen, err := db.HasPetAppointment(ctx, pet.ID, vet.ID, before, after)
+	must(t, "HasPetAppointment(none)", err)
+	if seen {
+		t.Errorf("HasPetAppointment(none): expected false")
+	}
+	appt := store.NewAppointment(owner.ID, vet.ID, pet.ID, at, 30, "Vaccination")
+	must(t, "CreateAppointment", db.CreateAppointment(ctx, appt))
+	seen, err = db.HasPetAppointment(ctx, pet.ID, vet.ID, before.Add(-24*time.Hour), before)
+	must(t, "HasPetAppointment(booked)", err)
+	if seen {
+		t.Errorf("HasPetAppointment(booked): expected false before the appointment")
+	}
+	seen, err = db.HasPetAppointment(ctx, pet.ID, vet.ID, before, after)
+	must(t, "HasPetAppointment", err)
+	if !seen {
+		t.Errorf("HasPetAppointment: expected true once the appointment started")
+	}
+	if seen, _ := db.HasPetAppointment(ctx, pet.ID, vet.ID, after, after.Add(24*time.Hour)); seen {
+		t.Errorf("HasPetAppointment(before since): expected false")
+	}
+	if seen, _ := db.HasPetAppointment(ctx, pet.ID, otherVet.ID, before, after); seen {
+		t.Errorf("HasPetAppointment(other veterinarian): expected false")
+	}
+	appt.Status = "completed"
+	must(t, "UpdateAppointment", db.UpdateAppointment(ctx, appt))
+	seen, err = db.HasPetAppointment(ctx, pet.ID, vet.ID, before, before)
+	must(t, "HasPetAppointment(completed)", err)
+	if !seen {
+		t.Errorf("HasPetAppointment(completed): expected true")
+	}
+	appt.Status = "cancelled"
+	must(t, "UpdateAppointment(cancelled)", db.UpdateAppointment(ctx, appt))
+	seen, err = db.HasPetAppointment(ctx, pet.ID, vet.ID, before, after)
+	must(t, "HasPetAppointment(cancelled)", err)
+	if seen {
+		t.Errorf("HasPetAppointment(cancelled): expected false")
+	}
+
+	// Owner grants and break-glass access are kept in the order they were made
+	expires := time.Now().Add(48 * time.Hour).Truncate(time.Microsecond)
+	grant := store.NewRecordConsent(pet.ID, owner.ID, otherVet.ID, &expires, owner.ID)
+	must(t, "CreateRecordConsent(grant)", db.CreateRecordConsent(ctx, grant))
+	glass := store.NewBreakGlassAccess(pet.ID, owner.ID, vet.ID, "  Hit by a car, owner unreachable ")
+	must(t, "CreateRecordConsent(break-glass)", db.CreateRecordConsent(ctx, glass))
+
+	got, err := db.GetRecordConsentByID(ctx, glass.ID)
+	must(t, "GetRecordConsentByID", err)
+	if got.Kind != store.ConsentBreakGlass || got.Justification != "Hit by a car, owner unreachable" ||
+		got.VeterinarianID != vet.ID || got.CreatedBy != vet.ID || got.ExpiresAt == nil ||
+		!got.Active(time.Now()) || got.Active(time.Now().Add(store.BreakGlassDuration)) {
+		t.Errorf("GetRecordConsentByID: unexpected break-glass access %+v", got)
+	}
+	_, err = db.GetRecordConsentByID(ctx, missingID())
+	expectNotFound(t, "GetRecordConsentByID(missing)", err)
+
+	consents, err := db.GetPetRecordConsents(ctx, pet.ID)
+	must(t, "GetPetRecordConsents", err)
+	if want := []string{grant.ID, glass.ID}; !sameIDs(ids(consents, consentID), want) {
+		t.Errorf("GetPetRecordConsents: expected %v, got %v", want, ids(consents, consentID))
+	}
+
+	// Break-glass access must be justified
+	unjustified := store.NewBreakGlassAccess(pet.ID, owner.ID, vet.ID, "   ")
+	if err := db.CreateRecordConsent(ctx, unjustified); !errors.Is(err, store.ErrInvalidConsent) {
+		t.Errorf("CreateRecordConsent(unjustified): expected ErrInvalidConsent, got %v", err)
+	}
+	stray := store.NewRecordConsent(pet.ID, owner.ID, missingID(), nil, owner.ID)
+	expectNotFound(t, "CreateRecordConsent(missing veterinarian)", db.CreateRecordConsent(ctx, stray))
+
+	revokedAt := time.Now().Truncate(time.Microsecond)
+	must(t, "RevokeRecordConsent", db.RevokeRecordConsent(ctx, grant.ID, revokedAt))
+	expectNotFound(t, "RevokeRecordConsent(twice)", db.RevokeRecordConsent(ctx, grant.ID, revokedAt))
+	got, err = db.GetRecordConsentByID(ctx, grant.ID)
+	must(t, "GetRecordConsentByID(revoked)", err)
+	if got.RevokedAt == nil || !got.RevokedAt.Equal(revokedAt) || got.Active(time.Now()) {
+		t.Errorf("GetRecordConsentByID(revoked): expected a revoked grant, got %+v", got)
+	}
+}
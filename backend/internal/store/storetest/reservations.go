@@ -0,0 +1,119 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// testReservations covers checkout reservations: while active they hold
+// stock against orders and other reservations, and they give it back when
+// released or expired or hand it to the orders they are confirmed into
+func testReservations(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	other := newClient(t, db)
+	vet := newVet(t, db)
+	food := newProduct(t, db, vet.ID, "food", 10, 5)
+	toy := newProduct(t, db, vet.ID, "toys", 4, 3)
+
+	held := store.NewReservation(client.ID, []store.ReservationItem{
+		{ProductID: food.ID, Quantity: 2},
+		{ProductID: toy.ID, Quantity: 1},
+		{ProductID: food.ID, Quantity: 1},
+	}, time.Hour)
+	must(t, "CreateReservation", db.CreateReservation(ctx, held))
+	got, err := db.GetReservationByID(ctx, held.ID)
+	must(t, "GetReservationByID", err)
+	if got.Status != store.ReservationActive || got.ClientID != client.ID || len(got.Items) != 2 {
+		t.Fatalf("GetReservationByID: unexpected reservation %+v", got)
+	}
+	for _, it := range got.Items {
+		if it.ProductID == food.ID && it.Quantity != 3 {
+			t.Errorf("GetReservationByID: expected duplicate items merged, got %+v", got.Items)
+		}
+	}
+	// Reserving does not move stock, it only makes it unavailable
+	assertStock(t, db, food.ID, 5)
+
+	// Orders and other reservations only see the stock that is left
+	var stockErr *store.InsufficientStockError
+	order := store.NewOrder(other.ID, vet.ID, store.Money{})
+	err = db.PlaceOrder(ctx, order, []store.OrderItem{*store.NewOrderItem("", food.ID, 3, store.Money{})})
+	if !errors.As(err, &stockErr) || stockErr.Available != 2 {
+		t.Fatalf("PlaceOrder over reserved stock: expected InsufficientStockError with 2 available, got %v", err)
+	}
+	greedy := store.NewReservation(other.ID, []store.ReservationItem{{ProductID: food.ID, Quantity: 3}}, time.Hour)
+	if err := db.CreateReservation(ctx, greedy); !errors.As(err, &stockErr) {
+		t.Fatalf("CreateReservation over reserved stock: expected InsufficientStockError, got %v", err)
+	}
+	rival := store.NewReservation(other.ID, []store.ReservationItem{{ProductID: food.ID, Quantity: 2}}, time.Hour)
+	must(t, "CreateReservation(rest)", db.CreateReservation(ctx, rival))
+
+	// Releasing gives the stock back
+	must(t, "ReleaseReservation", db.ReleaseReservation(ctx, rival.ID))
+	got, err = db.GetReservationByID(ctx, rival.ID)
+	must(t, "GetReservationByID(released)", err)
+	if got.Status != store.ReservationReleased {
+		t.Errorf("ReleaseReservation: expected status released, got %q", got.Status)
+	}
+	if err := db.ReleaseReservation(ctx, rival.ID); !errors.Is(err, store.ErrReservationClosed) {
+		t.Errorf("ReleaseReservation twice: expected ErrReservationClosed, got %v", err)
+	}
+
+	// Once the sweeper expires a reservation its stock is free again
+	lapsing := store.NewReservation(other.ID, []store.ReservationItem{{ProductID: food.ID, Quantity: 2}}, time.Minute)
+	must(t, "CreateReservation(lapsing)", db.CreateReservation(ctx, lapsing))
+	expired, err := db.ExpireReservations(ctx, time.Now().Add(2*time.Minute))
+	must(t, "ExpireReservations", err)
+	if expired < 1 {
+		t.Errorf("ExpireReservations: expected at least 1 reservation expired, got %d", expired)
+	}
+	got, err = db.GetReservationByID(ctx, lapsing.ID)
+	must(t, "GetReservationByID(expired)", err)
+	if got.Status != store.ReservationExpired {
+		t.Errorf("ExpireReservations: expected status expired, got %q", got.Status)
+	}
+	if _, err := db.ConfirmReservation(ctx, lapsing.ID, store.NewOrder(other.ID, "", store.Money{})); !errors.Is(err, store.ErrReservationClosed) {
+		t.Errorf("ConfirmReservation(expired): expected ErrReservationClosed, got %v", err)
+	}
+	got, err = db.GetReservationByID(ctx, held.ID)
+	must(t, "GetReservationByID(held)", err)
+	if got.Status != store.ReservationActive {
+		t.Errorf("ExpireReservations: expired a reservation that had not lapsed yet")
+	}
+
+	// Confirming places the order with the reserved items
+	if _, err := db.ConfirmReservation(ctx, held.ID, store.NewOrder(other.ID, "", store.Money{})); !errors.Is(err, store.ErrInvalidOrder) {
+		t.Errorf("ConfirmReservation for another client: expected ErrInvalidOrder, got %v", err)
+	}
+	checkout, err := db.ConfirmReservation(ctx, held.ID, store.NewOrder(client.ID, "", store.Money{}))
+	must(t, "ConfirmReservation", err)
+	if len(checkout.Orders) != 1 || len(checkout.Orders[0].Items) != 2 || checkout.TotalAmount != usd(34) {
+		t.Fatalf("ConfirmReservation: unexpected checkout %+v", checkout)
+	}
+	confirmed := checkout.Orders[0]
+	assertStock(t, db, food.ID, 2)
+	assertStock(t, db, toy.ID, 2)
+	got, err = db.GetReservationByID(ctx, held.ID)
+	must(t, "GetReservationByID(converted)", err)
+	if got.Status != store.ReservationConverted || got.CheckoutID != checkout.ID {
+		t.Errorf("ConfirmReservation: expected converted to checkout %s, got %+v", checkout.ID, got)
+	}
+	movements, _, err := db.ListStockMovements(ctx, food.ID, store.Page{Limit: 1})
+	must(t, "ListStockMovements", err)
+	if len(movements) != 1 || movements[0].Type != store.StockSale || movements[0].OrderID != confirmed.ID {
+		t.Errorf("ConfirmReservation: expected a sale movement for the order, got %+v", movements)
+	}
+	if _, err := db.ConfirmReservation(ctx, held.ID, store.NewOrder(client.ID, "", store.Money{})); !errors.Is(err, store.ErrReservationClosed) {
+		t.Errorf("ConfirmReservation twice: expected ErrReservationClosed, got %v", err)
+	}
+
+	_, err = db.GetReservationByID(ctx, missingID())
+	expectNotFound(t, "GetReservationByID", err)
+	expectNotFound(t, "ReleaseReservation", db.ReleaseReservation(ctx, missingID()))
+	missingProduct := store.NewReservation(client.ID, []store.ReservationItem{{ProductID: missingID(), Quantity: 1}}, time.Hour)
+	expectNotFound(t, "CreateReservation with missing product", db.CreateReservation(ctx, missingProduct))
+}
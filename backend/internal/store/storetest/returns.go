@@ -0,0 +1,153 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// deliverOrder moves a pending order through the lifecycle to delivered
+func deliverOrder(t *testing.T, db store.Database, order *store.Order, actorID string) {
+	t.Helper()
+	from := store.OrderPending
+	at := time.Now()
+	for i, to := range []string{store.OrderConfirmed, store.OrderProcessing, store.OrderDelivered} {
+		change := store.NewOrderStatusChange(order.ID, from, to, actorID, "")
+		change.CreatedAt = at.Add(time.Duration(i) * time.Millisecond)
+		must(t, "TransitionOrder("+to+")", db.TransitionOrder(context.Background(), change))
+		from = to
+	}
+}
+
+// testReturns covers return requests: they are priced from the order, can
+// only take back units that were delivered and not already returned, and
+// approving one restocks the items marked restock
+func testReturns(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	food := newProduct(t, db, vet.ID, "food", 10, 5)
+	toy := newProduct(t, db, vet.ID, "toys", 4, 5)
+	order := store.NewOrder(client.ID, vet.ID, store.Money{})
+	must(t, "PlaceOrder", db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", food.ID, 3, store.Money{}),
+		*store.NewOrderItem("", toy.ID, 2, store.Money{}),
+	}))
+	items, err := db.GetOrderItems(ctx, order.ID)
+	must(t, "GetOrderItems", err)
+	itemFor := map[string]string{}
+	for _, it := range items {
+		itemFor[it.ProductID] = it.ID
+	}
+
+	early := store.NewReturn(order.ID, client.ID, "Changed my mind",
+		[]store.ReturnItem{store.NewReturnItem(itemFor[food.ID], 1)})
+	if err := db.CreateReturn(ctx, early); !errors.Is(err, store.ErrInvalidReturn) {
+		t.Errorf("CreateReturn before delivery: expected ErrInvalidReturn, got %v", err)
+	}
+	deliverOrder(t, db, order, vet.ID)
+
+	tooMany := store.NewReturn(order.ID, client.ID, "Damaged",
+		[]store.ReturnItem{store.NewReturnItem(itemFor[food.ID], 4)})
+	if err := db.CreateReturn(ctx, tooMany); !errors.Is(err, store.ErrInvalidReturn) {
+		t.Errorf("CreateReturn of more than was ordered: expected ErrInvalidReturn, got %v", err)
+	}
+	foreign := store.NewReturn(order.ID, client.ID, "Damaged",
+		[]store.ReturnItem{store.NewReturnItem(missingID(), 1)})
+	if err := db.CreateReturn(ctx, foreign); !errors.Is(err, store.ErrInvalidReturn) {
+		t.Errorf("CreateReturn of another order's item: expected ErrInvalidReturn, got %v", err)
+	}
+	orphan := store.NewReturn(missingID(), client.ID, "Damaged",
+		[]store.ReturnItem{store.NewReturnItem(itemFor[food.ID], 1)})
+	expectNotFound(t, "CreateReturn for a missing order", db.CreateReturn(ctx, orphan))
+
+	ret := store.NewReturn(order.ID, client.ID, "Damaged in transit", []store.ReturnItem{
+		store.NewReturnItem(itemFor[food.ID], 2),
+		store.NewReturnItem(itemFor[toy.ID], 1),
+	})
+	must(t, "CreateReturn", db.CreateReturn(ctx, ret))
+	if ret.RefundAmount != usd(24) || ret.Items[0].ProductID != food.ID ||
+		ret.Items[0].RefundAmount != usd(20) || ret.Items[1].RefundAmount != usd(4) {
+		t.Errorf("CreateReturn: unexpected pricing %+v", ret)
+	}
+	rest := store.NewReturn(order.ID, client.ID, "Damaged",
+		[]store.ReturnItem{store.NewReturnItem(itemFor[food.ID], 2)})
+	if err := db.CreateReturn(ctx, rest); !errors.Is(err, store.ErrInvalidReturn) {
+		t.Errorf("CreateReturn of units already returned: expected ErrInvalidReturn, got %v", err)
+	}
+
+	if _, err := db.MarkReturnRefunded(ctx, ret.ID, ""); !errors.Is(err, store.ErrReturnTransition) {
+		t.Errorf("MarkReturnRefunded before review: expected ErrReturnTransition, got %v", err)
+	}
+	approved, err := db.ReviewReturn(ctx, &store.ReturnReview{
+		ReturnID:     ret.ID,
+		Status:       store.ReturnApproved,
+		ReviewerID:   vet.ID,
+		Note:         "Toy is chewed",
+		Dispositions: map[string]string{ret.Items[1].ID: store.ReturnWriteOff},
+	})
+	must(t, "ReviewReturn", err)
+	if approved.Status != store.ReturnApproved || approved.ReviewerID != vet.ID ||
+		approved.Items[0].Disposition != store.ReturnRestock ||
+		approved.Items[1].Disposition != store.ReturnWriteOff {
+		t.Errorf("ReviewReturn: unexpected return %+v", approved)
+	}
+	_, err = db.ReviewReturn(ctx, &store.ReturnReview{
+		ReturnID: ret.ID, Status: store.ReturnRejected, ReviewerID: vet.ID,
+	})
+	if !errors.Is(err, store.ErrReturnTransition) {
+		t.Errorf("ReviewReturn twice: expected ErrReturnTransition, got %v", err)
+	}
+
+	restocked, err := db.GetProductByID(ctx, food.ID)
+	must(t, "GetProductByID(food)", err)
+	if restocked.StockQuantity != 4 {
+		t.Errorf("ReviewReturn: expected food stock 4 after restocking, got %d", restocked.StockQuantity)
+	}
+	writtenOff, err := db.GetProductByID(ctx, toy.ID)
+	must(t, "GetProductByID(toy)", err)
+	if writtenOff.StockQuantity != 3 {
+		t.Errorf("ReviewReturn: expected toy stock to stay 3, got %d", writtenOff.StockQuantity)
+	}
+	movements, _, err := db.ListStockMovements(ctx, food.ID, store.Page{})
+	must(t, "ListStockMovements", err)
+	if m := movements[0]; m.Type != store.StockReturn || m.Quantity != 2 || m.BalanceAfter != 4 ||
+		m.OrderID != order.ID || m.ActorID != vet.ID {
+		t.Errorf("ReviewReturn: unexpected restock movement %+v", m)
+	}
+
+	rejected := store.NewReturn(order.ID, client.ID, "Wrong size",
+		[]store.ReturnItem{store.NewReturnItem(itemFor[toy.ID], 1)})
+	must(t, "CreateReturn(second)", db.CreateReturn(ctx, rejected))
+	_, err = db.ReviewReturn(ctx, &store.ReturnReview{
+		ReturnID: rejected.ID, Status: store.ReturnRejected, ReviewerID: vet.ID,
+	})
+	must(t, "ReviewReturn(rejected)", err)
+	again := store.NewReturn(order.ID, client.ID, "Wrong size",
+		[]store.ReturnItem{store.NewReturnItem(itemFor[toy.ID], 1)})
+	must(t, "CreateReturn after a rejection", db.CreateReturn(ctx, again))
+
+	refunded, err := db.MarkReturnRefunded(ctx, ret.ID, "")
+	must(t, "MarkReturnRefunded", err)
+	if refunded.Status != store.ReturnRefunded {
+		t.Errorf("MarkReturnRefunded: expected refunded, got %q", refunded.Status)
+	}
+	_, err = db.MarkReturnRefunded(ctx, missingID(), "")
+	expectNotFound(t, "MarkReturnRefunded", err)
+
+	returns, err := db.GetOrderReturns(ctx, order.ID)
+	must(t, "GetOrderReturns", err)
+	if want := []string{ret.ID, rejected.ID, again.ID}; !sameIDs(ids(returns, returnID), want) {
+		t.Errorf("GetOrderReturns: expected %v oldest first, got %v", want, ids(returns, returnID))
+	}
+	got, err := db.GetReturnByID(ctx, ret.ID)
+	must(t, "GetReturnByID", err)
+	if got.Status != store.ReturnRefunded || got.ReviewNote != "Toy is chewed" || len(got.Items) != 2 ||
+		got.Items[1].Disposition != store.ReturnWriteOff || got.RefundAmount != usd(24) {
+		t.Errorf("GetReturnByID: unexpected return %+v", got)
+	}
+	_, err = db.GetReturnByID(ctx, missingID())
+	expectNotFound(t, "GetReturnByID", err)
+}
@@ -0,0 +1,162 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+)
+
+// testStockLedger covers the inventory ledger: every stock change is a
+// movement, stock never goes negative and equals the sum of the movements
+func testStockLedger(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	product := newProduct(t, db, vet.ID, "food", 10, 5)
+
+	received := store.NewStockMovement(product.ID, store.StockReceived, 10, vet.ID)
+	received.Reason = "Delivery 42"
+	must(t, "RecordStockMovement(received)", db.RecordStockMovement(ctx, received))
+	if received.BalanceAfter != 15 {
+		t.Errorf("RecordStockMovement(received): expected balance 15, got %d", received.BalanceAfter)
+	}
+	writeOff := store.NewStockMovement(product.ID, store.StockWriteOff, -3, vet.ID)
+	must(t, "RecordStockMovement(write_off)", db.RecordStockMovement(ctx, writeOff))
+
+	// Taking more than is in stock fails and leaves stock alone
+	tooMany := store.NewStockMovement(product.ID, store.StockWriteOff, -100, vet.ID)
+	var stockErr *store.InsufficientStockError
+	if err := db.RecordStockMovement(ctx, tooMany); !errors.As(err, &stockErr) {
+		t.Fatalf("RecordStockMovement(too many): expected InsufficientStockError, got %v", err)
+	}
+	if stockErr.Requested != 100 || stockErr.Available != 12 {
+		t.Errorf("RecordStockMovement(too many): unexpected error %+v", stockErr)
+	}
+	wrongSign := store.NewStockMovement(product.ID, store.StockReceived, -1, vet.ID)
+	if err := db.RecordStockMovement(ctx, wrongSign); !errors.Is(err, store.ErrInvalidStockMovement) {
+		t.Errorf("RecordStockMovement(wrong sign): expected ErrInvalidStockMovement, got %v", err)
+	}
+	assertStock(t, db, product.ID, 12)
+
+	order := store.NewOrder(client.ID, vet.ID, store.Money{})
+	must(t, "PlaceOrder", db.PlaceOrder(ctx, order, []store.OrderItem{
+		*store.NewOrderItem("", product.ID, 2, store.Money{}),
+	}))
+
+	// UpdateProduct never writes stock
+	current, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID", err)
+	current.StockQuantity = 99
+	must(t, "UpdateProduct", db.UpdateProduct(ctx, current))
+	assertStock(t, db, product.ID, 10)
+
+	got, _, err := db.ListStockMovements(ctx, product.ID, store.Page{})
+	must(t, "ListStockMovements", err)
+	if len(got) != 4 {
+		t.Fatalf("ListStockMovements: expected 4 movements, got %d", len(got))
+	}
+	if got[2].ID != received.ID || got[1].ID != writeOff.ID {
+		t.Errorf("ListStockMovements: expected newest first, got %v", ids(got, movementID))
+	}
+
+	sale, opening := got[0], got[3]
+	if sale.Type != store.StockSale || sale.Quantity != -2 || sale.BalanceAfter != 10 ||
+		sale.OrderID != order.ID || sale.ActorID != client.ID {
+		t.Errorf("ListStockMovements: unexpected sale %+v", sale)
+	}
+	if opening.Type != store.StockAdjustment || opening.Quantity != 5 || opening.BalanceAfter != 5 {
+		t.Errorf("ListStockMovements: unexpected opening balance %+v", opening)
+	}
+	if got[2].Reason != "Delivery 42" || got[2].ActorID != vet.ID {
+		t.Errorf("ListStockMovements: reason or actor not stored, got %+v", got[2])
+	}
+	sum := 0
+	for _, m := range got {
+		sum += m.Quantity
+	}
+	if sum != 10 {
+		t.Errorf("ListStockMovements: expected movements to sum to the stock 10, got %d", sum)
+	}
+
+	first, next, err := db.ListStockMovements(ctx, product.ID, store.Page{Limit: 3})
+	must(t, "ListStockMovements(page 1)", err)
+	rest, _, err := db.ListStockMovements(ctx, product.ID, store.Page{Limit: 3, Cursor: next})
+	must(t, "ListStockMovements(page 2)", err)
+	if !sameIDs(append(ids(first, movementID), ids(rest, movementID)...), ids(got, movementID)) {
+		t.Errorf("ListStockMovements: pages do not add up to the full history")
+	}
+
+	_, _, err = db.ListStockMovements(ctx, missingID(), store.Page{})
+	expectNotFound(t, "ListStockMovements", err)
+	unknownOrder := store.NewStockMovement(product.ID, store.StockCancellation, 1, vet.ID)
+	unknownOrder.OrderID = missingID()
+	expectNotFound(t, "RecordStockMovement with missing order", db.RecordStockMovement(ctx, unknownOrder))
+}
+
+// testUpdateProductWithStock covers saving a product together with a new
+// stock count: the adjustment is worked out from the stored stock, and a
+// failed update records nothing
+func testUpdateProductWithStock(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	vet := newVet(t, db)
+	product := newProduct(t, db, vet.ID, "food", 10, 5)
+
+	// A delivery lands after the product was read
+	stale, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID", err)
+	received := store.NewStockMovement(product.ID, store.StockReceived, 10, vet.ID)
+	must(t, "RecordStockMovement", db.RecordStockMovement(ctx, received))
+
+	stale.Name = "Counted kibble"
+	stale.StockQuantity = 7
+	stale.Version = 0
+	adjustment := store.NewStockMovement(product.ID, store.StockAdjustment, 0, vet.ID)
+	adjustment.Reason = "Stocktake"
+	must(t, "UpdateProductWithStock", db.UpdateProductWithStock(ctx, stale, adjustment))
+	if adjustment.Quantity != -8 || adjustment.BalanceAfter != 7 {
+		t.Errorf("UpdateProductWithStock: expected -8 to a balance of 7, got %+v", adjustment)
+	}
+	got, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID", err)
+	if got.Name != "Counted kibble" || got.StockQuantity != 7 || got.Version != stale.Version {
+		t.Errorf("UpdateProductWithStock: unexpected product %+v, returned version %d", got, stale.Version)
+	}
+
+	// An unchanged count records no movement
+	got.Brand = "Acme"
+	same := store.NewStockMovement(product.ID, store.StockAdjustment, 0, vet.ID)
+	must(t, "UpdateProductWithStock(same stock)", db.UpdateProductWithStock(ctx, got, same))
+	if same.Quantity != 0 {
+		t.Errorf("UpdateProductWithStock(same stock): expected no change, got %d", same.Quantity)
+	}
+
+	// A version conflict leaves both the fields and the stock alone
+	got.Version--
+	got.Name = "Lost update"
+	got.StockQuantity = 1
+	conflict := store.NewStockMovement(product.ID, store.StockAdjustment, 0, vet.ID)
+	expectVersionConflict(t, "UpdateProductWithStock(stale version)",
+		db.UpdateProductWithStock(ctx, got, conflict))
+	current, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID", err)
+	if current.Name != "Counted kibble" || current.Brand != "Acme" {
+		t.Errorf("UpdateProductWithStock(stale version): fields changed to %+v", current)
+	}
+	assertStock(t, db, product.ID, 7)
+
+	movements, _, err := db.ListStockMovements(ctx, product.ID, store.Page{})
+	must(t, "ListStockMovements", err)
+	if len(movements) != 3 || movements[0].ID != adjustment.ID || movements[0].Reason != "Stocktake" {
+		t.Errorf("ListStockMovements: expected the adjustment on top of 3 movements, got %+v", movements)
+	}
+
+	current.StockQuantity = -1
+	if err := db.UpdateProductWithStock(ctx, current, conflict); !errors.Is(err, store.ErrInvalidStockMovement) {
+		t.Errorf("UpdateProductWithStock(negative): expected ErrInvalidStockMovement, got %v", err)
+	}
+	missing := *current
+	missing.ID = missingID()
+	missing.StockQuantity = 1
+	expectNotFound(t, "UpdateProductWithStock(missing)", db.UpdateProductWithStock(ctx, &missing, conflict))
+}
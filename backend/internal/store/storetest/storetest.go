@@ -0,0 +1,184 @@
+// Package storetest contains a contract test suite that every store.Database
+// implementation must pass. Backends call Run from their own tests:
+//
+//	func TestMemoryStoreContract(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Database {
+//			return store.NewMemoryStore()
+//		})
+//	}
+//
+// The suite only creates rows with fresh UUIDs and never assumes an empty
+// database, so it can run against a shared PostgreSQL or Supabase instance.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Factory returns the Database a subtest should run against
+type Factory func(t *testing.T) store.Database
+
+// Run executes the whole contract suite against databases built by newDB
+func Run(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, db store.Database)
+	}{
+		{"Users", testUsers},
+		{"UserConflicts", testUserConflicts},
+		{"ListUsers", testListUsers},
+		{"AdminAccounts", testAdminAccounts},
+		{"Pets", testPets},
+		{"MedicalRecords", testMedicalRecords},
+		{"PetAccess", testPetAccess},
+		{"RecordConsents", testRecordConsents},
+		{"QRCodes", testQRCodes},
+		{"Appointments", testAppointments},
+		{"AppointmentSlots", testAppointmentSlots},
+		{"Products", testProducts},
+		{"ProductFilters", testProductFilters},
+		{"ProductSearch", testProductSearch},
+		{"Orders", testOrders},
+		{"PlaceOrder", testPlaceOrder},
+		{"StockLedger", testStockLedger},
+		{"UpdateProductWithStock", testUpdateProductWithStock},
+		{"Reservations", testReservations},
+		{"Checkout", testCheckout},
+		{"Payments", testPayments},
+		{"OrderLifecycle", testOrderLifecycle},
+		{"Returns", testReturns},
+		{"Invoices", testInvoices},
+		{"Tax", testTax},
+		{"Promotions", testPromotions},
+		{"Pagination", testPagination},
+		{"Versions", testVersions},
+		{"Trash", testTrash},
+		{"Audit", testAudit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newDB(t))
+		})
+	}
+}
+
+// missingID is a well-formed ID that no backend will ever have stored
+func missingID() string {
+	return uuid.NewString()
+}
+
+// expectNotFound fails the test unless err wraps store.ErrNotFound
+func expectNotFound(t *testing.T, op string, err error) {
+	t.Helper()
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("%s: expected ErrNotFound, got %v", op, err)
+	}
+}
+
+// must fails the test immediately if err is not nil
+func must(t *testing.T, op string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", op, err)
+	}
+}
+
+// newClient stores a client with a unique ID and email
+func newClient(t *testing.T, db store.Database) *store.Client {
+	t.Helper()
+	id := uuid.NewString()
+	c := &store.Client{
+		ID:      id,
+		Name:    "Client " + id[:8],
+		Email:   id + "@client.example.com",
+		Phone:   "+6590000000",
+		Address: "1 Test Street",
+	}
+	must(t, "CreateClient", db.CreateClient(context.Background(), c))
+	return c
+}
+
+// newVet stores a veterinarian with a unique ID and email
+func newVet(t *testing.T, db store.Database, hours ...store.WorkingHours) *store.Veterinarian {
+	t.Helper()
+	id := uuid.NewString()
+	v := &store.Veterinarian{
+		ID:             id,
+		Name:           "Dr. " + id[:8],
+		Email:          id + "@vet.example.com",
+		ClinicAddress:  "2 Clinic Road",
+		AvailableHours: hours,
+	}
+	must(t, "CreateVeterinarian", db.CreateVeterinarian(context.Background(), v))
+	return v
+}
+
+// newPet stores a pet owned by ownerID
+func newPet(t *testing.T, db store.Database, ownerID, name string) *store.Pet {
+	t.Helper()
+	dob := time.Date(2020, 5, 17, 0, 0, 0, 0, time.UTC)
+	p := store.NewPet(ownerID, name, "Dog", "Beagle", dob, 12.5)
+	must(t, "CreatePet", db.CreatePet(context.Background(), p))
+	return p
+}
+
+// newProduct stores an active product sold by vetID
+func newProduct(
+	t *testing.T,
+	db store.Database,
+	vetID, category string,
+	price float64,
+	stock int,
+) *store.Product {
+	t.Helper()
+	p := store.NewProduct(vetID, "Product "+uuid.NewString()[:8], "", category, usd(price))
+	p.StockQuantity = stock
+	must(t, "CreateProduct", db.CreateProduct(context.Background(), p))
+	return p
+}
+
+// usd is major units of US dollars, such as usd(19.99)
+func usd(major float64) store.Money {
+	return store.MoneyFromMajor(major, "USD")
+}
+
+// ids returns the IDs of items in order
+func ids[T any](items []T, id func(T) string) []string {
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i] = id(it)
+	}
+	return out
+}
+
+func userID(u store.User) string              { return u.ID }
+func petID(p store.Pet) string                { return p.ID }
+func recordID(r store.MedicalRecord) string   { return r.ID }
+func apptID(a store.Appointment) string       { return a.ID }
+func productID(p store.Product) string        { return p.ID }
+func orderID(o store.Order) string            { return o.ID }
+func auditID(e store.AuditEntry) string       { return e.ID }
+func movementID(m store.StockMovement) string { return m.ID }
+func returnID(r store.Return) string          { return r.ID }
+func grantID(g store.PetAccessGrant) string   { return g.ID }
+func consentID(c store.RecordConsent) string  { return c.ID }
+
+// sameIDs reports whether got and want hold the same IDs in the same order
+func sameIDs(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
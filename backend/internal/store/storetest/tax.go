@@ -0,0 +1,117 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+)
+
+// testTax covers clinic tax settings and the tax charged on orders: each
+// rate applies to the items it does not exempt, on top of the prices or
+// worked out of them, and orders keep the tax they were charged
+func testTax(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db)
+	food := newProduct(t, db, vet.ID, "food", 10, 10)
+	meds := newProduct(t, db, vet.ID, "Medication", 20, 10)
+
+	_, err := db.GetTaxSettings(ctx, missingID())
+	expectNotFound(t, "GetTaxSettings for a missing veterinarian", err)
+	settings, err := db.GetTaxSettings(ctx, vet.ID)
+	must(t, "GetTaxSettings", err)
+	if settings.Inclusive || len(settings.Rates) != 0 {
+		t.Errorf("GetTaxSettings: expected no tax by default, got %+v", settings)
+	}
+
+	for _, rates := range [][]store.TaxRate{
+		{{RateBps: 900}},
+		{{Name: "GST", RateBps: 900}, {Name: "gst", RateBps: 100}},
+		{{Name: "GST"}},
+		{{Name: "GST", RateBps: store.MaxTaxRateBps + 1}},
+	} {
+		err := db.SetTaxSettings(ctx, store.NewTaxSettings(vet.ID, false, rates))
+		if !errors.Is(err, store.ErrInvalidTaxSettings) {
+			t.Errorf("SetTaxSettings(%+v): expected ErrInvalidTaxSettings, got %v", rates, err)
+		}
+	}
+	err = db.SetTaxSettings(ctx, store.NewTaxSettings(missingID(), false, nil))
+	expectNotFound(t, "SetTaxSettings for a missing veterinarian", err)
+
+	place := func(items ...store.OrderItem) *store.Order {
+		t.Helper()
+		order := store.NewOrder(client.ID, vet.ID, store.Money{})
+		must(t, "PlaceOrder", db.PlaceOrder(ctx, order, items))
+		return order
+	}
+
+	// Exclusive: GST exempts medication, matched regardless of case, and the
+	// levy applies to everything
+	must(t, "SetTaxSettings", db.SetTaxSettings(ctx, store.NewTaxSettings(vet.ID, false, []store.TaxRate{
+		{Name: "GST", RateBps: 900, ExemptCategories: []string{"medication"}},
+		{Name: "Levy", RateBps: 50},
+	})))
+	settings, err = db.GetTaxSettings(ctx, vet.ID)
+	must(t, "GetTaxSettings", err)
+	if settings.Inclusive || len(settings.Rates) != 2 || settings.Rates[0].ExemptCategories[0] != "medication" {
+		t.Errorf("GetTaxSettings: expected the rates just set, got %+v", settings)
+	}
+	exclusive := place(
+		*store.NewOrderItem("", food.ID, 2, store.Money{}),
+		*store.NewOrderItem("", meds.ID, 1, store.Money{}),
+	)
+	want := []store.TaxLine{
+		{Name: "GST", RateBps: 900, Taxable: usd(20), Amount: usd(1.80)},
+		{Name: "Levy", RateBps: 50, Taxable: usd(40), Amount: usd(0.20)},
+	}
+	assertTax(t, db, exclusive.ID, false, want, usd(2), usd(42))
+
+	// Inclusive: the tax is worked out of the price, rounded to the cent
+	must(t, "SetTaxSettings", db.SetTaxSettings(ctx, store.NewTaxSettings(vet.ID, true, []store.TaxRate{
+		{Name: "GST", RateBps: 900, ExemptCategories: []string{"medication"}},
+	})))
+	inclusive := place(*store.NewOrderItem("", food.ID, 1, store.Money{}))
+	want = []store.TaxLine{{Name: "GST", RateBps: 900, Taxable: usd(10), Amount: usd(0.83)}}
+	assertTax(t, db, inclusive.ID, true, want, usd(0.83), usd(10))
+
+	// A rate with nothing to tax adds no line
+	exempt := place(*store.NewOrderItem("", meds.ID, 1, store.Money{}))
+	assertTax(t, db, exempt.ID, true, []store.TaxLine{}, usd(0), usd(20))
+
+	// Orders keep the tax they were placed with
+	must(t, "SetTaxSettings", db.SetTaxSettings(ctx, store.NewTaxSettings(vet.ID, false, nil)))
+	want = []store.TaxLine{
+		{Name: "GST", RateBps: 900, Taxable: usd(20), Amount: usd(1.80)},
+		{Name: "Levy", RateBps: 50, Taxable: usd(40), Amount: usd(0.20)},
+	}
+	assertTax(t, db, exclusive.ID, false, want, usd(2), usd(42))
+	untaxed := place(*store.NewOrderItem("", food.ID, 1, store.Money{}))
+	assertTax(t, db, untaxed.ID, false, []store.TaxLine{}, usd(0), usd(10))
+}
+
+// assertTax checks the tax a stored order was charged and its total
+func assertTax(
+	t *testing.T,
+	db store.Database,
+	orderID string,
+	inclusive bool,
+	lines []store.TaxLine,
+	tax, total store.Money,
+) {
+	t.Helper()
+	order, err := db.GetOrderByID(context.Background(), orderID)
+	must(t, "GetOrderByID", err)
+	if order.TaxInclusive != inclusive || order.TaxAmount != tax || order.TotalAmount != total {
+		t.Errorf("order %s: expected tax %v of total %v (inclusive %v), got %v of %v (inclusive %v)",
+			orderID, tax, total, inclusive, order.TaxAmount, order.TotalAmount, order.TaxInclusive)
+	}
+	if len(order.TaxLines) != len(lines) {
+		t.Fatalf("order %s: expected tax lines %+v, got %+v", orderID, lines, order.TaxLines)
+	}
+	for i := range lines {
+		if order.TaxLines[i] != lines[i] {
+			t.Errorf("order %s: expected tax line %+v, got %+v", orderID, lines[i], order.TaxLines[i])
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// testTrash covers soft delete: deleted rows disappear from reads, show up in
+// the trash, come back with the rows deleted along with them and are removed
+// for good by a purge
+func testTrash(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	vet := newVet(t, db)
+	pet := newPet(t, db, owner.ID, "Bella")
+	record := store.NewMedicalRecord(pet.ID, vet.ID, "Checkup", "", time.Now(), nil, "", nil)
+	must(t, "CreateMedicalRecord", db.CreateMedicalRecord(ctx, record))
+	product := newProduct(t, db, vet.ID, "food", 10, 5)
+
+	// Deleting a client trashes their pets and the pets' records
+	must(t, "DeleteUser(client)", db.DeleteUser(ctx, owner.ID))
+	_, err := db.GetClientByID(ctx, owner.ID)
+	expectNotFound(t, "GetClientByID(deleted)", err)
+	_, err = db.GetUserByID(ctx, owner.ID)
+	expectNotFound(t, "GetUserByID(deleted)", err)
+	_, err = db.GetPetByID(ctx, pet.ID)
+	expectNotFound(t, "GetPetByID(owner deleted)", err)
+	_, err = db.GetMedicalRecordByID(ctx, record.ID)
+	expectNotFound(t, "GetMedicalRecordByID(owner deleted)", err)
+	expectNotFound(t, "UpdatePet(deleted)", db.UpdatePet(ctx, pet))
+
+	if got := trashIDs(t, db, "", owner.ID, pet.ID, record.ID); len(got) != 3 {
+		t.Errorf("ListTrash: expected the client, pet and record, got %v", got)
+	}
+	if got := trashIDs(t, db, store.EntityPet, owner.ID, pet.ID, record.ID); !sameIDs(got, []string{pet.ID}) {
+		t.Errorf("ListTrash(pet): expected only the pet, got %v", got)
+	}
+	if _, _, err := db.ListTrash(ctx, "appointment", store.Page{}); err == nil {
+		t.Error("ListTrash(appointment): expected an error for an unknown entity")
+	}
+
+	// A trashed ID stays taken
+	again := &store.Client{ID: owner.ID, Name: owner.Name, Email: "other-" + owner.Email}
+	if err := db.CreateClient(ctx, again); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreateClient(trashed ID): expected ErrConflict, got %v", err)
+	}
+
+	expectNotFound(t, "RestoreDeleted(wrong entity)",
+		db.RestoreDeleted(ctx, store.EntityProduct, owner.ID))
+	expectNotFound(t, "RestoreDeleted(live row)",
+		db.RestoreDeleted(ctx, store.EntityProduct, product.ID))
+
+	// Restoring the client brings back everything deleted with it
+	must(t, "RestoreDeleted(user)", db.RestoreDeleted(ctx, store.EntityUser, owner.ID))
+	_, err = db.GetClientByID(ctx, owner.ID)
+	must(t, "GetClientByID(restored)", err)
+	_, err = db.GetMedicalRecordByID(ctx, record.ID)
+	must(t, "GetMedicalRecordByID(restored)", err)
+	if got := trashIDs(t, db, "", owner.ID, pet.ID, record.ID); len(got) != 0 {
+		t.Errorf("ListTrash after restore: expected nothing, got %v", got)
+	}
+
+	// A record deleted on its own stays in the trash when its pet is restored
+	must(t, "DeleteMedicalRecord", db.DeleteMedicalRecord(ctx, record.ID))
+	must(t, "DeletePet", db.DeletePet(ctx, pet.ID))
+	must(t, "RestoreDeleted(pet)", db.RestoreDeleted(ctx, store.EntityPet, pet.ID))
+	_, err = db.GetPetByID(ctx, pet.ID)
+	must(t, "GetPetByID(restored)", err)
+	_, err = db.GetMedicalRecordByID(ctx, record.ID)
+	expectNotFound(t, "GetMedicalRecordByID(deleted before its pet)", err)
+
+	// Deleted products are deactivated and stay inactive when restored
+	must(t, "DeleteProduct", db.DeleteProduct(ctx, product.ID))
+	_, err = db.GetProductByID(ctx, product.ID)
+	expectNotFound(t, "GetProductByID(deleted)", err)
+	must(t, "RestoreDeleted(product)", db.RestoreDeleted(ctx, store.EntityProduct, product.ID))
+	restored, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID(restored)", err)
+	if restored.IsActive {
+		t.Error("RestoreDeleted(product): expected the product to stay inactive")
+	}
+
+	// Purging removes rows deleted before the cutoff and leaves the rest
+	purged, err := db.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	must(t, "PurgeDeleted(an hour ago)", err)
+	if got := trashIDs(t, db, "", record.ID); len(got) != 1 {
+		t.Errorf("PurgeDeleted(an hour ago): expected the record to stay, got %v after %d purged",
+			got, purged)
+	}
+	purged, err = db.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+	must(t, "PurgeDeleted", err)
+	if purged < 1 {
+		t.Errorf("PurgeDeleted: expected at least the record, got %d", purged)
+	}
+	if got := trashIDs(t, db, "", record.ID); len(got) != 0 {
+		t.Errorf("PurgeDeleted: expected the record to be gone, got %v", got)
+	}
+	expectNotFound(t, "RestoreDeleted(purged)",
+		db.RestoreDeleted(ctx, store.EntityMedicalRecord, record.ID))
+}
+
+// trashIDs walks the whole trash for entity and returns the IDs among want in
+// trash order. Other tests may share the database, so other rows are ignored.
+func trashIDs(t *testing.T, db store.Database, entity string, want ...string) []string {
+	t.Helper()
+	keep := make(map[string]bool, len(want))
+	for _, id := range want {
+		keep[id] = true
+	}
+	got := []string{}
+	page := store.Page{Limit: store.MaxPageLimit}
+	for {
+		items, next, err := db.ListTrash(context.Background(), entity, page)
+		must(t, "ListTrash", err)
+		for _, item := range items {
+			if keep[item.ID] {
+				got = append(got, item.ID)
+			}
+		}
+		if next == "" {
+			return got
+		}
+		page.Cursor = next
+	}
+}
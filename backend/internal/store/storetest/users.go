@@ -0,0 +1,146 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+)
+
+// testUsers covers client and veterinarian CRUD and the GetUserByID fallback
+func testUsers(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+	vet := newVet(t, db, store.WorkingHours{DayOfWeek: "Monday", Start: "09:00", End: "17:00"})
+
+	gotClient, err := db.GetClientByID(ctx, client.ID)
+	must(t, "GetClientByID", err)
+	if gotClient.Name != client.Name || gotClient.Email != client.Email || gotClient.Phone != client.Phone {
+		t.Errorf("GetClientByID: expected %+v, got %+v", client, gotClient)
+	}
+	if gotClient.Role != "client" {
+		t.Errorf("GetClientByID: expected default role client, got %q", gotClient.Role)
+	}
+
+	gotVet, err := db.GetVeterinarianByID(ctx, vet.ID)
+	must(t, "GetVeterinarianByID", err)
+	if gotVet.Role != "veterinarian" {
+		t.Errorf("GetVeterinarianByID: expected default role veterinarian, got %q", gotVet.Role)
+	}
+	if len(gotVet.AvailableHours) != 1 || gotVet.AvailableHours[0].Start != "09:00" {
+		t.Errorf("GetVeterinarianByID: available hours not stored, got %+v", gotVet.AvailableHours)
+	}
+
+	// GetUserByID looks in clients first and falls back to veterinarians
+	user, err := db.GetUserByID(ctx, client.ID)
+	must(t, "GetUserByID(client)", err)
+	if user.Role != "client" || user.Email != client.Email {
+		t.Errorf("GetUserByID(client): unexpected user %+v", user)
+	}
+	user, err = db.GetUserByID(ctx, vet.ID)
+	must(t, "GetUserByID(vet)", err)
+	if user.Role != "veterinarian" || user.Email != vet.Email {
+		t.Errorf("GetUserByID(vet): unexpected user %+v", user)
+	}
+
+	_, err = db.GetUserByID(ctx, missingID())
+	expectNotFound(t, "GetUserByID", err)
+	_, err = db.GetClientByID(ctx, missingID())
+	expectNotFound(t, "GetClientByID", err)
+	_, err = db.GetVeterinarianByID(ctx, missingID())
+	expectNotFound(t, "GetVeterinarianByID", err)
+
+	client.Name = "Renamed Client"
+	must(t, "UpdateClient", db.UpdateClient(ctx, client))
+	gotClient, err = db.GetClientByID(ctx, client.ID)
+	must(t, "GetClientByID after update", err)
+	if gotClient.Name != "Renamed Client" {
+		t.Errorf("UpdateClient: expected name to change, got %q", gotClient.Name)
+	}
+
+	vet.ClinicAddress = "3 New Road"
+	must(t, "UpdateVeterinarian", db.UpdateVeterinarian(ctx, vet))
+	gotVet, err = db.GetVeterinarianByID(ctx, vet.ID)
+	must(t, "GetVeterinarianByID after update", err)
+	if gotVet.ClinicAddress != "3 New Road" {
+		t.Errorf("UpdateVeterinarian: expected address to change, got %q", gotVet.ClinicAddress)
+	}
+
+	expectNotFound(t, "UpdateClient", db.UpdateClient(ctx, &store.Client{ID: missingID(), Email: "x@example.com"}))
+	expectNotFound(t, "UpdateVeterinarian", db.UpdateVeterinarian(ctx, &store.Veterinarian{ID: missingID(), Email: "x@example.com"}))
+
+	must(t, "DeleteUser(client)", db.DeleteUser(ctx, client.ID))
+	must(t, "DeleteUser(vet)", db.DeleteUser(ctx, vet.ID))
+	_, err = db.GetUserByID(ctx, client.ID)
+	expectNotFound(t, "GetUserByID after delete", err)
+	_, err = db.GetUserByID(ctx, vet.ID)
+	expectNotFound(t, "GetUserByID after delete", err)
+
+	expectNotFound(t, "DeleteUser(missing)", db.DeleteUser(ctx, missingID()))
+	expectNotFound(t, "DeleteUser(twice)", db.DeleteUser(ctx, client.ID))
+}
+
+// testUserConflicts covers uniqueness of profile IDs and emails
+func testUserConflicts(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	client := newClient(t, db)
+
+	dup := &store.Client{ID: missingID(), Name: "Dup", Email: client.Email}
+	if err := db.CreateClient(ctx, dup); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreateClient with duplicate email: expected ErrConflict, got %v", err)
+	}
+
+	again := *client
+	again.Email = missingID() + "@client.example.com"
+	if err := db.CreateClient(ctx, &again); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreateClient with duplicate ID: expected ErrConflict, got %v", err)
+	}
+
+	vet := newVet(t, db)
+	dupVet := &store.Veterinarian{ID: missingID(), Name: "Dup", Email: vet.Email}
+	if err := db.CreateVeterinarian(ctx, dupVet); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("CreateVeterinarian with duplicate email: expected ErrConflict, got %v", err)
+	}
+}
+
+// testListUsers covers ListUsers pagination over clients and veterinarians
+func testListUsers(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	created := []string{newClient(t, db).ID, newVet(t, db).ID, newClient(t, db).ID}
+
+	first, next, err := db.ListUsers(ctx, "", store.Page{Limit: 2})
+	must(t, "ListUsers(page 1)", err)
+	if len(first) != 2 || next == "" {
+		t.Fatalf("ListUsers(page 1): expected 2 users and a next cursor, got %d and %q", len(first), next)
+	}
+	second, _, err := db.ListUsers(ctx, "", store.Page{Limit: 2, Cursor: next})
+	must(t, "ListUsers(page 2)", err)
+	if len(second) == 0 {
+		t.Fatalf("ListUsers(page 2): expected at least 1 user")
+	}
+	seen := map[string]bool{}
+	for _, u := range append(first, second...) {
+		if seen[u.ID] {
+			t.Errorf("ListUsers: user %s appears on two pages", u.ID)
+		}
+		seen[u.ID] = true
+	}
+	if first[0].ID > first[1].ID || first[1].ID > second[0].ID {
+		t.Errorf("ListUsers: expected users ordered by ID across pages")
+	}
+
+	listed := map[string]bool{}
+	listUsers := func(page store.Page) ([]store.User, string, error) {
+		return db.ListUsers(ctx, "", page)
+	}
+	for _, page := range walk(t, "ListUsers", store.MaxPageLimit, userID, listUsers) {
+		for _, id := range page {
+			listed[id] = true
+		}
+	}
+	for _, id := range created {
+		if !listed[id] {
+			t.Errorf("ListUsers: created user %s missing from full listing", id)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"pet-mgt/backend/internal/store"
+	"testing"
+	"time"
+)
+
+// testVersions covers optimistic concurrency: creates start at version 1,
+// every update bumps the version and updates with a stale version fail
+func testVersions(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	owner := newClient(t, db)
+	vet := newVet(t, db)
+
+	pet := newPet(t, db, owner.ID, "Luna")
+	if pet.Version != 1 {
+		t.Errorf("CreatePet: expected version 1, got %d", pet.Version)
+	}
+
+	// Two editors load the same version; the second write loses
+	first, err := db.GetPetByID(ctx, pet.ID)
+	must(t, "GetPetByID", err)
+	second, err := db.GetPetByID(ctx, pet.ID)
+	must(t, "GetPetByID", err)
+
+	first.Name = "Luna II"
+	must(t, "UpdatePet", db.UpdatePet(ctx, first))
+	if first.Version != 2 {
+		t.Errorf("UpdatePet: expected version 2 written back, got %d", first.Version)
+	}
+	second.Name = "Stale"
+	expectVersionConflict(t, "UpdatePet with a stale version", db.UpdatePet(ctx, second))
+
+	got, err := db.GetPetByID(ctx, pet.ID)
+	must(t, "GetPetByID after conflict", err)
+	if got.Name != "Luna II" || got.Version != 2 {
+		t.Errorf("UpdatePet: expected the first write to stand at version 2, got %q at %d",
+			got.Name, got.Version)
+	}
+
+	// A zero version skips the check
+	second.Version = 0
+	must(t, "UpdatePet without a version", db.UpdatePet(ctx, second))
+	if second.Version != 3 {
+		t.Errorf("UpdatePet without a version: expected version 3, got %d", second.Version)
+	}
+
+	missing := *got
+	missing.ID = missingID()
+	expectNotFound(t, "UpdatePet(missing) with a version", db.UpdatePet(ctx, &missing))
+
+	record := store.NewMedicalRecord(pet.ID, vet.ID, "Checkup", "", time.Now(), nil, "", nil)
+	must(t, "CreateMedicalRecord", db.CreateMedicalRecord(ctx, record))
+	stale := *record
+	record.Notes = "Healthy"
+	must(t, "UpdateMedicalRecord", db.UpdateMedicalRecord(ctx, record))
+	expectVersionConflict(t, "UpdateMedicalRecord with a stale version",
+		db.UpdateMedicalRecord(ctx, &stale))
+
+	appt := store.NewAppointment(owner.ID, vet.ID, pet.ID, time.Now().Add(48*time.Hour), 30, "Vaccination")
+	must(t, "CreateAppointment", db.CreateAppointment(ctx, appt))
+	staleAppt := *appt
+	appt.Status = "completed"
+	must(t, "UpdateAppointment", db.UpdateAppointment(ctx, appt))
+	expectVersionConflict(t, "UpdateAppointment with a stale version",
+		db.UpdateAppointment(ctx, &staleAppt))
+
+	// Stock changes bump the product version too
+	product := newProduct(t, db, vet.ID, "food", 10, 5)
+	must(t, "RecordStockMovement", db.RecordStockMovement(ctx,
+		store.NewStockMovement(product.ID, store.StockWriteOff, -1, vet.ID)))
+	product.Name = "Stale"
+	expectVersionConflict(t, "UpdateProduct after a stock change", db.UpdateProduct(ctx, product))
+	current, err := db.GetProductByID(ctx, product.ID)
+	must(t, "GetProductByID", err)
+	if current.Version != 2 || current.StockQuantity != 4 {
+		t.Errorf("RecordStockMovement: expected stock 4 at version 2, got %d at %d",
+			current.StockQuantity, current.Version)
+	}
+	current.Price = usd(12)
+	must(t, "UpdateProduct", db.UpdateProduct(ctx, current))
+	if current.Version != 3 {
+		t.Errorf("UpdateProduct: expected version 3, got %d", current.Version)
+	}
+}
+
+// expectVersionConflict fails the test unless err wraps store.ErrVersionConflict
+func expectVersionConflict(t *testing.T, op string, err error) {
+	t.Helper()
+	if !errors.Is(err, store.ErrVersionConflict) {
+		t.Errorf("%s: expected ErrVersionConflict, got %v", op, err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package store/tax.go contains the clinic tax settings and the tax computation shared by all backends
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxTaxRateBps is the highest tax rate a clinic can charge, 100%
+const MaxTaxRateBps = 10000
+
+// TaxRate is one tax a clinic charges, such as GST or VAT, in basis points:
+// 900 is 9%. Products in an exempt category, such as prescription
+// medication, are not charged it.
+type TaxRate struct {
+	Name             string   `json:"name"`
+	RateBps          int      `json:"rate_bps"`
+	ExemptCategories []string `json:"exempt_categories,omitempty"`
+}
+
+// TaxSettings are the taxes a veterinarian's clinic charges on its orders.
+// With Inclusive pricing product prices already contain the tax, which is
+// worked out of them; otherwise it is added on top. A clinic without rates
+// charges no tax.
+type TaxSettings struct {
+	VeterinarianID string    `json:"veterinarian_id"`
+	Inclusive      bool      `json:"inclusive"`
+	Rates          []TaxRate `json:"rates"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TaxLine is one tax charged on an order: the rate, the part of the order's
+// items it applies to and the tax itself
+type TaxLine struct {
+	Name    string `json:"name"`
+	RateBps int    `json:"rate_bps"`
+	Taxable Money  `json:"taxable"`
+	Amount  Money  `json:"amount"`
+}
+
+// NewTaxSettings creates TaxSettings for vetID
+func NewTaxSettings(vetID string, inclusive bool, rates []TaxRate) *TaxSettings {
+	if rates == nil {
+		rates = []TaxRate{}
+	}
+	return &TaxSettings{
+		VeterinarianID: vetID,
+		Inclusive:      inclusive,
+		Rates:          rates,
+		UpdatedAt:      time.Now(),
+	}
+}
+
+// validateTaxSettings rejects rates without a name, repeated names and rates
+// outside 0-100%
+func validateTaxSettings(settings *TaxSettings) error {
+	if settings.VeterinarianID == "" {
+		return fmt.Errorf("%w: veterinarian is required", ErrInvalidTaxSettings)
+	}
+	names := make(map[string]bool, len(settings.Rates))
+	for _, rate := range settings.Rates {
+		name := strings.ToLower(strings.TrimSpace(rate.Name))
+		switch {
+		case name == "":
+			return fmt.Errorf("%w: every rate needs a name", ErrInvalidTaxSettings)
+		case names[name]:
+			return fmt.Errorf("%w: rate %q is listed twice", ErrInvalidTaxSettings, rate.Name)
+		case rate.RateBps <= 0 || rate.RateBps > MaxTaxRateBps:
+			return fmt.Errorf("%w: rate %q must be between 1 and %d basis points",
+				ErrInvalidTaxSettings, rate.Name, MaxTaxRateBps)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// exempts reports whether rate is not charged on products in category
+func (rate TaxRate) exempts(category string) bool {
+	for _, exempt := range rate.ExemptCategories {
+		if strings.EqualFold(exempt, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// taxOn is the tax at rateBps on taxable, rounded half up to the cent. With
+// inclusive pricing taxable already contains the tax. Each rate is worked
+// out on its own, which is exact when at most one rate applies to an item.
+func taxOn(taxable int64, rateBps int, inclusive bool) int64 {
+	bps := int64(rateBps)
+	if inclusive {
+		return (2*taxable*bps + MaxTaxRateBps + bps) / (2 * (MaxTaxRateBps + bps))
+	}
+	return (taxable*bps + MaxTaxRateBps/2) / MaxTaxRateBps
+}
+
+// applyTax charges settings' rates on the priced items of order, less the
+// discounts taken off each, recording the tax lines and setting the order's
+// total. categories maps product IDs to their categories.
+func applyTax(
+	order *Order,
+	items []OrderItem,
+	categories map[string]string,
+	discounts []int64,
+	settings *TaxSettings,
+) {
+	var subtotal Money
+	for _, it := range items {
+		// Callers have checked the items share a currency
+		subtotal, _ = subtotal.Add(it.TotalPrice)
+	}
+	currency := subtotal.currencyOrDefault()
+
+	order.TaxInclusive = settings.Inclusive
+	order.TaxLines = []TaxLine{}
+	tax := NewMoney(0, currency)
+	for _, rate := range settings.Rates {
+		var taxable int64
+		for i, it := range items {
+			if !rate.exempts(categories[it.ProductID]) {
+				taxable += it.TotalPrice.Amount - discounts[i]
+			}
+		}
+		if taxable == 0 {
+			continue
+		}
+		amount := taxOn(taxable, rate.RateBps, settings.Inclusive)
+		order.TaxLines = append(order.TaxLines, TaxLine{
+			Name:    rate.Name,
+			RateBps: rate.RateBps,
+			Taxable: NewMoney(taxable, currency),
+			Amount:  NewMoney(amount, currency),
+		})
+		tax.Amount += amount
+	}
+
+	order.TaxAmount = tax
+	order.TotalAmount = NewMoney(subtotal.Amount-order.DiscountAmount.Amount, currency)
+	if !settings.Inclusive {
+		order.TotalAmount.Amount += tax.Amount
+	}
+}
@@ -0,0 +1,96 @@
+// Package store/trash.go contains the soft delete types shared by all backends
+package store
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Entities whose Delete methods move rows to the trash
+const (
+	EntityUser          = "user"
+	EntityPet           = "pet"
+	EntityMedicalRecord = "medical_record"
+	EntityProduct       = "product"
+)
+
+// TrashEntities lists every entity that can be deleted and restored
+var TrashEntities = []string{EntityUser, EntityPet, EntityMedicalRecord, EntityProduct}
+
+// TrashItem is a soft-deleted row waiting to be restored or purged
+type TrashItem struct {
+	Entity    string    `json:"entity"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// trashTable maps an entity onto a table with a deleted_at column and the
+// column that names its rows in the trash
+type trashTable struct {
+	entity string
+	table  string
+	name   string
+}
+
+// trashTables lists the soft-deleted tables. Users live in two tables.
+var trashTables = []trashTable{
+	{entity: EntityUser, table: "clients", name: "name"},
+	{entity: EntityUser, table: "veterinarians", name: "name"},
+	{entity: EntityPet, table: "pets", name: "name"},
+	{entity: EntityMedicalRecord, table: "medical_records", name: "reason_for_visit"},
+	{entity: EntityProduct, table: "products", name: "name"},
+}
+
+// trashCascade is a table whose rows go to the trash along with the parent
+// row they reference
+type trashCascade struct {
+	parent string
+	table  string
+	column string
+}
+
+// trashCascades follows the same cascades as MemoryStore.DeleteUser,
+// DeletePet and DeleteProduct
+var trashCascades = []trashCascade{
+	{parent: "clients", table: "pets", column: "owner_id"},
+	{parent: "pets", table: "medical_records", column: "pet_id"},
+	{parent: "veterinarians", table: "products", column: "veterinarian_id"},
+}
+
+// softDeleted reports whether table keeps deleted rows with deleted_at set
+func softDeleted(table string) bool {
+	return slices.ContainsFunc(trashTables, func(t trashTable) bool { return t.table == table })
+}
+
+// trashTablesFor returns the tables holding entity, or all of them when
+// entity is empty
+func trashTablesFor(entity string) ([]trashTable, error) {
+	if entity == "" {
+		return trashTables, nil
+	}
+	if !slices.Contains(TrashEntities, entity) {
+		return nil, fmt.Errorf("unknown trash entity %q", entity)
+	}
+	var tables []trashTable
+	for _, t := range trashTables {
+		if t.entity == entity {
+			tables = append(tables, t)
+		}
+	}
+	return tables, nil
+}
+
+// trashKey is the cursor for ListTrash, which lists the most recently
+// deleted rows first
+func trashKey(item TrashItem) cursor {
+	return cursor{Sort: sortByDeletion, CreatedAt: item.DeletedAt, ID: item.ID}
+}
+
+// sortTrash orders items like ListTrash
+func sortTrash(items []TrashItem) {
+	slices.SortFunc(items, func(a, b TrashItem) int {
+		return trashKey(a).compare(trashKey(b))
+	})
+}
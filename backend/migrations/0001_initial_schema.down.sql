@@ -0,0 +1,11 @@
+-- Reverts 0001_initial_schema. Drops every table, so all data is lost.
+DROP FUNCTION IF EXISTS place_order(JSONB, JSONB);
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS qr_codes;
+DROP TABLE IF EXISTS medical_records;
+DROP TABLE IF EXISTS appointments;
+DROP TABLE IF EXISTS pets;
+DROP TABLE IF EXISTS veterinarians;
+DROP TABLE IF EXISTS clients;
@@ -0,0 +1,13 @@
+-- Full-text search over product name, description and SKU. The 'simple'
+-- configuration skips stemming so SKUs and brand names match as typed; the
+-- API builds prefix queries (term:*) so partial words still match.
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector(
+            'simple',
+            COALESCE(name, '') || ' ' || COALESCE(description, '') || ' ' || COALESCE(sku, '')
+        )
+    ) STORED;
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_price ON products(price);
+CREATE INDEX IF NOT EXISTS idx_products_brand_lower ON products(lower(brand));
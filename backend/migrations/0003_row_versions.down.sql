@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS products_bump_version ON products;
+DROP TRIGGER IF EXISTS appointments_bump_version ON appointments;
+DROP TRIGGER IF EXISTS medical_records_bump_version ON medical_records;
+DROP TRIGGER IF EXISTS pets_bump_version ON pets;
+
+ALTER TABLE products DROP COLUMN IF EXISTS version;
+ALTER TABLE appointments DROP COLUMN IF EXISTS version;
+ALTER TABLE medical_records DROP COLUMN IF EXISTS version;
+ALTER TABLE pets DROP COLUMN IF EXISTS version;
+
+DROP FUNCTION IF EXISTS bump_row_version();
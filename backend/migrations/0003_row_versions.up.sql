@@ -0,0 +1,24 @@
+-- Row versions for optimistic concurrency. Every UPDATE bumps version through
+-- a trigger, so stock decrements inside place_order and PostgREST updates
+-- change the ETag too; the API rejects writes whose If-Match names an older
+-- version.
+CREATE OR REPLACE FUNCTION bump_row_version() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$;
+
+ALTER TABLE pets ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE medical_records ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE TRIGGER pets_bump_version
+    BEFORE UPDATE ON pets FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+CREATE OR REPLACE TRIGGER medical_records_bump_version
+    BEFORE UPDATE ON medical_records FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+CREATE OR REPLACE TRIGGER appointments_bump_version
+    BEFORE UPDATE ON appointments FOR EACH ROW EXECUTE FUNCTION bump_row_version();
+CREATE OR REPLACE TRIGGER products_bump_version
+    BEFORE UPDATE ON products FOR EACH ROW EXECUTE FUNCTION bump_row_version();
@@ -0,0 +1,12 @@
+-- Rows still in the trash become visible again
+DROP INDEX IF EXISTS idx_products_deleted_at;
+DROP INDEX IF EXISTS idx_medical_records_deleted_at;
+DROP INDEX IF EXISTS idx_pets_deleted_at;
+DROP INDEX IF EXISTS idx_veterinarians_deleted_at;
+DROP INDEX IF EXISTS idx_clients_deleted_at;
+
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE medical_records DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE pets DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE veterinarians DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE clients DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,98 @@
+-- Restore place_order without the ledger inserts
+CREATE OR REPLACE FUNCTION place_order(p_order JSONB, p_items JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_vet_id UUID := (p_order->>'veterinarian_id')::UUID;
+    v_line JSONB;
+    v_qty INTEGER;
+    v_price DECIMAL(10, 2);
+    v_product products %ROWTYPE;
+    v_total DECIMAL(10, 2) := 0;
+    v_items JSONB := '[]'::JSONB;
+BEGIN
+    IF jsonb_array_length(p_items) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_items) ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        UPDATE products
+        SET stock_quantity = stock_quantity - v_qty,
+            updated_at = NOW()
+        WHERE id = (v_line->>'product_id')::UUID
+            AND is_active
+            AND stock_quantity >= v_qty
+        RETURNING * INTO v_product;
+
+        IF NOT FOUND THEN
+            SELECT * INTO v_product FROM products
+            WHERE id = (v_line->>'product_id')::UUID AND is_active;
+            IF NOT FOUND THEN
+                RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+            END IF;
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', COALESCE(v_product.stock_quantity, 0)
+                )::TEXT;
+        END IF;
+
+        IF v_product.veterinarian_id <> v_vet_id THEN
+            RAISE EXCEPTION 'all products must be from the same veterinarian' USING ERRCODE = 'PS002';
+        END IF;
+
+        v_price := v_product.price;
+        v_total := v_total + v_price * v_qty;
+        v_items := v_items || jsonb_build_array(
+            jsonb_build_object(
+                'id', v_line->>'id',
+                'product_id', v_product.id,
+                'quantity', v_qty,
+                'unit_price', v_price,
+                'total_price', v_price * v_qty
+            )
+        );
+    END LOOP;
+
+    INSERT INTO orders (
+        id, client_id, veterinarian_id, total_amount, status, payment_status,
+        payment_method, shipping_address, delivery_method, notes, created_at, updated_at
+    )
+    VALUES (
+        (p_order->>'id')::UUID,
+        (p_order->>'client_id')::UUID,
+        v_vet_id,
+        v_total,
+        COALESCE(p_order->>'status', 'pending'),
+        COALESCE(p_order->>'payment_status', 'pending'),
+        p_order->>'payment_method',
+        p_order->>'shipping_address',
+        COALESCE(p_order->>'delivery_method', 'pickup'),
+        p_order->>'notes',
+        COALESCE((p_order->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_order->>'updated_at')::TIMESTAMPTZ, NOW())
+    );
+
+    INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price)
+    SELECT (item->>'id')::UUID,
+        (p_order->>'id')::UUID,
+        (item->>'product_id')::UUID,
+        (item->>'quantity')::INTEGER,
+        (item->>'unit_price')::DECIMAL(10, 2),
+        (item->>'total_price')::DECIMAL(10, 2)
+    FROM jsonb_array_elements(v_items) AS item;
+
+    RETURN jsonb_build_object('total_amount', v_total, 'items', v_items);
+END;
+$$;
+
+DROP FUNCTION IF EXISTS record_stock_movement(JSONB);
+DROP TABLE IF EXISTS stock_movements;
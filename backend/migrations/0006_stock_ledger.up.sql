@@ -0,0 +1,204 @@
+-- Inventory ledger. Every change to products.stock_quantity is recorded as a
+-- stock movement, so a product's stock equals the sum of its movements'
+-- quantities. actor_id has no foreign key so movements outlive the users they
+-- name; a purged order only clears order_id.
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('sale', 'cancellation', 'adjustment', 'received', 'write_off')),
+    quantity INTEGER NOT NULL,
+    balance_after INTEGER NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    actor_id TEXT NOT NULL DEFAULT '',
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (
+        (type IN ('sale', 'write_off') AND quantity < 0)
+        OR (type IN ('cancellation', 'received') AND quantity > 0)
+        OR (type = 'adjustment' AND quantity <> 0)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product_id
+    ON stock_movements(product_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_order_id ON stock_movements(order_id);
+
+-- Open the ledger with each product's current stock
+INSERT INTO stock_movements (product_id, type, quantity, balance_after, reason)
+SELECT p.id, 'adjustment', p.stock_quantity, p.stock_quantity, 'Opening balance'
+FROM products p
+WHERE COALESCE(p.stock_quantity, 0) <> 0
+    AND NOT EXISTS (SELECT 1 FROM stock_movements m WHERE m.product_id = p.id);
+
+-- Applies one movement to a product's stock and appends it to the ledger, used
+-- by the Supabase store (POST /rpc/record_stock_movement). The conditional
+-- UPDATE keeps concurrent movements from taking stock below zero. Raises PS001
+-- (insufficient stock, DETAIL holds JSON with product_id/requested/available)
+-- or P0002 (not found). Returns the stored movement.
+CREATE OR REPLACE FUNCTION record_stock_movement(p_movement JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_product_id UUID := (p_movement->>'product_id')::UUID;
+    v_qty INTEGER := (p_movement->>'quantity')::INTEGER;
+    v_balance INTEGER;
+    v_movement stock_movements %ROWTYPE;
+BEGIN
+    UPDATE products
+    SET stock_quantity = COALESCE(stock_quantity, 0) + v_qty,
+        updated_at = NOW()
+    WHERE id = v_product_id
+        AND deleted_at IS NULL
+        AND COALESCE(stock_quantity, 0) + v_qty >= 0
+    RETURNING stock_quantity INTO v_balance;
+
+    IF NOT FOUND THEN
+        SELECT COALESCE(stock_quantity, 0) INTO v_balance FROM products
+        WHERE id = v_product_id AND deleted_at IS NULL;
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'product % not found', v_product_id USING ERRCODE = 'P0002';
+        END IF;
+        RAISE EXCEPTION 'insufficient stock for product %', v_product_id USING
+            ERRCODE = 'PS001',
+            DETAIL = jsonb_build_object(
+                'product_id', v_product_id,
+                'requested', -v_qty,
+                'available', v_balance
+            )::TEXT;
+    END IF;
+
+    INSERT INTO stock_movements (
+        id, product_id, type, quantity, balance_after, reason, actor_id, order_id, created_at
+    )
+    VALUES (
+        (p_movement->>'id')::UUID,
+        v_product_id,
+        p_movement->>'type',
+        v_qty,
+        v_balance,
+        COALESCE(p_movement->>'reason', ''),
+        COALESCE(p_movement->>'actor_id', ''),
+        NULLIF(p_movement->>'order_id', '')::UUID,
+        COALESCE((p_movement->>'created_at')::TIMESTAMPTZ, NOW())
+    )
+    RETURNING * INTO v_movement;
+
+    RETURN to_jsonb(v_movement);
+END;
+$$;
+
+-- Atomic order placement used by the Supabase store (POST /rpc/place_order).
+-- Inserts the order and its items, decrements stock and records one sale
+-- stock movement per line in one transaction.
+-- Stock is decremented with a conditional UPDATE so concurrent buyers cannot
+-- oversell. Raises PS001 (insufficient stock, DETAIL holds JSON with
+-- product_id/requested/available), PS002 (invalid order) or P0002 (not found).
+CREATE OR REPLACE FUNCTION place_order(p_order JSONB, p_items JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_vet_id UUID := (p_order->>'veterinarian_id')::UUID;
+    v_line JSONB;
+    v_qty INTEGER;
+    v_price DECIMAL(10, 2);
+    v_product products %ROWTYPE;
+    v_total DECIMAL(10, 2) := 0;
+    v_items JSONB := '[]'::JSONB;
+    v_sales JSONB := '[]'::JSONB;
+BEGIN
+    IF jsonb_array_length(p_items) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_items) ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        UPDATE products
+        SET stock_quantity = stock_quantity - v_qty,
+            updated_at = NOW()
+        WHERE id = (v_line->>'product_id')::UUID
+            AND is_active
+            AND stock_quantity >= v_qty
+        RETURNING * INTO v_product;
+
+        IF NOT FOUND THEN
+            SELECT * INTO v_product FROM products
+            WHERE id = (v_line->>'product_id')::UUID AND is_active;
+            IF NOT FOUND THEN
+                RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+            END IF;
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', COALESCE(v_product.stock_quantity, 0)
+                )::TEXT;
+        END IF;
+
+        IF v_product.veterinarian_id <> v_vet_id THEN
+            RAISE EXCEPTION 'all products must be from the same veterinarian' USING ERRCODE = 'PS002';
+        END IF;
+
+        v_price := v_product.price;
+        v_total := v_total + v_price * v_qty;
+        v_items := v_items || jsonb_build_array(
+            jsonb_build_object(
+                'id', v_line->>'id',
+                'product_id', v_product.id,
+                'quantity', v_qty,
+                'unit_price', v_price,
+                'total_price', v_price * v_qty
+            )
+        );
+        v_sales := v_sales || jsonb_build_array(
+            jsonb_build_object(
+                'product_id', v_product.id,
+                'quantity', -v_qty,
+                'balance_after', v_product.stock_quantity
+            )
+        );
+    END LOOP;
+
+    INSERT INTO orders (
+        id, client_id, veterinarian_id, total_amount, status, payment_status,
+        payment_method, shipping_address, delivery_method, notes, created_at, updated_at
+    )
+    VALUES (
+        (p_order->>'id')::UUID,
+        (p_order->>'client_id')::UUID,
+        v_vet_id,
+        v_total,
+        COALESCE(p_order->>'status', 'pending'),
+        COALESCE(p_order->>'payment_status', 'pending'),
+        p_order->>'payment_method',
+        p_order->>'shipping_address',
+        COALESCE(p_order->>'delivery_method', 'pickup'),
+        p_order->>'notes',
+        COALESCE((p_order->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_order->>'updated_at')::TIMESTAMPTZ, NOW())
+    );
+
+    INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price)
+    SELECT (item->>'id')::UUID,
+        (p_order->>'id')::UUID,
+        (item->>'product_id')::UUID,
+        (item->>'quantity')::INTEGER,
+        (item->>'unit_price')::DECIMAL(10, 2),
+        (item->>'total_price')::DECIMAL(10, 2)
+    FROM jsonb_array_elements(v_items) AS item;
+
+    INSERT INTO stock_movements (product_id, type, quantity, balance_after, actor_id, order_id)
+    SELECT (sale->>'product_id')::UUID,
+        'sale',
+        (sale->>'quantity')::INTEGER,
+        (sale->>'balance_after')::INTEGER,
+        p_order->>'client_id',
+        (p_order->>'id')::UUID
+    FROM jsonb_array_elements(v_sales) AS sale;
+
+    RETURN jsonb_build_object('total_amount', v_total, 'items', v_items);
+END;
+$$;
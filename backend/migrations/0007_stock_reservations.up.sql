@@ -0,0 +1,245 @@
+-- Stock reservations held during checkout. items is a JSON array of
+-- {product_id, quantity}. A reservation holds its stock while it is active
+-- and unexpired; the API's sweeper marks lapsed ones expired.
+CREATE TABLE IF NOT EXISTS reservations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'released', 'expired', 'converted')),
+    items JSONB NOT NULL,
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservations_active ON reservations(expires_at)
+    WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_reservations_client_id ON reservations(client_id);
+
+-- How much of a product active, unexpired reservations hold. Callers lock the
+-- product row first so the sum cannot change underneath them.
+CREATE OR REPLACE FUNCTION reserved_stock(p_product_id UUID) RETURNS INTEGER LANGUAGE sql AS $$
+    SELECT COALESCE(SUM((item->>'quantity')::INTEGER), 0)::INTEGER
+    FROM reservations r, jsonb_array_elements(r.items) AS item
+    WHERE r.status = 'active'
+        AND r.expires_at > NOW()
+        AND (item->>'product_id')::UUID = p_product_id;
+$$;
+
+-- Reserves stock for a checkout, used by the Supabase store
+-- (POST /rpc/create_reservation). Raises PS001 (insufficient stock, DETAIL
+-- holds JSON with product_id/requested/available), PS002 (invalid
+-- reservation) or P0002 (not found).
+CREATE OR REPLACE FUNCTION create_reservation(p_reservation JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_line JSONB;
+    v_qty INTEGER;
+    v_product products %ROWTYPE;
+    v_available INTEGER;
+    v_reservation reservations %ROWTYPE;
+BEGIN
+    IF jsonb_array_length(COALESCE(p_reservation->'items', '[]'::JSONB)) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_reservation->'items') ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        SELECT * INTO v_product FROM products
+        WHERE id = (v_line->>'product_id')::UUID AND is_active AND deleted_at IS NULL
+        FOR UPDATE;
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+        END IF;
+
+        v_available := COALESCE(v_product.stock_quantity, 0) - reserved_stock(v_product.id);
+        IF v_available < v_qty THEN
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', v_available
+                )::TEXT;
+        END IF;
+    END LOOP;
+
+    INSERT INTO reservations (id, client_id, status, items, expires_at, created_at, updated_at)
+    VALUES (
+        (p_reservation->>'id')::UUID,
+        (p_reservation->>'client_id')::UUID,
+        'active',
+        p_reservation->'items',
+        (p_reservation->>'expires_at')::TIMESTAMPTZ,
+        COALESCE((p_reservation->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_reservation->>'updated_at')::TIMESTAMPTZ, NOW())
+    )
+    RETURNING * INTO v_reservation;
+
+    RETURN to_jsonb(v_reservation);
+END;
+$$;
+
+-- Atomic order placement used by the Supabase store (POST /rpc/place_order).
+-- Inserts the order and its items, decrements stock and records one sale
+-- stock movement per line in one transaction.
+-- Stock is decremented with a conditional UPDATE so concurrent buyers cannot
+-- oversell, and only stock that no reservation holds can be sold. Raises PS001 (insufficient stock, DETAIL holds JSON with
+-- product_id/requested/available), PS002 (invalid order) or P0002 (not found).
+CREATE OR REPLACE FUNCTION place_order(p_order JSONB, p_items JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_vet_id UUID := (p_order->>'veterinarian_id')::UUID;
+    v_line JSONB;
+    v_qty INTEGER;
+    v_price DECIMAL(10, 2);
+    v_product products %ROWTYPE;
+    v_total DECIMAL(10, 2) := 0;
+    v_items JSONB := '[]'::JSONB;
+    v_sales JSONB := '[]'::JSONB;
+BEGIN
+    IF jsonb_array_length(p_items) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_items) ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        UPDATE products
+        SET stock_quantity = stock_quantity - v_qty,
+            updated_at = NOW()
+        WHERE id = (v_line->>'product_id')::UUID
+            AND is_active
+            AND stock_quantity - reserved_stock(id) >= v_qty
+        RETURNING * INTO v_product;
+
+        IF NOT FOUND THEN
+            SELECT * INTO v_product FROM products
+            WHERE id = (v_line->>'product_id')::UUID AND is_active;
+            IF NOT FOUND THEN
+                RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+            END IF;
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', COALESCE(v_product.stock_quantity, 0) - reserved_stock(v_product.id)
+                )::TEXT;
+        END IF;
+
+        IF v_product.veterinarian_id <> v_vet_id THEN
+            RAISE EXCEPTION 'all products must be from the same veterinarian' USING ERRCODE = 'PS002';
+        END IF;
+
+        v_price := v_product.price;
+        v_total := v_total + v_price * v_qty;
+        v_items := v_items || jsonb_build_array(
+            jsonb_build_object(
+                'id', v_line->>'id',
+                'product_id', v_product.id,
+                'quantity', v_qty,
+                'unit_price', v_price,
+                'total_price', v_price * v_qty
+            )
+        );
+        v_sales := v_sales || jsonb_build_array(
+            jsonb_build_object(
+                'product_id', v_product.id,
+                'quantity', -v_qty,
+                'balance_after', v_product.stock_quantity
+            )
+        );
+    END LOOP;
+
+    INSERT INTO orders (
+        id, client_id, veterinarian_id, total_amount, status, payment_status,
+        payment_method, shipping_address, delivery_method, notes, created_at, updated_at
+    )
+    VALUES (
+        (p_order->>'id')::UUID,
+        (p_order->>'client_id')::UUID,
+        v_vet_id,
+        v_total,
+        COALESCE(p_order->>'status', 'pending'),
+        COALESCE(p_order->>'payment_status', 'pending'),
+        p_order->>'payment_method',
+        p_order->>'shipping_address',
+        COALESCE(p_order->>'delivery_method', 'pickup'),
+        p_order->>'notes',
+        COALESCE((p_order->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_order->>'updated_at')::TIMESTAMPTZ, NOW())
+    );
+
+    INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price)
+    SELECT (item->>'id')::UUID,
+        (p_order->>'id')::UUID,
+        (item->>'product_id')::UUID,
+        (item->>'quantity')::INTEGER,
+        (item->>'unit_price')::DECIMAL(10, 2),
+        (item->>'total_price')::DECIMAL(10, 2)
+    FROM jsonb_array_elements(v_items) AS item;
+
+    INSERT INTO stock_movements (product_id, type, quantity, balance_after, actor_id, order_id)
+    SELECT (sale->>'product_id')::UUID,
+        'sale',
+        (sale->>'quantity')::INTEGER,
+        (sale->>'balance_after')::INTEGER,
+        p_order->>'client_id',
+        (p_order->>'id')::UUID
+    FROM jsonb_array_elements(v_sales) AS sale;
+
+    RETURN jsonb_build_object('total_amount', v_total, 'items', v_items);
+END;
+$$;
+
+-- Converts a reservation into an order, used by the Supabase store
+-- (POST /rpc/confirm_reservation). The reservation stops holding its stock
+-- before place_order runs, so the order can take it. Raises PS003 when the
+-- reservation is no longer active, and whatever place_order raises. Returns
+-- what place_order returns.
+CREATE OR REPLACE FUNCTION confirm_reservation(p_reservation_id UUID, p_order JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_reservation reservations %ROWTYPE;
+    v_items JSONB;
+    v_placed JSONB;
+BEGIN
+    SELECT * INTO v_reservation FROM reservations WHERE id = p_reservation_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'reservation % not found', p_reservation_id USING ERRCODE = 'P0002';
+    END IF;
+    IF v_reservation.status <> 'active' OR v_reservation.expires_at <= NOW() THEN
+        RAISE EXCEPTION 'reservation % is no longer active', p_reservation_id USING ERRCODE = 'PS003';
+    END IF;
+    IF (p_order->>'client_id')::UUID <> v_reservation.client_id THEN
+        RAISE EXCEPTION 'order is not for the reservation''s client' USING ERRCODE = 'PS002';
+    END IF;
+
+    UPDATE reservations SET status = 'converted', updated_at = NOW() WHERE id = p_reservation_id;
+
+    SELECT jsonb_agg(jsonb_build_object(
+        'id', gen_random_uuid(),
+        'product_id', item->>'product_id',
+        'quantity', (item->>'quantity')::INTEGER
+    ))
+    INTO v_items
+    FROM jsonb_array_elements(v_reservation.items) AS item;
+
+    v_placed := place_order(p_order, v_items);
+
+    UPDATE reservations SET order_id = (p_order->>'id')::UUID WHERE id = p_reservation_id;
+    RETURN v_placed;
+END;
+$$;
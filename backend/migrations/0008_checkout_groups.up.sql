@@ -0,0 +1,189 @@
+-- Checkouts place a cart from several veterinarians as one order per
+-- veterinarian. The orders share the checkout's ID as checkout_group_id, and a
+-- confirmed reservation records the checkout it became.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_group_id UUID;
+CREATE INDEX IF NOT EXISTS idx_orders_checkout_group_id ON orders(checkout_group_id)
+    WHERE checkout_group_id IS NOT NULL;
+
+-- Reservations confirmed before checkouts existed became a single order,
+-- which forms a checkout of its own
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS checkout_id UUID;
+UPDATE orders o SET checkout_group_id = o.id
+FROM reservations r
+WHERE r.order_id = o.id AND o.checkout_group_id IS NULL;
+UPDATE reservations SET checkout_id = order_id WHERE order_id IS NOT NULL;
+ALTER TABLE reservations DROP COLUMN IF EXISTS order_id;
+
+-- place_order also stores the order's checkout group
+CREATE OR REPLACE FUNCTION place_order(p_order JSONB, p_items JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_vet_id UUID := (p_order->>'veterinarian_id')::UUID;
+    v_line JSONB;
+    v_qty INTEGER;
+    v_price DECIMAL(10, 2);
+    v_product products %ROWTYPE;
+    v_total DECIMAL(10, 2) := 0;
+    v_items JSONB := '[]'::JSONB;
+    v_sales JSONB := '[]'::JSONB;
+BEGIN
+    IF jsonb_array_length(p_items) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_items) ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        UPDATE products
+        SET stock_quantity = stock_quantity - v_qty,
+            updated_at = NOW()
+        WHERE id = (v_line->>'product_id')::UUID
+            AND is_active
+            AND stock_quantity - reserved_stock(id) >= v_qty
+        RETURNING * INTO v_product;
+
+        IF NOT FOUND THEN
+            SELECT * INTO v_product FROM products
+            WHERE id = (v_line->>'product_id')::UUID AND is_active;
+            IF NOT FOUND THEN
+                RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+            END IF;
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', COALESCE(v_product.stock_quantity, 0) - reserved_stock(v_product.id)
+                )::TEXT;
+        END IF;
+
+        IF v_product.veterinarian_id <> v_vet_id THEN
+            RAISE EXCEPTION 'all products must be from the same veterinarian' USING ERRCODE = 'PS002';
+        END IF;
+
+        v_price := v_product.price;
+        v_total := v_total + v_price * v_qty;
+        v_items := v_items || jsonb_build_array(
+            jsonb_build_object(
+                'id', v_line->>'id',
+                'product_id', v_product.id,
+                'quantity', v_qty,
+                'unit_price', v_price,
+                'total_price', v_price * v_qty
+            )
+        );
+        v_sales := v_sales || jsonb_build_array(
+            jsonb_build_object(
+                'product_id', v_product.id,
+                'quantity', -v_qty,
+                'balance_after', v_product.stock_quantity
+            )
+        );
+    END LOOP;
+
+    INSERT INTO orders (
+        id, client_id, veterinarian_id, total_amount, status, payment_status,
+        payment_method, shipping_address, delivery_method, notes, checkout_group_id,
+        created_at, updated_at
+    )
+    VALUES (
+        (p_order->>'id')::UUID,
+        (p_order->>'client_id')::UUID,
+        v_vet_id,
+        v_total,
+        COALESCE(p_order->>'status', 'pending'),
+        COALESCE(p_order->>'payment_status', 'pending'),
+        p_order->>'payment_method',
+        p_order->>'shipping_address',
+        COALESCE(p_order->>'delivery_method', 'pickup'),
+        p_order->>'notes',
+        (p_order->>'checkout_group_id')::UUID,
+        COALESCE((p_order->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_order->>'updated_at')::TIMESTAMPTZ, NOW())
+    );
+
+    INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price)
+    SELECT (item->>'id')::UUID,
+        (p_order->>'id')::UUID,
+        (item->>'product_id')::UUID,
+        (item->>'quantity')::INTEGER,
+        (item->>'unit_price')::DECIMAL(10, 2),
+        (item->>'total_price')::DECIMAL(10, 2)
+    FROM jsonb_array_elements(v_items) AS item;
+
+    INSERT INTO stock_movements (product_id, type, quantity, balance_after, actor_id, order_id)
+    SELECT (sale->>'product_id')::UUID,
+        'sale',
+        (sale->>'quantity')::INTEGER,
+        (sale->>'balance_after')::INTEGER,
+        p_order->>'client_id',
+        (p_order->>'id')::UUID
+    FROM jsonb_array_elements(v_sales) AS sale;
+
+    RETURN jsonb_build_object('total_amount', v_total, 'items', v_items);
+END;
+$$;
+
+
+-- Converts a reservation into a checkout, used by the Supabase store
+-- (POST /rpc/confirm_reservation). p_orders is a JSON array of
+-- {order, items}, one per veterinarian, that together must hold exactly the
+-- reservation's items. The reservation stops holding its stock before the
+-- orders are placed, so they can take them; if any order fails nothing is
+-- written. Raises PS003 when the reservation is no longer active, PS002 when
+-- the orders do not match it, and whatever place_order raises. Returns what
+-- place_order returned for each order, in the order given.
+DROP FUNCTION IF EXISTS confirm_reservation(UUID, JSONB);
+CREATE FUNCTION confirm_reservation(p_reservation_id UUID, p_orders JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_reservation reservations %ROWTYPE;
+    v_entry JSONB;
+    v_group_id UUID;
+    v_placed JSONB := '[]'::JSONB;
+BEGIN
+    SELECT * INTO v_reservation FROM reservations WHERE id = p_reservation_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'reservation % not found', p_reservation_id USING ERRCODE = 'P0002';
+    END IF;
+    IF v_reservation.status <> 'active' OR v_reservation.expires_at <= NOW() THEN
+        RAISE EXCEPTION 'reservation % is no longer active', p_reservation_id USING ERRCODE = 'PS003';
+    END IF;
+    IF jsonb_array_length(COALESCE(p_orders, '[]'::JSONB)) = 0 THEN
+        RAISE EXCEPTION 'at least one order is required' USING ERRCODE = 'PS002';
+    END IF;
+    IF EXISTS (
+        SELECT 1 FROM jsonb_array_elements(p_orders) AS entry
+        WHERE (entry->'order'->>'client_id')::UUID IS DISTINCT FROM v_reservation.client_id
+    ) THEN
+        RAISE EXCEPTION 'order is not for the reservation''s client' USING ERRCODE = 'PS002';
+    END IF;
+    IF (
+        SELECT jsonb_object_agg(product_id, quantity) FROM (
+            SELECT item->>'product_id' AS product_id, SUM((item->>'quantity')::INTEGER) AS quantity
+            FROM jsonb_array_elements(p_orders) AS entry,
+                jsonb_array_elements(entry->'items') AS item
+            GROUP BY 1
+        ) AS ordered
+    ) IS DISTINCT FROM (
+        SELECT jsonb_object_agg(item->>'product_id', (item->>'quantity')::INTEGER)
+        FROM jsonb_array_elements(v_reservation.items) AS item
+    ) THEN
+        RAISE EXCEPTION 'orders do not match the reservation''s items' USING ERRCODE = 'PS002';
+    END IF;
+
+    UPDATE reservations SET status = 'converted', updated_at = NOW() WHERE id = p_reservation_id;
+
+    FOR v_entry IN SELECT value FROM jsonb_array_elements(p_orders) LOOP
+        v_group_id := (v_entry->'order'->>'checkout_group_id')::UUID;
+        v_placed := v_placed || jsonb_build_array(place_order(v_entry->'order', v_entry->'items'));
+    END LOOP;
+
+    UPDATE reservations SET checkout_id = v_group_id WHERE id = p_reservation_id;
+    RETURN v_placed;
+END;
+$$;
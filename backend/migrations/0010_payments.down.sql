@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS set_payment_status(UUID, TEXT, TEXT);
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+DROP TABLE IF EXISTS payments;
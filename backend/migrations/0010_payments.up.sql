@@ -0,0 +1,59 @@
+-- Payment attempts made through a payment gateway. intent_id is the
+-- gateway's reference for the attempt. An order's payment_status follows its
+-- latest attempt.
+CREATE TABLE IF NOT EXISTS payments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    intent_id TEXT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'PHP' CHECK (currency ~ '^[A-Z]{3}$'),
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'paid', 'failed', 'refunded')),
+    failure_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, intent_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order_id ON payments(order_id);
+
+UPDATE orders SET payment_status = 'pending'
+WHERE payment_status IS NULL
+    OR payment_status NOT IN ('pending', 'paid', 'failed', 'refunded');
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'paid', 'failed', 'refunded'));
+
+-- Moves a payment attempt and its order's payment status together, used by
+-- the Supabase store (POST /rpc/set_payment_status). Pending attempts can be
+-- paid or fail and paid ones refunded. Raises P0002 when the payment does not
+-- exist and PS004 when it cannot move to p_status. Returns the payment.
+CREATE OR REPLACE FUNCTION set_payment_status(
+    p_payment_id UUID,
+    p_status TEXT,
+    p_failure_reason TEXT
+) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_payment payments %ROWTYPE;
+BEGIN
+    SELECT * INTO v_payment FROM payments WHERE id = p_payment_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'payment % not found', p_payment_id USING ERRCODE = 'P0002';
+    END IF;
+    IF NOT (
+        (v_payment.status = 'pending' AND p_status IN ('paid', 'failed'))
+        OR (v_payment.status = 'paid' AND p_status = 'refunded')
+    ) THEN
+        RAISE EXCEPTION 'payment % cannot move from % to %', p_payment_id, v_payment.status, p_status
+            USING ERRCODE = 'PS004';
+    END IF;
+
+    UPDATE payments
+    SET status = p_status, failure_reason = NULLIF(p_failure_reason, ''), updated_at = NOW()
+    WHERE id = p_payment_id
+    RETURNING * INTO v_payment;
+    UPDATE orders SET payment_status = p_status, updated_at = NOW() WHERE id = v_payment.order_id;
+
+    RETURN to_jsonb(v_payment);
+END;
+$$;
@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS transition_order(JSONB);
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+DROP TABLE IF EXISTS order_status_history;
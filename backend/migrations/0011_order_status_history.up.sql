@@ -0,0 +1,91 @@
+-- Orders move through a fixed lifecycle: pending, confirmed, processing,
+-- shipped and delivered, or cancelled before they ship. Every move is
+-- recorded with who made it and why.
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    actor_id TEXT NOT NULL DEFAULT '',
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id
+    ON order_status_history(order_id, created_at);
+
+UPDATE orders SET status = 'pending'
+WHERE status IS NULL
+    OR status NOT IN ('pending', 'confirmed', 'processing', 'shipped', 'delivered', 'cancelled');
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'confirmed', 'processing', 'shipped', 'delivered', 'cancelled'));
+
+-- Moves an order to a new status, used by the Supabase store
+-- (POST /rpc/transition_order). p_change is {id, order_id, from_status,
+-- to_status, actor_id, note, created_at}. The order must still be in
+-- from_status and the lifecycle must allow the move; cancelling restocks the
+-- order's items that are not in the trash with cancellation movements.
+-- Raises P0002 when the order does not exist and PS005 when it cannot move.
+CREATE OR REPLACE FUNCTION transition_order(p_change JSONB) RETURNS VOID LANGUAGE plpgsql AS $$
+DECLARE
+    v_order_id UUID := (p_change->>'order_id')::UUID;
+    v_from TEXT := p_change->>'from_status';
+    v_to TEXT := p_change->>'to_status';
+    v_at TIMESTAMPTZ := COALESCE((p_change->>'created_at')::TIMESTAMPTZ, NOW());
+    v_current TEXT;
+    v_item order_items %ROWTYPE;
+    v_balance INTEGER;
+BEGIN
+    SELECT status INTO v_current FROM orders WHERE id = v_order_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'order % not found', v_order_id USING ERRCODE = 'P0002';
+    END IF;
+    IF v_current IS DISTINCT FROM v_from THEN
+        RAISE EXCEPTION 'order % is %, not %', v_order_id, v_current, v_from USING ERRCODE = 'PS005';
+    END IF;
+    IF NOT (v_from, v_to) IN (
+        ('pending', 'confirmed'), ('pending', 'cancelled'),
+        ('confirmed', 'processing'), ('confirmed', 'cancelled'),
+        ('processing', 'shipped'), ('processing', 'delivered'), ('processing', 'cancelled'),
+        ('shipped', 'delivered')
+    ) THEN
+        RAISE EXCEPTION 'order % cannot move from % to %', v_order_id, v_from, v_to
+            USING ERRCODE = 'PS005';
+    END IF;
+
+    IF v_to = 'cancelled' THEN
+        FOR v_item IN
+            SELECT i.* FROM order_items i
+            JOIN products p ON p.id = i.product_id AND p.deleted_at IS NULL
+            WHERE i.order_id = v_order_id
+            ORDER BY i.product_id
+        LOOP
+            UPDATE products
+            SET stock_quantity = COALESCE(stock_quantity, 0) + v_item.quantity,
+                updated_at = NOW()
+            WHERE id = v_item.product_id
+            RETURNING stock_quantity INTO v_balance;
+
+            INSERT INTO stock_movements (
+                product_id, type, quantity, balance_after, reason, actor_id, order_id, created_at
+            )
+            VALUES (
+                v_item.product_id, 'cancellation', v_item.quantity, v_balance,
+                'Order cancelled', COALESCE(p_change->>'actor_id', ''), v_order_id, v_at
+            );
+        END LOOP;
+    END IF;
+
+    UPDATE orders SET status = v_to, updated_at = v_at WHERE id = v_order_id;
+    INSERT INTO order_status_history (id, order_id, from_status, to_status, actor_id, note, created_at)
+    VALUES (
+        COALESCE((p_change->>'id')::UUID, gen_random_uuid()),
+        v_order_id,
+        v_from,
+        v_to,
+        COALESCE(p_change->>'actor_id', ''),
+        NULLIF(p_change->>'note', ''),
+        v_at
+    );
+END;
+$$;
@@ -0,0 +1,61 @@
+DROP FUNCTION IF EXISTS review_return(JSONB);
+DROP FUNCTION IF EXISTS create_return(JSONB);
+DROP FUNCTION IF EXISTS record_payment_refund(UUID, DECIMAL, TEXT);
+DROP TABLE IF EXISTS return_items;
+DROP TABLE IF EXISTS returns;
+
+-- Restore the 0010 set_payment_status, which also refunds paid attempts in full
+CREATE OR REPLACE FUNCTION set_payment_status(
+    p_payment_id UUID,
+    p_status TEXT,
+    p_failure_reason TEXT
+) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_payment payments %ROWTYPE;
+BEGIN
+    SELECT * INTO v_payment FROM payments WHERE id = p_payment_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'payment % not found', p_payment_id USING ERRCODE = 'P0002';
+    END IF;
+    IF NOT (
+        (v_payment.status = 'pending' AND p_status IN ('paid', 'failed'))
+        OR (v_payment.status = 'paid' AND p_status = 'refunded')
+    ) THEN
+        RAISE EXCEPTION 'payment % cannot move from % to %', p_payment_id, v_payment.status, p_status
+            USING ERRCODE = 'PS004';
+    END IF;
+
+    UPDATE payments
+    SET status = p_status, failure_reason = NULLIF(p_failure_reason, ''), updated_at = NOW()
+    WHERE id = p_payment_id
+    RETURNING * INTO v_payment;
+    UPDATE orders SET payment_status = p_status, updated_at = NOW() WHERE id = v_payment.order_id;
+
+    RETURN to_jsonb(v_payment);
+END;
+$$;
+
+-- Return movements become adjustments, which keep their quantities
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS stock_movements_type_check;
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS stock_movements_check;
+UPDATE stock_movements SET type = 'adjustment' WHERE type = 'return';
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_type_check
+    CHECK (type IN ('sale', 'cancellation', 'adjustment', 'received', 'write_off'));
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_check
+    CHECK (
+        (type IN ('sale', 'write_off') AND quantity < 0)
+        OR (type IN ('cancellation', 'received') AND quantity > 0)
+        OR (type = 'adjustment' AND quantity <> 0)
+    );
+
+-- Partially refunded payments count as paid again
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+UPDATE orders SET payment_status = 'paid' WHERE payment_status = 'partially_refunded';
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'paid', 'failed', 'refunded'));
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+UPDATE payments SET status = 'paid' WHERE status = 'partially_refunded';
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'paid', 'failed', 'refunded'));
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_refunded_amount_check;
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_amount;
@@ -0,0 +1,293 @@
+-- Payments can be refunded in parts. refunded_amount is the total refunded
+-- so far; a payment is partially_refunded until all of it has been returned.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+UPDATE payments SET refunded_amount = amount WHERE status = 'refunded';
+ALTER TABLE payments ADD CONSTRAINT payments_refunded_amount_check
+    CHECK (refunded_amount >= 0 AND refunded_amount <= amount);
+
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'paid', 'failed', 'partially_refunded', 'refunded'));
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_payment_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_payment_status_check
+    CHECK (payment_status IN ('pending', 'paid', 'failed', 'partially_refunded', 'refunded'));
+
+-- Returned units that are restocked are recorded as 'return' movements
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS stock_movements_type_check;
+ALTER TABLE stock_movements DROP CONSTRAINT IF EXISTS stock_movements_check;
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_type_check
+    CHECK (type IN ('sale', 'cancellation', 'adjustment', 'received', 'write_off', 'return'));
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_check
+    CHECK (
+        (type IN ('sale', 'write_off') AND quantity < 0)
+        OR (type IN ('cancellation', 'received', 'return') AND quantity > 0)
+        OR (type = 'adjustment' AND quantity <> 0)
+    );
+
+-- Return requests (RMAs) for items of delivered orders. The order's
+-- veterinarian approves or rejects them; approved returns are refunded from
+-- the order's payment. refund_amount is what the items were bought for.
+CREATE TABLE IF NOT EXISTS returns (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    client_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'requested'
+        CHECK (status IN ('requested', 'approved', 'rejected', 'refunded')),
+    reason TEXT NOT NULL DEFAULT '',
+    reviewer_id TEXT,
+    review_note TEXT,
+    refund_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'PHP' CHECK (currency ~ '^[A-Z]{3}$'),
+    payment_id UUID REFERENCES payments(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_returns_order_id ON returns(order_id, created_at);
+
+-- position keeps items in the order the client listed them
+CREATE TABLE IF NOT EXISTS return_items (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    return_id UUID NOT NULL REFERENCES returns(id) ON DELETE CASCADE,
+    order_item_id UUID NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    disposition TEXT CHECK (disposition IN ('restock', 'write_off')),
+    refund_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'PHP' CHECK (currency ~ '^[A-Z]{3}$'),
+    position INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (return_id, order_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_return_items_order_item_id ON return_items(order_item_id);
+
+-- set_payment_status now only settles pending attempts; refunds go through
+-- record_payment_refund
+CREATE OR REPLACE FUNCTION set_payment_status(
+    p_payment_id UUID,
+    p_status TEXT,
+    p_failure_reason TEXT
+) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_payment payments %ROWTYPE;
+BEGIN
+    SELECT * INTO v_payment FROM payments WHERE id = p_payment_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'payment % not found', p_payment_id USING ERRCODE = 'P0002';
+    END IF;
+    IF NOT (v_payment.status = 'pending' AND p_status IN ('paid', 'failed')) THEN
+        RAISE EXCEPTION 'payment % cannot move from % to %', p_payment_id, v_payment.status, p_status
+            USING ERRCODE = 'PS004';
+    END IF;
+
+    UPDATE payments
+    SET status = p_status, failure_reason = NULLIF(p_failure_reason, ''), updated_at = NOW()
+    WHERE id = p_payment_id
+    RETURNING * INTO v_payment;
+    UPDATE orders SET payment_status = p_status, updated_at = NOW() WHERE id = v_payment.order_id;
+
+    RETURN to_jsonb(v_payment);
+END;
+$$;
+
+-- Records that p_refunded has been refunded of a paid attempt in total and
+-- moves it and its order to partially_refunded or refunded, used by the
+-- Supabase store (POST /rpc/record_payment_refund). Raises P0002 when the
+-- payment does not exist, PS004 when it is not paid or the total is already
+-- recorded and PS006 when the total is in another currency or exceeds the
+-- payment. Returns the payment.
+CREATE OR REPLACE FUNCTION record_payment_refund(
+    p_payment_id UUID,
+    p_refunded DECIMAL(10, 2),
+    p_currency TEXT
+) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_payment payments %ROWTYPE;
+BEGIN
+    SELECT * INTO v_payment FROM payments WHERE id = p_payment_id FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'payment % not found', p_payment_id USING ERRCODE = 'P0002';
+    END IF;
+    IF v_payment.status NOT IN ('paid', 'partially_refunded') THEN
+        RAISE EXCEPTION 'payment % cannot be refunded from %', p_payment_id, v_payment.status
+            USING ERRCODE = 'PS004';
+    END IF;
+    IF p_currency IS DISTINCT FROM v_payment.currency THEN
+        RAISE EXCEPTION 'refund in % of a payment in %', p_currency, v_payment.currency
+            USING ERRCODE = 'PS006';
+    END IF;
+    IF p_refunded > v_payment.amount THEN
+        RAISE EXCEPTION 'refunds of % exceed the payment of %', p_refunded, v_payment.amount
+            USING ERRCODE = 'PS006';
+    END IF;
+    IF p_refunded <= v_payment.refunded_amount THEN
+        RAISE EXCEPTION 'payment % already refunded %', p_payment_id, v_payment.refunded_amount
+            USING ERRCODE = 'PS004';
+    END IF;
+
+    UPDATE payments
+    SET refunded_amount = p_refunded,
+        status = CASE WHEN p_refunded = amount THEN 'refunded' ELSE 'partially_refunded' END,
+        updated_at = NOW()
+    WHERE id = p_payment_id
+    RETURNING * INTO v_payment;
+    UPDATE orders SET payment_status = v_payment.status, updated_at = NOW()
+    WHERE id = v_payment.order_id;
+
+    RETURN to_jsonb(v_payment);
+END;
+$$;
+
+-- Records a return request, used by the Supabase store
+-- (POST /rpc/create_return). p_return is {id, order_id, client_id, reason,
+-- created_at, items: [{id, order_item_id, quantity}]}. The order is locked so
+-- concurrent requests cannot return the same units twice; each item is priced
+-- at what it was bought for. Raises P0002 when the order does not exist and
+-- PS007 when it is not delivered or an item cannot be returned.
+CREATE OR REPLACE FUNCTION create_return(p_return JSONB) RETURNS VOID LANGUAGE plpgsql AS $$
+DECLARE
+    v_return_id UUID := (p_return->>'id')::UUID;
+    v_at TIMESTAMPTZ := COALESCE((p_return->>'created_at')::TIMESTAMPTZ, NOW());
+    v_order orders %ROWTYPE;
+    v_line RECORD;
+    v_item order_items %ROWTYPE;
+    v_qty INTEGER;
+    v_returned INTEGER;
+    v_total DECIMAL(10, 2) := 0;
+BEGIN
+    SELECT * INTO v_order FROM orders WHERE id = (p_return->>'order_id')::UUID FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'order % not found', p_return->>'order_id' USING ERRCODE = 'P0002';
+    END IF;
+    IF v_order.status <> 'delivered' THEN
+        RAISE EXCEPTION 'order % is %, only delivered orders can be returned', v_order.id, v_order.status
+            USING ERRCODE = 'PS007';
+    END IF;
+
+    INSERT INTO returns (id, order_id, client_id, status, reason, currency, created_at, updated_at)
+    VALUES (
+        v_return_id,
+        v_order.id,
+        (p_return->>'client_id')::UUID,
+        'requested',
+        COALESCE(p_return->>'reason', ''),
+        v_order.currency,
+        v_at,
+        v_at
+    );
+
+    FOR v_line IN
+        SELECT value AS item, ordinality - 1 AS position
+        FROM jsonb_array_elements(p_return->'items') WITH ORDINALITY
+    LOOP
+        v_qty := (v_line.item->>'quantity')::INTEGER;
+        SELECT * INTO v_item FROM order_items
+        WHERE id = (v_line.item->>'order_item_id')::UUID AND order_id = v_order.id;
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'item % is not part of order %', v_line.item->>'order_item_id', v_order.id
+                USING ERRCODE = 'PS007';
+        END IF;
+
+        SELECT COALESCE(SUM(ri.quantity), 0) INTO v_returned
+        FROM return_items ri
+        JOIN returns r ON r.id = ri.return_id
+        WHERE ri.order_item_id = v_item.id AND r.status <> 'rejected';
+        IF v_qty > v_item.quantity - v_returned THEN
+            RAISE EXCEPTION 'only % of item % can still be returned', v_item.quantity - v_returned, v_item.id
+                USING ERRCODE = 'PS007';
+        END IF;
+
+        INSERT INTO return_items (
+            id, return_id, order_item_id, product_id, quantity, refund_amount, currency, position
+        )
+        VALUES (
+            (v_line.item->>'id')::UUID,
+            v_return_id,
+            v_item.id,
+            v_item.product_id,
+            v_qty,
+            v_item.unit_price * v_qty,
+            v_item.currency,
+            v_line.position
+        );
+        v_total := v_total + v_item.unit_price * v_qty;
+    END LOOP;
+
+    UPDATE returns SET refund_amount = v_total WHERE id = v_return_id;
+END;
+$$;
+
+-- Approves or rejects a requested return, used by the Supabase store
+-- (POST /rpc/review_return). p_review is {return_id, status, reviewer_id,
+-- note, dispositions: {item id: 'restock' | 'write_off'}}. Approved items are
+-- restocked unless marked write_off or their product is in the trash.
+-- Raises P0002 when the return does not exist, PS008 when it was already
+-- reviewed and PS007 when the review is invalid.
+CREATE OR REPLACE FUNCTION review_return(p_review JSONB) RETURNS VOID LANGUAGE plpgsql AS $$
+DECLARE
+    v_status TEXT := p_review->>'status';
+    v_dispositions JSONB := COALESCE(p_review->'dispositions', '{}'::JSONB);
+    v_now TIMESTAMPTZ := NOW();
+    v_return returns %ROWTYPE;
+    v_item return_items %ROWTYPE;
+    v_disposition TEXT;
+    v_balance INTEGER;
+BEGIN
+    SELECT * INTO v_return FROM returns WHERE id = (p_review->>'return_id')::UUID FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'return % not found', p_review->>'return_id' USING ERRCODE = 'P0002';
+    END IF;
+    IF v_return.status <> 'requested' THEN
+        RAISE EXCEPTION 'return % cannot move from % to %', v_return.id, v_return.status, v_status
+            USING ERRCODE = 'PS008';
+    END IF;
+    IF v_status IS NULL OR v_status NOT IN ('approved', 'rejected') THEN
+        RAISE EXCEPTION 'a review approves or rejects' USING ERRCODE = 'PS007';
+    END IF;
+    IF EXISTS (
+        SELECT 1 FROM jsonb_object_keys(v_dispositions) AS k(id)
+        WHERE NOT EXISTS (
+            SELECT 1 FROM return_items WHERE return_id = v_return.id AND id::TEXT = k.id
+        )
+    ) THEN
+        RAISE EXCEPTION 'dispositions name items outside return %', v_return.id
+            USING ERRCODE = 'PS007';
+    END IF;
+
+    UPDATE returns
+    SET status = v_status,
+        reviewer_id = NULLIF(p_review->>'reviewer_id', ''),
+        review_note = NULLIF(p_review->>'note', ''),
+        updated_at = v_now
+    WHERE id = v_return.id;
+    IF v_status = 'rejected' THEN
+        RETURN;
+    END IF;
+
+    FOR v_item IN
+        SELECT * FROM return_items WHERE return_id = v_return.id ORDER BY product_id
+    LOOP
+        v_disposition := COALESCE(v_dispositions->>v_item.id::TEXT, 'restock');
+        IF v_disposition NOT IN ('restock', 'write_off') THEN
+            RAISE EXCEPTION 'unknown disposition % for item %', v_disposition, v_item.id
+                USING ERRCODE = 'PS007';
+        END IF;
+        UPDATE return_items SET disposition = v_disposition WHERE id = v_item.id;
+        CONTINUE WHEN v_disposition <> 'restock';
+
+        UPDATE products
+        SET stock_quantity = COALESCE(stock_quantity, 0) + v_item.quantity, updated_at = NOW()
+        WHERE id = v_item.product_id AND deleted_at IS NULL
+        RETURNING stock_quantity INTO v_balance;
+        CONTINUE WHEN NOT FOUND;
+
+        INSERT INTO stock_movements (
+            product_id, type, quantity, balance_after, reason, actor_id, order_id, created_at
+        )
+        VALUES (
+            v_item.product_id, 'return', v_item.quantity, v_balance, 'Order returned',
+            COALESCE(p_review->>'reviewer_id', ''), v_return.order_id, v_now
+        );
+    END LOOP;
+END;
+$$;
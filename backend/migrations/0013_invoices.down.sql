@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS issue_invoice(JSONB);
+DROP TABLE IF EXISTS invoice_sequences;
+DROP TABLE IF EXISTS invoices;
+DROP FUNCTION IF EXISTS reject_invoice_change();
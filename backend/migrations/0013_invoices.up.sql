@@ -0,0 +1,114 @@
+-- Invoices and credit notes. Each row is a snapshot of what was sold and to
+-- whom, taken when it was issued, so it has no foreign keys to the rows it was
+-- made from and outlives them. Issued rows are never changed: triggers reject
+-- any UPDATE, DELETE or TRUNCATE.
+CREATE TABLE IF NOT EXISTS invoices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind TEXT NOT NULL CHECK (kind IN ('invoice', 'credit_note')),
+    number TEXT NOT NULL,
+    sequence INTEGER NOT NULL CHECK (sequence > 0),
+    order_id UUID NOT NULL,
+    veterinarian_id UUID NOT NULL,
+    client_id UUID NOT NULL,
+    invoice_id UUID REFERENCES invoices(id),
+    invoice_number TEXT,
+    return_id UUID,
+    seller JSONB NOT NULL,
+    buyer JSONB NOT NULL,
+    lines JSONB NOT NULL,
+    subtotal DECIMAL(10, 2) NOT NULL,
+    tax DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    total DECIMAL(10, 2) NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'PHP' CHECK (currency ~ '^[A-Z]{3}$'),
+    payment_status TEXT NOT NULL,
+    issued_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (veterinarian_id, kind, sequence),
+    CHECK ((kind = 'credit_note') = (invoice_id IS NOT NULL))
+);
+
+-- One invoice per order and one credit note per return
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_order_invoice
+    ON invoices(order_id) WHERE kind = 'invoice';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_return_credit_note
+    ON invoices(return_id) WHERE return_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_invoices_order_id ON invoices(order_id, kind, sequence);
+
+-- The last number each veterinarian issued of each kind. Numbering takes the
+-- row lock, so numbers are consecutive and never reused, even after purges.
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    veterinarian_id UUID NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('invoice', 'credit_note')),
+    last_sequence INTEGER NOT NULL,
+    PRIMARY KEY (veterinarian_id, kind)
+);
+
+CREATE OR REPLACE FUNCTION reject_invoice_change() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'issued invoices cannot be changed' USING ERRCODE = 'insufficient_privilege';
+END;
+$$;
+
+CREATE OR REPLACE TRIGGER invoices_append_only
+    BEFORE UPDATE OR DELETE ON invoices
+    FOR EACH ROW EXECUTE FUNCTION reject_invoice_change();
+CREATE OR REPLACE TRIGGER invoices_no_truncate
+    BEFORE TRUNCATE ON invoices
+    FOR EACH STATEMENT EXECUTE FUNCTION reject_invoice_change();
+
+-- issue_invoice numbers and inserts an invoice or credit note given as the
+-- JSON encoding of store.Invoice, returning its sequence and number
+CREATE OR REPLACE FUNCTION issue_invoice(p_invoice JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_kind TEXT := p_invoice->>'kind';
+    v_vet_id UUID := (p_invoice->>'veterinarian_id')::UUID;
+    v_sequence INTEGER;
+    v_number TEXT;
+BEGIN
+    IF v_kind = 'credit_note' AND NOT EXISTS (
+        SELECT 1 FROM invoices
+        WHERE id = (p_invoice->>'invoice_id')::UUID
+            AND kind = 'invoice'
+            AND order_id = (p_invoice->>'order_id')::UUID
+    ) THEN
+        RAISE EXCEPTION 'invoice % not found', p_invoice->>'invoice_id' USING ERRCODE = 'P0002';
+    END IF;
+
+    INSERT INTO invoice_sequences (veterinarian_id, kind, last_sequence)
+    VALUES (v_vet_id, v_kind, 1)
+    ON CONFLICT (veterinarian_id, kind)
+    DO UPDATE SET last_sequence = invoice_sequences.last_sequence + 1
+    RETURNING last_sequence INTO v_sequence;
+
+    v_number := CASE v_kind WHEN 'invoice' THEN 'INV-' ELSE 'CN-' END
+        || lpad(v_sequence::TEXT, 6, '0');
+
+    INSERT INTO invoices (
+        id, kind, number, sequence, order_id, veterinarian_id, client_id, invoice_id,
+        invoice_number, return_id, seller, buyer, lines, subtotal, tax, total, currency,
+        payment_status, issued_at
+    )
+    VALUES (
+        (p_invoice->>'id')::UUID,
+        v_kind,
+        v_number,
+        v_sequence,
+        (p_invoice->>'order_id')::UUID,
+        v_vet_id,
+        (p_invoice->>'client_id')::UUID,
+        NULLIF(p_invoice->>'invoice_id', '')::UUID,
+        NULLIF(p_invoice->>'invoice_number', ''),
+        NULLIF(p_invoice->>'return_id', '')::UUID,
+        p_invoice->'seller',
+        p_invoice->'buyer',
+        p_invoice->'lines',
+        (p_invoice->'subtotal'->>'amount')::BIGINT / 100.0,
+        (p_invoice->'tax'->>'amount')::BIGINT / 100.0,
+        (p_invoice->'total'->>'amount')::BIGINT / 100.0,
+        COALESCE(NULLIF(p_invoice->'total'->>'currency', ''), 'PHP'),
+        p_invoice->>'payment_status',
+        COALESCE((p_invoice->>'issued_at')::TIMESTAMPTZ, NOW())
+    );
+
+    RETURN jsonb_build_object('sequence', v_sequence, 'number', v_number);
+END;
+$$;
@@ -0,0 +1,186 @@
+DROP TABLE IF EXISTS tax_settings;
+
+-- Restore the 0009 place_order, which charges no tax
+CREATE OR REPLACE FUNCTION place_order(p_order JSONB, p_items JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_vet_id UUID := (p_order->>'veterinarian_id')::UUID;
+    v_line JSONB;
+    v_qty INTEGER;
+    v_price DECIMAL(10, 2);
+    v_product products %ROWTYPE;
+    v_total DECIMAL(10, 2) := 0;
+    v_currency TEXT;
+    v_items JSONB := '[]'::JSONB;
+    v_sales JSONB := '[]'::JSONB;
+BEGIN
+    IF jsonb_array_length(p_items) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_items) ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        UPDATE products
+        SET stock_quantity = stock_quantity - v_qty,
+            updated_at = NOW()
+        WHERE id = (v_line->>'product_id')::UUID
+            AND is_active
+            AND stock_quantity - reserved_stock(id) >= v_qty
+        RETURNING * INTO v_product;
+
+        IF NOT FOUND THEN
+            SELECT * INTO v_product FROM products
+            WHERE id = (v_line->>'product_id')::UUID AND is_active;
+            IF NOT FOUND THEN
+                RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+            END IF;
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', COALESCE(v_product.stock_quantity, 0) - reserved_stock(v_product.id)
+                )::TEXT;
+        END IF;
+
+        IF v_product.veterinarian_id <> v_vet_id THEN
+            RAISE EXCEPTION 'all products must be from the same veterinarian' USING ERRCODE = 'PS002';
+        END IF;
+        IF v_currency IS NULL THEN
+            v_currency := v_product.currency;
+        ELSIF v_product.currency <> v_currency THEN
+            RAISE EXCEPTION 'all products must be priced in the same currency' USING ERRCODE = 'PS002';
+        END IF;
+
+        v_price := v_product.price;
+        v_total := v_total + v_price * v_qty;
+        v_items := v_items || jsonb_build_array(
+            jsonb_build_object(
+                'id', v_line->>'id',
+                'product_id', v_product.id,
+                'quantity', v_qty,
+                'unit_price', v_price,
+                'total_price', v_price * v_qty
+            )
+        );
+        v_sales := v_sales || jsonb_build_array(
+            jsonb_build_object(
+                'product_id', v_product.id,
+                'quantity', -v_qty,
+                'balance_after', v_product.stock_quantity
+            )
+        );
+    END LOOP;
+
+    INSERT INTO orders (
+        id, client_id, veterinarian_id, total_amount, currency, status, payment_status,
+        payment_method, shipping_address, delivery_method, notes, checkout_group_id,
+        created_at, updated_at
+    )
+    VALUES (
+        (p_order->>'id')::UUID,
+        (p_order->>'client_id')::UUID,
+        v_vet_id,
+        v_total,
+        v_currency,
+        COALESCE(p_order->>'status', 'pending'),
+        COALESCE(p_order->>'payment_status', 'pending'),
+        p_order->>'payment_method',
+        p_order->>'shipping_address',
+        COALESCE(p_order->>'delivery_method', 'pickup'),
+        p_order->>'notes',
+        (p_order->>'checkout_group_id')::UUID,
+        COALESCE((p_order->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_order->>'updated_at')::TIMESTAMPTZ, NOW())
+    );
+
+    INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price, currency)
+    SELECT (item->>'id')::UUID,
+        (p_order->>'id')::UUID,
+        (item->>'product_id')::UUID,
+        (item->>'quantity')::INTEGER,
+        (item->>'unit_price')::DECIMAL(10, 2),
+        (item->>'total_price')::DECIMAL(10, 2),
+        v_currency
+    FROM jsonb_array_elements(v_items) AS item;
+
+    INSERT INTO stock_movements (product_id, type, quantity, balance_after, actor_id, order_id)
+    SELECT (sale->>'product_id')::UUID,
+        'sale',
+        (sale->>'quantity')::INTEGER,
+        (sale->>'balance_after')::INTEGER,
+        p_order->>'client_id',
+        (p_order->>'id')::UUID
+    FROM jsonb_array_elements(v_sales) AS sale;
+
+    RETURN jsonb_build_object('total_amount', v_total, 'currency', v_currency, 'items', v_items);
+END;
+$$;
+
+-- Restore the 0013 issue_invoice
+CREATE OR REPLACE FUNCTION issue_invoice(p_invoice JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_kind TEXT := p_invoice->>'kind';
+    v_vet_id UUID := (p_invoice->>'veterinarian_id')::UUID;
+    v_sequence INTEGER;
+    v_number TEXT;
+BEGIN
+    IF v_kind = 'credit_note' AND NOT EXISTS (
+        SELECT 1 FROM invoices
+        WHERE id = (p_invoice->>'invoice_id')::UUID
+            AND kind = 'invoice'
+            AND order_id = (p_invoice->>'order_id')::UUID
+    ) THEN
+        RAISE EXCEPTION 'invoice % not found', p_invoice->>'invoice_id' USING ERRCODE = 'P0002';
+    END IF;
+
+    INSERT INTO invoice_sequences (veterinarian_id, kind, last_sequence)
+    VALUES (v_vet_id, v_kind, 1)
+    ON CONFLICT (veterinarian_id, kind)
+    DO UPDATE SET last_sequence = invoice_sequences.last_sequence + 1
+    RETURNING last_sequence INTO v_sequence;
+
+    v_number := CASE v_kind WHEN 'invoice' THEN 'INV-' ELSE 'CN-' END
+        || lpad(v_sequence::TEXT, 6, '0');
+
+    INSERT INTO invoices (
+        id, kind, number, sequence, order_id, veterinarian_id, client_id, invoice_id,
+        invoice_number, return_id, seller, buyer, lines, subtotal, tax, total, currency,
+        payment_status, issued_at
+    )
+    VALUES (
+        (p_invoice->>'id')::UUID,
+        v_kind,
+        v_number,
+        v_sequence,
+        (p_invoice->>'order_id')::UUID,
+        v_vet_id,
+        (p_invoice->>'client_id')::UUID,
+        NULLIF(p_invoice->>'invoice_id', '')::UUID,
+        NULLIF(p_invoice->>'invoice_number', ''),
+        NULLIF(p_invoice->>'return_id', '')::UUID,
+        p_invoice->'seller',
+        p_invoice->'buyer',
+        p_invoice->'lines',
+        (p_invoice->'subtotal'->>'amount')::BIGINT / 100.0,
+        (p_invoice->'tax'->>'amount')::BIGINT / 100.0,
+        (p_invoice->'total'->>'amount')::BIGINT / 100.0,
+        COALESCE(NULLIF(p_invoice->'total'->>'currency', ''), 'PHP'),
+        p_invoice->>'payment_status',
+        COALESCE((p_invoice->>'issued_at')::TIMESTAMPTZ, NOW())
+    );
+
+    RETURN jsonb_build_object('sequence', v_sequence, 'number', v_number);
+END;
+$$;
+
+ALTER TABLE invoices DROP COLUMN IF EXISTS tax_lines;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_lines;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_inclusive;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_amount;
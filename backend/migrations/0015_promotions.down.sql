@@ -0,0 +1,182 @@
+-- Restore the 0014 place_order, which applies no promotions
+CREATE OR REPLACE FUNCTION place_order(p_order JSONB, p_items JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_vet_id UUID := (p_order->>'veterinarian_id')::UUID;
+    v_line JSONB;
+    v_qty INTEGER;
+    v_price DECIMAL(10, 2);
+    v_product products %ROWTYPE;
+    v_total DECIMAL(10, 2) := 0;
+    v_currency TEXT;
+    v_items JSONB := '[]'::JSONB;
+    v_sales JSONB := '[]'::JSONB;
+    v_settings tax_settings%ROWTYPE;
+    v_inclusive BOOLEAN;
+    v_rate JSONB;
+    v_bps BIGINT;
+    v_taxable BIGINT;
+    v_amount BIGINT;
+    v_tax BIGINT := 0;
+    v_tax_lines JSONB := '[]'::JSONB;
+BEGIN
+    IF jsonb_array_length(p_items) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_items) ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        UPDATE products
+        SET stock_quantity = stock_quantity - v_qty,
+            updated_at = NOW()
+        WHERE id = (v_line->>'product_id')::UUID
+            AND is_active
+            AND stock_quantity - reserved_stock(id) >= v_qty
+        RETURNING * INTO v_product;
+
+        IF NOT FOUND THEN
+            SELECT * INTO v_product FROM products
+            WHERE id = (v_line->>'product_id')::UUID AND is_active;
+            IF NOT FOUND THEN
+                RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+            END IF;
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', COALESCE(v_product.stock_quantity, 0) - reserved_stock(v_product.id)
+                )::TEXT;
+        END IF;
+
+        IF v_product.veterinarian_id <> v_vet_id THEN
+            RAISE EXCEPTION 'all products must be from the same veterinarian' USING ERRCODE = 'PS002';
+        END IF;
+        IF v_currency IS NULL THEN
+            v_currency := v_product.currency;
+        ELSIF v_product.currency <> v_currency THEN
+            RAISE EXCEPTION 'all products must be priced in the same currency' USING ERRCODE = 'PS002';
+        END IF;
+
+        v_price := v_product.price;
+        v_total := v_total + v_price * v_qty;
+        v_items := v_items || jsonb_build_array(
+            jsonb_build_object(
+                'id', v_line->>'id',
+                'product_id', v_product.id,
+                'quantity', v_qty,
+                'unit_price', v_price,
+                'total_price', v_price * v_qty,
+                'category', COALESCE(v_product.category, '')
+            )
+        );
+        v_sales := v_sales || jsonb_build_array(
+            jsonb_build_object(
+                'product_id', v_product.id,
+                'quantity', -v_qty,
+                'balance_after', v_product.stock_quantity
+            )
+        );
+    END LOOP;
+
+    -- Tax in cents, as store.applyTax works it out: each rate on the items
+    -- it does not exempt, rounded half up, added on top unless inclusive
+    SELECT * INTO v_settings FROM tax_settings WHERE veterinarian_id = v_vet_id;
+    v_inclusive := COALESCE(v_settings.inclusive, false);
+    FOR v_rate IN SELECT value FROM jsonb_array_elements(COALESCE(v_settings.rates, '[]'::JSONB))
+    LOOP
+        v_bps := (v_rate->>'rate_bps')::BIGINT;
+        SELECT COALESCE(SUM((item->>'total_price')::DECIMAL(10, 2) * 100), 0)::BIGINT INTO v_taxable
+        FROM jsonb_array_elements(v_items) AS item
+        WHERE NOT EXISTS (
+            SELECT 1
+            FROM jsonb_array_elements_text(COALESCE(v_rate->'exempt_categories', '[]'::JSONB)) AS exempt
+            WHERE lower(exempt) = lower(item->>'category')
+        );
+        CONTINUE WHEN v_taxable = 0;
+
+        IF v_inclusive THEN
+            v_amount := (2 * v_taxable * v_bps + 10000 + v_bps) / (2 * (10000 + v_bps));
+        ELSE
+            v_amount := (v_taxable * v_bps + 5000) / 10000;
+        END IF;
+        v_tax := v_tax + v_amount;
+        v_tax_lines := v_tax_lines || jsonb_build_array(
+            jsonb_build_object(
+                'name', v_rate->>'name',
+                'rate_bps', v_bps,
+                'taxable', jsonb_build_object('amount', v_taxable, 'currency', v_currency),
+                'amount', jsonb_build_object('amount', v_amount, 'currency', v_currency)
+            )
+        );
+    END LOOP;
+    IF NOT v_inclusive THEN
+        v_total := v_total + v_tax / 100.0;
+    END IF;
+
+    INSERT INTO orders (
+        id, client_id, veterinarian_id, total_amount, currency, tax_amount, tax_inclusive,
+        tax_lines, status, payment_status, payment_method, shipping_address, delivery_method,
+        notes, checkout_group_id, created_at, updated_at
+    )
+    VALUES (
+        (p_order->>'id')::UUID,
+        (p_order->>'client_id')::UUID,
+        v_vet_id,
+        v_total,
+        v_currency,
+        v_tax / 100.0,
+        v_inclusive,
+        v_tax_lines,
+        COALESCE(p_order->>'status', 'pending'),
+        COALESCE(p_order->>'payment_status', 'pending'),
+        p_order->>'payment_method',
+        p_order->>'shipping_address',
+        COALESCE(p_order->>'delivery_method', 'pickup'),
+        p_order->>'notes',
+        (p_order->>'checkout_group_id')::UUID,
+        COALESCE((p_order->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_order->>'updated_at')::TIMESTAMPTZ, NOW())
+    );
+
+    INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price, currency)
+    SELECT (item->>'id')::UUID,
+        (p_order->>'id')::UUID,
+        (item->>'product_id')::UUID,
+        (item->>'quantity')::INTEGER,
+        (item->>'unit_price')::DECIMAL(10, 2),
+        (item->>'total_price')::DECIMAL(10, 2),
+        v_currency
+    FROM jsonb_array_elements(v_items) AS item;
+
+    INSERT INTO stock_movements (product_id, type, quantity, balance_after, actor_id, order_id)
+    SELECT (sale->>'product_id')::UUID,
+        'sale',
+        (sale->>'quantity')::INTEGER,
+        (sale->>'balance_after')::INTEGER,
+        p_order->>'client_id',
+        (p_order->>'id')::UUID
+    FROM jsonb_array_elements(v_sales) AS sale;
+
+    RETURN jsonb_build_object(
+        'total_amount', v_total,
+        'tax_amount', v_tax / 100.0,
+        'tax_inclusive', v_inclusive,
+        'tax_lines', v_tax_lines,
+        'currency', v_currency,
+        'items', v_items
+    );
+END;
+$$;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS discounts;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_amount;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_code;
+
+DROP TABLE IF EXISTS promotions;
@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS revoke_admin(UUID);
+DROP VIEW IF EXISTS user_accounts;
+DROP TABLE IF EXISTS user_suspensions;
+DROP TABLE IF EXISTS admins;
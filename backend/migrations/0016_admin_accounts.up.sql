@@ -0,0 +1,57 @@
+-- Admin registry: users granted the admin role, whatever profile they have.
+-- Admins added by ID alone have no profile, so the registry keeps an email
+-- and name to show for them. granted_by has no foreign key so grants outlive
+-- the admins who made them, and is empty for admins bootstrapped at startup.
+CREATE TABLE IF NOT EXISTS admins (
+    user_id UUID PRIMARY KEY,
+    email TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL DEFAULT '',
+    granted_by TEXT NOT NULL DEFAULT '',
+    granted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Suspended accounts, which the API refuses to serve until reactivated
+CREATE TABLE IF NOT EXISTS user_suspensions (
+    user_id UUID PRIMARY KEY,
+    reason TEXT NOT NULL DEFAULT '',
+    suspended_by TEXT NOT NULL DEFAULT '',
+    suspended_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Every user with the role they act in: admin while in the registry,
+-- otherwise their profile's. profile is the role of their client or
+-- veterinarian profile, empty for admins without one.
+CREATE OR REPLACE VIEW user_accounts AS
+SELECT COALESCE(p.id, a.user_id)::TEXT AS id,
+    COALESCE(p.email, a.email) AS email,
+    CASE WHEN a.user_id IS NULL THEN p.role ELSE 'admin' END AS role,
+    COALESCE(p.role, '') AS profile,
+    s.suspended_at,
+    COALESCE(s.reason, '') AS suspension_reason
+FROM (
+    SELECT id, email, COALESCE(role, 'client') AS role FROM clients
+    WHERE deleted_at IS NULL
+    UNION ALL
+    SELECT id, email, COALESCE(role, 'veterinarian') FROM veterinarians
+    WHERE deleted_at IS NULL
+) p
+FULL JOIN admins a ON a.user_id = p.id
+LEFT JOIN user_suspensions s ON s.user_id = COALESCE(p.id, a.user_id);
+
+-- revoke_admin removes a user from the registry unless they are the last
+-- admin. Locking the registry first keeps two admins from demoting each
+-- other at once and leaving none.
+CREATE OR REPLACE FUNCTION revoke_admin(p_user_id UUID) RETURNS VOID LANGUAGE plpgsql AS $$
+DECLARE
+    v_admins INTEGER;
+BEGIN
+    SELECT count(*) INTO v_admins FROM (SELECT user_id FROM admins FOR UPDATE) locked;
+    IF NOT EXISTS (SELECT 1 FROM admins WHERE user_id = p_user_id) THEN
+        RAISE EXCEPTION 'admin % not found', p_user_id USING ERRCODE = 'P0002';
+    END IF;
+    IF v_admins <= 1 THEN
+        RAISE EXCEPTION 'cannot remove the last admin' USING ERRCODE = 'PS010';
+    END IF;
+    DELETE FROM admins WHERE user_id = p_user_id;
+END;
+$$;
@@ -0,0 +1,24 @@
+-- Pet access grants: a pet's owner lets another client act for the pet as
+-- co-owner or caretaker, with the permissions listed. Grants lapse at
+-- expires_at when set and end for good when revoked; revoked grants are kept
+-- so owners can see who had access. created_by has no foreign key so grants
+-- outlive the owner or admin who made them.
+CREATE TABLE IF NOT EXISTS pet_access_grants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pet_id UUID NOT NULL REFERENCES pets(id) ON DELETE CASCADE,
+    owner_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    grantee_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    grantee_email TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL CHECK (role IN ('co_owner', 'caretaker')),
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- A client holds at most one unrevoked grant per pet
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pet_access_grants_grantee_pet
+    ON pet_access_grants(pet_id, grantee_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_pet_access_grants_grantee
+    ON pet_access_grants(grantee_id, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_appointments_pet_vet;
+DROP TABLE IF EXISTS record_consents;
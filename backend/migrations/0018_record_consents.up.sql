@@ -0,0 +1,24 @@
+-- Record consents: what lets a veterinarian without an appointment for a pet
+-- see its medical history. Owners grant access explicitly; veterinarians
+-- can also take short-lived break-glass access in an emergency, which must
+-- be justified. Both lapse at expires_at when set and end when revoked;
+-- revoked ones are kept so owners can see who had access. created_by has no
+-- foreign key so consents outlive whoever made them.
+CREATE TABLE IF NOT EXISTS record_consents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pet_id UUID NOT NULL REFERENCES pets(id) ON DELETE CASCADE,
+    owner_id UUID NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+    veterinarian_id UUID NOT NULL REFERENCES veterinarians(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('owner_grant', 'break_glass')),
+    justification TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (kind <> 'break_glass' OR (justification <> '' AND expires_at IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_record_consents_pet ON record_consents(pet_id, veterinarian_id);
+
+-- Consent through an appointment is looked up by pet and veterinarian
+CREATE INDEX IF NOT EXISTS idx_appointments_pet_vet ON appointments(pet_id, veterinarian_id);
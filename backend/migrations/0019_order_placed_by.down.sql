@@ -0,0 +1,280 @@
+-- Restore the 0015 place_order, which does not store who placed the order
+CREATE OR REPLACE FUNCTION place_order(p_order JSONB, p_items JSONB) RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_vet_id UUID := (p_order->>'veterinarian_id')::UUID;
+    v_line JSONB;
+    v_qty INTEGER;
+    v_price DECIMAL(10, 2);
+    v_product products %ROWTYPE;
+    v_total DECIMAL(10, 2) := 0;
+    v_currency TEXT;
+    v_items JSONB := '[]'::JSONB;
+    v_sales JSONB := '[]'::JSONB;
+    v_settings tax_settings%ROWTYPE;
+    v_inclusive BOOLEAN;
+    v_rate JSONB;
+    v_bps BIGINT;
+    v_taxable BIGINT;
+    v_amount BIGINT;
+    v_tax BIGINT := 0;
+    v_tax_lines JSONB := '[]'::JSONB;
+    v_code TEXT := NULLIF(upper(btrim(p_order->>'discount_code')), '');
+    v_group TEXT := NULLIF(p_order->>'checkout_group_id', '');
+    v_ordered BOOLEAN;
+    v_ordered_from_vet BOOLEAN;
+    v_promotion promotions%ROWTYPE;
+    v_item JSONB;
+    v_covers BOOLEAN;
+    v_spend BIGINT;
+    v_left BIGINT;
+    v_off BIGINT;
+    v_discounted JSONB;
+    v_discount BIGINT := 0;
+    v_discounts JSONB := '[]'::JSONB;
+BEGIN
+    IF jsonb_array_length(p_items) = 0 THEN
+        RAISE EXCEPTION 'at least one item is required' USING ERRCODE = 'PS002';
+    END IF;
+
+    -- Lock product rows in a stable order to avoid deadlocks between checkouts
+    FOR v_line IN
+        SELECT value FROM jsonb_array_elements(p_items) ORDER BY value->>'product_id'
+    LOOP
+        v_qty := (v_line->>'quantity')::INTEGER;
+        IF v_qty IS NULL OR v_qty <= 0 THEN
+            RAISE EXCEPTION 'item quantity must be greater than 0' USING ERRCODE = 'PS002';
+        END IF;
+
+        UPDATE products
+        SET stock_quantity = stock_quantity - v_qty,
+            updated_at = NOW()
+        WHERE id = (v_line->>'product_id')::UUID
+            AND is_active
+            AND stock_quantity - reserved_stock(id) >= v_qty
+        RETURNING * INTO v_product;
+
+        IF NOT FOUND THEN
+            SELECT * INTO v_product FROM products
+            WHERE id = (v_line->>'product_id')::UUID AND is_active;
+            IF NOT FOUND THEN
+                RAISE EXCEPTION 'product % not found', v_line->>'product_id' USING ERRCODE = 'P0002';
+            END IF;
+            RAISE EXCEPTION 'insufficient stock for product %', v_product.id USING
+                ERRCODE = 'PS001',
+                DETAIL = jsonb_build_object(
+                    'product_id', v_product.id,
+                    'requested', v_qty,
+                    'available', COALESCE(v_product.stock_quantity, 0) - reserved_stock(v_product.id)
+                )::TEXT;
+        END IF;
+
+        IF v_product.veterinarian_id <> v_vet_id THEN
+            RAISE EXCEPTION 'all products must be from the same veterinarian' USING ERRCODE = 'PS002';
+        END IF;
+        IF v_currency IS NULL THEN
+            v_currency := v_product.currency;
+        ELSIF v_product.currency <> v_currency THEN
+            RAISE EXCEPTION 'all products must be priced in the same currency' USING ERRCODE = 'PS002';
+        END IF;
+
+        v_price := v_product.price;
+        v_total := v_total + v_price * v_qty;
+        v_items := v_items || jsonb_build_array(
+            jsonb_build_object(
+                'id', v_line->>'id',
+                'product_id', v_product.id,
+                'quantity', v_qty,
+                'unit_price', v_price,
+                'total_price', v_price * v_qty,
+                'category', COALESCE(v_product.category, ''),
+                'discount', 0
+            )
+        );
+        v_sales := v_sales || jsonb_build_array(
+            jsonb_build_object(
+                'product_id', v_product.id,
+                'quantity', -v_qty,
+                'balance_after', v_product.stock_quantity
+            )
+        );
+    END LOOP;
+
+    -- Promotions, as store.applyPromotions applies them: automatic ones
+    -- oldest first, then the discount code, each taking its cut in cents of
+    -- what the earlier ones left of the items it covers. v_items is in product
+    -- order, which is the order fixed amounts are taken in.
+    SELECT COUNT(*) > 0, COUNT(*) FILTER (WHERE veterinarian_id = v_vet_id) > 0
+    INTO v_ordered, v_ordered_from_vet
+    FROM orders
+    WHERE client_id = (p_order->>'client_id')::UUID
+        AND COALESCE(status, 'pending') <> 'cancelled'
+        AND (v_group IS NULL OR checkout_group_id IS NULL OR checkout_group_id::TEXT <> v_group);
+
+    FOR v_promotion IN
+        SELECT * FROM promotions
+        WHERE active AND (veterinarian_id = v_vet_id OR veterinarian_id IS NULL)
+            AND (starts_at IS NULL OR starts_at <= NOW()) AND (ends_at IS NULL OR ends_at > NOW())
+            AND (code IS NULL OR code = v_code)
+        ORDER BY code IS NOT NULL, created_at, id
+    LOOP
+        CONTINUE WHEN v_promotion.first_order_only AND CASE
+            WHEN v_promotion.veterinarian_id IS NULL THEN v_ordered
+            ELSE v_ordered_from_vet
+        END;
+        CONTINUE WHEN v_promotion.currency IS NOT NULL AND v_promotion.currency <> v_currency;
+
+        v_spend := 0;
+        v_left := (v_promotion.amount * 100)::BIGINT;
+        v_amount := 0;
+        v_discounted := '[]'::JSONB;
+        FOR v_item IN SELECT value FROM jsonb_array_elements(v_items)
+        LOOP
+            v_covers := (cardinality(v_promotion.product_ids) = 0 AND cardinality(v_promotion.categories) = 0)
+                OR v_item->>'product_id' = ANY(v_promotion.product_ids)
+                OR EXISTS (
+                    SELECT 1 FROM unnest(v_promotion.categories) AS category
+                    WHERE lower(category) = lower(v_item->>'category')
+                );
+            v_off := 0;
+            IF v_covers THEN
+                v_spend := v_spend + ((v_item->>'total_price')::DECIMAL(10, 2) * 100)::BIGINT;
+                v_off := ((v_item->>'total_price')::DECIMAL(10, 2) * 100)::BIGINT
+                    - (v_item->>'discount')::BIGINT;
+                IF v_promotion.kind = 'percent' THEN
+                    v_off := (v_off * v_promotion.percent_bps + 5000) / 10000;
+                ELSE
+                    v_off := LEAST(v_left, v_off);
+                    v_left := v_left - v_off;
+                END IF;
+            END IF;
+            v_amount := v_amount + v_off;
+            v_discounted := v_discounted || jsonb_build_array(
+                jsonb_set(v_item, '{discount}', to_jsonb((v_item->>'discount')::BIGINT + v_off))
+            );
+        END LOOP;
+        CONTINUE WHEN v_spend = 0 OR v_spend < (v_promotion.min_spend * 100)::BIGINT OR v_amount = 0;
+
+        -- Take one use, unless the cap is reached
+        UPDATE promotions
+        SET usage_count = usage_count + 1,
+            updated_at = NOW()
+        WHERE id = v_promotion.id
+            AND (usage_limit = 0 OR usage_count < usage_limit);
+        IF NOT FOUND THEN
+            IF v_promotion.code IS NOT NULL THEN
+                RAISE EXCEPTION 'code % has been used up', v_promotion.code USING ERRCODE = 'PS009';
+            END IF;
+            CONTINUE;
+        END IF;
+
+        v_items := v_discounted;
+        v_discount := v_discount + v_amount;
+        v_discounts := v_discounts || jsonb_build_array(
+            jsonb_build_object(
+                'promotion_id', v_promotion.id,
+                'code', v_promotion.code,
+                'name', v_promotion.name,
+                'amount', jsonb_build_object('amount', v_amount, 'currency', v_currency)
+            )
+        );
+    END LOOP;
+
+    -- Tax in cents, as store.applyTax works it out: each rate on the items
+    -- it does not exempt, less their discounts, rounded half up, added on
+    -- top unless inclusive
+    SELECT * INTO v_settings FROM tax_settings WHERE veterinarian_id = v_vet_id;
+    v_inclusive := COALESCE(v_settings.inclusive, false);
+    FOR v_rate IN SELECT value FROM jsonb_array_elements(COALESCE(v_settings.rates, '[]'::JSONB))
+    LOOP
+        v_bps := (v_rate->>'rate_bps')::BIGINT;
+        SELECT COALESCE(SUM((item->>'total_price')::DECIMAL(10, 2) * 100
+            - (item->>'discount')::BIGINT), 0)::BIGINT INTO v_taxable
+        FROM jsonb_array_elements(v_items) AS item
+        WHERE NOT EXISTS (
+            SELECT 1
+            FROM jsonb_array_elements_text(COALESCE(v_rate->'exempt_categories', '[]'::JSONB)) AS exempt
+            WHERE lower(exempt) = lower(item->>'category')
+        );
+        CONTINUE WHEN v_taxable = 0;
+
+        IF v_inclusive THEN
+            v_amount := (2 * v_taxable * v_bps + 10000 + v_bps) / (2 * (10000 + v_bps));
+        ELSE
+            v_amount := (v_taxable * v_bps + 5000) / 10000;
+        END IF;
+        v_tax := v_tax + v_amount;
+        v_tax_lines := v_tax_lines || jsonb_build_array(
+            jsonb_build_object(
+                'name', v_rate->>'name',
+                'rate_bps', v_bps,
+                'taxable', jsonb_build_object('amount', v_taxable, 'currency', v_currency),
+                'amount', jsonb_build_object('amount', v_amount, 'currency', v_currency)
+            )
+        );
+    END LOOP;
+    v_total := v_total - v_discount / 100.0;
+    IF NOT v_inclusive THEN
+        v_total := v_total + v_tax / 100.0;
+    END IF;
+
+    INSERT INTO orders (
+        id, client_id, veterinarian_id, total_amount, currency, tax_amount, tax_inclusive,
+        tax_lines, discount_code, discount_amount, discounts, status, payment_status, payment_method, shipping_address, delivery_method,
+        notes, checkout_group_id, created_at, updated_at
+    )
+    VALUES (
+        (p_order->>'id')::UUID,
+        (p_order->>'client_id')::UUID,
+        v_vet_id,
+        v_total,
+        v_currency,
+        v_tax / 100.0,
+        v_inclusive,
+        v_tax_lines,
+        v_code,
+        v_discount / 100.0,
+        v_discounts,
+        COALESCE(p_order->>'status', 'pending'),
+        COALESCE(p_order->>'payment_status', 'pending'),
+        p_order->>'payment_method',
+        p_order->>'shipping_address',
+        COALESCE(p_order->>'delivery_method', 'pickup'),
+        p_order->>'notes',
+        (p_order->>'checkout_group_id')::UUID,
+        COALESCE((p_order->>'created_at')::TIMESTAMPTZ, NOW()),
+        COALESCE((p_order->>'updated_at')::TIMESTAMPTZ, NOW())
+    );
+
+    INSERT INTO order_items (id, order_id, product_id, quantity, unit_price, total_price, currency)
+    SELECT (item->>'id')::UUID,
+        (p_order->>'id')::UUID,
+        (item->>'product_id')::UUID,
+        (item->>'quantity')::INTEGER,
+        (item->>'unit_price')::DECIMAL(10, 2),
+        (item->>'total_price')::DECIMAL(10, 2),
+        v_currency
+    FROM jsonb_array_elements(v_items) AS item;
+
+    INSERT INTO stock_movements (product_id, type, quantity, balance_after, actor_id, order_id)
+    SELECT (sale->>'product_id')::UUID,
+        'sale',
+        (sale->>'quantity')::INTEGER,
+        (sale->>'balance_after')::INTEGER,
+        p_order->>'client_id',
+        (p_order->>'id')::UUID
+    FROM jsonb_array_elements(v_sales) AS sale;
+
+    RETURN jsonb_build_object(
+        'total_amount', v_total,
+        'tax_amount', v_tax / 100.0,
+        'tax_inclusive', v_inclusive,
+        'tax_lines', v_tax_lines,
+        'discount_amount', v_discount / 100.0,
+        'discounts', v_discounts,
+        'currency', v_currency,
+        'items', v_items
+    );
+END;
+$$;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS placed_by;
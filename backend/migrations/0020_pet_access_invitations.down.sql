@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_pet_access_grants_invitation;
+
+-- Unclaimed invitations have no client to keep them for
+DELETE FROM pet_access_grants WHERE grantee_id IS NULL;
+ALTER TABLE pet_access_grants ALTER COLUMN grantee_id SET NOT NULL;
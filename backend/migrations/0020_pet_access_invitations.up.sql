@@ -0,0 +1,8 @@
+-- Owners can invite an email no client has yet. The invitation is a grant
+-- without a grantee_id until a client signs up with that email and claims
+-- it, so inviting does not tell owners whether an account exists.
+ALTER TABLE pet_access_grants ALTER COLUMN grantee_id DROP NOT NULL;
+
+-- An email holds at most one unrevoked invitation per pet
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pet_access_grants_invitation
+    ON pet_access_grants(pet_id, grantee_email) WHERE grantee_id IS NULL AND revoked_at IS NULL;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS update_product_with_stock(JSONB, JSONB);
@@ -0,0 +1,70 @@
+-- update_product_with_stock saves a product's fields and brings its stock to
+-- p_product's stock_quantity in one transaction, used by the Supabase store
+-- (POST /rpc/update_product_with_stock). The product row is locked before the
+-- adjustment is worked out, so a concurrent movement cannot make it stale. A
+-- non-zero version in p_product must still be current. Raises PS011 (version
+-- conflict) or P0002 (not found). Returns the new version and the recorded
+-- adjustment, which is null when the stock already matched.
+CREATE OR REPLACE FUNCTION update_product_with_stock(p_product JSONB, p_movement JSONB)
+RETURNS JSONB LANGUAGE plpgsql AS $$
+DECLARE
+    v_product_id UUID := (p_product->>'id')::UUID;
+    v_version INTEGER := COALESCE((p_product->>'version')::INTEGER, 0);
+    v_stock INTEGER := (p_product->>'stock_quantity')::INTEGER;
+    v_current products %ROWTYPE;
+    v_qty INTEGER;
+    v_movement stock_movements %ROWTYPE;
+BEGIN
+    SELECT * INTO v_current FROM products
+    WHERE id = v_product_id AND deleted_at IS NULL
+    FOR UPDATE;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'product % not found', v_product_id USING ERRCODE = 'P0002';
+    END IF;
+    IF v_version <> 0 AND v_current.version <> v_version THEN
+        RAISE EXCEPTION 'product % has changed', v_product_id USING ERRCODE = 'PS011';
+    END IF;
+    v_qty := v_stock - COALESCE(v_current.stock_quantity, 0);
+
+    UPDATE products
+    SET name = p_product->>'name',
+        description = p_product->>'description',
+        category = p_product->>'category',
+        price = (p_product->>'price')::DECIMAL(10, 2),
+        currency = p_product->>'currency',
+        sku = NULLIF(p_product->>'sku', ''),
+        brand = p_product->>'brand',
+        weight = (p_product->>'weight')::DECIMAL(5, 2),
+        dimensions = p_product->'dimensions',
+        is_prescription_required = (p_product->>'is_prescription_required')::BOOLEAN,
+        is_active = (p_product->>'is_active')::BOOLEAN,
+        images = CASE WHEN jsonb_typeof(p_product->'images') = 'array'
+            THEN ARRAY(SELECT jsonb_array_elements_text(p_product->'images')) END,
+        stock_quantity = v_stock,
+        updated_at = NOW()
+    WHERE id = v_product_id
+    RETURNING version INTO v_version;
+
+    IF v_qty = 0 THEN
+        RETURN jsonb_build_object('version', v_version, 'movement', NULL);
+    END IF;
+
+    INSERT INTO stock_movements (
+        id, product_id, type, quantity, balance_after, reason, actor_id, order_id, created_at
+    )
+    VALUES (
+        (p_movement->>'id')::UUID,
+        v_product_id,
+        'adjustment',
+        v_qty,
+        v_stock,
+        COALESCE(p_movement->>'reason', ''),
+        COALESCE(p_movement->>'actor_id', ''),
+        NULL,
+        COALESCE((p_movement->>'created_at')::TIMESTAMPTZ, NOW())
+    )
+    RETURNING * INTO v_movement;
+
+    RETURN jsonb_build_object('version', v_version, 'movement', to_jsonb(v_movement));
+END;
+$$;
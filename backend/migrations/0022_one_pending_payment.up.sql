@@ -0,0 +1,15 @@
+-- An order has at most one pending payment attempt, so two requests racing to
+-- pay it cannot both start one. Attempts that already collided are failed,
+-- keeping the newest.
+UPDATE payments p
+SET status = 'failed', failure_reason = 'superseded', updated_at = NOW()
+WHERE p.status = 'pending'
+    AND EXISTS (
+        SELECT 1 FROM payments newer
+        WHERE newer.order_id = p.order_id
+            AND newer.status = 'pending'
+            AND (newer.created_at, newer.id) > (p.created_at, p.id)
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_pending_order
+    ON payments(order_id) WHERE status = 'pending';
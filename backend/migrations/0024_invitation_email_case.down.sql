@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_pet_access_grants_invitation;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pet_access_grants_invitation
+    ON pet_access_grants(pet_id, grantee_email) WHERE grantee_id IS NULL AND revoked_at IS NULL;
@@ -0,0 +1,19 @@
+-- Invitation emails match clients whatever their case, so an email holds at
+-- most one unrevoked invitation per pet in any case. Invitations that already
+-- differ only in case are revoked, keeping the newest.
+UPDATE pet_access_grants g
+SET revoked_at = NOW()
+WHERE g.grantee_id IS NULL AND g.revoked_at IS NULL
+    AND EXISTS (
+        SELECT 1 FROM pet_access_grants newer
+        WHERE newer.pet_id = g.pet_id
+            AND newer.grantee_id IS NULL
+            AND newer.revoked_at IS NULL
+            AND lower(newer.grantee_email) = lower(g.grantee_email)
+            AND (newer.created_at, newer.id) > (g.created_at, g.id)
+    );
+
+DROP INDEX IF EXISTS idx_pet_access_grants_invitation;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pet_access_grants_invitation
+    ON pet_access_grants(pet_id, lower(grantee_email))
+    WHERE grantee_id IS NULL AND revoked_at IS NULL;
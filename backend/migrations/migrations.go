@@ -0,0 +1,13 @@
+// Package migrations embeds the versioned SQL schema migrations.
+//
+// Files are named NNNN_name.up.sql and NNNN_name.down.sql. Create new ones
+// with `go run ./cmd/migrate create <name>`; never edit a migration that has
+// already been applied, since its checksum is recorded in schema_migrations.
+package migrations
+
+import "embed"
+
+// FS holds every *.sql file in this directory
+//
+//go:embed *.sql
+var FS embed.FS
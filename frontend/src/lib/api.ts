@@ -16,3 +16,13 @@ export function apiFetch(path: string, init?: RequestInit): Promise<Response> {
 }
 
 
+
+/**
+ * Returns the If-Match header value for updating an entity last seen at `version`.
+ * The API answers 412 when someone else changed it since. Without the version the edit
+ * was made against there is nothing safe to send, so the caller must reload the entity.
+ */
+export function ifMatch(version?: number): string {
+  if (!version) throw new Error('This item has changed or was not loaded; reload it and try again')
+  return `"${version}"`
+}
@@ -8,21 +8,59 @@ export function cn(...inputs: ClassValue[]) {
   return twMerge(clsx(inputs))
 }
 
+/** Currency the shop prices in, and the API's default for amounts sent without one. */
+export const DEFAULT_CURRENCY = 'PHP'
+
 /**
- * Format a number into Philippine Peso (PHP) currency.
- * Keeps it chill: just pass a number, get a `₱` string.
+ * Money as the API sends prices and totals: `amount` in cents (hundredths of the
+ * major unit) with its ISO 4217 `currency`, e.g. `{ amount: 1999, currency: 'PHP' }`.
  */
-export function formatPHP(amount: number): string {
+export interface Money {
+  amount: number
+  currency: string
+}
+
+/** Money of `major` units, such as 19.99, rounded to the nearest cent. */
+export function moneyFromMajor(major: number, currency = DEFAULT_CURRENCY): Money {
+  return { amount: Math.round((isFinite(major) ? major : 0) * 100), currency }
+}
+
+/** Money times `n`, such as a unit price times a quantity. */
+export function mulMoney(m: Money, n: number): Money {
+  return { amount: m.amount * n, currency: m.currency }
+}
+
+/**
+ * Sum amounts; missing ones count as nothing. The shop prices everything in one
+ * currency, so the total takes the first amount's currency.
+ */
+export function sumMoney(values: Array<Money | null | undefined>): Money {
+  let total: Money = { amount: 0, currency: DEFAULT_CURRENCY }
+  let first = true
+  for (const v of values) {
+    if (!v) continue
+    total = { amount: total.amount + v.amount, currency: first ? v.currency : total.currency }
+    first = false
+  }
+  return total
+}
+
+/**
+ * Format Money in its currency, e.g. `₱1,999.00`. Missing amounts show as zero pesos.
+ */
+export function formatMoney(m?: Money | null): string {
+  const amount = (m?.amount ?? 0) / 100
+  const currency = m?.currency || DEFAULT_CURRENCY
   try {
-    return new Intl.NumberFormat('en-PH', { style: 'currency', currency: 'PHP' }).format(amount)
+    return new Intl.NumberFormat('en-PH', { style: 'currency', currency }).format(amount)
   } catch {
     const safe = isFinite(amount) ? amount : 0
     // Fallback: manual format with comma separators
     const parts = safe.toFixed(2).split('.')
     parts[0] = parts[0].replace(/\B(?=(\d{3})+(?!\d))/g, ',')
-    return `₱${parts.join('.')}`
+    return `${currency === 'PHP' ? '₱' : currency + ' '}${parts.join('.')}`
   }
-} 
+}
 
 /**
  * formatTimeHM returns hh:mm AM/PM for a given ISO datetime string.
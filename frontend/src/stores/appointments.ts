@@ -1,6 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { useAuthStore } from './auth'
+import { ifMatch } from '@/lib/api'
 
 // Types for appointments
 export interface Appointment {
@@ -15,6 +16,7 @@ export interface Appointment {
   notes?: string
   created_at: string
   updated_at: string
+  version: number
 }
 
 export interface CreateAppointmentRequest {
@@ -160,11 +162,14 @@ export const useAppointmentsStore = defineStore('appointments', () => {
     error.value = null
 
     try {
-      const response = await fetch(`${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/appointments/${encodeURIComponent(id)}`, {
+      const url = `${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/appointments/${encodeURIComponent(id)}`
+      const version = appointments.value.find(a => a.id === id)?.version
+      const response = await fetch(url, {
         method: 'PUT',
         headers: {
           'Authorization': `Bearer ${authStore.session.access_token}`,
           'Content-Type': 'application/json',
+          'If-Match': ifMatch(version),
         },
         body: JSON.stringify(updates),
       })
@@ -254,13 +259,13 @@ export const useAppointmentsStore = defineStore('appointments', () => {
   /**
    * List veterinarians for booking UI.
    */
-  const listVeterinarians = async (limit = 10, offset = 0) => {
+  const listVeterinarians = async (limit = 20, cursor = '') => {
     if (!authStore.session?.access_token) {
       throw new Error('No authentication token')
     }
 
     const response = await fetch(
-      `${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/veterinarians?limit=${limit}&offset=${offset}`,
+      `${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/veterinarians?limit=${limit}${cursor ? `&cursor=${encodeURIComponent(cursor)}` : ''}`,
       {
         headers: {
           'Authorization': `Bearer ${authStore.session.access_token}`,
@@ -1,13 +1,14 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
+import { moneyFromMajor, mulMoney, sumMoney, type Money } from '@/lib/utils'
 
 export interface CartItem {
   /** Unique product id */
   productId: string
   /** Display name for quick rendering */
   name: string
-  /** Unit price in PHP */
-  price: number
+  /** Unit price */
+  price: Money
   /** Quantity selected */
   quantity: number
   /** Optional small image URL */
@@ -24,7 +25,11 @@ export const useCartStore = defineStore('cart', () => {
   function loadFromStorage(): void {
     try {
       const raw = localStorage.getItem('petmgt:cart')
-      if (raw) items.value = JSON.parse(raw)
+      if (raw) {
+        // Carts saved before prices carried a currency hold plain pesos
+        items.value = (JSON.parse(raw) as Array<Omit<CartItem, 'price'> & { price: Money | number }>)
+          .map(i => ({ ...i, price: typeof i.price === 'number' ? moneyFromMajor(i.price) : i.price }))
+      }
     } catch {
       items.value = []
     }
@@ -72,7 +77,7 @@ export const useCartStore = defineStore('cart', () => {
 
   const itemCount = computed(() => items.value.reduce((sum, i) => sum + i.quantity, 0))
   const distinctCount = computed(() => items.value.length)
-  const subtotal = computed(() => items.value.reduce((sum, i) => sum + i.price * i.quantity, 0))
+  const subtotal = computed(() => sumMoney(items.value.map(i => mulMoney(i.price, i.quantity))))
 
   /** Serialize items for API consumption */
   function toCheckoutPayload(): Array<{ product_id: string; quantity: number }> {
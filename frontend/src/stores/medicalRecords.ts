@@ -1,6 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref } from 'vue'
 import { useAuthStore } from './auth'
+import { ifMatch } from '@/lib/api'
 
 export interface MedicalRecord {
   id: string
@@ -14,6 +15,7 @@ export interface MedicalRecord {
   notes: string
   created_at: string
   updated_at: string
+  version: number
 }
 
 export interface CreateMedicalRecordRequest {
@@ -143,11 +145,14 @@ export const useMedicalRecordsStore = defineStore('medicalRecords', () => {
     error.value = null
 
     try {
-      const response = await fetch(`${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/medical-records/${encodeURIComponent(recordId)}`, {
+      const cached = Object.values(recordsByPetId.value).flat().find(r => r.id === recordId)
+      const url = `${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/medical-records/${encodeURIComponent(recordId)}`
+      const response = await fetch(url, {
         method: 'PUT',
         headers: {
           Authorization: `Bearer ${authStore.session.access_token}`,
           'Content-Type': 'application/json',
+          'If-Match': ifMatch(cached?.version),
         },
         body: JSON.stringify(updates),
       })
@@ -1,21 +1,22 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { useAuthStore } from './auth'
+import { sumMoney, type Money } from '@/lib/utils'
 
 export interface OrderItem {
   id: string
   order_id: string
   product_id: string
   quantity: number
-  unit_price: number
-  total_price: number
+  unit_price: Money
+  total_price: Money
 }
 
 export interface Order {
   id: string
   client_id: string
   veterinarian_id: string
-  total_amount: number
+  total_amount: Money
   status: string
   payment_status: string
   created_at: string
@@ -95,12 +96,12 @@ export const useOrdersStore = defineStore('orders', () => {
   const revenueForMonth = (dateInMonth: Date) => {
     const y = dateInMonth.getFullYear()
     const m = dateInMonth.getMonth()
-    return orders.value
+    return sumMoney(orders.value
       .filter(o => {
         const d = new Date(o.created_at)
         return d.getFullYear() === y && d.getMonth() === m && o.status !== 'cancelled'
       })
-      .reduce((sum, o) => sum + (o.total_amount || 0), 0)
+      .map(o => o.total_amount))
   }
 
   /**
@@ -114,14 +115,14 @@ export const useOrdersStore = defineStore('orders', () => {
       const t = new Date(o.created_at).getTime()
       return t >= startMs && t <= endMs && o.status !== 'cancelled'
     })
-    const productIdToTotals: Record<string, { quantity: number; revenue: number }> = {}
+    const productIdToTotals: Record<string, { quantity: number; revenue: Money }> = {}
     for (const o of relevant) {
       try {
         const items = await fetchOrderItems(o.id)
         for (const it of items) {
-          const bucket = productIdToTotals[it.product_id] || { quantity: 0, revenue: 0 }
+          const bucket = productIdToTotals[it.product_id] || { quantity: 0, revenue: sumMoney([]) }
           bucket.quantity += it.quantity
-          bucket.revenue += it.total_price
+          bucket.revenue = sumMoney([bucket.revenue, it.total_price])
           productIdToTotals[it.product_id] = bucket
         }
       } catch (_) {}
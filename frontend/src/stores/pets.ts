@@ -1,6 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { useAuthStore } from './auth'
+import { ifMatch } from '@/lib/api'
 
 // Types for pets
 export interface Pet {
@@ -13,6 +14,7 @@ export interface Pet {
   owner_id: string
   created_at: string
   updated_at: string
+  version: number
 }
 
 export interface CreatePetRequest {
@@ -155,11 +157,14 @@ export const usePetsStore = defineStore('pets', () => {
     error.value = null
 
     try {
-      const response = await fetch(`${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/pets/${petId}`, {
+      const url = `${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/pets/${petId}`
+      const version = pets.value.find(pet => pet.id === petId)?.version
+      const response = await fetch(url, {
         method: 'PUT',
         headers: {
           'Authorization': `Bearer ${authStore.session.access_token}`,
-          'Content-Type': 'application/json'
+          'Content-Type': 'application/json',
+          'If-Match': ifMatch(version)
         },
         body: JSON.stringify(updates)
       })
@@ -1,6 +1,8 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { useAuthStore } from './auth'
+import { ifMatch } from '@/lib/api'
+import type { Money } from '@/lib/utils'
 
 export interface Product {
   id: string
@@ -8,12 +10,13 @@ export interface Product {
   name: string
   description?: string
   category?: string
-  price: number
+  price: Money
   stock_quantity: number
   is_active: boolean
   images?: string[]
   created_at: string
   updated_at: string
+  version: number
 }
 
 /** Simple product store to list vet products for dashboard widgets. */
@@ -82,9 +85,12 @@ export const useProductsStore = defineStore('products', () => {
   /** Update a product by id (vet/admin). */
   const updateProduct = async (id: string, updates: Partial<Product>) => {
     if (!auth.session?.access_token) throw new Error('No authentication token')
-    const res = await fetch(`${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/products/${encodeURIComponent(id)}`, {
+    const version = products.value.find(p => p.id === id)?.version
+    const url = `${import.meta.env.VITE_API_URL ?? 'http://localhost:3000'}/api/v1/products/${encodeURIComponent(id)}`
+    const tag = ifMatch(version)
+    const res = await fetch(url, {
       method: 'PUT',
-      headers: { 'Authorization': `Bearer ${auth.session.access_token}`, 'Content-Type': 'application/json' },
+      headers: { 'Authorization': `Bearer ${auth.session.access_token}`, 'Content-Type': 'application/json', 'If-Match': tag },
       body: JSON.stringify(updates),
     })
     if (!res.ok) throw new Error((await res.json().catch(() => ({}))).message || res.statusText)